@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"relay/internal/analytics"
+	"relay/internal/cluster"
+	"relay/internal/config"
+	"relay/internal/dashboard"
+	"relay/internal/dispatch"
+	"relay/internal/display"
+	"relay/internal/message"
+	"relay/internal/server"
+	"relay/internal/signing"
+	"relay/internal/uplink"
+)
+
+// api is the local HTTP API, with what it gathers from chat: rolling
+// word and emote counts, spam clusters, and the dashboard's feed. A nil
+// *api, when --api-listen is unset, ignores every call.
+type api struct {
+	mux *http.ServeMux
+	// guard limits the API to loopback callers, or to [server] tokens and
+	// client certificates
+	guard    *server.Guard
+	counts   *analytics.Counter
+	clusters *cluster.Clusterer
+	// dash serves the web dashboard when enabled
+	dash *dashboard.Dashboard
+}
+
+// startAPI serves the HTTP API on cfg.API.Listen until ctx is done, or
+// returns nil when it is unset. Responses are signed by signer, when
+// set, except the dashboard's.
+func startAPI(ctx context.Context, cfg config.Config, status *display.Status, filter *display.Filter, health *sourceHealth, signer *signing.Signer) *api {
+	if cfg.API.Listen == "" {
+		return nil
+	}
+	guard, err := serverGuard(cfg.Server)
+	if err == nil {
+		err = guard.CheckListen(cfg.API.Listen)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [server] %v\n", err)
+		os.Exit(1)
+	}
+	a := &api{
+		mux:      http.NewServeMux(),
+		guard:    guard,
+		counts:   analytics.NewCounter(),
+		clusters: cluster.New(cluster.Options{}),
+	}
+	a.handle("/api/analytics/top", a.counts.Handler())
+	a.handle("/api/clusters", a.clusters.Handler())
+	a.mux.Handle("/api/display", displayHandler(guard, filter, cfg.API.Listen))
+	a.handle("/api/health", health.Handler())
+	// The dashboard's page and event stream aren't signed as responses:
+	// signing buffers the whole response, and the page is for people.
+	// The stream's events carry their own signatures.
+	root := http.NewServeMux()
+	root.Handle("/", signer.Handler(a.mux))
+	if cfg.API.Dashboard || cfg.API.DashboardControls {
+		a.dash = dashboard.New(dashboard.Options{Filter: filter, Controls: cfg.API.DashboardControls})
+		root.Handle("/dashboard", guard.Require(server.ScopeRead, a.dash.Handler()))
+		root.Handle("/dashboard/", guard.Require(server.ScopeRead, a.dash.Handler()))
+	}
+	go func() {
+		status.Banner(message.Relay, "Serving HTTP API on %s", cfg.API.Listen)
+		if a.dash != nil {
+			status.Banner(message.Relay, "Dashboard at %s://%s/dashboard", apiScheme(guard), cfg.API.Listen)
+		}
+		if err := serveAPI(ctx, cfg.API.Listen, root, guard.TLSConfig()); err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP API error: %v\n", err)
+		}
+	}()
+	return a
+}
+
+// handle serves h at path to callers with the read scope.
+func (a *api) handle(path string, h http.Handler) {
+	if a == nil {
+		return
+	}
+	a.mux.Handle(path, a.guard.Require(server.ScopeRead, h))
+}
+
+// add counts msg and shows it on the dashboard.
+func (a *api) add(msg message.Message) {
+	if a == nil {
+		return
+	}
+	a.counts.Add(msg)
+	a.clusters.Add(msg)
+	if a.dash != nil {
+		a.dash.Add(msg)
+	}
+}
+
+// track shows a source's reconnects on the dashboard.
+func (a *api) track(p message.Platform, count func() int64) {
+	if a == nil || a.dash == nil {
+		return
+	}
+	a.dash.Track(p, count)
+}
+
+// serveAPI runs the local HTTP API on addr until ctx is cancelled.
+func serveAPI(ctx context.Context, addr string, handler http.Handler, tlsConfig *tls.Config) error {
+	srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	var err error
+	if tlsConfig != nil {
+		// The certificates are already in tlsConfig
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// displayHandler serves the display's mutes and solos at /api/display:
+// GET reports them and POST, with the control scope, changes them with
+// {"action": "mute", "target": "ttv#xqc"} and likewise unmute, solo, and
+// unsolo, as the console's commands do. POST only takes JSON, sent to
+// addr, the API's address, from a page it served, so that another site
+// open in the streamer's browser can't change the display.
+func displayHandler(guard *server.Guard, filter *display.Filter, addr string) http.Handler {
+	get := guard.Require(server.ScopeRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		muted, solo := filter.Targets()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"muted": muted, "solo": solo})
+	}))
+	post := guard.Require(server.ScopeControl, server.SameOrigin(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A form can't send JSON, so this also rules out simple
+		// cross-site form posts
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		var req struct {
+			Action string `json:"action"`
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "body must be JSON with action and target", http.StatusBadRequest)
+			return
+		}
+		if req.Action == "unsolo" {
+			filter.ClearSolo()
+			get.ServeHTTP(w, r)
+			return
+		}
+		apply := map[string]func(display.Target){"mute": filter.Mute, "unmute": filter.Unmute, "solo": filter.Solo}[req.Action]
+		if apply == nil {
+			http.Error(w, "action must be mute, unmute, solo, or unsolo", http.StatusBadRequest)
+			return
+		}
+		t, err := display.ParseTarget(req.Target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		apply(t)
+		get.ServeHTTP(w, r)
+	})))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			get.ServeHTTP(w, r)
+		case http.MethodPost:
+			post.ServeHTTP(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// bridgeStats is one uplink's backlog as served by the HTTP API.
+type bridgeStats struct {
+	uplink.Stats
+	// Dropped counts messages the sink's queue had no room for.
+	Dropped int64 `json:"dropped"`
+}
+
+// bridgeStatsHandler serves GET with each uplink's backlog, keyed by sink
+// name, e.g. {"uplink": {"workers": 4, "queued": 12, ...}}.
+func bridgeStatsHandler(d *dispatch.Dispatcher, clients map[string]*uplink.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		stats := make(map[string]bridgeStats, len(clients))
+		for name, c := range clients {
+			// Routed uplinks ("uplink:slug") share the uplink sink
+			sink, _, _ := strings.Cut(name, ":")
+			stats[name] = bridgeStats{Stats: c.Stats(), Dropped: d.Dropped(sink)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+}
+
+// apiScheme is "https" when the HTTP API serves TLS.
+func apiScheme(guard *server.Guard) string {
+	if guard.TLSConfig() != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// serverGuard builds the access rules for the local servers from
+// [server].
+func serverGuard(sc config.ServerConfig) (*server.Guard, error) {
+	opts := server.Options{
+		CertFile:    sc.TLSCert,
+		KeyFile:     sc.TLSKey,
+		ClientCA:    sc.ClientCA,
+		AllowRemote: sc.AllowRemote,
+	}
+	var err error
+	if opts.ClientScope, err = server.ParseScope(sc.ClientScope); err != nil {
+		return nil, fmt.Errorf("client_scope: %w", err)
+	}
+	for i, t := range sc.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("tokens[%d] has no token", i)
+		}
+		scope, err := server.ParseScope(t.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+		if opts.Tokens == nil {
+			opts.Tokens = make(map[string]server.Scope)
+		}
+		opts.Tokens[t.Token] = scope
+	}
+	return server.New(opts)
+}
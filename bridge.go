@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/dispatch"
+	"relay/internal/hackrtv"
+	"relay/internal/message"
+	"relay/internal/optout"
+	"relay/internal/twitch"
+	"relay/internal/uplink"
+	"relay/internal/youtube"
+)
+
+// uplinks are the bridge's clients to hackr.tv, with the goroutines that
+// feed them and retry their failed sends.
+type uplinks struct {
+	// spill is the uplink whose retry queue spills to disk
+	spill *uplink.Client
+	// With several bridge workers each uplink sink feeds its client's
+	// Run, which spreads sends over the workers; drain closes the inputs
+	// once dispatch has drained so queued messages still go out
+	inputs []chan message.Message
+	runs   sync.WaitGroup
+	// retries run until shutdown, when they save what is still unsent to
+	// the spill file
+	retries sync.WaitGroup
+}
+
+// drain closes the uplinks' inputs and waits for what they hold to be
+// sent, after the dispatcher has stopped.
+func (u *uplinks) drain() {
+	for _, in := range u.inputs {
+		close(in)
+	}
+	u.runs.Wait()
+}
+
+// startUplinks adds the uplink sink, which bridges chat to hackr.tv,
+// with one client per channel the routes name, and the supporters sink
+// when [supporters] sets a channel. htv is the cable connection regular
+// hackrs post over.
+func (r *relay) startUplinks(htv *hackrtv.Client) *uplinks {
+	u := &uplinks{}
+	if !r.cfg.Bridge {
+		return u
+	}
+	cfg, ctx := r.cfg, r.ctx
+	handle := func(c *uplink.Client) func(message.Message) {
+		if cfg.BridgeWorkers <= 1 {
+			return func(msg message.Message) { c.Handle(ctx, msg) }
+		}
+		in := make(chan message.Message)
+		u.inputs = append(u.inputs, in)
+		u.runs.Add(1)
+		go func() {
+			defer u.runs.Done()
+			c.Run(ctx, in)
+		}()
+		return func(msg message.Message) {
+			select {
+			case in <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}
+	bridgeClients := make(map[string]*uplink.Client)
+	uplinkOpts := uplink.Options{
+		StrictOrder:      cfg.BridgeOrder == "strict",
+		SlowMode:         cfg.BridgeSlowMode,
+		Rate:             cfg.BridgeRate,
+		Burst:            cfg.BridgeBurst,
+		Workers:          cfg.BridgeWorkers,
+		MaxLength:        cfg.BridgeMaxLength,
+		Template:         r.bridgeTmpl,
+		RetryQueue:       cfg.BridgeRetryQueue,
+		BreakerThreshold: cfg.BridgeBreaker,
+		BreakerCooldown:  cfg.BridgeBreakerCooldown,
+		Echoes:           r.echoes,
+		SendTimeout:      cfg.SendTimeout,
+	}
+	newUplink := func(channel string, opts uplink.Options) *uplink.Client {
+		var c *uplink.Client
+		switch {
+		case cfg.BridgeDryRun:
+			// Nothing is sent, so nothing fails or needs retrying,
+			// and the spill file is left for a real run
+			opts.DryRun = true
+			opts.RetryQueue, opts.SpillFile, opts.BreakerThreshold = 0, "", 0
+			c = uplink.NewUserClient(nil, channel, opts)
+		case cfg.HackrTV.AuthMode == "user":
+			// Post as a regular hackr over the hackr.tv cable connection
+			c = uplink.NewUserClient(htv, channel, opts)
+		default:
+			var err error
+			c, err = uplink.NewClient(cfg.HackrTV.URL, cfg.HackrTV.Token, cfg.HackrTV.Alias, channel, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Uplink client error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// Failed sends and those held by an open breaker wait in the
+		// retry queue in every mode; without one this returns at once
+		u.retries.Add(1)
+		go func() {
+			defer u.retries.Done()
+			c.RunRetries(ctx)
+		}()
+		return c
+	}
+	// Each hackr.tv channel the routes name gets its own uplink. Only
+	// the first spills to disk, so two queues never share a file.
+	targets := routeTargets(r.routes)
+	clients := make(map[string]*uplink.Client, len(targets))
+	handles := make(map[string]func(message.Message), len(targets))
+	for i, target := range targets {
+		opts, name := uplinkOpts, "uplink"
+		if i == 0 {
+			opts.SpillFile = cfg.BridgeSpillFile
+			opts.SpillRetention = r.spillKeep
+		} else {
+			name += ":" + target
+		}
+		c := newUplink(target, opts)
+		clients[target] = c
+		handles[target] = handle(c)
+		bridgeClients[name] = c
+	}
+	u.spill = clients[targets[0]]
+	if cfg.BridgeDryRun {
+		r.status.Banner(message.HackrTV, "Bridge dry run — logging what would be sent instead of sending it")
+	} else {
+		r.status.Banner(message.HackrTV, "Bridge mode enabled (%s) — forwarding Twitch/YouTube chat to hackr.tv", cfg.HackrTV.AuthMode)
+	}
+	if len(cfg.BridgeRoutes) > 0 {
+		for _, route := range r.routes {
+			r.status.Banner(message.HackrTV, "Bridging %s to channel %s", route, route.target)
+		}
+	}
+	// The uplink receives everything routed from outside hackr.tv, and
+	// by default drops messages it can't keep up with
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "uplink",
+		Accept: func(msg message.Message) bool {
+			_, ok := routeTarget(r.routes, msg)
+			return ok && !r.optOut.Skip(msg) && !r.bridgeFilter.Skip(msg)
+		},
+		Handle: withRoute(cfg.Sinks["uplink"], func(msg message.Message) {
+			target, _ := routeTarget(r.routes, msg)
+			handles[target](msg)
+		}),
+		Overflowed: withRoute(cfg.Sinks["uplink"], func(msg message.Message) {
+			target, _ := routeTarget(r.routes, msg)
+			clients[target].Queue(msg)
+		}),
+		Options: sinkOptions(cfg.Sinks["uplink"], dispatch.OverflowDrop),
+	})
+
+	if cfg.BridgeAnnounce {
+		for _, target := range targets {
+			c := clients[target]
+			mirrored := strings.Join(mirroredChats(cfg, r.twitchChannels, func(p message.Platform, channel string) bool {
+				t, ok := routeTarget(r.routes, message.Message{Platform: p, Channel: channel})
+				return ok && t == target
+			}), ", ")
+			go announce(ctx, c, "Relay online: mirroring "+mirrored)
+			r.onShutdown(func() {
+				stopCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+				defer stop()
+				announce(stopCtx, c, "Relay offline: no longer mirroring "+mirrored)
+			})
+		}
+	}
+
+	// A lower-noise feed of subscriber, member, and VIP chat. Deletions
+	// pass too, so retracted messages still queued are dropped.
+	if sup := cfg.Supporters; sup.Channel != "" {
+		supportersClient := newUplink(sup.Channel, uplinkOpts)
+		r.status.Banner(message.HackrTV, "Mirroring supporter chat (%s) to channel %s", strings.Join(sup.Badges, ", "), sup.Channel)
+		addSink(r.dispatcher, dispatch.Sink{
+			Name: "supporters",
+			Accept: func(msg message.Message) bool {
+				if _, ok := routeTarget(r.routes, msg); !ok || r.optOut.Skip(msg) || r.bridgeFilter.Skip(msg) {
+					return false
+				}
+				return msg.Type == message.TypeDeletion || msg.HasBadge(sup.Badges...)
+			},
+			Handle:     withRoute(cfg.Sinks["supporters"], handle(supportersClient)),
+			Overflowed: withRoute(cfg.Sinks["supporters"], func(msg message.Message) { supportersClient.Queue(msg) }),
+			Options:    sinkOptions(cfg.Sinks["supporters"], dispatch.OverflowDrop),
+		})
+		bridgeClients["supporters"] = supportersClient
+	}
+	r.api.handle("/api/bridge", bridgeStatsHandler(r.dispatcher, bridgeClients))
+	return u
+}
+
+// bridgeToYouTube adds the youtube sink, which posts hackr.tv chat to the
+// first YouTube video's chat when the relay can post there. The client
+// never reads its own posts back, so nothing loops.
+func (r *relay) bridgeToYouTube(p *platforms) {
+	if p.ytPoster == nil {
+		return
+	}
+	cfg, ctx := r.cfg, r.ctx
+	r.status.Banner(message.YouTube, "Bridging hackr.tv chat into live chat")
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "youtube",
+		Accept: func(msg message.Message) bool {
+			return msg.Platform == message.HackrTV && !msg.IsEvent()
+		},
+		Handle: withRoute(cfg.Sinks["youtube"], func(msg message.Message) {
+			text := uplink.FormatOutbound(msg, cfg.BridgePrefix)
+			if cfg.BridgeDryRun {
+				logDryRun("YouTube", text)
+				return
+			}
+			err := p.ytPoster.Send(ctx, text)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, youtube.ErrNoLiveChat) {
+				fmt.Fprintf(os.Stderr, "YouTube send error: %v\n", err)
+			}
+		}),
+		Options: sinkOptions(cfg.Sinks["youtube"], dispatch.OverflowDrop),
+	})
+}
+
+// bridgeToTwitch adds the twitch sink, which posts hackr.tv chat to the
+// first Twitch channel when the relay has a login there. Twitch does not
+// echo a connection's own messages back, so posts never loop into
+// hackr.tv.
+func (r *relay) bridgeToTwitch(p *platforms) {
+	cfg, ctx := r.cfg, r.ctx
+	if !cfg.Bridge || p.hackrTV == nil || p.twitch == nil || cfg.Twitch.Token == "" {
+		return
+	}
+	channel := r.twitchChannels[0]
+	r.status.Banner(message.Twitch, "Bridging hackr.tv chat into channel: %s", channel)
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "twitch",
+		Accept: func(msg message.Message) bool {
+			return msg.Platform == message.HackrTV && !msg.IsEvent()
+		},
+		Handle: withRoute(cfg.Sinks["twitch"], func(msg message.Message) {
+			text := uplink.FormatOutbound(msg, cfg.BridgePrefix)
+			if cfg.BridgeDryRun {
+				logDryRun("Twitch #"+channel, text)
+				return
+			}
+			err := p.twitch.Send(ctx, channel, text)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, twitch.ErrNotConnected) {
+				fmt.Fprintf(os.Stderr, "Twitch send error: %v\n", err)
+			}
+		}),
+		Options: sinkOptions(cfg.Sinks["twitch"], dispatch.OverflowDrop),
+	})
+}
+
+// addReplies adds the replies sink, which answers the opt-out commands
+// in the chat they came from, where the relay has a login there.
+func (r *relay) addReplies(p *platforms) {
+	cfg, ctx := r.cfg, r.ctx
+	twitchPoster := p.twitch
+	if cfg.Twitch.Token == "" {
+		twitchPoster = nil
+	}
+	if !cfg.BridgeReplies || r.optOut == nil || (twitchPoster == nil && p.ytPoster == nil) {
+		return
+	}
+	videoIDs := cfg.YouTube.AllVideoIDs()
+	// Each reply names the channel the viewer's chat goes to
+	repliers := make(map[string]*optout.Replier)
+	for _, target := range routeTargets(r.routes) {
+		repliers[target] = &optout.Replier{Where: mirrorName(cfg, []string{target})}
+	}
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "replies",
+		Accept: func(msg message.Message) bool {
+			// Chat that isn't bridged has nothing to opt out of
+			if _, ok := routeTarget(r.routes, msg); !ok {
+				return false
+			}
+			switch msg.Platform {
+			case message.Twitch:
+				return twitchPoster != nil && optout.Command(msg) != ""
+			case message.YouTube:
+				// Posting goes to the first video's chat
+				return p.ytPoster != nil && optout.Command(msg) != "" && (len(videoIDs) == 0 || msg.Channel == videoIDs[0])
+			}
+			return false
+		},
+		Handle: func(msg message.Message) {
+			target, _ := routeTarget(r.routes, msg)
+			text, ok := repliers[target].Reply(msg)
+			if !ok {
+				return
+			}
+			if cfg.BridgeDryRun {
+				where := "YouTube"
+				if msg.Platform == message.Twitch {
+					where = "Twitch #" + msg.Channel
+				}
+				logDryRun(where, text)
+				return
+			}
+			var err error
+			if msg.Platform == message.Twitch {
+				err = twitchPoster.Send(ctx, msg.Channel, text)
+			} else {
+				err = p.ytPoster.Send(ctx, text)
+			}
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Bridge reply error: %v\n", err)
+			}
+		},
+		Options: sinkOptions(cfg.Sinks["replies"], dispatch.OverflowDrop),
+	})
+}
+
+// isBridgeEcho returns true if an HTV message is an echo of a bridged
+// Twitch/YouTube message sent by our own relay alias, in the format tmpl
+// bridges them with.
+func isBridgeEcho(msg message.Message, relayAlias string, tmpl *uplink.Template) bool {
+	if msg.Platform != message.HackrTV || !strings.EqualFold(msg.Username, relayAlias) {
+		return false
+	}
+	return tmpl.IsBridged(msg.Content)
+}
+
+// announce posts a relay system line to hackr.tv. Over the cable it may
+// run before the connection is up, so it tries a few times.
+func announce(ctx context.Context, client *uplink.Client, text string) {
+	msg := message.Message{Platform: message.Relay, Type: message.TypeSystem, ID: message.NewID(), Content: text}
+	var err error
+	for range 5 {
+		if err = client.Send(ctx, msg); err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Bridge announcement error: %v\n", err)
+}
+
+// logDryRun prints what --bridge-dry-run would have posted to a chat.
+func logDryRun(where, text string) {
+	fmt.Fprintf(os.Stderr, "Bridge dry run → %s: %s\n", where, text)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"relay/internal/bus"
+	"relay/internal/dispatch"
+	"relay/internal/message"
+)
+
+// startBus connects the relay to [bus], or returns nil without one. A
+// publishing relay gets the bus sink, which sends it every message; a
+// consuming relay gets the bus as its one source.
+func (r *relay) startBus() *bus.Client {
+	cfg, ctx := r.cfg, r.ctx
+	if cfg.Bus.URL == "" {
+		return nil
+	}
+	client, err := bus.New(cfg.Bus.URL, bus.Options{
+		Subject:      cfg.Bus.Subject,
+		Echoes:       r.echoes,
+		Alias:        cfg.HackrTV.Alias,
+		WriteTimeout: cfg.SendTimeout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [bus] %v\n", err)
+		os.Exit(1)
+	}
+	if r.busConsume {
+		r.sources = append(r.sources, source{
+			name:     "bus",
+			platform: message.Relay,
+			banner:   "Consuming chat from " + client.String(),
+			connect:  client.Connect,
+			failed:   func(err error) { fmt.Fprintf(os.Stderr, "Bus error: %v\n", err) },
+		})
+		return client
+	}
+
+	r.status.Banner(message.Relay, "Publishing chat to %s", client)
+	// Only the first failure and the recovery are logged
+	var failing atomic.Bool
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "bus",
+		// The relay's own notices, such as hype, stay local
+		Accept: func(msg message.Message) bool { return msg.Platform != message.Relay },
+		Handle: func(msg message.Message) {
+			if err := client.Publish(ctx, msg); err != nil {
+				if !failing.Swap(true) {
+					fmt.Fprintf(os.Stderr, "Bus publish error: %v\n", err)
+				}
+			} else if failing.Swap(false) {
+				fmt.Fprintln(os.Stderr, "Bus publishing again")
+			}
+		},
+		Options: sinkOptions(cfg.Sinks["bus"], dispatch.OverflowDrop),
+	})
+	return client
+}
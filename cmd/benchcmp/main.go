@@ -0,0 +1,162 @@
+// Command benchcmp compares benchmark results with a baseline run and
+// fails when any regressed: time or memory per op by more than the
+// threshold, or allocations per op by any amount. Both files are "go test
+// -bench -benchmem" output; repeated runs (-count) are reduced to their
+// median.
+//
+//	go run ./cmd/benchcmp [-threshold 0.2] baseline.txt current.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// metrics are the units compared, in display order.
+var metrics = []string{"ns/op", "B/op", "allocs/op"}
+
+// procsSuffix is the GOMAXPROCS suffix of a benchmark name, e.g. "-8".
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// results maps "pkg.BenchmarkName" to each unit's samples.
+type results map[string]map[string][]float64
+
+func main() {
+	threshold := flag.Float64("threshold", 0.2, "allowed slowdown or memory growth per op, as a fraction")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: benchcmp [-threshold 0.2] baseline.txt current.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	baseline, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	current, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if regressions := compare(os.Stdout, baseline, current, *threshold); regressions > 0 {
+		fmt.Printf("\n%d regression(s) against %s\n", regressions, flag.Arg(0))
+		os.Exit(1)
+	}
+}
+
+func parseFile(path string) (results, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parse reads benchmark lines such as
+// "BenchmarkPrint-8  736718  2086 ns/op  680 B/op  24 allocs/op", naming
+// each by the package from the preceding "pkg:" line.
+func parse(r io.Reader) (results, error) {
+	res := results{}
+	pkg := ""
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = p[strings.LastIndex(p, "/")+1:]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := pkg + "." + procsSuffix.ReplaceAllString(fields[0], "")
+		if res[name] == nil {
+			res[name] = map[string][]float64{}
+		}
+		// fields[1] is the iteration count; value/unit pairs follow
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q in %q", fields[i], line)
+			}
+			res[name][fields[i+1]] = append(res[name][fields[i+1]], v)
+		}
+	}
+	return res, sc.Err()
+}
+
+// median returns the middle of samples, which must not be empty.
+func median(samples []float64) float64 {
+	s := slices.Sorted(slices.Values(samples))
+	if n := len(s); n%2 == 0 {
+		return (s[n/2-1] + s[n/2]) / 2
+	}
+	return s[len(s)/2]
+}
+
+// compare writes a table of every benchmark's metrics against the
+// baseline and returns how many regressed.
+func compare(w io.Writer, baseline, current results, threshold float64) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tmetric\tbaseline\tcurrent\tdelta\t")
+	regressions := 0
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		base, ok := baseline[name]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t\t\t\tnot in baseline\t\n", name)
+			continue
+		}
+		for _, unit := range metrics {
+			old, cur := base[unit], current[name][unit]
+			if len(old) == 0 || len(cur) == 0 {
+				continue
+			}
+			o, c := median(old), median(cur)
+			delta := "~"
+			if o != 0 {
+				delta = fmt.Sprintf("%+.1f%%", (c-o)/o*100)
+			} else if c != 0 {
+				delta = "+inf"
+			}
+			if regressed(unit, o, c, threshold) {
+				delta += " REGRESSION"
+				regressions++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", name, unit, format(o), format(c), delta)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(baseline)) {
+		if _, ok := current[name]; !ok {
+			fmt.Fprintf(tw, "%s\t\t\t\tnot run\t\n", name)
+		}
+	}
+	tw.Flush()
+	return regressions
+}
+
+// regressed reports whether cur is worse than old: any extra allocation,
+// or time and bytes grown by more than threshold.
+func regressed(unit string, old, cur, threshold float64) bool {
+	if unit == "allocs/op" {
+		return cur > old
+	}
+	return cur > old*(1+threshold)
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const baselineOutput = `goos: linux
+pkg: relay/internal/display
+BenchmarkPrint-8    	  700000	      2000 ns/op	     680 B/op	      24 allocs/op
+BenchmarkPrint-8    	  700000	      2100 ns/op	     680 B/op	      24 allocs/op
+BenchmarkPrint-8    	  700000	      9000 ns/op	     680 B/op	      24 allocs/op
+pkg: relay/internal/twitch
+BenchmarkParseLine-8	  400000	      3000 ns/op	    1864 B/op	      43 allocs/op
+PASS
+`
+
+func TestParse(t *testing.T) {
+	res, err := parse(strings.NewReader(baselineOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res["display.BenchmarkPrint"]["ns/op"]; len(got) != 3 {
+		t.Fatalf("display.BenchmarkPrint ns/op samples = %v, want 3", got)
+	}
+	// The median ignores the one noisy run
+	if got := median(res["display.BenchmarkPrint"]["ns/op"]); got != 2100 {
+		t.Errorf("median = %v, want 2100", got)
+	}
+	if got := res["twitch.BenchmarkParseLine"]["allocs/op"]; len(got) != 1 || got[0] != 43 {
+		t.Errorf("twitch.BenchmarkParseLine allocs/op = %v, want [43]", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline, _ := parse(strings.NewReader(baselineOutput))
+	tests := []struct {
+		name    string
+		current string
+		want    int
+	}{
+		{"within threshold", "pkg: relay/internal/display\nBenchmarkPrint-8 1 2400 ns/op 680 B/op 24 allocs/op\n", 0},
+		{"slower", "pkg: relay/internal/display\nBenchmarkPrint-8 1 2600 ns/op 680 B/op 24 allocs/op\n", 1},
+		{"one more allocation", "pkg: relay/internal/display\nBenchmarkPrint-8 1 2000 ns/op 680 B/op 25 allocs/op\n", 1},
+		{"faster and leaner", "pkg: relay/internal/twitch\nBenchmarkParseLine-8 1 1000 ns/op 100 B/op 2 allocs/op\n", 0},
+	}
+	for _, tt := range tests {
+		current, _ := parse(strings.NewReader(tt.current))
+		var out strings.Builder
+		if got := compare(&out, baseline, current, 0.2); got != tt.want {
+			t.Errorf("%s: compare() = %d regressions, want %d\n%s", tt.name, got, tt.want, out.String())
+		}
+	}
+}
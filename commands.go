@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"relay/internal/console"
+	"relay/internal/display"
+	"relay/internal/hackrtv"
+	"relay/internal/highlight"
+	"relay/internal/twitcheventsub"
+)
+
+// defaultClipDuration is how much chat /clip saves without an argument.
+const defaultClipDuration = time.Minute
+
+// registerClipCommand adds /clip, which appends recent chat to the
+// highlights file and, when createClip is set, also creates a Twitch clip.
+func registerClipCommand(con *console.Console, rec *highlight.Recorder, path string, createClip func(context.Context) (string, error)) {
+	con.Register("clip", console.Command{
+		Usage: "/clip [seconds] [note]",
+		Help:  "save the last minute (or N seconds) of chat as a highlight",
+		Run: func(args []string) (string, error) {
+			d := defaultClipDuration
+			if len(args) > 0 {
+				if n, err := strconv.Atoi(args[0]); err == nil {
+					if n <= 0 {
+						return "", fmt.Errorf("seconds must be positive")
+					}
+					d = time.Duration(n) * time.Second
+					args = args[1:]
+				}
+			}
+			d = min(d, rec.Window())
+
+			clip := highlight.Clip{
+				At:       time.Now(),
+				Duration: d,
+				Note:     strings.Join(args, " "),
+				Messages: rec.Since(d),
+			}
+			var clipErr error
+			if createClip != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				clip.ClipURL, clipErr = createClip(ctx)
+				cancel()
+			}
+			if err := highlight.Append(path, clip); err != nil {
+				return "", err
+			}
+
+			status := fmt.Sprintf("[clip] saved %d messages from the last %s to %s", len(clip.Messages), d, path)
+			switch {
+			case clip.ClipURL != "":
+				status += "; Twitch clip: " + clip.ClipURL
+			case errors.Is(clipErr, twitcheventsub.ErrNotLive):
+				status += "; no Twitch clip, the channel is offline"
+			case clipErr != nil:
+				status += fmt.Sprintf("; Twitch clip failed: %v", clipErr)
+			}
+			return status, nil
+		},
+	})
+}
+
+// registerWhoCommand adds /who, which lists the hackrs seen connecting
+// to each hackr.tv channel.
+func registerWhoCommand(con *console.Console, client *hackrtv.Client, channels []string) {
+	con.Register("who", console.Command{
+		Usage: "/who",
+		Help:  "list hackrs seen connecting to hackr.tv",
+		Run: func(args []string) (string, error) {
+			var parts []string
+			for _, ch := range channels {
+				present := client.Present(ch)
+				if len(present) == 0 {
+					parts = append(parts, fmt.Sprintf("#%s: nobody seen", ch))
+					continue
+				}
+				parts = append(parts, fmt.Sprintf("#%s (%d): %s", ch, len(present), strings.Join(present, ", ")))
+			}
+			return "[who] " + strings.Join(parts, "; "), nil
+		},
+	})
+}
+
+// registerDisplayCommands adds the mute/solo console commands. Each one
+// replies with the resulting filter state as a status line.
+func registerDisplayCommands(con *console.Console, filter *display.Filter) {
+	status := func() string { return "[display] " + filter.Status() }
+
+	withTarget := func(apply func(display.Target)) func([]string) (string, error) {
+		return func(args []string) (string, error) {
+			if len(args) != 1 {
+				return "", fmt.Errorf("expected one platform")
+			}
+			t, err := display.ParseTarget(args[0])
+			if err != nil {
+				return "", err
+			}
+			apply(t)
+			return status(), nil
+		}
+	}
+
+	con.Register("mute", console.Command{
+		Usage: "/mute <platform>[#channel]",
+		Help:  "hide a platform or channel in the display",
+		Run:   withTarget(filter.Mute),
+	})
+	con.Register("unmute", console.Command{
+		Usage: "/unmute <platform>[#channel]",
+		Help:  "show a muted platform or channel again",
+		Run:   withTarget(filter.Unmute),
+	})
+	con.Register("solo", console.Command{
+		Usage: "/solo <platform>[#channel]",
+		Help:  "show only soloed platforms or channels",
+		Run:   withTarget(filter.Solo),
+	})
+	con.Register("unsolo", console.Command{
+		Usage: "/unsolo",
+		Help:  "clear solo and show all unmuted platforms",
+		Run: func(args []string) (string, error) {
+			filter.ClearSolo()
+			return status(), nil
+		},
+	})
+	con.Register("status", console.Command{
+		Usage: "/status",
+		Help:  "show the current mute/solo state",
+		Run: func(args []string) (string, error) {
+			return status(), nil
+		},
+	})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"relay/internal/config"
+)
+
+// cliFlags are the command-line flags. Each one that is set overrides
+// its config field.
+type cliFlags struct {
+	configPath            *string
+	twitchChannel         *string
+	twitchNick            *string
+	twitchToken           *string
+	youtubeVideoID        *string
+	youtubeChannel        *string
+	youtubeAPIKey         *string
+	youtubeTransport      *string
+	hackrtvURL            *string
+	hackrtvChannel        *string
+	hackrtvToken          *string
+	hackrtvAlias          *string
+	hackrtvAuthMode       *string
+	hackrtvNoHistory      *bool
+	bridge                *bool
+	bridgeOrder           *string
+	bridgeSlowMode        *time.Duration
+	bridgeAnnounce        *bool
+	bridgeDryRun          *bool
+	bridgeWorkers         *int
+	bridgeRate            *float64
+	bridgeBurst           *int
+	bridgeTemplate        *string
+	bridgeMaxLength       *int
+	bridgeReplies         *bool
+	bridgeRetryQueue      *int
+	bridgeSpillFile       *string
+	bridgeBreaker         *int
+	bridgeBreakerCooldown *time.Duration
+	bridgePrefix          *string
+	stateDir              *string
+	replayWindow          *time.Duration
+	keepRaw               *bool
+	sendTimeout           *time.Duration
+	output                *string
+	outputTemplate        *string
+	apiListen             *string
+	chatLogDir            *string
+	chatLogFormat         *string
+	busURL                *string
+	busRole               *string
+	dashboard             *bool
+	tui                   *bool
+	highlight             *string
+	bell                  *bool
+	show                  *string
+	emotes                *string
+	timestampFormat       *string
+	timezone              *string
+	emoteProviders        *string
+	notify                *bool
+	safeMode              *bool
+	// demoSeed and demoRate are only registered for "relay demo"
+	demoSeed *uint64
+	demoRate *float64
+
+	// set holds the names of the flags given on the command line, once
+	// parsed
+	set map[string]bool
+}
+
+// registerFlags defines the relay's flags on the default flag set, with
+// --seed and --rate too for "relay demo".
+func registerFlags(demoMode bool) *cliFlags {
+	f := &cliFlags{}
+	if demoMode {
+		f.demoSeed = flag.Uint64("seed", 0, "Demo: seed for the generated chat; the same seed repeats it")
+		f.demoRate = flag.Float64("rate", 0, "Demo: mean messages per second (default 2)")
+	}
+	f.configPath = flag.String("config", "", "Path to TOML config file")
+	f.twitchChannel = flag.String("twitch-channel", "", "Twitch channel name(s) to watch, comma-separated")
+	f.twitchNick = flag.String("twitch-nick", "", "Twitch login for sending messages (requires --twitch-token)")
+	f.twitchToken = flag.String("twitch-token", "", "Twitch OAuth token for sending messages (or set TWITCH_OAUTH_TOKEN env)")
+	f.youtubeVideoID = flag.String("youtube-video-id", "", "YouTube video ID for live stream (comma-separated for several)")
+	f.youtubeChannel = flag.String("youtube-channel", "", "YouTube channel ID or @handle whose live stream to follow (when no video ID is given)")
+	f.youtubeAPIKey = flag.String("youtube-api-key", "", "YouTube Data API key(s), comma-separated for rotation (or set YOUTUBE_API_KEY env)")
+	f.youtubeTransport = flag.String("youtube-transport", "", "YouTube chat transport: api (Data API key) or innertube (key-less, video ID only)")
+	f.hackrtvURL = flag.String("hackrtv-url", "", "hackr.tv ActionCable WebSocket URL (e.g. wss://hackr.tv/cable)")
+	f.hackrtvChannel = flag.String("hackrtv-channel", "", "hackr.tv chat channel slug(s), comma-separated; the bridge posts to the first")
+	f.hackrtvToken = flag.String("hackrtv-token", "", "hackr.tv API token (or set HACKRTV_API_TOKEN env)")
+	f.hackrtvAlias = flag.String("hackrtv-alias", "", "hackr.tv hackr alias for auth")
+	f.hackrtvAuthMode = flag.String("hackrtv-auth-mode", "", "hackr.tv bridge posting mode: admin (Uplink API) or user (regular hackr)")
+	f.hackrtvNoHistory = flag.Bool("hackrtv-no-history", false, "Skip hackr.tv's initial packet history, showing only packets newer than the connection")
+	f.bridge = flag.Bool("bridge", false, "Bridge Twitch/YouTube chat to hackr.tv via Uplink API")
+	f.bridgeOrder = flag.String("bridge-order", "", "Bridge delivery ordering: best_effort or strict (retry to keep source order)")
+	f.bridgeSlowMode = flag.Duration("bridge-slow-mode", 0, "Bridge at most one message per user per interval (e.g. 10s), summarizing the rest")
+	f.bridgeAnnounce = flag.Bool("bridge-announce", false, "Post to hackr.tv when the bridge starts and stops")
+	f.bridgeDryRun = flag.Bool("bridge-dry-run", false, "Run the bridge but log what would be sent instead of sending it")
+	f.bridgeWorkers = flag.Int("bridge-workers", 0, "Bridge sends in flight at once; each user's messages stay in order (default 1)")
+	f.bridgeRate = flag.Float64("bridge-rate", 0, "Bridge at most this many messages per second (e.g. 2); 0 disables")
+	f.bridgeBurst = flag.Int("bridge-burst", 0, "Messages the bridge may send at once before --bridge-rate applies (default 1)")
+	f.bridgeTemplate = flag.String("bridge-template", "", "Go text/template for bridged messages, over .Platform, .Username, .Content, .Channel, .Amount, and .Event")
+	f.bridgeMaxLength = flag.Int("bridge-max-length", 0, "Longest bridged message in bytes, cut with \"…\" (default 512)")
+	f.bridgeReplies = flag.Bool("bridge-replies", false, "Answer !bridge, !nobridge, and !yesbridge in Twitch/YouTube chat where the relay can post")
+	f.bridgeRetryQueue = flag.Int("bridge-retry-queue", 0, "Retry up to this many failed or overflowed bridge messages with backoff; 0 disables")
+	f.bridgeSpillFile = flag.String("bridge-spill-file", "", "File for retry-queue overflow and messages unsent at shutdown")
+	f.bridgeBreaker = flag.Int("bridge-breaker", 0, "Pause bridge sends after this many fail in a row, holding messages until hackr.tv is back; 0 disables")
+	f.bridgeBreakerCooldown = flag.Duration("bridge-breaker-cooldown", 0, "How long the bridge pauses before trying hackr.tv again (default 30s)")
+	f.bridgePrefix = flag.String("bridge-prefix", "", "Prefix for hackr.tv chat posted to Twitch and YouTube (default \"[HTV]\")")
+	f.stateDir = flag.String("state-dir", "", "Directory for state kept across restarts, such as YouTube chat checkpoints")
+	f.replayWindow = flag.Duration("replay-window", 0, "Drop messages sent more than this long before startup (e.g. 30s), so restarts don't replay history; 0 keeps all")
+	f.keepRaw = flag.Bool("keep-raw", false, "Keep each message's source payload (IRC line or JSON) in the JSON output and chat log")
+	f.sendTimeout = flag.Duration("send-timeout", 0, "Give up on a send or write to hackr.tv, Twitch, YouTube, or the bus after this long (default 10s)")
+	f.output = flag.String("output", "", "Chat output on stdout: text (colored, default) or json (one object per line)")
+	f.outputTemplate = flag.String("output-template", "", "Go text/template for each printed message, over .Platform, .Username, .Timestamp, .Content, .Channel, with color functions like cyan")
+	f.apiListen = flag.String("api-listen", "", "Address for the local HTTP API (e.g. 127.0.0.1:8787); disabled when empty")
+	f.chatLogDir = flag.String("chat-log", "", "Directory to archive every message to, one file per day")
+	f.chatLogFormat = flag.String("chat-log-format", "", "Chat log format: text (one line per message, default) or json (one object per line)")
+	f.busURL = flag.String("bus-url", "", "NATS or Redis URL for splitting reading and bridging across relays (e.g. nats://10.0.0.5:4222; tls:// or rediss:// for TLS)")
+	f.busRole = flag.String("bus-role", "", "Bus role: publish (read platforms, publish chat) or consume (take chat from the bus)")
+	f.dashboard = flag.Bool("dashboard", false, "Serve a web dashboard of live chat and source status at /dashboard on the HTTP API")
+	f.tui = flag.Bool("tui", false, "Full-screen terminal view with scrollback, pause, platform toggle keys, and source status")
+	f.highlight = flag.String("highlight", "", "Words to pick out in displayed chat, comma-separated, e.g. @mychannel,relay")
+	f.bell = flag.Bool("bell", false, "Ring the terminal bell for highlighted chat")
+	f.show = flag.String("show", "", "Platforms to display, comma-separated, e.g. ttv,htv; the rest are muted but still bridged")
+	f.emotes = flag.String("emotes", "", "How emotes are displayed: text (names in color, default), images (pictures on kitty and iTerm2), or plain")
+	f.timestampFormat = flag.String("timestamp-format", "", "Go time layout for chat times, e.g. 15:04 or \"2006-01-02 15:04:05\", or relative for \"2m ago\" in the TUI")
+	f.timezone = flag.String("timezone", "", "Show chat times in this zone: UTC, Local (default), or an IANA name such as America/New_York")
+	f.emoteProviders = flag.String("emote-providers", "", "Third-party emotes to find in Twitch chat, comma-separated: bttv, 7tv")
+	f.notify = flag.Bool("notify", false, "Desktop notifications for highlights, Super Chats and cheers, and raids")
+	f.safeMode = flag.Bool("safe-mode", false, "Start with only the chat display, as after repeated crashes; --safe-mode=false starts normally despite them")
+	return f
+}
+
+// parse parses the command line and records which flags were given.
+func (f *cliFlags) parse() {
+	flag.Parse()
+	f.set = make(map[string]bool)
+	flag.Visit(func(fl *flag.Flag) {
+		f.set[fl.Name] = true
+	})
+}
+
+// apply overrides cfg with the flags given on the command line.
+func (f *cliFlags) apply(cfg *config.Config) {
+	if f.set["twitch-channel"] {
+		cfg.Twitch.Channel = ""
+		cfg.Twitch.Channels = strings.Split(*f.twitchChannel, ",")
+	}
+	if f.set["twitch-nick"] {
+		cfg.Twitch.Nick = *f.twitchNick
+	}
+	if f.set["twitch-token"] {
+		cfg.Twitch.Token = *f.twitchToken
+	}
+	if f.set["youtube-video-id"] {
+		cfg.YouTube.VideoID = *f.youtubeVideoID
+	}
+	if f.set["youtube-channel"] {
+		cfg.YouTube.ChannelID, cfg.YouTube.Handle = "", ""
+		if strings.HasPrefix(*f.youtubeChannel, "@") {
+			cfg.YouTube.Handle = *f.youtubeChannel
+		} else {
+			cfg.YouTube.ChannelID = *f.youtubeChannel
+		}
+	}
+	if f.set["youtube-api-key"] {
+		cfg.YouTube.APIKey = *f.youtubeAPIKey
+		cfg.YouTube.APIKeys = nil
+	}
+	if f.set["youtube-transport"] {
+		cfg.YouTube.Transport = *f.youtubeTransport
+	}
+	if f.set["hackrtv-url"] {
+		cfg.HackrTV.URL = *f.hackrtvURL
+	}
+	if f.set["hackrtv-channel"] {
+		cfg.HackrTV.Channel = ""
+		cfg.HackrTV.Channels = strings.Split(*f.hackrtvChannel, ",")
+	}
+	if f.set["hackrtv-token"] {
+		cfg.HackrTV.Token = *f.hackrtvToken
+	}
+	if f.set["hackrtv-alias"] {
+		cfg.HackrTV.Alias = *f.hackrtvAlias
+	}
+	if f.set["hackrtv-auth-mode"] {
+		cfg.HackrTV.AuthMode = *f.hackrtvAuthMode
+	}
+	if f.set["hackrtv-no-history"] {
+		cfg.HackrTV.SkipHistory = *f.hackrtvNoHistory
+		// Only skipping replaces history; =false keeps a configured last_N
+		if *f.hackrtvNoHistory {
+			cfg.HackrTV.History = ""
+		}
+	}
+	if f.set["bridge"] {
+		cfg.Bridge = *f.bridge
+	}
+	if f.set["bridge-order"] {
+		cfg.BridgeOrder = *f.bridgeOrder
+	}
+	if f.set["bridge-slow-mode"] {
+		cfg.BridgeSlowMode = *f.bridgeSlowMode
+	}
+	if f.set["bridge-announce"] {
+		cfg.BridgeAnnounce = *f.bridgeAnnounce
+	}
+	if f.set["bridge-dry-run"] {
+		cfg.BridgeDryRun = *f.bridgeDryRun
+	}
+	if cfg.BridgeDryRun {
+		cfg.Bridge = true
+	}
+	if f.set["bridge-workers"] {
+		cfg.BridgeWorkers = *f.bridgeWorkers
+	}
+	if f.set["bridge-rate"] {
+		cfg.BridgeRate = *f.bridgeRate
+	}
+	if f.set["bridge-burst"] {
+		cfg.BridgeBurst = *f.bridgeBurst
+	}
+	if f.set["bridge-template"] {
+		cfg.BridgeTemplate = *f.bridgeTemplate
+	}
+	if f.set["bridge-max-length"] {
+		cfg.BridgeMaxLength = *f.bridgeMaxLength
+	}
+	if f.set["bridge-replies"] {
+		cfg.BridgeReplies = *f.bridgeReplies
+	}
+	if f.set["bridge-retry-queue"] {
+		cfg.BridgeRetryQueue = *f.bridgeRetryQueue
+	}
+	if f.set["bridge-spill-file"] {
+		cfg.BridgeSpillFile = *f.bridgeSpillFile
+	}
+	if f.set["bridge-breaker"] {
+		cfg.BridgeBreaker = *f.bridgeBreaker
+	}
+	if f.set["bridge-breaker-cooldown"] {
+		cfg.BridgeBreakerCooldown = *f.bridgeBreakerCooldown
+	}
+	if f.set["bridge-prefix"] {
+		cfg.BridgePrefix = *f.bridgePrefix
+	}
+	if f.set["state-dir"] {
+		cfg.StateDir = *f.stateDir
+	}
+	if f.set["replay-window"] {
+		cfg.ReplayWindow = *f.replayWindow
+	}
+	if f.set["keep-raw"] {
+		cfg.KeepRaw = *f.keepRaw
+	}
+	if f.set["send-timeout"] {
+		cfg.SendTimeout = *f.sendTimeout
+	}
+	if f.set["output"] {
+		cfg.Display.Output = *f.output
+	}
+	if f.set["output-template"] {
+		cfg.Display.Template = *f.outputTemplate
+	}
+	if f.set["api-listen"] {
+		cfg.API.Listen = *f.apiListen
+	}
+	if f.set["chat-log"] {
+		cfg.ChatLog.Dir = *f.chatLogDir
+	}
+	if f.set["chat-log-format"] {
+		cfg.ChatLog.Format = *f.chatLogFormat
+	}
+	if f.set["bus-url"] {
+		cfg.Bus.URL = *f.busURL
+	}
+	if f.set["bus-role"] {
+		cfg.Bus.Role = *f.busRole
+	}
+	if f.set["dashboard"] {
+		cfg.API.Dashboard = *f.dashboard
+	}
+	if f.set["tui"] {
+		cfg.Display.TUI = *f.tui
+	}
+	if f.set["highlight"] {
+		cfg.Display.Highlights = strings.Split(*f.highlight, ",")
+	}
+	if f.set["bell"] {
+		cfg.Display.Bell = *f.bell
+	}
+	if f.set["show"] {
+		cfg.Display.Platforms = strings.Split(*f.show, ",")
+	}
+	if f.set["emotes"] {
+		cfg.Display.Emotes = *f.emotes
+	}
+	if f.set["timestamp-format"] {
+		cfg.Display.TimestampFormat = *f.timestampFormat
+	}
+	if f.set["timezone"] {
+		cfg.Display.Timezone = *f.timezone
+	}
+	if f.set["emote-providers"] {
+		cfg.Emotes.Providers = strings.Split(*f.emoteProviders, ",")
+	}
+	if f.set["notify"] {
+		cfg.Notifications.Enabled = *f.notify
+	}
+	if f.set["seed"] {
+		cfg.Demo.Seed = *f.demoSeed
+	}
+	if f.set["rate"] {
+		cfg.Demo.Rate = *f.demoRate
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"relay/internal/dispatch"
+	"relay/internal/display"
+	"relay/internal/hackrtv"
+	"relay/internal/message"
+	"relay/internal/twitch"
+	"relay/internal/twitcheventsub"
+	"relay/internal/youtube"
+)
+
+// sourceHealth records how each chat source is doing, by name ("twitch",
+// "youtube:VIDEO_ID", ...), for /api/health and the exit status.
+type sourceHealth struct {
+	mu      sync.Mutex
+	sources map[string]sourceStatus
+	// failed is the first source failure.
+	failed error
+}
+
+// sourceStatus is one source as served by /api/health.
+type sourceStatus struct {
+	// State is "running", "stopped" when its stream ended, or "failed".
+	State string `json:"state"`
+	// Reason is a failure's category, from failureReason.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newSourceHealth() *sourceHealth {
+	return &sourceHealth{sources: make(map[string]sourceStatus)}
+}
+
+// run records name as running, calls connect, and records how it ended.
+// It returns connect's error, or nil when ctx was cancelled, since that
+// is a shutdown rather than a failure.
+func (h *sourceHealth) run(ctx context.Context, name string, connect func() error) error {
+	h.set(name, sourceStatus{State: "running"})
+	err := connect()
+	switch reason := failureReason(err); {
+	case ctx.Err() != nil:
+		return nil
+	case err == nil || reason == "stream_ended":
+		h.set(name, sourceStatus{State: "stopped"})
+		return nil
+	default:
+		h.set(name, sourceStatus{State: "failed", Reason: reason, Error: err.Error()})
+		h.mu.Lock()
+		if h.failed == nil {
+			h.failed = err
+		}
+		h.mu.Unlock()
+		return err
+	}
+}
+
+func (h *sourceHealth) set(name string, st sourceStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sources[name] = st
+}
+
+// exitCodes are the exit statuses for a failed source, by reason, so a
+// supervisor such as systemd can tell a refused token, which restarting
+// won't fix, from a passing fault. 2 is taken by flag errors.
+var exitCodes = map[string]int{
+	"error":                 1,
+	"auth":                  3,
+	"not_live":              4,
+	"rate_limit":            5,
+	"subscription_rejected": 6,
+}
+
+// exitCode is the exit status for the first source that failed, or 0.
+func (h *sourceHealth) exitCode() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failed == nil {
+		return 0
+	}
+	return exitCodes[failureReason(h.failed)]
+}
+
+// Handler serves GET with each source's status, e.g. {"status": "ok",
+// "sources": {"twitch": {"state": "running"}}}, with a 503 and status
+// "failing" once any source has failed.
+func (h *sourceHealth) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.mu.Lock()
+		resp := struct {
+			Status  string                  `json:"status"`
+			Sources map[string]sourceStatus `json:"sources"`
+		}{"ok", maps.Clone(h.sources)}
+		failed := h.failed != nil
+		h.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if failed {
+			resp.Status = "failing"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// failureReason sorts a source's error into the categories the client
+// packages export: "auth", "not_live", "rate_limit" (including an
+// exhausted YouTube quota), "subscription_rejected", "stream_ended", or
+// "error" for anything else.
+func failureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, twitch.ErrAuth), errors.Is(err, twitcheventsub.ErrAuth),
+		errors.Is(err, youtube.ErrAuth), errors.Is(err, hackrtv.ErrAuth):
+		return "auth"
+	case errors.Is(err, youtube.ErrNotLive):
+		return "not_live"
+	case errors.Is(err, youtube.ErrRateLimit), errors.Is(err, youtube.ErrQuotaExhausted),
+		errors.Is(err, twitcheventsub.ErrRateLimit):
+		return "rate_limit"
+	case errors.Is(err, hackrtv.ErrSubscriptionRejected), errors.Is(err, twitcheventsub.ErrSubscriptionRejected):
+		return "subscription_rejected"
+	case errors.Is(err, youtube.ErrStreamEnded):
+		return "stream_ended"
+	default:
+		return "error"
+	}
+}
+
+// sessionSummary gathers the shutdown summary: messages and reconnects
+// per platform, in platform order, and each sink's drops.
+func sessionSummary(uptime time.Duration, counts map[message.Platform]int64, reconnects []func() (message.Platform, int64), d *dispatch.Dispatcher) display.Summary {
+	byPlatform := maps.Clone(counts)
+	retried := make(map[message.Platform]int64)
+	for _, fn := range reconnects {
+		p, n := fn()
+		retried[p] += n
+		byPlatform[p] += 0
+	}
+	sum := display.Summary{Uptime: uptime, Dropped: make(map[string]int64)}
+	for _, p := range slices.Sorted(maps.Keys(byPlatform)) {
+		sum.Sources = append(sum.Sources, display.SourceSummary{Platform: p, Messages: byPlatform[p], Reconnects: retried[p]})
+	}
+	for _, name := range d.Names() {
+		sum.Dropped[name] = d.Dropped(name)
+	}
+	return sum
+}
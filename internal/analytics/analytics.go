@@ -0,0 +1,232 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"relay/internal/message"
+)
+
+const (
+	// bucketSize is the counting granularity; windows are rounded up to it.
+	bucketSize = time.Minute
+	// maxWindow is the longest window Top can answer.
+	maxWindow = time.Hour
+
+	defaultWindow = 5 * time.Minute
+	defaultLimit  = 20
+	maxLimit      = 100
+)
+
+// stopwords are common words left out of the word counts.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "at": true, "be": true,
+	"but": true, "for": true, "i": true, "im": true, "in": true, "is": true,
+	"it": true, "its": true, "me": true, "my": true, "of": true, "on": true,
+	"or": true, "so": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "we": true, "you": true,
+}
+
+// bucket holds the counts for one bucketSize slice of time.
+type bucket struct {
+	start  time.Time
+	words  map[string]int
+	emotes map[string]int
+}
+
+// Counter keeps rolling word and emote frequencies over the last hour.
+// Counts are kept per minute, so adding a message is a few map updates
+// and Top only merges the buckets inside its window.
+type Counter struct {
+	mu      sync.Mutex
+	buckets []*bucket // oldest first
+	now     func() time.Time
+}
+
+// NewCounter creates an empty Counter.
+func NewCounter() *Counter {
+	return &Counter{now: time.Now}
+}
+
+// Add counts the words and emotes in a chat message. Events are skipped.
+func (c *Counter) Add(msg message.Message) {
+	if msg.IsEvent() {
+		return
+	}
+	words, emotes := Tokens(msg.Content)
+	if len(words) == 0 && len(emotes) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.current()
+	for _, w := range words {
+		b.words[w]++
+	}
+	for _, e := range emotes {
+		b.emotes[e]++
+	}
+}
+
+// current returns the bucket for now, starting a new one and dropping
+// buckets older than maxWindow as time moves on. c.mu must be held.
+func (c *Counter) current() *bucket {
+	start := c.now().Truncate(bucketSize)
+	if n := len(c.buckets); n > 0 && c.buckets[n-1].start.Equal(start) {
+		return c.buckets[n-1]
+	}
+	cutoff := start.Add(-maxWindow)
+	i := 0
+	for i < len(c.buckets) && !c.buckets[i].start.After(cutoff) {
+		i++
+	}
+	b := &bucket{start: start, words: make(map[string]int), emotes: make(map[string]int)}
+	c.buckets = append(c.buckets[i:], b)
+	return b
+}
+
+// Count is a token and how often it was seen.
+type Count struct {
+	Token string `json:"token"`
+	Count int    `json:"count"`
+}
+
+// Top returns the limit most frequent words and emotes from the last
+// window, most frequent first with ties broken alphabetically.
+func (c *Counter) Top(window time.Duration, limit int) (words, emotes []Count) {
+	cutoff := c.now().Truncate(bucketSize).Add(-window + bucketSize)
+	wordTotals := make(map[string]int)
+	emoteTotals := make(map[string]int)
+
+	c.mu.Lock()
+	for _, b := range c.buckets {
+		if b.start.Before(cutoff) {
+			continue
+		}
+		for w, n := range b.words {
+			wordTotals[w] += n
+		}
+		for e, n := range b.emotes {
+			emoteTotals[e] += n
+		}
+	}
+	c.mu.Unlock()
+
+	return top(wordTotals, limit), top(emoteTotals, limit)
+}
+
+func top(totals map[string]int, limit int) []Count {
+	out := make([]Count, 0, len(totals))
+	for token, n := range totals {
+		out = append(out, Count{Token: token, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Token < out[j].Token
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Tokens splits chat text into lowercased words and emotes. Emotes are
+// emoji and Twitch-style codes: words of three or more letters with an
+// uppercase letter after the first (PogChamp, LUL, KEKW), kept as typed.
+// Links, stopwords, and single characters are dropped.
+func Tokens(s string) (words, emotes []string) {
+	for _, field := range strings.Fields(s) {
+		if strings.Contains(field, "://") {
+			continue
+		}
+		field = strings.TrimFunc(field, func(r rune) bool {
+			return unicode.IsPunct(r) && r != '_'
+		})
+		if field == "" {
+			continue
+		}
+		if isEmote(field) {
+			emotes = append(emotes, field)
+			continue
+		}
+		w := strings.ToLower(field)
+		if len([]rune(w)) < 2 || stopwords[w] {
+			continue
+		}
+		words = append(words, w)
+	}
+	return words, emotes
+}
+
+func isEmote(s string) bool {
+	runes := []rune(s)
+	for _, r := range runes {
+		if unicode.Is(unicode.So, r) {
+			return true
+		}
+	}
+	if len(runes) < 3 {
+		return false
+	}
+	for _, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	for _, r := range runes[1:] {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// topResponse is the JSON body served by Handler.
+type topResponse struct {
+	Window string  `json:"window"`
+	Words  []Count `json:"words"`
+	Emotes []Count `json:"emotes"`
+}
+
+// Handler serves GET ?window=5m&limit=20 with the top words and emotes.
+// window defaults to 5m (at most 1h) and limit to 20 (at most 100).
+func (c *Counter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		window := defaultWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 || d > maxWindow {
+				http.Error(w, "window must be a duration between 1s and 1h, e.g. 5m", http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		limit := defaultLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxLimit {
+				http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		words, emotes := c.Top(window, limit)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(topResponse{Window: window.String(), Words: words, Emotes: emotes})
+	})
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestTokens(t *testing.T) {
+	words, emotes := Tokens("GG the play was INSANE!! PogChamp 🔥 see https://x.example/y a KEKW, gg")
+	if want := []string{"gg", "play", "see", "gg"}; !slices.Equal(words, want) {
+		t.Errorf("words = %q, want %q", words, want)
+	}
+	if want := []string{"INSANE", "PogChamp", "🔥", "KEKW"}; !slices.Equal(emotes, want) {
+		t.Errorf("emotes = %q, want %q", emotes, want)
+	}
+}
+
+func TestCounterWindow(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 0, 30, 0, time.UTC)
+	c := NewCounter()
+	c.now = func() time.Time { return now }
+
+	c.Add(message.Message{Content: "old old LUL"})
+	now = now.Add(10 * time.Minute)
+	c.Add(message.Message{Content: "new LUL"})
+	c.Add(message.Message{Type: message.TypeSub, Content: "subscribed new new"})
+
+	words, emotes := c.Top(5*time.Minute, 10)
+	if want := []Count{{"new", 1}}; !slices.Equal(words, want) {
+		t.Errorf("5m words = %+v, want %+v", words, want)
+	}
+	if want := []Count{{"LUL", 1}}; !slices.Equal(emotes, want) {
+		t.Errorf("5m emotes = %+v, want %+v", emotes, want)
+	}
+
+	words, _ = c.Top(time.Hour, 1)
+	if want := []Count{{"old", 2}}; !slices.Equal(words, want) {
+		t.Errorf("1h top word = %+v, want %+v", words, want)
+	}
+
+	// Buckets older than the longest window are dropped as time moves on.
+	now = now.Add(2 * time.Hour)
+	c.Add(message.Message{Content: "later"})
+	if len(c.buckets) != 1 {
+		t.Errorf("kept %d buckets, want 1", len(c.buckets))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCounter()
+	c.Add(message.Message{Content: "hello hello world LUL"})
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?window=1m&limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body topResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Window != "1m0s" || !slices.Equal(body.Words, []Count{{"hello", 2}}) || !slices.Equal(body.Emotes, []Count{{"LUL", 1}}) {
+		t.Errorf("response = %+v", body)
+	}
+
+	for _, query := range []string{"?window=2h", "?window=soon", "?limit=0", "?limit=500"} {
+		resp, err := http.Get(server.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
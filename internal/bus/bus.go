@@ -0,0 +1,306 @@
+// Package bus carries chat between relay instances over NATS or Redis
+// pub/sub, in plaintext or TLS, one message per publish in the JSON schema of --output=json, so
+// one relay can read the platforms and another bridge and archive.
+package bus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/echo"
+	"relay/internal/message"
+	"relay/internal/netio"
+)
+
+const (
+	// DefaultSubject is the NATS subject or Redis channel chat is
+	// published on.
+	DefaultSubject = "relay.chat"
+
+	dialTimeout = 5 * time.Second
+	// keepalive is how long a subscription may be silent before the
+	// broker is pinged; a second silent keepalive drops the connection.
+	keepalive = time.Minute
+	// echoWait is how long a hackr.tv packet from the relay's alias waits
+	// for a bridge send still in flight, as in the hackr.tv client.
+	echoWait = time.Second
+)
+
+// Options configures a Client.
+type Options struct {
+	// Subject is the NATS subject or Redis channel (default "relay.chat").
+	Subject string
+	// Echoes and Alias drop the bridge's own hackr.tv packets when they
+	// come back over the bus, as the hackr.tv client does for its own
+	// connection.
+	Echoes *echo.Set
+	Alias  string
+	// Clock paces reconnect backoff. Defaults to the wall clock.
+	Clock clock.Clock
+	// WriteTimeout bounds each write to the broker, and Publish's wait
+	// for Redis to answer, so a broker that stops draining fails the
+	// publish instead of holding it. Defaults to 10s.
+	WriteTimeout time.Duration
+	// TLSConfig is used for tls:// and rediss:// URLs, and for a NATS
+	// server that requires TLS. ServerName defaults to the URL's host.
+	// Nil verifies the broker against the system roots.
+	TLSConfig *tls.Config
+}
+
+// conn is one connection to a broker.
+type conn interface {
+	publish(ctx context.Context, subject string, data []byte) error
+	subscribe(ctx context.Context, subject string) error
+	// next returns the payload of the next message on the subscription.
+	next() ([]byte, error)
+	// drain keeps a publishing connection alive in the background.
+	drain()
+	Close() error
+}
+
+// Client publishes to and subscribes from one broker.
+type Client struct {
+	url   *url.URL
+	opts  Options
+	clock clock.Clock
+
+	// mu guards pub, the publishing connection, dialed on first use and
+	// again after a failure.
+	mu  sync.Mutex
+	pub conn
+
+	minBackoff, maxBackoff time.Duration
+	reconnects             atomic.Int64
+}
+
+// New parses rawURL, "nats://[user:pass@|token@]host[:4222]" or
+// "redis://[[user]:pass@]host[:6379]", with tls:// and rediss:// for their
+// TLS forms. Nothing is dialed until the client is used.
+func New(rawURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "nats", "tls", "redis", "rediss":
+	default:
+		return nil, fmt.Errorf("bus url %q: scheme must be nats://, tls://, redis://, or rediss://", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("bus url %q: missing host", rawURL)
+	}
+	if opts.Subject == "" {
+		opts.Subject = DefaultSubject
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = netio.DefaultWriteTimeout
+	}
+	return &Client{
+		url:        u,
+		opts:       opts,
+		clock:      clock.Or(opts.Clock),
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+	}, nil
+}
+
+// String names the broker and subject without credentials, e.g.
+// "nats://10.0.0.5:4222 relay.chat".
+func (c *Client) String() string {
+	return c.url.Scheme + "://" + c.url.Host + " " + c.opts.Subject
+}
+
+// dial opens a connection of the URL's kind.
+func (c *Client) dial(ctx context.Context) (conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	redis := c.url.Scheme == "redis" || c.url.Scheme == "rediss"
+	port := "4222"
+	if redis {
+		port = "6379"
+	}
+	if p := c.url.Port(); p != "" {
+		port = p
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", net.JoinHostPort(c.url.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	var bc conn
+	switch {
+	case c.url.Scheme == "rediss":
+		// Redis has no STARTTLS: the handshake comes first
+		tc := tls.Client(nc, c.tlsConfig())
+		if err = tc.HandshakeContext(ctx); err == nil {
+			bc, err = newRedisConn(ctx, tc, c.url.User, c.opts.WriteTimeout)
+		}
+	case redis:
+		bc, err = newRedisConn(ctx, nc, c.url.User, c.opts.WriteTimeout)
+	default:
+		bc, err = newNATSConn(ctx, nc, c.url.User, c.opts.WriteTimeout, c.tlsConfig(), c.url.Scheme == "tls")
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	return bc, nil
+}
+
+// tlsConfig is Options.TLSConfig, or an empty one, naming the URL's host
+// as the server unless it already names one.
+func (c *Client) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if c.opts.TLSConfig != nil {
+		cfg = c.opts.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = c.url.Hostname()
+	}
+	return cfg
+}
+
+// waitIdle waits up to keepalive for the broker to send something,
+// without consuming it. It reports idle the first time nothing arrives, so
+// the caller can ping, and fails the second time in a row. Once data
+// arrives the rest of it must follow within keepalive.
+func waitIdle(nc net.Conn, r *bufio.Reader, pinged *bool) (idle bool, err error) {
+	nc.SetReadDeadline(time.Now().Add(keepalive))
+	_, err = r.Peek(1)
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout() && !*pinged:
+		*pinged = true
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	*pinged = false
+	return false, nil
+}
+
+// Publish sends msg to the subject, dialing first when there is no
+// connection. When a connection that has gone stale fails, msg is sent
+// once more on a new one. It gives up when ctx is done or a write
+// outlasts Options.WriteTimeout.
+func (c *Client) Publish(ctx context.Context, msg message.Message) error {
+	data, err := display.MarshalJSON(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		fresh := c.pub == nil
+		if fresh {
+			if c.pub, err = c.dial(ctx); err != nil {
+				return err
+			}
+			c.pub.drain()
+		}
+		err := c.pub.publish(ctx, c.opts.Subject, data)
+		if err == nil {
+			return nil
+		}
+		c.pub.Close()
+		c.pub = nil
+		if fresh || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the publishing connection, if any.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pub == nil {
+		return nil
+	}
+	err := c.pub.Close()
+	c.pub = nil
+	return err
+}
+
+// Connect subscribes to the subject and sends each message published
+// there on messages until ctx is cancelled. Dropped connections are
+// re-established with exponential backoff.
+func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) error {
+	backoff := c.minBackoff
+	for {
+		established, err := c.session(ctx, messages)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if established {
+			backoff = c.minBackoff
+		}
+
+		fmt.Fprintf(os.Stderr, "bus: %v; reconnecting in %s\n", err, backoff)
+		c.reconnects.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(backoff):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+// Reconnects returns how many times Connect has reconnected after the
+// connection dropped.
+func (c *Client) Reconnects() int64 {
+	return c.reconnects.Load()
+}
+
+// session runs one subscription until it fails. established reports
+// whether the subscription was made, so Connect can reset its backoff.
+func (c *Client) session(ctx context.Context, messages chan<- message.Message) (established bool, err error) {
+	bc, err := c.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer bc.Close()
+	if err := bc.subscribe(ctx, c.opts.Subject); err != nil {
+		return false, err
+	}
+	// Unblock next when the relay shuts down
+	stop := context.AfterFunc(ctx, func() { bc.Close() })
+	defer stop()
+
+	for {
+		data, err := bc.next()
+		if err != nil {
+			return true, err
+		}
+		msg, err := display.UnmarshalJSON(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bus: skipping message: %v\n", err)
+			continue
+		}
+		if msg.Platform == message.HackrTV && strings.EqualFold(msg.Username, c.opts.Alias) && c.opts.Echoes.Echo(msg.ID, echoWait) {
+			continue
+		}
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
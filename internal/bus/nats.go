@@ -0,0 +1,192 @@
+package bus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/netio"
+)
+
+// natsConn speaks the NATS client protocol: text commands, each payload
+// sent with its length.
+type natsConn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	// timeout bounds each write
+	timeout time.Duration
+	// mu keeps a PONG from interleaving with a PUB, and guards err
+	mu sync.Mutex
+	// err is why a publishing connection's reader stopped
+	err error
+	// pinged is set while a keepalive PING is unanswered
+	pinged bool
+}
+
+// newNATSConn reads the server's INFO, then sends CONNECT with the URL's
+// credentials: user and password, or a token in the user part. The PING
+// after CONNECT makes the server report a rejected login before PONG.
+// The connection is upgraded to TLS after INFO, as NATS does, when
+// requireTLS is set or the server asks for it.
+func newNATSConn(ctx context.Context, nc net.Conn, user *url.Userinfo, timeout time.Duration, tlsConfig *tls.Config, requireTLS bool) (*natsConn, error) {
+	c := &natsConn{nc: nc, r: bufio.NewReader(nc), timeout: timeout}
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return nil, fmt.Errorf("nats: expected INFO, got %q", line)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return nil, fmt.Errorf("nats: INFO: %w", err)
+	}
+	if requireTLS || info.TLSRequired {
+		tc := tls.Client(nc, tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("nats: tls: %w", err)
+		}
+		c.nc, c.r = tc, bufio.NewReader(tc)
+	}
+
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "relay", "lang": "go"}
+	if user != nil {
+		if pass, ok := user.Password(); ok {
+			opts["user"], opts["pass"] = user.Username(), pass
+		} else {
+			opts["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if err := c.write(ctx, fmt.Sprintf("CONNECT %s\r\nPING\r\n", connect)); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case line == "PONG":
+			return c, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, fmt.Errorf("nats: %s", natsError(line))
+		}
+	}
+}
+
+// write sends s within the connection's timeout, giving up when ctx is
+// done.
+func (c *natsConn) write(ctx context.Context, s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return netio.Write(ctx, c.nc, c.timeout, func(time.Time) error {
+		_, err := io.WriteString(c.nc, s)
+		return err
+	})
+}
+
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *natsConn) publish(ctx context.Context, subject string, data []byte) error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.write(ctx, fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(data), data))
+}
+
+// drain answers the server's PINGs on a publishing connection, which
+// otherwise reads nothing, so the server doesn't drop it as stale. The
+// next publish after the connection fails returns the failure.
+func (c *natsConn) drain() {
+	go func() {
+		for {
+			line, err := c.readLine()
+			if err == nil && strings.HasPrefix(line, "-ERR") {
+				err = fmt.Errorf("nats: %s", natsError(line))
+			}
+			if err != nil {
+				c.mu.Lock()
+				c.err = err
+				c.mu.Unlock()
+				return
+			}
+			if line == "PING" {
+				c.write(context.Background(), "PONG\r\n")
+			}
+		}
+	}()
+}
+
+func (c *natsConn) subscribe(ctx context.Context, subject string) error {
+	return c.write(ctx, fmt.Sprintf("SUB %s 1\r\n", subject))
+}
+
+func (c *natsConn) next() ([]byte, error) {
+	for {
+		idle, err := waitIdle(c.nc, c.r, &c.pinged)
+		if err != nil {
+			return nil, err
+		}
+		if idle {
+			if err := c.write(context.Background(), "PING\r\n"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case line == "PING":
+			if err := c.write(context.Background(), "PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, fmt.Errorf("nats: %s", natsError(line))
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("nats: bad MSG line %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, payload); err != nil {
+				return nil, err
+			}
+			return payload[:n], nil
+		}
+	}
+}
+
+func (c *natsConn) Close() error {
+	return c.nc.Close()
+}
+
+// natsError extracts the message from "-ERR 'Authorization Violation'".
+func natsError(line string) string {
+	return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'")
+}
@@ -0,0 +1,193 @@
+package bus
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"relay/internal/netio"
+)
+
+// redisConn speaks RESP, the Redis protocol, for PUBLISH and SUBSCRIBE.
+type redisConn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	// timeout bounds each write, and the reply to a PUBLISH
+	timeout time.Duration
+	// pinged is set while a keepalive PING is unanswered
+	pinged bool
+}
+
+// redisError is an error reply, e.g. "WRONGPASS invalid username-password
+// pair".
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// newRedisConn authenticates with the URL's password, and its user when
+// one is given (Redis 6 ACLs).
+func newRedisConn(ctx context.Context, nc net.Conn, user *url.Userinfo, timeout time.Duration) (*redisConn, error) {
+	c := &redisConn{nc: nc, r: bufio.NewReader(nc), timeout: timeout}
+	if user == nil {
+		return c, nil
+	}
+	args := []string{"AUTH"}
+	if pass, ok := user.Password(); ok {
+		if user.Username() != "" {
+			args = append(args, user.Username())
+		}
+		args = append(args, pass)
+	} else {
+		args = append(args, user.Username())
+	}
+	if _, err := c.call(ctx, args...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// command writes args as a RESP array of bulk strings within the
+// connection's timeout, giving up when ctx is done.
+func (c *redisConn) command(ctx context.Context, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return netio.Write(ctx, c.nc, c.timeout, func(time.Time) error {
+		_, err := io.WriteString(c.nc, b.String())
+		return err
+	})
+}
+
+// call sends a command and reads its reply.
+func (c *redisConn) call(ctx context.Context, args ...string) (any, error) {
+	if err := c.command(ctx, args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads one reply: a string, an int64, nil, a []any, or a
+// redisError as the error.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch body := line[1:]; line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *redisConn) publish(ctx context.Context, subject string, data []byte) error {
+	if err := c.command(ctx, "PUBLISH", subject, string(data)); err != nil {
+		return err
+	}
+	// A broker that takes the command but never answers is given up on
+	// like one that won't take it
+	c.nc.SetReadDeadline(time.Now().Add(c.timeout))
+	defer c.nc.SetReadDeadline(time.Time{})
+	_, err := c.read()
+	return err
+}
+
+// drain does nothing: every PUBLISH reads its own reply, and Redis
+// doesn't ping idle clients.
+func (c *redisConn) drain() {}
+
+func (c *redisConn) subscribe(ctx context.Context, subject string) error {
+	reply, err := c.call(ctx, "SUBSCRIBE", subject)
+	if err != nil {
+		return err
+	}
+	if kind, _ := redisPush(reply); kind != "subscribe" {
+		return fmt.Errorf("redis: unexpected SUBSCRIBE reply %v", reply)
+	}
+	return nil
+}
+
+func (c *redisConn) next() ([]byte, error) {
+	for {
+		idle, err := waitIdle(c.nc, c.r, &c.pinged)
+		if err != nil {
+			return nil, err
+		}
+		if idle {
+			// Subscribed connections may PING; the answer is a push
+			if err := c.command(context.Background(), "PING"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if kind, items := redisPush(reply); kind == "message" && len(items) == 3 {
+			if payload, ok := items[2].(string); ok {
+				return []byte(payload), nil
+			}
+		}
+	}
+}
+
+func (c *redisConn) Close() error {
+	return c.nc.Close()
+}
+
+// redisPush returns the kind of a pub/sub push, e.g. "message" for
+// ["message", channel, payload], and its items.
+func redisPush(reply any) (kind string, items []any) {
+	items, _ = reply.([]any)
+	if len(items) == 0 {
+		return "", nil
+	}
+	kind, _ = items[0].(string)
+	return kind, items
+}
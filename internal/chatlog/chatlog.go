@@ -0,0 +1,176 @@
+// Package chatlog archives every message to files in a directory, one per
+// day, as plain text or NDJSON, so streams can be searched later with
+// grep or jq.
+package chatlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+// Options configures a Log. The zero value writes plain text to the
+// working directory.
+type Options struct {
+	// Dir holds the log files, and is created if needed. Defaults to
+	// the working directory.
+	Dir string
+	// Format is "text" (default), one line per message, or "json", one
+	// JSON object per line in the same form as --output=json.
+	Format string
+	// Clock decides which day's file a message goes to. Defaults to the
+	// wall clock.
+	Clock clock.Clock
+}
+
+// Log appends messages to the day's file, relay-2025-01-15.log (or
+// .jsonl), moving to a new file at local midnight. It is safe for
+// concurrent use.
+type Log struct {
+	dir   string
+	json  bool
+	clock clock.Clock
+
+	mu sync.Mutex
+	// day is the date of the open file, as in its name.
+	day string
+	f   *os.File
+}
+
+// New creates a Log, creating its directory. Files are opened on the
+// first Write.
+func New(opts Options) (*Log, error) {
+	l := &Log{dir: opts.Dir, clock: clock.Or(opts.Clock)}
+	switch opts.Format {
+	case "", "text":
+	case "json":
+		l.json = true
+	default:
+		return nil, fmt.Errorf("unknown chat log format %q, want text or json", opts.Format)
+	}
+	if l.dir != "" {
+		if err := os.MkdirAll(l.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating chat log directory: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Path returns the file messages written on day go to.
+func (l *Log) Path(day time.Time) string {
+	ext := ".log"
+	if l.json {
+		ext = ".jsonl"
+	}
+	return filepath.Join(l.dir, "relay-"+day.Local().Format(time.DateOnly)+ext)
+}
+
+// Write appends msg to today's file, opening it first when the day has
+// changed.
+func (l *Log) Write(msg message.Message) error {
+	line, err := l.format(msg)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if day := now.Local().Format(time.DateOnly); day != l.day || l.f == nil {
+		if l.f != nil {
+			l.f.Close()
+			l.f = nil
+		}
+		f, err := os.OpenFile(l.Path(now), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("opening chat log: %w", err)
+		}
+		l.f, l.day = f, day
+	}
+	if _, err := l.f.Write(line); err != nil {
+		return fmt.Errorf("writing chat log: %w", err)
+	}
+	return nil
+}
+
+// format renders msg as one line:
+//
+//	2025-01-15 14:30:45 [TTV] #xqc bob: hello
+//	2025-01-15 14:31:02 [TTV] #xqc * raider is raiding with 12 viewers
+//
+// or as JSON.
+func (l *Log) format(msg message.Message) ([]byte, error) {
+	if l.json {
+		data, err := display.MarshalJSON(msg)
+		if err != nil {
+			return nil, fmt.Errorf("encoding chat log line: %w", err)
+		}
+		return append(data, '\n'), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] ", msg.Timestamp.Local().Format(time.DateTime), msg.Platform)
+	if msg.Channel != "" {
+		b.WriteString("#" + msg.Channel + " ")
+	}
+	if msg.IsEvent() {
+		b.WriteString("* ")
+	} else {
+		b.WriteString(msg.Username + ": ")
+	}
+	// One line per message, whatever the content holds
+	b.WriteString(strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(msg.Content))
+	b.WriteString("\n")
+	return []byte(b.String()), nil
+}
+
+// ParseLine reads back a line written in either format. A text line
+// gives the platform, channel, sender, content, and a timestamp to the
+// second in local time, and whether it is an event, as TypeSystem.
+func ParseLine(line string) (message.Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "{") {
+		return display.UnmarshalJSON([]byte(line))
+	}
+	if len(line) < len(time.DateTime)+3 {
+		return message.Message{}, fmt.Errorf("chat log line too short: %q", line)
+	}
+	ts, err := time.ParseInLocation(time.DateTime, line[:len(time.DateTime)], time.Local)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("chat log line has no timestamp: %q", line)
+	}
+	label, rest, ok := strings.Cut(strings.TrimPrefix(line[len(time.DateTime):], " ["), "] ")
+	p, known := message.ParsePlatform(label)
+	if !ok || !known {
+		return message.Message{}, fmt.Errorf("chat log line has no platform: %q", line)
+	}
+	msg := message.Message{Platform: p, Timestamp: ts}
+	if strings.HasPrefix(rest, "#") {
+		msg.Channel, rest, _ = strings.Cut(rest[1:], " ")
+	}
+	if content, ok := strings.CutPrefix(rest, "* "); ok {
+		msg.Type, msg.Content = message.TypeSystem, content
+		return msg, nil
+	}
+	if msg.Username, msg.Content, ok = strings.Cut(rest, ": "); !ok {
+		return message.Message{}, fmt.Errorf("chat log line has no sender: %q", line)
+	}
+	return msg, nil
+}
+
+// Close closes the open file, if any.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,152 @@
+package chatlog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+// ts is built in local time, as files are dated, so tests don't depend
+// on the machine's zone.
+var ts = time.Date(2025, 1, 15, 23, 59, 30, 0, time.Local)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteText(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	l, err := New(Options{Dir: dir, Clock: clock.NewFake(ts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	msgs := []message.Message{
+		{Platform: message.Twitch, Channel: "xqc", Username: "bob", Content: "hello\nthere", Timestamp: ts},
+		{Platform: message.Twitch, Channel: "xqc", Type: message.TypeRaid, Username: "raider", Content: "raider is raiding with 12 viewers", Timestamp: ts},
+		{Platform: message.HackrTV, Username: "xeraen", Content: "welcome", Timestamp: ts},
+	}
+	for _, msg := range msgs {
+		if err := l.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "2025-01-15 23:59:30 [TTV] #xqc bob: hello there\n" +
+		"2025-01-15 23:59:30 [TTV] #xqc * raider is raiding with 12 viewers\n" +
+		"2025-01-15 23:59:30 [HTV] xeraen: welcome\n"
+	if got := read(t, filepath.Join(dir, "relay-2025-01-15.log")); got != want {
+		t.Errorf("log =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(Options{Dir: dir, Format: "json", Clock: clock.NewFake(ts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := l.Write(message.Message{Platform: message.YouTube, Username: "fan", Content: "hi", Timestamp: ts}); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Platform string `json:"platform"`
+		Username string `json:"username"`
+		Content  string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(read(t, filepath.Join(dir, "relay-2025-01-15.jsonl"))), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "fan" || got.Content != "hi" {
+		t.Errorf("line = %+v", got)
+	}
+}
+
+func TestRotatesDaily(t *testing.T) {
+	dir := t.TempDir()
+	fake := clock.NewFake(ts)
+	l, err := New(Options{Dir: dir, Clock: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Write(message.Message{Platform: message.Twitch, Username: "bob", Content: "before midnight", Timestamp: ts})
+	fake.Advance(time.Minute)
+	l.Write(message.Message{Platform: message.Twitch, Username: "bob", Content: "after midnight", Timestamp: ts.Add(time.Minute)})
+
+	if got := read(t, filepath.Join(dir, "relay-2025-01-15.log")); got != "2025-01-15 23:59:30 [TTV] bob: before midnight\n" {
+		t.Errorf("first day = %q", got)
+	}
+	if got := read(t, filepath.Join(dir, "relay-2025-01-16.log")); got != "2025-01-16 00:00:30 [TTV] bob: after midnight\n" {
+		t.Errorf("second day = %q", got)
+	}
+}
+
+func TestAppendsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	for _, content := range []string{"first run", "second run"} {
+		l, err := New(Options{Dir: dir, Clock: clock.NewFake(ts)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Write(message.Message{Platform: message.Twitch, Username: "bob", Content: content, Timestamp: ts})
+		l.Close()
+	}
+	want := "2025-01-15 23:59:30 [TTV] bob: first run\n2025-01-15 23:59:30 [TTV] bob: second run\n"
+	if got := read(t, filepath.Join(dir, "relay-2025-01-15.log")); got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(Options{Dir: t.TempDir(), Format: "csv"}); err == nil {
+		t.Error("New() accepted an unknown format")
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	msg, err := ParseLine("2025-01-15 23:59:30 [TTV] #xqc bob: hello: there\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Platform != message.Twitch || msg.Channel != "xqc" || msg.Username != "bob" || msg.Content != "hello: there" || !msg.Timestamp.Equal(ts) || msg.IsEvent() {
+		t.Errorf("ParseLine() = %+v", msg)
+	}
+
+	msg, err = ParseLine("2025-01-15 23:59:30 [TTV] #xqc * raider is raiding with 12 viewers")
+	if err != nil || !msg.IsEvent() || msg.Content != "raider is raiding with 12 viewers" {
+		t.Errorf("ParseLine(event) = %+v, %v", msg, err)
+	}
+
+	msg, err = ParseLine("2025-01-15 23:59:30 [HTV] xeraen: welcome")
+	if err != nil || msg.Platform != message.HackrTV || msg.Channel != "" || msg.Username != "xeraen" {
+		t.Errorf("ParseLine(no channel) = %+v, %v", msg, err)
+	}
+
+	// JSON lines come back whole
+	data, _ := display.MarshalJSON(message.Message{Platform: message.YouTube, Username: "fan", Content: "hi", Timestamp: ts})
+	if msg, err = ParseLine(string(data)); err != nil || msg.Username != "fan" {
+		t.Errorf("ParseLine(json) = %+v, %v", msg, err)
+	}
+
+	for _, bad := range []string{"", "hello", "2025-01-15 23:59:30 [XYZ] bob: hi", "2025-01-15 23:59:30 [TTV] bob"} {
+		if _, err := ParseLine(bad); err == nil {
+			t.Errorf("ParseLine(%q) succeeded", bad)
+		}
+	}
+}
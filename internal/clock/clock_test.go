@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+
+// fired reports whether ch has a value ready.
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	ch := f.After(10 * time.Second)
+	f.Advance(9 * time.Second)
+	if fired(ch) {
+		t.Fatal("After fired early")
+	}
+	f.Advance(time.Second)
+	if !fired(ch) {
+		t.Fatal("After did not fire at its deadline")
+	}
+	if n := f.Waiters(); n != 0 {
+		t.Errorf("Waiters() = %d after firing, want 0", n)
+	}
+	if !fired(f.After(0)) {
+		t.Error("After(0) should fire immediately")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	tk := f.NewTicker(time.Second)
+	f.Advance(time.Second)
+	if got := <-tk.C(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("tick at %v", got)
+	}
+	// A reader that falls behind gets one tick, not a backlog.
+	f.Advance(5 * time.Second)
+	if !fired(tk.C()) {
+		t.Fatal("ticker did not fire")
+	}
+	if fired(tk.C()) {
+		t.Error("ticker queued more than one tick")
+	}
+	tk.Stop()
+	f.Advance(time.Second)
+	if fired(tk.C()) {
+		t.Error("stopped ticker fired")
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Or(nil) should be the real clock")
+	}
+	f := NewFake(start)
+	if Or(f) != Clock(f) {
+		t.Error("Or should keep a set clock")
+	}
+}
@@ -0,0 +1,262 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"relay/internal/message"
+)
+
+const (
+	defaultWindow    = 10 * time.Minute
+	defaultThreshold = 0.6
+
+	// minLength is the shortest normalized text clustered; short replies
+	// like "lol" are too common to say anything about spam.
+	minLength = 12
+	// maxClusters bounds memory during a flood of unrelated messages.
+	maxClusters = 500
+	// maxUsers and maxSamples cap what each cluster remembers.
+	maxUsers   = 20
+	maxSamples = 5
+)
+
+// Options configures clustering. Zero values use the defaults.
+type Options struct {
+	// Window is how long a cluster is kept after its last message.
+	// Defaults to 10m.
+	Window time.Duration
+	// Threshold is the trigram similarity (0-1) at which a message joins
+	// a cluster. Defaults to 0.6.
+	Threshold float64
+}
+
+// Cluster is a group of near-duplicate messages.
+type Cluster struct {
+	// Text is the first message that started the cluster.
+	Text      string    `json:"text"`
+	Count     int       `json:"count"`
+	Users     []string  `json:"users"`
+	Platforms []string  `json:"platforms"`
+	Samples   []string  `json:"samples"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	grams map[string]struct{}
+}
+
+// Clusterer groups recent chat into clusters of similar messages, so a
+// spam wave or repeated scam link shows up as one large cluster.
+type Clusterer struct {
+	window    time.Duration
+	threshold float64
+	now       func() time.Time
+
+	mu       sync.Mutex
+	clusters []*Cluster
+}
+
+// New creates a Clusterer.
+func New(opts Options) *Clusterer {
+	c := &Clusterer{window: opts.Window, threshold: opts.Threshold, now: time.Now}
+	if c.window <= 0 {
+		c.window = defaultWindow
+	}
+	if c.threshold <= 0 || c.threshold > 1 {
+		c.threshold = defaultThreshold
+	}
+	return c
+}
+
+// Add assigns a chat message to the most similar cluster, or starts a
+// new one. Events and short messages are ignored.
+func (c *Clusterer) Add(msg message.Message) {
+	if msg.IsEvent() {
+		return
+	}
+	norm := normalize(msg.Content)
+	if len([]rune(norm)) < minLength {
+		return
+	}
+	grams := trigrams(norm)
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+
+	var best *Cluster
+	bestScore := 0.0
+	for _, cl := range c.clusters {
+		if score := similarity(grams, cl.grams); score >= c.threshold && score > bestScore {
+			best, bestScore = cl, score
+		}
+	}
+	if best == nil {
+		if len(c.clusters) >= maxClusters {
+			c.dropQuietest()
+		}
+		best = &Cluster{Text: msg.Content, FirstSeen: now, grams: grams}
+		c.clusters = append(c.clusters, best)
+	}
+	best.Count++
+	best.LastSeen = now
+	best.Users = appendUnique(best.Users, msg.Username, maxUsers)
+	best.Platforms = appendUnique(best.Platforms, msg.Platform.String(), len(message.Platforms()))
+	best.Samples = appendUnique(best.Samples, msg.Content, maxSamples)
+}
+
+// expire drops clusters idle for longer than the window. c.mu must be held.
+func (c *Clusterer) expire(now time.Time) {
+	cutoff := now.Add(-c.window)
+	kept := c.clusters[:0]
+	for _, cl := range c.clusters {
+		if !cl.LastSeen.Before(cutoff) {
+			kept = append(kept, cl)
+		}
+	}
+	clear(c.clusters[len(kept):])
+	c.clusters = kept
+}
+
+// dropQuietest removes the least recently active single-message
+// cluster, or the least recently active one if none are single.
+// c.mu must be held.
+func (c *Clusterer) dropQuietest() {
+	victim := 0
+	for i, cl := range c.clusters {
+		if quieter(cl, c.clusters[victim]) {
+			victim = i
+		}
+	}
+	c.clusters = append(c.clusters[:victim], c.clusters[victim+1:]...)
+}
+
+// quieter reports whether a is a better eviction candidate than b.
+func quieter(a, b *Cluster) bool {
+	if (a.Count == 1) != (b.Count == 1) {
+		return a.Count == 1
+	}
+	return a.LastSeen.Before(b.LastSeen)
+}
+
+// Clusters returns copies of the live clusters with at least minCount
+// messages, largest first.
+func (c *Clusterer) Clusters(minCount int) []Cluster {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(c.now())
+
+	var out []Cluster
+	for _, cl := range c.clusters {
+		if cl.Count < minCount {
+			continue
+		}
+		cp := *cl
+		cp.Users = append([]string(nil), cl.Users...)
+		cp.Platforms = append([]string(nil), cl.Platforms...)
+		cp.Samples = append([]string(nil), cl.Samples...)
+		cp.grams = nil
+		out = append(out, cp)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
+
+// Handler serves GET ?min=3 with the clusters of at least min messages
+// (default 2) as JSON.
+func (c *Clusterer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		minCount := 2
+		if v := r.URL.Query().Get("min"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "min must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			minCount = n
+		}
+		clusters := c.Clusters(minCount)
+		if clusters == nil {
+			clusters = []Cluster{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"clusters": clusters})
+	})
+}
+
+// normalize lowercases s, drops punctuation and symbols, and collapses
+// whitespace, so variations like "FREE  nitro!!" and "free nitro" match.
+func normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '/' || r == '.':
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// trigrams returns the set of three-rune substrings of s.
+func trigrams(s string) map[string]struct{} {
+	runes := []rune(s)
+	grams := make(map[string]struct{}, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = struct{}{}
+	}
+	return grams
+}
+
+// similarity is the Jaccard index of two trigram sets.
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for g := range a {
+		if _, ok := b[g]; ok {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// appendUnique appends v to list unless present or list is at limit.
+func appendUnique(list []string, v string, limit int) []string {
+	if v == "" || len(list) >= limit {
+		return list
+	}
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
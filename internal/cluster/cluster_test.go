@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestClustererGroupsNearDuplicates(t *testing.T) {
+	c := New(Options{})
+	for _, m := range []message.Message{
+		{Platform: message.Twitch, Username: "bot1", Content: "FREE nitro at https://scam.example/claim !!"},
+		{Platform: message.Twitch, Username: "bot2", Content: "free nitro at https://scam.example/claim2"},
+		{Platform: message.YouTube, Username: "bot3", Content: "Free Nitro at: https://scam.example/claim"},
+		{Platform: message.Twitch, Username: "alice", Content: "that boss fight was incredible"},
+		{Platform: message.Twitch, Username: "bob", Content: "lol"},
+		{Platform: message.Twitch, Type: message.TypeSub, Username: "carol", Content: "free nitro at https://scam.example/claim"},
+	} {
+		c.Add(m)
+	}
+
+	got := c.Clusters(1)
+	if len(got) != 2 {
+		t.Fatalf("got %d clusters, want 2: %+v", len(got), got)
+	}
+	spam := got[0]
+	if spam.Count != 3 || len(spam.Users) != 3 || len(spam.Platforms) != 2 || len(spam.Samples) != 3 {
+		t.Errorf("spam cluster = %+v", spam)
+	}
+	if got[1].Count != 1 || got[1].Users[0] != "alice" {
+		t.Errorf("second cluster = %+v", got[1])
+	}
+	if big := c.Clusters(2); len(big) != 1 {
+		t.Errorf("Clusters(2) returned %d clusters, want 1", len(big))
+	}
+}
+
+func TestClustererExpires(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 0, 0, 0, time.UTC)
+	c := New(Options{Window: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Add(message.Message{Username: "a", Content: "buy followers cheap now"})
+	now = now.Add(2 * time.Minute)
+	c.Add(message.Message{Username: "b", Content: "buy followers cheap now"})
+
+	got := c.Clusters(1)
+	if len(got) != 1 || got[0].Count != 1 || got[0].Users[0] != "b" {
+		t.Errorf("clusters after expiry = %+v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := New(Options{})
+	c.Add(message.Message{Username: "a", Content: "follow my channel please"})
+	c.Add(message.Message{Username: "b", Content: "follow my channel please!"})
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?min=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Clusters []Cluster `json:"clusters"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Clusters) != 1 || body.Clusters[0].Count != 2 || body.Clusters[0].Text != "follow my channel please" {
+		t.Errorf("response = %+v", body)
+	}
+
+	resp, err = http.Get(server.URL + "?min=zero")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad min status = %d, want 400", resp.StatusCode)
+	}
+}
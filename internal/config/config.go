@@ -3,31 +3,630 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	Bridge  bool          `toml:"bridge"`
+	Bridge bool `toml:"bridge"`
+	// BridgeOrder is "best_effort" (default) or "strict"; strict retries
+	// failed sends so hackr.tv always shows messages in source order.
+	BridgeOrder string `toml:"bridge_order"`
+	// BridgeSlowMode bridges at most one chat message per user per
+	// interval, e.g. "10s", summarizing the rest. Zero disables it.
+	BridgeSlowMode time.Duration `toml:"bridge_slow_mode"`
+	// BridgePrefix starts hackr.tv chat posted to Twitch and YouTube,
+	// replacing the default "[HTV]".
+	BridgePrefix string `toml:"bridge_prefix"`
+	// BridgeAnnounce posts to hackr.tv when the bridge starts and stops,
+	// naming the mirrored chats.
+	BridgeAnnounce bool `toml:"bridge_announce"`
+	// BridgeDryRun runs the bridge end to end but logs what would be
+	// sent instead of sending it. It turns the bridge on, and needs no
+	// hackr.tv token.
+	BridgeDryRun bool `toml:"bridge_dry_run"`
+	// BridgeWorkers is how many bridged messages are sent at once. Each
+	// user's messages stay in order. Defaults to 1.
+	BridgeWorkers int `toml:"bridge_workers"`
+	// BridgeRate caps bridged messages per second with a token bucket, to
+	// stay under hackr.tv's rate limit. Zero disables it.
+	BridgeRate float64 `toml:"bridge_rate"`
+	// BridgeBurst is how many messages may go out at once before
+	// BridgeRate applies. Defaults to 1.
+	BridgeBurst int `toml:"bridge_burst"`
+	// BridgeTemplate is a Go text/template for bridged messages over
+	// .Platform, .Username, .Content, .Channel, .Amount, and .Event.
+	// Echoes are recognized by the same template. Empty keeps
+	// "[TTV] user: text".
+	BridgeTemplate string `toml:"bridge_template"`
+	// BridgeMaxLength caps each bridged message, in bytes, ending longer
+	// ones with "…". Defaults to 512.
+	BridgeMaxLength int `toml:"bridge_max_length"`
+	// BridgeOptOut lists viewers never bridged: a username, or
+	// "platform:username" for one platform.
+	BridgeOptOut []string `toml:"bridge_opt_out"`
+	// BridgeOptOutFile keeps the opt-outs viewers make with !nobridge
+	// across restarts.
+	BridgeOptOutFile string `toml:"bridge_opt_out_file"`
+	// BridgeReplies answers !bridge, !nobridge, and !yesbridge in Twitch
+	// and YouTube chat, where the relay can post there.
+	BridgeReplies bool `toml:"bridge_replies"`
+	// BridgeRetryQueue keeps up to this many bridged messages that failed
+	// to send or didn't fit the uplink queue, and retries them with
+	// backoff. Zero disables it.
+	BridgeRetryQueue int `toml:"bridge_retry_queue"`
+	// BridgeSpillFile, with BridgeRetryQueue, holds retry-queue overflow
+	// on disk and keeps unsent messages across restarts.
+	BridgeSpillFile string `toml:"bridge_spill_file"`
+	// BridgeBreaker pauses bridge sends after this many fail in a row,
+	// holding messages until hackr.tv answers again. Zero disables it.
+	BridgeBreaker int `toml:"bridge_breaker"`
+	// BridgeBreakerCooldown is how long sends pause before hackr.tv is
+	// tried again. Defaults to 30s.
+	BridgeBreakerCooldown time.Duration `toml:"bridge_breaker_cooldown"`
+	// BridgeRoutes limits bridging to the listed sources and picks each
+	// one's hackr.tv channel. Empty bridges every platform to the first
+	// hackr.tv channel.
+	BridgeRoutes []BridgeRouteConfig `toml:"bridge_routes"`
+	// BridgeFilters keeps bot spam, commands, and unwanted words off
+	// hackr.tv. It is a top-level table because "bridge" is already the
+	// on/off switch.
+	BridgeFilters BridgeFiltersConfig `toml:"bridge_filters"`
+
+	// StateDir holds what the relay saves to pick up where it left off
+	// after a restart, such as YouTube chat checkpoints. Empty saves
+	// nothing.
+	StateDir string `toml:"state_dir"`
+	// ReplayWindow drops messages stamped more than this long before the
+	// relay started, so history a source replays on connect after a
+	// restart isn't printed or bridged again. Zero keeps everything.
+	ReplayWindow time.Duration `toml:"replay_window"`
+	// KeepRaw has each source keep the payload every message was parsed
+	// from, for the JSON output and chat log to include.
+	KeepRaw bool `toml:"keep_raw"`
+	// SendTimeout bounds each message sent to hackr.tv, Twitch, YouTube,
+	// or the bus, and each write to their connections, so a platform
+	// that stops answering fails the send instead of holding up the
+	// bridge or shutdown. Defaults to 10s.
+	SendTimeout time.Duration `toml:"send_timeout"`
+
 	Twitch  TwitchConfig  `toml:"twitch"`
 	YouTube YouTubeConfig `toml:"youtube"`
 	HackrTV HackrTVConfig `toml:"hackrtv"`
+	Display DisplayConfig `toml:"display"`
+	// Previews fetches OpenGraph metadata for links in chat.
+	Previews PreviewConfig `toml:"previews"`
+	// Enrich looks up senders' account details, such as Twitch account
+	// age and avatar, for the dashboard, overlays, and bridge filters.
+	Enrich EnrichConfig `toml:"enrich"`
+	// Highlights configures the /clip command.
+	Highlights HighlightsConfig `toml:"highlights"`
+	// Retention bounds the files the relay keeps on disk.
+	Retention RetentionConfig `toml:"retention"`
+	// Hype emits an event when chat speeds up well past its baseline.
+	Hype HypeConfig `toml:"hype"`
+	// Currency converts cheers and Super Chats into one base currency.
+	Currency CurrencyConfig `toml:"currency"`
+	// Supporters mirrors subscriber, member, and VIP chat to a second
+	// hackr.tv channel when bridging.
+	Supporters SupportersConfig `toml:"supporters"`
+	// Sinks tunes delivery to each output, keyed "printer", "uplink",
+	// "supporters", "twitch", "youtube", "replies", "bus", "chat_log", or
+	// "notifications".
+	Sinks map[string]SinkConfig `toml:"sinks"`
+	// API serves chat analytics over local HTTP when Listen is set.
+	API APIConfig `toml:"api"`
+	// Server controls who may reach the relay's local servers.
+	Server ServerConfig `toml:"server"`
+	// Signing signs the JSON the relay serves with an Ed25519 key.
+	Signing SigningConfig `toml:"signing"`
+	// Labels overrides platform tags ("twitch" = "TTV") used when
+	// bridging, in echo detection, and in the display.
+	Labels map[string]string `toml:"labels"`
+	// Demo configures the generated chat shown by "relay demo".
+	Demo DemoConfig `toml:"demo"`
+	// Bus splits reading platforms and bridging between relay instances.
+	Bus BusConfig `toml:"bus"`
+	// ChatLog archives every message to a file per day when Dir is set.
+	ChatLog ChatLogConfig `toml:"chat_log"`
+	// Notifications raises desktop notifications for chat that shouldn't
+	// be missed.
+	Notifications NotificationsConfig `toml:"notifications"`
+	// Emotes finds third-party emotes in Twitch chat.
+	Emotes EmotesConfig `toml:"emotes"`
+	// SafeMode starts the relay with only the printer after it crashes
+	// repeatedly. It needs StateDir.
+	SafeMode SafeModeConfig `toml:"safe_mode"`
 }
 
-type TwitchConfig struct {
+type DisplayConfig struct {
+	// Labels overrides platform tags in the terminal only, e.g. emoji.
+	Labels map[string]string `toml:"labels"`
+	// Locale selects the language of system events and the format of
+	// timestamps and amounts, e.g. "de". Defaults to "en".
+	Locale string `toml:"locale"`
+	// Output is "text" (the colored terminal format) or "json", one JSON
+	// object per message on stdout. Defaults to "text".
+	Output string `toml:"output"`
+	// Template replaces the text format with a Go text/template over
+	// .Platform, .Username, .Timestamp, .Content, .Channel, and more,
+	// with color functions such as {{cyan .Username}}.
+	Template string `toml:"template"`
+	// Width wraps message content at this many columns. Defaults to the
+	// terminal's width; -1 never wraps.
+	Width int `toml:"width"`
+	// TUI shows chat full-screen with scrollback, pause, platform toggle
+	// keys, and each source's status, instead of printing it.
+	TUI bool `toml:"tui"`
+	// Highlights picks out chat mentioning any of these words, matched
+	// whole and ignoring case, e.g. ["@mychannel", "relay"].
+	Highlights []string `toml:"highlights"`
+	// Bell rings the terminal bell for highlighted chat.
+	Bell bool `toml:"bell"`
+	// Platforms limits the display to these platforms, by key or label,
+	// e.g. ["ttv", "htv"]. The rest start out muted, and are still
+	// bridged, logged, and served. Empty shows every platform.
+	Platforms []string `toml:"platforms"`
+	// Emotes is how emotes in chat are shown: "text" (their names in
+	// color, the default), "images" (pictures, on kitty and iTerm2), or
+	// "plain".
+	Emotes string `toml:"emotes"`
+	// TimestampFormat is a Go time layout for chat times, e.g. "15:04"
+	// or "2006-01-02 15:04:05 MST", or "relative" for "2m ago" in the
+	// TUI. Defaults to the locale's clock time.
+	TimestampFormat string `toml:"timestamp_format"`
+	// Timezone shows chat times in this zone: "UTC", "Local" (the
+	// default), or an IANA name such as "America/New_York".
+	Timezone string `toml:"timezone"`
+}
+
+type EmotesConfig struct {
+	// Providers lists the emote services to look up, "bttv" (BetterTTV)
+	// and/or "7tv". Empty finds only Twitch's own emotes.
+	Providers []string `toml:"providers"`
+	// Refresh is how long a channel's emotes are kept before they are
+	// fetched again, e.g. "1h".
+	Refresh time.Duration `toml:"refresh"`
+}
+
+type SafeModeConfig struct {
+	// Crashes is how many crashes within Window start the relay in safe
+	// mode. Defaults to 3; -1 never does.
+	Crashes int `toml:"crashes"`
+	// Window is how recent a crash must be to count, e.g. "10m".
+	Window time.Duration `toml:"window"`
+}
+
+type PreviewConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Deny lists hosts (and their subdomains) never fetched.
+	Deny []string `toml:"deny"`
+	// MaxConcurrent caps simultaneous fetches. Defaults to 4.
+	MaxConcurrent int `toml:"max_concurrent"`
+	// Timeout is how long a message may wait for its previews, e.g. "2s".
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type EnrichConfig struct {
+	Enabled bool `toml:"enabled"`
+	// CacheSize caps how many senders are remembered. Defaults to 1000.
+	CacheSize int `toml:"cache_size"`
+	// TTL is how long a sender's details are kept, e.g. "6h".
+	TTL time.Duration `toml:"ttl"`
+	// Rate caps lookups per second on each platform. Defaults to 2.
+	Rate float64 `toml:"rate"`
+	// Timeout is how long a message may wait for a lookup, e.g. "1s".
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type HypeConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Factor is how many times the baseline rate counts as hype.
+	// Defaults to 3.
+	Factor float64 `toml:"factor"`
+	// Window is the span compared against the baseline, e.g. "10s".
+	Window time.Duration `toml:"window"`
+	// Baseline is how much earlier chat sets the normal rate, e.g. "5m".
+	Baseline time.Duration `toml:"baseline"`
+	// MinMessages is the fewest messages in a window that can be hype.
+	MinMessages int `toml:"min_messages"`
+	// Cooldown is the least time between hype events, e.g. "1m".
+	Cooldown time.Duration `toml:"cooldown"`
+}
+
+type SupportersConfig struct {
+	// Channel is the hackr.tv channel that receives supporter chat.
+	// Empty disables the mirror. It needs auth_mode = "admin".
 	Channel string `toml:"channel"`
+	// Badges count a sender as a supporter. Defaults to subscriber,
+	// founder, vip, and member.
+	Badges []string `toml:"badges"`
+}
+
+type CurrencyConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Base is the ISO 4217 code amounts are converted to. Defaults to USD.
+	Base string `toml:"base"`
+	// RatesURL overrides the exchange-rate service (open.er-api.com
+	// format), fetched once a day as <rates_url>/<base>.
+	RatesURL string `toml:"rates_url"`
+}
+
+type SinkConfig struct {
+	// Buffer is the sink's queue length. Defaults to 100.
+	Buffer int `toml:"buffer"`
+	// Concurrency is how many messages the sink handles at once.
+	// Defaults to 1; more requires ordered = false.
+	Concurrency int `toml:"concurrency"`
+	// Ordered delivers messages one at a time in arrival order.
+	// Defaults to true.
+	Ordered *bool `toml:"ordered"`
+	// Overflow is "block" (wait, holding up every sink) or "drop" when
+	// the queue is full. The printer blocks by default, the uplink drops.
+	Overflow string `toml:"overflow"`
+	// Markup rewrites chat for this route before it is handled.
+	Markup MarkupConfig `toml:"markup"`
+	// Footer is appended to each message on this route, e.g. " ↪ via
+	// relay", so viewers can tell mirrored chat apart.
+	Footer string `toml:"footer"`
+}
+
+// MarkupConfig translates emotes and formatting for one route. The zero
+// value passes chat through unchanged.
+type MarkupConfig struct {
+	// Emotes is "keep" (default), "shortcode" (":Kappa:"), or "strip"
+	// for Twitch emotes and YouTube custom emoji.
+	Emotes string `toml:"emotes"`
+	// Emoji is "keep" (default) or "strip" for Unicode emoji.
+	Emoji string `toml:"emoji"`
+	// Plain strips /me framing, invisible characters, and stacked
+	// combining marks.
+	Plain bool `toml:"plain"`
+}
+
+type APIConfig struct {
+	// Listen is the address for the HTTP API, e.g. "127.0.0.1:8787".
+	// Empty disables it.
+	Listen string `toml:"listen"`
+	// Dashboard serves a web page at /dashboard with the live chat,
+	// source status, and message rates.
+	Dashboard bool `toml:"dashboard"`
+	// DashboardControls adds mute and solo buttons to the dashboard.
+	// They post to /api/display, which needs the control scope.
+	DashboardControls bool `toml:"dashboard_controls"`
+}
+
+type ServerConfig struct {
+	// AllowRemote permits listening on non-loopback addresses. It
+	// requires Tokens or ClientCA.
+	AllowRemote bool `toml:"allow_remote"`
+	// Tokens are bearer tokens accepted by the servers, each with a scope.
+	// Without tokens or a client CA, loopback callers may do anything.
+	Tokens []ServerTokenConfig `toml:"tokens"`
+	// TLSCert and TLSKey serve HTTPS.
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+	// ClientCA requires clients to present a certificate it signed
+	// (mTLS). A verified certificate grants ClientScope, default "read".
+	ClientCA    string `toml:"client_ca"`
+	ClientScope string `toml:"client_scope"`
+}
+
+type ServerTokenConfig struct {
+	Token string `toml:"token"`
+	// Scope is "read" (the default) or "control".
+	Scope string `toml:"scope"`
+}
+
+type SigningConfig struct {
+	// Enabled signs HTTP API responses in an X-Relay-Signature header,
+	// and each JSON event (the JSON output, bus, dashboard stream, and
+	// JSON chat logs) in a final "signature" field.
+	Enabled bool `toml:"enabled"`
+	// KeyFile holds the PEM private key, created on first use. Defaults
+	// to signing.key in the state directory.
+	KeyFile string `toml:"key_file"`
+}
+
+type BusConfig struct {
+	// URL is the broker: "nats://host:4222" or "redis://host:6379", or
+	// "tls://" and "rediss://" for TLS, with any user, password, or NATS
+	// token in the URL.
+	URL string `toml:"url"`
+	// Role is "publish", to read the platforms and publish their chat, or
+	// "consume", to take chat from the bus instead of the platforms.
+	Role string `toml:"role"`
+	// Subject is the NATS subject or Redis channel. Defaults to
+	// "relay.chat".
+	Subject string `toml:"subject"`
+}
+
+type ChatLogConfig struct {
+	// Dir holds the daily log files, e.g. "logs". Empty disables the
+	// chat log.
+	Dir string `toml:"dir"`
+	// Format is "text" (default), one line per message, or "json", one
+	// object per line as with --output=json.
+	Format string `toml:"format"`
+}
+
+type NotificationsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Events are what to notify for: "highlights", "paid" (cheers and
+	// Super Chats), or an event type such as "raid" or "sub". Defaults to
+	// paid, raid, and highlights when [display] has keywords.
+	Events []string `toml:"events"`
+	// Users are senders whose every message notifies: a username, or
+	// "platform:username" for one platform.
+	Users []string `toml:"users"`
+	// Command runs instead of the desktop's notifier, with the title and
+	// body appended, e.g. ["notify-send", "-u", "critical"].
+	Command []string `toml:"command"`
+	// Cooldown is the least time between notifications, e.g. "5s".
+	Cooldown time.Duration `toml:"cooldown"`
+}
+
+type DemoConfig struct {
+	// Seed selects the generated sequence; the same seed repeats it.
+	Seed uint64 `toml:"seed"`
+	// Rate is the mean number of messages per second (default 2).
+	Rate float64 `toml:"rate"`
+	// Personas replace the built-in cast of chatters.
+	Personas []DemoPersonaConfig `toml:"personas"`
+}
+
+// DemoPersonaConfig is one [[demo.personas]] entry.
+type DemoPersonaConfig struct {
+	Name string `toml:"name"`
+	// Platform is a platform key or label, e.g. "twitch" or "YT_".
+	Platform string `toml:"platform"`
+	Role     string `toml:"role"`
+	// Lines are what the persona says; empty uses a shared pool.
+	Lines []string `toml:"lines"`
+}
+
+// BridgeRouteConfig sends chat from one source to a hackr.tv channel.
+type BridgeRouteConfig struct {
+	// From is a platform key or label, e.g. "twitch", or
+	// "platform#channel" for one Twitch channel or YouTube video.
+	From string `toml:"from"`
+	// To is the hackr.tv channel slug. Defaults to the first hackr.tv
+	// channel.
+	To string `toml:"to"`
+}
+
+// BridgeFiltersConfig skips chat before it is bridged. Users are a
+// username, or "platform:username" for one platform.
+type BridgeFiltersConfig struct {
+	// DenyUsers are never bridged, e.g. ["nightbot"].
+	DenyUsers []string `toml:"deny_users"`
+	// AllowUsers are exempt from the content filters.
+	AllowUsers []string `toml:"allow_users"`
+	// DenyWords skips chat containing these words or phrases.
+	DenyWords []string `toml:"deny_words"`
+	// DenyPatterns skips chat matching these regular expressions.
+	DenyPatterns []string `toml:"deny_patterns"`
+	// MinLength skips chat shorter than this many characters.
+	MinLength int `toml:"min_length"`
+	// SkipCommands skips chat starting with "!".
+	SkipCommands bool `toml:"skip_commands"`
+	// MinAccountAge skips chat from accounts younger than this, e.g.
+	// "168h". It needs [enrich] to know an account's age.
+	MinAccountAge time.Duration `toml:"min_account_age"`
+}
+
+// RetentionConfig bounds the files the relay writes. A running relay
+// prunes them at start and every Interval; "relay prune" does it once.
+type RetentionConfig struct {
+	// Interval is how often a running relay prunes. Defaults to 1h.
+	Interval time.Duration `toml:"interval"`
+	// Highlights bounds the /clip highlights file, by clip.
+	Highlights RetentionPolicy `toml:"highlights"`
+	// Spill bounds the bridge spill file, by message.
+	Spill RetentionPolicy `toml:"spill"`
+}
+
+// RetentionPolicy drops a file's oldest entries. The zero value keeps
+// everything.
+type RetentionPolicy struct {
+	// MaxAge drops entries older than this, e.g. "720h".
+	MaxAge time.Duration `toml:"max_age"`
+	// MaxSize drops the oldest entries until the file fits, e.g. "10MB".
+	MaxSize string `toml:"max_size"`
+}
+
+type HighlightsConfig struct {
+	// File is where /clip appends snapshots. Defaults to "highlights.txt".
+	File string `toml:"file"`
+	// Window is how much recent chat is kept for /clip, e.g. "5m".
+	// Defaults to 5m.
+	Window time.Duration `toml:"window"`
+	// TwitchClip also creates a Twitch clip when EventSub credentials are
+	// set. The token needs the clips:edit scope.
+	TwitchClip bool `toml:"twitch_clip"`
+}
+
+type TwitchConfig struct {
+	Channel  string   `toml:"channel"`
+	Channels []string `toml:"channels"`
+	// Server overrides the IRC address ("host:port"); defaults to Twitch.
+	Server string `toml:"server"`
+	// Plaintext falls back to unencrypted IRC on port 6667 instead of TLS.
+	Plaintext bool `toml:"plaintext"`
+	// Capabilities overrides the IRCv3 capabilities requested on connect.
+	// Unset requests tags and commands; an empty list skips CAP REQ.
+	Capabilities []string `toml:"capabilities"`
+	// Nick and Token authenticate the IRC connection so the relay can
+	// send messages. Leave empty for anonymous read-only access.
+	Nick  string `toml:"nick"`
+	Token string `toml:"token"`
+	// EventSub enables follow/raid/redemption events when ClientID is set.
+	EventSub EventSubConfig `toml:"eventsub"`
+}
+
+type EventSubConfig struct {
+	ClientID string `toml:"client_id"`
+	// Token is a user access token with moderator:read:followers and
+	// channel:read:redemptions scopes. Defaults to the IRC token.
+	Token string `toml:"token"`
+	// Broadcaster is the channel login to watch. Defaults to the first
+	// Twitch channel.
+	Broadcaster string `toml:"broadcaster"`
+}
+
+// AllChannels returns the union of Channel and Channels, lowercased and
+// de-duplicated, in the order they were declared.
+func (t TwitchConfig) AllChannels() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, ch := range append([]string{t.Channel}, t.Channels...) {
+		ch = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ch), "#"))
+		if ch == "" || seen[ch] {
+			continue
+		}
+		seen[ch] = true
+		out = append(out, ch)
+	}
+	return out
 }
 
 type YouTubeConfig struct {
 	VideoID string `toml:"video_id"`
-	APIKey  string `toml:"api_key"`
+	// VideoIDs adds live streams watched at the same time, e.g. a
+	// simulcast on two channels.
+	VideoIDs []string `toml:"video_ids"`
+	APIKey   string   `toml:"api_key"`
+	// APIKeys adds keys to the rotation pool alongside APIKey.
+	APIKeys []string `toml:"api_keys"`
+	// BaseURL overrides the YouTube Data API base URL (regional endpoint,
+	// proxy, or mock server).
+	BaseURL string `toml:"base_url"`
+	// ChannelID or Handle (e.g. "@hackrtv") follows a channel's live
+	// streams when VideoID is empty.
+	ChannelID string `toml:"channel_id"`
+	Handle    string `toml:"handle"`
+	// DiscoverInterval is how often the followed channel is checked for a
+	// new live stream (default 1m).
+	DiscoverInterval time.Duration `toml:"discover_interval"`
+	// MinPollInterval and MaxPollInterval bound the wait between chat
+	// polls, which follows the API's hint, e.g. a "10s" floor to save
+	// quota on all-day streams. Zero leaves that side unbounded.
+	MinPollInterval time.Duration `toml:"min_poll_interval"`
+	MaxPollInterval time.Duration `toml:"max_poll_interval"`
+	// Transport is "api" (the Data API, needs a key) or "innertube"
+	// (key-less, video ID only). Defaults to api when a key is set.
+	Transport string `toml:"transport"`
+	// OAuth credentials let the bridge post hackr.tv chat into the
+	// YouTube live chat.
+	OAuth YouTubeOAuthConfig `toml:"oauth"`
+}
+
+// YouTubeOAuthConfig holds a Google OAuth client for the device flow.
+type YouTubeOAuthConfig struct {
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	// TokenFile keeps the refresh token between runs (default
+	// "youtube-token.json").
+	TokenFile string `toml:"token_file"`
+}
+
+// Enabled reports whether a video or channel to read is configured.
+func (y YouTubeConfig) Enabled() bool {
+	return len(y.AllVideoIDs()) > 0 || y.ChannelID != "" || y.Handle != ""
+}
+
+// AllVideoIDs returns VideoID followed by VideoIDs, de-duplicated, in the
+// order they were declared. Entries may be comma-separated lists, as from
+// a flag.
+func (y YouTubeConfig) AllVideoIDs() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, entry := range append([]string{y.VideoID}, y.VideoIDs...) {
+		for _, id := range strings.Split(entry, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// AllAPIKeys returns APIKey followed by APIKeys, de-duplicated. Entries
+// may themselves be comma-separated lists, as from a flag or env var.
+func (y YouTubeConfig) AllAPIKeys() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, entry := range append([]string{y.APIKey}, y.APIKeys...) {
+		for _, key := range strings.Split(entry, ",") {
+			key = strings.TrimSpace(key)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return out
 }
 
 type HackrTVConfig struct {
-	URL     string `toml:"url"`
+	URL      string   `toml:"url"`
+	Channel  string   `toml:"channel"`
+	Channels []string `toml:"channels"`
+	Token    string   `toml:"token"`
+	Alias    string   `toml:"alias"`
+	// AuthMode selects how bridged messages are posted: "admin" uses the
+	// Admin Uplink API, "user" posts as a regular hackr over the cable.
+	AuthMode string `toml:"auth_mode"`
+	// StaleTimeout is how long to wait for an ActionCable ping before
+	// reconnecting, e.g. "10s". Defaults to 10s when unset.
+	StaleTimeout time.Duration `toml:"stale_timeout"`
+	// HeaderAuth sends the token in an Authorization header instead of
+	// the URL query, falling back to the query for older servers.
+	HeaderAuth bool `toml:"header_auth"`
+	// History is how much of the recent-message backlog sent on connect
+	// is shown: "all" (default), "none", or "last_N" for the newest N.
+	History string `toml:"history"`
+	// SkipHistory is the same as History = "none".
+	SkipHistory bool `toml:"skip_history"`
+	// ConfirmTimeout is how long to wait for each subscription to be
+	// confirmed before retrying once and then failing. Defaults to 5s.
+	ConfirmTimeout time.Duration `toml:"confirm_timeout"`
+	// ChannelClass is the ActionCable channel class subscribed for each
+	// chat channel. Defaults to "LiveChatChannel".
+	ChannelClass string `toml:"channel_class"`
+	// Subscriptions are extra ActionCable channels to subscribe to
+	// alongside chat; their broadcasts appear as system events.
+	Subscriptions []SubscriptionConfig `toml:"subscriptions"`
+}
+
+type SubscriptionConfig struct {
+	// Channel is the ActionCable channel class, e.g. "NotificationsChannel".
 	Channel string `toml:"channel"`
-	Token   string `toml:"token"`
-	Alias   string `toml:"alias"`
+	// Params are extra identifier fields sent with the subscription.
+	Params map[string]any `toml:"params"`
+}
+
+// AllChannels returns the union of Channel and Channels, de-duplicated,
+// in the order they were declared. The first is the primary channel the
+// bridge posts to.
+func (h HackrTVConfig) AllChannels() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, ch := range append([]string{h.Channel}, h.Channels...) {
+		ch = strings.TrimSpace(ch)
+		if ch == "" || seen[ch] {
+			continue
+		}
+		seen[ch] = true
+		out = append(out, ch)
+	}
+	return out
 }
 
 // Load reads and decodes a TOML config file from the given path.
@@ -48,10 +647,31 @@ func Load(path string) (Config, error) {
 
 // ApplyDefaults sets default values for fields that have them.
 func (c *Config) ApplyDefaults() {
-	if c.HackrTV.Channel == "" {
+	if c.HackrTV.Channel == "" && len(c.HackrTV.Channels) == 0 {
 		c.HackrTV.Channel = "live"
 	}
 	if c.HackrTV.Alias == "" {
 		c.HackrTV.Alias = "relay"
 	}
+	if c.HackrTV.AuthMode == "" {
+		c.HackrTV.AuthMode = "admin"
+	}
+	if c.Highlights.File == "" {
+		c.Highlights.File = "highlights.txt"
+	}
+	if c.Retention.Interval <= 0 {
+		c.Retention.Interval = time.Hour
+	}
+	if c.Highlights.Window <= 0 {
+		c.Highlights.Window = 5 * time.Minute
+	}
+	if c.YouTube.OAuth.TokenFile == "" {
+		c.YouTube.OAuth.TokenFile = "youtube-token.json"
+	}
+	if len(c.Supporters.Badges) == 0 {
+		c.Supporters.Badges = []string{"subscriber", "founder", "vip", "member"}
+	}
+	if c.BridgeOrder == "" {
+		c.BridgeOrder = "best_effort"
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -12,16 +13,24 @@ bridge = true
 
 [twitch]
 channel = "xqc"
+plaintext = true
 
 [youtube]
 video_id = "dQw4w9WgXcQ"
 api_key = "test-api-key"
+base_url = "https://youtube.example.com/v3"
+
+[youtube.oauth]
+client_id = "client.apps.googleusercontent.com"
+client_secret = "secret"
 
 [hackrtv]
 url = "wss://hackr.tv/cable"
 channel = "live"
 token = "test-token"
 alias = "XERAEN"
+stale_timeout = "15s"
+confirm_timeout = "3s"
 `
 	path := writeTempConfig(t, content)
 
@@ -36,12 +45,21 @@ alias = "XERAEN"
 	if cfg.Twitch.Channel != "xqc" {
 		t.Errorf("Twitch.Channel = %q, want %q", cfg.Twitch.Channel, "xqc")
 	}
+	if !cfg.Twitch.Plaintext {
+		t.Error("expected Twitch.Plaintext to be true")
+	}
 	if cfg.YouTube.VideoID != "dQw4w9WgXcQ" {
 		t.Errorf("YouTube.VideoID = %q, want %q", cfg.YouTube.VideoID, "dQw4w9WgXcQ")
 	}
 	if cfg.YouTube.APIKey != "test-api-key" {
 		t.Errorf("YouTube.APIKey = %q, want %q", cfg.YouTube.APIKey, "test-api-key")
 	}
+	if cfg.YouTube.BaseURL != "https://youtube.example.com/v3" {
+		t.Errorf("YouTube.BaseURL = %q", cfg.YouTube.BaseURL)
+	}
+	if cfg.YouTube.OAuth.ClientID != "client.apps.googleusercontent.com" || cfg.YouTube.OAuth.ClientSecret != "secret" {
+		t.Errorf("YouTube.OAuth = %+v", cfg.YouTube.OAuth)
+	}
 	if cfg.HackrTV.URL != "wss://hackr.tv/cable" {
 		t.Errorf("HackrTV.URL = %q, want %q", cfg.HackrTV.URL, "wss://hackr.tv/cable")
 	}
@@ -54,6 +72,12 @@ alias = "XERAEN"
 	if cfg.HackrTV.Alias != "XERAEN" {
 		t.Errorf("HackrTV.Alias = %q, want %q", cfg.HackrTV.Alias, "XERAEN")
 	}
+	if cfg.HackrTV.StaleTimeout != 15*time.Second {
+		t.Errorf("HackrTV.StaleTimeout = %v, want 15s", cfg.HackrTV.StaleTimeout)
+	}
+	if cfg.HackrTV.ConfirmTimeout != 3*time.Second {
+		t.Errorf("HackrTV.ConfirmTimeout = %v, want 3s", cfg.HackrTV.ConfirmTimeout)
+	}
 }
 
 func TestLoadPartial(t *testing.T) {
@@ -82,6 +106,218 @@ channel = "shroud"
 	}
 }
 
+func TestTwitchAllChannels(t *testing.T) {
+	content := `
+[twitch]
+channel = "xQc"
+channels = ["shroud", "#XQC", "hackrTV", ""]
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	got := cfg.Twitch.AllChannels()
+	want := []string{"xqc", "shroud", "hackrtv"}
+	if len(got) != len(want) {
+		t.Fatalf("AllChannels() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AllChannels()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHackrTVAllChannels(t *testing.T) {
+	content := `
+[hackrtv]
+channels = ["live", " dev ", "live", ""]
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	cfg.ApplyDefaults()
+
+	got := cfg.HackrTV.AllChannels()
+	want := []string{"live", "dev"}
+	if len(got) != len(want) {
+		t.Fatalf("AllChannels() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AllChannels()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestYouTubeAllAPIKeys(t *testing.T) {
+	y := YouTubeConfig{
+		APIKey:  "key-a,key-b",
+		APIKeys: []string{"key-c", "key-a", " "},
+	}
+
+	got := y.AllAPIKeys()
+	want := []string{"key-a", "key-b", "key-c"}
+	if len(got) != len(want) {
+		t.Fatalf("AllAPIKeys() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AllAPIKeys()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestYouTubeAllVideoIDs(t *testing.T) {
+	y := YouTubeConfig{
+		VideoID:  "vid-a, vid-b",
+		VideoIDs: []string{"vid-c", "vid-a"},
+	}
+
+	got := y.AllVideoIDs()
+	want := []string{"vid-a", "vid-b", "vid-c"}
+	if len(got) != len(want) {
+		t.Fatalf("AllVideoIDs() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AllVideoIDs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if !y.Enabled() || (YouTubeConfig{VideoID: " "}).Enabled() {
+		t.Error("Enabled() should follow AllVideoIDs")
+	}
+}
+
+func TestLoadEventSub(t *testing.T) {
+	content := `
+[twitch]
+channel = "hackrtv"
+
+[twitch.eventsub]
+client_id = "cid"
+token = "tok"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	if cfg.Twitch.EventSub.ClientID != "cid" {
+		t.Errorf("EventSub.ClientID = %q, want %q", cfg.Twitch.EventSub.ClientID, "cid")
+	}
+	if cfg.Twitch.EventSub.Token != "tok" {
+		t.Errorf("EventSub.Token = %q, want %q", cfg.Twitch.EventSub.Token, "tok")
+	}
+}
+
+func TestLoadSubscriptions(t *testing.T) {
+	content := `
+[[hackrtv.subscriptions]]
+channel = "NotificationsChannel"
+params = { hackr_id = 7 }
+
+[[hackrtv.subscriptions]]
+channel = "EventsChannel"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	subs := cfg.HackrTV.Subscriptions
+	if len(subs) != 2 {
+		t.Fatalf("Subscriptions = %+v, want 2", subs)
+	}
+	if subs[0].Channel != "NotificationsChannel" || subs[0].Params["hackr_id"] != int64(7) {
+		t.Errorf("Subscriptions[0] = %+v", subs[0])
+	}
+	if subs[1].Channel != "EventsChannel" || len(subs[1].Params) != 0 {
+		t.Errorf("Subscriptions[1] = %+v", subs[1])
+	}
+}
+
+func TestLoadDemo(t *testing.T) {
+	content := `
+[demo]
+seed = 42
+rate = 5.5
+
+[[demo.personas]]
+name = "xeraen"
+platform = "hackrtv"
+role = "admin"
+lines = ["welcome", "new track soon"]
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Demo.Seed != 42 || cfg.Demo.Rate != 5.5 {
+		t.Errorf("Demo = %+v", cfg.Demo)
+	}
+	if len(cfg.Demo.Personas) != 1 || cfg.Demo.Personas[0].Platform != "hackrtv" || len(cfg.Demo.Personas[0].Lines) != 2 {
+		t.Errorf("Demo.Personas = %+v", cfg.Demo.Personas)
+	}
+}
+
+func TestLoadBridgeFilters(t *testing.T) {
+	content := `
+bridge = true
+
+[bridge_filters]
+deny_users = ["nightbot"]
+deny_patterns = ['^\d+$']
+min_length = 2
+skip_commands = true
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	bf := cfg.BridgeFilters
+	if !cfg.Bridge || len(bf.DenyUsers) != 1 || bf.DenyPatterns[0] != `^\d+$` || bf.MinLength != 2 || !bf.SkipCommands {
+		t.Errorf("BridgeFilters = %+v", bf)
+	}
+}
+
+func TestLoadLabels(t *testing.T) {
+	content := `
+[labels]
+twitch = "TWI"
+
+[display.labels]
+youtube = "▶"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	if cfg.Labels["twitch"] != "TWI" {
+		t.Errorf("Labels[twitch] = %q, want %q", cfg.Labels["twitch"], "TWI")
+	}
+	if cfg.Display.Labels["youtube"] != "▶" {
+		t.Errorf("Display.Labels[youtube] = %q, want %q", cfg.Display.Labels["youtube"], "▶")
+	}
+}
+
 func TestLoadInvalidPath(t *testing.T) {
 	_, err := Load("/nonexistent/relay.toml")
 	if err == nil {
@@ -99,6 +335,18 @@ func TestApplyDefaults(t *testing.T) {
 	if cfg.HackrTV.Alias != "relay" {
 		t.Errorf("HackrTV.Alias = %q, want %q", cfg.HackrTV.Alias, "relay")
 	}
+	if cfg.HackrTV.AuthMode != "admin" {
+		t.Errorf("HackrTV.AuthMode = %q, want %q", cfg.HackrTV.AuthMode, "admin")
+	}
+	if len(cfg.Supporters.Badges) != 4 || cfg.Supporters.Badges[0] != "subscriber" {
+		t.Errorf("Supporters.Badges = %q, want the default supporter badges", cfg.Supporters.Badges)
+	}
+	if cfg.Highlights.File != "highlights.txt" || cfg.Highlights.Window != 5*time.Minute {
+		t.Errorf("Highlights = %+v, want highlights.txt and 5m", cfg.Highlights)
+	}
+	if cfg.BridgeOrder != "best_effort" {
+		t.Errorf("BridgeOrder = %q, want %q", cfg.BridgeOrder, "best_effort")
+	}
 }
 
 func TestApplyDefaultsPreservesExisting(t *testing.T) {
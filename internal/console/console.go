@@ -0,0 +1,107 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command is a console command such as "/mute ttv".
+type Command struct {
+	// Usage is shown by /help, e.g. "/mute <platform>[#channel]".
+	Usage string
+	// Help is a one-line description.
+	Help string
+	// Run executes the command and returns a status line to print.
+	Run func(args []string) (string, error)
+}
+
+// Console reads slash commands from an input stream (normally stdin)
+// and dispatches them to registered commands.
+type Console struct {
+	out      io.Writer
+	mu       sync.RWMutex
+	commands map[string]Command
+}
+
+// New creates a console that writes command output to out.
+func New(out io.Writer) *Console {
+	c := &Console{
+		out:      out,
+		commands: make(map[string]Command),
+	}
+	c.Register("help", Command{
+		Usage: "/help",
+		Help:  "list available commands",
+		Run:   c.help,
+	})
+	return c
+}
+
+// Register adds a command under name (without the leading slash).
+func (c *Console) Register(name string, cmd Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands[strings.ToLower(name)] = cmd
+}
+
+// Run reads lines from in until EOF, executing each "/command args...".
+// Lines that don't start with "/" are ignored.
+func (c *Console) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if out := c.Exec(scanner.Text()); out != "" {
+			fmt.Fprintln(c.out, out)
+		}
+	}
+}
+
+// Exec runs a single command line and returns its output or error text.
+func (c *Console) Exec(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return ""
+	}
+
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return ""
+	}
+
+	c.mu.RLock()
+	cmd, ok := c.commands[strings.ToLower(fields[0])]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Sprintf("unknown command /%s (try /help)", fields[0])
+	}
+
+	out, err := cmd.Run(fields[1:])
+	if err != nil {
+		return fmt.Sprintf("/%s: %v (usage: %s)", fields[0], err, cmd.Usage)
+	}
+	return out
+}
+
+func (c *Console) help(args []string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.commands))
+	for name := range c.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		cmd := c.commands[name]
+		fmt.Fprintf(&b, "  %-32s %s", cmd.Usage, cmd.Help)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,71 @@
+package console
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	c := New(&bytes.Buffer{})
+
+	var gotArgs []string
+	c.Register("echo", Command{
+		Usage: "/echo <text>",
+		Help:  "repeat text",
+		Run: func(args []string) (string, error) {
+			gotArgs = args
+			return strings.Join(args, " "), nil
+		},
+	})
+	c.Register("fail", Command{
+		Usage: "/fail",
+		Run: func(args []string) (string, error) {
+			return "", errors.New("boom")
+		},
+	})
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"/echo hello world", "hello world"},
+		{"  /ECHO  spaced  ", "spaced"},
+		{"not a command", ""},
+		{"/", ""},
+		{"/nope", "unknown command /nope (try /help)"},
+		{"/fail", "/fail: boom (usage: /fail)"},
+	}
+
+	for _, tt := range tests {
+		if got := c.Exec(tt.line); got != tt.want {
+			t.Errorf("Exec(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	c.Exec("/echo a b")
+	if len(gotArgs) != 2 || gotArgs[0] != "a" || gotArgs[1] != "b" {
+		t.Errorf("args = %q, want [a b]", gotArgs)
+	}
+}
+
+func TestRunAndHelp(t *testing.T) {
+	var out bytes.Buffer
+	c := New(&out)
+	c.Register("ping", Command{
+		Usage: "/ping",
+		Help:  "reply with pong",
+		Run:   func(args []string) (string, error) { return "pong", nil },
+	})
+
+	c.Run(strings.NewReader("/ping\nchat line\n/help\n"))
+
+	got := out.String()
+	if !strings.HasPrefix(got, "pong\n") {
+		t.Errorf("expected pong first, got %q", got)
+	}
+	if !strings.Contains(got, "/ping") || !strings.Contains(got, "reply with pong") {
+		t.Errorf("help output missing ping command: %q", got)
+	}
+}
@@ -0,0 +1,174 @@
+// Package currency converts cheer and Super Chat amounts into one base
+// currency, so stats and leaderboards can add up support that arrives in
+// bits, dollars, euros, and yen. Exchange rates are fetched once a day.
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+const (
+	// DefaultBase is the currency amounts are normalized to by default.
+	DefaultBase = "USD"
+	// DefaultRatesURL serves daily rates as JSON at <url>/<base>.
+	DefaultRatesURL = "https://open.er-api.com/v6/latest"
+
+	// refreshInterval is how long fetched rates are used.
+	refreshInterval = 24 * time.Hour
+	// retryInterval is the wait after a failed fetch.
+	retryInterval = 10 * time.Minute
+
+	// bitValueUSD is what a Twitch bit is worth to the streamer.
+	bitValueUSD = 0.01
+)
+
+// Options configures the converter. Zero values use the defaults.
+type Options struct {
+	// Base is the ISO 4217 code amounts are converted to. Defaults to USD.
+	Base string
+	// RatesURL is fetched as <RatesURL>/<Base> and must answer in the
+	// open.er-api.com format. Defaults to DefaultRatesURL.
+	RatesURL string
+	// Clock schedules the daily refresh. Defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Converter annotates monetised messages with their value in the base
+// currency.
+type Converter struct {
+	base     string
+	ratesURL string
+	http     *http.Client
+	clock    clock.Clock
+
+	mu    sync.RWMutex
+	rates map[string]float64 // units of each currency per base unit
+}
+
+// New creates a converter. It has no rates until Refresh or Run has
+// fetched them; until then only amounts already in the base currency are
+// normalized.
+func New(opts Options) *Converter {
+	c := &Converter{
+		base:     strings.ToUpper(strings.TrimSpace(opts.Base)),
+		ratesURL: strings.TrimRight(opts.RatesURL, "/"),
+		http:     &http.Client{Timeout: 10 * time.Second},
+		clock:    clock.Or(opts.Clock),
+	}
+	if c.base == "" {
+		c.base = DefaultBase
+	}
+	if c.ratesURL == "" {
+		c.ratesURL = DefaultRatesURL
+	}
+	return c
+}
+
+// Base returns the currency amounts are converted to.
+func (c *Converter) Base() string {
+	return c.base
+}
+
+// ratesResponse is the open.er-api.com latest-rates payload.
+type ratesResponse struct {
+	Result    string             `json:"result"`
+	ErrorType string             `json:"error-type"`
+	BaseCode  string             `json:"base_code"`
+	Rates     map[string]float64 `json:"rates"`
+}
+
+// Refresh fetches the current exchange rates.
+func (c *Converter) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.ratesURL+"/"+c.base, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("currency: unexpected status %d", resp.StatusCode)
+	}
+	var body ratesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("currency: decoding rates: %w", err)
+	}
+	if body.Result != "success" {
+		return fmt.Errorf("currency: rates lookup failed: %s", body.ErrorType)
+	}
+	if !strings.EqualFold(body.BaseCode, c.base) {
+		return fmt.Errorf("currency: rates are based on %s, want %s", body.BaseCode, c.base)
+	}
+
+	c.mu.Lock()
+	c.rates = body.Rates
+	c.mu.Unlock()
+	return nil
+}
+
+// Run fetches rates now and again every day until ctx is cancelled. A
+// failed fetch is retried after ten minutes, keeping the previous rates.
+func (c *Converter) Run(ctx context.Context) {
+	for {
+		wait := refreshInterval
+		if err := c.Refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Exchange rate error: %v\n", err)
+			wait = retryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(wait):
+		}
+	}
+}
+
+// Convert returns a in the base currency. It reports false for messages
+// without an amount and for currencies with no known rate.
+func (c *Converter) Convert(a message.Amount) (message.Amount, bool) {
+	if a.IsZero() {
+		return message.Amount{}, false
+	}
+	value, currency := a.Value, strings.ToUpper(a.Currency)
+	if currency == "BITS" {
+		value, currency = value*bitValueUSD, "USD"
+	}
+
+	if currency != c.base {
+		c.mu.RLock()
+		rate := c.rates[currency]
+		c.mu.RUnlock()
+		if rate <= 0 {
+			return message.Amount{}, false
+		}
+		value /= rate
+	}
+	value = math.Round(value*100) / 100
+	return message.Amount{Value: value, Currency: c.base, Display: i18n.Money(value, c.base)}, true
+}
+
+// Normalize sets msg.Normalized when its amount can be converted.
+func (c *Converter) Normalize(msg message.Message) message.Message {
+	if n, ok := c.Convert(msg.Amount); ok {
+		msg.Normalized = n
+	}
+	return msg
+}
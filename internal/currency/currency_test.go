@@ -0,0 +1,115 @@
+package currency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+// ratesServer serves EUR-based rates and counts the fetches.
+func ratesServer(t *testing.T, fetches *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest/EUR" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		fetches.Add(1)
+		w.Write([]byte(`{"result":"success","base_code":"EUR","rates":{"EUR":1,"USD":1.25,"JPY":160}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConvert(t *testing.T) {
+	var fetches atomic.Int32
+	server := ratesServer(t, &fetches)
+	c := New(Options{Base: "eur", RatesURL: server.URL + "/latest/"})
+
+	// Only the base currency converts before rates are known
+	if _, ok := c.Convert(message.Amount{Value: 5, Currency: "USD"}); ok {
+		t.Error("Convert() before Refresh should fail for USD")
+	}
+	if n, ok := c.Convert(message.Amount{Value: 5, Currency: "EUR"}); !ok || n.Value != 5 {
+		t.Errorf("Convert(EUR) = %+v, %v", n, ok)
+	}
+
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+	tests := []struct {
+		a    message.Amount
+		want float64
+		ok   bool
+	}{
+		{message.Amount{Value: 5, Currency: "USD"}, 4, true},
+		{message.Amount{Value: 1000, Currency: "JPY"}, 6.25, true},
+		{message.Amount{Value: 500, Currency: "BITS"}, 4, true},
+		{message.Amount{Value: 5, Currency: "XTS"}, 0, false},
+		{message.Amount{}, 0, false},
+	}
+	for _, tt := range tests {
+		n, ok := c.Convert(tt.a)
+		if ok != tt.ok || n.Value != tt.want {
+			t.Errorf("Convert(%+v) = %+v, %v; want %v, %v", tt.a, n, ok, tt.want, tt.ok)
+		}
+		if ok && (n.Currency != "EUR" || n.Display == "") {
+			t.Errorf("Convert(%+v) = %+v, want a displayable EUR amount", tt.a, n)
+		}
+	}
+
+	msg := c.Normalize(message.Message{Amount: message.Amount{Value: 5, Currency: "USD", Display: "$5.00"}})
+	if msg.Normalized.Value != 4 || msg.Amount.Display != "$5.00" {
+		t.Errorf("Normalize() = %+v", msg)
+	}
+}
+
+func TestRunRefreshesDaily(t *testing.T) {
+	var fetches atomic.Int32
+	server := ratesServer(t, &fetches)
+	fake := clock.NewFake(time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC))
+	c := New(Options{Base: "EUR", RatesURL: server.URL + "/latest", Clock: fake})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("fetches after start = %d, want 1", n)
+	}
+	// Rates are reused within the day
+	fake.Advance(23 * time.Hour)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetches within a day = %d, want 1", n)
+	}
+	fake.Advance(time.Hour)
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestRefreshFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":"error","error-type":"unsupported-code"}`))
+	}))
+	defer server.Close()
+
+	c := New(Options{Base: "XTS", RatesURL: server.URL})
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Error("Refresh() should fail for an error result")
+	}
+}
@@ -0,0 +1,280 @@
+// Package dashboard serves a small web page for moderators who don't use
+// terminals: the merged chat as it arrives, each source's status, message
+// rates over the last hour, and, when enabled, the display's mute and solo
+// settings.
+package dashboard
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+//go:embed dashboard.html
+var page []byte
+
+const (
+	defaultHistory = 200
+	// rateBucket and rateBuckets size the rate graph: an hour by minute.
+	rateBucket  = time.Minute
+	rateBuckets = 60
+	// subscriberBuffer is how many messages a page may fall behind
+	// before it misses some.
+	subscriberBuffer = 64
+)
+
+// Options configures a Dashboard. The zero value is a read-only page.
+type Options struct {
+	// History is how many recent messages a newly opened page starts
+	// with (default 200).
+	History int
+	// Filter, when set, leaves out of the feed what the terminal display
+	// hides.
+	Filter *display.Filter
+	// Controls shows mute and solo buttons, which post to /api/display.
+	// Without it the page only reads.
+	Controls bool
+	// Clock defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Dashboard keeps what the page shows. It is safe for concurrent use.
+type Dashboard struct {
+	opts    Options
+	clock   clock.Clock
+	started time.Time
+
+	mu      sync.Mutex
+	recent  [][]byte // encoded messages, oldest first
+	subs    map[chan []byte]struct{}
+	sources map[message.Platform]*source
+	rates   []rate // oldest first
+}
+
+// source is one platform's status.
+type source struct {
+	messages   int64
+	last       time.Time
+	reconnects func() int64
+}
+
+// rate counts messages per platform key in one rateBucket.
+type rate struct {
+	start  time.Time
+	counts map[string]int
+}
+
+// New creates an empty Dashboard.
+func New(opts Options) *Dashboard {
+	if opts.History <= 0 {
+		opts.History = defaultHistory
+	}
+	c := clock.Or(opts.Clock)
+	return &Dashboard{
+		opts:    opts,
+		clock:   c,
+		started: c.Now(),
+		subs:    make(map[chan []byte]struct{}),
+		sources: make(map[message.Platform]*source),
+	}
+}
+
+// Track lists a source on the page before its first message, with its
+// reconnect count when reconnects is non-nil.
+func (d *Dashboard) Track(p message.Platform, reconnects func() int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.source(p)
+	if reconnects != nil {
+		prev := s.reconnects
+		s.reconnects = func() int64 {
+			n := reconnects()
+			if prev != nil {
+				n += prev()
+			}
+			return n
+		}
+	}
+}
+
+// source returns p's status, creating it. d.mu must be held.
+func (d *Dashboard) source(p message.Platform) *source {
+	s, ok := d.sources[p]
+	if !ok {
+		s = &source{}
+		d.sources[p] = s
+	}
+	return s
+}
+
+// Add counts msg and sends it to open pages unless the display filter
+// hides it. Pages too far behind miss it rather than hold up the relay.
+func (d *Dashboard) Add(msg message.Message) {
+	now := d.clock.Now()
+	data, err := display.MarshalJSON(msg)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.source(msg.Platform)
+	s.messages++
+	s.last = now
+	d.current(now).counts[msg.Platform.Key()]++
+
+	if d.opts.Filter != nil && !d.opts.Filter.Allows(msg) {
+		return
+	}
+	if len(d.recent) >= d.opts.History {
+		d.recent = d.recent[1:]
+	}
+	d.recent = append(d.recent, data)
+	for ch := range d.subs {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// current returns the rate bucket for now, dropping buckets older than
+// the graph. d.mu must be held.
+func (d *Dashboard) current(now time.Time) *rate {
+	start := now.Truncate(rateBucket)
+	if n := len(d.rates); n > 0 && d.rates[n-1].start.Equal(start) {
+		return &d.rates[n-1]
+	}
+	cutoff := start.Add(-rateBuckets * rateBucket)
+	i := 0
+	for i < len(d.rates) && !d.rates[i].start.After(cutoff) {
+		i++
+	}
+	d.rates = append(d.rates[i:], rate{start: start, counts: make(map[string]int)})
+	return &d.rates[len(d.rates)-1]
+}
+
+// Handler serves the page at /dashboard, its chat feed as server-sent
+// events at /dashboard/events, and its status at /dashboard/stats.
+func (d *Dashboard) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.URL.Path {
+		case "/dashboard", "/dashboard/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+		case "/dashboard/events":
+			d.serveEvents(w, r)
+		case "/dashboard/stats":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(d.Stats())
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// serveEvents streams recent and then live messages until the page
+// closes.
+func (d *Dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan []byte, subscriberBuffer)
+	d.mu.Lock()
+	backlog := append([][]byte(nil), d.recent...)
+	d.subs[ch] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.subs, ch)
+		d.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, data := range backlog {
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+// Stats is the page's status panel and rate graph.
+type Stats struct {
+	Uptime   string        `json:"uptime"`
+	Controls bool          `json:"controls"`
+	Sources  []SourceStats `json:"sources"`
+	// Rates holds one entry per minute of the last hour with messages,
+	// oldest first.
+	Rates []RateStats `json:"rates"`
+}
+
+// SourceStats is one platform's status.
+type SourceStats struct {
+	Platform string `json:"platform"`
+	Label    string `json:"label"`
+	// Color is the platform's terminal color hint, e.g. "magenta".
+	Color      string    `json:"color,omitempty"`
+	Messages   int64     `json:"messages"`
+	Last       time.Time `json:"last,omitzero"`
+	Reconnects int64     `json:"reconnects"`
+}
+
+// RateStats counts one minute's messages by platform key.
+type RateStats struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Stats reports the sources in platform order and the last hour's rates.
+func (d *Dashboard) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	st := Stats{
+		Uptime:   now.Sub(d.started).Round(time.Second).String(),
+		Controls: d.opts.Controls,
+		Sources:  []SourceStats{},
+		Rates:    []RateStats{},
+	}
+	for _, p := range message.Platforms() {
+		s, ok := d.sources[p]
+		if !ok {
+			continue
+		}
+		ss := SourceStats{Platform: p.Key(), Label: p.String(), Color: p.Color(), Messages: s.messages, Last: s.last}
+		if s.reconnects != nil {
+			ss.Reconnects = s.reconnects()
+		}
+		st.Sources = append(st.Sources, ss)
+	}
+	cutoff := now.Truncate(rateBucket).Add(-rateBuckets * rateBucket)
+	for _, r := range d.rates {
+		if r.start.After(cutoff) {
+			st.Rates = append(st.Rates, RateStats{Start: r.start, Counts: maps.Clone(r.counts)})
+		}
+	}
+	return st
+}
@@ -0,0 +1,119 @@
+package dashboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+func TestStats(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 1, 15, 14, 0, 30, 0, time.UTC))
+	d := New(Options{Clock: clk, Controls: true})
+	d.Track(message.YouTube, func() int64 { return 2 })
+	d.Add(message.Message{Platform: message.Twitch, Content: "hi"})
+	d.Add(message.Message{Platform: message.Twitch, Content: "hello"})
+	clk.Advance(time.Minute)
+	d.Add(message.Message{Platform: message.Twitch, Content: "still here"})
+
+	st := d.Stats()
+	if st.Uptime != "1m0s" || !st.Controls {
+		t.Errorf("uptime %q, controls %v", st.Uptime, st.Controls)
+	}
+	if len(st.Sources) != 2 {
+		t.Fatalf("sources = %+v, want Twitch and YouTube", st.Sources)
+	}
+	ttv, yt := st.Sources[0], st.Sources[1]
+	if ttv.Label != "TTV" || ttv.Messages != 3 || !ttv.Last.Equal(clk.Now()) {
+		t.Errorf("Twitch = %+v", ttv)
+	}
+	if yt.Label != "YT_" || yt.Messages != 0 || yt.Reconnects != 2 || !yt.Last.IsZero() {
+		t.Errorf("YouTube = %+v", yt)
+	}
+	if len(st.Rates) != 2 || st.Rates[0].Counts["twitch"] != 2 || st.Rates[1].Counts["twitch"] != 1 {
+		t.Errorf("rates = %+v", st.Rates)
+	}
+
+	// Minutes older than the graph are forgotten
+	clk.Advance(2 * time.Hour)
+	if st := d.Stats(); len(st.Rates) != 0 {
+		t.Errorf("rates after two hours = %+v", st.Rates)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	filter := display.NewFilter()
+	filter.Mute(display.Target{Platform: message.YouTube})
+	d := New(Options{History: 2, Filter: filter})
+	for _, c := range []string{"one", "two", "three"} {
+		d.Add(message.Message{Platform: message.Twitch, Username: "viewer", Content: c})
+	}
+	d.Add(message.Message{Platform: message.YouTube, Content: "muted"})
+
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/dashboard/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				var m struct{ Content string }
+				if err := json.Unmarshal([]byte(data), &m); err != nil {
+					t.Fatal(err)
+				}
+				return m.Content
+			}
+		}
+		t.Fatal("feed ended")
+		return ""
+	}
+	// The backlog is the last History messages the display shows
+	if got := next() + "," + next(); got != "two,three" {
+		t.Errorf("backlog = %s, want two,three", got)
+	}
+	d.Add(message.Message{Platform: message.Twitch, Content: "live"})
+	if got := next(); got != "live" {
+		t.Errorf("live message = %q", got)
+	}
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	h := New(Options{}).Handler()
+	for path, want := range map[string]int{
+		"/dashboard":       http.StatusOK,
+		"/dashboard/":      http.StatusOK,
+		"/dashboard/stats": http.StatusOK,
+		"/dashboard/nope":  http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dashboard/stats", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,201 @@
+// Package demo generates synthetic multi-platform chat for screenshots,
+// theme work, and overlay testing without a live stream. The same seed
+// always produces the same messages.
+package demo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+// defaultRate is the mean number of messages per second.
+const defaultRate = 2.0
+
+// eventChance is the share of messages that are subs, raids, cheers,
+// and other events rather than chat.
+const eventChance = 0.06
+
+// Persona is a synthetic chatter.
+type Persona struct {
+	Name     string
+	Platform message.Platform
+	Role     string
+	// Lines are what the persona says. Empty uses a shared pool.
+	Lines []string
+}
+
+// Options configures the generator. Zero values use the defaults.
+type Options struct {
+	// Seed selects the sequence; the same seed repeats it exactly.
+	Seed uint64
+	// Rate is the mean number of messages per second. Defaults to 2.
+	Rate float64
+	// Personas chat in the demo. Defaults to a built-in cast across
+	// Twitch, YouTube, and hackr.tv.
+	Personas []Persona
+	// Clock paces and stamps messages. Defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Generator produces a deterministic stream of synthetic chat.
+type Generator struct {
+	rng      *rand.Rand
+	rate     float64
+	personas []Persona
+	clock    clock.Clock
+	n        int
+}
+
+// New creates a generator.
+func New(opts Options) *Generator {
+	g := &Generator{
+		rng:      rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15)),
+		rate:     opts.Rate,
+		personas: opts.Personas,
+		clock:    clock.Or(opts.Clock),
+	}
+	if g.rate <= 0 {
+		g.rate = defaultRate
+	}
+	if len(g.personas) == 0 {
+		g.personas = DefaultPersonas()
+	}
+	return g
+}
+
+// Connect emits generated messages at the configured rate, with
+// randomized gaps, until ctx is cancelled. It has the same shape as the
+// platform clients' Connect.
+func (g *Generator) Connect(ctx context.Context, messages chan<- message.Message) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.clock.After(g.gap()):
+		}
+		select {
+		case messages <- g.Next():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// gap draws the wait before the next message. Gaps are exponentially
+// distributed, so chat arrives in natural-looking clumps.
+func (g *Generator) gap() time.Duration {
+	secs := g.rng.ExpFloat64() / g.rate
+	return time.Duration(math.Min(secs, 10/g.rate) * float64(time.Second))
+}
+
+// Next returns the next message in the sequence, stamped with the
+// clock's current time.
+func (g *Generator) Next() message.Message {
+	g.n++
+	p := g.personas[g.rng.IntN(len(g.personas))]
+	msg := message.Message{
+		Platform:  p.Platform,
+		ID:        "demo-" + strconv.Itoa(g.n),
+		Username:  p.Name,
+		Role:      p.Role,
+		Timestamp: g.clock.Now(),
+	}
+	if p.Platform == message.HackrTV {
+		msg.Channel = "live"
+	}
+	if g.rng.Float64() < eventChance {
+		g.event(&msg)
+		return msg
+	}
+	lines := p.Lines
+	if len(lines) == 0 {
+		lines = chatLines
+	}
+	msg.Content = lines[g.rng.IntN(len(lines))]
+	return msg
+}
+
+// event turns msg into an event that fits its platform.
+func (g *Generator) event(msg *message.Message) {
+	switch msg.Platform {
+	case message.Twitch:
+		switch g.rng.IntN(4) {
+		case 0:
+			msg.Type = message.TypeSub
+			months := g.rng.IntN(24) + 1
+			msg.Content = fmt.Sprintf("%s subscribed at Tier 1. They've subscribed for %d months!", msg.Username, months)
+		case 1:
+			msg.Type = message.TypeRaid
+			msg.Content = fmt.Sprintf("%d raiders from %s have joined!", g.rng.IntN(200)+5, msg.Username)
+		case 2:
+			msg.Type = message.TypeFollow
+			msg.Content = msg.Username + " followed"
+		default:
+			bits := (g.rng.IntN(10) + 1) * 100
+			msg.Content = fmt.Sprintf("Cheer%d %s", bits, chatLines[g.rng.IntN(len(chatLines))])
+			msg.Amount = message.Amount{Value: float64(bits), Currency: "BITS", Display: fmt.Sprintf("%d bits", bits)}
+		}
+	case message.YouTube:
+		dollars := []float64{2, 5, 10, 20, 50}[g.rng.IntN(5)]
+		msg.Content = chatLines[g.rng.IntN(len(chatLines))]
+		msg.Amount = message.Amount{Value: dollars, Currency: "USD", Display: fmt.Sprintf("$%.2f", dollars)}
+	default:
+		msg.Type = message.TypeSystem
+		msg.Content = i18n.T(i18n.PresenceOnline, i18n.T(i18n.PresenceConnected, msg.Username), g.rng.IntN(40)+3)
+	}
+}
+
+// DefaultPersonas returns the built-in cast.
+func DefaultPersonas() []Persona {
+	return []Persona{
+		{Name: "pixelwitch", Platform: message.Twitch},
+		{Name: "n00bslayer99", Platform: message.Twitch},
+		{Name: "StreamElements", Platform: message.Twitch, Role: "moderator", Lines: []string{
+			"Follow the socials! !discord !twitter",
+			"Remember to hydrate, chat",
+		}},
+		{Name: "lurker_prime", Platform: message.Twitch},
+		{Name: "Ada Lovecraft", Platform: message.YouTube},
+		{Name: "Synthwave Sam", Platform: message.YouTube},
+		{Name: "Kenji T.", Platform: message.YouTube},
+		{Name: "xeraen", Platform: message.HackrTV, Role: "admin", Lines: []string{
+			"welcome to the grid, hackrs",
+			"new track dropping after this set",
+			"the uplink is stable tonight",
+		}},
+		{Name: "n0va", Platform: message.HackrTV, Role: "operative"},
+		{Name: "glitchkat", Platform: message.HackrTV},
+	}
+}
+
+// chatLines is the shared pool of chat messages.
+var chatLines = []string{
+	"hello chat!",
+	"LUL",
+	"PogChamp PogChamp PogChamp",
+	"this track is so good",
+	"first time here, love the vibe",
+	"what synth is that?",
+	"KEKW",
+	"GG",
+	"can you play the one from last week?",
+	"the visuals tonight 🔥🔥",
+	"back from lunch, what did I miss",
+	"bass is hitting different",
+	"W stream",
+	"is this live or a rerun?",
+	"hi from Brazil 🇧🇷",
+	"catJAM",
+	"that transition was clean",
+	"chat is moving fast today",
+	"check out https://hackr.tv for the full set",
+	"o7",
+}
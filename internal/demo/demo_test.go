@@ -0,0 +1,86 @@
+package demo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+var start = time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+
+func generate(seed uint64, n int) []message.Message {
+	g := New(Options{Seed: seed, Clock: clock.NewFake(start)})
+	var out []message.Message
+	for range n {
+		out = append(out, g.Next())
+	}
+	return out
+}
+
+func TestSeedIsDeterministic(t *testing.T) {
+	a, b := generate(42, 200), generate(42, 200)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("the same seed produced different messages")
+	}
+	if reflect.DeepEqual(a, generate(43, 200)) {
+		t.Error("different seeds produced the same messages")
+	}
+
+	platforms := make(map[message.Platform]bool)
+	events := 0
+	for _, msg := range a {
+		platforms[msg.Platform] = true
+		if msg.IsEvent() || !msg.Amount.IsZero() {
+			events++
+		}
+		if msg.Content == "" || msg.Username == "" {
+			t.Errorf("incomplete message %+v", msg)
+		}
+	}
+	if len(platforms) != 3 {
+		t.Errorf("messages came from %d platforms, want all 3", len(platforms))
+	}
+	if events == 0 || events > 40 {
+		t.Errorf("%d of 200 messages were events, want a few", events)
+	}
+}
+
+func TestCustomPersonas(t *testing.T) {
+	g := New(Options{Personas: []Persona{{Name: "solo", Platform: message.HackrTV, Lines: []string{"only line"}}}})
+	for range 50 {
+		msg := g.Next()
+		if msg.Username != "solo" || msg.Channel != "live" {
+			t.Fatalf("Next() = %+v, want the only persona", msg)
+		}
+		if !msg.IsEvent() && msg.Content != "only line" {
+			t.Fatalf("Content = %q, want the persona's line", msg.Content)
+		}
+	}
+}
+
+func TestConnectPacesOnClock(t *testing.T) {
+	fake := clock.NewFake(start)
+	g := New(Options{Seed: 1, Rate: 1, Clock: fake})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := make(chan message.Message, 1)
+	go g.Connect(ctx, messages)
+
+	// Gaps are capped at ten times the mean, so 10s always yields one
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case msg := <-messages:
+		t.Fatalf("got %+v before the clock moved", msg)
+	default:
+	}
+	fake.Advance(10 * time.Second)
+	if msg := <-messages; !msg.Timestamp.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Timestamp = %v, want the clock's time", msg.Timestamp)
+	}
+}
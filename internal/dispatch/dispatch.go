@@ -0,0 +1,156 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"relay/internal/message"
+)
+
+const defaultBuffer = 100
+
+// Overflow policies for a sink whose queue is full.
+const (
+	// OverflowBlock holds up the dispatcher until the sink catches up.
+	OverflowBlock = "block"
+	// OverflowDrop discards the message for that sink only.
+	OverflowDrop = "drop"
+)
+
+// Options configures how one sink receives messages.
+type Options struct {
+	// Buffer is the sink's queue length. Defaults to 100.
+	Buffer int
+	// Concurrency is how many messages the sink handles at once.
+	// Defaults to 1. Values above 1 require Unordered.
+	Concurrency int
+	// Unordered allows messages to be handled out of order, which
+	// Concurrency above 1 implies.
+	Unordered bool
+	// Overflow is OverflowBlock or OverflowDrop (the default).
+	Overflow string
+}
+
+// Sink is a destination for dispatched messages.
+type Sink struct {
+	Name string
+	// Accept selects the messages the sink receives; nil accepts all.
+	Accept func(message.Message) bool
+	// Handle delivers one message. It is called from Concurrency
+	// goroutines at once.
+	Handle func(message.Message)
+	// Overflowed, if set, receives each message dropped because the
+	// queue was full, e.g. to keep it for a later retry. It is called
+	// from the dispatcher and must not block.
+	Overflowed func(message.Message)
+	Options
+}
+
+// queue is a registered sink with its running state.
+type queue struct {
+	Sink
+	ch      chan message.Message
+	dropped atomic.Int64
+}
+
+// Dispatcher fans messages out to sinks, each with its own queue and
+// workers, so a slow sink only delays itself unless it asks to block.
+type Dispatcher struct {
+	queues []*queue
+}
+
+// New creates an empty Dispatcher.
+func New() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add registers a sink. It must be called before Run.
+func (d *Dispatcher) Add(s Sink) error {
+	if s.Buffer <= 0 {
+		s.Buffer = defaultBuffer
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = 1
+	}
+	if s.Overflow == "" {
+		s.Overflow = OverflowDrop
+	}
+	if s.Overflow != OverflowBlock && s.Overflow != OverflowDrop {
+		return fmt.Errorf("sink %s: overflow must be %q or %q, got %q", s.Name, OverflowBlock, OverflowDrop, s.Overflow)
+	}
+	if s.Concurrency > 1 && !s.Unordered {
+		return fmt.Errorf("sink %s: concurrency %d requires unordered delivery", s.Name, s.Concurrency)
+	}
+	d.queues = append(d.queues, &queue{Sink: s, ch: make(chan message.Message, s.Buffer)})
+	return nil
+}
+
+// Names returns the names of the sinks, in the order they were added.
+func (d *Dispatcher) Names() []string {
+	names := make([]string, 0, len(d.queues))
+	for _, q := range d.queues {
+		names = append(names, q.Name)
+	}
+	return names
+}
+
+// Dropped returns how many messages the named sink has discarded because
+// its queue was full.
+func (d *Dispatcher) Dropped(name string) int64 {
+	for _, q := range d.queues {
+		if q.Name == name {
+			return q.dropped.Load()
+		}
+	}
+	return 0
+}
+
+// Run delivers messages from in to every accepting sink until in is
+// closed, then lets each sink drain its queue and returns. When ctx is
+// cancelled, blocked sends give up and queued messages are discarded.
+func (d *Dispatcher) Run(ctx context.Context, in <-chan message.Message) {
+	var wg sync.WaitGroup
+	for _, q := range d.queues {
+		for i := 0; i < q.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for msg := range q.ch {
+					if ctx.Err() == nil {
+						q.Handle(msg)
+					}
+				}
+			}()
+		}
+	}
+
+	for msg := range in {
+		for _, q := range d.queues {
+			if q.Accept != nil && !q.Accept(msg) {
+				continue
+			}
+			if q.Overflow == OverflowBlock {
+				select {
+				case q.ch <- msg:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			select {
+			case q.ch <- msg:
+			default:
+				q.dropped.Add(1)
+				if q.Overflowed != nil {
+					q.Overflowed(msg)
+				}
+			}
+		}
+	}
+
+	for _, q := range d.queues {
+		close(q.ch)
+	}
+	wg.Wait()
+}
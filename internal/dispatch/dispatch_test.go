@@ -0,0 +1,195 @@
+package dispatch
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/relaytest"
+)
+
+func TestSlowSinkDoesNotDelayOthers(t *testing.T) {
+	d := New()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var fastGot, overflowed []string
+	var mu sync.Mutex
+
+	if err := d.Add(Sink{
+		Name: "slow",
+		Handle: func(message.Message) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		},
+		Overflowed: func(msg message.Message) { overflowed = append(overflowed, msg.Content) },
+		Options:    Options{Buffer: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add(Sink{
+		Name: "fast",
+		Handle: func(msg message.Message) {
+			mu.Lock()
+			fastGot = append(fastGot, msg.Content)
+			mu.Unlock()
+		},
+		Options: Options{Overflow: OverflowBlock},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan message.Message)
+	done := make(chan struct{})
+	go func() {
+		d.Run(context.Background(), in)
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		select {
+		case in <- message.Message{Content: strconv.Itoa(i)}:
+		case <-time.After(time.Second):
+			t.Fatalf("dispatcher blocked on message %d behind the slow sink", i)
+		}
+		if i == 0 {
+			<-started
+		}
+	}
+	close(in)
+	// Sinks are offered each message in order, so once the fast sink has
+	// everything the slow sink's drops are settled.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := len(fastGot)
+		mu.Unlock()
+		if n == 10 || time.Now().After(deadline) {
+			break
+		}
+	}
+	close(release)
+	<-done
+
+	if len(fastGot) != 10 {
+		t.Fatalf("fast sink got %d messages, want 10", len(fastGot))
+	}
+	for i, c := range fastGot {
+		if c != strconv.Itoa(i) {
+			t.Errorf("fast sink message %d = %q, want in order", i, c)
+		}
+	}
+	// The slow sink holds one message in its handler and one queued.
+	if got := d.Dropped("slow"); got != 8 {
+		t.Errorf("slow sink dropped %d messages, want 8", got)
+	}
+	if len(overflowed) != 8 || overflowed[0] != "2" {
+		t.Errorf("Overflowed got %v, want the 8 dropped messages from 2", overflowed)
+	}
+}
+
+func TestConcurrencyAndAccept(t *testing.T) {
+	d := New()
+	var active, peak, handled atomic.Int32
+	err := d.Add(Sink{
+		Name:   "webhook",
+		Accept: func(msg message.Message) bool { return msg.Platform != message.HackrTV },
+		Handle: func(message.Message) {
+			n := active.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			active.Add(-1)
+			handled.Add(1)
+		},
+		Options: Options{Concurrency: 3, Unordered: true, Overflow: OverflowBlock},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan message.Message, 10)
+	for i := 0; i < 9; i++ {
+		in <- message.Message{Platform: message.Twitch}
+	}
+	in <- message.Message{Platform: message.HackrTV}
+	close(in)
+	d.Run(context.Background(), in)
+
+	if got := handled.Load(); got != 9 {
+		t.Errorf("handled %d messages, want 9", got)
+	}
+	if p := peak.Load(); p != 3 {
+		t.Errorf("peak concurrency = %d, want 3", p)
+	}
+}
+
+func TestAddValidates(t *testing.T) {
+	d := New()
+	if err := d.Add(Sink{Name: "x", Options: Options{Concurrency: 2}}); err == nil {
+		t.Error("ordered sink with concurrency 2 should be rejected")
+	}
+	if err := d.Add(Sink{Name: "x", Options: Options{Overflow: "spill"}}); err == nil {
+		t.Error("unknown overflow policy should be rejected")
+	}
+}
+
+func TestSourceThroughDispatcher(t *testing.T) {
+	sink := relaytest.NewSink()
+	d := New()
+	if err := d.Add(Sink{Name: "capture", Handle: sink.Handle, Options: Options{Overflow: OverflowBlock}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMerger(10)
+	go relaytest.NewSource(
+		message.Message{Platform: message.Twitch, Content: "one"},
+		message.Message{Platform: message.Twitch, Content: "two"},
+	).Connect(ctx, m.Source())
+	go d.Run(ctx, m.Output())
+
+	got := sink.Wait(t, 2)
+	if got[0].Content != "one" || got[1].Content != "two" {
+		t.Errorf("sink got %+v, want both messages in order", got)
+	}
+	cancel()
+	m.Close()
+}
+
+// BenchmarkDispatch fans each message out to four sinks, one of them
+// filtering, as a bridging relay's printer, uplink, and posters do.
+func BenchmarkDispatch(b *testing.B) {
+	d := New()
+	var handled atomic.Int64
+	count := func(message.Message) { handled.Add(1) }
+	for _, name := range []string{"printer", "uplink", "twitch", "youtube"} {
+		s := Sink{Name: name, Handle: count, Options: Options{Overflow: OverflowBlock}}
+		if name != "printer" {
+			s.Accept = func(msg message.Message) bool { return msg.Platform != message.HackrTV }
+		}
+		if err := d.Add(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+	in := make(chan message.Message)
+	done := make(chan struct{})
+	go func() {
+		d.Run(context.Background(), in)
+		close(done)
+	}()
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "hello chat"}
+	for b.Loop() {
+		in <- msg
+	}
+	close(in)
+	<-done
+}
@@ -0,0 +1,91 @@
+package dispatch
+
+import (
+	"sync"
+
+	"relay/internal/message"
+)
+
+// sourceBuffer is the queue length of each source channel.
+const sourceBuffer = 100
+
+// Merger combines per-source channels into one stream. Source channels
+// are never closed, so a source, or a goroutine it leaves running after
+// a restart or shutdown, can never panic by sending on a closed channel.
+// Only the merged output is closed, by Close, once every forwarder has
+// stopped.
+type Merger struct {
+	out  chan message.Message
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewMerger creates a Merger whose output holds up to buffer messages.
+func NewMerger(buffer int) *Merger {
+	return &Merger{
+		out:  make(chan message.Message, buffer),
+		stop: make(chan struct{}),
+	}
+}
+
+// Output returns the merged stream. It is closed by Close.
+func (m *Merger) Output() <-chan message.Message {
+	return m.out
+}
+
+// Source returns a new channel for one producer. Messages it sends are
+// forwarded to Output in order until Close. A channel requested after
+// Close is never read, so sends on it block rather than panic.
+func (m *Merger) Source() chan<- message.Message {
+	ch := make(chan message.Message, sourceBuffer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ch
+	}
+	m.wg.Add(1)
+	go m.forward(ch)
+	return ch
+}
+
+// forward copies ch to the output. On Close it passes along whatever is
+// already queued, then returns; later sends are never read.
+func (m *Merger) forward(ch <-chan message.Message) {
+	defer m.wg.Done()
+	for {
+		select {
+		case msg := <-ch:
+			m.out <- msg
+		case <-m.stop:
+			for {
+				select {
+				case msg := <-ch:
+					m.out <- msg
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close stops forwarding and closes Output once queued messages have
+// been passed on. Call it after the producers have returned; it is safe
+// to call more than once.
+func (m *Merger) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	close(m.stop)
+	m.wg.Wait()
+	close(m.out)
+}
@@ -0,0 +1,76 @@
+package dispatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestMergerKeepsPerSourceOrder(t *testing.T) {
+	m := NewMerger(10)
+	a, b := m.Source(), m.Source()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			a <- message.Message{Platform: message.Twitch, ID: string(rune('a' + i%26))}
+			b <- message.Message{Platform: message.YouTube}
+		}
+	}()
+
+	var twitch []string
+	for n := 0; n < 100; n++ {
+		msg := <-m.Output()
+		if msg.Platform == message.Twitch {
+			twitch = append(twitch, msg.ID)
+		}
+	}
+	for i, id := range twitch {
+		if want := string(rune('a' + i%26)); id != want {
+			t.Fatalf("twitch message %d = %q, want %q", i, id, want)
+		}
+	}
+	m.Close()
+	if _, ok := <-m.Output(); ok {
+		t.Error("Output should be closed after Close")
+	}
+}
+
+func TestMergerLateSendsDoNotPanic(t *testing.T) {
+	m := NewMerger(1)
+	src := m.Source()
+	src <- message.Message{Content: "queued"}
+
+	// Drain the output concurrently so Close can flush.
+	var got []message.Message
+	done := make(chan struct{})
+	go func() {
+		for msg := range m.Output() {
+			got = append(got, msg)
+		}
+		close(done)
+	}()
+
+	m.Close()
+	m.Close()
+	<-done
+	if len(got) != 1 || got[0].Content != "queued" {
+		t.Errorf("flushed %+v, want the queued message", got)
+	}
+
+	// A straggling sender and a source requested after Close must not
+	// panic; their messages are simply never read.
+	var wg sync.WaitGroup
+	for _, ch := range []chan<- message.Message{src, m.Source()} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case ch <- message.Message{Content: "late"}:
+			case <-time.After(10 * time.Millisecond):
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,118 @@
+package display
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fatih/color"
+	"relay/internal/message"
+)
+
+// Emote display modes, for SetEmotes.
+const (
+	// EmotesText shows emotes by name in their own color. It is the
+	// default.
+	EmotesText = "text"
+	// EmotesImages draws emotes as pictures on terminals that can, see
+	// ImageProtocol, and as EmotesText elsewhere.
+	EmotesImages = "images"
+	// EmotesPlain shows emotes as the rest of the message.
+	EmotesPlain = "plain"
+)
+
+// SetEmotes sets how emotes in chat and paid messages are shown in the
+// text format: EmotesText (the default), EmotesImages, or EmotesPlain.
+// Pictures are only drawn when the printer writes to a terminal that
+// ImageProtocol recognises; each is downloaded the first time its emote
+// is seen, and the emote is shown by name until it arrives.
+func (p *Printer) SetEmotes(mode string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emotes = mode
+	p.images = nil
+	if mode == EmotesImages {
+		if proto := ImageProtocol(); proto != "" && terminalWidth(p.out) > 0 {
+			p.images = newImageCache(proto, &http.Client{})
+		}
+	}
+}
+
+// Span is a piece of a line of message content: plain text, or one
+// emote.
+type Span struct {
+	Text string
+	// Emote is the emote Text names, or nil for plain text.
+	Emote *message.Emote
+}
+
+// Spans splits a line of content at the emotes in it. Emotes are matched
+// by name, since wrapping a message moves them from their offsets.
+func Spans(line string, emotes []message.Emote) []Span {
+	if len(emotes) == 0 {
+		return []Span{{Text: line}}
+	}
+	byName := make(map[string]*message.Emote, len(emotes))
+	for i := range emotes {
+		if _, ok := byName[emotes[i].Name]; !ok {
+			byName[emotes[i].Name] = &emotes[i]
+		}
+	}
+	var spans []Span
+	var text strings.Builder
+	for i, word := range strings.Split(line, " ") {
+		if i > 0 {
+			text.WriteByte(' ')
+		}
+		e, ok := byName[word]
+		if !ok {
+			text.WriteString(word)
+			continue
+		}
+		if text.Len() > 0 {
+			spans = append(spans, Span{Text: text.String()})
+			text.Reset()
+		}
+		spans = append(spans, Span{Text: word, Emote: e})
+	}
+	if text.Len() > 0 {
+		spans = append(spans, Span{Text: text.String()})
+	}
+	return spans
+}
+
+// printContent writes chat content like printIndented, showing its
+// emotes as set by SetEmotes.
+func (p *Printer) printContent(c *color.Color, text string, emotes []message.Emote, width int) {
+	if len(emotes) == 0 || p.emotes == EmotesPlain {
+		p.printIndented(c, text, width)
+		return
+	}
+	for _, line := range Wrap(text, width) {
+		var b strings.Builder
+		b.WriteString(indent)
+		for _, s := range Spans(line, emotes) {
+			switch {
+			case s.Emote == nil && c != nil:
+				b.WriteString(c.Sprint(s.Text))
+			case s.Emote == nil:
+				b.WriteString(s.Text)
+			default:
+				b.WriteString(p.emote(s.Emote))
+			}
+		}
+		b.WriteByte('\n')
+		io.WriteString(p.out, b.String())
+	}
+}
+
+// emote renders one emote: its picture when it is ready, and otherwise
+// its name in the emote color.
+func (p *Printer) emote(e *message.Emote) string {
+	if p.images != nil && e.Image != "" {
+		if seq, ok := p.images.get(e.Image); ok {
+			return seq
+		}
+	}
+	return p.emoteColor.Sprint(e.Name)
+}
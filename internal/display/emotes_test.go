@@ -0,0 +1,130 @@
+package display
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"relay/internal/message"
+)
+
+var kappa = message.Emote{Name: "Kappa", Start: 0, End: 5, Image: "/kappa.png"}
+
+func TestSpans(t *testing.T) {
+	spans := Spans("Kappa hi  there Kappa", []message.Emote{kappa, {Name: "Kappa", Start: 16, End: 21}})
+	want := []Span{{Text: "Kappa", Emote: &kappa}, {Text: " hi  there "}, {Text: "Kappa", Emote: &kappa}}
+	if len(spans) != len(want) {
+		t.Fatalf("Spans() = %+v, want %+v", spans, want)
+	}
+	for i := range want {
+		if spans[i].Text != want[i].Text || (spans[i].Emote == nil) != (want[i].Emote == nil) {
+			t.Errorf("Spans()[%d] = %+v, want %+v", i, spans[i], want[i])
+		}
+	}
+	if spans := Spans("no emotes", nil); len(spans) != 1 || spans[0].Text != "no emotes" {
+		t.Errorf("Spans() without emotes = %+v", spans)
+	}
+}
+
+func TestPrintEmotes(t *testing.T) {
+	color.NoColor = false
+	defer func() { color.NoColor = true }()
+
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "Kappa gg", Emotes: []message.Emote{kappa}}
+	p := NewPrinter()
+	p.SetWidth(-1)
+	if out := capturePrint(p, msg); !strings.Contains(out, "    \x1b[35mKappa\x1b[0m gg\n") {
+		t.Errorf("output = %q, want the emote in magenta", out)
+	}
+	p.SetEmotes(EmotesPlain)
+	if out := capturePrint(p, msg); !strings.Contains(out, "    Kappa gg\n") {
+		t.Errorf("plain output = %q", out)
+	}
+	// Images fall back to names when the terminal can't draw them
+	p.SetEmotes(EmotesImages)
+	if out := capturePrint(p, msg); !strings.Contains(out, "\x1b[35mKappa\x1b[0m") {
+		t.Errorf("images output off a terminal = %q", out)
+	}
+}
+
+// testPNG is a 2x2 PNG.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrintEmoteImages(t *testing.T) {
+	pic := testPNG(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pic)
+	}))
+	defer server.Close()
+
+	p := NewPrinter()
+	p.SetWidth(-1)
+	p.images = newImageCache(Kitty, server.Client())
+	e := kappa
+	e.Image = server.URL + e.Image
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "Kappa gg", Emotes: []message.Emote{e}}
+
+	// The name stands in until the picture has downloaded
+	if out := capturePrint(p, msg); !strings.Contains(out, "    Kappa gg\n") {
+		t.Errorf("first output = %q", out)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		out := capturePrint(p, msg)
+		if strings.Contains(out, "    \x1b_Gf=100,a=T,c=2,r=1,q=2,m=0;") && strings.Contains(out, "\x1b\\ gg\n") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want the picture", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	pic := testPNG(t)
+	seq, err := encodeImage(ITerm2, pic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1b]1337;File=inline=1;size=" + strconv.Itoa(len(pic)) + ";width=2;height=1;preserveAspectRatio=1:" + base64.StdEncoding.EncodeToString(pic) + "\a"
+	if seq != want {
+		t.Errorf("iTerm2 sequence = %q, want %q", seq, want)
+	}
+
+	// Large pictures go to kitty in chunks
+	big := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range big.Pix {
+		big.Pix[i] = byte(rng.IntN(256))
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, big)
+	seq, err = encodeImage(Kitty, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(seq, "\x1b_Gf=100,a=T,c=2,r=1,q=2,m=1;") || !strings.Contains(seq, "\x1b_Gm=0;") {
+		t.Errorf("kitty sequence isn't chunked: %.80q...", seq)
+	}
+
+	if _, err := encodeImage(Kitty, []byte("RIFF....WEBP")); err == nil {
+		t.Error("encodeImage() accepted a picture it can't decode")
+	}
+}
@@ -0,0 +1,162 @@
+package display
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"relay/internal/message"
+)
+
+// Target selects a platform, optionally narrowed to one source channel.
+type Target struct {
+	Platform message.Platform
+	Channel  string
+}
+
+// ParseTarget parses "ttv" or "ttv#xqc" (platform key or label, with an
+// optional channel).
+func ParseTarget(s string) (Target, error) {
+	name, channel, _ := strings.Cut(strings.TrimSpace(s), "#")
+	p, ok := message.ParsePlatform(name)
+	if !ok {
+		return Target{}, fmt.Errorf("unknown platform %q", name)
+	}
+	return Target{Platform: p, Channel: strings.ToLower(channel)}, nil
+}
+
+func (t Target) matches(msg message.Message) bool {
+	return t.Platform == msg.Platform && (t.Channel == "" || strings.EqualFold(t.Channel, msg.Channel))
+}
+
+func (t Target) String() string {
+	if t.Channel != "" {
+		return t.Platform.String() + "#" + t.Channel
+	}
+	return t.Platform.String()
+}
+
+// Filter holds the live mute/solo state for the display. When any target
+// is soloed only soloed messages are shown; otherwise muted targets are
+// hidden. It is safe for concurrent use.
+type Filter struct {
+	mu    sync.RWMutex
+	muted map[Target]bool
+	solo  map[Target]bool
+}
+
+func NewFilter() *Filter {
+	return &Filter{
+		muted: make(map[Target]bool),
+		solo:  make(map[Target]bool),
+	}
+}
+
+// Mute hides a target until Unmute is called.
+func (f *Filter) Mute(t Target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.muted[t] = true
+}
+
+// Unmute shows a previously muted target again.
+func (f *Filter) Unmute(t Target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.muted, t)
+}
+
+// Muted reports whether t itself is muted.
+func (f *Filter) Muted(t Target) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.muted[t]
+}
+
+// ShowOnly mutes every registered platform except the given ones, so the
+// display starts out showing only those. Each can be unmuted again.
+func (f *Filter) ShowOnly(platforms ...message.Platform) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range message.Platforms() {
+		if !slices.Contains(platforms, p) {
+			f.muted[Target{Platform: p}] = true
+		}
+	}
+}
+
+// Solo adds a target to the solo set.
+func (f *Filter) Solo(t Target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.solo[t] = true
+}
+
+// ClearSolo empties the solo set so all unmuted targets are shown.
+func (f *Filter) ClearSolo() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.solo = make(map[Target]bool)
+}
+
+// Allows reports whether msg should be displayed.
+func (f *Filter) Allows(msg message.Message) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.solo) > 0 {
+		for t := range f.solo {
+			if t.matches(msg) {
+				return true
+			}
+		}
+		return false
+	}
+	for t := range f.muted {
+		if t.matches(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Status summarises the current state for a status line,
+// e.g. "solo: HTV" or "muted: TTV#xqc, YT_".
+func (f *Filter) Status() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var parts []string
+	if len(f.solo) > 0 {
+		parts = append(parts, "solo: "+joinTargets(f.solo))
+	}
+	if len(f.muted) > 0 {
+		parts = append(parts, "muted: "+joinTargets(f.muted))
+	}
+	if len(parts) == 0 {
+		return "showing all"
+	}
+	return strings.Join(parts, " | ")
+}
+
+// Targets returns the muted and soloed targets, sorted, e.g. "TTV#xqc".
+func (f *Filter) Targets() (muted, solo []string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return sortedTargets(f.muted), sortedTargets(f.solo)
+}
+
+func joinTargets(set map[Target]bool) string {
+	return strings.Join(sortedTargets(set), ", ")
+}
+
+func sortedTargets(set map[Target]bool) []string {
+	names := make([]string, 0, len(set))
+	for t := range set {
+		names = append(names, t.String())
+	}
+	sort.Strings(names)
+	return names
+}
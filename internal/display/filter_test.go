@@ -0,0 +1,120 @@
+package display
+
+import (
+	"strings"
+	"testing"
+
+	"relay/internal/message"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Target
+		wantErr bool
+	}{
+		{in: "ttv", want: Target{Platform: message.Twitch}},
+		{in: "hackrtv", want: Target{Platform: message.HackrTV}},
+		{in: "TTV#XQC", want: Target{Platform: message.Twitch, Channel: "xqc"}},
+		{in: "discord", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTarget(%q) expected error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTarget(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTarget(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMute(t *testing.T) {
+	f := NewFilter()
+	ttv := message.Message{Platform: message.Twitch, Channel: "xqc"}
+	ttvOther := message.Message{Platform: message.Twitch, Channel: "shroud"}
+	yt := message.Message{Platform: message.YouTube}
+
+	f.Mute(Target{Platform: message.Twitch, Channel: "xqc"})
+	if f.Allows(ttv) {
+		t.Error("muted channel should be hidden")
+	}
+	if !f.Allows(ttvOther) {
+		t.Error("other Twitch channel should still show")
+	}
+	if !f.Allows(yt) {
+		t.Error("YouTube should still show")
+	}
+	if !f.Muted(Target{Platform: message.Twitch, Channel: "xqc"}) || f.Muted(Target{Platform: message.Twitch}) {
+		t.Error("Muted() should report only the muted channel")
+	}
+
+	f.Unmute(Target{Platform: message.Twitch, Channel: "xqc"})
+	if !f.Allows(ttv) {
+		t.Error("unmuted channel should show again")
+	}
+}
+
+func TestFilterSolo(t *testing.T) {
+	f := NewFilter()
+	htv := message.Message{Platform: message.HackrTV}
+	ttv := message.Message{Platform: message.Twitch}
+
+	f.Solo(Target{Platform: message.HackrTV})
+	if !f.Allows(htv) {
+		t.Error("soloed platform should show")
+	}
+	if f.Allows(ttv) {
+		t.Error("non-soloed platform should be hidden")
+	}
+	if got := f.Status(); got != "solo: HTV" {
+		t.Errorf("Status() = %q, want %q", got, "solo: HTV")
+	}
+
+	f.ClearSolo()
+	if !f.Allows(ttv) {
+		t.Error("clearing solo should show all platforms again")
+	}
+	if got := f.Status(); got != "showing all" {
+		t.Errorf("Status() = %q, want %q", got, "showing all")
+	}
+}
+
+func TestFilterTargets(t *testing.T) {
+	f := NewFilter()
+	f.Mute(Target{Platform: message.YouTube})
+	f.Mute(Target{Platform: message.Twitch, Channel: "xqc"})
+	f.Solo(Target{Platform: message.HackrTV})
+
+	muted, solo := f.Targets()
+	if strings.Join(muted, ",") != "TTV#xqc,YT_" || strings.Join(solo, ",") != "HTV" {
+		t.Errorf("Targets() = %q, %q", muted, solo)
+	}
+	f.ClearSolo()
+	if _, solo := f.Targets(); len(solo) != 0 {
+		t.Errorf("solo after ClearSolo() = %q", solo)
+	}
+}
+
+func TestFilterShowOnly(t *testing.T) {
+	f := NewFilter()
+	f.ShowOnly(message.Twitch, message.HackrTV)
+	if !f.Allows(message.Message{Platform: message.Twitch}) || !f.Allows(message.Message{Platform: message.HackrTV}) {
+		t.Error("shown platforms should show")
+	}
+	if f.Allows(message.Message{Platform: message.YouTube}) || f.Allows(message.Message{Platform: message.Relay}) {
+		t.Error("platforms left out should be hidden")
+	}
+	f.Unmute(Target{Platform: message.YouTube})
+	if !f.Allows(message.Message{Platform: message.YouTube}) {
+		t.Error("a platform left out should show again once unmuted")
+	}
+}
@@ -0,0 +1,110 @@
+package display
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestPrintGolden checks the full rendering of each message shape against
+// testdata/<name>.golden. Run with -update after an intended change to
+// the display format and review the diff.
+func TestPrintGolden(t *testing.T) {
+	// Timestamps are printed in local time, so build them there to keep
+	// the output independent of the machine's zone.
+	ts := time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local)
+
+	tests := []struct {
+		name string
+		msg  message.Message
+	}{
+		{"chat", message.Message{Platform: message.Twitch, Username: "testuser", Content: "hello chat"}},
+		{"role", message.Message{Platform: message.HackrTV, Username: "xeraen", Role: "admin", Content: "welcome"}},
+		{"custom_role", message.Message{Platform: message.HackrTV, Username: "n0va", Role: "netrunner", Content: "jacked in"}},
+		{"channel", message.Message{Platform: message.Twitch, Username: "viewer", Channel: "channel2", Content: "hi"}},
+		{"cheer", message.Message{
+			Platform: message.Twitch, Username: "bigfan", Content: "take my bits",
+			Amount: message.Amount{Value: 100, Currency: "bits", Display: "100 bits"},
+		}},
+		{"super_chat", message.Message{
+			Platform: message.YouTube, Username: "ytfan", Content: "great stream",
+			Amount: message.Amount{Value: 5, Currency: "USD", Display: "$5.00"},
+		}},
+		{"normalized", message.Message{
+			Platform: message.YouTube, Username: "eurofan", Content: "grüße",
+			Amount:     message.Amount{Value: 10, Currency: "EUR", Display: "€10.00"},
+			Normalized: message.Amount{Value: 10.87, Currency: "USD", Display: "$10.87"},
+		}},
+		{"previews", message.Message{
+			Platform: message.Twitch, Username: "linker", Content: "look https://example.com",
+			Previews: []message.Preview{{URL: "https://example.com", Title: "Example Domain"}},
+		}},
+		{"reply", message.Message{
+			Platform: message.Twitch, Username: "viewer", Content: "@streamer same here",
+			ReplyToID: "abc-123", ReplyToUser: "streamer",
+		}},
+		{"sub", message.Message{Platform: message.Twitch, Type: message.TypeSub, Username: "newsub", Content: "subscribed at Tier 1"}},
+		{"deletion", message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "troll", Channel: "xqc", Content: "message from troll deleted"}},
+		{"edit", message.Message{Platform: message.HackrTV, Type: message.TypeEdit, Username: "xeraen", Content: "message from xeraen edited: fixed typo"}},
+		{"system", message.Message{Platform: message.HackrTV, Type: message.TypeSystem, Username: "xeraen", Content: "xeraen connected (2 online)"}},
+		{"hype", message.Message{Platform: message.Relay, Type: message.TypeHype, Username: "hype", Content: "chat is popping off"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := NewPrinterTo(&buf)
+			msg := tt.msg
+			msg.Timestamp = ts
+			p.Print(msg)
+			checkGolden(t, tt.name, buf.Bytes())
+		})
+	}
+}
+
+// TestRunGolden prints a stream through the filter, as the relay does,
+// and checks the combined output.
+func TestRunGolden(t *testing.T) {
+	ts := time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local)
+	ch := make(chan message.Message, 3)
+	ch <- message.Message{Platform: message.Twitch, Username: "a", Timestamp: ts, Content: "twitch"}
+	ch <- message.Message{Platform: message.YouTube, Username: "b", Timestamp: ts, Content: "youtube, muted"}
+	ch <- message.Message{Platform: message.HackrTV, Username: "c", Timestamp: ts, Content: "hackr.tv"}
+	close(ch)
+
+	var buf bytes.Buffer
+	p := NewPrinterTo(&buf)
+	p.Filter().Mute(Target{Platform: message.YouTube})
+	p.Run(ch)
+	checkGolden(t, "stream", buf.Bytes())
+}
+
+// checkGolden compares got with testdata/<name>.golden, rewriting the
+// file instead when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
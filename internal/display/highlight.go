@@ -0,0 +1,72 @@
+package display
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"relay/internal/message"
+)
+
+// Highlights matches chat that mentions one of a set of keywords, such as
+// the streamer's "@name", so it stands out in the display. A nil
+// *Highlights matches nothing.
+type Highlights struct {
+	// words are the keywords, lowercased.
+	words []string
+}
+
+// NewHighlights returns a matcher for words, ignoring blank ones, or nil
+// when there are none.
+func NewHighlights(words []string) *Highlights {
+	var h Highlights
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			h.words = append(h.words, w)
+		}
+	}
+	if len(h.words) == 0 {
+		return nil
+	}
+	return &h
+}
+
+// Match reports whether msg is chat whose content contains a keyword as
+// a whole word, ignoring case: "relay" matches "ask the Relay?" but not
+// "relayed". Events are never highlighted.
+func (h *Highlights) Match(msg message.Message) bool {
+	if h == nil || msg.IsEvent() {
+		return false
+	}
+	content := strings.ToLower(msg.Content)
+	for _, w := range h.words {
+		if containsWord(content, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether word appears in s with no letter, digit,
+// or underscore directly before or after it.
+func containsWord(s, word string) bool {
+	for start := 0; ; {
+		i := strings.Index(s[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if (i == 0 || !isWordRune(before)) && (end == len(s) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		start = i + size
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
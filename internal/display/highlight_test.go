@@ -0,0 +1,45 @@
+package display
+
+import (
+	"testing"
+
+	"relay/internal/message"
+)
+
+func TestHighlightsMatch(t *testing.T) {
+	h := NewHighlights([]string{"@MyChannel", " relay ", ""})
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"hey @mychannel what's the setup?", true},
+		{"@MYCHANNEL", true},
+		{"does the Relay work with kick?", true},
+		{"relay, relayed", true},
+		{"it relayed fine", false},
+		{"relays everywhere", false},
+		{"@mychannel_fan here", false},
+		{"nothing to see", false},
+	}
+	for _, tt := range tests {
+		msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: tt.content}
+		if got := h.Match(msg); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+
+	// Events aren't chat aimed at anyone
+	if h.Match(message.Message{Type: message.TypeRaid, Content: "relay raided with 10 viewers"}) {
+		t.Error("Match() highlighted an event")
+	}
+}
+
+func TestNoHighlights(t *testing.T) {
+	h := NewHighlights([]string{"", "  "})
+	if h != nil {
+		t.Fatalf("NewHighlights() of blank words = %+v, want nil", h)
+	}
+	if h.Match(message.Message{Content: "anything"}) {
+		t.Error("nil Highlights matched")
+	}
+}
@@ -0,0 +1,178 @@
+package display
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inline image protocols, as returned by ImageProtocol.
+const (
+	// Kitty is kitty's graphics protocol, also spoken by WezTerm,
+	// Ghostty, and Konsole.
+	Kitty = "kitty"
+	// ITerm2 is iTerm2's inline images protocol.
+	ITerm2 = "iterm2"
+)
+
+const (
+	// maxImageBytes caps the size of an emote picture.
+	maxImageBytes = 1 << 20
+	// imageCacheLimit bounds how many pictures are kept.
+	imageCacheLimit = 500
+	// imageFetches caps simultaneous picture downloads.
+	imageFetches = 4
+	// imageTimeout bounds one picture's download.
+	imageTimeout = 5 * time.Second
+	// imageChunk is the most base64 kitty takes in one escape sequence.
+	imageChunk = 4096
+)
+
+// ImageProtocol returns the inline image protocol of the terminal the
+// relay runs in, from the variables terminals set, or "" when it is
+// unknown or the relay runs under tmux or screen, which don't pass
+// images through.
+func ImageProtocol() string {
+	term := os.Getenv("TERM")
+	switch {
+	case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen") || strings.HasPrefix(term, "tmux"):
+		return ""
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty":
+		return Kitty
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("LC_TERMINAL") == "iTerm2" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		return ITerm2
+	}
+	return ""
+}
+
+// imageCache downloads emote pictures and keeps them encoded for the
+// terminal, by URL.
+type imageCache struct {
+	protocol string
+	http     *http.Client
+	sem      chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*imageEntry
+	order   []string
+}
+
+type imageEntry struct {
+	// seq draws the picture, or is "" while it downloads or when it
+	// couldn't be shown.
+	seq string
+}
+
+func newImageCache(protocol string, client *http.Client) *imageCache {
+	return &imageCache{
+		protocol: protocol,
+		http:     client,
+		sem:      make(chan struct{}, imageFetches),
+		entries:  make(map[string]*imageEntry),
+	}
+}
+
+// get returns the escape sequence that draws the picture at url two
+// cells wide. The first call for a URL starts its download and reports
+// false, as do calls until it is done and for pictures that fail.
+func (c *imageCache) get(url string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[url]; ok {
+		return e.seq, e.seq != ""
+	}
+	if len(c.order) >= imageCacheLimit {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	e := &imageEntry{}
+	c.entries[url] = e
+	c.order = append(c.order, url)
+	go func() {
+		c.sem <- struct{}{}
+		defer func() { <-c.sem }()
+		seq, err := c.fetch(url)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		e.seq = seq
+		c.mu.Unlock()
+	}()
+	return "", false
+}
+
+// fetch downloads the picture at url and encodes it for the terminal.
+func (c *imageCache) fetch(url string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("image: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageBytes {
+		return "", fmt.Errorf("image: %s is over %d bytes", url, maxImageBytes)
+	}
+	return encodeImage(c.protocol, data)
+}
+
+// encodeImage returns the escape sequence that draws the picture in data
+// two cells wide and one high. Only PNG, GIF, and JPEG pictures are
+// drawn; kitty is sent a PNG of the first frame.
+func encodeImage(protocol string, data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	switch protocol {
+	case Kitty:
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+		payload := base64.StdEncoding.EncodeToString(buf.Bytes())
+		var b strings.Builder
+		for first := true; first || payload != ""; first = false {
+			chunk := payload[:min(len(payload), imageChunk)]
+			payload = payload[len(chunk):]
+			more := 0
+			if payload != "" {
+				more = 1
+			}
+			if first {
+				// Transmit and show a PNG over 2x1 cells, without replies
+				fmt.Fprintf(&b, "\x1b_Gf=100,a=T,c=2,r=1,q=2,m=%d;%s\x1b\\", more, chunk)
+			} else {
+				fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+			}
+		}
+		return b.String(), nil
+	case ITerm2:
+		return "\x1b]1337;File=inline=1;size=" + fmt.Sprint(len(data)) +
+			";width=2;height=1;preserveAspectRatio=1:" + base64.StdEncoding.EncodeToString(data) + "\a", nil
+	}
+	return "", fmt.Errorf("image: unknown protocol %q", protocol)
+}
@@ -0,0 +1,225 @@
+package display
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/signing"
+)
+
+// signer signs each message the JSON output and MarshalJSON encode, or
+// is nil. It is set once at startup with SetSigner.
+var signer atomic.Pointer[signing.Signer]
+
+// SetSigner signs every message encoded as JSON from now on with s, in a
+// final "signature" field (see signing.SignJSON). That covers the JSON
+// output and everything using MarshalJSON: bus publishes, the
+// dashboard's event stream, and JSON chat logs. A nil s stops signing.
+func SetSigner(s *signing.Signer) {
+	signer.Store(s)
+}
+
+// jsonMessage is one line of JSON output. The top-level fields are what
+// every message has; the rest sits under metadata, left out when empty.
+type jsonMessage struct {
+	Platform  string       `json:"platform"`
+	Label     string       `json:"label"`
+	Type      string       `json:"type"`
+	Channel   string       `json:"channel,omitempty"`
+	Username  string       `json:"username"`
+	Content   string       `json:"content"`
+	Timestamp time.Time    `json:"timestamp"`
+	Metadata  jsonMetadata `json:"metadata"`
+}
+
+type jsonMetadata struct {
+	ID          string            `json:"id,omitempty"`
+	TargetID    string            `json:"target_id,omitempty"`
+	ReplyToID   string            `json:"reply_to_id,omitempty"`
+	ReplyToUser string            `json:"reply_to_user,omitempty"`
+	UserID      string            `json:"user_id,omitempty"`
+	Role        string            `json:"role,omitempty"`
+	Badges      []string          `json:"badges,omitempty"`
+	Amount      *jsonAmount       `json:"amount,omitempty"`
+	Normalized  *jsonAmount       `json:"normalized,omitempty"`
+	Emotes      []jsonEmote       `json:"emotes,omitempty"`
+	Previews    []jsonPreview     `json:"previews,omitempty"`
+	Profile     *jsonProfile      `json:"profile,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Raw         string            `json:"raw,omitempty"`
+}
+
+type jsonAmount struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+	Display  string  `json:"display"`
+}
+
+type jsonEmote struct {
+	Name  string `json:"name"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Image string `json:"image,omitempty"`
+}
+
+type jsonPreview struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+type jsonProfile struct {
+	Created *time.Time `json:"created,omitempty"`
+	Avatar  string     `json:"avatar,omitempty"`
+	URL     string     `json:"url,omitempty"`
+}
+
+// NewJSONPrinter returns a printer that writes one JSON object per message
+// (NDJSON) to stdout, for jq, log shippers, and other tools.
+func NewJSONPrinter() *Printer {
+	return NewJSONPrinterTo(os.Stdout)
+}
+
+// NewJSONPrinterTo returns a JSON printer that writes to w.
+func NewJSONPrinterTo(w io.Writer) *Printer {
+	p := NewPrinterTo(w)
+	p.json = true
+	return p
+}
+
+// printJSON writes msg as a single line of JSON, with its timestamp in
+// the display's timezone when one is set.
+func (p *Printer) printJSON(msg message.Message) {
+	if p.timestamps.Location != nil {
+		msg.Timestamp = msg.Timestamp.In(p.timestamps.Location)
+	}
+	data, err := MarshalJSON(msg)
+	if err != nil {
+		return
+	}
+	p.out.Write(append(data, '\n'))
+}
+
+// MarshalJSON encodes msg in the same form as the JSON output, without
+// the trailing newline, for other places that hand chat to tools. It is
+// signed when SetSigner has given a key.
+func MarshalJSON(msg message.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(newJSONMessage(msg)); err != nil {
+		return nil, err
+	}
+	return signer.Load().SignJSON(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// UnmarshalJSON decodes a message written by MarshalJSON or the JSON
+// output. The platform must be registered in this process.
+func UnmarshalJSON(data []byte) (message.Message, error) {
+	var in jsonMessage
+	if err := json.Unmarshal(data, &in); err != nil {
+		return message.Message{}, err
+	}
+	p, ok := message.ParsePlatform(in.Platform)
+	if !ok {
+		return message.Message{}, fmt.Errorf("unknown platform %q", in.Platform)
+	}
+	t, ok := message.ParseType(in.Type)
+	if !ok {
+		return message.Message{}, fmt.Errorf("unknown message type %q", in.Type)
+	}
+	md := in.Metadata
+	msg := message.Message{
+		Platform:    p,
+		Type:        t,
+		ID:          md.ID,
+		TargetID:    md.TargetID,
+		ReplyToID:   md.ReplyToID,
+		ReplyToUser: md.ReplyToUser,
+		Channel:     in.Channel,
+		Username:    in.Username,
+		UserID:      md.UserID,
+		Role:        md.Role,
+		Badges:      md.Badges,
+		Timestamp:   in.Timestamp,
+		Content:     in.Content,
+		Amount:      md.Amount.amount(),
+		Normalized:  md.Normalized.amount(),
+		Extra:       md.Extra,
+		Raw:         md.Raw,
+	}
+	for _, e := range md.Emotes {
+		msg.Emotes = append(msg.Emotes, message.Emote(e))
+	}
+	for _, pv := range md.Previews {
+		msg.Previews = append(msg.Previews, message.Preview(pv))
+	}
+	if pf := md.Profile; pf != nil {
+		msg.Profile = &message.Profile{Avatar: pf.Avatar, URL: pf.URL}
+		if pf.Created != nil {
+			msg.Profile.Created = *pf.Created
+		}
+	}
+	return msg, nil
+}
+
+// newJSONMessage lays msg out in the JSON output's schema.
+func newJSONMessage(msg message.Message) jsonMessage {
+	out := jsonMessage{
+		Platform:  msg.Platform.Key(),
+		Label:     msg.Platform.String(),
+		Type:      msg.Type.String(),
+		Channel:   msg.Channel,
+		Username:  msg.Username,
+		Content:   msg.Content,
+		Timestamp: msg.Timestamp,
+		Metadata: jsonMetadata{
+			ID:          msg.ID,
+			TargetID:    msg.TargetID,
+			ReplyToID:   msg.ReplyToID,
+			ReplyToUser: msg.ReplyToUser,
+			UserID:      msg.UserID,
+			Role:        msg.Role,
+			Badges:      msg.Badges,
+			Amount:      newJSONAmount(msg.Amount),
+			Normalized:  newJSONAmount(msg.Normalized),
+			Extra:       msg.Extra,
+			Raw:         msg.Raw,
+		},
+	}
+	for _, e := range msg.Emotes {
+		out.Metadata.Emotes = append(out.Metadata.Emotes, jsonEmote(e))
+	}
+	for _, pv := range msg.Previews {
+		out.Metadata.Previews = append(out.Metadata.Previews, jsonPreview(pv))
+	}
+	if pf := msg.Profile; pf != nil {
+		out.Metadata.Profile = &jsonProfile{Avatar: pf.Avatar, URL: pf.URL}
+		if !pf.Created.IsZero() {
+			out.Metadata.Profile.Created = &pf.Created
+		}
+	}
+	return out
+}
+
+// amount returns a as a message amount, zero when a is nil.
+func (a *jsonAmount) amount() message.Amount {
+	if a == nil {
+		return message.Amount{}
+	}
+	return message.Amount{Value: a.Value, Currency: a.Currency, Display: a.Display}
+}
+
+// newJSONAmount returns a, or nil when no amount is set.
+func newJSONAmount(a message.Amount) *jsonAmount {
+	if a.IsZero() {
+		return nil
+	}
+	return &jsonAmount{Value: a.Value, Currency: a.Currency, Display: a.Display}
+}
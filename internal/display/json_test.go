@@ -0,0 +1,175 @@
+package display
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/signing"
+)
+
+func TestJSONPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewJSONPrinterTo(&buf)
+	p.Handle(message.Message{
+		Platform:  message.Twitch,
+		ID:        "abc",
+		Channel:   "xqc",
+		Username:  "cheerer",
+		Badges:    []string{"subscriber"},
+		Timestamp: time.Date(2025, 1, 15, 14, 32, 6, 0, time.UTC),
+		Content:   "Cheer100 <3 great stream",
+		Amount:    message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"},
+		Extra:     map[string]string{message.ExtraColor: "#FF4500"},
+	})
+	p.Handle(message.Message{Platform: message.HackrTV, Type: message.TypeSystem, Username: "relay", Content: "hi"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per message:\n%s", len(lines), buf.String())
+	}
+	want := `{"platform":"twitch","label":"TTV","type":"chat","channel":"xqc","username":"cheerer","content":"Cheer100 <3 great stream","timestamp":"2025-01-15T14:32:06Z","metadata":{"id":"abc","badges":["subscriber"],"amount":{"value":100,"currency":"BITS","display":"100 bits"},"extra":{"color":"#FF4500"}}}`
+	if lines[0] != want {
+		t.Errorf("line 1 =\n%s\nwant\n%s", lines[0], want)
+	}
+	var second map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second["type"] != "system" || second["platform"] != "hackrtv" {
+		t.Errorf("line 2 = %v", second)
+	}
+
+	// Mutes apply as they do to the text output
+	buf.Reset()
+	p.Filter().Mute(Target{Platform: message.Twitch})
+	p.Handle(message.Message{Platform: message.Twitch, Content: "hidden"})
+	if buf.Len() != 0 {
+		t.Errorf("muted message was written: %s", buf.String())
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	var buf bytes.Buffer
+	msg := message.Message{Platform: message.YouTube, Username: "viewer", Content: "<3 & hi", Timestamp: time.Date(2025, 1, 15, 14, 32, 6, 0, time.UTC)}
+	NewJSONPrinterTo(&buf).Handle(msg)
+	got, err := MarshalJSON(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got)+"\n" != buf.String() {
+		t.Errorf("MarshalJSON() = %s\nwant the printer's line %s", got, buf.String())
+	}
+}
+
+func TestJSONSigned(t *testing.T) {
+	s, err := signing.LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSigner(s)
+	defer SetSigner(nil)
+
+	var buf bytes.Buffer
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "hi", Timestamp: time.Date(2025, 1, 15, 14, 32, 6, 0, time.UTC)}
+	NewJSONPrinterTo(&buf).Handle(msg)
+	line := strings.TrimSuffix(buf.String(), "\n")
+	if !signing.VerifyJSON(s.PublicKey(), []byte(line)) {
+		t.Errorf("NDJSON line %s has no valid signature", line)
+	}
+	if tampered := strings.Replace(line, `"hi"`, `"injected"`, 1); signing.VerifyJSON(s.PublicKey(), []byte(tampered)) {
+		t.Error("VerifyJSON() accepted an altered line")
+	}
+
+	// Bus publishes and the dashboard use MarshalJSON, and a consuming
+	// relay still decodes what it signed
+	data, err := MarshalJSON(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != line {
+		t.Errorf("MarshalJSON() = %s, want the NDJSON line %s", data, line)
+	}
+	got, err := UnmarshalJSON(data)
+	if err != nil || got.Content != "hi" {
+		t.Errorf("UnmarshalJSON() = %+v, %v", got, err)
+	}
+}
+
+func TestUnmarshalJSONRoundTrip(t *testing.T) {
+	msg := message.Message{
+		Platform:    message.Twitch,
+		Type:        message.TypeSub,
+		ID:          "abc",
+		TargetID:    "def",
+		ReplyToID:   "ghi",
+		ReplyToUser: "streamer",
+		Channel:     "xqc",
+		Username:    "cheerer",
+		UserID:      "12826",
+		Role:        "moderator",
+		Badges:      []string{"subscriber"},
+		Timestamp:   time.Date(2025, 1, 15, 14, 32, 6, 0, time.UTC),
+		Content:     "Kappa hi",
+		Emotes:      []message.Emote{{Name: "Kappa", Start: 0, End: 5}},
+		Amount:      message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"},
+		Normalized:  message.Amount{Value: 1, Currency: "USD", Display: "$1.00"},
+		Previews:    []message.Preview{{URL: "https://example.com", Title: "Example"}},
+		Profile: &message.Profile{
+			Created: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC),
+			Avatar:  "https://static-cdn.jtvnw.net/cheerer.png",
+			URL:     "https://www.twitch.tv/cheerer",
+		},
+		Extra: map[string]string{message.ExtraFirstMessage: "1", "twitch.returning": "1"},
+		Raw:   "@badges=subscriber/1;id=abc :cheerer!cheerer@cheerer.tmi.twitch.tv PRIVMSG #xqc :Kappa hi",
+	}
+	data, err := MarshalJSON(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, msg)
+	}
+
+	for _, bad := range []string{`{"platform":"discord","type":"chat"}`, `{"platform":"twitch","type":"shout"}`, `not json`} {
+		if _, err := UnmarshalJSON([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalJSON(%s) succeeded", bad)
+		}
+	}
+}
+
+// benchMessage is a chat message with the metadata a busy Twitch chat
+// usually carries.
+var benchMessage = message.Message{
+	Platform:  message.Twitch,
+	ID:        "b34ccfc7-4977-403a-8a94-33c6bac34fb8",
+	Channel:   "xqc",
+	Username:  "viewer",
+	Badges:    []string{"subscriber", "premium"},
+	Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+	Content:   "Kappa Keepo Kappa what a play, did everyone see that clip from yesterday's stream",
+	Emotes:    []message.Emote{{Name: "Kappa", Start: 0, End: 5}, {Name: "Keepo", Start: 6, End: 11}, {Name: "Kappa", Start: 12, End: 17}},
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	for b.Loop() {
+		MarshalJSON(benchMessage)
+	}
+}
+
+func BenchmarkPrintJSON(b *testing.B) {
+	p := NewJSONPrinterTo(io.Discard)
+	for b.Loop() {
+		p.Print(benchMessage)
+	}
+}
@@ -2,61 +2,278 @@ package display
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/fatih/color"
+	"relay/internal/i18n"
 	"relay/internal/message"
 )
 
+// colorHints maps platform descriptor color hints to terminal colors.
+var colorHints = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+// roleBadge is the tag shown before a sender's name for their role.
+type roleBadge struct {
+	tag   string
+	color *color.Color
+}
+
+// roleBadges maps roles to badges. Other non-empty roles get a dim badge
+// from their first three letters.
+var roleBadges = map[string]roleBadge{
+	"admin":     {"ADM", color.New(color.FgRed, color.Bold)},
+	"moderator": {"MOD", color.New(color.FgGreen, color.Bold)},
+	"operative": {"OPR", color.New(color.FgBlue)},
+}
+
+// eventColors sets each kind of event apart in the text format. Other
+// event types use the printer's event color.
+var eventColors = map[message.Type]*color.Color{
+	message.TypeSub:        color.New(color.FgHiMagenta, color.Bold),
+	message.TypeRaid:       color.New(color.FgHiCyan, color.Bold),
+	message.TypeFollow:     color.New(color.FgHiGreen, color.Bold),
+	message.TypeRedemption: color.New(color.FgHiBlue, color.Bold),
+	message.TypeHype:       color.New(color.FgHiRed, color.Bold),
+	message.TypeDeletion:   color.New(color.FgRed),
+	message.TypeEdit:       color.New(color.FgHiBlack),
+	message.TypeSystem:     color.New(color.FgHiBlack),
+}
+
 type Printer struct {
-	twitchColor   *color.Color
-	youtubeColor  *color.Color
-	hackrtvColor  *color.Color
+	// mu keeps each message's lines together when Handle is called
+	// from several goroutines.
+	mu            sync.Mutex
+	out           io.Writer
+	filter        *Filter
 	usernameColor *color.Color
 	dimColor      *color.Color
+	eventColor    *color.Color
+	amountColor   *color.Color
+	// highlightColor marks chat matching highlights, set by
+	// SetHighlights, which also rings the bell for it when bell is set.
+	highlightColor *color.Color
+	highlights     *Highlights
+	bell           bool
+	// json, when set, writes each message as a line of JSON instead.
+	json bool
+	// tmpl, when set, formats each message with a user's template.
+	tmpl *template.Template
+	// width is the wrapping width set by SetWidth.
+	width int
+	// emotes is how emotes are shown, set by SetEmotes, and images
+	// draws their pictures when that is EmotesImages and the terminal
+	// can.
+	emotes     string
+	emoteColor *color.Color
+	images     *imageCache
+	// timestamps is how send times are shown, set by SetTimestamps.
+	timestamps Timestamps
 }
 
+// NewPrinter returns a printer that writes to stdout.
 func NewPrinter() *Printer {
+	return NewPrinterTo(os.Stdout)
+}
+
+// NewPrinterTo returns a printer that writes to w.
+func NewPrinterTo(w io.Writer) *Printer {
 	return &Printer{
-		twitchColor:   color.New(color.FgMagenta, color.Bold),
-		youtubeColor:  color.New(color.FgRed, color.Bold),
-		hackrtvColor:  color.New(color.FgGreen, color.Bold),
+		out:           w,
+		filter:        NewFilter(),
 		usernameColor: color.New(color.FgCyan),
 		dimColor:      color.New(color.FgHiBlack),
+		eventColor:    color.New(color.FgYellow, color.Bold),
+		amountColor:   color.New(color.FgHiYellow, color.Bold),
+		emoteColor:    color.New(color.FgMagenta),
+		// Black on yellow, so it reads on dark and light terminals
+		highlightColor: color.New(color.FgBlack, color.BgYellow, color.Bold),
 	}
 }
 
+// SetHighlights picks out chat matching h in the text format, and with
+// bell also rings the terminal bell as it is printed, in the text and
+// template formats.
+func (p *Printer) SetHighlights(h *Highlights, bell bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.highlights = h
+	p.bell = bell
+}
+
+// Print writes msg as JSON, with the printer's template, or in the
+// default format.
 func (p *Printer) Print(msg message.Message) {
-	// Line 1: [TW] username • HH:MM:SS
-	// Line 2:     message content (indented)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bell && !p.json && p.highlights.Match(msg) {
+		io.WriteString(p.out, "\a")
+	}
+	switch {
+	case p.json:
+		p.printJSON(msg)
+	case p.tmpl != nil && p.printTemplate(msg):
+	default:
+		p.printText(msg)
+	}
+}
+
+// printText writes msg in the default colored format.
+func (p *Printer) printText(msg message.Message) {
+	// Line 1: [TW] [ROLE] username • [◆ amount •] [#channel •] HH:MM:SS
+	// Line 2:     message content (indented), after "↳ replying to X"
+	//             for replies
 	// Line 3: thin separator
-	var platformStr string
-	switch msg.Platform {
-	case message.Twitch:
-		platformStr = p.twitchColor.Sprint("[TTV]")
-	case message.YouTube:
-		platformStr = p.youtubeColor.Sprint("[YT_]")
-	case message.HackrTV:
-		platformStr = p.hackrtvColor.Sprint("[HTV]")
-	}
-
-	timestamp := p.dimColor.Sprint(msg.Timestamp.Local().Format("15:04:05"))
-
-	// Line 1: header
-	fmt.Fprintf(os.Stdout, "%s %s %s %s\n",
-		platformStr,
-		p.usernameColor.Sprint(msg.Username),
-		p.dimColor.Sprint("•"),
-		timestamp,
-	)
-	// Line 2: indented message
-	fmt.Fprintf(os.Stdout, "    %s\n", msg.Content)
+	// Notices are one line instead, see printNotice.
+	platformStr := platformColor(msg.Platform).Sprint("[" + msg.Platform.DisplayLabel() + "]")
+
+	timestamp := p.dimColor.Sprint(p.timestamps.Format(msg.Timestamp))
+	if IsNotice(msg.Type) {
+		p.printNotice(msg, platformStr, timestamp)
+		return
+	}
+
+	// Line 1: header, with the cheer/Super Chat amount and the source
+	// channel when present
+	header := []string{platformStr}
+	if badge := p.roleBadge(msg.Role); badge != "" {
+		header = append(header, badge)
+	}
+	header = append(header, p.usernameColor.Sprint(msg.Username))
+	if !msg.Amount.IsZero() {
+		header = append(header, p.dimColor.Sprint("•"), p.amountColor.Sprint("◆ "+i18n.Amount(msg.Amount)))
+		// Foreign amounts also show their value in the base currency
+		if n := msg.Normalized; !n.IsZero() && n.Currency != msg.Amount.Currency {
+			header = append(header, p.dimColor.Sprint("(≈ "+n.Display+")"))
+		}
+	}
+	if msg.Channel != "" {
+		header = append(header, p.dimColor.Sprint("•"), p.dimColor.Sprint("#"+msg.Channel))
+	}
+	header = append(header, p.dimColor.Sprint("•"), timestamp)
+	fmt.Fprintln(p.out, strings.Join(header, " "))
+	// Line 2: indented message, wrapped to the terminal; events are
+	// marked and highlighted, chat mentioning a highlight keyword is
+	// picked out, paid messages (cheers, Super Chats) stand out in the
+	// amount color, and emotes in chat are set apart
+	width := p.contentWidth()
+	if msg.ReplyToUser != "" {
+		p.printIndented(p.dimColor, "↳ "+i18n.T(i18n.ReplyingTo, msg.ReplyToUser), width)
+	}
+	switch {
+	case msg.IsEvent():
+		p.printIndented(p.typeColor(msg.Type), eventMarker(msg.Type)+" "+msg.Content, width)
+	case p.highlights.Match(msg):
+		p.printIndented(p.highlightColor, msg.Content, width)
+	case !msg.Amount.IsZero():
+		p.printContent(p.amountColor, msg.Content, msg.Emotes, width)
+	default:
+		p.printContent(nil, msg.Content, msg.Emotes, width)
+	}
+	// Link previews, one dim line each
+	for _, pv := range msg.Previews {
+		p.printIndented(p.dimColor, "↳ "+pv.Title, width)
+	}
 	// Line 3: thin separator
-	fmt.Fprintln(os.Stdout, p.dimColor.Sprint("────────────────────────────────"))
+	fmt.Fprintln(p.out, p.dimColor.Sprint("────────────────────────────────"))
 }
 
+// Filter returns the printer's live mute/solo state.
+func (p *Printer) Filter() *Filter {
+	return p.filter
+}
+
+// Run prints every message the filter allows until messages is closed.
 func (p *Printer) Run(messages <-chan message.Message) {
 	for msg := range messages {
+		p.Handle(msg)
+	}
+}
+
+// Handle prints msg if the filter allows it.
+func (p *Printer) Handle(msg message.Message) {
+	if p.filter.Allows(msg) {
 		p.Print(msg)
 	}
 }
+
+// roleBadge renders the badge for role, or "" when there is none.
+func (p *Printer) roleBadge(role string) string {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role == "" {
+		return ""
+	}
+	if b, ok := roleBadges[role]; ok {
+		return b.color.Sprint("[" + b.tag + "]")
+	}
+	tag := []rune(strings.ToUpper(role))
+	if len(tag) > 3 {
+		tag = tag[:3]
+	}
+	return p.dimColor.Sprint("[" + string(tag) + "]")
+}
+
+// IsNotice reports whether events of type t are notices about the chat,
+// such as deletions, edits, and platform notices, rather than something
+// that happened in it. The display gives notices one quiet line instead
+// of a message's block.
+func IsNotice(t message.Type) bool {
+	return t == message.TypeDeletion || t == message.TypeEdit || t == message.TypeSystem
+}
+
+// printNotice writes a notice on one line, its content named before the
+// channel and time as no sender is shown:
+//
+//	[TTV] ✖ message from bob deleted • #xqc • 14:30:45
+func (p *Printer) printNotice(msg message.Message, platformStr, timestamp string) {
+	line := []string{platformStr, p.typeColor(msg.Type).Sprint(eventMarker(msg.Type) + " " + msg.Content)}
+	if msg.Channel != "" {
+		line = append(line, p.dimColor.Sprint("•"), p.dimColor.Sprint("#"+msg.Channel))
+	}
+	line = append(line, p.dimColor.Sprint("•"), timestamp)
+	fmt.Fprintln(p.out, strings.Join(line, " "))
+}
+
+// typeColor returns the color of an event of type t.
+func (p *Printer) typeColor(t message.Type) *color.Color {
+	if c, ok := eventColors[t]; ok {
+		return c
+	}
+	return p.eventColor
+}
+
+// eventMarker returns the glyph that prefixes an event line.
+func eventMarker(t message.Type) string {
+	switch t {
+	case message.TypeDeletion:
+		return "✖"
+	case message.TypeEdit:
+		return "✎"
+	case message.TypeSystem:
+		return "»"
+	case message.TypeHype:
+		return "▲"
+	}
+	return "★"
+}
+
+// platformColor returns the bold tag color for a platform's color hint,
+// or plain bold when the hint is unknown.
+func platformColor(p message.Platform) *color.Color {
+	if attr, ok := colorHints[p.Color()]; ok {
+		return color.New(attr, color.Bold)
+	}
+	return color.New(color.Bold)
+}
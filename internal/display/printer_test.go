@@ -2,12 +2,13 @@ package display
 
 import (
 	"bytes"
-	"os"
+	"io"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/fatih/color"
+	"relay/internal/i18n"
 	"relay/internal/message"
 )
 
@@ -16,18 +17,13 @@ func init() {
 	color.NoColor = true
 }
 
+// capturePrint prints msg with p's settings and returns the output.
 func capturePrint(p *Printer, msg message.Message) string {
-	old := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-
-	p.Print(msg)
-
-	w.Close()
-	os.Stdout = old
-
 	var buf bytes.Buffer
-	buf.ReadFrom(r)
+	out := p.out
+	p.out = &buf
+	p.Print(msg)
+	p.out = out
 	return buf.String()
 }
 
@@ -123,8 +119,207 @@ func TestPrintOutputFormat(t *testing.T) {
 	}
 }
 
-func TestRun(t *testing.T) {
+func TestPrintDisplayLabel(t *testing.T) {
+	message.SetDisplayLabel(message.HackrTV, "⚡HTV")
+	t.Cleanup(func() { message.SetDisplayLabel(message.HackrTV, "HTV") })
+
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.HackrTV,
+		Username:  "xeraen",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "hi",
+	})
+
+	if !strings.Contains(output, "[⚡HTV]") {
+		t.Errorf("expected display label tag, got: %s", output)
+	}
+}
+
+func TestPrintEvent(t *testing.T) {
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.Twitch,
+		Type:      message.TypeRaid,
+		Username:  "raider",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "15 raiders from raider have joined!",
+	})
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), output)
+	}
+	if lines[1] != "    ★ 15 raiders from raider have joined!" {
+		t.Errorf("line 2 = %q, want starred event content", lines[1])
+	}
+}
+
+func TestPrintDeletion(t *testing.T) {
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.Twitch,
+		Type:      message.TypeDeletion,
+		Username:  "ronni",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local),
+		Content:   "ronni timed out for 350s",
+	})
+
+	// Notices take one line, without a separator
+	if output != "[TTV] ✖ ronni timed out for 350s • 14:30:45\n" {
+		t.Errorf("expected a one-line deletion notice, got: %q", output)
+	}
+}
+
+func TestPrintEventColors(t *testing.T) {
+	color.NoColor = false
+	defer func() { color.NoColor = true }()
+
+	p := NewPrinter()
+	sub := capturePrint(p, message.Message{Platform: message.YouTube, Type: message.TypeSub, Username: "fan", Content: "fan became a member"})
+	raid := capturePrint(p, message.Message{Platform: message.Twitch, Type: message.TypeRaid, Username: "raider", Content: "15 raiders"})
+	if !strings.Contains(sub, eventColors[message.TypeSub].Sprint("★ fan became a member")) {
+		t.Errorf("sub = %q, want it in the sub color", sub)
+	}
+	if !strings.Contains(raid, eventColors[message.TypeRaid].Sprint("★ 15 raiders")) {
+		t.Errorf("raid = %q, want it in the raid color", raid)
+	}
+}
+
+func TestPrintRoleBadge(t *testing.T) {
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"admin", "[HTV] [ADM] xeraen •"},
+		{"Moderator", "[HTV] [MOD] xeraen •"},
+		{"operative", "[HTV] [OPR] xeraen •"},
+		{"ghost", "[HTV] [GHO] xeraen •"},
+		{"", "[HTV] xeraen •"},
+	}
+	for _, tt := range tests {
+		p := NewPrinter()
+		output := capturePrint(p, message.Message{
+			Platform:  message.HackrTV,
+			Username:  "xeraen",
+			Role:      tt.role,
+			Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+			Content:   "hello grid",
+		})
+		if !strings.HasPrefix(output, tt.want) {
+			t.Errorf("role %q: got %q, want prefix %q", tt.role, output, tt.want)
+		}
+	}
+}
+
+func TestPrintPreviews(t *testing.T) {
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.Twitch,
+		Username:  "viewer",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "look https://example.com/post",
+		Previews:  []message.Preview{{URL: "https://example.com/post", Title: "A Post"}},
+	})
+
+	if !strings.Contains(output, "    look https://example.com/post\n    ↳ A Post\n") {
+		t.Errorf("expected preview line after content, got: %s", output)
+	}
+}
+
+func TestPrintEdit(t *testing.T) {
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.HackrTV,
+		Type:      message.TypeEdit,
+		Username:  "xeraen",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "message from xeraen edited: hello grid",
+	})
+
+	if !strings.Contains(output, "[HTV] ✎ message from xeraen edited: hello grid • ") {
+		t.Errorf("expected edit marker, got: %s", output)
+	}
+}
+
+func TestPrintHype(t *testing.T) {
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.Relay,
+		Type:      message.TypeHype,
+		Username:  "hype",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "chat is popping off: 42 messages in 10s (6.0× normal)",
+	})
+
+	if !strings.Contains(output, "[RLY] hype") || !strings.Contains(output, "    ▲ chat is popping off") {
+		t.Errorf("expected relay hype line, got: %s", output)
+	}
+}
+
+func TestPrintAmount(t *testing.T) {
 	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.Twitch,
+		Username:  "bob",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC),
+		Content:   "Cheer100 gg",
+		Amount:    message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"},
+	})
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	if !strings.Contains(lines[0], "◆ 100 bits") {
+		t.Errorf("line 1 missing amount: %q", lines[0])
+	}
+	if lines[1] != "    Cheer100 gg" {
+		t.Errorf("line 2 = %q, want the content", lines[1])
+	}
+}
+
+func TestPrintLocale(t *testing.T) {
+	if err := i18n.Set("de"); err != nil {
+		t.Fatal(err)
+	}
+	defer i18n.Set(i18n.DefaultTag)
+
+	p := NewPrinter()
+	output := capturePrint(p, message.Message{
+		Platform:  message.YouTube,
+		Username:  "ytuser",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local),
+		Content:   "danke",
+		Amount:    message.Amount{Value: 1234.5, Currency: "EUR", Display: "€1,234.50"},
+	})
+
+	if !strings.Contains(output, "◆ 1.234,50 €") {
+		t.Errorf("expected German amount format, got: %s", output)
+	}
+	if !strings.Contains(output, "14:30:45") {
+		t.Errorf("expected 24-hour timestamp, got: %s", output)
+	}
+}
+
+func TestPrintChannel(t *testing.T) {
+	p := NewPrinter()
+	msg := message.Message{
+		Platform:  message.Twitch,
+		Channel:   "xqc",
+		Username:  "someone",
+		Timestamp: time.Date(2025, 6, 1, 9, 5, 3, 0, time.UTC),
+		Content:   "test content",
+	}
+
+	output := capturePrint(p, msg)
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	if !strings.Contains(lines[0], "#xqc") {
+		t.Errorf("line 1 missing source channel: %q", lines[0])
+	}
+}
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrinterTo(&buf)
 	ch := make(chan message.Message, 2)
 
 	ch <- message.Message{
@@ -141,21 +336,74 @@ func TestRun(t *testing.T) {
 	}
 	close(ch)
 
-	// Capture stdout
-	old := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-
 	p.Run(ch)
+	output := buf.String()
 
-	w.Close()
-	os.Stdout = old
+	if !strings.Contains(output, "msg1") || !strings.Contains(output, "msg2") {
+		t.Errorf("Run should print all messages, got: %s", output)
+	}
+}
 
+func TestRunHonorsFilter(t *testing.T) {
 	var buf bytes.Buffer
-	buf.ReadFrom(r)
+	p := NewPrinterTo(&buf)
+	p.Filter().Mute(Target{Platform: message.Twitch})
+
+	ch := make(chan message.Message, 2)
+	ch <- message.Message{Platform: message.Twitch, Username: "a", Content: "muted msg"}
+	ch <- message.Message{Platform: message.HackrTV, Username: "b", Content: "shown msg"}
+	close(ch)
+
+	p.Run(ch)
 	output := buf.String()
 
-	if !strings.Contains(output, "msg1") || !strings.Contains(output, "msg2") {
-		t.Errorf("Run should print all messages, got: %s", output)
+	if strings.Contains(output, "muted msg") {
+		t.Errorf("muted platform should not print, got: %s", output)
+	}
+	if !strings.Contains(output, "shown msg") {
+		t.Errorf("unmuted platform should print, got: %s", output)
+	}
+}
+
+func BenchmarkPrint(b *testing.B) {
+	p := NewPrinterTo(io.Discard)
+	for b.Loop() {
+		p.Print(benchMessage)
+	}
+}
+
+func BenchmarkPrintWrapped(b *testing.B) {
+	p := NewPrinterTo(io.Discard)
+	p.SetWidth(40)
+	for b.Loop() {
+		p.Print(benchMessage)
+	}
+}
+
+func TestPrintHighlightBell(t *testing.T) {
+	mention := message.Message{Platform: message.Twitch, Username: "viewer", Content: "@mychannel what keyboard is that?"}
+	other := message.Message{Platform: message.Twitch, Username: "viewer", Content: "gg"}
+	h := NewHighlights([]string{"@mychannel"})
+
+	p := NewPrinter()
+	p.SetHighlights(h, true)
+	if output := capturePrint(p, mention); !strings.HasPrefix(output, "\a") || !strings.Contains(output, "    @mychannel what keyboard is that?") {
+		t.Errorf("highlighted output = %q, want a bell and the content", output)
+	}
+	if output := capturePrint(p, other); strings.Contains(output, "\a") {
+		t.Errorf("output = %q, rang the bell for chat that isn't highlighted", output)
+	}
+
+	// Without the bell, highlighting is only visual
+	p.SetHighlights(h, false)
+	if output := capturePrint(p, mention); strings.Contains(output, "\a") {
+		t.Errorf("output = %q, rang the bell with it off", output)
+	}
+
+	// JSON output is for machines, which have no bell
+	p = NewJSONPrinter()
+	p.SetHighlights(h, true)
+	if output := capturePrint(p, mention); strings.Contains(output, "\a") {
+		t.Errorf("JSON output = %q, rang the bell", output)
 	}
 }
@@ -0,0 +1,143 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"relay/internal/message"
+)
+
+// Status writes the relay's own status lines, such as connection banners
+// and the session summary, tagged and colored like chat so each source's
+// lines are easy to pick out.
+type Status struct {
+	mu        sync.Mutex
+	out       io.Writer
+	dimColor  *color.Color
+	markColor *color.Color
+	warnColor *color.Color
+}
+
+// NewStatus returns a status writer for stderr, keeping stdout to chat.
+func NewStatus() *Status {
+	return NewStatusTo(stderr{})
+}
+
+// stderr writes to os.Stderr as it is at each write, so status lines
+// follow it when the TUI takes stderr over.
+type stderr struct{}
+
+func (stderr) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+// NewStatusTo returns a status writer for w.
+func NewStatusTo(w io.Writer) *Status {
+	return &Status{
+		out:       w,
+		dimColor:  color.New(color.FgHiBlack),
+		markColor: color.New(color.FgGreen, color.Bold),
+		warnColor: color.New(color.FgRed, color.Bold),
+	}
+}
+
+// Banner prints a status line for platform p, e.g.
+// "[TTV] ● Connecting to channels: xqc".
+func (s *Status) Banner(p message.Platform, format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "%s %s %s\n", s.tag(p), s.markColor.Sprint("●"), fmt.Sprintf(format, args...))
+}
+
+// Warning prints a warning that mustn't be missed, between red rules:
+//
+//	━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+//	[RLY] ▲ SAFE MODE: the relay crashed 3 times in 10m
+//	[RLY]   Only chat display is running.
+//	━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+func (s *Status) Warning(p message.Platform, title string, lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rule := s.warnColor.Sprint(strings.Repeat("━", 60))
+	fmt.Fprintln(s.out, rule)
+	fmt.Fprintf(s.out, "%s %s\n", s.tag(p), s.warnColor.Sprint("▲ "+title))
+	for _, line := range lines {
+		fmt.Fprintf(s.out, "%s   %s\n", s.tag(p), line)
+	}
+	fmt.Fprintln(s.out, rule)
+}
+
+// SourceSummary is one platform's share of a session.
+type SourceSummary struct {
+	Platform message.Platform
+	// Messages counts everything the platform's sources produced.
+	Messages int64
+	// Reconnects counts connections re-established, or requests retried,
+	// after a failure.
+	Reconnects int64
+}
+
+// Summary accounts for a session at shutdown.
+type Summary struct {
+	Uptime  time.Duration
+	Sources []SourceSummary
+	// Dropped is how many messages each sink discarded, by sink name.
+	// Sinks that dropped nothing are left out of the summary.
+	Dropped map[string]int64
+}
+
+// Summary prints the session summary:
+//
+//	── Session summary ──
+//	Uptime 1h2m3s
+//	[TTV] 1234 messages
+//	[HTV] 78 messages, 1 reconnect
+//	Dropped: uplink 12
+func (s *Status) Summary(sum Summary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.out, s.dimColor.Sprint("── Session summary ──"))
+	fmt.Fprintf(s.out, "Uptime %s\n", sum.Uptime.Round(time.Second))
+	for _, src := range sum.Sources {
+		line := plural(src.Messages, "message")
+		if src.Reconnects > 0 {
+			line += ", " + plural(src.Reconnects, "reconnect")
+		}
+		fmt.Fprintf(s.out, "%s %s\n", s.tag(src.Platform), line)
+	}
+	if len(sum.Sources) == 0 {
+		fmt.Fprintln(s.out, "No messages")
+	}
+
+	var dropped []string
+	for _, name := range slices.Sorted(maps.Keys(sum.Dropped)) {
+		if n := sum.Dropped[name]; n > 0 {
+			dropped = append(dropped, fmt.Sprintf("%s %d", name, n))
+		}
+	}
+	if len(dropped) == 0 {
+		fmt.Fprintln(s.out, "Dropped: none")
+	} else {
+		fmt.Fprintf(s.out, "Dropped: %s\n", strings.Join(dropped, ", "))
+	}
+}
+
+// tag renders p's display label in its color, e.g. "[TTV]".
+func (s *Status) tag(p message.Platform) string {
+	return platformColor(p).Sprint("[" + p.DisplayLabel() + "]")
+}
+
+// plural formats n with noun, adding an "s" unless n is 1.
+func plural(n int64, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
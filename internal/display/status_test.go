@@ -0,0 +1,55 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestStatusBanner(t *testing.T) {
+	var buf bytes.Buffer
+	NewStatusTo(&buf).Banner(message.Twitch, "Connecting to channels: %s", "xqc")
+	if got, want := buf.String(), "[TTV] ● Connecting to channels: xqc\n"; got != want {
+		t.Errorf("Banner() = %q, want %q", got, want)
+	}
+}
+
+func TestStatusWarning(t *testing.T) {
+	var buf bytes.Buffer
+	NewStatusTo(&buf).Warning(message.Relay, "SAFE MODE", "Only chat display is running.")
+	rule := strings.Repeat("━", 60) + "\n"
+	want := rule + "[RLY] ▲ SAFE MODE\n[RLY]   Only chat display is running.\n" + rule
+	if got := buf.String(); got != want {
+		t.Errorf("Warning() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestStatusSummary(t *testing.T) {
+	var buf bytes.Buffer
+	NewStatusTo(&buf).Summary(Summary{
+		Uptime: time.Hour + 2*time.Minute + 3400*time.Millisecond,
+		Sources: []SourceSummary{
+			{Platform: message.Twitch, Messages: 1234},
+			{Platform: message.HackrTV, Messages: 1, Reconnects: 2},
+		},
+		Dropped: map[string]int64{"uplink": 12, "printer": 0, "replies": 1},
+	})
+	want := `── Session summary ──
+Uptime 1h2m3s
+[TTV] 1234 messages
+[HTV] 1 message, 2 reconnects
+Dropped: replies 1, uplink 12
+`
+	if buf.String() != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	NewStatusTo(&buf).Summary(Summary{})
+	if want := "── Session summary ──\nUptime 0s\nNo messages\nDropped: none\n"; buf.String() != want {
+		t.Errorf("empty Summary() = %q, want %q", buf.String(), want)
+	}
+}
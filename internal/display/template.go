@@ -0,0 +1,129 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fatih/color"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+// TemplateData is what an output template is executed with.
+type TemplateData struct {
+	// Platform is the display label, e.g. "TTV".
+	Platform string
+	// Color is the platform's color hint, e.g. "magenta", for
+	// {{color .Color .Platform}}.
+	Color string
+	// Type is "chat" or the event's type, e.g. "sub" or "deletion".
+	Type string
+	// Event is set for subs, raids, deletions, and other non-chat
+	// messages.
+	Event    bool
+	Role     string
+	Username string
+	// Channel is the source channel, when known.
+	Channel string
+	Content string
+	// Amount is a cheer or Super Chat's amount, e.g. "100 bits", or
+	// empty.
+	Amount string
+	// Timestamp is when the message was sent, in the display's timezone
+	// (local time by default), e.g. for {{.Timestamp.Format "15:04"}}.
+	Timestamp time.Time
+	// Time is Timestamp as the default format shows it, in the
+	// timestamp format or the locale's.
+	Time string
+}
+
+// templateFuncs are the color helpers, e.g. {{cyan .Username}} or
+// {{.Content | bold}}. They print plain text when color is off.
+var templateFuncs = func() template.FuncMap {
+	funcs := template.FuncMap{
+		"dim":  color.New(color.FgHiBlack).SprintFunc(),
+		"bold": color.New(color.Bold).SprintFunc(),
+		// color applies a color hint by name, so {{color .Color .Platform}}
+		// matches the platform's color
+		"color": func(hint string, a ...any) string {
+			if attr, ok := colorHints[hint]; ok {
+				return color.New(attr).Sprint(a...)
+			}
+			return fmt.Sprint(a...)
+		},
+	}
+	for name, attr := range colorHints {
+		funcs[name] = color.New(attr).SprintFunc()
+	}
+	return funcs
+}()
+
+// templateSample checks a template against every field at parse time.
+var templateSample = message.Message{
+	Platform:  message.Twitch,
+	Username:  "viewer",
+	Channel:   "channel",
+	Content:   "hello",
+	Timestamp: time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC),
+	Amount:    message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"},
+}
+
+// NewTemplatePrinter returns a printer that writes each message to
+// stdout as a text/template over TemplateData renders it.
+func NewTemplatePrinter(text string) (*Printer, error) {
+	return NewTemplatePrinterTo(os.Stdout, text)
+}
+
+// NewTemplatePrinterTo returns a template printer that writes to w. It
+// reports syntax errors and unknown fields or functions.
+func NewTemplatePrinterTo(w io.Writer, text string) (*Printer, error) {
+	t, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("output template: %w", err)
+	}
+	if err := t.Execute(io.Discard, newTemplateData(templateSample, Timestamps{})); err != nil {
+		return nil, fmt.Errorf("output template: %w", err)
+	}
+	p := NewPrinterTo(w)
+	p.tmpl = t
+	return p, nil
+}
+
+// printTemplate writes msg with the printer's template, ending it with a
+// newline unless the template does. It reports false, writing nothing,
+// when the template fails so the default format is used instead.
+func (p *Printer) printTemplate(msg message.Message) bool {
+	var b strings.Builder
+	if err := p.tmpl.Execute(&b, newTemplateData(msg, p.timestamps)); err != nil {
+		return false
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	io.WriteString(p.out, out)
+	return true
+}
+
+func newTemplateData(msg message.Message, ts Timestamps) TemplateData {
+	d := TemplateData{
+		Platform:  msg.Platform.DisplayLabel(),
+		Color:     msg.Platform.Color(),
+		Type:      msg.Type.String(),
+		Event:     msg.IsEvent(),
+		Role:      msg.Role,
+		Username:  msg.Username,
+		Channel:   msg.Channel,
+		Content:   msg.Content,
+		Timestamp: ts.In(msg.Timestamp),
+		Time:      ts.Format(msg.Timestamp),
+	}
+	if !msg.Amount.IsZero() {
+		d.Amount = i18n.Amount(msg.Amount)
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+package display
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestTemplatePrinter(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := NewTemplatePrinterTo(&buf, `{{color .Color .Platform}} {{cyan .Username}}{{with .Channel}} #{{.}}{{end}} {{.Timestamp.Format "15:04"}}: {{if .Event}}{{bold .Content}}{{else}}{{.Content}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2025, 1, 15, 14, 30, 0, 0, time.Local)
+	p.Handle(message.Message{Platform: message.Twitch, Channel: "xqc", Username: "viewer", Content: "hello chat", Timestamp: ts})
+	p.Handle(message.Message{Platform: message.YouTube, Type: message.TypeSub, Username: "fan", Content: "fan became a member", Timestamp: ts})
+	want := "TTV viewer #xqc 14:30: hello chat\nYT_ fan 14:30: fan became a member\n"
+	if buf.String() != want {
+		t.Errorf("output =\n%q\nwant\n%q", buf.String(), want)
+	}
+
+	// Mutes apply as they do to the default format
+	buf.Reset()
+	p.Filter().Mute(Target{Platform: message.Twitch})
+	p.Handle(message.Message{Platform: message.Twitch, Content: "hidden"})
+	if buf.Len() != 0 {
+		t.Errorf("muted message was written: %q", buf.String())
+	}
+}
+
+func TestTemplatePrinterKeepsNewline(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := NewTemplatePrinterTo(&buf, "{{.Username}}\n  {{.Content}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Print(message.Message{Platform: message.HackrTV, Username: "xeraen", Content: "hi"})
+	if buf.String() != "xeraen\n  hi\n" {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestTemplatePrinterRejectsBadTemplates(t *testing.T) {
+	for _, text := range []string{
+		"{{.Username",          // syntax
+		"{{.Nickname}}",        // unknown field
+		"{{sparkle .Content}}", // unknown function
+	} {
+		if _, err := NewTemplatePrinterTo(&bytes.Buffer{}, text); err == nil {
+			t.Errorf("NewTemplatePrinterTo(%q) succeeded, want an error", text)
+		}
+	}
+}
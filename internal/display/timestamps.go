@@ -0,0 +1,96 @@
+package display
+
+import (
+	"fmt"
+	"time"
+
+	"relay/internal/i18n"
+)
+
+// TimestampsRelative is the Timestamps layout that shows how long ago
+// each message was sent, e.g. "2m ago". Only the TUI, which redraws, can
+// keep it current; printed lines show the locale's clock time instead.
+const TimestampsRelative = "relative"
+
+// Timestamps is how the display shows when messages were sent. The zero
+// value shows the locale's clock time (i18n.Time) in local time.
+type Timestamps struct {
+	// Layout is a time.Format layout such as "15:04" or
+	// "2006-01-02 15:04:05", or TimestampsRelative. Empty uses the
+	// locale's.
+	Layout string
+	// Location is the zone times are shown in. Nil is local time.
+	Location *time.Location
+}
+
+// ParseTimestamps checks a timestamp layout and a zone name, "UTC",
+// "Local", or an IANA name such as "America/New_York", from the config.
+// Empty strings keep the defaults.
+func ParseTimestamps(layout, zone string) (Timestamps, error) {
+	ts := Timestamps{Layout: layout}
+	// A layout with no time fields would print itself for every message
+	ref := time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)
+	if layout != "" && layout != TimestampsRelative && ref.Format(layout) == layout {
+		return Timestamps{}, fmt.Errorf("timestamp format %q has no time fields; use a Go layout such as \"15:04\" or %q", layout, TimestampsRelative)
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return Timestamps{}, fmt.Errorf("timezone %q: %v", zone, err)
+		}
+		ts.Location = loc
+	}
+	return ts, nil
+}
+
+// Relative reports whether times are shown as how long ago they were.
+func (ts Timestamps) Relative() bool {
+	return ts.Layout == TimestampsRelative
+}
+
+// In returns t in the display's zone.
+func (ts Timestamps) In(t time.Time) time.Time {
+	if ts.Location == nil {
+		return t.Local()
+	}
+	return t.In(ts.Location)
+}
+
+// Format renders t as the clock time the display shows, in its zone and
+// layout. A relative layout formats as the locale's.
+func (ts Timestamps) Format(t time.Time) string {
+	if ts.Layout == "" || ts.Relative() {
+		return i18n.Time(ts.In(t))
+	}
+	return ts.In(t).Format(ts.Layout)
+}
+
+// Ago renders how long before now t was, compactly and right-aligned to
+// seven columns so chat lines up as the times change: "    now",
+// "45s ago", " 2m ago", " 3h ago", " 2d ago".
+func Ago(t, now time.Time) string {
+	d := now.Sub(t)
+	var s string
+	switch {
+	case d < 5*time.Second:
+		s = "now"
+	case d < time.Minute:
+		s = fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		s = fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		s = fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		s = fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%7s", s)
+}
+
+// SetTimestamps sets how the text and template formats show when
+// messages were sent. The JSON output keeps RFC 3339 timestamps, only
+// moved to ts's zone.
+func (p *Printer) SetTimestamps(ts Timestamps) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timestamps = ts
+}
@@ -0,0 +1,85 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestParseTimestamps(t *testing.T) {
+	ts, err := ParseTimestamps("2006-01-02 15:04", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Layout != "2006-01-02 15:04" || ts.Location != time.UTC {
+		t.Errorf("ParseTimestamps() = %+v", ts)
+	}
+	if ts, err := ParseTimestamps("", ""); err != nil || ts != (Timestamps{}) {
+		t.Errorf("ParseTimestamps() of defaults = %+v, %v", ts, err)
+	}
+	if ts, err := ParseTimestamps(TimestampsRelative, ""); err != nil || !ts.Relative() {
+		t.Errorf("ParseTimestamps(relative) = %+v, %v", ts, err)
+	}
+	for _, bad := range [][2]string{{"HH:MM", ""}, {"", "Mars/Olympus_Mons"}} {
+		if _, err := ParseTimestamps(bad[0], bad[1]); err == nil {
+			t.Errorf("ParseTimestamps(%q, %q) accepted it", bad[0], bad[1])
+		}
+	}
+}
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{2 * time.Second, "    now"},
+		{45 * time.Second, "45s ago"},
+		{150 * time.Second, " 2m ago"},
+		{3 * time.Hour, " 3h ago"},
+		{50 * time.Hour, " 2d ago"},
+	}
+	for _, tt := range tests {
+		if got := Ago(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("Ago(%v) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestPrintTimestamps(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "hi", Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)}
+
+	p := NewPrinter()
+	p.SetTimestamps(Timestamps{Layout: "2006-01-02 15:04 MST", Location: cet})
+	if out := capturePrint(p, msg); !strings.Contains(out, "2025-01-15 15:30 CET") {
+		t.Errorf("output = %q, want the time in CET", out)
+	}
+	// Printed lines can't count up, so relative shows the clock time
+	p.SetTimestamps(Timestamps{Layout: TimestampsRelative, Location: time.UTC})
+	if out := capturePrint(p, msg); !strings.Contains(out, "14:30:45") {
+		t.Errorf("relative output = %q, want the clock time", out)
+	}
+
+	var buf bytes.Buffer
+	tp, err := NewTemplatePrinterTo(&buf, `{{.Time}} {{.Timestamp.Format "15:04 MST"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp.SetTimestamps(Timestamps{Layout: "3:04PM", Location: cet})
+	tp.Print(msg)
+	if got, want := buf.String(), "3:30PM 15:30 CET\n"; got != want {
+		t.Errorf("template output = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	jp := NewJSONPrinterTo(&buf)
+	jp.SetTimestamps(Timestamps{Location: cet})
+	jp.Print(msg)
+	if !strings.Contains(buf.String(), `"timestamp":"2025-01-15T15:30:45+01:00"`) {
+		t.Errorf("JSON output = %s, want the timestamp in CET", buf.String())
+	}
+}
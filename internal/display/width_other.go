@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package display
+
+import "io"
+
+// terminalWidth can't read the terminal's size here, so content is only
+// wrapped at a configured width.
+func terminalWidth(w io.Writer) int {
+	return 0
+}
@@ -0,0 +1,139 @@
+package display
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// indent starts every line under a message's header.
+	indent = "    "
+	// minWrapWidth is the narrowest content column worth wrapping to;
+	// below it lines are left for the terminal to break.
+	minWrapWidth = 20
+)
+
+// SetWidth wraps message content at cols columns. 0, the default, uses
+// the width of the terminal the printer writes to, read for each message
+// so resizes apply, and doesn't wrap when it isn't a terminal. A negative
+// width never wraps. JSON and template output are never wrapped.
+func (p *Printer) SetWidth(cols int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.width = cols
+}
+
+// contentWidth returns the columns available after the indent, or 0 when
+// content isn't wrapped.
+func (p *Printer) contentWidth() int {
+	width := p.width
+	if width == 0 {
+		width = terminalWidth(p.out)
+	}
+	width -= len(indent)
+	if width < minWrapWidth {
+		return 0
+	}
+	return width
+}
+
+// printIndented writes text under the header in c (plain when nil),
+// wrapped to width columns with each line indented.
+func (p *Printer) printIndented(c *color.Color, text string, width int) {
+	for _, line := range Wrap(text, width) {
+		if c != nil {
+			line = c.Sprint(line)
+		}
+		io.WriteString(p.out, indent+line+"\n")
+	}
+}
+
+// Wrap breaks text into lines of at most width columns, at spaces where
+// it can and inside words longer than a line. Line breaks in text are
+// kept. width 0 returns text as one line.
+func Wrap(text string, width int) []string {
+	if width <= 0 {
+		return []string{text}
+	}
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		if stringWidth(para) <= width {
+			lines = append(lines, para)
+			continue
+		}
+		var line strings.Builder
+		lineWidth := 0
+		for _, word := range strings.Fields(para) {
+			w := stringWidth(word)
+			if lineWidth > 0 && lineWidth+1+w <= width {
+				line.WriteByte(' ')
+				line.WriteString(word)
+				lineWidth += 1 + w
+				continue
+			}
+			if lineWidth > 0 {
+				lines = append(lines, line.String())
+				line.Reset()
+				lineWidth = 0
+			}
+			// A word wider than a line is cut at the width
+			for w > width {
+				head, rest := cutWidth(word, width)
+				lines = append(lines, head)
+				word, w = rest, stringWidth(rest)
+			}
+			line.WriteString(word)
+			lineWidth = w
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// cutWidth splits s after as many runes as fit in width columns, and at
+// least one.
+func cutWidth(s string, width int) (head, rest string) {
+	used := 0
+	for i, r := range s {
+		w := runeWidth(r)
+		if used+w > width && i > 0 {
+			return s[:i], s[i:]
+		}
+		used += w
+	}
+	return s, ""
+}
+
+// stringWidth returns the columns s takes in a terminal.
+func stringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the columns r takes: none for combining marks,
+// variation selectors, and zero-width characters, two for East Asian wide
+// characters and emoji, and one otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cc, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f, // CJK through Yi
+		r >= 0xac00 && r <= 0xd7a3,                // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff,                // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f,                // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60,                // fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // emoji and pictographs
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd: // CJK extensions
+		return 2
+	}
+	return 1
+}
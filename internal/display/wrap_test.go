@@ -0,0 +1,55 @@
+package display
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"short enough", 20, []string{"short enough"}},
+		{"the quick brown fox jumps over the lazy dog", 15, []string{"the quick brown", "fox jumps over", "the lazy dog"}},
+		{"see https://example.com/a/very/long/path ok", 12, []string{"see", "https://exam", "ple.com/a/ve", "ry/long/path", "ok"}},
+		{"first line\nsecond line", 20, []string{"first line", "second line"}},
+		{"日本語のチャットです", 8, []string{"日本語の", "チャット", "です"}},
+		{"no wrapping at all", 0, []string{"no wrapping at all"}},
+	}
+	for _, tt := range tests {
+		if got := Wrap(tt.text, tt.width); !slices.Equal(got, tt.want) {
+			t.Errorf("Wrap(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestPrintWraps(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrinterTo(&buf)
+	p.SetWidth(30)
+	p.Print(message.Message{
+		Platform:  message.Twitch,
+		Username:  "viewer",
+		Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local),
+		Content:   "this message is too long to fit on one line",
+	})
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	want := []string{"    this message is too long", "    to fit on one line"}
+	if len(lines) < 3 || string(lines[1]) != want[0] || string(lines[2]) != want[1] {
+		t.Errorf("output =\n%s\nwant content lines %q", buf.String(), want)
+	}
+
+	// A buffer isn't a terminal, so the default doesn't wrap
+	buf.Reset()
+	p.SetWidth(0)
+	p.Print(message.Message{Platform: message.Twitch, Username: "viewer", Content: "this message is too long to fit on one line"})
+	if lines := bytes.Split(buf.Bytes(), []byte("\n")); string(lines[1]) != "    this message is too long to fit on one line" {
+		t.Errorf("output =\n%s\nwant the content unwrapped", buf.String())
+	}
+}
@@ -0,0 +1,133 @@
+// Package echo remembers the hackr.tv packets the bridge created, so the
+// hackr.tv reader can recognise them when they are broadcast back instead
+// of guessing from their content.
+package echo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// limit is how many packet IDs are remembered; the oldest are forgotten
+// first.
+const limit = 1000
+
+// Set holds the IDs of packets the bridge created, and tracks sends still
+// waiting for hackr.tv's answer. A nil *Set knows no packets. It is safe
+// for concurrent use.
+type Set struct {
+	mu    sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	// pending holds the sequence numbers of unanswered sends; next is the
+	// number the next send gets.
+	pending map[uint64]struct{}
+	next    uint64
+	// changed is closed, and replaced, whenever a send is answered.
+	changed chan struct{}
+	// unreported is set once hackr.tv accepts a packet without saying
+	// which ID it got.
+	unreported atomic.Bool
+}
+
+// New returns an empty set.
+func New() *Set {
+	return &Set{
+		ids:     make(map[string]struct{}),
+		pending: make(map[uint64]struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// Begin records a send about to be made. The returned function must be
+// called with its outcome: the created packet's ID, or "" with created
+// false when no packet was made.
+func (s *Set) Begin() (done func(id string, created bool)) {
+	if s == nil {
+		return func(string, bool) {}
+	}
+	s.mu.Lock()
+	seq := s.next
+	s.next++
+	s.pending[seq] = struct{}{}
+	s.mu.Unlock()
+
+	return func(id string, created bool) {
+		if created && id == "" {
+			s.unreported.Store(true)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.pending, seq)
+		if id != "" {
+			s.add(id)
+		}
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+}
+
+// add remembers id, forgetting the oldest ID once the set is full.
+// Callers hold mu.
+func (s *Set) add(id string) {
+	if _, ok := s.ids[id]; ok {
+		return
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > limit {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Echo reports whether the packet with the given ID was created by the
+// bridge. A broadcast can arrive before the send that created it has been
+// answered, so while sends begun before the call are unanswered it waits
+// for them, up to wait.
+func (s *Set) Echo(id string, wait time.Duration) bool {
+	if s == nil {
+		return false
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	s.mu.Lock()
+	before := s.next
+	for {
+		if _, ok := s.ids[id]; ok {
+			s.mu.Unlock()
+			return true
+		}
+		if !s.waiting(before) {
+			s.mu.Unlock()
+			return false
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return false
+		}
+		s.mu.Lock()
+	}
+}
+
+// waiting reports whether any send numbered below before is unanswered.
+// Callers hold mu.
+func (s *Set) waiting(before uint64) bool {
+	for seq := range s.pending {
+		if seq < before {
+			return true
+		}
+	}
+	return false
+}
+
+// Unreported reports whether hackr.tv has accepted a packet without
+// returning its ID, in which case echoes can't be told apart by ID.
+func (s *Set) Unreported() bool {
+	return s == nil || s.unreported.Load()
+}
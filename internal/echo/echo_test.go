@@ -0,0 +1,70 @@
+package echo
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetRemembersCreatedPackets(t *testing.T) {
+	s := New()
+	s.Begin()("42", true)
+	s.Begin()("", false)
+	if !s.Echo("42", 0) {
+		t.Error("Echo(42) = false, want the created packet recognised")
+	}
+	if s.Echo("43", 0) {
+		t.Error("Echo(43) = true for a packet the bridge didn't create")
+	}
+	if s.Unreported() {
+		t.Error("Unreported() = true though every created packet had an ID")
+	}
+	s.Begin()("", true)
+	if !s.Unreported() {
+		t.Error("Unreported() = false after a packet was created without an ID")
+	}
+
+	var none *Set
+	none.Begin()("1", true)
+	if none.Echo("1", 0) || !none.Unreported() {
+		t.Error("a nil Set should know no packets")
+	}
+}
+
+func TestSetWaitsForPendingSends(t *testing.T) {
+	s := New()
+	done := s.Begin()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		done("7", true)
+	}()
+	// The broadcast beat the API's answer
+	if !s.Echo("7", time.Second) {
+		t.Error("Echo(7) = false, want it to wait for the pending send")
+	}
+
+	// With nothing pending an unknown packet is answered at once
+	start := time.Now()
+	if s.Echo("8", time.Second) {
+		t.Error("Echo(8) = true for an unknown packet")
+	}
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("Echo waited %s with no sends pending", waited)
+	}
+
+	// A send that is never answered holds it up to the wait
+	s.Begin()
+	if s.Echo("9", 10*time.Millisecond) {
+		t.Error("Echo(9) = true for an unknown packet")
+	}
+}
+
+func TestSetForgetsOldest(t *testing.T) {
+	s := New()
+	for i := range limit + 1 {
+		s.Begin()(strconv.Itoa(i), true)
+	}
+	if s.Echo("0", 0) || !s.Echo(strconv.Itoa(limit), 0) {
+		t.Error("want the oldest ID forgotten and the newest kept")
+	}
+}
@@ -0,0 +1,402 @@
+// Package emote finds BetterTTV and 7TV emotes in Twitch chat. Twitch
+// marks its own emotes in each message's tags, but third-party emotes
+// are plain words that only viewers running a browser extension see as
+// pictures, so their names are looked up in the providers' emote sets:
+// the global sets, and each channel's own once its Twitch ID is known.
+package emote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+// Providers, as named in Options.Providers.
+const (
+	BetterTTV = "bttv"
+	SevenTV   = "7tv"
+)
+
+const (
+	// DefaultBetterTTVURL and DefaultSevenTVURL are the providers' APIs.
+	DefaultBetterTTVURL = "https://api.betterttv.net/3"
+	DefaultSevenTVURL   = "https://7tv.io/v3"
+
+	// bttvImageURL serves BetterTTV emote pictures by ID.
+	bttvImageURL = "https://cdn.betterttv.net/emote/"
+
+	defaultRefresh = time.Hour
+	// retryInterval is the wait before a failed set is fetched again.
+	retryInterval = 5 * time.Minute
+)
+
+// Options configures a Finder. The zero value looks nothing up.
+type Options struct {
+	// Providers lists the emote providers to look up, BetterTTV and/or
+	// SevenTV. An emote both have is taken from the first listed.
+	Providers []string
+	// ChannelID returns the Twitch user ID of a channel, or "" while it
+	// is unknown, in which case only global emotes are found there.
+	ChannelID func(channel string) string
+	// BetterTTVURL and SevenTVURL override the providers' APIs. Default
+	// to DefaultBetterTTVURL and DefaultSevenTVURL.
+	BetterTTVURL string
+	SevenTVURL   string
+	// Refresh is how long a fetched emote set is used before it is
+	// fetched again, picking up emotes a channel adds. Defaults to 1h.
+	Refresh time.Duration
+	// Clock expires emote sets. Defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Finder marks third-party emotes in Twitch messages.
+type Finder struct {
+	providers []string
+	channelID func(string) string
+	bttvURL   string
+	stvURL    string
+	refresh   time.Duration
+	http      *http.Client
+	clock     clock.Clock
+
+	mu sync.Mutex
+	// sets holds each channel's emotes, keyed by channel ID, with ""
+	// for the global emotes.
+	sets map[string]*emoteSet
+}
+
+// emoteSet is the emotes known for one channel, or the global ones.
+type emoteSet struct {
+	// emotes maps names to image URLs.
+	emotes  map[string]string
+	expires time.Time
+	loading bool
+}
+
+// New creates a Finder. It returns an error for an unknown provider.
+func New(opts Options) (*Finder, error) {
+	f := &Finder{
+		channelID: opts.ChannelID,
+		bttvURL:   strings.TrimRight(opts.BetterTTVURL, "/"),
+		stvURL:    strings.TrimRight(opts.SevenTVURL, "/"),
+		refresh:   opts.Refresh,
+		http:      &http.Client{Timeout: 10 * time.Second},
+		clock:     clock.Or(opts.Clock),
+		sets:      make(map[string]*emoteSet),
+	}
+	for _, p := range opts.Providers {
+		switch p = strings.ToLower(strings.TrimSpace(p)); p {
+		case BetterTTV, SevenTV:
+			if !slices.Contains(f.providers, p) {
+				f.providers = append(f.providers, p)
+			}
+		default:
+			return nil, fmt.Errorf("emote: unknown provider %q (want %q or %q)", p, BetterTTV, SevenTV)
+		}
+	}
+	if f.bttvURL == "" {
+		f.bttvURL = DefaultBetterTTVURL
+	}
+	if f.stvURL == "" {
+		f.stvURL = DefaultSevenTVURL
+	}
+	if f.refresh <= 0 {
+		f.refresh = defaultRefresh
+	}
+	return f, nil
+}
+
+// Run reads messages from in, marks the third-party emotes in them, and
+// writes them to out in their original order. Messages are never held
+// for a lookup: emote sets are fetched in the background, and chat that
+// arrives first is passed on with only Twitch's own emotes. out is
+// closed when in is closed.
+func (f *Finder) Run(ctx context.Context, in <-chan message.Message, out chan<- message.Message) {
+	defer close(out)
+	for msg := range in {
+		out <- f.Find(ctx, msg)
+	}
+}
+
+// Find adds the third-party emotes in msg's content to msg.Emotes,
+// starting a fetch of any emote set it needs that isn't loaded or has
+// expired. Only Twitch messages are looked at.
+func (f *Finder) Find(ctx context.Context, msg message.Message) message.Message {
+	if msg.Platform != message.Twitch || msg.Content == "" || len(f.providers) == 0 {
+		return msg
+	}
+	global := f.set(ctx, "")
+	var channel map[string]string
+	if id := f.id(msg.Channel); id != "" {
+		channel = f.set(ctx, id)
+	}
+	if len(global) == 0 && len(channel) == 0 {
+		return msg
+	}
+
+	runes := []rune(msg.Content)
+	taken := make([]bool, len(runes))
+	for _, e := range msg.Emotes {
+		for i := max(e.Start, 0); i < min(e.End, len(runes)); i++ {
+			taken[i] = true
+		}
+	}
+	var found []message.Emote
+	for start := 0; start < len(runes); {
+		if unicode.IsSpace(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		if !taken[start] && !taken[end-1] {
+			name := string(runes[start:end])
+			image, ok := channel[name]
+			if !ok {
+				image, ok = global[name]
+			}
+			if ok {
+				found = append(found, message.Emote{Name: name, Start: start, End: end, Image: image})
+			}
+		}
+		start = end
+	}
+	if len(found) == 0 {
+		return msg
+	}
+	msg.Emotes = append(slices.Clone(msg.Emotes), found...)
+	slices.SortFunc(msg.Emotes, func(a, b message.Emote) int { return a.Start - b.Start })
+	return msg
+}
+
+// id returns the Twitch user ID of channel, or "" when unknown.
+func (f *Finder) id(channel string) string {
+	if f.channelID == nil || channel == "" {
+		return ""
+	}
+	return f.channelID(channel)
+}
+
+// set returns the emotes known under key, fetching them in the
+// background when they are missing or stale.
+func (f *Finder) set(ctx context.Context, key string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.sets[key]
+	if s == nil {
+		s = &emoteSet{}
+		f.sets[key] = s
+	}
+	if !s.loading && !f.clock.Now().Before(s.expires) {
+		s.loading = true
+		go f.load(ctx, key)
+	}
+	return s.emotes
+}
+
+// Load fetches the global emotes and, when channel's ID is known, the
+// channel's own, waiting for them. Find fetches sets on its own; Load
+// lets a caller have them ready before chat arrives.
+func (f *Finder) Load(ctx context.Context, channel string) error {
+	if err := f.load(ctx, ""); err != nil {
+		return err
+	}
+	if id := f.id(channel); id != "" {
+		return f.load(ctx, id)
+	}
+	return nil
+}
+
+// load fetches the emote set under key from every provider and stores
+// it. A failed fetch keeps the emotes already known and is retried after
+// retryInterval.
+func (f *Finder) load(ctx context.Context, key string) error {
+	emotes := make(map[string]string)
+	var errs []error
+	for _, p := range f.providers {
+		var got map[string]string
+		var err error
+		switch p {
+		case BetterTTV:
+			got, err = f.bttv(ctx, key)
+		case SevenTV:
+			got, err = f.sevenTV(ctx, key)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for name, image := range got {
+			if _, ok := emotes[name]; !ok {
+				emotes[name] = image
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.sets[key]
+	if s == nil {
+		s = &emoteSet{}
+		f.sets[key] = s
+	}
+	s.loading = false
+	if len(errs) > 0 {
+		s.expires = f.clock.Now().Add(retryInterval)
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Emote lookup error: %v\n", errs[0])
+		}
+		// Keep what the failed provider gave last time
+		for name, image := range s.emotes {
+			if _, ok := emotes[name]; !ok {
+				emotes[name] = image
+			}
+		}
+		s.emotes = emotes
+		return errs[0]
+	}
+	s.emotes = emotes
+	s.expires = f.clock.Now().Add(f.refresh)
+	return nil
+}
+
+// bttvEmote is an emote in BetterTTV's API.
+type bttvEmote struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+// bttv fetches BetterTTV's global emotes, or a channel's by its ID.
+func (f *Finder) bttv(ctx context.Context, id string) (map[string]string, error) {
+	var list []bttvEmote
+	if id == "" {
+		if err := f.get(ctx, f.bttvURL+"/cached/emotes/global", &list); err != nil {
+			return nil, fmt.Errorf("emote: BetterTTV global emotes: %w", err)
+		}
+	} else {
+		var user struct {
+			ChannelEmotes []bttvEmote `json:"channelEmotes"`
+			SharedEmotes  []bttvEmote `json:"sharedEmotes"`
+		}
+		if err := f.get(ctx, f.bttvURL+"/cached/users/twitch/"+id, &user); err != nil {
+			return nil, fmt.Errorf("emote: BetterTTV emotes for channel %s: %w", id, err)
+		}
+		list = append(user.ChannelEmotes, user.SharedEmotes...)
+	}
+	out := make(map[string]string, len(list))
+	for _, e := range list {
+		if e.Code != "" && e.ID != "" {
+			out[e.Code] = bttvImageURL + e.ID + "/1x"
+		}
+	}
+	return out, nil
+}
+
+// stvEmote is an emote in 7TV's API.
+type stvEmote struct {
+	Name string `json:"name"`
+	Data struct {
+		Host struct {
+			URL   string `json:"url"`
+			Files []struct {
+				Name   string `json:"name"`
+				Format string `json:"format"`
+			} `json:"files"`
+		} `json:"host"`
+	} `json:"data"`
+}
+
+// image returns the URL of the emote's smallest picture, preferring a
+// PNG or GIF, which terminals can show, over WebP and AVIF.
+func (e stvEmote) image() string {
+	host := e.Data.Host
+	var file string
+	for _, f := range host.Files {
+		if !strings.HasPrefix(f.Name, "1x.") {
+			continue
+		}
+		if f.Format == "PNG" || f.Format == "GIF" {
+			file = f.Name
+			break
+		}
+		if file == "" {
+			file = f.Name
+		}
+	}
+	if host.URL == "" || file == "" {
+		return ""
+	}
+	url := host.URL + "/" + file
+	if strings.HasPrefix(url, "//") {
+		url = "https:" + url
+	}
+	return url
+}
+
+// sevenTV fetches 7TV's global emotes, or a channel's by its Twitch ID.
+func (f *Finder) sevenTV(ctx context.Context, id string) (map[string]string, error) {
+	var set struct {
+		Emotes []stvEmote `json:"emotes"`
+	}
+	if id == "" {
+		if err := f.get(ctx, f.stvURL+"/emote-sets/global", &set); err != nil {
+			return nil, fmt.Errorf("emote: 7TV global emotes: %w", err)
+		}
+	} else {
+		var user struct {
+			EmoteSet *struct {
+				Emotes []stvEmote `json:"emotes"`
+			} `json:"emote_set"`
+		}
+		if err := f.get(ctx, f.stvURL+"/users/twitch/"+id, &user); err != nil {
+			return nil, fmt.Errorf("emote: 7TV emotes for channel %s: %w", id, err)
+		}
+		if user.EmoteSet != nil {
+			set.Emotes = user.EmoteSet.Emotes
+		}
+	}
+	out := make(map[string]string, len(set.Emotes))
+	for _, e := range set.Emotes {
+		if e.Name != "" {
+			out[e.Name] = e.image()
+		}
+	}
+	return out, nil
+}
+
+// get decodes the JSON at url into v. A 404, which both providers give
+// for a channel without an account, leaves v empty.
+func (f *Finder) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	}
+	return nil
+}
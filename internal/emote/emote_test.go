@@ -0,0 +1,153 @@
+package emote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+// providers serves BetterTTV's and 7TV's APIs: global emotes, and
+// channel emotes for Twitch user 71092938 only.
+func providers(t *testing.T, hits map[string]int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/bttv/cached/emotes/global":
+			io.WriteString(w, `[{"id":"b1","code":"LULW","imageType":"png"},{"id":"b2","code":"catJAM","imageType":"gif"}]`)
+		case "/bttv/cached/users/twitch/71092938":
+			io.WriteString(w, `{"channelEmotes":[{"id":"b3","code":"xqcL"}],"sharedEmotes":[{"id":"b4","code":"pepeD"}]}`)
+		case "/7tv/emote-sets/global":
+			io.WriteString(w, `{"emotes":[{"name":"catJAM","data":{"host":{"url":"//cdn.7tv.app/emote/s1","files":[{"name":"1x.webp","format":"WEBP"},{"name":"1x.gif","format":"GIF"}]}}}]}`)
+		case "/7tv/users/twitch/71092938":
+			io.WriteString(w, `{"emote_set":{"emotes":[{"name":"Clap","data":{"host":{"url":"//cdn.7tv.app/emote/s2","files":[{"name":"1x.webp","format":"WEBP"}]}}}]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newFinder(t *testing.T, server *httptest.Server, opts Options) *Finder {
+	t.Helper()
+	opts.BetterTTVURL = server.URL + "/bttv"
+	opts.SevenTVURL = server.URL + "/7tv"
+	opts.ChannelID = func(channel string) string {
+		return map[string]string{"xqc": "71092938", "nobody": "404"}[channel]
+	}
+	f, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFind(t *testing.T) {
+	f := newFinder(t, providers(t, map[string]int{}), Options{Providers: []string{"bttv", "7tv"}})
+	if err := f.Load(context.Background(), "xqc"); err != nil {
+		t.Fatal(err)
+	}
+
+	kappa := message.Emote{Name: "Kappa", Start: 0, End: 5, Image: "twitch"}
+	msg := f.Find(context.Background(), message.Message{
+		Platform: message.Twitch,
+		Channel:  "xqc",
+		Content:  "Kappa LULW catJAM xqcL pepeD Clap LULW!",
+		Emotes:   []message.Emote{kappa},
+	})
+	want := []message.Emote{
+		kappa,
+		{Name: "LULW", Start: 6, End: 10, Image: "https://cdn.betterttv.net/emote/b1/1x"},
+		// BetterTTV is listed first, so its catJAM wins
+		{Name: "catJAM", Start: 11, End: 17, Image: "https://cdn.betterttv.net/emote/b2/1x"},
+		{Name: "xqcL", Start: 18, End: 22, Image: "https://cdn.betterttv.net/emote/b3/1x"},
+		{Name: "pepeD", Start: 23, End: 28, Image: "https://cdn.betterttv.net/emote/b4/1x"},
+		{Name: "Clap", Start: 29, End: 33, Image: "https://cdn.7tv.app/emote/s2/1x.webp"},
+	}
+	if !slices.Equal(msg.Emotes, want) {
+		t.Errorf("Emotes = %+v\nwant %+v", msg.Emotes, want)
+	}
+
+	// Channel emotes stay in their channel; other platforms are left alone
+	msg = f.Find(context.Background(), message.Message{Platform: message.Twitch, Channel: "other", Content: "xqcL LULW"})
+	if len(msg.Emotes) != 1 || msg.Emotes[0].Name != "LULW" {
+		t.Errorf("Emotes in another channel = %+v", msg.Emotes)
+	}
+	msg = f.Find(context.Background(), message.Message{Platform: message.YouTube, Content: "LULW"})
+	if msg.Emotes != nil {
+		t.Errorf("Emotes on YouTube = %+v", msg.Emotes)
+	}
+}
+
+func TestFindSevenTVImage(t *testing.T) {
+	f := newFinder(t, providers(t, map[string]int{}), Options{Providers: []string{"7tv"}})
+	if err := f.Load(context.Background(), "nobody"); err != nil {
+		t.Fatalf("Load() = %v; a channel without an account isn't an error", err)
+	}
+	msg := f.Find(context.Background(), message.Message{Platform: message.Twitch, Channel: "nobody", Content: "catJAM"})
+	if len(msg.Emotes) != 1 || msg.Emotes[0].Image != "https://cdn.7tv.app/emote/s1/1x.gif" {
+		t.Errorf("Emotes = %+v, want the GIF over the WebP", msg.Emotes)
+	}
+}
+
+func TestFindFetchesInBackground(t *testing.T) {
+	hits := map[string]int{}
+	server := providers(t, hits)
+	clk := clock.NewFake(time.Date(2025, 1, 15, 20, 0, 0, 0, time.UTC))
+	f := newFinder(t, server, Options{Providers: []string{"bttv"}, Clock: clk})
+
+	in := make(chan message.Message)
+	out := make(chan message.Message)
+	go f.Run(context.Background(), in, out)
+	send := func() message.Message {
+		in <- message.Message{Platform: message.Twitch, Channel: "xqc", Content: "LULW"}
+		return <-out
+	}
+
+	// The first message isn't held while the sets load
+	if msg := send(); msg.Emotes != nil {
+		t.Errorf("first message Emotes = %+v, want none yet", msg.Emotes)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(send().Emotes) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("emotes never loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Sets are fetched again once they expire
+	clk.Advance(2 * time.Hour)
+	send()
+	for f.loading("") {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(in)
+	if _, ok := <-out; ok {
+		t.Error("out wasn't closed")
+	}
+	if n := hits["/bttv/cached/emotes/global"]; n != 2 {
+		t.Errorf("global emotes fetched %d times, want 2", n)
+	}
+}
+
+// loading reports whether the set under key is being fetched.
+func (f *Finder) loading(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sets[key] != nil && f.sets[key].loading
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := New(Options{Providers: []string{"ffz"}}); err == nil {
+		t.Error("New() accepted an unknown provider")
+	}
+}
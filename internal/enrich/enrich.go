@@ -0,0 +1,280 @@
+// Package enrich looks up who sent each message, such as a Twitch
+// account's age and avatar or a YouTube author's channel page, and
+// attaches it to the message for the dashboard, overlays, and bridge
+// filters. Lookups are cached and rate limited per platform, so a busy
+// chat costs one request per sender rather than one per message.
+package enrich
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+const (
+	defaultCacheSize = 1000
+	defaultTTL       = 6 * time.Hour
+	defaultRate      = 2
+	defaultTimeout   = time.Second
+
+	// failureTTL is how long a failed lookup is remembered, so an
+	// unknown or erroring sender isn't looked up on every message.
+	failureTTL = 5 * time.Minute
+)
+
+// Resolver looks up the profile of msg's sender on one platform.
+type Resolver func(ctx context.Context, msg message.Message) (message.Profile, error)
+
+// Options configures an Enricher. The zero value looks nothing up but
+// still remembers the roles senders have been seen with.
+type Options struct {
+	// Resolvers look up profiles, by platform. Messages from other
+	// platforms are passed on without one.
+	Resolvers map[message.Platform]Resolver
+	// CacheSize caps how many senders are remembered, evicting the least
+	// recently seen. Defaults to 1000.
+	CacheSize int
+	// TTL is how long a profile is kept before it is looked up again.
+	// Defaults to 6h.
+	TTL time.Duration
+	// Rate caps lookups per second on each platform. Senders seen while
+	// the limit is reached are passed on without a profile and tried
+	// again on their next message. Defaults to 2.
+	Rate float64
+	// Timeout bounds how long a message is held waiting for a lookup
+	// before it is passed on without a profile. Defaults to 1s.
+	Timeout time.Duration
+	// Clock expires cached profiles and paces the rate limits. Defaults
+	// to the wall clock.
+	Clock clock.Clock
+}
+
+// Enricher attaches sender profiles to messages.
+type Enricher struct {
+	resolvers map[message.Platform]Resolver
+	size      int
+	ttl       time.Duration
+	timeout   time.Duration
+	clock     clock.Clock
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	limits   map[message.Platform]*limiter
+	inflight map[string]chan struct{}
+}
+
+// entry is what is known about one sender.
+type entry struct {
+	key     string
+	profile *message.Profile
+	// role is the last role the sender was seen with, filled in on their
+	// messages that don't carry one, such as hackr.tv edits.
+	role    string
+	expires time.Time
+}
+
+// New creates an Enricher.
+func New(opts Options) *Enricher {
+	size := opts.CacheSize
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	rate := opts.Rate
+	if rate <= 0 {
+		rate = defaultRate
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	e := &Enricher{
+		resolvers: opts.Resolvers,
+		size:      size,
+		ttl:       ttl,
+		timeout:   timeout,
+		clock:     clock.Or(opts.Clock),
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		limits:    make(map[message.Platform]*limiter),
+		inflight:  make(map[string]chan struct{}),
+	}
+	for p := range opts.Resolvers {
+		e.limits[p] = &limiter{rate: rate, burst: max(rate, 1), tokens: max(rate, 1)}
+	}
+	return e
+}
+
+// Run reads messages from in, attaches what is known about their
+// senders, and writes them to out in their original order. Lookups run
+// concurrently, so a slow one delays later messages by at most the
+// configured timeout. out is closed when in is closed.
+func (e *Enricher) Run(ctx context.Context, in <-chan message.Message, out chan<- message.Message) {
+	pending := make(chan chan message.Message, cap(out)+1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(out)
+		for p := range pending {
+			out <- <-p
+		}
+	}()
+
+	for msg := range in {
+		p := make(chan message.Message, 1)
+		pending <- p
+		if msg, ok := e.fromCache(msg); ok {
+			p <- msg
+			continue
+		}
+		go func() {
+			p <- e.Enrich(ctx, msg)
+		}()
+	}
+	close(pending)
+	<-done
+}
+
+// fromCache returns msg with what the cache knows, and whether that is
+// all there is to know without a lookup.
+func (e *Enricher) fromCache(msg message.Message) (message.Message, bool) {
+	key := senderKey(msg)
+	if key == "" {
+		return msg, true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ent := e.touch(key, msg.Role)
+	if msg.Role == "" {
+		msg.Role = ent.role
+	}
+	if e.resolvers[msg.Platform] == nil || e.clock.Now().Before(ent.expires) {
+		msg.Profile = ent.profile
+		return msg, true
+	}
+	return msg, false
+}
+
+// Enrich returns msg with its sender's profile, looking it up when it
+// isn't cached and the platform's rate limit allows. Concurrent calls
+// for one sender share a lookup.
+func (e *Enricher) Enrich(ctx context.Context, msg message.Message) message.Message {
+	msg, ok := e.fromCache(msg)
+	if ok {
+		return msg
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	key := senderKey(msg)
+	for {
+		e.mu.Lock()
+		wait, busy := e.inflight[key]
+		if !busy {
+			break
+		}
+		e.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return msg
+		}
+		if cached, ok := e.fromCache(msg); ok {
+			return cached
+		}
+	}
+	if !e.limits[msg.Platform].allow(e.clock.Now()) {
+		e.mu.Unlock()
+		return msg
+	}
+	finished := make(chan struct{})
+	e.inflight[key] = finished
+	e.mu.Unlock()
+
+	profile, err := e.resolvers[msg.Platform](ctx, msg)
+
+	e.mu.Lock()
+	delete(e.inflight, key)
+	close(finished)
+	// Timeouts say nothing about the sender, so only cache real answers
+	if ctx.Err() == nil {
+		ent := e.touch(key, "")
+		ent.profile, ent.expires = nil, e.clock.Now().Add(failureTTL)
+		if err == nil {
+			ent.profile, ent.expires = &profile, e.clock.Now().Add(e.ttl)
+		}
+	}
+	e.mu.Unlock()
+	if err == nil {
+		msg.Profile = &profile
+	}
+	return msg
+}
+
+// touch returns key's entry, creating it if needed, and marks it most
+// recently used, evicting the least recently used entry once the cache
+// is full. A role, when given, is remembered. The caller holds e.mu.
+func (e *Enricher) touch(key, role string) *entry {
+	var ent *entry
+	if el, ok := e.entries[key]; ok {
+		e.lru.MoveToFront(el)
+		ent = el.Value.(*entry)
+	} else {
+		ent = &entry{key: key}
+		e.entries[key] = e.lru.PushFront(ent)
+		for e.lru.Len() > e.size {
+			oldest := e.lru.Back()
+			e.lru.Remove(oldest)
+			delete(e.entries, oldest.Value.(*entry).key)
+		}
+	}
+	if role != "" {
+		ent.role = role
+	}
+	return ent
+}
+
+// senderKey identifies msg's sender on its platform, by account ID when
+// the platform gives one. It is empty for messages with no sender.
+func senderKey(msg message.Message) string {
+	id := msg.UserID
+	if id == "" {
+		if msg.Username == "" {
+			return ""
+		}
+		id = "@" + strings.ToLower(msg.Username)
+	}
+	return msg.Platform.Key() + ":" + id
+}
+
+// limiter is a token bucket that refuses rather than waits when empty,
+// since a lookup that has to wait is better skipped until the sender's
+// next message.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token if one is available. The caller holds e.mu.
+func (l *limiter) allow(now time.Time) bool {
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
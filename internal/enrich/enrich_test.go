@@ -0,0 +1,213 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+var start = time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+
+// counting returns a resolver that gives every sender an avatar named
+// after them, and the number of lookups it has made.
+func counting() (Resolver, *atomic.Int64) {
+	var calls atomic.Int64
+	return func(_ context.Context, msg message.Message) (message.Profile, error) {
+		calls.Add(1)
+		return message.Profile{Avatar: "https://cdn.example/" + msg.Username + ".png", Created: start.AddDate(-1, 0, 0)}, nil
+	}, &calls
+}
+
+func chat(user string) message.Message {
+	return message.Message{Platform: message.Twitch, Username: user, Content: "hi", Timestamp: start}
+}
+
+func TestEnrichCaches(t *testing.T) {
+	resolve, calls := counting()
+	fake := clock.NewFake(start)
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: resolve}, TTL: time.Hour, Clock: fake})
+
+	for range 3 {
+		msg := e.Enrich(context.Background(), chat("bob"))
+		if msg.Profile == nil || msg.Profile.Avatar != "https://cdn.example/bob.png" {
+			t.Fatalf("Profile = %+v", msg.Profile)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("lookups = %d, want 1", n)
+	}
+	if age, ok := e.Enrich(context.Background(), chat("bob")).AccountAge(); !ok || age < 365*24*time.Hour {
+		t.Errorf("AccountAge() = %v, %v", age, ok)
+	}
+
+	// A stale profile is looked up again
+	fake.Advance(2 * time.Hour)
+	e.Enrich(context.Background(), chat("bob"))
+	if n := calls.Load(); n != 2 {
+		t.Errorf("lookups after TTL = %d, want 2", n)
+	}
+}
+
+func TestEnrichEvictsLeastRecentlyUsed(t *testing.T) {
+	resolve, calls := counting()
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: resolve}, CacheSize: 2, Rate: 100, Clock: clock.NewFake(start)})
+
+	ctx := context.Background()
+	e.Enrich(ctx, chat("a"))
+	e.Enrich(ctx, chat("b"))
+	e.Enrich(ctx, chat("a")) // a is now more recent than b
+	e.Enrich(ctx, chat("c")) // evicts b
+	e.Enrich(ctx, chat("a"))
+	if n := calls.Load(); n != 3 {
+		t.Errorf("lookups = %d, want 3", n)
+	}
+	e.Enrich(ctx, chat("b"))
+	if n := calls.Load(); n != 4 {
+		t.Errorf("lookups after eviction = %d, want 4", n)
+	}
+}
+
+func TestEnrichRateLimited(t *testing.T) {
+	resolve, calls := counting()
+	fake := clock.NewFake(start)
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: resolve}, Rate: 1, Clock: fake})
+
+	ctx := context.Background()
+	if e.Enrich(ctx, chat("a")).Profile == nil {
+		t.Fatal("first lookup was refused")
+	}
+	if msg := e.Enrich(ctx, chat("b")); msg.Profile != nil {
+		t.Error("second lookup in the same second wasn't rate limited")
+	}
+	// The refused sender is tried again once the bucket refills
+	fake.Advance(time.Second)
+	if e.Enrich(ctx, chat("b")).Profile == nil {
+		t.Error("lookup after the limit passed was refused")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("lookups = %d, want 2", n)
+	}
+}
+
+func TestEnrichFailuresCached(t *testing.T) {
+	var calls atomic.Int64
+	fail := func(context.Context, message.Message) (message.Profile, error) {
+		calls.Add(1)
+		return message.Profile{}, errors.New("user not found")
+	}
+	fake := clock.NewFake(start)
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: fail}, Rate: 100, Clock: fake})
+
+	for range 3 {
+		if msg := e.Enrich(context.Background(), chat("ghost")); msg.Profile != nil {
+			t.Errorf("Profile = %+v for a failed lookup", msg.Profile)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("lookups = %d, want 1", n)
+	}
+	fake.Advance(failureTTL + time.Second)
+	e.Enrich(context.Background(), chat("ghost"))
+	if n := calls.Load(); n != 2 {
+		t.Errorf("lookups after failureTTL = %d, want 2", n)
+	}
+}
+
+func TestEnrichSharesLookups(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int64
+	slow := func(context.Context, message.Message) (message.Profile, error) {
+		calls.Add(1)
+		<-release
+		return message.Profile{URL: "https://www.twitch.tv/bob"}, nil
+	}
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: slow}, Rate: 100, Timeout: 5 * time.Second})
+
+	var wg sync.WaitGroup
+	results := make([]message.Message, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = e.Enrich(context.Background(), chat("bob"))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("lookups = %d, want 1", n)
+	}
+	for i, msg := range results {
+		if msg.Profile == nil {
+			t.Errorf("result %d has no profile", i)
+		}
+	}
+}
+
+func TestEnrichTimeout(t *testing.T) {
+	hang := func(ctx context.Context, _ message.Message) (message.Profile, error) {
+		<-ctx.Done()
+		return message.Profile{}, ctx.Err()
+	}
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: hang}, Timeout: 20 * time.Millisecond})
+
+	begin := time.Now()
+	if msg := e.Enrich(context.Background(), chat("bob")); msg.Profile != nil {
+		t.Errorf("Profile = %+v after a timeout", msg.Profile)
+	}
+	if took := time.Since(begin); took > time.Second {
+		t.Errorf("Enrich() took %s with a 20ms timeout", took)
+	}
+}
+
+func TestEnrichRemembersRoles(t *testing.T) {
+	e := New(Options{})
+	ctx := context.Background()
+
+	e.Enrich(ctx, message.Message{Platform: message.HackrTV, Username: "xeraen", Role: "admin", Content: "hi"})
+	edit := e.Enrich(ctx, message.Message{Platform: message.HackrTV, Type: message.TypeEdit, Username: "XERAEN", Content: "message from xeraen edited: hello"})
+	if edit.Role != "admin" {
+		t.Errorf("Role = %q, want the role xeraen was seen with", edit.Role)
+	}
+	if edit.Profile != nil {
+		t.Errorf("Profile = %+v without a resolver", edit.Profile)
+	}
+}
+
+func TestRunKeepsOrder(t *testing.T) {
+	resolve, _ := counting()
+	slow := func(ctx context.Context, msg message.Message) (message.Profile, error) {
+		if msg.Username == "slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return resolve(ctx, msg)
+	}
+	e := New(Options{Resolvers: map[message.Platform]Resolver{message.Twitch: slow}, Rate: 100})
+
+	in := make(chan message.Message, 3)
+	out := make(chan message.Message, 3)
+	in <- chat("slow")
+	in <- chat("fast")
+	in <- message.Message{Platform: message.YouTube, Username: "fan", Content: "hi"}
+	close(in)
+	go e.Run(context.Background(), in, out)
+
+	var got []string
+	for msg := range out {
+		got = append(got, msg.Username)
+		if msg.Platform == message.Twitch && msg.Profile == nil {
+			t.Errorf("%s has no profile", msg.Username)
+		}
+	}
+	if len(got) != 3 || got[0] != "slow" || got[1] != "fast" || got[2] != "fan" {
+		t.Errorf("order = %v", got)
+	}
+}
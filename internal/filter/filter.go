@@ -0,0 +1,136 @@
+// Package filter decides which chat is worth bridging to hackr.tv, so bot
+// spam, commands, and unwanted words stay on the platform they were
+// typed on.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"relay/internal/message"
+)
+
+// Options configures a Filter. The zero value passes everything.
+type Options struct {
+	// DenyUsers are never bridged: a username, or "platform:username"
+	// for one platform, case-insensitively.
+	DenyUsers []string
+	// AllowUsers are exempt from the content rules below, in the same
+	// form as DenyUsers. DenyUsers still wins.
+	AllowUsers []string
+	// DenyWords skips chat containing any of these words or phrases,
+	// matched case-insensitively on word boundaries.
+	DenyWords []string
+	// DenyPatterns skips chat matching any of these regular expressions.
+	DenyPatterns []string
+	// MinLength skips chat with fewer characters than this.
+	MinLength int
+	// SkipCommands skips chat starting with "!".
+	SkipCommands bool
+	// MinAccountAge skips chat from accounts made less than this long
+	// ago, where the enrichment stage found the account's age.
+	MinAccountAge time.Duration
+}
+
+// Filter applies Options to messages. It is safe for concurrent use.
+type Filter struct {
+	deny      map[string]bool
+	allow     map[string]bool
+	words     *regexp.Regexp
+	patterns  []*regexp.Regexp
+	minLength int
+	commands  bool
+	minAge    time.Duration
+}
+
+// New compiles opts, reporting bad user entries and patterns.
+func New(opts Options) (*Filter, error) {
+	f := &Filter{minLength: opts.MinLength, commands: opts.SkipCommands, minAge: opts.MinAccountAge}
+	var err error
+	if f.deny, err = users(opts.DenyUsers); err != nil {
+		return nil, err
+	}
+	if f.allow, err = users(opts.AllowUsers); err != nil {
+		return nil, err
+	}
+	var words []string
+	for _, w := range opts.DenyWords {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, regexp.QuoteMeta(w))
+		}
+	}
+	if len(words) > 0 {
+		f.words = regexp.MustCompile(`(?i)(?:^|\P{L})(?:` + strings.Join(words, "|") + `)(?:\P{L}|$)`)
+	}
+	for _, p := range opts.DenyPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("filter: pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// users normalizes entries to "key:username" or "username".
+func users(entries []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if name, user, ok := strings.Cut(e, ":"); ok {
+			p, ok := message.ParsePlatform(name)
+			if !ok {
+				return nil, fmt.Errorf("filter: unknown platform %q in user %q", name, e)
+			}
+			e = p.Key() + ":" + user
+		}
+		set[e] = true
+	}
+	return set, nil
+}
+
+// listed reports whether msg's sender is in set.
+func listed(set map[string]bool, msg message.Message) bool {
+	name := strings.ToLower(msg.Username)
+	return set[name] || set[msg.Platform.Key()+":"+name]
+}
+
+// Skip reports whether msg must not be bridged. Deletions always pass so
+// they can still retract queued messages. Content rules apply only to
+// plain chat, never to events or paid messages.
+func (f *Filter) Skip(msg message.Message) bool {
+	if f == nil || msg.Type == message.TypeDeletion {
+		return false
+	}
+	if listed(f.deny, msg) {
+		return true
+	}
+	if msg.Type != message.TypeChat || !msg.Amount.IsZero() || listed(f.allow, msg) {
+		return false
+	}
+	if age, ok := msg.AccountAge(); ok && age < f.minAge {
+		return true
+	}
+	content := strings.TrimSpace(msg.Content)
+	if f.commands && strings.HasPrefix(content, "!") {
+		return true
+	}
+	if utf8.RuneCountInString(content) < f.minLength {
+		return true
+	}
+	if f.words != nil && f.words.MatchString(content) {
+		return true
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
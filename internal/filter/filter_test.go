@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func chat(p message.Platform, user, content string) message.Message {
+	return message.Message{Platform: p, Type: message.TypeChat, Username: user, Content: content}
+}
+
+func TestSkip(t *testing.T) {
+	f, err := New(Options{
+		DenyUsers:    []string{"Nightbot", "yt_:spammer"},
+		AllowUsers:   []string{"twitch:mod"},
+		DenyWords:    []string{"free followers", "scam"},
+		DenyPatterns: []string{`https?://bit\.ly/`},
+		MinLength:    2,
+		SkipCommands: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		msg  message.Message
+		want bool
+	}{
+		{"plain chat", chat(message.Twitch, "viewer", "hello there"), false},
+		{"denied user", chat(message.Twitch, "nightbot", "hello there"), true},
+		{"denied user on any platform", chat(message.YouTube, "NightBot", "hello there"), true},
+		{"platform-qualified deny", chat(message.YouTube, "spammer", "hello there"), true},
+		{"platform-qualified deny elsewhere", chat(message.Twitch, "spammer", "hello there"), false},
+		{"command", chat(message.Twitch, "viewer", "!uptime"), true},
+		{"too short", chat(message.Twitch, "viewer", " a "), true},
+		{"short multibyte", chat(message.Twitch, "viewer", "ok"), false},
+		{"denied phrase", chat(message.Twitch, "viewer", "get FREE FOLLOWERS now"), true},
+		{"denied word", chat(message.Twitch, "viewer", "this is a scam!"), true},
+		{"word inside another", chat(message.Twitch, "viewer", "scampi for dinner"), false},
+		{"pattern", chat(message.Twitch, "viewer", "see http://bit.ly/x"), true},
+		{"allowed user", chat(message.Twitch, "mod", "!uptime"), false},
+		{"allowed user elsewhere", chat(message.YouTube, "mod", "!uptime"), true},
+		{"event", message.Message{Platform: message.Twitch, Type: message.TypeSub, Username: "viewer", Content: "!"}, false},
+		{"event from denied user", message.Message{Platform: message.Twitch, Type: message.TypeSub, Username: "nightbot"}, true},
+		{"cheer", message.Message{Platform: message.Twitch, Username: "viewer", Content: "!", Amount: message.Amount{Value: 100, Currency: "BITS"}}, false},
+		{"deletion", message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "nightbot"}, false},
+	}
+	for _, tt := range tests {
+		if got := f.Skip(tt.msg); got != tt.want {
+			t.Errorf("%s: Skip() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSkipNewAccounts(t *testing.T) {
+	f, err := New(Options{MinAccountAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	aged := func(age time.Duration) message.Message {
+		msg := chat(message.Twitch, "viewer", "hello there")
+		msg.Timestamp = now
+		msg.Profile = &message.Profile{Created: now.Add(-age)}
+		return msg
+	}
+	if !f.Skip(aged(time.Hour)) {
+		t.Error("chat from an hour-old account was bridged")
+	}
+	if f.Skip(aged(30 * 24 * time.Hour)) {
+		t.Error("chat from a month-old account was skipped")
+	}
+	if f.Skip(chat(message.Twitch, "viewer", "hello there")) {
+		t.Error("chat from an account of unknown age was skipped")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(Options{DenyPatterns: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, err := New(Options{DenyUsers: []string{"myspace:tom"}}); err == nil {
+		t.Error("expected an error for an unknown platform")
+	}
+	var f *Filter
+	if f.Skip(chat(message.Twitch, "viewer", "!x")) {
+		t.Error("a nil Filter should pass everything")
+	}
+}
@@ -1,38 +1,337 @@
 package hackrtv
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/http"
 	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"relay/internal/clock"
+	"relay/internal/echo"
+	"relay/internal/i18n"
 	"relay/internal/message"
+	"relay/internal/netio"
 )
 
+var (
+	// ErrNotConnected is returned by Perform when there is no live cable connection.
+	ErrNotConnected = errors.New("hackrtv: not connected")
+	// ErrAuth marks a connection the server refused for bad or missing
+	// credentials, on the WebSocket upgrade or in a disconnect frame.
+	ErrAuth = errors.New("hackrtv: unauthorized")
+	// ErrSubscriptionRejected is returned by Connect when the server
+	// rejects a channel's subscription, e.g. for an unknown slug.
+	ErrSubscriptionRejected = errors.New("hackrtv: subscription rejected")
+	// ErrUnconfirmed is returned by Connect when the server neither
+	// confirms nor rejects a channel's subscription, even once resent.
+	ErrUnconfirmed = errors.New("hackrtv: no subscription confirmation")
+)
+
+const (
+	// minBackoff and maxBackoff bound the delay between reconnect attempts.
+	// The delay doubles after each failed attempt and resets once a
+	// session is established again.
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+
+	// defaultStaleThreshold is how long to wait for an ActionCable ping
+	// before treating the connection as dead. Servers ping every 3s.
+	defaultStaleThreshold = 10 * time.Second
+
+	// defaultConfirmTimeout is how long to wait for confirm_subscription
+	// before subscribing again, and again before giving up.
+	defaultConfirmTimeout = 5 * time.Second
+
+	// seenLimit bounds how many packet IDs are remembered for dedup.
+	// It only needs to cover the initial_packets history replayed on
+	// each (re)subscribe.
+	seenLimit = 1000
+
+	// echoWait is the longest a packet from the client's own alias is
+	// held while the bridge waits to learn the IDs of its sends. It is
+	// short so the read loop keeps up with pings.
+	echoWait = time.Second
+
+	// defaultChannelClass is the ActionCable channel class streaming chat.
+	defaultChannelClass = "LiveChatChannel"
+)
+
+// permanentError marks a failure that reconnecting cannot fix, such as a
+// rejected subscription. Connect returns it instead of retrying.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Options configures the hackr.tv cable client.
+type Options struct {
+	// StaleThreshold is how long the connection may go without a ping
+	// before it is torn down and re-established. Defaults to 10s.
+	StaleThreshold time.Duration
+	// ConfirmTimeout is how long to wait for each channel's subscription
+	// to be confirmed. Unconfirmed subscriptions are sent once more, then
+	// Connect fails. Defaults to 5s.
+	ConfirmTimeout time.Duration
+	// HeaderAuth sends the token in an Authorization header during the
+	// WebSocket upgrade instead of the URL query, keeping it out of proxy
+	// and access logs. If the server refuses it as unauthorized, the
+	// client falls back to query parameters for older servers.
+	HeaderAuth bool
+	// SkipHistory ignores the initial_packets backlog sent when a channel
+	// is first subscribed, so only live chat is shown. History replayed on
+	// a reconnect still delivers packets missed while disconnected.
+	SkipHistory bool
+	// HistoryLast, without SkipHistory, shows only the newest HistoryLast
+	// packets of that backlog. Zero shows all of it.
+	HistoryLast int
+	// ChannelClass is the ActionCable channel class subscribed once per
+	// chat channel, identified by a chat_channel slug. Defaults to
+	// "LiveChatChannel".
+	ChannelClass string
+	// Subscriptions are extra ActionCable channels subscribed alongside
+	// chat. Their broadcasts are emitted as system events.
+	Subscriptions []Subscription
+	// Clock paces reconnect backoff and stamps events that carry no time
+	// of their own. Defaults to the wall clock.
+	Clock clock.Clock
+	// Echoes holds the IDs of packets the bridge created. Packets from
+	// the client's own alias with one of those IDs are not delivered,
+	// so bridged chat isn't shown twice or bridged back out.
+	Echoes *echo.Set
+	// WriteTimeout bounds each frame written to the cable, so Perform,
+	// subscribing, and the close frame sent on shutdown give up on a
+	// connection that has stopped draining. Defaults to 10s.
+	WriteTimeout time.Duration
+	// KeepRaw sets each message's Raw to the broadcast it came from, or
+	// for history, to its packet's part of the initial_packets batch.
+	KeepRaw bool
+}
+
+// Subscription declares an ActionCable channel other than the chat
+// channel class, e.g. {Channel: "NotificationsChannel"}.
+type Subscription struct {
+	// Channel is the ActionCable channel class.
+	Channel string
+	// Params are additional identifier fields, e.g. {"hackr_id": 7}.
+	Params map[string]any
+}
+
+// extraSubscription is a Subscription with its identifier prepared.
+type extraSubscription struct {
+	class string
+	// label names the subscription in errors: the class, or the full
+	// identifier when params distinguish several of one class.
+	label      string
+	identifier string
+	// fields is the identifier decoded back from JSON, so numbers compare
+	// equal to the identifier the server echoes.
+	fields map[string]any
+	err    error
+}
+
+func newExtraSubscription(s Subscription) extraSubscription {
+	fields := make(map[string]any, len(s.Params)+1)
+	maps.Copy(fields, s.Params)
+	fields["channel"] = s.Channel
+
+	ext := extraSubscription{class: s.Channel, label: s.Channel}
+	idJSON, err := json.Marshal(fields)
+	if err != nil {
+		ext.err = fmt.Errorf("failed to marshal %s identifier: %w", s.Channel, err)
+		return ext
+	}
+	ext.identifier = string(idJSON)
+	if len(s.Params) > 0 {
+		ext.label = ext.identifier
+	}
+	json.Unmarshal(idJSON, &ext.fields)
+	return ext
+}
+
+// matches reports whether rawIdentifier carries every field of the
+// subscription's identifier.
+func (e extraSubscription) matches(rawIdentifier string) bool {
+	var got map[string]any
+	if err := json.Unmarshal([]byte(rawIdentifier), &got); err != nil {
+		return false
+	}
+	for k, v := range e.fields {
+		if !reflect.DeepEqual(got[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
 type Client struct {
-	wsURL   string
-	token   string
-	alias   string
-	channel string
+	wsURL string
+	token string
+	alias string
+	// channels are the chat channel slugs subscribed on the connection,
+	// each as a channelClass subscription. The first is the primary
+	// channel that Perform targets.
+	channels     []string
+	channelClass string
+	extras       []extraSubscription
+
+	// writeMu serialises writes to conn, which is set while a session is live.
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+
+	// seen holds delivered packet IDs so the initial_packets history
+	// replayed after a reconnect is not emitted twice.
+	seen *packetSet
+
+	// headerAuth is cleared after a server rejects header credentials.
+	headerAuth bool
+
+	// skipHistory discards the first initial_packets batch per channel;
+	// primed records the channels whose first batch has arrived.
+	skipHistory bool
+	// historyLast caps the first batch per channel to its newest packets.
+	historyLast int
+	primed      map[string]bool
+
+	// echoes identifies the bridge's own packets, or is nil.
+	echoes *echo.Set
+	// keepRaw keeps each message's source JSON in its Raw.
+	keepRaw bool
+
+	// present tracks hackrs seen joining each chat channel, from
+	// hackr_joined and hackr_left broadcasts.
+	presentMu sync.Mutex
+	present   map[string]map[string]bool
+
+	staleThreshold time.Duration
+	confirmTimeout time.Duration
+	writeTimeout   time.Duration
+	clock          clock.Clock
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+
+	// reconnects counts sessions re-established after a dropped
+	// connection.
+	reconnects atomic.Int64
+
+	// ready, when set, is called once a session's subscriptions are all
+	// confirmed. Check uses it.
+	ready func()
 }
 
-func NewClient(wsURL, token, alias, channel string) *Client {
+// NewClient creates a hackr.tv client that subscribes to every given chat
+// channel, and any extra subscriptions in opts, on a single cable connection.
+func NewClient(wsURL, token, alias string, channels []string, opts Options) *Client {
+	stale := opts.StaleThreshold
+	if stale <= 0 {
+		stale = defaultStaleThreshold
+	}
+	confirm := opts.ConfirmTimeout
+	if confirm <= 0 {
+		confirm = defaultConfirmTimeout
+	}
+	class := opts.ChannelClass
+	if class == "" {
+		class = defaultChannelClass
+	}
+	var extras []extraSubscription
+	for _, s := range opts.Subscriptions {
+		extras = append(extras, newExtraSubscription(s))
+	}
 	return &Client{
-		wsURL:   wsURL,
-		token:   token,
-		alias:   alias,
-		channel: channel,
+		wsURL:          wsURL,
+		token:          token,
+		alias:          alias,
+		channels:       channels,
+		channelClass:   class,
+		extras:         extras,
+		seen:           newPacketSet(seenLimit),
+		headerAuth:     opts.HeaderAuth,
+		skipHistory:    opts.SkipHistory,
+		historyLast:    opts.HistoryLast,
+		primed:         make(map[string]bool),
+		echoes:         opts.Echoes,
+		keepRaw:        opts.KeepRaw,
+		present:        make(map[string]map[string]bool),
+		staleThreshold: stale,
+		confirmTimeout: confirm,
+		writeTimeout:   opts.WriteTimeout,
+		clock:          clock.Or(opts.Clock),
+		minBackoff:     minBackoff,
+		maxBackoff:     maxBackoff,
 	}
 }
 
+// packetSet is a bounded set of packet IDs that forgets the oldest
+// entries once full.
+type packetSet struct {
+	ids   map[int]struct{}
+	order []int
+	limit int
+}
+
+func newPacketSet(limit int) *packetSet {
+	return &packetSet{ids: make(map[int]struct{}), limit: limit}
+}
+
+// add records id and reports whether it was new.
+func (s *packetSet) add(id int) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > s.limit {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
 // ActionCable protocol messages
 type cableMessage struct {
 	Type       string          `json:"type,omitempty"`
 	Message    json.RawMessage `json:"message,omitempty"`
 	Identifier string          `json:"identifier,omitempty"`
 	Command    string          `json:"command,omitempty"`
+	Data       string          `json:"data,omitempty"`
+
+	// Reason and Reconnect accompany "disconnect" frames, e.g.
+	// {"type":"disconnect","reason":"unauthorized","reconnect":false}.
+	Reason    string `json:"reason,omitempty"`
+	Reconnect *bool  `json:"reconnect,omitempty"`
+}
+
+// disconnectError describes a disconnect frame. The server's reconnect
+// hint decides whether it is retried: reconnect:false (e.g. unauthorized)
+// is permanent, anything else is retried with the usual backoff.
+func disconnectError(msg cableMessage) error {
+	reason := msg.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	err := fmt.Errorf("server disconnected: %s", reason)
+	if reason == "unauthorized" {
+		err = fmt.Errorf("server disconnected: %w", ErrAuth)
+	}
+	if msg.Reconnect != nil && !*msg.Reconnect {
+		return &permanentError{err}
+	}
+	return err
 }
 
 type channelIdentifier struct {
@@ -47,10 +346,17 @@ type packet struct {
 	CreatedAt string `json:"created_at"`
 	Dropped   bool   `json:"dropped"`
 	GridHackr struct {
-		ID        int    `json:"id"`
+		ID         int    `json:"id"`
 		HackrAlias string `json:"hackr_alias"`
-		Role      string `json:"role"`
+		Role       string `json:"role"`
 	} `json:"grid_hackr"`
+	// ReplyTo is the packet this one answers, when it is a reply.
+	ReplyTo *struct {
+		ID        int `json:"id"`
+		GridHackr struct {
+			HackrAlias string `json:"hackr_alias"`
+		} `json:"grid_hackr"`
+	} `json:"reply_to,omitempty"`
 }
 
 type initialPacketsMessage struct {
@@ -58,19 +364,133 @@ type initialPacketsMessage struct {
 	Packets []packet `json:"packets"`
 }
 
+// newPacketMessage also carries packet_dropped and packet_updated
+// broadcasts, which report the packet's current state.
 type newPacketMessage struct {
 	Type   string `json:"type"`
 	Packet packet `json:"packet"`
 }
 
+// presenceMessage is a hackr_joined or hackr_left broadcast.
+// OnlineCount is the server's concurrent total, when it sends one.
+type presenceMessage struct {
+	Type      string `json:"type"`
+	GridHackr struct {
+		HackrAlias string `json:"hackr_alias"`
+		Role       string `json:"role"`
+	} `json:"grid_hackr"`
+	OnlineCount *int `json:"online_count"`
+}
+
+// Connect streams packets from the chat channel class until ctx is cancelled.
+// Dropped connections are re-established with exponential backoff and the
+// subscription is renewed; packets already delivered are skipped when the
+// server replays its history. Only permanent failures are returned.
 func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) error {
-	// Build WebSocket URL with auth params
+	backoff := c.minBackoff
+	for {
+		established, err := c.session(ctx, messages)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return err
+		}
+		if established {
+			backoff = c.minBackoff
+		}
+
+		fmt.Fprintf(os.Stderr, "hackr.tv: %v; reconnecting in %s\n", err, backoff)
+		c.reconnects.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(backoff):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+// Check connects once and waits for every subscription to be confirmed,
+// to validate settings before they are used, as "relay setup" does. Once
+// they are, use (when not nil) is run while the connection is still
+// open, e.g. to Perform a test send, and its error returned. Otherwise
+// Check returns why the session failed, such as ErrAuth or
+// ErrSubscriptionRejected, without reconnecting.
+func (c *Client) Check(ctx context.Context, use func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	used := make(chan error, 1)
+	c.ready = func() {
+		go func() {
+			var err error
+			if use != nil {
+				err = use(ctx)
+			}
+			used <- err
+			cancel()
+		}()
+	}
+	defer func() { c.ready = nil }()
+
+	// History isn't wanted, but must not hold up the read loop
+	messages := make(chan message.Message)
+	go func() {
+		for {
+			select {
+			case <-messages:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	header := c.headerAuth
+	_, err := c.session(ctx, messages)
+	if header && !c.headerAuth {
+		// Older servers only read query parameters; check with those
+		_, err = c.session(ctx, messages)
+	}
+	select {
+	case err := <-used:
+		return err
+	default:
+		return err
+	}
+}
+
+// Reconnects returns how many times Connect has reconnected after the
+// connection dropped.
+func (c *Client) Reconnects() int64 {
+	return c.reconnects.Load()
+}
+
+// session runs a single cable connection: dial, welcome, subscribe, then
+// read until the connection fails. established reports whether the
+// subscription was sent, so Connect can reset its backoff. Subscriptions
+// not confirmed within confirmTimeout are sent once more before the
+// session fails permanently, so a misconfigured channel slug is reported
+// rather than waited on forever.
+func (c *Client) session(ctx context.Context, messages chan<- message.Message) (established bool, err error) {
+	established, err = c.dialSession(ctx, messages)
+	if c.headerAuth && c.token != "" && errors.Is(err, ErrAuth) {
+		// Older servers only read query parameters; retry with those.
+		c.headerAuth = false
+		return false, fmt.Errorf("header authentication refused, falling back to query parameters (%v)", err)
+	}
+	return established, err
+}
+
+// dialSession is session for the current authentication mode.
+func (c *Client) dialSession(ctx context.Context, messages chan<- message.Message) (established bool, err error) {
+	// Build WebSocket URL, with auth params unless they go in a header
 	u, err := url.Parse(c.wsURL)
 	if err != nil {
-		return fmt.Errorf("invalid websocket URL: %w", err)
+		return false, &permanentError{fmt.Errorf("invalid websocket URL: %w", err)}
 	}
 	q := u.Query()
-	if c.token != "" {
+	if c.token != "" && !c.headerAuth {
 		q.Set("token", c.token)
 		q.Set("hackr_alias", c.alias)
 	}
@@ -87,107 +507,304 @@ func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) e
 	headers := map[string][]string{
 		"Origin": {origin},
 	}
+	if c.token != "" && c.headerAuth {
+		headers["Authorization"] = []string{"Bearer " + c.alias + ":" + c.token}
+	}
 
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), headers)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), headers)
 	if err != nil {
-		return fmt.Errorf("failed to connect to hackr.tv: %w", err)
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return false, fmt.Errorf("failed to connect to hackr.tv: %w (status %d)", ErrAuth, resp.StatusCode)
+		}
+		return false, fmt.Errorf("failed to connect to hackr.tv: %w", err)
 	}
 	defer conn.Close()
 
 	// Wait for ActionCable welcome message
-	if err := c.waitForWelcome(conn); err != nil {
-		return err
+	if err := c.waitForWelcome(ctx, conn); err != nil {
+		return false, err
 	}
 
-	// Subscribe to LiveChatChannel
-	if err := c.subscribe(conn); err != nil {
-		return err
+	// Subscribe to the chat channel class for each chat channel, then to
+	// any extra channels. Subscriptions are tracked by label until
+	// confirmed.
+	var labels []string
+	identifiers := make(map[string]string)
+	for _, channel := range c.channels {
+		id, err := c.identifier(channel)
+		if err != nil {
+			return false, err
+		}
+		labels = append(labels, channel)
+		identifiers[channel] = id
 	}
+	for _, ext := range c.extras {
+		if ext.err != nil {
+			return false, &permanentError{ext.err}
+		}
+		labels = append(labels, ext.label)
+		identifiers[ext.label] = ext.identifier
+	}
+	for _, label := range labels {
+		if err := c.subscribe(ctx, conn, identifiers[label]); err != nil {
+			return false, err
+		}
+	}
+
+	c.setConn(conn)
+	defer c.setConn(nil)
 
 	// Read loop
 	readErr := make(chan error, 1)
+	confirmed := make(chan string, 2*len(labels))
 	go func() {
-		readErr <- c.readLoop(conn, messages)
+		readErr <- c.readLoop(ctx, conn, messages, confirmed)
 	}()
 
-	select {
-	case <-ctx.Done():
-		// Graceful close
-		conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		return ctx.Err()
-	case err := <-readErr:
-		return err
+	pending := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		pending[label] = true
+	}
+	retried := false
+	confirmTimer := time.NewTimer(c.confirmTimeout)
+	defer confirmTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Graceful close, which ctx no longer bounds
+			c.writeMu.Lock()
+			c.write(context.Background(), conn, func() error {
+				return conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			})
+			c.writeMu.Unlock()
+			return true, ctx.Err()
+		case err := <-readErr:
+			return true, err
+		case label := <-confirmed:
+			delete(pending, label)
+			if len(pending) == 0 {
+				confirmTimer.Stop()
+				if c.ready != nil {
+					c.ready()
+				}
+			}
+		case <-confirmTimer.C:
+			if retried {
+				return true, &permanentError{fmt.Errorf("%w for channel(s) %s within %s", ErrUnconfirmed,
+					strings.Join(slices.Sorted(maps.Keys(pending)), ", "), c.confirmTimeout)}
+			}
+			retried = true
+			for label := range pending {
+				c.writeMu.Lock()
+				err := c.subscribe(ctx, conn, identifiers[label])
+				c.writeMu.Unlock()
+				if err != nil {
+					return true, err
+				}
+			}
+			confirmTimer.Reset(c.confirmTimeout)
+		}
 	}
 }
 
-func (c *Client) waitForWelcome(conn *websocket.Conn) error {
+func (c *Client) waitForWelcome(ctx context.Context, conn *websocket.Conn) error {
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 	defer conn.SetReadDeadline(time.Time{})
+	// Shutting down stops the wait rather than sitting out the deadline
+	stop := context.AfterFunc(ctx, func() { conn.NetConn().SetReadDeadline(time.Unix(1, 0)) })
+	defer stop()
 
 	var msg cableMessage
 	if err := conn.ReadJSON(&msg); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return fmt.Errorf("failed to read welcome: %w", err)
 	}
+	// Servers reject bad credentials with a disconnect instead of a welcome.
+	if msg.Type == "disconnect" {
+		return disconnectError(msg)
+	}
 	if msg.Type != "welcome" {
 		return fmt.Errorf("expected welcome, got %q", msg.Type)
 	}
 	return nil
 }
 
-func (c *Client) subscribe(conn *websocket.Conn) error {
+// identifier returns the subscription identifier for a chat channel.
+func (c *Client) identifier(channel string) (string, error) {
 	identifier := channelIdentifier{
-		Channel:     "LiveChatChannel",
-		ChatChannel: c.channel,
+		Channel:     c.channelClass,
+		ChatChannel: channel,
 	}
 	idJSON, err := json.Marshal(identifier)
 	if err != nil {
-		return fmt.Errorf("failed to marshal channel identifier: %w", err)
+		return "", fmt.Errorf("failed to marshal channel identifier: %w", err)
 	}
+	return string(idJSON), nil
+}
 
+func (c *Client) subscribe(ctx context.Context, conn *websocket.Conn, id string) error {
 	sub := cableMessage{
 		Command:    "subscribe",
-		Identifier: string(idJSON),
+		Identifier: id,
+	}
+	return c.write(ctx, conn, func() error { return conn.WriteJSON(sub) })
+}
+
+// write runs write, which writes one frame to conn, within writeTimeout,
+// giving up when ctx is done. A failed write may leave a frame half
+// sent, so the connection is closed and the session ends to be redialed.
+func (c *Client) write(ctx context.Context, conn *websocket.Conn, write func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := netio.Write(ctx, conn.NetConn(), c.writeTimeout, func(deadline time.Time) error {
+		// The websocket applies its own deadline to every frame
+		conn.SetWriteDeadline(deadline)
+		defer conn.SetWriteDeadline(time.Time{})
+		return write()
+	})
+	if err != nil {
+		conn.Close()
+	}
+	return err
+}
+
+func (c *Client) setConn(conn *websocket.Conn) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn = conn
+}
+
+// Perform invokes an ActionCable channel action on the primary channel's
+// subscription, e.g. Perform(ctx, "send_packet", map[string]any{"content": "hi"}).
+// It returns ErrNotConnected if Connect is not currently running.
+func (c *Client) Perform(ctx context.Context, action string, data map[string]any) error {
+	if len(c.channels) == 0 {
+		return errors.New("hackrtv: no chat channel to perform on")
+	}
+	id, err := c.identifier(c.channels[0])
+	if err != nil {
+		return err
+	}
+
+	payload := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["action"] = action
+	dataJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s data: %w", action, err)
 	}
-	return conn.WriteJSON(sub)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	conn := c.conn
+	return c.write(ctx, conn, func() error {
+		return conn.WriteJSON(cableMessage{
+			Command:    "message",
+			Identifier: id,
+			Data:       string(dataJSON),
+		})
+	})
 }
 
-// matchesSubscription checks if a cable message's identifier matches our
-// subscription by comparing struct fields, avoiding brittle JSON string comparison.
-func (c *Client) matchesSubscription(rawIdentifier string) bool {
+// subscribedChannel returns the chat channel a cable message's identifier
+// refers to if it is one of our subscriptions, comparing struct fields to
+// avoid brittle JSON string comparison.
+func (c *Client) subscribedChannel(rawIdentifier string) (string, bool) {
 	var id channelIdentifier
 	if err := json.Unmarshal([]byte(rawIdentifier), &id); err != nil {
-		return false
+		return "", false
+	}
+	if id.Channel != c.channelClass || !slices.Contains(c.channels, id.ChatChannel) {
+		return "", false
 	}
-	return id.Channel == "LiveChatChannel" && id.ChatChannel == c.channel
+	return id.ChatChannel, true
 }
 
-func (c *Client) readLoop(conn *websocket.Conn, messages chan<- message.Message) error {
+// extraSubscription returns the extra subscription a cable message's
+// identifier refers to, if any.
+func (c *Client) extraSubscription(rawIdentifier string) (extraSubscription, bool) {
+	for _, ext := range c.extras {
+		if ext.matches(rawIdentifier) {
+			return ext, true
+		}
+	}
+	return extraSubscription{}, false
+}
+
+// subscriptionLabel returns the label session tracks a subscription by:
+// the chat slug for the chat channel class, or the extra subscription's label.
+func (c *Client) subscriptionLabel(rawIdentifier string) (string, bool) {
+	if channel, ok := c.subscribedChannel(rawIdentifier); ok {
+		return channel, true
+	}
+	if ext, ok := c.extraSubscription(rawIdentifier); ok {
+		return ext.label, true
+	}
+	return "", false
+}
+
+// readLoop dispatches cable frames until the connection fails, reporting
+// confirmed subscriptions on confirmed. The read deadline is pushed out on
+// every ping, so a server that stops pinging (a half-dead connection)
+// surfaces as a stale error within staleThreshold.
+func (c *Client) readLoop(ctx context.Context, conn *websocket.Conn, messages chan<- message.Message, confirmed chan<- string) error {
+	lastPing := time.Now()
+	conn.SetReadDeadline(lastPing.Add(c.staleThreshold))
 	for {
 		var raw cableMessage
 		if err := conn.ReadJSON(&raw); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("connection stale: no ping for %s", time.Since(lastPing).Round(time.Second))
+			}
 			return fmt.Errorf("read error: %w", err)
 		}
 
 		// Handle ActionCable protocol messages
 		switch raw.Type {
 		case "ping":
+			lastPing = time.Now()
+			conn.SetReadDeadline(lastPing.Add(c.staleThreshold))
 			continue
 		case "confirm_subscription":
+			if label, ok := c.subscriptionLabel(raw.Identifier); ok {
+				select {
+				case confirmed <- label:
+				default:
+				}
+			}
 			continue
 		case "reject_subscription":
-			return fmt.Errorf("subscription rejected for channel %q", c.channel)
+			label, _ := c.subscriptionLabel(raw.Identifier)
+			return &permanentError{fmt.Errorf("%w for channel %q", ErrSubscriptionRejected, label)}
 		case "disconnect":
-			return fmt.Errorf("server disconnected: %s", string(raw.Message))
+			return disconnectError(raw)
 		}
 
-		// Skip messages not for our subscription
-		if !c.matchesSubscription(raw.Identifier) {
+		// Data message — parse the inner message
+		if raw.Message == nil {
 			continue
 		}
 
-		// Data message — parse the inner message
-		if raw.Message == nil {
+		// Extra channels are surfaced as system events; skip messages
+		// not for any of our subscriptions
+		channel, ok := c.subscribedChannel(raw.Identifier)
+		if !ok {
+			if ext, isExtra := c.extraSubscription(raw.Identifier); isExtra {
+				if !emit(ctx, messages, c.withRaw(systemEvent(ext.class, raw.Message, c.clock.Now()), raw.Message)) {
+					return ctx.Err()
+				}
+			}
 			continue
 		}
 
@@ -205,34 +822,243 @@ func (c *Client) readLoop(conn *websocket.Conn, messages chan<- message.Message)
 			if err := json.Unmarshal(raw.Message, &init); err != nil {
 				continue
 			}
-			for _, pkt := range init.Packets {
-				if pkt.Dropped {
-					continue
+			start := 0
+			if !c.primed[channel] {
+				start = c.historyStart(init.Packets)
+			}
+			// Remember the part of the first backlog not shown
+			for _, pkt := range init.Packets[:start] {
+				c.seen.add(pkt.ID)
+			}
+			payloads := c.packetPayloads(raw.Message)
+			for i, pkt := range init.Packets[start:] {
+				var payload json.RawMessage
+				if payloads != nil {
+					payload = payloads[start+i]
+				}
+				if !c.deliver(ctx, pkt, channel, payload, messages) {
+					return ctx.Err()
 				}
-				messages <- packetToMessage(pkt)
 			}
+			c.primed[channel] = true
 		case "new_packet":
 			var np newPacketMessage
 			if err := json.Unmarshal(raw.Message, &np); err != nil {
 				continue
 			}
-			if np.Packet.Dropped {
+			if !c.deliver(ctx, np.Packet, channel, raw.Message, messages) {
+				return ctx.Err()
+			}
+		case "packet_dropped", "packet_updated":
+			var np newPacketMessage
+			if err := json.Unmarshal(raw.Message, &np); err != nil {
+				continue
+			}
+			if !emit(ctx, messages, c.withRaw(packetChange(envelope.Type, np.Packet, channel, c.clock.Now()), raw.Message)) {
+				return ctx.Err()
+			}
+		case "hackr_joined", "hackr_left":
+			var pm presenceMessage
+			if err := json.Unmarshal(raw.Message, &pm); err != nil || pm.GridHackr.HackrAlias == "" {
 				continue
 			}
-			messages <- packetToMessage(np.Packet)
+			c.setPresent(channel, pm.GridHackr.HackrAlias, pm.Type == "hackr_joined")
+			if !emit(ctx, messages, c.withRaw(presenceEvent(pm, channel, c.clock.Now()), raw.Message)) {
+				return ctx.Err()
+			}
 		}
 	}
 }
 
-func packetToMessage(pkt packet) message.Message {
+// historyStart returns where the shown part of a channel's first
+// backlog begins: the end with SkipHistory, and with HistoryLast the
+// newest that many packets, not counting dropped ones.
+func (c *Client) historyStart(packets []packet) int {
+	switch {
+	case c.skipHistory:
+		return len(packets)
+	case c.historyLast <= 0:
+		return 0
+	}
+	shown := 0
+	for i := len(packets) - 1; i >= 0; i-- {
+		if packets[i].Dropped {
+			continue
+		}
+		if shown++; shown == c.historyLast {
+			return i
+		}
+	}
+	return 0
+}
+
+// setPresent records that alias joined or left channel.
+func (c *Client) setPresent(channel, alias string, joined bool) {
+	c.presentMu.Lock()
+	defer c.presentMu.Unlock()
+	set := c.present[channel]
+	if set == nil {
+		set = make(map[string]bool)
+		c.present[channel] = set
+	}
+	if joined {
+		set[alias] = true
+	} else {
+		delete(set, alias)
+	}
+}
+
+// Present returns the hackrs seen joining channel and not since leaving,
+// sorted by alias. Hackrs who were already connected before the relay
+// are not known until they rejoin.
+func (c *Client) Present(channel string) []string {
+	c.presentMu.Lock()
+	defer c.presentMu.Unlock()
+	out := make([]string, 0, len(c.present[channel]))
+	for alias := range c.present[channel] {
+		out = append(out, alias)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// packetPayloads returns the JSON of each packet in an initial_packets
+// message, so each message keeps only its own, or nil when raw payloads
+// aren't kept.
+func (c *Client) packetPayloads(data json.RawMessage) []json.RawMessage {
+	if !c.keepRaw {
+		return nil
+	}
+	var batch struct {
+		Packets []json.RawMessage `json:"packets"`
+	}
+	json.Unmarshal(data, &batch)
+	return batch.Packets
+}
+
+// withRaw sets msg's Raw to payload when the client keeps raw payloads.
+func (c *Client) withRaw(msg message.Message, payload json.RawMessage) message.Message {
+	if c.keepRaw {
+		msg.Raw = string(payload)
+	}
+	return msg
+}
+
+// deliver emits pkt, tagged with the chat channel it arrived on, unless
+// it was dropped, has already been delivered, or is a bridge echo. It
+// returns false if ctx ended first.
+func (c *Client) deliver(ctx context.Context, pkt packet, channel string, payload json.RawMessage, messages chan<- message.Message) bool {
+	if pkt.Dropped || !c.seen.add(pkt.ID) {
+		return true
+	}
+	if c.echoes != nil && strings.EqualFold(pkt.GridHackr.HackrAlias, c.alias) && c.echoes.Echo(strconv.Itoa(pkt.ID), echoWait) {
+		return true
+	}
+	return emit(ctx, messages, c.withRaw(packetToMessage(pkt, channel, c.clock.Now()), payload))
+}
+
+// emit hands msg to messages, reporting false if ctx ended first, so a
+// stalled reader can't keep the read loop from exiting.
+func emit(ctx context.Context, messages chan<- message.Message, msg message.Message) bool {
+	select {
+	case messages <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// systemEvent surfaces a broadcast from an extra channel. A payload's
+// "type" becomes the username and its "message" (or "text") the content;
+// payloads without either are shown as raw JSON.
+func systemEvent(class string, payload json.RawMessage, now time.Time) message.Message {
+	var fields struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Text    string `json:"text"`
+	}
+	json.Unmarshal(payload, &fields)
+
+	content := cmp.Or(fields.Message, fields.Text)
+	if content == "" {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, payload); err != nil {
+			buf.Reset()
+			buf.Write(payload)
+		}
+		content = buf.String()
+	}
+	return message.Message{
+		Platform:  message.HackrTV,
+		Type:      message.TypeSystem,
+		ID:        message.NewID(),
+		Channel:   class,
+		Username:  cmp.Or(fields.Type, "system"),
+		Timestamp: now,
+		Content:   content,
+	}
+}
+
+// presenceEvent turns a presence broadcast into a system line such as
+// "xeraen connected (12 online)".
+func presenceEvent(pm presenceMessage, channel string, now time.Time) message.Message {
+	key := i18n.PresenceConnected
+	if pm.Type == "hackr_left" {
+		key = i18n.PresenceDisconnected
+	}
+	content := i18n.T(key, pm.GridHackr.HackrAlias)
+	if pm.OnlineCount != nil {
+		content = i18n.T(i18n.PresenceOnline, content, *pm.OnlineCount)
+	}
+	return message.Message{
+		Platform:  message.HackrTV,
+		Type:      message.TypeSystem,
+		ID:        message.NewID(),
+		Channel:   channel,
+		Username:  pm.GridHackr.HackrAlias,
+		Role:      pm.GridHackr.Role,
+		Timestamp: now,
+		Content:   content,
+	}
+}
+
+// packetChange turns a packet_dropped or packet_updated broadcast into a
+// deletion or edit event targeting the original packet.
+func packetChange(kind string, pkt packet, channel string, now time.Time) message.Message {
+	msg := message.Message{
+		Platform:  message.HackrTV,
+		Type:      message.TypeEdit,
+		ID:        message.NewID(),
+		TargetID:  strconv.Itoa(pkt.ID),
+		Channel:   channel,
+		Username:  pkt.GridHackr.HackrAlias,
+		Timestamp: now,
+		Content:   i18n.T(i18n.MessageEdited, pkt.GridHackr.HackrAlias, pkt.Content),
+	}
+	if kind == "packet_dropped" {
+		msg.Type = message.TypeDeletion
+		msg.Content = i18n.T(i18n.MessageDropped, pkt.GridHackr.HackrAlias)
+	}
+	return msg
+}
+
+func packetToMessage(pkt packet, channel string, now time.Time) message.Message {
 	ts, err := time.Parse(time.RFC3339, pkt.CreatedAt)
 	if err != nil {
-		ts = time.Now()
+		ts = now
 	}
-	return message.Message{
+	msg := message.Message{
 		Platform:  message.HackrTV,
+		ID:        strconv.Itoa(pkt.ID),
+		Channel:   channel,
 		Username:  pkt.GridHackr.HackrAlias,
+		Role:      pkt.GridHackr.Role,
 		Timestamp: ts,
 		Content:   pkt.Content,
 	}
+	if r := pkt.ReplyTo; r != nil && r.ID != 0 {
+		msg.ReplyToID = strconv.Itoa(r.ID)
+		msg.ReplyToUser = r.GridHackr.HackrAlias
+	}
+	return msg
 }
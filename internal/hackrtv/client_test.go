@@ -3,18 +3,25 @@ package hackrtv
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"relay/internal/echo"
+	"relay/internal/i18n"
 	"relay/internal/message"
+	"relay/internal/relaytest"
 )
 
-func TestMatchesSubscription(t *testing.T) {
-	c := NewClient("ws://localhost/cable", "", "", "main")
+func TestSubscribedChannel(t *testing.T) {
+	c := NewClient("ws://localhost/cable", "", "", []string{"main", "dev"}, Options{})
 
 	tests := []struct {
 		name       string
@@ -61,18 +68,41 @@ func TestMatchesSubscription(t *testing.T) {
 			identifier: `{"channel":"LiveChatChannel","chat_channel":"main","extra":"field"}`,
 			want:       true,
 		},
+		{
+			name:       "second subscribed channel",
+			identifier: `{"channel":"LiveChatChannel","chat_channel":"dev"}`,
+			want:       true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := c.matchesSubscription(tt.identifier)
+			_, got := c.subscribedChannel(tt.identifier)
 			if got != tt.want {
-				t.Errorf("matchesSubscription(%q) = %v, want %v", tt.identifier, got, tt.want)
+				t.Errorf("subscribedChannel(%q) = %v, want %v", tt.identifier, got, tt.want)
 			}
 		})
 	}
 }
 
+func TestCustomChannelClass(t *testing.T) {
+	c := NewClient("ws://localhost/cable", "", "", []string{"main"}, Options{ChannelClass: "EventsChannel"})
+
+	id, err := c.identifier("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != `{"channel":"EventsChannel","chat_channel":"main"}` {
+		t.Errorf("identifier = %s", id)
+	}
+	if _, ok := c.subscribedChannel(id); !ok {
+		t.Error("custom class identifier should match")
+	}
+	if _, ok := c.subscribedChannel(`{"channel":"LiveChatChannel","chat_channel":"main"}`); ok {
+		t.Error("default class should not match when another is configured")
+	}
+}
+
 func TestPacketToMessage(t *testing.T) {
 	pkt := packet{
 		ID:        42,
@@ -84,7 +114,7 @@ func TestPacketToMessage(t *testing.T) {
 	pkt.GridHackr.HackrAlias = "xeraen"
 	pkt.GridHackr.Role = "admin"
 
-	msg := packetToMessage(pkt)
+	msg := packetToMessage(pkt, "main", time.Now())
 
 	if msg.Platform != message.HackrTV {
 		t.Errorf("Platform = %v, want HackrTV", msg.Platform)
@@ -92,9 +122,18 @@ func TestPacketToMessage(t *testing.T) {
 	if msg.Username != "xeraen" {
 		t.Errorf("Username = %q, want %q", msg.Username, "xeraen")
 	}
+	if msg.ID != "42" {
+		t.Errorf("ID = %q, want %q", msg.ID, "42")
+	}
 	if msg.Content != "hello grid" {
 		t.Errorf("Content = %q, want %q", msg.Content, "hello grid")
 	}
+	if msg.Channel != "main" {
+		t.Errorf("Channel = %q, want %q", msg.Channel, "main")
+	}
+	if msg.Role != "admin" {
+		t.Errorf("Role = %q, want %q", msg.Role, "admin")
+	}
 	expectedTime := time.Date(2025, 6, 15, 10, 30, 0, 0, time.UTC)
 	if !msg.Timestamp.Equal(expectedTime) {
 		t.Errorf("Timestamp = %v, want %v", msg.Timestamp, expectedTime)
@@ -109,7 +148,7 @@ func TestPacketToMessageInvalidTimestamp(t *testing.T) {
 	pkt.GridHackr.HackrAlias = "user"
 
 	before := time.Now()
-	msg := packetToMessage(pkt)
+	msg := packetToMessage(pkt, "main", time.Now())
 	after := time.Now()
 
 	if msg.Timestamp.Before(before) || msg.Timestamp.After(after) {
@@ -117,8 +156,25 @@ func TestPacketToMessageInvalidTimestamp(t *testing.T) {
 	}
 }
 
+func TestPacketToMessageReply(t *testing.T) {
+	var pkt packet
+	data := `{"id":8,"content":"same here","grid_hackr":{"hackr_alias":"n0va"},"reply_to":{"id":7,"grid_hackr":{"hackr_alias":"xeraen"}}}`
+	if err := json.Unmarshal([]byte(data), &pkt); err != nil {
+		t.Fatal(err)
+	}
+	msg := packetToMessage(pkt, "main", time.Now())
+	if msg.ReplyToID != "7" || msg.ReplyToUser != "xeraen" {
+		t.Errorf("reply to %q from %q, want packet 7 from xeraen", msg.ReplyToID, msg.ReplyToUser)
+	}
+
+	pkt.ReplyTo = nil
+	if msg := packetToMessage(pkt, "main", time.Now()); msg.ReplyToID != "" || msg.ReplyToUser != "" {
+		t.Errorf("packet without reply_to replies to %q from %q", msg.ReplyToID, msg.ReplyToUser)
+	}
+}
+
 func TestNewClient(t *testing.T) {
-	c := NewClient("ws://localhost/cable", "secret", "relay", "main")
+	c := NewClient("ws://localhost/cable", "secret", "relay", []string{"main"}, Options{})
 
 	if c.wsURL != "ws://localhost/cable" {
 		t.Errorf("wsURL = %q", c.wsURL)
@@ -129,8 +185,8 @@ func TestNewClient(t *testing.T) {
 	if c.alias != "relay" {
 		t.Errorf("alias = %q", c.alias)
 	}
-	if c.channel != "main" {
-		t.Errorf("channel = %q", c.channel)
+	if len(c.channels) != 1 || c.channels[0] != "main" {
+		t.Errorf("channels = %q", c.channels)
 	}
 }
 
@@ -236,25 +292,38 @@ func TestConnectFullProtocol(t *testing.T) {
 	defer server.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
-	client := NewClient(wsURL, "test_token", "relay", "main")
+	client := NewClient(wsURL, "test_token", "relay", []string{"main"}, Options{})
 
 	messages := make(chan message.Message, 10)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Connect will return when server closes the connection
-	client.Connect(ctx, messages)
-	close(messages)
-
+	// The server closes after one batch; take the first session's
+	// messages and stop Connect before it reconnects.
 	var received []message.Message
-	for msg := range messages {
-		received = append(received, msg)
-	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		for len(received) < 2 {
+			select {
+			case msg := <-messages:
+				received = append(received, msg)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	client.Connect(ctx, messages)
+	<-done
 
 	// Should get 2 messages: 1 from initial (dropped filtered) + 1 new (dropped filtered)
 	if len(received) != 2 {
 		t.Fatalf("expected 2 messages, got %d: %+v", len(received), received)
 	}
+	if len(messages) != 0 {
+		t.Errorf("unexpected extra messages: %d", len(messages))
+	}
 
 	if received[0].Content != "old msg" {
 		t.Errorf("msg[0].Content = %q, want %q", received[0].Content, "old msg")
@@ -302,13 +371,13 @@ func TestConnectNoToken(t *testing.T) {
 	defer server.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
-	client := NewClient(wsURL, "", "relay", "main")
+	client := NewClient(wsURL, "", "relay", []string{"main"}, Options{})
 
 	messages := make(chan message.Message, 10)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	client.Connect(ctx, messages)
+	client.session(ctx, messages)
 	// No assertion needed — just verify no panic/crash with empty token
 }
 
@@ -331,15 +400,15 @@ func TestConnectRejectedSubscription(t *testing.T) {
 	defer server.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
-	client := NewClient(wsURL, "token", "relay", "main")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
 
 	messages := make(chan message.Message, 10)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	err := client.Connect(ctx, messages)
-	if err == nil || !strings.Contains(err.Error(), "subscription rejected") {
-		t.Errorf("expected subscription rejected error, got: %v", err)
+	if !errors.Is(err, ErrSubscriptionRejected) || !strings.Contains(err.Error(), `channel "main"`) {
+		t.Errorf("expected subscription rejected error for the channel, got: %v", err)
 	}
 }
 
@@ -352,19 +421,1013 @@ func TestConnectBadWelcome(t *testing.T) {
 		defer conn.Close()
 
 		// Send wrong type instead of welcome
-		conn.WriteJSON(cableMessage{Type: "disconnect"})
+		conn.WriteJSON(cableMessage{Type: "ping"})
 	}))
 	defer server.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
-	client := NewClient(wsURL, "", "", "main")
+	client := NewClient(wsURL, "", "", []string{"main"}, Options{})
 
 	messages := make(chan message.Message, 10)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := client.Connect(ctx, messages)
+	// A bad welcome is retried by Connect, so check a single session.
+	_, err := client.session(ctx, messages)
 	if err == nil || !strings.Contains(err.Error(), "expected welcome") {
 		t.Errorf("expected welcome error, got: %v", err)
 	}
 }
+
+func TestConnectDisconnectFrames(t *testing.T) {
+	no, yes := false, true
+	tests := []struct {
+		name      string
+		frame     cableMessage
+		permanent bool
+	}{
+		{"unauthorized", cableMessage{Type: "disconnect", Reason: "unauthorized", Reconnect: &no}, true},
+		{"server restart", cableMessage{Type: "disconnect", Reason: "server_restart", Reconnect: &yes}, false},
+		{"no hint", cableMessage{Type: "disconnect"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var dials int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				mu.Lock()
+				dials++
+				mu.Unlock()
+
+				// Rails sends the disconnect in place of a welcome.
+				conn.WriteJSON(tt.frame)
+			}))
+			defer server.Close()
+
+			wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+			client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+			client.minBackoff = 10 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := client.Connect(ctx, make(chan message.Message, 1))
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.permanent {
+				if !errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), "server disconnected") {
+					t.Errorf("Connect() error = %v, want server disconnected: %v", err, ErrAuth)
+				}
+				if dials != 1 {
+					t.Errorf("dials = %d, want no reconnect", dials)
+				}
+				return
+			}
+			if err != context.DeadlineExceeded {
+				t.Errorf("Connect() error = %v, want reconnects until deadline", err)
+			}
+			if dials < 2 {
+				t.Errorf("dials = %d, want reconnect", dials)
+			}
+		})
+	}
+}
+
+func TestConnectMultipleChannels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		for id := 1; id <= 2; id++ {
+			var sub cableMessage
+			if err := conn.ReadJSON(&sub); err != nil || sub.Command != "subscribe" {
+				return
+			}
+			conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+			var ident channelIdentifier
+			json.Unmarshal([]byte(sub.Identifier), &ident)
+			pkt := packet{ID: id, Content: "hi " + ident.ChatChannel, CreatedAt: "2025-01-01T00:00:00Z"}
+			payload, _ := json.Marshal(newPacketMessage{Type: "new_packet", Packet: pkt})
+			conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"live", "dev"}, Options{})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go client.Connect(ctx, messages)
+
+	for _, want := range []string{"live", "dev"} {
+		select {
+		case msg := <-messages:
+			if msg.Channel != want || msg.Content != "hi "+want {
+				t.Errorf("got %q on %q, want a packet from %q", msg.Content, msg.Channel, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for a packet from %q", want)
+		}
+	}
+}
+
+func TestConnectPacketChanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		pkt := packet{ID: 7, Content: "helo", CreatedAt: "2025-01-01T00:00:00Z"}
+		pkt.GridHackr.HackrAlias = "xeraen"
+		for _, kind := range []string{"new_packet", "packet_updated", "packet_dropped"} {
+			if kind == "packet_updated" {
+				pkt.Content = "hello"
+			}
+			if kind == "packet_dropped" {
+				pkt.Dropped = true
+			}
+			payload, _ := json.Marshal(newPacketMessage{Type: kind, Packet: pkt})
+			conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go client.Connect(ctx, messages)
+
+	// Edits and deletions get IDs of their own, generated as hackr.tv
+	// sends none
+	want := []struct {
+		typ     message.Type
+		id      string
+		content string
+	}{
+		{message.TypeChat, "7", "helo"},
+		{message.TypeEdit, "", "message from xeraen edited: hello"},
+		{message.TypeDeletion, "", "message from xeraen dropped"},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-messages:
+			idOK := msg.ID == w.id || (w.id == "" && msg.ID != "" && msg.ID != "7")
+			if msg.Type != w.typ || !idOK || msg.Content != w.content {
+				t.Errorf("got %v %q %q, want %v %q %q", msg.Type, msg.ID, msg.Content, w.typ, w.id, w.content)
+			}
+			if w.typ != message.TypeChat && msg.TargetID != "7" {
+				t.Errorf("%v TargetID = %q, want 7", msg.Type, msg.TargetID)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %v", w.typ)
+		}
+	}
+}
+
+func TestPacketChangeLocale(t *testing.T) {
+	if err := i18n.Set("fr"); err != nil {
+		t.Fatal(err)
+	}
+	defer i18n.Set(i18n.DefaultTag)
+
+	var pkt packet
+	pkt.ID = 7
+	pkt.Content = "corrigé"
+	pkt.GridHackr.HackrAlias = "xeraen"
+	now := time.Now()
+	if got, want := packetChange("packet_updated", pkt, "live", now).Content, "message de xeraen modifié : corrigé"; got != want {
+		t.Errorf("packet_updated content = %q, want %q", got, want)
+	}
+	if got, want := packetChange("packet_dropped", pkt, "live", now).Content, "message de xeraen retiré"; got != want {
+		t.Errorf("packet_dropped content = %q, want %q", got, want)
+	}
+}
+
+func TestConnectPresence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		for _, payload := range []string{
+			`{"type":"hackr_joined","grid_hackr":{"hackr_alias":"xeraen","role":"admin"},"online_count":2}`,
+			`{"type":"hackr_joined","grid_hackr":{"hackr_alias":"ashlinn"}}`,
+			`{"type":"hackr_left","grid_hackr":{"hackr_alias":"xeraen"},"online_count":1}`,
+		} {
+			conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: json.RawMessage(payload)})
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go client.Connect(ctx, messages)
+
+	want := []struct{ username, content string }{
+		{"xeraen", "xeraen connected (2 online)"},
+		{"ashlinn", "ashlinn connected"},
+		{"xeraen", "xeraen disconnected (1 online)"},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-messages:
+			if msg.Type != message.TypeSystem || msg.Channel != "main" || msg.Username != w.username || msg.Content != w.content {
+				t.Errorf("got %v #%s %s: %q, want system #main %s: %q", msg.Type, msg.Channel, msg.Username, msg.Content, w.username, w.content)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %q", w.content)
+		}
+	}
+
+	if got := client.Present("main"); !slices.Equal(got, []string{"ashlinn"}) {
+		t.Errorf("Present(main) = %q, want [ashlinn]", got)
+	}
+}
+
+func TestConnectExtraSubscriptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var chat, extra cableMessage
+		conn.ReadJSON(&chat)
+		conn.ReadJSON(&extra)
+		if !strings.Contains(extra.Identifier, `"channel":"NotificationsChannel"`) || !strings.Contains(extra.Identifier, `"hackr_id":7`) {
+			t.Errorf("extra identifier = %s", extra.Identifier)
+		}
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: chat.Identifier})
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: extra.Identifier})
+
+		conn.WriteJSON(cableMessage{Identifier: extra.Identifier, Message: json.RawMessage(`{"type":"achievement","message":"XERAEN unlocked Root"}`)})
+		conn.WriteJSON(cableMessage{Identifier: extra.Identifier, Message: json.RawMessage(`{"viewers": 42}`)})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{
+		ConfirmTimeout: 100 * time.Millisecond,
+		Subscriptions:  []Subscription{{Channel: "NotificationsChannel", Params: map[string]any{"hackr_id": int64(7)}}},
+	})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect(ctx, messages) }()
+
+	want := []struct{ username, content string }{
+		{"achievement", "XERAEN unlocked Root"},
+		{"system", `{"viewers":42}`},
+	}
+	for _, w := range want {
+		select {
+		case msg := <-messages:
+			if msg.Type != message.TypeSystem || msg.Channel != "NotificationsChannel" || msg.Username != w.username || msg.Content != w.content {
+				t.Errorf("got %v #%s %s: %q, want system #NotificationsChannel %s: %q", msg.Type, msg.Channel, msg.Username, msg.Content, w.username, w.content)
+			}
+		case err := <-errc:
+			t.Fatalf("Connect() returned early: %v", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for system event")
+		}
+	}
+
+	// Both subscriptions were confirmed, so the confirmation timeout
+	// must not end the session.
+	select {
+	case err := <-errc:
+		t.Fatalf("Connect() returned: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestPerformNotConnected(t *testing.T) {
+	c := NewClient("ws://localhost/cable", "token", "relay", []string{"main"}, Options{})
+
+	err := c.Perform(context.Background(), "send_packet", map[string]any{"content": "hi"})
+	if err != ErrNotConnected {
+		t.Errorf("Perform() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestPerformSendsMessageCommand(t *testing.T) {
+	performed := make(chan cableMessage, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		var cmd cableMessage
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		performed <- cmd
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go client.Connect(ctx, make(chan message.Message, 10))
+
+	// Retry until Connect has registered the live connection
+	for {
+		err := client.Perform(ctx, "send_packet", map[string]any{"content": "[TTV] user: hi"})
+		if err == nil {
+			break
+		}
+		if err != ErrNotConnected {
+			t.Fatalf("Perform() error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for connection")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var cmd cableMessage
+	select {
+	case cmd = <-performed:
+	case <-ctx.Done():
+		t.Fatal("server never received the message command")
+	}
+
+	if cmd.Command != "message" {
+		t.Errorf("Command = %q, want %q", cmd.Command, "message")
+	}
+	if channel, ok := client.subscribedChannel(cmd.Identifier); !ok || channel != "main" {
+		t.Errorf("Identifier = %q does not match the primary subscription", cmd.Identifier)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal([]byte(cmd.Data), &data); err != nil {
+		t.Fatalf("invalid data JSON: %v", err)
+	}
+	if data["action"] != "send_packet" {
+		t.Errorf("action = %v, want send_packet", data["action"])
+	}
+	if data["content"] != "[TTV] user: hi" {
+		t.Errorf("content = %v", data["content"])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	performed := make(chan cableMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		if strings.Contains(sub.Identifier, "nope") {
+			conn.WriteJSON(cableMessage{Type: "reject_subscription", Identifier: sub.Identifier})
+			return
+		}
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+		// History must not hold up the check
+		initPayload, _ := json.Marshal(initialPacketsMessage{Type: "initial_packets", Packets: []packet{{ID: 1, Content: "old"}}})
+		conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: initPayload})
+
+		var cmd cableMessage
+		if err := conn.ReadJSON(&cmd); err == nil {
+			performed <- cmd
+		}
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+	err := client.Check(ctx, func(ctx context.Context) error {
+		return client.Perform(ctx, "send_packet", map[string]any{"content": "test"})
+	})
+	if err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+	select {
+	case <-performed:
+	case <-ctx.Done():
+		t.Fatal("the server never received the test send")
+	}
+
+	if err := client.Check(ctx, nil); err != nil {
+		t.Errorf("Check() without use = %v", err)
+	}
+
+	client = NewClient(wsURL, "token", "relay", []string{"nope"}, Options{})
+	if err := client.Check(ctx, nil); !errors.Is(err, ErrSubscriptionRejected) {
+		t.Errorf("Check() = %v, want ErrSubscriptionRejected", err)
+	}
+}
+
+// stalledServer confirms the subscription, sends packets, then stops
+// reading until the test ends.
+func stalledServer(t *testing.T, packets int) string {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+		for id := 1; id <= packets; id++ {
+			payload, _ := json.Marshal(newPacketMessage{Type: "new_packet", Packet: packet{ID: id, Content: "hi"}})
+			conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+		}
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestPerformGivesUpOnStalledConnection(t *testing.T) {
+	relaytest.NoLeaks(t, 2*time.Second)
+	client := NewClient(stalledServer(t, 0), "token", "relay", []string{"main"}, Options{WriteTimeout: 100 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Connect(ctx, make(chan message.Message, 10))
+	}()
+	defer func() { cancel(); <-done }()
+
+	// Frames go out until the socket buffers fill, then a write blocks
+	content := strings.Repeat("x", 1<<20)
+	deadline := time.Now().Add(10 * time.Second)
+	var err error
+	for err == nil || err == ErrNotConnected {
+		if time.Now().After(deadline) {
+			t.Fatal("Perform() never blocked")
+		}
+		start := time.Now()
+		err = client.Perform(ctx, "send_packet", map[string]any{"content": content})
+		if took := time.Since(start); took > 2*time.Second {
+			t.Fatalf("Perform() took %s with a 100ms write timeout", took)
+		}
+		if err == ErrNotConnected {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Perform() = %v, want a timeout", err)
+	}
+}
+
+func TestConnectReturnsWhenReaderStalls(t *testing.T) {
+	relaytest.NoLeaks(t, 2*time.Second)
+	client := NewClient(stalledServer(t, 3), "token", "relay", []string{"main"}, Options{})
+
+	// Nothing reads messages past the first
+	messages := make(chan message.Message)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Connect(ctx, messages) }()
+	select {
+	case <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Connect() = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connect() still blocked on a stalled reader after cancel")
+	}
+}
+
+func TestPacketSet(t *testing.T) {
+	s := newPacketSet(2)
+	if !s.add(1) || !s.add(2) {
+		t.Fatal("first adds should report new IDs")
+	}
+	if s.add(1) {
+		t.Error("add(1) again should report a duplicate")
+	}
+	// Adding a third ID evicts the oldest.
+	s.add(3)
+	if !s.add(1) {
+		t.Error("add(1) after eviction should report a new ID")
+	}
+}
+
+func TestConnectReconnectsWithoutReplaying(t *testing.T) {
+	var mu sync.Mutex
+	var subscribes int
+
+	newPacket := func(id int, content string) packet {
+		pkt := packet{ID: id, Content: content, CreatedAt: "2025-01-01T00:00:00Z"}
+		pkt.GridHackr.HackrAlias = "hackr"
+		return pkt
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		if err := conn.ReadJSON(&sub); err != nil || sub.Command != "subscribe" {
+			return
+		}
+		mu.Lock()
+		subscribes++
+		n := subscribes
+		mu.Unlock()
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		// Every session replays history; the second also has a new packet.
+		history := []packet{newPacket(1, "one"), newPacket(2, "two")}
+		if n > 1 {
+			history = append(history, newPacket(3, "three"))
+		}
+		payload, _ := json.Marshal(initialPacketsMessage{Type: "initial_packets", Packets: history})
+		conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+
+		if n == 1 {
+			// Drop the first connection abruptly.
+			return
+		}
+		// Keep later sessions open until the client goes away.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{})
+	client.minBackoff = 10 * time.Millisecond
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect(ctx, messages) }()
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case msg := <-messages:
+			got = append(got, msg.ID+":"+msg.Content)
+		case <-ctx.Done():
+			t.Fatalf("timed out; got %q", got)
+		}
+	}
+	// Give a stray duplicate a chance to arrive before stopping.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Connect() error = %v, want context.Canceled", err)
+	}
+
+	want := []string{"1:one", "2:two", "3:three"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if len(messages) != 0 {
+		t.Errorf("replayed history was delivered again: %d extra messages", len(messages))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if subscribes < 2 {
+		t.Errorf("subscribes = %d, want resubscribe after reconnect", subscribes)
+	}
+	if n := client.Reconnects(); n != int64(subscribes-1) {
+		t.Errorf("Reconnects() = %d, want %d", n, subscribes-1)
+	}
+}
+
+func TestConnectSkipHistory(t *testing.T) {
+	var mu sync.Mutex
+	var sessions int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		mu.Lock()
+		sessions++
+		n := sessions
+		mu.Unlock()
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		// The second session's history includes a packet sent while the
+		// client was disconnected.
+		history := []packet{{ID: 1, Content: "one"}, {ID: 2, Content: "two"}}
+		if n > 1 {
+			history = append(history, packet{ID: 3, Content: "missed"})
+		}
+		payload, _ := json.Marshal(initialPacketsMessage{Type: "initial_packets", Packets: history})
+		conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+
+		if n == 1 {
+			live, _ := json.Marshal(newPacketMessage{Type: "new_packet", Packet: packet{ID: 4, Content: "live"}})
+			conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: live})
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{SkipHistory: true})
+	client.minBackoff = 10 * time.Millisecond
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go client.Connect(ctx, messages)
+
+	for _, want := range []string{"live", "missed"} {
+		select {
+		case msg := <-messages:
+			if msg.Content != want {
+				t.Errorf("got %q, want %q", msg.Content, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(messages) != 0 {
+		t.Errorf("history was delivered: %d extra messages", len(messages))
+	}
+}
+
+func TestConnectHeaderAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		// legacy servers only accept query credentials
+		legacy    bool
+		wantQuery bool
+	}{
+		{"header accepted", false, false},
+		{"falls back to query", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var dials []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header := r.Header.Get("Authorization")
+				query := r.URL.Query().Get("token")
+				mu.Lock()
+				dials = append(dials, "header="+header+" query="+query)
+				mu.Unlock()
+
+				if tt.legacy && query == "" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.WriteJSON(cableMessage{Type: "welcome"})
+				var sub cableMessage
+				conn.ReadJSON(&sub)
+				conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+				payload, _ := json.Marshal(newPacketMessage{Type: "new_packet", Packet: packet{ID: 1, Content: "hi"}})
+				conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: payload})
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+			client := NewClient(wsURL, "secret", "relay", []string{"main"}, Options{HeaderAuth: true})
+			client.minBackoff = 10 * time.Millisecond
+
+			messages := make(chan message.Message, 1)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			go client.Connect(ctx, messages)
+
+			select {
+			case <-messages:
+			case <-ctx.Done():
+				t.Fatal("never connected")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if dials[0] != "header=Bearer relay:secret query=" {
+				t.Errorf("first dial = %q, want header credentials only", dials[0])
+			}
+			last := dials[len(dials)-1]
+			if tt.wantQuery && last != "header= query=secret" {
+				t.Errorf("fallback dial = %q, want query credentials only", last)
+			}
+			if !tt.wantQuery && len(dials) != 1 {
+				t.Errorf("dials = %q, want a single header-authenticated dial", dials)
+			}
+		})
+	}
+}
+
+func TestNewClientStaleThreshold(t *testing.T) {
+	if c := NewClient("ws://localhost/cable", "", "", []string{"main"}, Options{}); c.staleThreshold != 10*time.Second {
+		t.Errorf("default staleThreshold = %v, want 10s", c.staleThreshold)
+	}
+	if c := NewClient("ws://localhost/cable", "", "", []string{"main"}, Options{StaleThreshold: time.Minute}); c.staleThreshold != time.Minute {
+		t.Errorf("staleThreshold = %v, want 1m", c.staleThreshold)
+	}
+	if c := NewClient("ws://localhost/cable", "", "", []string{"main"}, Options{}); c.confirmTimeout != 5*time.Second {
+		t.Errorf("default confirmTimeout = %v, want 5s", c.confirmTimeout)
+	}
+}
+
+func TestConnectUnconfirmedSubscription(t *testing.T) {
+	subscribes := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		for {
+			var sub cableMessage
+			if err := conn.ReadJSON(&sub); err != nil {
+				return
+			}
+			var ident channelIdentifier
+			json.Unmarshal([]byte(sub.Identifier), &ident)
+			subscribes <- ident.ChatChannel
+			// Only "live" exists; "typo" is silently never confirmed.
+			if ident.ChatChannel == "live" {
+				conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"live", "typo"}, Options{ConfirmTimeout: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.Connect(ctx, make(chan message.Message, 1))
+	if !errors.Is(err, ErrUnconfirmed) || !strings.Contains(err.Error(), `no subscription confirmation for channel(s) typo within 50ms`) {
+		t.Fatalf("Connect() error = %v, want confirmation timeout for typo", err)
+	}
+
+	var got []string
+	for len(subscribes) > 0 {
+		got = append(got, <-subscribes)
+	}
+	if want := "live,typo,typo"; strings.Join(got, ",") != want {
+		t.Errorf("subscribes = %q, want %s (one retry for the unconfirmed channel)", got, want)
+	}
+}
+
+func TestSessionStaleWithoutPings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		conn.ReadJSON(&sub)
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+
+		// A few pings, then silence while keeping the socket open.
+		for i := 0; i < 3; i++ {
+			conn.WriteJSON(cableMessage{Type: "ping"})
+			time.Sleep(20 * time.Millisecond)
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "", "", []string{"main"}, Options{StaleThreshold: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	established, err := client.session(ctx, make(chan message.Message, 1))
+	if !established {
+		t.Error("session should report it was established")
+	}
+	if err == nil || !strings.Contains(err.Error(), "connection stale") {
+		t.Errorf("expected stale error, got %v", err)
+	}
+}
+
+func TestHistoryStart(t *testing.T) {
+	packets := []packet{{ID: 1}, {ID: 2}, {ID: 3, Dropped: true}, {ID: 4}}
+	tests := []struct {
+		opts Options
+		want int
+	}{
+		{Options{}, 0},
+		{Options{SkipHistory: true}, 4},
+		{Options{HistoryLast: 1}, 3},
+		{Options{HistoryLast: 2}, 1},
+		{Options{HistoryLast: 10}, 0},
+	}
+	for _, tt := range tests {
+		c := NewClient("ws://localhost/cable", "token", "relay", []string{"main"}, tt.opts)
+		if got := c.historyStart(packets); got != tt.want {
+			t.Errorf("historyStart(%+v) = %d, want %d", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverDropsEchoes(t *testing.T) {
+	echoes := echo.New()
+	echoes.Begin()("2", true)
+	c := NewClient("ws://localhost/cable", "token", "relay", []string{"main"}, Options{Echoes: echoes})
+
+	messages := make(chan message.Message, 4)
+	pkt := func(id int, alias string) packet {
+		p := packet{ID: id, Content: "[TTV] viewer: hi"}
+		p.GridHackr.HackrAlias = alias
+		return p
+	}
+	c.deliver(context.Background(), pkt(1, "relay"), "main", nil, messages)
+	c.deliver(context.Background(), pkt(2, "relay"), "main", nil, messages)
+	// Someone else's packet is never an echo, whatever its content
+	c.deliver(context.Background(), pkt(3, "xeraen"), "main", nil, messages)
+	close(messages)
+
+	var ids []string
+	for msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	if strings.Join(ids, ",") != "1,3" {
+		t.Errorf("delivered %v, want 1 and 3 without the echoed packet 2", ids)
+	}
+}
+
+func TestConnectKeepsRaw(t *testing.T) {
+	history := []packet{{ID: 1, Content: "old"}, {ID: 2, Content: "recent"}}
+	initPayload, _ := json.Marshal(initialPacketsMessage{Type: "initial_packets", Packets: history})
+	recent, _ := json.Marshal(history[1])
+	live, _ := json.Marshal(newPacketMessage{Type: "new_packet", Packet: packet{ID: 3, Content: "live"}})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(cableMessage{Type: "welcome"})
+		var sub cableMessage
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		conn.WriteJSON(cableMessage{Type: "confirm_subscription", Identifier: sub.Identifier})
+		conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: initPayload})
+		conn.WriteJSON(cableMessage{Identifier: sub.Identifier, Message: live})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewClient(wsURL, "token", "relay", []string{"main"}, Options{HistoryLast: 1, KeepRaw: true})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go client.Connect(ctx, messages)
+
+	// A history packet keeps its own JSON, not the whole batch
+	for _, want := range []string{string(recent), string(live)} {
+		select {
+		case msg := <-messages:
+			if msg.Raw != want {
+				t.Errorf("%q: Raw = %s, want %s", msg.Content, msg.Raw, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package highlight
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/retention"
+)
+
+// Recorder keeps the most recent window of merged chat so a clip can
+// snapshot what was just said.
+type Recorder struct {
+	mu     sync.Mutex
+	window time.Duration
+	msgs   []message.Message
+}
+
+// NewRecorder creates a Recorder that retains messages received within
+// window.
+func NewRecorder(window time.Duration) *Recorder {
+	return &Recorder{window: window}
+}
+
+// Window returns how far back the recorder remembers.
+func (r *Recorder) Window() time.Duration {
+	return r.window
+}
+
+// Add records msg, stamped with its arrival time when it has none, and
+// forgets messages older than the window.
+func (r *Recorder) Add(msg message.Message) {
+	now := time.Now()
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	cutoff := now.Add(-r.window)
+	i := 0
+	for i < len(r.msgs) && r.msgs[i].Timestamp.Before(cutoff) {
+		i++
+	}
+	r.msgs = r.msgs[i:]
+}
+
+// Since returns the recorded messages from the last d, oldest first.
+func (r *Recorder) Since(d time.Duration) []message.Message {
+	cutoff := time.Now().Add(-d)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []message.Message
+	for _, msg := range r.msgs {
+		if !msg.Timestamp.Before(cutoff) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// Clip is a highlight: a marker time plus the chat leading up to it.
+type Clip struct {
+	At       time.Time
+	Duration time.Duration
+	Note     string
+	// ClipURL is the Twitch clip's edit URL, when one was created.
+	ClipURL  string
+	Messages []message.Message
+}
+
+// Write formats c as a plain-text block:
+//
+//	=== CLIP 2025-01-15 14:32:05 (last 30s) great play ===
+//	twitch: https://clips.twitch.tv/.../edit
+//	14:31:40 [TTV] bob: what a shot
+//
+// A blank line ends the block.
+func (c Clip) Write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== CLIP %s (last %s)", c.At.Local().Format("2006-01-02 15:04:05"), c.Duration)
+	if c.Note != "" {
+		b.WriteString(" " + c.Note)
+	}
+	b.WriteString(" ===\n")
+	if c.ClipURL != "" {
+		fmt.Fprintf(&b, "twitch: %s\n", c.ClipURL)
+	}
+	for _, msg := range c.Messages {
+		fmt.Fprintf(&b, "%s [%s] %s: %s\n", msg.Timestamp.Local().Format("15:04:05"), msg.Platform, msg.Username, msg.Content)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fileMu keeps Prune from rewriting a highlights file under Append.
+var fileMu sync.Mutex
+
+// Append writes c to the end of the highlights file at path, creating it
+// if needed.
+func Append(path string, c Clip) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening highlights file: %w", err)
+	}
+	if err := c.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing highlight: %w", err)
+	}
+	return f.Close()
+}
+
+// clipHeader starts each clip block in a highlights file.
+const clipHeader = "=== CLIP "
+
+// Prune applies p to the highlights file at path, dropping clips older
+// than MaxAge and then the oldest while the file is over MaxSize. Text
+// before the first clip is kept unless space runs out. It reports how
+// many clips were dropped; a missing file has none.
+func Prune(path string, p retention.Policy, now time.Time) (int, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading highlights file: %w", err)
+	}
+
+	// Split into blocks at each header line
+	var blocks []string
+	var records []retention.Record
+	rest := string(data)
+	for rest != "" {
+		end := strings.Index(rest[1:], "\n"+clipHeader)
+		block := rest
+		if end >= 0 {
+			block = rest[:end+2]
+		}
+		rest = rest[len(block):]
+		var at time.Time
+		if stamp, ok := strings.CutPrefix(block, clipHeader); ok && len(stamp) >= len(time.DateTime) {
+			at, _ = time.ParseInLocation(time.DateTime, stamp[:len(time.DateTime)], time.Local)
+		}
+		blocks = append(blocks, block)
+		records = append(records, retention.Record{Time: at, Size: len(block)})
+	}
+
+	start := p.Keep(records, now)
+	dropped := 0
+	for _, r := range records[:start] {
+		if !r.Time.IsZero() {
+			dropped++
+		}
+	}
+	if start == 0 {
+		return 0, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(blocks[start:], "")), 0o644); err != nil {
+		return 0, fmt.Errorf("pruning highlights file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("pruning highlights file: %w", err)
+	}
+	return dropped, nil
+}
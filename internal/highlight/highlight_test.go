@@ -0,0 +1,96 @@
+package highlight
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/retention"
+)
+
+func TestRecorderWindow(t *testing.T) {
+	r := NewRecorder(time.Minute)
+	now := time.Now()
+	r.Add(message.Message{Username: "old", Timestamp: now.Add(-2 * time.Minute)})
+	r.Add(message.Message{Username: "mid", Timestamp: now.Add(-30 * time.Second)})
+	r.Add(message.Message{Username: "new"})
+
+	if got := len(r.msgs); got != 2 {
+		t.Errorf("recorder kept %d messages, want 2 within the window", got)
+	}
+
+	got := r.Since(10 * time.Second)
+	if len(got) != 1 || got[0].Username != "new" {
+		t.Errorf("Since(10s) = %+v, want only the new message", got)
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Error("Add should stamp messages without a timestamp")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "highlights.txt")
+	at := time.Date(2025, 1, 15, 14, 32, 5, 0, time.Local)
+	clip := Clip{
+		At:       at,
+		Duration: 30 * time.Second,
+		Note:     "great play",
+		ClipURL:  "https://clips.twitch.tv/Clip1/edit",
+		Messages: []message.Message{
+			{Platform: message.Twitch, Username: "bob", Timestamp: at.Add(-25 * time.Second), Content: "what a shot"},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := Append(path, clip); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "=== CLIP 2025-01-15 14:32:05 (last 30s) great play ===\n" +
+		"twitch: https://clips.twitch.tv/Clip1/edit\n" +
+		"14:31:40 [TTV] bob: what a shot\n\n"
+	if string(data) != want+want {
+		t.Errorf("highlights file =\n%s\nwant two copies of\n%s", data, want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "highlights.txt")
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.Local)
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		c := Clip{At: now.Add(-age), Duration: time.Minute, Note: "clip" + string(rune('1'+i)),
+			Messages: []message.Message{{Platform: message.Twitch, Username: "bob", Content: "pog", Timestamp: now.Add(-age)}}}
+		if err := Append(path, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := Prune(path, retention.Policy{MaxAge: 50 * time.Hour}, now)
+	if err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v; want the oldest clip dropped", n, err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "clip1") || !strings.HasPrefix(string(data), "=== CLIP ") || !strings.Contains(string(data), "clip2") {
+		t.Errorf("file after pruning by age:\n%s", data)
+	}
+
+	n, err = Prune(path, retention.Policy{MaxSize: int64(len(data)) - 1}, now)
+	if err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v; want one clip dropped to fit", n, err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Count(string(data), "=== CLIP ") != 1 || !strings.Contains(string(data), "clip3") {
+		t.Errorf("file after pruning by size:\n%s", data)
+	}
+
+	if n, err := Prune(filepath.Join(t.TempDir(), "missing.txt"), retention.Policy{MaxAge: time.Hour}, now); n != 0 || err != nil {
+		t.Errorf("Prune(missing) = %d, %v", n, err)
+	}
+}
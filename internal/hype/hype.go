@@ -0,0 +1,140 @@
+package hype
+
+import (
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+const (
+	defaultWindow      = 10 * time.Second
+	defaultBaseline    = 5 * time.Minute
+	defaultFactor      = 3.0
+	defaultMinMessages = 10
+	defaultCooldown    = time.Minute
+)
+
+// Options configures hype detection. Zero values use the defaults.
+type Options struct {
+	// Window is the span whose message count is compared against the
+	// baseline. Defaults to 10s.
+	Window time.Duration
+	// Baseline is how much earlier chat sets the normal rate. Detection
+	// starts once this much time has been observed. Defaults to 5m.
+	Baseline time.Duration
+	// Factor is how many times the baseline rate the window must reach.
+	// Defaults to 3.
+	Factor float64
+	// MinMessages is the fewest messages in a window that can count as
+	// hype, so a quiet chat waking up is not flagged. Defaults to 10.
+	MinMessages int
+	// Cooldown is the least time between hype events. Defaults to 1m.
+	Cooldown time.Duration
+	// Clock times message arrivals. Defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Detector watches chat velocity and reports bursts well above the
+// recent baseline.
+type Detector struct {
+	window      time.Duration
+	baseline    time.Duration
+	factor      float64
+	minMessages int
+	cooldown    time.Duration
+	clock       clock.Clock
+
+	mu       sync.Mutex
+	started  time.Time
+	times    []time.Time // chat arrivals within window+baseline, oldest first
+	lastHype time.Time
+}
+
+// NewDetector creates a Detector.
+func NewDetector(opts Options) *Detector {
+	d := &Detector{
+		window:      opts.Window,
+		baseline:    opts.Baseline,
+		factor:      opts.Factor,
+		minMessages: opts.MinMessages,
+		cooldown:    opts.Cooldown,
+		clock:       clock.Or(opts.Clock),
+	}
+	if d.window <= 0 {
+		d.window = defaultWindow
+	}
+	if d.baseline <= 0 {
+		d.baseline = defaultBaseline
+	}
+	if d.factor <= 0 {
+		d.factor = defaultFactor
+	}
+	if d.minMessages <= 0 {
+		d.minMessages = defaultMinMessages
+	}
+	if d.cooldown <= 0 {
+		d.cooldown = defaultCooldown
+	}
+	return d
+}
+
+// Observe records a chat message and, when it tips the current window
+// over the threshold, returns a hype event. Events are ignored, and the
+// message's arrival is taken as now so replayed history cannot trigger.
+func (d *Detector) Observe(msg message.Message) (message.Message, bool) {
+	if msg.IsEvent() {
+		return message.Message{}, false
+	}
+	return d.observe(d.clock.Now())
+}
+
+func (d *Detector) observe(now time.Time) (message.Message, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started.IsZero() {
+		d.started = now
+	}
+	d.times = append(d.times, now)
+	cutoff := now.Add(-d.window - d.baseline)
+	i := 0
+	for i < len(d.times) && d.times[i].Before(cutoff) {
+		i++
+	}
+	d.times = d.times[i:]
+
+	if now.Sub(d.started) < d.window+d.baseline || now.Sub(d.lastHype) < d.cooldown {
+		return message.Message{}, false
+	}
+
+	windowStart := now.Add(-d.window)
+	recent := 0
+	for _, t := range d.times {
+		if !t.Before(windowStart) {
+			recent++
+		}
+	}
+	before := len(d.times) - recent
+	expected := float64(before) * float64(d.window) / float64(d.baseline)
+
+	if recent < d.minMessages || float64(recent) < d.factor*expected {
+		return message.Message{}, false
+	}
+	d.lastHype = now
+
+	content := i18n.T(i18n.HypeBurst, recent, d.window)
+	if expected > 0 {
+		content = i18n.T(i18n.HypeFactor, content, i18n.Number(float64(recent)/expected, 1))
+	}
+	return message.Message{
+		Platform:  message.Relay,
+		Type:      message.TypeHype,
+		ID:        message.NewID(),
+		Username:  "hype",
+		Timestamp: now,
+		Content:   content,
+	}, true
+}
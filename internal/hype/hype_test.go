@@ -0,0 +1,58 @@
+package hype
+
+import (
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestDetector(t *testing.T) {
+	d := NewDetector(Options{Window: 10 * time.Second, Baseline: time.Minute, Factor: 3, MinMessages: 5, Cooldown: 30 * time.Second})
+	start := time.Date(2025, 1, 15, 14, 0, 0, 0, time.UTC)
+
+	// A steady message every 5s sets a baseline of two per window.
+	now := start
+	for ; now.Before(start.Add(2 * time.Minute)); now = now.Add(5 * time.Second) {
+		if ev, ok := d.observe(now); ok {
+			t.Fatalf("steady chat triggered hype at %s: %+v", now.Sub(start), ev)
+		}
+	}
+
+	// Six messages in two seconds is three times the baseline.
+	var hypes []message.Message
+	for i := 0; i < 6; i++ {
+		now = now.Add(300 * time.Millisecond)
+		if ev, ok := d.observe(now); ok {
+			hypes = append(hypes, ev)
+		}
+	}
+	if len(hypes) != 1 {
+		t.Fatalf("got %d hype events during the burst, want 1", len(hypes))
+	}
+	ev := hypes[0]
+	if ev.Platform != message.Relay || ev.Type != message.TypeHype || ev.Content == "" {
+		t.Errorf("hype event = %+v", ev)
+	}
+
+	// The cooldown holds back a second burst right after the first.
+	for i := 0; i < 10; i++ {
+		now = now.Add(100 * time.Millisecond)
+		if _, ok := d.observe(now); ok {
+			t.Fatal("hype fired again during cooldown")
+		}
+	}
+}
+
+func TestDetectorWarmup(t *testing.T) {
+	d := NewDetector(Options{MinMessages: 3})
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		if _, ok := d.observe(now); ok {
+			t.Fatal("hype fired before a baseline was observed")
+		}
+	}
+	if _, ok := d.Observe(message.Message{Type: message.TypeSub}); ok {
+		t.Error("events should not count toward hype")
+	}
+}
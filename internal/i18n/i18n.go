@@ -0,0 +1,363 @@
+// Package i18n holds the message catalog for text the relay writes
+// itself (system events, hype, amounts) and the locale's time and number
+// formats. The locale is chosen once at startup with Set.
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"relay/internal/message"
+)
+
+// Catalog keys. Each maps to a fmt format string in every locale.
+const (
+	PresenceConnected    = "presence.connected"    // alias
+	PresenceDisconnected = "presence.disconnected" // alias
+	PresenceOnline       = "presence.online"       // event text, online count
+	StreamEnded          = "stream.ended"          // video ID
+	HypeBurst            = "hype.burst"            // message count, window
+	HypeFactor           = "hype.factor"           // event text, formatted factor
+	BitsOne              = "bits.one"              // formatted amount
+	BitsOther            = "bits.other"            // formatted amount
+	MemberNew            = "member.new"            // username
+	MemberMilestone      = "member.milestone"      // username, months
+	MemberGiftOne        = "member.gift.one"       // username
+	MemberGiftOther      = "member.gift.other"     // username, count
+	MemberGiftReceived   = "member.gift.received"  // username
+	ReplyingTo           = "reply.to"              // username
+	MessageEdited        = "mod.edited"            // username, new text
+	MessageDropped       = "mod.dropped"           // username
+	MessageDeleted       = "mod.deleted"           // username
+	MessageDeletedAnon   = "mod.deleted.anon"      // no arguments
+	ChatCleared          = "mod.cleared"           // no arguments
+	UserTimedOut         = "mod.timeout"           // username, seconds
+	UserBanned           = "mod.banned"            // username
+)
+
+// Locale is a language's catalog and formats.
+type Locale struct {
+	// Tag is the locale's name, e.g. "de" or "pt-BR".
+	Tag string
+	// TimeLayout formats message timestamps, as for time.Format.
+	TimeLayout string
+	// Decimal and Group separate fractions and thousands in numbers.
+	Decimal string
+	Group   string
+	// CurrencyFirst puts the currency symbol before the amount.
+	CurrencyFirst bool
+	catalog       map[string]string
+}
+
+// DefaultTag is the locale used until Set is called. It keeps amounts
+// exactly as the platforms format them.
+const DefaultTag = "en"
+
+var en = &Locale{
+	Tag: "en", TimeLayout: "15:04:05", Decimal: ".", Group: ",", CurrencyFirst: true,
+	catalog: map[string]string{
+		PresenceConnected:    "%s connected",
+		PresenceDisconnected: "%s disconnected",
+		PresenceOnline:       "%s (%d online)",
+		StreamEnded:          "stream ended: live chat for %s is offline",
+		HypeBurst:            "chat is popping off: %d messages in %s",
+		HypeFactor:           "%s (%s× normal)",
+		BitsOne:              "%s bit",
+		BitsOther:            "%s bits",
+		MemberNew:            "%s became a member",
+		MemberMilestone:      "%s has been a member for %d months",
+		MemberGiftOne:        "%s gifted a membership",
+		MemberGiftOther:      "%s gifted %d memberships",
+		MemberGiftReceived:   "%s received a gift membership",
+		ReplyingTo:           "replying to %s",
+		MessageEdited:        "message from %s edited: %s",
+		MessageDropped:       "message from %s dropped",
+		MessageDeleted:       "message from %s deleted",
+		MessageDeletedAnon:   "message deleted",
+		ChatCleared:          "chat cleared by a moderator",
+		UserTimedOut:         "%s timed out for %ss",
+		UserBanned:           "%s banned",
+	},
+}
+
+var locales = map[string]*Locale{
+	"en": en,
+	"en-US": {
+		Tag: "en-US", TimeLayout: "3:04:05 PM", Decimal: ".", Group: ",", CurrencyFirst: true,
+		catalog: en.catalog,
+	},
+	"de": {
+		Tag: "de", TimeLayout: "15:04:05", Decimal: ",", Group: ".",
+		catalog: map[string]string{
+			PresenceConnected:    "%s ist verbunden",
+			PresenceDisconnected: "%s hat die Verbindung getrennt",
+			PresenceOnline:       "%s (%d online)",
+			StreamEnded:          "Stream beendet: Live-Chat für %s ist offline",
+			HypeBurst:            "Chat explodiert: %d Nachrichten in %s",
+			HypeFactor:           "%s (%s× normal)",
+			BitsOne:              "%s Bit",
+			BitsOther:            "%s Bits",
+			MemberNew:            "%s ist jetzt Mitglied",
+			MemberMilestone:      "%s ist seit %d Monaten Mitglied",
+			MemberGiftOne:        "%s hat eine Mitgliedschaft verschenkt",
+			MemberGiftOther:      "%s hat %d Mitgliedschaften verschenkt",
+			MemberGiftReceived:   "%s hat eine Mitgliedschaft geschenkt bekommen",
+			ReplyingTo:           "Antwort an %s",
+			MessageEdited:        "Nachricht von %s bearbeitet: %s",
+			MessageDropped:       "Nachricht von %s entfernt",
+			MessageDeleted:       "Nachricht von %s gelöscht",
+			MessageDeletedAnon:   "Nachricht gelöscht",
+			ChatCleared:          "Chat von einem Moderator geleert",
+			UserTimedOut:         "%s für %s s gesperrt",
+			UserBanned:           "%s gebannt",
+		},
+	},
+	"es": {
+		Tag: "es", TimeLayout: "15:04:05", Decimal: ",", Group: ".",
+		catalog: map[string]string{
+			PresenceConnected:    "%s se conectó",
+			PresenceDisconnected: "%s se desconectó",
+			PresenceOnline:       "%s (%d en línea)",
+			StreamEnded:          "directo finalizado: el chat en vivo de %s está desconectado",
+			HypeBurst:            "el chat está que arde: %d mensajes en %s",
+			HypeFactor:           "%s (%s× lo normal)",
+			BitsOne:              "%s bit",
+			BitsOther:            "%s bits",
+			MemberNew:            "%s se hizo miembro",
+			MemberMilestone:      "%s lleva %d meses como miembro",
+			MemberGiftOne:        "%s regaló una membresía",
+			MemberGiftOther:      "%s regaló %d membresías",
+			MemberGiftReceived:   "%s recibió una membresía de regalo",
+			ReplyingTo:           "respondiendo a %s",
+			MessageEdited:        "mensaje de %s editado: %s",
+			MessageDropped:       "mensaje de %s retirado",
+			MessageDeleted:       "mensaje de %s eliminado",
+			MessageDeletedAnon:   "mensaje eliminado",
+			ChatCleared:          "chat vaciado por un moderador",
+			UserTimedOut:         "%s expulsado temporalmente durante %s s",
+			UserBanned:           "%s baneado",
+		},
+	},
+	"fr": {
+		Tag: "fr", TimeLayout: "15:04:05", Decimal: ",", Group: "\u202f",
+		catalog: map[string]string{
+			PresenceConnected:    "%s s'est connecté",
+			PresenceDisconnected: "%s s'est déconnecté",
+			PresenceOnline:       "%s (%d en ligne)",
+			StreamEnded:          "stream terminé : le chat en direct de %s est hors ligne",
+			HypeBurst:            "le chat s'enflamme : %d messages en %s",
+			HypeFactor:           "%s (%s× la normale)",
+			BitsOne:              "%s bit",
+			BitsOther:            "%s bits",
+			MemberNew:            "%s est devenu membre",
+			MemberMilestone:      "%s est membre depuis %d mois",
+			MemberGiftOne:        "%s a offert un abonnement",
+			MemberGiftOther:      "%s a offert %d abonnements",
+			MemberGiftReceived:   "%s a reçu un abonnement offert",
+			ReplyingTo:           "en réponse à %s",
+			MessageEdited:        "message de %s modifié : %s",
+			MessageDropped:       "message de %s retiré",
+			MessageDeleted:       "message de %s supprimé",
+			MessageDeletedAnon:   "message supprimé",
+			ChatCleared:          "chat vidé par un modérateur",
+			UserTimedOut:         "%s exclu pendant %s s",
+			UserBanned:           "%s banni",
+		},
+	},
+	"pt-BR": {
+		Tag: "pt-BR", TimeLayout: "15:04:05", Decimal: ",", Group: ".", CurrencyFirst: true,
+		catalog: map[string]string{
+			PresenceConnected:    "%s conectou",
+			PresenceDisconnected: "%s desconectou",
+			PresenceOnline:       "%s (%d online)",
+			StreamEnded:          "live encerrada: o chat ao vivo de %s está offline",
+			HypeBurst:            "o chat está bombando: %d mensagens em %s",
+			HypeFactor:           "%s (%s× o normal)",
+			BitsOne:              "%s bit",
+			BitsOther:            "%s bits",
+			MemberNew:            "%s se tornou membro",
+			MemberMilestone:      "%s é membro há %d meses",
+			MemberGiftOne:        "%s presenteou uma assinatura",
+			MemberGiftOther:      "%s presenteou %d assinaturas",
+			MemberGiftReceived:   "%s ganhou uma assinatura de presente",
+			ReplyingTo:           "respondendo a %s",
+			MessageEdited:        "mensagem de %s editada: %s",
+			MessageDropped:       "mensagem de %s removida",
+			MessageDeleted:       "mensagem de %s apagada",
+			MessageDeletedAnon:   "mensagem apagada",
+			ChatCleared:          "chat limpo por um moderador",
+			UserTimedOut:         "%s suspenso por %ss",
+			UserBanned:           "%s banido",
+		},
+	},
+	"ja": {
+		Tag: "ja", TimeLayout: "15:04:05", Decimal: ".", Group: ",", CurrencyFirst: true,
+		catalog: map[string]string{
+			PresenceConnected:    "%s が接続しました",
+			PresenceDisconnected: "%s が切断しました",
+			PresenceOnline:       "%s（%d 人オンライン）",
+			StreamEnded:          "配信終了: %s のライブチャットはオフラインです",
+			HypeBurst:            "チャットが盛り上がっています: %[2]s で %[1]d 件",
+			HypeFactor:           "%s（通常の %s 倍）",
+			BitsOne:              "%s ビッツ",
+			BitsOther:            "%s ビッツ",
+			MemberNew:            "%s がメンバーになりました",
+			MemberMilestone:      "%s はメンバー歴 %d か月です",
+			MemberGiftOne:        "%s がメンバーシップをギフトしました",
+			MemberGiftOther:      "%s がメンバーシップを %d 件ギフトしました",
+			MemberGiftReceived:   "%s がメンバーシップのギフトを受け取りました",
+			ReplyingTo:           "%s への返信",
+			MessageEdited:        "%s のメッセージが編集されました: %s",
+			MessageDropped:       "%s のメッセージが取り下げられました",
+			MessageDeleted:       "%s のメッセージが削除されました",
+			MessageDeletedAnon:   "メッセージが削除されました",
+			ChatCleared:          "モデレーターがチャットをクリアしました",
+			UserTimedOut:         "%s が %s 秒間タイムアウトされました",
+			UserBanned:           "%s が BAN されました",
+		},
+	},
+}
+
+// currencySymbols are shown in place of common ISO codes.
+var currencySymbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "BRL": "R$",
+}
+
+// zeroDecimalCurrencies have no minor unit.
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true}
+
+var current atomic.Pointer[Locale]
+
+func init() {
+	current.Store(en)
+}
+
+// Tags lists the available locales.
+func Tags() []string {
+	var tags []string
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Set selects the locale by tag, case-insensitively. An empty tag keeps
+// the default.
+func Set(tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for t, l := range locales {
+		if strings.EqualFold(t, tag) {
+			current.Store(l)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown locale %q (available: %s)", tag, strings.Join(Tags(), ", "))
+}
+
+// Current returns the selected locale.
+func Current() *Locale {
+	return current.Load()
+}
+
+// T formats the catalog entry for key in the current locale, falling
+// back to English for keys a locale lacks.
+func T(key string, args ...any) string {
+	return Current().T(key, args...)
+}
+
+// T formats the catalog entry for key.
+func (l *Locale) T(key string, args ...any) string {
+	format, ok := l.catalog[key]
+	if !ok {
+		format = en.catalog[key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Time formats a timestamp in the current locale.
+func Time(t time.Time) string {
+	return t.Format(Current().TimeLayout)
+}
+
+// Number formats v with the given number of decimals in the current
+// locale.
+func Number(v float64, decimals int) string {
+	return Current().Number(v, decimals)
+}
+
+// Number formats v with the locale's separators.
+func (l *Locale) Number(v float64, decimals int) string {
+	s := fmt.Sprintf("%.*f", decimals, math.Abs(v))
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 {
+		b.WriteByte('-')
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// Amount formats a cheer or Super Chat amount in the current locale. The
+// default locale shows the platform's own formatting unchanged.
+func Amount(a message.Amount) string {
+	return Current().Amount(a)
+}
+
+// Amount formats a for the locale.
+func (l *Locale) Amount(a message.Amount) string {
+	if l == en || a.Currency == "" {
+		return a.Display
+	}
+	if a.Currency == "BITS" {
+		key := BitsOther
+		if a.Value == 1 {
+			key = BitsOne
+		}
+		return l.T(key, l.Number(a.Value, 0))
+	}
+	return l.Money(a.Value, a.Currency)
+}
+
+// Money formats v in the ISO 4217 currency in the current locale, e.g.
+// "$5.43" for en.
+func Money(v float64, currency string) string {
+	return Current().Money(v, currency)
+}
+
+// Money formats v in currency for the locale.
+func (l *Locale) Money(v float64, currency string) string {
+	decimals := 2
+	if zeroDecimalCurrencies[currency] {
+		decimals = 0
+	}
+	number := l.Number(v, decimals)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		// Codes read better with a space: "CHF 5.00", "5,00 CHF"
+		if l.CurrencyFirst {
+			return currency + " " + number
+		}
+		return number + " " + currency
+	}
+	if l.CurrencyFirst {
+		return symbol + number
+	}
+	return number + " " + symbol
+}
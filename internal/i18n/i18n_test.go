@@ -0,0 +1,94 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+// use selects tag for one test and restores the default afterwards.
+func use(t *testing.T, tag string) {
+	t.Helper()
+	if err := Set(tag); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Set(DefaultTag) })
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		tag      string
+		v        float64
+		decimals int
+		want     string
+	}{
+		{"en", 1234567.891, 2, "1,234,567.89"},
+		{"de", 1234567.891, 2, "1.234.567,89"},
+		{"fr", 1500, 0, "1\u202f500"},
+		{"en", 999, 0, "999"},
+		{"de", -1000.5, 1, "-1.000,5"},
+	}
+	for _, tt := range tests {
+		if got := locales[tt.tag].Number(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("%s Number(%v, %d) = %q, want %q", tt.tag, tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestAmount(t *testing.T) {
+	usd := message.Amount{Value: 1234.5, Currency: "USD", Display: "$1,234.50"}
+	bits := message.Amount{Value: 1000, Currency: "BITS", Display: "1000 bits"}
+	chf := message.Amount{Value: 5, Currency: "CHF", Display: "CHF 5.00"}
+	yen := message.Amount{Value: 500, Currency: "JPY", Display: "¥500"}
+
+	tests := []struct {
+		tag  string
+		a    message.Amount
+		want string
+	}{
+		// The default keeps the platform's formatting
+		{"en", usd, "$1,234.50"},
+		{"en", bits, "1000 bits"},
+		{"de", usd, "1.234,50 $"},
+		{"de", bits, "1.000 Bits"},
+		{"de", chf, "5,00 CHF"},
+		{"en-US", chf, "CHF 5.00"},
+		{"ja", yen, "¥500"},
+		{"ja", bits, "1,000 ビッツ"},
+	}
+	for _, tt := range tests {
+		if got := locales[tt.tag].Amount(tt.a); got != tt.want {
+			t.Errorf("%s Amount(%+v) = %q, want %q", tt.tag, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSetAndT(t *testing.T) {
+	if err := Set("klingon"); err == nil {
+		t.Error("expected an error for an unknown locale")
+	}
+	use(t, "PT-br")
+	if got := T(PresenceConnected, "xeraen"); got != "xeraen conectou" {
+		t.Errorf("T() = %q", got)
+	}
+	at := time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)
+	use(t, "en-US")
+	if got := Time(at); got != "2:30:45 PM" {
+		t.Errorf("Time() = %q, want 12-hour", got)
+	}
+	use(t, "ja")
+	if got := T(HypeBurst, 42, "10s"); got != "チャットが盛り上がっています: 10s で 42 件" {
+		t.Errorf("T() = %q, want reordered arguments", got)
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for tag, l := range locales {
+		for key := range en.catalog {
+			if _, ok := l.catalog[key]; !ok {
+				t.Errorf("locale %s is missing %s", tag, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package latency estimates how far each platform's chat trails the
+// others during a simulcast. Viewers on every platform react to the same
+// moments on stream, so chat rate spikes line up once each platform's
+// stream delay is taken out; the delay is found by cross-correlating the
+// spikes.
+package latency
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"relay/internal/message"
+)
+
+const (
+	defaultBucket = time.Second
+	defaultMaxLag = 30 * time.Second
+
+	// trendWindow is the span of the moving average taken out of each
+	// rate series, leaving the reaction spikes.
+	trendWindow = time.Minute
+	// minMessages is the least chat a platform needs to be compared.
+	minMessages = 20
+	// maxBuckets bounds a session's length in buckets.
+	maxBuckets = 10_000_000
+	// WeakMatch is the correlation below which a lag is only a guess.
+	WeakMatch = 0.2
+)
+
+// ErrNoChat is returned by Report when fewer than two platforms have
+// enough chat to compare.
+var ErrNoChat = errors.New("latency: need chat from at least two platforms")
+
+// Options configures an Analyzer. The zero value compares one-second
+// rates against the busiest platform, looking up to 30s either way.
+type Options struct {
+	// Bucket is the resolution chat rates are counted at. Defaults to 1s.
+	Bucket time.Duration
+	// MaxLag is the largest delay looked for between two platforms.
+	// Defaults to 30s.
+	MaxLag time.Duration
+	// Reference is the platform the others are compared against, by key
+	// or label. Defaults to the one with the most chat.
+	Reference string
+}
+
+// Analyzer collects chat timestamps over a session. It is not safe for
+// concurrent use.
+type Analyzer struct {
+	opts  Options
+	times map[message.Platform][]time.Time
+}
+
+// New creates an Analyzer.
+func New(opts Options) *Analyzer {
+	if opts.Bucket <= 0 {
+		opts.Bucket = defaultBucket
+	}
+	if opts.MaxLag <= 0 {
+		opts.MaxLag = defaultMaxLag
+	}
+	return &Analyzer{opts: opts, times: make(map[message.Platform][]time.Time)}
+}
+
+// Add records msg. Only chat counts: events like raids happen on one
+// platform, and the relay's own messages on none.
+func (a *Analyzer) Add(msg message.Message) {
+	if msg.IsEvent() || msg.Platform == message.Relay || msg.Timestamp.IsZero() {
+		return
+	}
+	a.times[msg.Platform] = append(a.times[msg.Platform], msg.Timestamp)
+}
+
+// Result is one platform's estimate.
+type Result struct {
+	Platform message.Platform
+	Messages int
+	// Behind is how far the platform's chat trails the fastest one's.
+	Behind time.Duration
+	// Match is the correlation of the platform's spikes with the
+	// reference's at that delay, from -1 to 1; 1 for the reference.
+	Match float64
+	// Reference marks the platform the others were compared against.
+	Reference bool
+	// Skipped says why the platform wasn't compared, e.g. too little
+	// chat; Behind and Match are then unset.
+	Skipped string
+}
+
+// Report is the outcome of a session's analysis.
+type Report struct {
+	Start, End time.Time
+	Bucket     time.Duration
+	Results    []Result
+}
+
+// Report estimates each platform's delay from the chat added so far.
+func (a *Analyzer) Report() (Report, error) {
+	var start, end time.Time
+	for _, ts := range a.times {
+		for _, t := range ts {
+			if start.IsZero() || t.Before(start) {
+				start = t
+			}
+			if t.After(end) {
+				end = t
+			}
+		}
+	}
+	r := Report{Start: start, End: end, Bucket: a.opts.Bucket}
+	n := int(end.Sub(start)/a.opts.Bucket) + 1
+	if n > maxBuckets {
+		return r, fmt.Errorf("latency: session of %s is too long for %s buckets", end.Sub(start), a.opts.Bucket)
+	}
+
+	// The busiest platform comes first
+	var platforms []message.Platform
+	for p := range a.times {
+		platforms = append(platforms, p)
+	}
+	slices.SortFunc(platforms, func(x, y message.Platform) int {
+		return cmp.Or(cmp.Compare(len(a.times[y]), len(a.times[x])), cmp.Compare(x, y))
+	})
+
+	series := make(map[message.Platform][]float64)
+	for _, p := range platforms {
+		res := Result{Platform: p, Messages: len(a.times[p])}
+		if res.Messages < minMessages {
+			res.Skipped = "too little chat"
+		} else {
+			series[p] = spikes(a.times[p], start, n, a.opts.Bucket)
+		}
+		r.Results = append(r.Results, res)
+	}
+	if len(series) < 2 {
+		return r, ErrNoChat
+	}
+
+	ref := r.Results[0].Platform
+	if a.opts.Reference != "" {
+		p, ok := message.ParsePlatform(a.opts.Reference)
+		if !ok {
+			return r, fmt.Errorf("latency: unknown platform %q", a.opts.Reference)
+		}
+		if series[p] == nil {
+			return r, fmt.Errorf("latency: not enough %s chat to compare against", p)
+		}
+		ref = p
+	}
+	maxLag := int(a.opts.MaxLag / a.opts.Bucket)
+	lags := make(map[message.Platform]float64)
+	for i := range r.Results {
+		res := &r.Results[i]
+		switch {
+		case res.Skipped != "":
+		case res.Platform == ref:
+			res.Reference, res.Match = true, 1
+			lags[res.Platform] = 0
+		default:
+			lags[res.Platform], res.Match = bestLag(series[ref], series[res.Platform], maxLag)
+		}
+	}
+
+	// Delays are given from the fastest platform, whichever it is
+	fastest := math.Inf(1)
+	for _, lag := range lags {
+		fastest = min(fastest, lag)
+	}
+	for i := range r.Results {
+		res := &r.Results[i]
+		if lag, ok := lags[res.Platform]; ok {
+			res.Behind = time.Duration((lag - fastest) * float64(a.opts.Bucket))
+		}
+	}
+	return r, nil
+}
+
+// spikes counts times into n buckets from start and takes out the
+// moving average, so what is left is chat rising and falling around
+// moments on stream rather than the session's overall ebb and flow.
+func spikes(times []time.Time, start time.Time, n int, bucket time.Duration) []float64 {
+	counts := make([]float64, n)
+	for _, t := range times {
+		counts[int(t.Sub(start)/bucket)]++
+	}
+	half := max(int(trendWindow/bucket)/2, 1)
+	// Prefix sums give each window's total in constant time
+	sums := make([]float64, n+1)
+	for i, c := range counts {
+		sums[i+1] = sums[i] + c
+	}
+	out := make([]float64, n)
+	for i, c := range counts {
+		lo, hi := max(i-half, 0), min(i+half+1, n)
+		out[i] = c - (sums[hi]-sums[lo])/float64(hi-lo)
+	}
+	return out
+}
+
+// bestLag finds the shift of y against x, in buckets within ±maxLag,
+// whose correlation is highest, refined between buckets by fitting a
+// parabola through the peak. A positive lag means y trails x.
+func bestLag(x, y []float64, maxLag int) (lag, match float64) {
+	maxLag = max(min(maxLag, len(x)-2), 0)
+	corr := make([]float64, 2*maxLag+1)
+	best := 0
+	for k := -maxLag; k <= maxLag; k++ {
+		corr[k+maxLag] = correlate(x, y, k)
+		if corr[k+maxLag] > corr[best] {
+			best = k + maxLag
+		}
+	}
+	lag, match = float64(best-maxLag), corr[best]
+	if best > 0 && best < len(corr)-1 {
+		a, b, c := corr[best-1], corr[best], corr[best+1]
+		if d := a - 2*b + c; d < 0 {
+			lag += (a - c) / (2 * d)
+		}
+	}
+	return lag, match
+}
+
+// correlate returns the Pearson correlation of x[i] with y[i+k] where
+// both exist, or 0 when either side is flat.
+func correlate(x, y []float64, k int) float64 {
+	lo, hi := max(0, -k), min(len(x), len(y)-k)
+	if hi-lo < 2 {
+		return 0
+	}
+	var sx, sy float64
+	for i := lo; i < hi; i++ {
+		sx += x[i]
+		sy += y[i+k]
+	}
+	n := float64(hi - lo)
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := lo; i < hi; i++ {
+		dx, dy := x[i]-mx, y[i+k]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// Write prints the report as a table:
+//
+//	PLATFORM  MESSAGES  BEHIND  MATCH
+//	TTV       8123      0.0s    reference
+//	YT_       2210      4.3s    0.62
+func (r Report) Write(w io.Writer) error {
+	fmt.Fprintf(w, "Session %s to %s (%s), %s buckets\n\n",
+		r.Start.Local().Format(time.DateTime), r.End.Local().Format(time.DateTime),
+		r.End.Sub(r.Start).Round(time.Second), r.Bucket)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLATFORM\tMESSAGES\tBEHIND\tMATCH")
+	var weak bool
+	for _, res := range r.Results {
+		behind, match := fmt.Sprintf("%.1fs", res.Behind.Seconds()), fmt.Sprintf("%.2f", res.Match)
+		switch {
+		case res.Skipped != "":
+			behind, match = "-", res.Skipped
+		case res.Reference:
+			match = "reference"
+		case res.Match < WeakMatch:
+			match += " (weak)"
+			weak = true
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", res.Platform, res.Messages, behind, match)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if weak {
+		fmt.Fprintln(w, "\nA weak match means chat had few shared spikes; a longer session or a busier moment helps.")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package latency
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+var start = time.Date(2025, 1, 15, 20, 0, 0, 0, time.UTC)
+
+// session simulates chat on each platform reacting to the same moments
+// on stream, each after its own delay, over a steady trickle of chatter.
+func session(delays map[message.Platform]time.Duration) []message.Message {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var moments []time.Duration
+	for t := 30 * time.Second; t < 30*time.Minute; t += time.Duration(40+rng.IntN(80)) * time.Second {
+		moments = append(moments, t)
+	}
+	var msgs []message.Message
+	for _, p := range slices.Sorted(maps.Keys(delays)) {
+		delay := delays[p]
+		// Background chat, about one message every two seconds
+		for t := time.Duration(0); t < 30*time.Minute; t += time.Duration(rng.IntN(4000)) * time.Millisecond {
+			msgs = append(msgs, message.Message{Platform: p, Username: "viewer", Content: "hi", Timestamp: start.Add(t)})
+		}
+		// A burst of reactions over a few seconds after each moment
+		for _, m := range moments {
+			for range 15 + rng.IntN(10) {
+				t := m + delay + time.Duration(rng.IntN(3000))*time.Millisecond
+				msgs = append(msgs, message.Message{Platform: p, Username: "viewer", Content: "LUL", Timestamp: start.Add(t)})
+			}
+		}
+	}
+	return msgs
+}
+
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -500*time.Millisecond && d < 500*time.Millisecond
+}
+
+func TestReportFindsDelays(t *testing.T) {
+	a := New(Options{})
+	for _, msg := range session(map[message.Platform]time.Duration{
+		message.Twitch:  2 * time.Second,
+		message.YouTube: 7500 * time.Millisecond,
+		message.HackrTV: 0,
+	}) {
+		a.Add(msg)
+	}
+	r, err := a.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[message.Platform]time.Duration{
+		message.HackrTV: 0,
+		message.Twitch:  2 * time.Second,
+		message.YouTube: 7500 * time.Millisecond,
+	}
+	if len(r.Results) != 3 {
+		t.Fatalf("Results = %+v", r.Results)
+	}
+	for _, res := range r.Results {
+		if !near(res.Behind, want[res.Platform]) {
+			t.Errorf("%s is %s behind, want about %s", res.Platform, res.Behind, want[res.Platform])
+		}
+		if res.Match < 0.5 {
+			t.Errorf("%s match = %.2f, want a strong one", res.Platform, res.Match)
+		}
+	}
+}
+
+func TestReportReference(t *testing.T) {
+	msgs := session(map[message.Platform]time.Duration{message.Twitch: 0, message.YouTube: 3 * time.Second})
+	a := New(Options{Reference: "yt_"})
+	for _, msg := range msgs {
+		a.Add(msg)
+	}
+	r, err := a.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range r.Results {
+		if res.Reference != (res.Platform == message.YouTube) {
+			t.Errorf("%s Reference = %v", res.Platform, res.Reference)
+		}
+		// Delays are still from the fastest platform
+		if res.Platform == message.YouTube && !near(res.Behind, 3*time.Second) {
+			t.Errorf("YouTube is %s behind, want about 3s", res.Behind)
+		}
+	}
+
+	a = New(Options{Reference: "myspace"})
+	for _, msg := range msgs {
+		a.Add(msg)
+	}
+	if _, err := a.Report(); err == nil {
+		t.Error("Report() accepted an unknown reference platform")
+	}
+}
+
+func TestReportNeedsTwoPlatforms(t *testing.T) {
+	a := New(Options{})
+	for _, msg := range session(map[message.Platform]time.Duration{message.Twitch: 0}) {
+		a.Add(msg)
+	}
+	// Events and a handful of messages don't make a second platform
+	for range 5 {
+		a.Add(message.Message{Platform: message.YouTube, Username: "fan", Content: "hi", Timestamp: start})
+	}
+	a.Add(message.Message{Platform: message.HackrTV, Type: message.TypeSystem, Content: "xeraen connected", Timestamp: start})
+
+	r, err := a.Report()
+	if !errors.Is(err, ErrNoChat) {
+		t.Fatalf("Report() = %v, want ErrNoChat", err)
+	}
+	if len(r.Results) != 2 || r.Results[1].Skipped == "" {
+		t.Errorf("Results = %+v, want YouTube skipped", r.Results)
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	r := Report{
+		Start:  start,
+		End:    start.Add(90 * time.Minute),
+		Bucket: time.Second,
+		Results: []Result{
+			{Platform: message.Twitch, Messages: 8123, Match: 1, Reference: true},
+			{Platform: message.YouTube, Messages: 2210, Behind: 4300 * time.Millisecond, Match: 0.62},
+			{Platform: message.HackrTV, Messages: 40, Behind: time.Second, Match: 0.1},
+			{Platform: message.Relay, Messages: 3, Skipped: "too little chat"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"TTV       8123      0.0s    reference",
+		"YT_       2210      4.3s    0.62",
+		"HTV       40        1.0s    0.10 (weak)",
+		"RLY       3         -       too little chat",
+		"A weak match",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report is missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package markup rewrites chat text for a route whose destination renders
+// it differently from the source: platform emotes become shortcodes or
+// are dropped, emoji can be removed, and formatting tricks that only make
+// sense on the source platform are stripped.
+package markup
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"relay/internal/message"
+)
+
+// Emote handling modes.
+const (
+	// Keep leaves emotes and emoji as they are.
+	Keep = "keep"
+	// Shortcode writes emotes as ":Kappa:", the way YouTube already
+	// writes its custom emoji, so they read as emotes rather than words.
+	Shortcode = "shortcode"
+	// Strip removes them.
+	Strip = "strip"
+)
+
+// Options chooses how a route rewrites chat. The zero value changes
+// nothing.
+type Options struct {
+	// Emotes is Keep (default), Shortcode, or Strip for Twitch emotes and
+	// YouTube custom emoji.
+	Emotes string
+	// Emoji is Keep (default) or Strip for Unicode emoji.
+	Emoji string
+	// Plain strips formatting the destination can't show: /me action
+	// framing, control and zero-width characters, bidirectional
+	// overrides, and runs of stacked combining marks.
+	Plain bool
+}
+
+// Validate reports an unknown mode.
+func (o Options) Validate() error {
+	switch o.Emotes {
+	case "", Keep, Shortcode, Strip:
+	default:
+		return fmt.Errorf("emotes must be %q, %q, or %q, got %q", Keep, Shortcode, Strip, o.Emotes)
+	}
+	switch o.Emoji {
+	case "", Keep, Strip:
+	default:
+		return fmt.Errorf("emoji must be %q or %q, got %q", Keep, Strip, o.Emoji)
+	}
+	return nil
+}
+
+// IsZero reports whether the options leave messages unchanged.
+func (o Options) IsZero() bool {
+	return (o.Emotes == "" || o.Emotes == Keep) && (o.Emoji == "" || o.Emoji == Keep) && !o.Plain
+}
+
+// maxCombining is how many combining marks may follow one character
+// before Plain drops the rest.
+const maxCombining = 2
+
+// Translate rewrites msg's content for a route. It reports false when
+// nothing is left of a chat message, e.g. one made only of stripped
+// emotes, so the route can skip it. Emote positions don't survive the
+// rewrite and are cleared.
+func Translate(msg message.Message, opts Options) (message.Message, bool) {
+	if opts.IsZero() {
+		return msg, true
+	}
+	content := rewriteEmotes(msg.Content, msg.Emotes, opts.Emotes)
+	if opts.Plain {
+		content = plain(content)
+	}
+	if opts.Emoji == Strip {
+		content = strings.Map(func(r rune) rune {
+			if isEmoji(r) {
+				return -1
+			}
+			return r
+		}, content)
+	}
+	if content != msg.Content {
+		content = strings.Join(strings.Fields(content), " ")
+		msg.Emotes = nil
+	}
+	msg.Content = content
+	return msg, content != "" || msg.Type != message.TypeChat
+}
+
+// rewriteEmotes applies mode to the emotes in content. Emotes whose
+// position no longer matches their name are left alone.
+func rewriteEmotes(content string, emotes []message.Emote, mode string) string {
+	if len(emotes) == 0 || mode == "" || mode == Keep {
+		return content
+	}
+	runes := []rune(content)
+	var b strings.Builder
+	last := 0
+	for _, e := range emotes {
+		if e.Start < last || e.End > len(runes) || string(runes[e.Start:e.End]) != e.Name {
+			continue
+		}
+		b.WriteString(string(runes[last:e.Start]))
+		if mode == Shortcode {
+			b.WriteString(shortcode(e.Name))
+		}
+		last = e.End
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String()
+}
+
+// shortcode wraps an emote name in colons unless it already is one.
+func shortcode(name string) string {
+	if len(name) > 1 && strings.HasPrefix(name, ":") && strings.HasSuffix(name, ":") {
+		return name
+	}
+	return ":" + name + ":"
+}
+
+// plain strips /me framing and invisible or layout-changing characters.
+func plain(s string) string {
+	if rest, ok := strings.CutPrefix(s, "\x01ACTION "); ok {
+		s = strings.TrimSuffix(rest, "\x01")
+	}
+	var b strings.Builder
+	combining := 0
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteRune(' ')
+			continue
+		case unicode.IsControl(r), isInvisible(r):
+			continue
+		case unicode.Is(unicode.Mn, r):
+			combining++
+			if combining > maxCombining {
+				continue
+			}
+		default:
+			combining = 0
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isInvisible reports zero-width and bidirectional control characters,
+// and the tag character some Twitch clients append to dodge the
+// duplicate-message check. The zero-width joiner and the tags that spell
+// out subdivision flags are kept for emoji.
+func isInvisible(r rune) bool {
+	switch {
+	case r == '\u200b', r == '\u2060', r == '\ufeff', r == '\u180e':
+		return true
+	case r == '\u200e', r == '\u200f', r >= '\u202a' && r <= '\u202e', r >= '\u2066' && r <= '\u2069':
+		return true
+	case r == 0xe0000:
+		return true
+	}
+	return false
+}
+
+// isEmoji reports pictographs, dingbats, flags, and the modifiers and
+// joiners that build emoji sequences.
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1f000 && r <= 0x1faff: // pictographs, emoticons, flags, modifiers
+		return true
+	case r >= 0x2600 && r <= 0x27bf: // miscellaneous symbols and dingbats
+		return true
+	case r == '\u200d', r == '\ufe0f', r == '\u20e3':
+		return true
+	case r >= 0xe0020 && r <= 0xe007f: // subdivision flag tags
+		return true
+	}
+	return false
+}
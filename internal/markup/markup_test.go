@@ -0,0 +1,68 @@
+package markup
+
+import (
+	"testing"
+
+	"relay/internal/message"
+)
+
+func TestTranslate(t *testing.T) {
+	kappa := message.Message{
+		Content: "Kappa hi Kappa PogChamp",
+		Emotes: []message.Emote{
+			{Name: "Kappa", Start: 0, End: 5},
+			{Name: "Kappa", Start: 9, End: 14},
+			{Name: "PogChamp", Start: 15, End: 23},
+		},
+	}
+	yt := message.Message{
+		Content: "hello 👋 :hand-pink-waving:",
+		Emotes:  []message.Emote{{Name: ":hand-pink-waving:", Start: 8, End: 26}},
+	}
+
+	tests := []struct {
+		name string
+		msg  message.Message
+		opts Options
+		want string
+		ok   bool
+	}{
+		{"zero options", kappa, Options{}, "Kappa hi Kappa PogChamp", true},
+		{"twitch shortcodes", kappa, Options{Emotes: Shortcode}, ":Kappa: hi :Kappa: :PogChamp:", true},
+		{"twitch strip", kappa, Options{Emotes: Strip}, "hi", true},
+		{"youtube shortcode unchanged", yt, Options{Emotes: Shortcode}, "hello 👋 :hand-pink-waving:", true},
+		{"youtube strip", yt, Options{Emotes: Strip}, "hello 👋", true},
+		{"emoji strip", yt, Options{Emoji: Strip}, "hello :hand-pink-waving:", true},
+		{"emoji sequence", message.Message{Content: "a 👨\u200d👩\u200d👧 b ❤\ufe0f c"}, Options{Emoji: Strip}, "a b c", true},
+		{"stale positions", message.Message{Content: "edited", Emotes: kappa.Emotes}, Options{Emotes: Strip}, "edited", true},
+		{"only emotes", message.Message{Content: "Kappa", Emotes: kappa.Emotes[:1]}, Options{Emotes: Strip}, "", false},
+		{"only emotes event", message.Message{Type: message.TypeSub, Content: "Kappa", Emotes: kappa.Emotes[:1]}, Options{Emotes: Strip}, "", true},
+		{"action", message.Message{Content: "\x01ACTION waves\x01"}, Options{Plain: true}, "waves", true},
+		{"invisible", message.Message{Content: "dup\u200b\u202e message \U000E0000"}, Options{Plain: true}, "dup message", true},
+		{"newlines", message.Message{Content: "one\ntwo"}, Options{Plain: true}, "one two", true},
+		{"zalgo", message.Message{Content: "e\u0301\u0302\u0303\u0304!"}, Options{Plain: true}, "e\u0301\u0302!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Translate(tt.msg, tt.opts)
+			if got.Content != tt.want || ok != tt.ok {
+				t.Errorf("Translate() = %q, %v; want %q, %v", got.Content, ok, tt.want, tt.ok)
+			}
+			if got.Content != tt.msg.Content && got.Emotes != nil {
+				t.Errorf("Emotes = %+v, want cleared after a rewrite", got.Emotes)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Options{Emotes: Shortcode, Emoji: Strip}).Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := (Options{Emotes: "images"}).Validate(); err == nil {
+		t.Error("Validate() should reject an unknown emotes mode")
+	}
+	if err := (Options{Emoji: Shortcode}).Validate(); err == nil {
+		t.Error("Validate() should reject shortcode for emoji")
+	}
+}
@@ -1,31 +1,421 @@
 package message
 
-import "time"
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
 
+// Platform is a handle to a registered platform descriptor. The built-in
+// platforms are registered by this package; out-of-tree sources call
+// Register from an init function to add their own.
 type Platform int
 
-const (
-	Twitch Platform = iota
-	YouTube
-	HackrTV
+// Descriptor describes a chat platform.
+type Descriptor struct {
+	// Key is the stable lowercase identifier used in config, e.g. "twitch".
+	Key string
+	// Label is the tag used when bridging and for echo detection, e.g. "TTV".
+	Label string
+	// DisplayLabel optionally overrides Label in the terminal (emoji welcome).
+	DisplayLabel string
+	// Color is a display color hint such as "magenta" or "red".
+	Color string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Descriptor
+)
+
+// Built-in platforms.
+var (
+	Twitch  = Register(Descriptor{Key: "twitch", Label: "TTV", Color: "magenta"})
+	YouTube = Register(Descriptor{Key: "youtube", Label: "YT_", Color: "red"})
+	HackrTV = Register(Descriptor{Key: "hackrtv", Label: "HTV", Color: "green"})
+	// Relay tags events the relay synthesizes itself, such as hype
+	// alerts. They are never bridged.
+	Relay = Register(Descriptor{Key: "relay", Label: "RLY", Color: "yellow"})
 )
 
+// Register adds a platform and returns its handle. It panics if the key
+// is empty or already registered, like other init-time registries.
+func Register(d Descriptor) Platform {
+	d.Key = strings.ToLower(strings.TrimSpace(d.Key))
+	if d.Key == "" {
+		panic("message: Register called with empty platform key")
+	}
+	if d.Label == "" {
+		d.Label = strings.ToUpper(d.Key)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Key == d.Key {
+			panic("message: platform " + d.Key + " registered twice")
+		}
+	}
+	registry = append(registry, d)
+	return Platform(len(registry) - 1)
+}
+
+// Platforms returns every registered platform in registration order.
+func Platforms() []Platform {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]Platform, len(registry))
+	for i := range registry {
+		out[i] = Platform(i)
+	}
+	return out
+}
+
+// Lookup returns the descriptor for a platform handle.
+func Lookup(p Platform) (Descriptor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if p < 0 || int(p) >= len(registry) {
+		return Descriptor{}, false
+	}
+	return registry[p], true
+}
+
+// ParsePlatform resolves a config key ("twitch") or label ("TTV"),
+// case-insensitively.
+func ParsePlatform(s string) (Platform, bool) {
+	for _, p := range Platforms() {
+		if strings.EqualFold(s, p.Key()) || strings.EqualFold(s, p.String()) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// Key returns the platform's stable config key, e.g. "twitch".
+func (p Platform) Key() string {
+	if d, ok := Lookup(p); ok {
+		return d.Key
+	}
+	return "unknown"
+}
+
+// String returns the platform's label, e.g. "TTV". This is the single
+// source of truth for bridged prefixes and echo detection.
 func (p Platform) String() string {
-	switch p {
-	case Twitch:
-		return "TTV"
-	case YouTube:
-		return "YT_"
-	case HackrTV:
-		return "HTV"
+	if d, ok := Lookup(p); ok {
+		return d.Label
+	}
+	return "???"
+}
+
+// DisplayLabel returns the label shown in the terminal, falling back to
+// String when no display override is set.
+func (p Platform) DisplayLabel() string {
+	if d, ok := Lookup(p); ok && d.DisplayLabel != "" {
+		return d.DisplayLabel
+	}
+	return p.String()
+}
+
+// Color returns the platform's display color hint, or "" if unset.
+func (p Platform) Color() string {
+	d, _ := Lookup(p)
+	return d.Color
+}
+
+// SetLabel overrides a platform's label. Empty labels are ignored.
+func SetLabel(p Platform, label string) {
+	update(p, func(d *Descriptor) {
+		if label = strings.TrimSpace(label); label != "" {
+			d.Label = label
+		}
+	})
+}
+
+// SetDisplayLabel overrides the label shown in the terminal only.
+// An empty label clears the override.
+func SetDisplayLabel(p Platform, label string) {
+	update(p, func(d *Descriptor) {
+		d.DisplayLabel = strings.TrimSpace(label)
+	})
+}
+
+func update(p Platform, fn func(*Descriptor)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if p >= 0 && int(p) < len(registry) {
+		fn(&registry[p])
+	}
+}
+
+// Type distinguishes regular chat from platform events.
+type Type int
+
+const (
+	// TypeChat is a regular chat message (the zero value).
+	TypeChat Type = iota
+	// TypeSub is a subscription, resubscription, or gifted sub.
+	TypeSub
+	// TypeRaid is an incoming raid.
+	TypeRaid
+	// TypeDeletion reports that a message, or all of a user's messages,
+	// were removed by a moderator. TargetID names the message when known.
+	TypeDeletion
+	// TypeFollow is a new follower.
+	TypeFollow
+	// TypeRedemption is a channel point reward redemption.
+	TypeRedemption
+	// TypeEdit reports that a message's content was changed after it was
+	// sent. TargetID names the message and Content holds the new text.
+	TypeEdit
+	// TypeSystem is a platform notice that is neither chat nor one of the
+	// events above, e.g. a broadcast on a hackr.tv notifications channel.
+	TypeSystem
+	// TypeHype marks a burst of chat well above its recent rate. It is
+	// synthesized by the relay rather than sent by a platform.
+	TypeHype
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeChat:
+		return "chat"
+	case TypeSub:
+		return "sub"
+	case TypeRaid:
+		return "raid"
+	case TypeDeletion:
+		return "deletion"
+	case TypeFollow:
+		return "follow"
+	case TypeRedemption:
+		return "redemption"
+	case TypeEdit:
+		return "edit"
+	case TypeSystem:
+		return "system"
+	case TypeHype:
+		return "hype"
 	default:
-		return "???"
+		return "unknown"
 	}
 }
 
+// ParseType returns the type whose String is s, e.g. "sub".
+func ParseType(s string) (Type, bool) {
+	for t := TypeChat; t <= TypeHype; t++ {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return TypeChat, false
+}
+
+// Amount is a monetary value attached to a message, such as Twitch bits
+// or a YouTube Super Chat.
+type Amount struct {
+	// Value is the amount in Currency units, e.g. 100 (bits) or 4.99.
+	Value float64
+	// Currency is an ISO 4217 code, or "BITS" for Twitch bits.
+	Currency string
+	// Display is the human-readable amount, e.g. "100 bits" or "$4.99".
+	Display string
+}
+
+// IsZero reports whether no amount is set.
+func (a Amount) IsZero() bool {
+	return a.Value == 0 && a.Currency == ""
+}
+
 type Message struct {
-	Platform  Platform
-	Username  string
+	Platform Platform
+	Type     Type
+	// ID is the platform-native message ID, or a NewID when the platform
+	// gives the message none, so every message a client produces can be
+	// told apart.
+	ID string
+	// TargetID is the ID of the message an event refers to, e.g. the
+	// deleted message for TypeDeletion or the changed one for TypeEdit.
+	TargetID string
+	// ReplyToID is the ID of the message this one answers, when the
+	// platform marks it as a reply, and ReplyToUser who sent that one.
+	ReplyToID   string
+	ReplyToUser string
+	// Channel is the source channel on the platform (e.g. the Twitch
+	// channel name without "#", or the YouTube video ID). Empty when the
+	// platform has only one.
+	Channel  string
+	Username string
+	// UserID is the sender's platform account ID when the platform
+	// reports one: the Twitch user-id tag or the YouTube channel ID.
+	UserID string
+	// Role is the sender's standing on the platform when it reports one,
+	// e.g. hackr.tv's "admin" or "operative".
+	Role string
+	// Badges are the sender's platform badges, e.g. Twitch "subscriber"
+	// or "vip" and YouTube "member" or "moderator".
+	Badges    []string
 	Timestamp time.Time
 	Content   string
+	// Emotes locates platform emotes in Content: Twitch emotes from the
+	// emotes tag, YouTube custom emoji written as ":shortcut:", and
+	// BetterTTV and 7TV emotes when those lookups are enabled.
+	Emotes []Emote
+	// Amount is set for monetised messages (cheers, Super Chats).
+	Amount Amount
+	// Normalized is Amount converted to the configured base currency,
+	// when currency normalization is enabled and a rate is known.
+	Normalized Amount
+	// Previews holds metadata for links in Content, when link previews
+	// are enabled.
+	Previews []Preview
+	// Profile holds what the enrichment stage found out about the
+	// sender, or nil when it is off or found nothing.
+	Profile *Profile
+	// Extra holds platform-specific details that have no field of their
+	// own, keyed by the Extra constants or "<platform key>.<name>" for
+	// one platform's, e.g. "twitch.color". Values are strings so they
+	// survive the JSON output and the publish bus as they are.
+	Extra map[string]string
+	// Raw is the payload the message was parsed from, when the client
+	// was asked to keep it: the Twitch IRC line, or the JSON of the
+	// hackr.tv cable message, YouTube chat item, or EventSub event. It
+	// lets fields the relay doesn't parse be recovered later.
+	Raw string
+}
+
+// Well-known Extra keys.
+const (
+	// ExtraColor is the sender's chosen name color as "#RRGGBB".
+	ExtraColor = "color"
+	// ExtraFirstMessage is "1" on the sender's first message in the
+	// channel.
+	ExtraFirstMessage = "first_message"
+)
+
+// Emote is a platform emote within a message's Content.
+type Emote struct {
+	// Name is the emote's text, e.g. "Kappa" or ":hand-pink-waving:".
+	Name string
+	// Start and End are the rune offsets of the emote in Content, end
+	// exclusive.
+	Start, End int
+	// Image is the URL of the emote's picture, when the platform or
+	// emote provider gives one.
+	Image string
+}
+
+// Preview is OpenGraph metadata for a link mentioned in a message.
+type Preview struct {
+	URL   string
+	Title string
+	// Image is the og:image URL, if the page declares one.
+	Image string
+}
+
+// Profile is account information about a message's sender, looked up
+// from the platform and shared by every message from them.
+type Profile struct {
+	// Created is when the account was made, when the platform says.
+	Created time.Time
+	// Avatar is the URL of the sender's profile picture.
+	Avatar string
+	// URL is the sender's channel or profile page.
+	URL string
+}
+
+// AccountAge reports how old the sender's account was when msg was
+// sent, and false when that isn't known.
+func (m Message) AccountAge() (time.Duration, bool) {
+	if m.Profile == nil || m.Profile.Created.IsZero() {
+		return 0, false
+	}
+	return m.Timestamp.Sub(m.Profile.Created), true
+}
+
+// HasBadge reports whether the sender has any of the named badges.
+func (m Message) HasBadge(names ...string) bool {
+	for _, b := range m.Badges {
+		for _, name := range names {
+			if strings.EqualFold(b, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get returns the Extra value for key, or "" when it isn't set.
+func (m Message) Get(key string) string {
+	return m.Extra[key]
+}
+
+// Set sets an Extra value, making the map if needed. An empty value
+// removes the key. The map is shared by every copy of the message, so a
+// pipeline stage should clone it before setting values on chat that
+// others already hold.
+func (m *Message) Set(key, value string) {
+	if value == "" {
+		delete(m.Extra, key)
+		return
+	}
+	if m.Extra == nil {
+		m.Extra = make(map[string]string)
+	}
+	m.Extra[key] = value
+}
+
+// Color returns the sender's chosen name color, e.g. "#FF4500", or ""
+// when the platform doesn't say.
+func (m Message) Color() string {
+	return m.Get(ExtraColor)
+}
+
+// IsFirstMessage reports whether this is the sender's first message in
+// the channel, as far as the platform says.
+func (m Message) IsFirstMessage() bool {
+	return m.Get(ExtraFirstMessage) == "1"
+}
+
+// IsBroadcaster reports whether the sender owns the channel: the Twitch
+// broadcaster or the YouTube channel owner.
+func (m Message) IsBroadcaster() bool {
+	return m.HasBadge("broadcaster", "owner")
+}
+
+// IsModerator reports whether the sender can moderate the chat: a
+// channel owner, a moderator badge, or a hackr.tv admin or moderator
+// role.
+func (m Message) IsModerator() bool {
+	return m.IsBroadcaster() || m.HasBadge("moderator") ||
+		strings.EqualFold(m.Role, "admin") || strings.EqualFold(m.Role, "moderator")
+}
+
+// IsSubscriber reports whether the sender pays to support the channel:
+// a Twitch subscriber or founder, or a YouTube member.
+func (m Message) IsSubscriber() bool {
+	return m.HasBadge("subscriber", "founder", "member")
+}
+
+// IsVIP reports whether the sender has a Twitch VIP badge.
+func (m Message) IsVIP() bool {
+	return m.HasBadge("vip")
+}
+
+// IsEvent reports whether the message is a platform event rather than chat.
+func (m Message) IsEvent() bool {
+	return m.Type != TypeChat
+}
+
+// NewID returns a random UUID (version 4), the ID of a message whose
+// platform gives it none.
+func NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
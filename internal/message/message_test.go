@@ -1,6 +1,9 @@
 package message
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+)
 
 func TestPlatformString(t *testing.T) {
 	tests := []struct {
@@ -10,6 +13,7 @@ func TestPlatformString(t *testing.T) {
 		{Twitch, "TTV"},
 		{YouTube, "YT_"},
 		{HackrTV, "HTV"},
+		{Relay, "RLY"},
 		{Platform(99), "???"},
 	}
 
@@ -20,3 +24,214 @@ func TestPlatformString(t *testing.T) {
 		}
 	}
 }
+
+func TestSetLabel(t *testing.T) {
+	t.Cleanup(func() { SetLabel(Twitch, "TTV") })
+
+	SetLabel(Twitch, "TWI")
+	if got := Twitch.String(); got != "TWI" {
+		t.Errorf("Twitch.String() = %q, want %q", got, "TWI")
+	}
+	if got := Twitch.DisplayLabel(); got != "TWI" {
+		t.Errorf("Twitch.DisplayLabel() = %q, want fallback %q", got, "TWI")
+	}
+
+	SetLabel(Twitch, "  ")
+	if got := Twitch.String(); got != "TWI" {
+		t.Errorf("empty label should be ignored, got %q", got)
+	}
+}
+
+func TestSetDisplayLabel(t *testing.T) {
+	t.Cleanup(func() { SetDisplayLabel(YouTube, "") })
+
+	SetDisplayLabel(YouTube, "▶ YT")
+	if got := YouTube.DisplayLabel(); got != "▶ YT" {
+		t.Errorf("YouTube.DisplayLabel() = %q, want %q", got, "▶ YT")
+	}
+	if got := YouTube.String(); got != "YT_" {
+		t.Errorf("display label must not change String(), got %q", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	builtins := len(Platforms())
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = registry[:builtins]
+		registryMu.Unlock()
+	})
+
+	discord := Register(Descriptor{Key: "Discord", Label: "DSC", Color: "blue"})
+
+	if got := discord.String(); got != "DSC" {
+		t.Errorf("String() = %q, want %q", got, "DSC")
+	}
+	if got := discord.Key(); got != "discord" {
+		t.Errorf("Key() = %q, want %q", got, "discord")
+	}
+	if got := discord.Color(); got != "blue" {
+		t.Errorf("Color() = %q, want %q", got, "blue")
+	}
+	if p, ok := ParsePlatform("dsc"); !ok || p != discord {
+		t.Errorf("ParsePlatform(dsc) = %v, %v; want %v, true", p, ok, discord)
+	}
+
+	found := false
+	for _, p := range Platforms() {
+		if p == discord {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Platforms() missing registered platform")
+	}
+
+	kick := Register(Descriptor{Key: "kick"})
+	if got := kick.String(); got != "KICK" {
+		t.Errorf("default label = %q, want %q", got, "KICK")
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for duplicate key")
+		}
+	}()
+	Register(Descriptor{Key: "twitch"})
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   Platform
+		wantOk bool
+	}{
+		{"twitch", Twitch, true},
+		{"YouTube", YouTube, true},
+		{"htv", HackrTV, true},
+		{"TTV", Twitch, true},
+		{"discord", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParsePlatform(tt.in)
+		if ok != tt.wantOk || (ok && got != tt.want) {
+			t.Errorf("ParsePlatform(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	tests := []struct {
+		typ  Type
+		want string
+	}{
+		{TypeChat, "chat"},
+		{TypeSub, "sub"},
+		{TypeRaid, "raid"},
+		{TypeDeletion, "deletion"},
+		{TypeFollow, "follow"},
+		{TypeRedemption, "redemption"},
+		{TypeEdit, "edit"},
+		{TypeSystem, "system"},
+		{TypeHype, "hype"},
+		{Type(99), "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.typ.String(); got != tt.want {
+			t.Errorf("Type(%d).String() = %q, want %q", tt.typ, got, tt.want)
+		}
+		if got, ok := ParseType(tt.want); tt.want != "unknown" && (!ok || got != tt.typ) {
+			t.Errorf("ParseType(%q) = %v, %v", tt.want, got, ok)
+		}
+	}
+	if _, ok := ParseType("unknown"); ok {
+		t.Error(`ParseType("unknown") should fail`)
+	}
+}
+
+func TestIsEvent(t *testing.T) {
+	if (Message{}).IsEvent() {
+		t.Error("zero-value message should be chat, not an event")
+	}
+	if !(Message{Type: TypeSub}).IsEvent() {
+		t.Error("sub message should be an event")
+	}
+}
+
+func TestHasBadge(t *testing.T) {
+	msg := Message{Badges: []string{"subscriber", "vip"}}
+	if !msg.HasBadge("member", "VIP") {
+		t.Error("HasBadge should match any name, case-insensitively")
+	}
+	if msg.HasBadge("moderator") || (Message{}).HasBadge("vip") {
+		t.Error("HasBadge matched a badge the sender lacks")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		msg                          Message
+		broadcaster, mod, sub, isVIP bool
+	}{
+		{Message{Badges: []string{"broadcaster", "subscriber"}}, true, true, true, false},
+		{Message{Badges: []string{"owner"}}, true, true, false, false},
+		{Message{Badges: []string{"moderator", "member"}}, false, true, true, false},
+		{Message{Badges: []string{"founder", "vip"}}, false, false, true, true},
+		{Message{Role: "admin"}, false, true, false, false},
+		{Message{Role: "operative"}, false, false, false, false},
+	}
+	for _, tt := range tests {
+		m := tt.msg
+		if m.IsBroadcaster() != tt.broadcaster || m.IsModerator() != tt.mod || m.IsSubscriber() != tt.sub || m.IsVIP() != tt.isVIP {
+			t.Errorf("%+v: broadcaster %v, moderator %v, subscriber %v, VIP %v", m, m.IsBroadcaster(), m.IsModerator(), m.IsSubscriber(), m.IsVIP())
+		}
+	}
+}
+
+func TestExtra(t *testing.T) {
+	var msg Message
+	if msg.Color() != "" || msg.IsFirstMessage() || msg.Get("twitch.anything") != "" {
+		t.Error("empty message has Extra values")
+	}
+	msg.Set(ExtraColor, "#FF4500")
+	msg.Set(ExtraFirstMessage, "1")
+	msg.Set("twitch.returning", "")
+	if msg.Color() != "#FF4500" || !msg.IsFirstMessage() {
+		t.Errorf("Extra = %v, want the color and first message", msg.Extra)
+	}
+	if len(msg.Extra) != 2 {
+		t.Errorf("Extra = %v, an empty value set a key", msg.Extra)
+	}
+	msg.Set(ExtraColor, "")
+	if _, ok := msg.Extra[ExtraColor]; ok {
+		t.Error("Set with an empty value kept the key")
+	}
+}
+
+func TestAmountIsZero(t *testing.T) {
+	if !(Amount{}).IsZero() {
+		t.Error("empty amount should be zero")
+	}
+	if (Amount{Value: 100, Currency: "BITS"}).IsZero() {
+		t.Error("bits amount should not be zero")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for range 100 {
+		id := NewID()
+		if !uuid.MatchString(id) {
+			t.Fatalf("NewID() = %q, want a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewID() repeated %q", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,56 @@
+// Package netio bounds writes to network connections by a timeout and a
+// context, so a peer that stops reading can hold up neither a send nor
+// shutdown.
+package netio
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DefaultWriteTimeout bounds a write when no timeout is configured.
+const DefaultWriteTimeout = 10 * time.Second
+
+// expired is a write deadline already in the past, which fails a write
+// in progress at once.
+var expired = time.Unix(1, 0)
+
+// Write runs write, which writes to nc, until it returns, timeout
+// passes, or ctx is done, whichever comes first, by setting nc's write
+// deadline. A timeout of zero uses DefaultWriteTimeout. write is handed
+// the deadline for connections layered on nc that apply their own, such
+// as a websocket.Conn. A write that fails once ctx is done returns ctx's
+// error.
+//
+// A write cut short may have sent part of a line or frame, so callers
+// should close the connection when Write fails.
+func Write(ctx context.Context, nc net.Conn, timeout time.Duration, write func(deadline time.Time) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultWriteTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	nc.SetWriteDeadline(deadline)
+	defer nc.SetWriteDeadline(time.Time{})
+
+	// Cancelling ctx expires the deadline, failing the write in progress
+	cancelled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		nc.SetWriteDeadline(expired)
+		close(cancelled)
+	})
+	err := write(deadline)
+	if !stop() {
+		<-cancelled
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package netio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"relay/internal/relaytest"
+)
+
+// stalled returns the client end of a connection whose peer never
+// reads, so every write blocks.
+func stalled(t *testing.T) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return client
+}
+
+// write writes a line to nc.
+func write(nc net.Conn) func(time.Time) error {
+	return func(time.Time) error {
+		_, err := io.WriteString(nc, "PRIVMSG #xqc :hi\r\n")
+		return err
+	}
+}
+
+func TestWriteTimesOut(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	nc := stalled(t)
+	start := time.Now()
+	err := Write(context.Background(), nc, 50*time.Millisecond, write(nc))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() = %v, want a deadline error", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Write() took %s with a 50ms timeout", took)
+	}
+}
+
+func TestWriteCancelled(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	nc := stalled(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := Write(ctx, nc, time.Minute, write(nc)); err != context.Canceled {
+		t.Errorf("Write() = %v, want context.Canceled", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Write() took %s to notice cancellation", took)
+	}
+
+	// A done context doesn't write at all
+	called := false
+	err := Write(ctx, nc, time.Minute, func(time.Time) error { called = true; return nil })
+	if err != context.Canceled || called {
+		t.Errorf("Write() after cancel = %v, called = %v", err, called)
+	}
+}
+
+func TestWriteContextDeadline(t *testing.T) {
+	nc := stalled(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var got time.Time
+	err := Write(ctx, nc, time.Minute, func(deadline time.Time) error {
+		got = deadline
+		return write(nc)(deadline)
+	})
+	// The connection's deadline and the context's expire together
+	if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() = %v, want a deadline error", err)
+	}
+	if want, _ := ctx.Deadline(); !got.Equal(want) {
+		t.Errorf("deadline = %v, want the context's %v", got, want)
+	}
+}
+
+func TestWriteClearsDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+
+	if err := Write(context.Background(), client, 20*time.Millisecond, write(client)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	// Writing later, outside Write, isn't held to its deadline
+	time.Sleep(50 * time.Millisecond)
+	if _, err := io.WriteString(client, "PING\r\n"); err != nil {
+		t.Errorf("write after Write() = %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build darwin
+
+package notify
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+)
+
+// DefaultBackend returns terminal-notifier when it is installed, and
+// otherwise Notification Center through osascript.
+func DefaultBackend() (Backend, error) {
+	if _, err := exec.LookPath("terminal-notifier"); err == nil {
+		return terminalNotifier{}, nil
+	}
+	if _, err := exec.LookPath("osascript"); err == nil {
+		return osascript{}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// terminalNotifier takes the title and body as flags rather than
+// trailing arguments.
+type terminalNotifier struct{}
+
+func (terminalNotifier) Notify(ctx context.Context, title, body string) error {
+	return run(ctx, "terminal-notifier", "-group", "relay", "-title", title, "-message", body)
+}
+
+// osascript posts through AppleScript's display notification.
+type osascript struct{}
+
+func (osascript) Notify(ctx context.Context, title, body string) error {
+	// AppleScript strings are quoted like Go's for quotes and backslashes
+	script := "display notification " + strconv.Quote(body) + " with title " + strconv.Quote(title)
+	return run(ctx, "osascript", "-e", script)
+}
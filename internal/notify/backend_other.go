@@ -0,0 +1,8 @@
+//go:build !unix
+
+package notify
+
+// DefaultBackend knows no notifier here; configure a Command instead.
+func DefaultBackend() (Backend, error) {
+	return nil, ErrUnsupported
+}
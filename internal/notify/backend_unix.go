@@ -0,0 +1,14 @@
+//go:build unix && !darwin
+
+package notify
+
+import "os/exec"
+
+// DefaultBackend returns notify-send from libnotify, which most Linux
+// and BSD desktops provide.
+func DefaultBackend() (Backend, error) {
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return nil, ErrUnsupported
+	}
+	return Command{"notify-send", "--app-name=relay"}, nil
+}
@@ -0,0 +1,211 @@
+// Package notify raises desktop notifications for chat that shouldn't be
+// missed, such as highlights, Super Chats, raids, or messages from chosen
+// users, so the terminal can be minimized.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+// notifyTimeout bounds each notification, so a hung notifier can't hold
+// up the sink.
+const notifyTimeout = 5 * time.Second
+
+// maxBody is the most characters of a message shown in a notification.
+const maxBody = 200
+
+// ErrUnsupported is returned by DefaultBackend where the relay knows no
+// notifier, or none is installed. A Command can still be configured.
+var ErrUnsupported = errors.New("notify: no desktop notifier found")
+
+// Backend shows one desktop notification.
+type Backend interface {
+	Notify(ctx context.Context, title, body string) error
+}
+
+// Command is a Backend that runs a program with the title and body
+// appended to its arguments, e.g. ["notify-send", "-u", "critical"].
+type Command []string
+
+// Notify runs the command.
+func (c Command) Notify(ctx context.Context, title, body string) error {
+	if len(c) == 0 {
+		return errors.New("notify: empty command")
+	}
+	return run(ctx, c[0], append(append([]string{}, c[1:]...), title, body)...)
+}
+
+// run runs a notifier program, reporting its output when it fails.
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("notify: %s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("notify: %s: %w", name, err)
+	}
+	return nil
+}
+
+// Options configures a Notifier. With no Events it notifies for cheers
+// and Super Chats, raids, and highlights when there are keywords.
+type Options struct {
+	// Events are what to notify for: "highlights" (chat matching
+	// Highlights), "paid" (cheers and Super Chats), or an event type
+	// such as "raid", "sub", or "follow".
+	Events []string
+	// Highlights decides which chat is a highlight.
+	Highlights *display.Highlights
+	// Users are senders whose every message notifies: a username, or
+	// "platform:username" for one platform, case-insensitively.
+	Users []string
+	// Cooldown is the least time between notifications; ones that come
+	// sooner are dropped. Zero notifies for everything.
+	Cooldown time.Duration
+	// Backend shows the notifications. Defaults to DefaultBackend.
+	Backend Backend
+	// Clock paces the cooldown. Defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// Notifier decides which messages deserve a notification and sends
+// them. It is safe for concurrent use.
+type Notifier struct {
+	highlights *display.Highlights
+	paid       bool
+	types      map[message.Type]bool
+	users      map[string]bool
+	cooldown   time.Duration
+	backend    Backend
+	clock      clock.Clock
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// New creates a Notifier, reporting unknown events and platforms, or
+// ErrUnsupported when no Backend is given and none is found.
+func New(opts Options) (*Notifier, error) {
+	n := &Notifier{
+		types:    make(map[message.Type]bool),
+		users:    make(map[string]bool),
+		cooldown: opts.Cooldown,
+		backend:  opts.Backend,
+		clock:    clock.Or(opts.Clock),
+	}
+	events := opts.Events
+	if len(events) == 0 {
+		events = []string{"paid", "raid"}
+		if opts.Highlights != nil {
+			events = append(events, "highlights")
+		}
+	}
+	for _, e := range events {
+		switch e = strings.ToLower(strings.TrimSpace(e)); e {
+		case "highlights":
+			if opts.Highlights == nil {
+				return nil, errors.New(`notify: "highlights" needs highlight keywords`)
+			}
+			n.highlights = opts.Highlights
+		case "paid":
+			n.paid = true
+		default:
+			t, ok := message.ParseType(e)
+			if !ok || t == message.TypeChat {
+				return nil, fmt.Errorf("notify: unknown event %q", e)
+			}
+			n.types[t] = true
+		}
+	}
+	for _, u := range opts.Users {
+		u = strings.ToLower(strings.TrimSpace(u))
+		if u == "" {
+			continue
+		}
+		if name, user, ok := strings.Cut(u, ":"); ok {
+			p, ok := message.ParsePlatform(name)
+			if !ok {
+				return nil, fmt.Errorf("notify: unknown platform %q in user %q", name, u)
+			}
+			u = p.Key() + ":" + user
+		}
+		n.users[u] = true
+	}
+	if n.backend == nil {
+		var err error
+		if n.backend, err = DefaultBackend(); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Match reports whether msg deserves a notification.
+func (n *Notifier) Match(msg message.Message) bool {
+	if msg.Type == message.TypeDeletion || msg.Type == message.TypeEdit {
+		return false
+	}
+	name := strings.ToLower(msg.Username)
+	switch {
+	case name != "" && (n.users[name] || n.users[msg.Platform.Key()+":"+name]):
+		return true
+	case n.paid && !msg.Amount.IsZero():
+		return true
+	case n.types[msg.Type]:
+		return true
+	default:
+		return n.highlights.Match(msg)
+	}
+}
+
+// Handle notifies for msg if it matches and the cooldown has passed.
+func (n *Notifier) Handle(ctx context.Context, msg message.Message) error {
+	if !n.Match(msg) || !n.ready() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	title, body := Format(msg)
+	return n.backend.Notify(ctx, title, body)
+}
+
+// ready reports whether the cooldown allows a notification now, starting
+// a new one if so.
+func (n *Notifier) ready() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := n.clock.Now()
+	if n.cooldown > 0 && !n.last.IsZero() && now.Sub(n.last) < n.cooldown {
+		return false
+	}
+	n.last = now
+	return true
+}
+
+// Format returns the title and body of msg's notification: the platform
+// tag and sender (with the amount for paid messages) over the content,
+// shortened to fit.
+func Format(msg message.Message) (title, body string) {
+	title = "[" + msg.Platform.String() + "] " + msg.Username
+	switch {
+	case !msg.Amount.IsZero():
+		title += " ◆ " + msg.Amount.Display
+	case msg.IsEvent():
+		title = "[" + msg.Platform.String() + "] " + msg.Type.String()
+	}
+	body = strings.Join(strings.Fields(msg.Content), " ")
+	if r := []rune(body); len(r) > maxBody {
+		body = string(r[:maxBody-1]) + "…"
+	}
+	return title, body
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+// recorder is a Backend that keeps what it was asked to show.
+type recorder struct{ shown []string }
+
+func (r *recorder) Notify(_ context.Context, title, body string) error {
+	r.shown = append(r.shown, title+" | "+body)
+	return nil
+}
+
+func TestMatch(t *testing.T) {
+	n, err := New(Options{
+		Highlights: display.NewHighlights([]string{"@hackr"}),
+		Users:      []string{"xeraen", "twitch:bob"},
+		Backend:    &recorder{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		msg  message.Message
+		want bool
+	}{
+		{"plain chat", message.Message{Platform: message.Twitch, Username: "viewer", Content: "hello"}, false},
+		{"highlight", message.Message{Platform: message.Twitch, Username: "viewer", Content: "hi @hackr"}, true},
+		{"super chat", message.Message{Platform: message.YouTube, Username: "fan", Content: "gg", Amount: message.Amount{Value: 5, Currency: "USD", Display: "$5.00"}}, true},
+		{"raid", message.Message{Platform: message.Twitch, Type: message.TypeRaid, Username: "raider", Content: "raider is raiding"}, true},
+		{"follow", message.Message{Platform: message.Twitch, Type: message.TypeFollow, Username: "new", Content: "new followed"}, false},
+		{"user", message.Message{Platform: message.HackrTV, Username: "XERAEN", Content: "hello"}, true},
+		{"user on one platform", message.Message{Platform: message.Twitch, Username: "bob", Content: "hello"}, true},
+		{"user on another platform", message.Message{Platform: message.YouTube, Username: "bob", Content: "hello"}, false},
+		{"deletion from user", message.Message{Platform: message.HackrTV, Type: message.TypeDeletion, Username: "xeraen"}, false},
+	}
+	for _, tt := range tests {
+		if got := n.Match(tt.msg); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventsChooseWhatNotifies(t *testing.T) {
+	n, err := New(Options{Events: []string{"follow", "sub"}, Backend: &recorder{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Match(message.Message{Platform: message.Twitch, Type: message.TypeFollow, Username: "new"}) {
+		t.Error("follow didn't match")
+	}
+	if n.Match(message.Message{Platform: message.Twitch, Type: message.TypeRaid, Username: "raider"}) {
+		t.Error("raid matched without being listed")
+	}
+	if n.Match(message.Message{Platform: message.YouTube, Username: "fan", Amount: message.Amount{Value: 5, Currency: "USD"}}) {
+		t.Error("Super Chat matched without paid")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, opts := range []Options{
+		{Events: []string{"shout"}, Backend: &recorder{}},
+		{Events: []string{"chat"}, Backend: &recorder{}},
+		{Events: []string{"highlights"}, Backend: &recorder{}},
+		{Users: []string{"myspace:tom"}, Backend: &recorder{}},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("New(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestHandleCooldown(t *testing.T) {
+	rec := &recorder{}
+	fake := clock.NewFake(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	n, err := New(Options{Events: []string{"raid"}, Cooldown: 10 * time.Second, Backend: rec, Clock: fake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raid := message.Message{Platform: message.Twitch, Type: message.TypeRaid, Username: "raider", Content: "raider is raiding with 12 viewers"}
+	ctx := context.Background()
+	n.Handle(ctx, raid)
+	n.Handle(ctx, raid)
+	n.Handle(ctx, message.Message{Platform: message.Twitch, Username: "viewer", Content: "hello"})
+	fake.Advance(10 * time.Second)
+	n.Handle(ctx, raid)
+
+	if len(rec.shown) != 2 {
+		t.Fatalf("shown = %q, want two raids", rec.shown)
+	}
+	if rec.shown[0] != "[TTV] raid | raider is raiding with 12 viewers" {
+		t.Errorf("notification = %q", rec.shown[0])
+	}
+}
+
+func TestFormat(t *testing.T) {
+	title, body := Format(message.Message{Platform: message.YouTube, Username: "fan", Content: "great\nstream", Amount: message.Amount{Value: 5, Currency: "USD", Display: "$5.00"}})
+	if title != "[YT_] fan ◆ $5.00" || body != "great stream" {
+		t.Errorf("Format() = %q, %q", title, body)
+	}
+	_, body = Format(message.Message{Platform: message.Twitch, Username: "bob", Content: strings.Repeat("a", 300)})
+	if n := len([]rune(body)); n != maxBody {
+		t.Errorf("body is %d characters, want %d", n, maxBody)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "shown")
+	cmd := Command{"sh", "-c", `printf '%s|%s' "$1" "$2" > "$0"`, out}
+	if err := cmd.Notify(context.Background(), "[TTV] bob", "hello there"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[TTV] bob|hello there" {
+		t.Errorf("command got %q", data)
+	}
+
+	err = Command{"sh", "-c", "echo broken >&2; exit 1"}.Notify(context.Background(), "t", "b")
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Notify() = %v, want the command's output", err)
+	}
+}
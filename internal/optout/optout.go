@@ -0,0 +1,174 @@
+// Package optout tracks viewers who asked not to have their chat
+// bridged to hackr.tv, either in the config or by typing !nobridge, until
+// they type !yesbridge. !bridge only explains the bridge.
+package optout
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"relay/internal/message"
+)
+
+// Chat commands viewers send to opt out of bridging and back in, and to
+// ask what the bridge is. InfoCommand changes nothing, so a viewer
+// curious about the bridge isn't opted back in by asking.
+const (
+	OptOutCommand = "!nobridge"
+	OptInCommand  = "!yesbridge"
+	InfoCommand   = "!bridge"
+)
+
+// List is the set of opted-out viewers. Entries are a username, which
+// matches on every platform, or "platform:username" (a platform key or
+// label, e.g. "twitch:viewer" or "YT_:viewer"), case-insensitively.
+// Opt-outs from chat are always platform-qualified. It is safe for
+// concurrent use.
+type List struct {
+	// path, if set, keeps the entries made from chat across restarts.
+	path string
+
+	mu sync.RWMutex
+	// fixed holds the configured entries, which chat can't lift.
+	fixed map[string]bool
+	// users holds the entries made from chat or read from path.
+	users map[string]bool
+}
+
+// New creates a List from configured entries, loading any saved in path.
+// A missing file is empty.
+func New(entries []string, path string) (*List, error) {
+	l := &List{path: path, fixed: make(map[string]bool), users: make(map[string]bool)}
+	for _, e := range entries {
+		key, err := parseEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		l.fixed[key] = true
+	}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("optout: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("optout: %s: %w", path, err)
+		}
+		l.users[key] = true
+	}
+	return l, nil
+}
+
+// parseEntry normalizes an entry to "key:username" or "username".
+func parseEntry(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", fmt.Errorf("empty opt-out entry")
+	}
+	if name, user, ok := strings.Cut(s, ":"); ok {
+		p, ok := message.ParsePlatform(name)
+		if !ok {
+			return "", fmt.Errorf("unknown platform %q in opt-out entry %q", name, s)
+		}
+		return p.Key() + ":" + user, nil
+	}
+	return s, nil
+}
+
+// userKey is the platform-qualified entry for msg's sender.
+func userKey(msg message.Message) string {
+	return msg.Platform.Key() + ":" + strings.ToLower(msg.Username)
+}
+
+// Command returns the opt-out command msg is, OptOutCommand,
+// OptInCommand, or InfoCommand, or "" for other messages. A command is the first word of
+// a chat message.
+func Command(msg message.Message) string {
+	if msg.Type != message.TypeChat {
+		return ""
+	}
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch cmd := strings.ToLower(fields[0]); cmd {
+	case OptOutCommand, OptInCommand, InfoCommand:
+		return cmd
+	}
+	return ""
+}
+
+// Observe applies an opt-out command in msg, saving the change to the
+// list's file. It reports whether msg was a command.
+func (l *List) Observe(msg message.Message) (bool, error) {
+	cmd := Command(msg)
+	if cmd == "" || msg.Username == "" {
+		return false, nil
+	}
+	if cmd == InfoCommand {
+		return true, nil
+	}
+	key := userKey(msg)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (cmd == OptOutCommand) == l.users[key] {
+		return true, nil
+	}
+	if cmd == OptOutCommand {
+		l.users[key] = true
+	} else {
+		delete(l.users, key)
+	}
+	return true, l.save()
+}
+
+// save writes the chat entries to path. l.mu must be held.
+func (l *List) save() error {
+	if l.path == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(l.users))
+	for k := range l.users {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	data := "# Viewers who sent " + OptOutCommand + "; they are never bridged\n" + strings.Join(keys, "\n") + "\n"
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+		return fmt.Errorf("optout: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("optout: %w", err)
+	}
+	return nil
+}
+
+// Skip reports whether msg must not be bridged: its sender opted out, or
+// it is an opt-out command. Deletions always pass so they can still
+// retract queued messages.
+func (l *List) Skip(msg message.Message) bool {
+	if msg.Type == message.TypeDeletion {
+		return false
+	}
+	if Command(msg) != "" {
+		return true
+	}
+	key := userKey(msg)
+	name := strings.ToLower(msg.Username)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fixed[name] || l.fixed[key] || l.users[name] || l.users[key]
+}
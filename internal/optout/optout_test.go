@@ -0,0 +1,133 @@
+package optout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+func chat(p message.Platform, user, content string) message.Message {
+	return message.Message{Platform: p, Type: message.TypeChat, Username: user, Content: content}
+}
+
+func TestSkipConfigured(t *testing.T) {
+	l, err := New([]string{"Shy", "yt_:private"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		msg  message.Message
+		want bool
+	}{
+		{chat(message.Twitch, "shy", "hi"), true},
+		{chat(message.YouTube, "SHY", "hi"), true},
+		{chat(message.YouTube, "private", "hi"), true},
+		{chat(message.Twitch, "private", "hi"), false},
+		{chat(message.Twitch, "viewer", "hi"), false},
+		{chat(message.Twitch, "viewer", "!nobridge please"), true},
+		{message.Message{Platform: message.Twitch, Type: message.TypeSub, Username: "shy"}, true},
+		{message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "shy"}, false},
+	}
+	for _, tt := range tests {
+		if got := l.Skip(tt.msg); got != tt.want {
+			t.Errorf("Skip(%s %q: %q) = %v, want %v", tt.msg.Platform, tt.msg.Username, tt.msg.Content, got, tt.want)
+		}
+	}
+
+	if _, err := New([]string{"myspace:tom"}, ""); err == nil {
+		t.Error("New() should reject an unknown platform")
+	}
+}
+
+func TestCommandsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "optout.txt")
+	l, err := New(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := l.Observe(chat(message.Twitch, "Viewer", "!NoBridge")); !ok || err != nil {
+		t.Fatalf("Observe() = %v, %v", ok, err)
+	}
+	if !l.Skip(chat(message.Twitch, "viewer", "hello")) {
+		t.Error("viewer should be skipped after !nobridge")
+	}
+	if l.Skip(chat(message.YouTube, "viewer", "hello")) {
+		t.Error("a chat opt-out should only cover its platform")
+	}
+	if ok, _ := l.Observe(chat(message.Twitch, "other", "!nobridge is a command")); !ok {
+		t.Error("Observe() should take the command as the first word")
+	}
+	if ok, _ := l.Observe(chat(message.Twitch, "other", "type !nobridge to opt out")); ok {
+		t.Error("Observe() took a command that wasn't the first word")
+	}
+
+	// Saved opt-outs survive a restart
+	l, err = New(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Skip(chat(message.Twitch, "viewer", "hello")) {
+		t.Error("opt-out was not reloaded from the file")
+	}
+	// !bridge only asks about the bridge
+	if ok, _ := l.Observe(chat(message.Twitch, "viewer", "!bridge")); !ok {
+		t.Error("Observe() should take !bridge as a command")
+	}
+	if !l.Skip(chat(message.Twitch, "viewer", "hello")) {
+		t.Error("!bridge opted the viewer back in")
+	}
+	l.Observe(chat(message.Twitch, "viewer", "!yesbridge"))
+	if l.Skip(chat(message.Twitch, "viewer", "hello")) {
+		t.Error("viewer still skipped after !yesbridge")
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "twitch:viewer") || !strings.Contains(string(data), "twitch:other") {
+		t.Errorf("file = %q, want only twitch:other", data)
+	}
+}
+
+func TestConfiguredCannotOptIn(t *testing.T) {
+	l, _ := New([]string{"twitch:shy"}, "")
+	l.Observe(chat(message.Twitch, "shy", "!yesbridge"))
+	if !l.Skip(chat(message.Twitch, "shy", "hi")) {
+		t.Error("!yesbridge lifted an opt-out set in the config")
+	}
+}
+
+func TestReplier(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	r := &Replier{Where: "hackr.tv #live", Clock: fake}
+
+	got, ok := r.Reply(chat(message.Twitch, "viewer", "!bridge"))
+	if want := "@viewer chat here is mirrored to hackr.tv #live. Type !nobridge to keep yours off it."; !ok || got != want {
+		t.Errorf("Reply(!bridge) = %q, %v; want %q", got, ok, want)
+	}
+	got, ok = r.Reply(chat(message.YouTube, "@fan", "!nobridge"))
+	if want := "@fan your chat won't be mirrored to hackr.tv #live. Type !yesbridge to undo."; !ok || got != want {
+		t.Errorf("Reply(!nobridge) = %q, %v; want %q", got, ok, want)
+	}
+	got, ok = r.Reply(chat(message.YouTube, "@fan", "!yesbridge"))
+	if want := "@fan your chat is mirrored to hackr.tv #live again. Type !nobridge to keep it off."; !ok || got != want {
+		t.Errorf("Reply(!yesbridge) = %q, %v; want %q", got, ok, want)
+	}
+	if _, ok := r.Reply(chat(message.Twitch, "viewer", "hello")); ok {
+		t.Error("Reply() answered a message that isn't a command")
+	}
+
+	// Repeats within the cooldown go unanswered
+	if _, ok := r.Reply(chat(message.Twitch, "viewer", "!bridge")); ok {
+		t.Error("Reply() answered a repeat within the cooldown")
+	}
+	if _, ok := r.Reply(chat(message.Twitch, "other", "!bridge")); !ok {
+		t.Error("the cooldown should be per viewer")
+	}
+	fake.Advance(defaultReplyCooldown)
+	if _, ok := r.Reply(chat(message.Twitch, "viewer", "!bridge")); !ok {
+		t.Error("Reply() still silent after the cooldown")
+	}
+}
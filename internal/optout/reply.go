@@ -0,0 +1,71 @@
+package optout
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+// defaultReplyCooldown is how long a viewer waits for another answer to
+// the same command.
+const defaultReplyCooldown = time.Minute
+
+// Replier words the relay's answers to opt-out commands, so chatters on
+// the source platform can see where their chat goes and how to keep it
+// there. Each viewer gets at most one answer per command per cooldown,
+// so the commands can't be used to make the relay spam chat. It is safe
+// for concurrent use.
+type Replier struct {
+	// Where names the mirror, e.g. "hackr.tv #live".
+	Where string
+	// Cooldown defaults to one minute.
+	Cooldown time.Duration
+	// Clock defaults to the wall clock.
+	Clock clock.Clock
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// Reply returns the answer to a command in msg. It reports false for
+// other messages and for viewers answered too recently.
+func (r *Replier) Reply(msg message.Message) (string, bool) {
+	cmd := Command(msg)
+	if cmd == "" || msg.Username == "" {
+		return "", false
+	}
+	now := clock.Or(r.Clock).Now()
+	cooldown := r.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultReplyCooldown
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		r.last = make(map[string]time.Time)
+	}
+	for k, t := range r.last {
+		if now.Sub(t) >= cooldown {
+			delete(r.last, k)
+		}
+	}
+	key := cmd + " " + userKey(msg)
+	if _, ok := r.last[key]; ok {
+		return "", false
+	}
+	r.last[key] = now
+
+	user := "@" + strings.TrimPrefix(msg.Username, "@")
+	switch cmd {
+	case OptOutCommand:
+		return fmt.Sprintf("%s your chat won't be mirrored to %s. Type %s to undo.", user, r.Where, OptInCommand), true
+	case OptInCommand:
+		return fmt.Sprintf("%s your chat is mirrored to %s again. Type %s to keep it off.", user, r.Where, OptOutCommand), true
+	}
+	return fmt.Sprintf("%s chat here is mirrored to %s. Type %s to keep yours off it.", user, r.Where, OptOutCommand), true
+}
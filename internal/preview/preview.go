@@ -0,0 +1,326 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"relay/internal/message"
+)
+
+const (
+	// defaultMaxConcurrent caps simultaneous page fetches.
+	defaultMaxConcurrent = 4
+	// defaultTimeout bounds how long a message waits for its previews.
+	defaultTimeout = 2 * time.Second
+
+	// maxLinks is the most URLs looked up per message.
+	maxLinks = 3
+	// maxBody is how much of a page is read looking for metadata.
+	maxBody = 512 << 10
+
+	// cacheLimit and cacheTTL bound the preview cache. Failed lookups
+	// are cached too so a dead link is not refetched for every paste.
+	cacheLimit = 500
+	cacheTTL   = time.Hour
+)
+
+// errBlockedAddress is returned when a link resolves to a loopback,
+// private, or link-local address.
+var errBlockedAddress = errors.New("preview: refusing to fetch a non-public address")
+
+// Options configures link preview fetching.
+type Options struct {
+	// Deny lists hosts whose links are never fetched. A host also
+	// covers its subdomains.
+	Deny []string
+	// MaxConcurrent caps simultaneous page fetches. Defaults to 4.
+	MaxConcurrent int
+	// Timeout bounds how long a message is held waiting for its
+	// previews before it is passed on without them. Defaults to 2s.
+	Timeout time.Duration
+}
+
+// Fetcher attaches OpenGraph link previews to messages.
+type Fetcher struct {
+	http    *http.Client
+	deny    []string
+	sem     chan struct{}
+	timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	order []string
+}
+
+type cacheEntry struct {
+	preview message.Preview
+	ok      bool
+	expires time.Time
+}
+
+// NewFetcher creates a Fetcher. Its HTTP client refuses to connect to
+// non-public addresses so chat links cannot probe the local network.
+func NewFetcher(opts Options) *Fetcher {
+	limit := opts.MaxConcurrent
+	if limit <= 0 {
+		limit = defaultMaxConcurrent
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	var deny []string
+	for _, host := range opts.Deny {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			deny = append(deny, strings.TrimPrefix(host, "."))
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	return &Fetcher{
+		http: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+		deny:    deny,
+		sem:     make(chan struct{}, limit),
+		timeout: timeout,
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+// publicOnly rejects connections to loopback, private, link-local, and
+// unspecified addresses after DNS resolution.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// Run reads messages from in, attaches previews for any links they
+// contain, and writes them to out in their original order. Lookups run
+// concurrently, so a slow page delays later messages by at most the
+// configured timeout. out is closed when in is closed.
+func (f *Fetcher) Run(ctx context.Context, in <-chan message.Message, out chan<- message.Message) {
+	pending := make(chan chan message.Message, cap(out)+1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(out)
+		for p := range pending {
+			out <- <-p
+		}
+	}()
+
+	for msg := range in {
+		p := make(chan message.Message, 1)
+		pending <- p
+		links := Links(msg.Content)
+		if len(links) == 0 {
+			p <- msg
+			continue
+		}
+		go func() {
+			msg.Previews = f.lookupAll(ctx, links)
+			p <- msg
+		}()
+	}
+	close(pending)
+	<-done
+}
+
+// lookupAll fetches previews for links concurrently, returning those that
+// were found before the timeout in link order.
+func (f *Fetcher) lookupAll(ctx context.Context, links []string) []message.Preview {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	results := make([]message.Preview, len(links))
+	found := make([]bool, len(links))
+	var wg sync.WaitGroup
+	for i, link := range links {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], found[i] = f.Lookup(ctx, link)
+		}()
+	}
+	wg.Wait()
+
+	var out []message.Preview
+	for i := range links {
+		if found[i] {
+			out = append(out, results[i])
+		}
+	}
+	return out
+}
+
+// Lookup returns the preview for link, from the cache when possible.
+// It reports false for denied hosts and pages without metadata.
+func (f *Fetcher) Lookup(ctx context.Context, link string) (message.Preview, bool) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || f.denied(u.Hostname()) {
+		return message.Preview{}, false
+	}
+
+	if p, ok, hit := f.cached(link, time.Now()); hit {
+		return p, ok
+	}
+
+	select {
+	case f.sem <- struct{}{}:
+	case <-ctx.Done():
+		return message.Preview{}, false
+	}
+	p, err := f.fetch(ctx, link)
+	<-f.sem
+
+	// Timeouts say nothing about the page, so only cache real answers.
+	if ctx.Err() == nil {
+		f.store(link, p, err == nil, time.Now())
+	}
+	return p, err == nil
+}
+
+// denied reports whether host or one of its parents is on the denylist.
+func (f *Fetcher) denied(host string) bool {
+	host = strings.ToLower(host)
+	for _, d := range f.deny {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fetcher) cached(link string, now time.Time) (p message.Preview, ok, hit bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, hit := f.cache[link]
+	if !hit || now.After(e.expires) {
+		return message.Preview{}, false, false
+	}
+	return e.preview, e.ok, true
+}
+
+// store caches a lookup result, evicting the oldest entries once full.
+func (f *Fetcher) store(link string, p message.Preview, ok bool, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.cache[link]; !exists {
+		f.order = append(f.order, link)
+	}
+	f.cache[link] = cacheEntry{preview: p, ok: ok, expires: now.Add(cacheTTL)}
+	for len(f.order) > cacheLimit {
+		delete(f.cache, f.order[0])
+		f.order = f.order[1:]
+	}
+}
+
+func (f *Fetcher) fetch(ctx context.Context, link string) (message.Preview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return message.Preview{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return message.Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return message.Preview{}, fmt.Errorf("preview: unexpected status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "html") {
+		return message.Preview{}, fmt.Errorf("preview: not an HTML page (%s)", ct)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return message.Preview{}, err
+	}
+
+	p := parseMeta(string(body))
+	if p.Title == "" {
+		return message.Preview{}, errors.New("preview: no title")
+	}
+	p.URL = link
+	return p, nil
+}
+
+var (
+	linkPattern  = regexp.MustCompile(`https?://[^\s<>"]+`)
+	metaPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrPattern  = regexp.MustCompile(`(?is)([a-z][a-z:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// Links returns up to three distinct http(s) URLs in s, without trailing
+// punctuation.
+func Links(s string) []string {
+	var out []string
+	for _, link := range linkPattern.FindAllString(s, -1) {
+		link = strings.TrimRight(link, ".,!?;:)]}'")
+		if len(out) == maxLinks {
+			break
+		}
+		if !slices.Contains(out, link) {
+			out = append(out, link)
+		}
+	}
+	return out
+}
+
+// parseMeta extracts og:title and og:image from a page, falling back to
+// the <title> element.
+func parseMeta(page string) message.Preview {
+	var p message.Preview
+	for _, tag := range metaPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		switch strings.ToLower(key) {
+		case "og:title":
+			p.Title = cleanText(attrs["content"])
+		case "og:image":
+			p.Image = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+		}
+	}
+	if p.Title == "" {
+		if m := titlePattern.FindStringSubmatch(page); m != nil {
+			p.Title = cleanText(m[1])
+		}
+	}
+	return p
+}
+
+// cleanText unescapes HTML entities and collapses whitespace.
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
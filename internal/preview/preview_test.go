@@ -0,0 +1,187 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestLinks(t *testing.T) {
+	got := Links("see https://a.example/x, (http://b.example/y) and https://a.example/x again https://c.example https://d.example")
+	want := []string{"https://a.example/x", "http://b.example/y", "https://c.example"}
+	if len(got) != len(want) {
+		t.Fatalf("Links() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Links()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if got := Links("no links here"); got != nil {
+		t.Errorf("Links() = %q, want none", got)
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	page := `<html><head>
+<title>Fallback</title>
+<meta property="og:title" content="The  Grid &amp; You">
+<meta content='https://img.example/p.png' property='og:image' />
+</head></html>`
+	p := parseMeta(page)
+	if p.Title != "The Grid & You" {
+		t.Errorf("Title = %q", p.Title)
+	}
+	if p.Image != "https://img.example/p.png" {
+		t.Errorf("Image = %q", p.Image)
+	}
+
+	if p := parseMeta("<title>\n  Just a title </title>"); p.Title != "Just a title" {
+		t.Errorf("fallback Title = %q", p.Title)
+	}
+}
+
+// testFetcher returns a Fetcher that may reach the loopback test server.
+func testFetcher(server *httptest.Server, opts Options) *Fetcher {
+	f := NewFetcher(opts)
+	f.http = server.Client()
+	return f
+}
+
+func TestLookupCachesResults(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `<meta property="og:title" content="Hello">`)
+	}))
+	defer server.Close()
+
+	f := testFetcher(server, Options{})
+	for i := 0; i < 2; i++ {
+		p, ok := f.Lookup(context.Background(), server.URL+"/page")
+		if !ok || p.Title != "Hello" || p.URL != server.URL+"/page" {
+			t.Errorf("Lookup() = %+v, %v", p, ok)
+		}
+		if _, ok := f.Lookup(context.Background(), server.URL+"/missing"); ok {
+			t.Error("Lookup() of a 404 should fail")
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("server hits = %d, want 2 (one per link, then cached)", got)
+	}
+}
+
+func TestLookupDenylist(t *testing.T) {
+	f := NewFetcher(Options{Deny: []string{"Example.com"}})
+	if !f.denied("cdn.example.com") {
+		t.Error("subdomain of a denied host should be denied")
+	}
+	for _, link := range []string{"https://example.com/a", "https://cdn.example.com/b", "ftp://other.test/c"} {
+		if _, ok := f.Lookup(context.Background(), link); ok {
+			t.Errorf("Lookup(%q) should be refused", link)
+		}
+	}
+	if f.denied("notexample.com") {
+		t.Error("notexample.com should not match example.com")
+	}
+}
+
+func TestLookupRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the fetcher reached a loopback server")
+	}))
+	defer server.Close()
+
+	f := NewFetcher(Options{})
+	if _, ok := f.Lookup(context.Background(), server.URL); ok {
+		t.Error("Lookup() of a loopback address should fail")
+	}
+}
+
+func TestRunKeepsOrderAndCapsConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// The first link is slowest, so its message finishes last.
+		if r.URL.Path == "/0" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<title>page %s</title>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	f := testFetcher(server, Options{MaxConcurrent: 2, Timeout: 5 * time.Second})
+	in := make(chan message.Message, 6)
+	out := make(chan message.Message, 6)
+	for i := 0; i < 5; i++ {
+		in <- message.Message{Content: fmt.Sprintf("link %s/%d", server.URL, i)}
+	}
+	in <- message.Message{Content: "plain"}
+	close(in)
+
+	f.Run(context.Background(), in, out)
+
+	var got []message.Message
+	for msg := range out {
+		got = append(got, msg)
+	}
+	if len(got) != 6 {
+		t.Fatalf("got %d messages, want 6", len(got))
+	}
+	for i := 0; i < 5; i++ {
+		if len(got[i].Previews) != 1 || got[i].Previews[0].Title != fmt.Sprintf("page /%d", i) {
+			t.Errorf("message %d previews = %+v", i, got[i].Previews)
+		}
+	}
+	if got[5].Content != "plain" || got[5].Previews != nil {
+		t.Errorf("last message = %+v", got[5])
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("peak concurrent fetches = %d, want at most 2", p)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	f := testFetcher(server, Options{Timeout: 50 * time.Millisecond})
+	in := make(chan message.Message, 1)
+	out := make(chan message.Message, 1)
+	in <- message.Message{Content: server.URL}
+	close(in)
+
+	start := time.Now()
+	f.Run(context.Background(), in, out)
+	msg := <-out
+	if msg.Previews != nil {
+		t.Errorf("Previews = %+v, want none after timeout", msg.Previews)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Run took %s, want about the 50ms timeout", d)
+	}
+}
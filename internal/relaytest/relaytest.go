@@ -0,0 +1,126 @@
+// Package relaytest provides helpers for testing code that consumes or
+// produces chat messages: a scripted source, a sink that records what it
+// is handed, a manually advanced clock, and a goroutine leak check.
+package relaytest
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+// Source is a scripted chat source. Connect has the same shape as the
+// platform clients' Connect, so a Source can stand in for one.
+type Source struct {
+	msgs []message.Message
+}
+
+// NewSource returns a source that sends msgs in order.
+func NewSource(msgs ...message.Message) *Source {
+	return &Source{msgs: msgs}
+}
+
+// Connect sends the scripted messages, then blocks until ctx is
+// cancelled, like a live connection with nothing more to say.
+func (s *Source) Connect(ctx context.Context, messages chan<- message.Message) error {
+	for _, msg := range s.msgs {
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Sink records every message it handles. Its Handle method fits the
+// dispatcher's Sink.Handle, and it is safe for concurrent use.
+type Sink struct {
+	mu   sync.Mutex
+	msgs []message.Message
+	// added is closed and replaced on every Handle, waking waiters.
+	added chan struct{}
+}
+
+// NewSink returns an empty capture sink.
+func NewSink() *Sink {
+	return &Sink{added: make(chan struct{})}
+}
+
+// Handle records msg.
+func (s *Sink) Handle(msg message.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, msg)
+	close(s.added)
+	s.added = make(chan struct{})
+}
+
+// Messages returns a copy of the messages handled so far.
+func (s *Sink) Messages() []message.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]message.Message(nil), s.msgs...)
+}
+
+// Wait returns the first n messages once they have been handled, failing
+// t if that takes longer than a second.
+func (s *Sink) Wait(t testing.TB, n int) []message.Message {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		s.mu.Lock()
+		if len(s.msgs) >= n {
+			msgs := append([]message.Message(nil), s.msgs[:n]...)
+			s.mu.Unlock()
+			return msgs
+		}
+		added := s.added
+		got := len(s.msgs)
+		s.mu.Unlock()
+
+		select {
+		case <-added:
+		case <-deadline:
+			t.Fatalf("sink got %d messages, want %d", got, n)
+			return nil
+		}
+	}
+}
+
+// Clock is a manually advanced clock. It implements clock.Clock, and its
+// Now method can also be passed wherever a package takes a
+// now func() time.Time.
+type Clock = clock.Fake
+
+// NewClock returns a clock stopped at start.
+func NewClock(start time.Time) *Clock {
+	return clock.NewFake(start)
+}
+
+// NoLeaks fails t unless every goroutine started after the call has
+// exited within bound of the test finishing, counting cleanups
+// registered later, which run first. It counts every goroutine in the
+// process, so tests using it must not run in parallel.
+func NoLeaks(t testing.TB, bound time.Duration) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(bound)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				buf = buf[:runtime.Stack(buf, true)]
+				t.Errorf("%d goroutines still running %s after the test, %d before:\n%s", runtime.NumGoroutine(), bound, before, buf)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package relaytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestSourceToSink(t *testing.T) {
+	src := NewSource(
+		message.Message{Platform: message.Twitch, Content: "one"},
+		message.Message{Platform: message.YouTube, Content: "two"},
+	)
+	sink := NewSink()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan message.Message)
+	done := make(chan error)
+	go func() { done <- src.Connect(ctx, messages) }()
+	go func() {
+		for msg := range messages {
+			sink.Handle(msg)
+		}
+	}()
+
+	got := sink.Wait(t, 2)
+	if got[0].Content != "one" || got[1].Content != "two" {
+		t.Errorf("sink got %+v, want the scripted messages in order", got)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Connect() = %v, want context.Canceled", err)
+	}
+	close(messages)
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	c := NewClock(start)
+	c.Advance(90 * time.Second)
+	if got := c.Now(); !got.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("Now() = %v", got)
+	}
+}
+
+func TestNoLeaks(t *testing.T) {
+	NoLeaks(t, time.Second)
+	// A goroutine a later cleanup stops isn't a leak
+	stop := make(chan struct{})
+	go func() { <-stop }()
+	t.Cleanup(func() { close(stop) })
+}
@@ -0,0 +1,80 @@
+// Package retention decides which records of an append-only file to keep
+// so that files a long-running relay writes don't grow without bound.
+package retention
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy bounds a file by the age of its records and its total size. The
+// zero value keeps everything.
+type Policy struct {
+	// MaxAge drops records older than this. Zero keeps them.
+	MaxAge time.Duration
+	// MaxSize drops the oldest records until the rest fit in this many
+	// bytes. Zero means no limit.
+	MaxSize int64
+}
+
+// IsZero reports whether the policy keeps everything.
+func (p Policy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxSize <= 0
+}
+
+// Record is one entry of a file, oldest first.
+type Record struct {
+	// Time is when the record was written. Records with no time are only
+	// dropped to save space.
+	Time time.Time
+	// Size is the record's length in bytes.
+	Size int
+}
+
+// Keep returns the index of the first record to keep: older records, and
+// the oldest of the rest while they don't fit in MaxSize, are dropped.
+func (p Policy) Keep(records []Record, now time.Time) int {
+	start := 0
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for i, r := range records {
+			if !r.Time.IsZero() && r.Time.Before(cutoff) {
+				start = i + 1
+			}
+		}
+	}
+	if p.MaxSize > 0 {
+		var total int64
+		for _, r := range records[start:] {
+			total += int64(r.Size)
+		}
+		for start < len(records) && total > p.MaxSize {
+			total -= int64(records[start].Size)
+			start++
+		}
+	}
+	return start
+}
+
+// ParseSize parses a size such as "512KB", "10MB", "1GB", or a plain
+// number of bytes. Units are powers of 1024.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, mult = strings.TrimSpace(rest), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, e.g. \"10MB\"", size)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,48 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeep(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	records := []Record{
+		{Time: now.Add(-48 * time.Hour), Size: 10},
+		{Time: now.Add(-25 * time.Hour), Size: 10},
+		{Size: 10},
+		{Time: now.Add(-time.Hour), Size: 30},
+		{Time: now, Size: 20},
+	}
+	tests := []struct {
+		name   string
+		policy Policy
+		want   int
+	}{
+		{"zero", Policy{}, 0},
+		{"age", Policy{MaxAge: 24 * time.Hour}, 2},
+		{"size", Policy{MaxSize: 50}, 3},
+		{"size fits", Policy{MaxSize: 80}, 0},
+		{"both", Policy{MaxAge: 30 * time.Hour, MaxSize: 60}, 2},
+		{"nothing fits", Policy{MaxSize: 5}, 5},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Keep(records, now); got != tt.want {
+			t.Errorf("%s: Keep() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"1024": 1024, "512KB": 512 << 10, "10 mb": 10 << 20, "1GB": 1 << 30, "7B": 7}
+	for in, want := range tests {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "ten MB", "-1KB", "1TB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package safemode notices when the relay keeps crashing, so it can start
+// with only what it needs to show chat instead of taking a live stream's
+// bridge down again and again with a bad setting or a corrupt file.
+package safemode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"relay/internal/clock"
+)
+
+// FileName is the file in the state dir that records runs and crashes.
+const FileName = "crashes.json"
+
+// Options configures a Guard. The zero value, with Dir set, uses the
+// defaults.
+type Options struct {
+	// Dir is the state dir the record is kept in. Empty records nothing,
+	// and the relay never starts in safe mode.
+	Dir string
+	// Crashes is how many crashes within Window start the relay in safe
+	// mode. Defaults to 3; negative never does.
+	Crashes int
+	// Window is how recent a crash must be to count. Defaults to 10m.
+	Window time.Duration
+	// Clock defaults to the wall clock.
+	Clock clock.Clock
+}
+
+// record is the file's contents.
+type record struct {
+	// Running is when the current run started, or zero after a clean
+	// exit. A run still marked when the next one starts crashed.
+	Running time.Time `json:"running,omitzero"`
+	// Crashes holds when each recent crashed run started, oldest first.
+	Crashes []time.Time `json:"crashes,omitempty"`
+}
+
+// Guard marks one run of the relay in the state dir until Stop.
+type Guard struct {
+	path    string
+	crashes []time.Time
+	safe    bool
+}
+
+// Start marks this run as started and counts the crashes before it: a
+// run that never called Stop counts as one, whether it panicked, was
+// killed, or exited on an error. A missing or unreadable record counts
+// none.
+func Start(opts Options) (*Guard, error) {
+	if opts.Dir == "" {
+		return &Guard{}, nil
+	}
+	if opts.Crashes == 0 {
+		opts.Crashes = 3
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Minute
+	}
+	now := clock.Or(opts.Clock).Now()
+	g := &Guard{path: filepath.Join(opts.Dir, FileName)}
+
+	var rec record
+	if data, err := os.ReadFile(g.path); err == nil {
+		if err := json.Unmarshal(data, &rec); err != nil {
+			fmt.Fprintf(os.Stderr, "Crash record error: %s: %v\n", g.path, err)
+			rec = record{}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !rec.Running.IsZero() {
+		rec.Crashes = append(rec.Crashes, rec.Running)
+	}
+	cutoff := now.Add(-opts.Window)
+	for _, t := range rec.Crashes {
+		if !t.Before(cutoff) {
+			g.crashes = append(g.crashes, t)
+		}
+	}
+	g.safe = opts.Crashes > 0 && len(g.crashes) >= opts.Crashes
+
+	if err := save(g.path, record{Running: now, Crashes: g.crashes}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Safe reports whether enough runs crashed recently that this one should
+// start in safe mode.
+func (g *Guard) Safe() bool {
+	return g.safe
+}
+
+// Crashes returns when each crashed run within the window started,
+// oldest first.
+func (g *Guard) Crashes() []time.Time {
+	return g.crashes
+}
+
+// Stop records a clean exit, which clears the crash history: the next
+// run starts normally.
+func (g *Guard) Stop() error {
+	if g.path == "" {
+		return nil
+	}
+	return save(g.path, record{})
+}
+
+// save writes rec to path, replacing it atomically.
+func save(path string, rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,102 @@
+package safemode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+)
+
+var start = time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+
+// crash starts a run and leaves it without stopping, as a crash does.
+func crash(t *testing.T, opts Options) *Guard {
+	t.Helper()
+	g, err := Start(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestRepeatedCrashesStartSafe(t *testing.T) {
+	clk := clock.NewFake(start)
+	opts := Options{Dir: t.TempDir(), Clock: clk}
+
+	for i := range 3 {
+		if g := crash(t, opts); g.Safe() {
+			t.Fatalf("run %d is safe after %d crashes", i+1, i)
+		}
+		clk.Advance(time.Minute)
+	}
+	g := crash(t, opts)
+	if !g.Safe() || len(g.Crashes()) != 3 {
+		t.Fatalf("Safe() = %v with %d crashes, want safe after 3", g.Safe(), len(g.Crashes()))
+	}
+	if got := g.Crashes()[0]; !got.Equal(start) {
+		t.Errorf("first crash = %v, want %v", got, start)
+	}
+
+	// A clean exit clears the history
+	if err := g.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if g := crash(t, opts); g.Safe() || len(g.Crashes()) != 0 {
+		t.Errorf("run after a clean exit: Safe() = %v, %d crashes", g.Safe(), len(g.Crashes()))
+	}
+}
+
+func TestOldCrashesDontCount(t *testing.T) {
+	clk := clock.NewFake(start)
+	opts := Options{Dir: t.TempDir(), Crashes: 2, Window: 5 * time.Minute, Clock: clk}
+
+	crash(t, opts)
+	clk.Advance(10 * time.Minute)
+	crash(t, opts)
+	clk.Advance(time.Minute)
+	// Only the second run's crash is within the window
+	if g := crash(t, opts); g.Safe() || len(g.Crashes()) != 1 {
+		t.Errorf("Safe() = %v with %d crashes, want 1 recent crash", g.Safe(), len(g.Crashes()))
+	}
+	if g := crash(t, opts); !g.Safe() {
+		t.Error("two crashes in the window didn't start safe")
+	}
+}
+
+func TestNeverSafe(t *testing.T) {
+	opts := Options{Dir: t.TempDir(), Crashes: -1}
+	for range 5 {
+		if crash(t, opts).Safe() {
+			t.Fatal("Crashes: -1 started safe")
+		}
+	}
+}
+
+func TestCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Start(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Safe() || len(g.Crashes()) != 0 {
+		t.Errorf("corrupt record: Safe() = %v, %d crashes", g.Safe(), len(g.Crashes()))
+	}
+}
+
+func TestNoDir(t *testing.T) {
+	g, err := Start(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Safe() {
+		t.Error("Safe() without a state dir")
+	}
+	if err := g.Stop(); err != nil {
+		t.Errorf("Stop() = %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package server guards the relay's local servers: where they may listen,
+// who may connect, and what each caller may do.
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Scope is what a caller may do. Each scope includes the ones below it.
+type Scope int
+
+const (
+	// ScopeNone grants nothing.
+	ScopeNone Scope = iota
+	// ScopeRead may read chat, analytics, and stats.
+	ScopeRead
+	// ScopeControl may also change what the relay is doing.
+	ScopeControl
+)
+
+// ParseScope reads "read" or "control". Empty means read, the safer one.
+func ParseScope(s string) (Scope, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "read":
+		return ScopeRead, nil
+	case "control":
+		return ScopeControl, nil
+	}
+	return ScopeNone, fmt.Errorf("unknown scope %q (expected read or control)", s)
+}
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeRead:
+		return "read"
+	case ScopeControl:
+		return "control"
+	}
+	return "none"
+}
+
+// Options configures access to a server.
+type Options struct {
+	// Tokens maps bearer tokens, sent as "Authorization: Bearer <token>"
+	// or, for browsers, an access_token query parameter, to the scope
+	// each grants.
+	Tokens map[string]Scope
+	// CertFile and KeyFile serve TLS instead of plain HTTP.
+	CertFile string
+	KeyFile  string
+	// ClientCA, with TLS, requires every client to present a certificate
+	// signed by one of the PEM certificates in this file (mTLS). A
+	// verified certificate grants ClientScope, which defaults to read.
+	ClientCA    string
+	ClientScope Scope
+	// AllowRemote permits listening on addresses other than loopback.
+	// It requires Tokens or ClientCA, so a reachable server is never open.
+	AllowRemote bool
+}
+
+// Guard enforces Options. Without tokens or a client CA every caller gets
+// the control scope, which is only allowed on loopback addresses.
+type Guard struct {
+	opts Options
+	tls  *tls.Config
+}
+
+// New checks opts and loads its certificates.
+func New(opts Options) (*Guard, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("tls_cert and tls_key must be set together")
+	}
+	if opts.ClientCA != "" && opts.CertFile == "" {
+		return nil, errors.New("client_ca requires tls_cert and tls_key")
+	}
+	if opts.AllowRemote && len(opts.Tokens) == 0 && opts.ClientCA == "" {
+		return nil, errors.New("allow_remote requires tokens or client_ca")
+	}
+	if opts.ClientScope == ScopeNone {
+		opts.ClientScope = ScopeRead
+	}
+	g := &Guard{opts: opts}
+	if opts.CertFile == "" {
+		return g, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	g.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if opts.ClientCA != "" {
+		pem, err := os.ReadFile(opts.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates", opts.ClientCA)
+		}
+		g.tls.ClientCAs = pool
+		g.tls.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return g, nil
+}
+
+// TLSConfig returns the server's TLS configuration, or nil to serve plain
+// HTTP.
+func (g *Guard) TLSConfig() *tls.Config {
+	return g.tls
+}
+
+// CheckListen rejects addresses reachable from other machines, such as
+// ":8787" or "0.0.0.0:8787", unless AllowRemote is set.
+func (g *Guard) CheckListen(addr string) error {
+	if g.opts.AllowRemote {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if isLoopback(host) {
+		return nil
+	}
+	return fmt.Errorf("%s is not a loopback address; set allow_remote = true under [server] to listen on it", addr)
+}
+
+// Require serves h only to callers granted at least scope. Callers with
+// no credentials get 401, and those whose credentials grant too little
+// get 403.
+func (g *Guard) Require(scope Scope, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted, presented := g.scope(r)
+		switch {
+		case granted >= scope:
+			h.ServeHTTP(w, r)
+		case !presented:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "forbidden: needs "+scope.String()+" scope", http.StatusForbidden)
+		}
+	})
+}
+
+// SameOrigin serves h only to requests addressed to addr, the address the
+// server listens on, and not sent by another site's page. A Host naming
+// some other server is DNS rebinding, another site's name resolving to
+// loopback, and an Origin other than the Host is another site's page
+// posting cross-origin; both get 403. These matter most without tokens,
+// where every loopback caller has the control scope. On an address
+// listening on every interface, such as ":8787", any Host is accepted,
+// but the Origin must still match it.
+func SameOrigin(addr string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hostMatches(addr, r) {
+			http.Error(w, "forbidden: Host does not match the server's address", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !strings.EqualFold(u.Host, r.Host) {
+				http.Error(w, "forbidden: cross-origin request", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// hostMatches reports whether r's Host names addr. Loopback addresses
+// also answer to localhost and the other loopback IPs.
+func hostMatches(addr string, r *http.Request) bool {
+	listenHost, listenPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// No port: the scheme's default
+		host, port = r.Host, "80"
+		if r.TLS != nil {
+			port = "443"
+		}
+	}
+	if port != listenPort {
+		return false
+	}
+	if listenHost == "" {
+		return true
+	}
+	if ip := net.ParseIP(listenHost); ip != nil && ip.IsUnspecified() {
+		return true
+	}
+	if isLoopback(listenHost) {
+		return isLoopback(host)
+	}
+	return strings.EqualFold(host, listenHost)
+}
+
+// isLoopback reports whether host is localhost or a loopback IP.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// scope returns the most a request's credentials grant, and whether it
+// presented any.
+func (g *Guard) scope(r *http.Request) (granted Scope, presented bool) {
+	if len(g.opts.Tokens) == 0 && g.opts.ClientCA == "" {
+		return ScopeControl, false
+	}
+	if g.opts.ClientCA != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		granted, presented = g.opts.ClientScope, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.URL.Query().Has("access_token") {
+		token, ok = r.URL.Query().Get("access_token"), true
+	}
+	if ok {
+		presented = true
+		for t, s := range g.opts.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				granted = max(granted, s)
+			}
+		}
+	}
+	return granted, presented
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckListen(t *testing.T) {
+	local, _ := New(Options{})
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:8787": true,
+		"[::1]:8787":     true,
+		"localhost:8787": true,
+		":8787":          false,
+		"0.0.0.0:8787":   false,
+		"192.0.2.7:8787": false,
+	} {
+		if err := local.CheckListen(addr); (err == nil) != ok {
+			t.Errorf("CheckListen(%q) = %v, want allowed %v", addr, err, ok)
+		}
+	}
+
+	remote, err := New(Options{AllowRemote: true, Tokens: map[string]Scope{"t": ScopeRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.CheckListen(":8787"); err != nil {
+		t.Errorf("CheckListen() with allow_remote = %v", err)
+	}
+	if _, err := New(Options{AllowRemote: true}); err == nil {
+		t.Error("allow_remote without tokens or client_ca should be rejected")
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		addr, host, origin string
+		want               int
+	}{
+		{"127.0.0.1:8787", "127.0.0.1:8787", "", http.StatusOK},
+		{"127.0.0.1:8787", "localhost:8787", "http://localhost:8787", http.StatusOK},
+		{"[::1]:8787", "[::1]:8787", "", http.StatusOK},
+		// DNS rebinding: another site's name pointed at loopback
+		{"127.0.0.1:8787", "evil.example:8787", "", http.StatusForbidden},
+		{"127.0.0.1:8787", "127.0.0.1:9999", "", http.StatusForbidden},
+		// Another site's page posting to the relay
+		{"127.0.0.1:8787", "127.0.0.1:8787", "http://evil.example", http.StatusForbidden},
+		{"127.0.0.1:8787", "127.0.0.1:8787", "null", http.StatusForbidden},
+		{":8787", "relay.lan:8787", "http://relay.lan:8787", http.StatusOK},
+		{":8787", "relay.lan:8787", "http://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		SameOrigin(tt.addr, ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("listening on %s, Host %s, Origin %q: status %d, want %d", tt.addr, tt.host, tt.origin, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRequireTokens(t *testing.T) {
+	g, err := New(Options{Tokens: map[string]Scope{"reader": ScopeRead, "admin": ScopeControl}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		token string
+		scope Scope
+		want  int
+	}{
+		{"", ScopeRead, http.StatusUnauthorized},
+		{"wrong", ScopeRead, http.StatusForbidden},
+		{"reader", ScopeRead, http.StatusOK},
+		{"reader", ScopeControl, http.StatusForbidden},
+		{"admin", ScopeControl, http.StatusOK},
+		{"admin", ScopeRead, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/bridge", nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		g.Require(tt.scope, ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("token %q for %s: status %d, want %d", tt.token, tt.scope, w.Code, tt.want)
+		}
+	}
+
+	// Browsers' EventSource can't set headers, so the query works too
+	w := httptest.NewRecorder()
+	g.Require(ScopeRead, ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard/events?access_token=reader", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("access_token query: status %d, want 200", w.Code)
+	}
+
+	// With no credentials configured, loopback callers may do anything
+	open, _ := New(Options{})
+	w = httptest.NewRecorder()
+	open.Require(ScopeControl, ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("open guard: status %d, want 200", w.Code)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCert(t, nil, nil, "relay test CA")
+	serverCert, serverKey := newCert(t, ca, caKey, "127.0.0.1")
+	clientCert, clientKey := newCert(t, ca, caKey, "overlay")
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600)
+		return path
+	}
+	keyDER := func(k *ecdsa.PrivateKey) []byte {
+		der, _ := x509.MarshalPKCS8PrivateKey(k)
+		return der
+	}
+
+	g, err := New(Options{
+		CertFile: write("server.pem", "CERTIFICATE", serverCert.Raw),
+		KeyFile:  write("server.key", "PRIVATE KEY", keyDER(serverKey)),
+		ClientCA: write("ca.pem", "CERTIFICATE", ca.Raw),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(g.Require(ScopeRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	srv.TLS = g.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+	if _, err := client().Get(srv.URL); err == nil {
+		t.Error("a client without a certificate was served")
+	}
+	resp, err := client(tls.Certificate{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("verified client: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// newCert issues a certificate for name, signed by parent, or a CA
+// certificate when parent is nil.
+func newCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = tmpl, key
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,225 @@
+package setup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"relay/internal/config"
+	"relay/internal/hackrtv"
+	"relay/internal/message"
+	"relay/internal/uplink"
+)
+
+// testContent is what the test send posts.
+const testContent = "relay setup test message, safe to ignore"
+
+// hackrTVSettings are the answers being checked.
+type hackrTVSettings struct {
+	url, alias, token, channel string
+	// mode is the auth_mode that posted the test message.
+	mode string
+}
+
+// HackrTV walks through bridging to hackr.tv: it asks for the cable
+// address, hackr alias, API token, and chat channel, connects to check
+// the token and the channel's subscription, posts a test message (and
+// drops it again where the Uplink API allows), then writes the settings
+// into the config file's [hackrtv] table. Failed checks explain the
+// likely cause and ask again for the setting at fault. Settings already
+// in the config file, and HACKRTV_API_TOKEN, are offered as defaults.
+func HackrTV(ctx context.Context, opts Options) error {
+	w := newWizard(opts)
+	var cur config.HackrTVConfig
+	cfg, err := config.Load(w.config)
+	switch {
+	case err == nil:
+		cur = cfg.HackrTV
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	envToken := os.Getenv("HACKRTV_API_TOKEN")
+	s := hackrTVSettings{
+		url:     cmp.Or(cur.URL, "wss://hackr.tv/cable"),
+		alias:   cmp.Or(cur.Alias, "relay"),
+		token:   cmp.Or(cur.Token, envToken),
+		channel: "live",
+		mode:    cmp.Or(cur.AuthMode, "admin"),
+	}
+	if chans := cur.AllChannels(); len(chans) > 0 {
+		s.channel = chans[0]
+	}
+
+	fmt.Fprintf(w.out, "hackr.tv setup: each setting is checked against the server before it is saved to %s.\n\n", w.config)
+	if err := w.connect(ctx, &s); err != nil {
+		return err
+	}
+	save, err := w.testSend(ctx, &s)
+	if err != nil || !save {
+		return err
+	}
+
+	settings := []Setting{
+		{"url", s.url},
+		{"channel", s.channel},
+		{"alias", s.alias},
+		{"auth_mode", s.mode},
+	}
+	if s.token != envToken {
+		settings = append(settings, Setting{"token", s.token})
+	}
+	if ok, err := w.confirm(fmt.Sprintf("Save these settings to %s?", w.config), true); err != nil || !ok {
+		if err == nil {
+			fmt.Fprintln(w.out, "Nothing was saved.")
+		}
+		return err
+	}
+	if err := SetTable(w.config, "hackrtv", settings); err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "Saved [hackrtv] to %s.\n", w.config)
+	if s.token == envToken {
+		fmt.Fprintln(w.out, "The token was left out, since it comes from HACKRTV_API_TOKEN.")
+	}
+	fmt.Fprintf(w.out, "Start bridging with: relay --config %s --bridge\n", w.config)
+	return nil
+}
+
+// connect asks for the address, login, and channel until the server
+// accepts them.
+func (w *wizard) connect(ctx context.Context, s *hackrTVSettings) error {
+	askAddress, askLogin, askChannel := true, true, true
+	for {
+		var err error
+		for askAddress {
+			if s.url, err = w.ask("hackr.tv address", s.url); err != nil {
+				return err
+			}
+			var u string
+			if u, err = CableURL(s.url); err != nil {
+				fmt.Fprintf(w.out, "  %v\n", err)
+				continue
+			}
+			s.url, askAddress = u, false
+		}
+		if askLogin {
+			if s.alias, err = w.ask("Hackr alias", s.alias); err != nil {
+				return err
+			}
+			hint := "keep the saved token"
+			if s.token == os.Getenv("HACKRTV_API_TOKEN") {
+				hint = "use HACKRTV_API_TOKEN"
+			}
+			if s.token, err = w.askSecret("API token (not shown)", s.token, hint); err != nil {
+				return err
+			}
+		}
+		if askChannel {
+			if s.channel, err = w.ask("Chat channel", s.channel); err != nil {
+				return err
+			}
+		}
+		askLogin, askChannel = false, false
+
+		fmt.Fprintf(w.out, "Connecting to %s as %s... ", s.url, s.alias)
+		checkCtx, cancel := context.WithTimeout(ctx, w.timeout)
+		err = hackrtv.NewClient(s.url, s.token, s.alias, []string{s.channel}, hackrtv.Options{}).Check(checkCtx, nil)
+		cancel()
+		if err == nil {
+			fmt.Fprintf(w.out, "ok, joined #%s\n", s.channel)
+			return nil
+		}
+		fmt.Fprintf(w.out, "failed\n  %v\n", err)
+		switch {
+		case errors.Is(err, hackrtv.ErrAuth):
+			fmt.Fprintf(w.out, "  hackr.tv refused the token for %s. A token belongs to one hackr, so check the alias\n"+
+				"  is that hackr's, and copy the token again from their hackr.tv settings.\n", s.alias)
+			askLogin = true
+		case errors.Is(err, hackrtv.ErrSubscriptionRejected), errors.Is(err, hackrtv.ErrUnconfirmed):
+			fmt.Fprintf(w.out, "  The server wouldn't let %s join #%s. Check the channel's slug (the part after\n"+
+				"  /chat/ in its address) and that %s may read it.\n", s.alias, s.channel, s.alias)
+			askChannel = true
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			fmt.Fprintln(w.out, "  Check the address: it is hackr.tv's ActionCable endpoint, e.g. wss://hackr.tv/cable.")
+			askAddress = true
+		}
+	}
+}
+
+// testSend posts a test message, through the Uplink API or, if the token
+// isn't an admin's, as a regular hackr. It reports whether to save.
+func (w *wizard) testSend(ctx context.Context, s *hackrTVSettings) (bool, error) {
+	send, err := w.confirm(fmt.Sprintf("Post a test message to #%s?", s.channel), true)
+	if err != nil || !send {
+		return err == nil, err
+	}
+	msg := message.Message{Platform: message.Relay, Username: s.alias, Content: testContent, Timestamp: time.Now()}
+
+	fmt.Fprint(w.out, "Posting through the Uplink API... ")
+	up, err := uplink.NewClient(s.url, s.token, s.alias, s.channel, uplink.Options{SendTimeout: w.timeout})
+	if err != nil {
+		return false, err
+	}
+	id, err := up.Post(ctx, msg)
+	switch {
+	case err == nil:
+		fmt.Fprintln(w.out, "ok")
+		s.mode = "admin"
+		w.drop(ctx, up, id)
+		return true, nil
+	case errors.Is(err, uplink.ErrAuth):
+		fmt.Fprintf(w.out, "refused\n  %v\n  The Uplink API takes admin tokens only. %s's token can read chat, and can still post\n"+
+			"  as a regular hackr over the chat connection (auth_mode = \"user\").\n", err, s.alias)
+		user, err := w.confirm("Post as a regular hackr instead?", true)
+		if err != nil {
+			return false, err
+		}
+		if user {
+			return w.userSend(ctx, s, msg)
+		}
+	default:
+		fmt.Fprintf(w.out, "failed\n  %v\n", err)
+	}
+	return w.confirm("Save the settings anyway?", false)
+}
+
+// drop removes the test message, or says how to.
+func (w *wizard) drop(ctx context.Context, up *uplink.Client, id string) {
+	if id == "" {
+		fmt.Fprintln(w.out, "  hackr.tv didn't say which packet it made, so delete the test message by hand.")
+		return
+	}
+	fmt.Fprint(w.out, "Deleting the test message... ")
+	switch err := up.Drop(ctx, id); {
+	case err == nil:
+		fmt.Fprintln(w.out, "ok")
+	case errors.Is(err, uplink.ErrNoDrop):
+		fmt.Fprintf(w.out, "not supported by this server\n  Delete packet %s by hand if it's in the way.\n", id)
+	default:
+		fmt.Fprintf(w.out, "failed\n  %v\n  Delete packet %s by hand if it's in the way.\n", err, id)
+	}
+}
+
+// userSend posts the test message as a regular hackr over the cable.
+func (w *wizard) userSend(ctx context.Context, s *hackrTVSettings, msg message.Message) (bool, error) {
+	fmt.Fprintf(w.out, "Posting as %s... ", s.alias)
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	cable := hackrtv.NewClient(s.url, s.token, s.alias, []string{s.channel}, hackrtv.Options{})
+	err := cable.Check(ctx, func(ctx context.Context) error {
+		return uplink.NewUserClient(cable, s.channel, uplink.Options{}).Send(ctx, msg)
+	})
+	if err != nil {
+		fmt.Fprintf(w.out, "failed\n  %v\n", err)
+		return w.confirm("Save the settings anyway?", false)
+	}
+	fmt.Fprintln(w.out, "ok\n  Messages posted as a hackr can't be deleted by the relay; remove it by hand if you like.")
+	s.mode = "user"
+	return true, nil
+}
@@ -0,0 +1,306 @@
+// Package setup holds the interactive wizards behind "relay setup", which
+// ask for a service's settings, check them against the live service, and
+// write the ones that work into the config file.
+package setup
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// defaultTimeout bounds each check against a live service.
+const defaultTimeout = 15 * time.Second
+
+// ErrAborted is returned when input ends before a wizard is done.
+var ErrAborted = errors.New("setup: input ended before setup finished")
+
+// Options configures a wizard. The zero value talks on stdin and stdout
+// and writes relay.toml.
+type Options struct {
+	// In and Out are the terminal the wizard talks on. Default to
+	// os.Stdin and os.Stdout.
+	In  io.Reader
+	Out io.Writer
+	// ReadSecret reads a token or password without echoing it. Defaults
+	// to hidden input when In is a terminal, and a plain line otherwise.
+	ReadSecret func() (string, error)
+	// Config is the TOML file the checked settings are written to.
+	// Defaults to "relay.toml".
+	Config string
+	// Timeout bounds each check against the service. Defaults to 15s.
+	Timeout time.Duration
+}
+
+// wizard is the prompting shared by the wizards.
+type wizard struct {
+	in      *bufio.Reader
+	out     io.Writer
+	secret  func() (string, error)
+	config  string
+	timeout time.Duration
+}
+
+func newWizard(opts Options) *wizard {
+	var in io.Reader = os.Stdin
+	if opts.In != nil {
+		in = opts.In
+	}
+	var out io.Writer = os.Stdout
+	if opts.Out != nil {
+		out = opts.Out
+	}
+	w := &wizard{
+		in:      bufio.NewReader(in),
+		out:     out,
+		secret:  opts.ReadSecret,
+		config:  cmp.Or(opts.Config, "relay.toml"),
+		timeout: cmp.Or(opts.Timeout, defaultTimeout),
+	}
+	if w.secret == nil {
+		w.secret = w.line
+		if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			w.secret = func() (string, error) {
+				b, err := term.ReadPassword(int(f.Fd()))
+				fmt.Fprintln(w.out)
+				return string(b), err
+			}
+		}
+	}
+	return w
+}
+
+// line reads one line of input, trimmed.
+func (w *wizard) line() (string, error) {
+	s, err := w.in.ReadString('\n')
+	if err != nil && (s == "" || !errors.Is(err, io.EOF)) {
+		if errors.Is(err, io.EOF) {
+			return "", ErrAborted
+		}
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// ask prompts for a value, which is def when the answer is blank. With no
+// default it asks until it gets an answer.
+func (w *wizard) ask(prompt, def string) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", prompt)
+		}
+		s, err := w.line()
+		if err != nil {
+			return "", err
+		}
+		if s = cmp.Or(s, def); s != "" {
+			return s, nil
+		}
+	}
+}
+
+// askSecret is ask without echoing the answer. hint describes the default
+// in place of showing it.
+func (w *wizard) askSecret(prompt, def, hint string) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", prompt, hint)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", prompt)
+		}
+		s, err := w.secret()
+		if err != nil {
+			return "", err
+		}
+		if s = cmp.Or(strings.TrimSpace(s), def); s != "" {
+			return s, nil
+		}
+	}
+}
+
+// confirm asks a yes-or-no question, with def for a blank answer.
+func (w *wizard) confirm(prompt string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, choices)
+		s, err := w.line()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(s) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// CableURL turns what a user might type for hackr.tv's address, such as
+// "hackr.tv" or "https://hackr.tv", into its ActionCable WebSocket URL,
+// "wss://hackr.tv/cable". WebSocket URLs are kept as they are.
+func CableURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "wss://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("setup: invalid address %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("setup: address %q must be ws://, wss://, http://, or https://", s)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("setup: address %q has no host", s)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/cable"
+	}
+	return u.String(), nil
+}
+
+// Setting is a string value to write for a key.
+type Setting struct {
+	Key, Value string
+}
+
+// SetTable writes settings into table in the TOML file at path. Keys the
+// table already has are replaced where they are, keeping any comment at
+// the end of the line, and the rest are added under the table's header,
+// which is added at the end of the file when missing. Everything else,
+// comments included, is left as it was. A new file is made readable
+// only by its owner, since it may hold tokens.
+func SetTable(path, table string, settings []Setting) error {
+	mode := fs.FileMode(0o600)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode().Perm()
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	header, end := -1, len(lines)
+	for i, line := range lines {
+		name, ok := tableHeader(line)
+		if !ok {
+			continue
+		}
+		if header >= 0 {
+			end = i
+			break
+		}
+		if name == table {
+			header = i
+		}
+	}
+	if header < 0 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+table+"]")
+		header, end = len(lines)-1, len(lines)
+	}
+
+	var added []string
+	for _, s := range settings {
+		line := s.Key + " = " + tomlString(s.Value)
+		replaced := false
+		for i := header + 1; i < end; i++ {
+			if comment, ok := keyLine(lines[i], s.Key); ok {
+				lines[i] = line + comment
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			added = append(added, line)
+		}
+	}
+	lines = append(lines[:header+1], append(added, lines[header+1:]...)...)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), mode)
+}
+
+// tableHeader returns the name of the table a [table] or [[table]] line
+// starts.
+func tableHeader(line string) (string, bool) {
+	line, _, _ = strings.Cut(line, "#")
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Trim(line, "[]")), true
+}
+
+// keyLine reports whether line sets key, returning the comment at its end
+// when the value is a plain string it can tell it apart from.
+func keyLine(line, key string) (comment string, ok bool) {
+	k, value, found := strings.Cut(line, "=")
+	if !found || strings.TrimSpace(k) != key {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, `"`) {
+		return "", true
+	}
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			if rest := value[i+1:]; strings.HasPrefix(strings.TrimSpace(rest), "#") {
+				return rest, true
+			}
+			return "", true
+		}
+	}
+	return "", true
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
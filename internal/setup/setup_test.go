@@ -0,0 +1,253 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"relay/internal/config"
+)
+
+func TestCableURL(t *testing.T) {
+	tests := map[string]string{
+		"hackr.tv":                   "wss://hackr.tv/cable",
+		"https://hackr.tv":           "wss://hackr.tv/cable",
+		"https://hackr.tv/":          "wss://hackr.tv/cable",
+		"http://localhost:3000":      "ws://localhost:3000/cable",
+		"wss://hackr.tv/cable":       "wss://hackr.tv/cable",
+		" ws://10.0.0.5:3000/cable ": "ws://10.0.0.5:3000/cable",
+	}
+	for in, want := range tests {
+		if got, err := CableURL(in); err != nil || got != want {
+			t.Errorf("CableURL(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"ftp://hackr.tv", "https://", "ws://%zz"} {
+		if got, err := CableURL(in); err == nil {
+			t.Errorf("CableURL(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestSetTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.toml")
+	orig := `# My relay
+[twitch]
+channel = "xqc"
+
+[hackrtv]   # the hackr.tv side
+url = "wss://old.example/cable"  # staging
+# token = "YOUR_HACKRTV_TOKEN"
+history = "none"
+
+[[hackrtv.subscriptions]]
+channel = "NotificationsChannel"
+`
+	if err := os.WriteFile(path, []byte(orig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := SetTable(path, "hackrtv", []Setting{{"url", "wss://hackr.tv/cable"}, {"token", `s3"cr\t`}, {"channel", "live"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := `# My relay
+[twitch]
+channel = "xqc"
+
+[hackrtv]   # the hackr.tv side
+token = "s3\"cr\\t"
+channel = "live"
+url = "wss://hackr.tv/cable"  # staging
+# token = "YOUR_HACKRTV_TOKEN"
+history = "none"
+
+[[hackrtv.subscriptions]]
+channel = "NotificationsChannel"
+`
+	if string(data) != want {
+		t.Errorf("file =\n%s\nwant\n%s", data, want)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HackrTV.Token != `s3"cr\t` || cfg.Twitch.Channel != "xqc" || len(cfg.HackrTV.Subscriptions) != 1 {
+		t.Errorf("config = %+v", cfg.HackrTV)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want the file's own", fi.Mode().Perm())
+	}
+
+	// A missing table goes at the end, and a new file is private
+	path = filepath.Join(t.TempDir(), "new.toml")
+	if err := SetTable(path, "hackrtv", []Setting{{"alias", "xeraen"}}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "[hackrtv]\nalias = \"xeraen\"\n" {
+		t.Errorf("new file = %q", data)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Errorf("new file mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+// fakeHackrTV serves the cable and the Uplink API. Only token "good" for
+// alias "xeraen" is accepted, only channel "live" exists, and the Uplink
+// API takes the token only when admin is set.
+type fakeHackrTV struct {
+	admin     bool
+	performed chan string
+	dropped   chan string
+}
+
+func (f *fakeHackrTV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cable":
+		if r.URL.Query().Get("token") != "good" || r.URL.Query().Get("hackr_alias") != "xeraen" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(map[string]string{"type": "welcome"})
+		var sub struct{ Identifier string }
+		conn.ReadJSON(&sub)
+		kind := "reject_subscription"
+		if strings.Contains(sub.Identifier, `"chat_channel":"live"`) {
+			kind = "confirm_subscription"
+		}
+		conn.WriteJSON(map[string]string{"type": kind, "identifier": sub.Identifier})
+		var cmd struct{ Data string }
+		if err := conn.ReadJSON(&cmd); err == nil {
+			f.performed <- cmd.Data
+		}
+	case "/api/admin/uplink/send_packet":
+		if !f.admin {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"packet":{"id":42}}`)
+	case "/api/admin/uplink/drop_packet":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		f.dropped <- body["packet_id"]
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func runHackrTV(t *testing.T, f *fakeHackrTV, path string, input ...string) string {
+	t.Helper()
+	t.Setenv("HACKRTV_API_TOKEN", "")
+	var out strings.Builder
+	err := HackrTV(context.Background(), Options{
+		In:      strings.NewReader(strings.Join(input, "\n") + "\n"),
+		Out:     &out,
+		Config:  path,
+		Timeout: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("HackrTV() = %v\n%s", err, out.String())
+	}
+	return out.String()
+}
+
+func TestHackrTV(t *testing.T) {
+	f := &fakeHackrTV{admin: true, performed: make(chan string, 1), dropped: make(chan string, 1)}
+	server := httptest.NewServer(f)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "relay.toml")
+
+	out := runHackrTV(t, f, path,
+		server.URL, // the address, as a web page
+		"xeraen",   // alias
+		"wrong",    // a refused token
+		"live",     // channel
+		"",         // the alias kept
+		"good",     // the token again
+		"y",        // the test message
+		"",         // save
+	)
+	for _, want := range []string{
+		"refused the token for xeraen",
+		"ok, joined #live",
+		"Posting through the Uplink API... ok",
+		"Deleting the test message... ok",
+		"Saved [hackrtv]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if id := <-f.dropped; id != "42" {
+		t.Errorf("dropped packet %q, want 42", id)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := cfg.HackrTV
+	if h.URL != "ws"+strings.TrimPrefix(server.URL, "http")+"/cable" || h.Alias != "xeraen" || h.Token != "good" || h.Channel != "live" || h.AuthMode != "admin" {
+		t.Errorf("saved %+v", h)
+	}
+}
+
+func TestHackrTVUserMode(t *testing.T) {
+	f := &fakeHackrTV{performed: make(chan string, 1), dropped: make(chan string, 1)}
+	server := httptest.NewServer(f)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "relay.toml")
+	os.WriteFile(path, []byte("[hackrtv]\nurl = \""+server.URL+"\"\nalias = \"xeraen\"\ntoken = \"good\"\n"), 0o600)
+
+	out := runHackrTV(t, f, path,
+		"",     // the saved address
+		"",     // the saved alias
+		"",     // the saved token
+		"typo", // a rejected channel
+		"live", // channel again
+		"",     // the test message
+		"",     // as a regular hackr
+		"",     // save
+	)
+	for _, want := range []string{
+		"wouldn't let xeraen join #typo",
+		"The Uplink API takes admin tokens only",
+		"Posting as xeraen... ok",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if data := <-f.performed; !strings.Contains(data, `"action":"send_packet"`) || !strings.Contains(data, testContent) {
+		t.Errorf("performed %s", data)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HackrTV.AuthMode != "user" || cfg.HackrTV.Channel != "live" {
+		t.Errorf("saved %+v", cfg.HackrTV)
+	}
+}
+
+func TestHackrTVAborted(t *testing.T) {
+	var out strings.Builder
+	err := HackrTV(context.Background(), Options{In: strings.NewReader("hackr.tv\n"), Out: &out, Config: filepath.Join(t.TempDir(), "relay.toml")})
+	if err != ErrAborted {
+		t.Errorf("HackrTV() = %v, want ErrAborted", err)
+	}
+}
@@ -0,0 +1,178 @@
+// Package signing signs the JSON the relay hands to other programs with an
+// Ed25519 key, so downstream automation can check that an event came from
+// this relay instance and wasn't injected along the way.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Header carries the signature of an HTTP response body.
+const Header = "X-Relay-Signature"
+
+// Signer signs with one Ed25519 private key.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// LoadOrCreate reads the PEM-encoded PKCS #8 private key at path, or
+// generates one and saves it there, readable only by the owner, when
+// the file doesn't exist yet. Keeping the key means consumers pin the
+// public key once.
+func LoadOrCreate(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return &Signer{key: key}, nil
+}
+
+// create generates a key and writes it to path.
+func create(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// O_EXCL so two relays starting at once can't each write a key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &Signer{key: key}, nil
+}
+
+// PublicKey returns the base64-encoded public key consumers verify with.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the base64-encoded signature of data.
+func (s *Signer) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+// Verify reports whether sig, as returned by Sign, is a valid signature
+// of data by the base64-encoded public key pub.
+func Verify(pub string, data []byte, sig string) bool {
+	key, err := base64.StdEncoding.DecodeString(pub)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(key), data, raw)
+}
+
+// Field is the JSON field carrying an event's signature. SignJSON adds
+// it last, so what was signed is the event with the field cut off:
+// {"content":"hi","signature":"..."} is signed over {"content":"hi"}.
+const Field = "signature"
+
+// SignJSON returns the JSON object data with its signature added as the
+// final Field. A nil Signer returns data unchanged.
+func (s *Signer) SignJSON(data []byte) []byte {
+	if s == nil || len(data) < 2 || data[len(data)-1] != '}' {
+		return data
+	}
+	sig := s.Sign(data)
+	out := make([]byte, 0, len(data)+len(Field)+len(sig)+6)
+	out = append(out, data[:len(data)-1]...)
+	out = append(out, `,"`+Field+`":"`...)
+	out = append(out, sig...)
+	return append(out, `"}`...)
+}
+
+// VerifyJSON reports whether the JSON object data, as written by
+// SignJSON, carries a valid signature by the base64-encoded public key
+// pub.
+func VerifyJSON(pub string, data []byte) bool {
+	data = bytes.TrimSpace(data)
+	i := bytes.LastIndex(data, []byte(`,"`+Field+`":"`))
+	start, end := i+len(Field)+5, len(data)-2
+	if i < 0 || start > end || !bytes.HasSuffix(data, []byte(`"}`)) {
+		return false
+	}
+	sig := data[start:end]
+	signed := append(data[:i:i], '}')
+	return Verify(pub, signed, string(sig))
+}
+
+// Handler signs every response body h writes, in the X-Relay-Signature
+// header. Responses are buffered until h returns so the signature can be
+// sent ahead of the body. A nil Signer returns h unchanged.
+func (s *Signer) Handler(h http.Handler) http.Handler {
+	if s == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{header: make(http.Header), status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set(Header, s.Sign(rec.body.Bytes()))
+		w.Header().Set("Content-Length", strconv.Itoa(rec.body.Len()))
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// recorder buffers a response so it can be signed.
+type recorder struct {
+	header http.Header
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status, r.wrote = status, true
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wrote = true
+	return r.body.Write(p)
+}
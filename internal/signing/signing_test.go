@@ -0,0 +1,106 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreateKeepsKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	first, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file: %v, %v; want mode 0600", info, err)
+	}
+	second, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.PublicKey() != second.PublicKey() {
+		t.Error("a restart should keep the same key")
+	}
+
+	os.WriteFile(path, []byte("not a key"), 0o600)
+	if _, err := LoadOrCreate(path); err == nil {
+		t.Error("LoadOrCreate() should reject a file without a PEM key")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	s, err := LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"platform":"TTV","content":"hi"}`)
+	sig := s.Sign(data)
+	if !Verify(s.PublicKey(), data, sig) {
+		t.Error("Verify() rejected a genuine signature")
+	}
+	if Verify(s.PublicKey(), []byte(`{"platform":"TTV","content":"injected"}`), sig) {
+		t.Error("Verify() accepted a signature over different data")
+	}
+	if Verify("bogus", data, sig) {
+		t.Error("Verify() accepted a malformed public key")
+	}
+}
+
+func TestSignJSON(t *testing.T) {
+	s, err := LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"platform":"twitch","content":"say \",\"signature\":\"x"}`)
+	signed := s.SignJSON(data)
+	if want := `{"platform":"twitch","content":"say \",\"signature\":\"x","signature":"` + s.Sign(data) + `"}`; string(signed) != want {
+		t.Errorf("SignJSON() = %s, want %s", signed, want)
+	}
+	if !VerifyJSON(s.PublicKey(), signed) {
+		t.Error("VerifyJSON() rejected a genuine event")
+	}
+	for _, bad := range []string{
+		strings.Replace(string(signed), "twitch", "youtube", 1),
+		string(data),
+		`{"a":1,"signature":"}`,
+	} {
+		if VerifyJSON(s.PublicKey(), []byte(bad)) {
+			t.Errorf("VerifyJSON(%s) = true, want false", bad)
+		}
+	}
+	var none *Signer
+	if got := none.SignJSON(data); string(got) != string(data) {
+		t.Errorf("nil SignJSON() = %s, want the data unchanged", got)
+	}
+}
+
+func TestHandlerSignsBody(t *testing.T) {
+	s, err := LoadOrCreate(filepath.Join(t.TempDir(), "signing.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bridge", nil))
+
+	if rec.Code != http.StatusTeapot || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("status %d, content type %q; want the handler's own", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !Verify(s.PublicKey(), rec.Body.Bytes(), rec.Header().Get(Header)) {
+		t.Errorf("%s doesn't verify the body %q", Header, rec.Body.String())
+	}
+
+	var none *Signer
+	if got := none.Handler(h); got == nil {
+		t.Error("a nil Signer should pass the handler through")
+	}
+}
@@ -0,0 +1,670 @@
+// Package tui is the relay's full-screen terminal view (--tui): a
+// scrollable chat history that holds still while scrolled back, keys that
+// toggle each platform, a command line for the console commands, and a
+// status bar with each source's connection state.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+const (
+	defaultHistory = 5000
+	// refresh is how often the screen is redrawn, bringing in new chat
+	// and the status bar's counts.
+	refresh = 100 * time.Millisecond
+	// reconnectShown is how long a source that reconnected shows as
+	// reconnecting, unless chat arrives first.
+	reconnectShown = time.Minute
+)
+
+// Options configures a TUI. The zero value keeps 5000 lines of history
+// and has no command line.
+type Options struct {
+	// History is how many messages and log lines are kept for scrollback
+	// (default 5000).
+	History int
+	// Filter is the display's mute/solo state, shared with /mute, /solo,
+	// and the dashboard. The platform keys toggle its mutes. Defaults to
+	// a filter of its own.
+	Filter *display.Filter
+	// Exec runs a console command typed after "/" and returns its output.
+	// Without it "/" does nothing.
+	Exec func(line string) string
+	// Quit is called when q or Ctrl+C is pressed.
+	Quit func()
+	// Clock dates reconnects for the status bar. Defaults to the wall
+	// clock.
+	Clock clock.Clock
+	// Highlights picks out chat mentioning its keywords, and Bell rings
+	// the terminal bell when such chat arrives and isn't muted.
+	Highlights *display.Highlights
+	Bell       bool
+	// PlainEmotes shows emotes as the rest of the message instead of in
+	// their own color.
+	PlainEmotes bool
+	// Timestamps sets the format and zone of chat times. A relative
+	// format shows how long ago each message was sent, kept current as
+	// the screen redraws.
+	Timestamps display.Timestamps
+}
+
+// TUI keeps the chat history and view state. Handle, Log, and Track are
+// safe to call while Run draws.
+type TUI struct {
+	opts  Options
+	clock clock.Clock
+
+	mu sync.Mutex
+	// entries is the history, oldest first; entries[i] is number
+	// first+i of everything added.
+	entries []entry
+	first   int
+	sources []*source
+	// paused holds the view at anchor, the number of the newest entry
+	// it shows, while chat keeps arriving below it.
+	paused bool
+	anchor int
+	// scroll is how many rows the view sits above its newest entry.
+	scroll int
+	// page is the height of the chat area at the last draw.
+	page int
+	// typing is set while a command is typed on the bottom line.
+	typing  bool
+	command []rune
+	// beep rings the bell at the next draw.
+	beep bool
+}
+
+// entry is a chat message or a line the relay logged.
+type entry struct {
+	msg message.Message
+	// log, when set, is shown instead of msg.
+	log string
+	// highlighted marks chat matching Options.Highlights.
+	highlighted bool
+}
+
+// source is one platform's status bar item.
+type source struct {
+	platform   message.Platform
+	messages   int64
+	last       time.Time
+	reconnects func() int64
+	// seen is the reconnect count at the last draw, and reconnected
+	// when it last went up.
+	seen        int64
+	reconnected time.Time
+}
+
+// New creates an empty TUI.
+func New(opts Options) *TUI {
+	if opts.History <= 0 {
+		opts.History = defaultHistory
+	}
+	if opts.Filter == nil {
+		opts.Filter = display.NewFilter()
+	}
+	return &TUI{opts: opts, clock: clock.Or(opts.Clock)}
+}
+
+// Track shows platform p in the status bar before its first message.
+// reconnects, when set, counts the source's reconnects.
+func (t *TUI) Track(p message.Platform, reconnects func() int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.source(p).reconnects = reconnects
+}
+
+// source returns p's status, adding it in platform order.
+func (t *TUI) source(p message.Platform) *source {
+	i, found := slices.BinarySearchFunc(t.sources, p, func(s *source, p message.Platform) int {
+		return int(s.platform) - int(p)
+	})
+	if !found {
+		t.sources = slices.Insert(t.sources, i, &source{platform: p})
+	}
+	return t.sources[i]
+}
+
+// Handle adds msg to the history.
+func (t *TUI) Handle(msg message.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	src := t.source(msg.Platform)
+	src.messages++
+	src.last = t.clock.Now()
+	e := entry{msg: msg, highlighted: t.opts.Highlights.Match(msg)}
+	if e.highlighted && t.opts.Bell && t.opts.Filter.Allows(msg) {
+		t.beep = true
+	}
+	t.add(e)
+}
+
+// ansi matches the color codes of status lines written for a terminal.
+var ansi = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// Log adds a line the relay wrote, such as a connection banner or an
+// error, to the history, without its terminal colors.
+func (t *TUI) Log(line string) {
+	line = strings.TrimRight(ansi.ReplaceAllString(line, ""), " \r\n")
+	if line == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(entry{log: line})
+}
+
+func (t *TUI) add(e entry) {
+	t.entries = append(t.entries, e)
+	if len(t.entries) > t.opts.History {
+		t.entries = t.entries[1:]
+		t.first++
+	}
+}
+
+// Run draws the TUI on s, an initialized screen, and handles keys until
+// ctx is cancelled, then finalizes s to restore the terminal.
+func (t *TUI) Run(ctx context.Context, s tcell.Screen) {
+	defer s.Fini()
+	events := make(chan tcell.Event, 16)
+	quit := make(chan struct{})
+	defer close(quit)
+	go s.ChannelEvents(events, quit)
+	tick := time.NewTicker(refresh)
+	defer tick.Stop()
+
+	for {
+		t.draw(s)
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				s.Sync()
+			case *tcell.EventKey:
+				t.key(ev)
+			}
+		case <-tick.C:
+		}
+	}
+}
+
+// key handles one key press.
+func (t *TUI) key(ev *tcell.EventKey) {
+	t.mu.Lock()
+	if t.typing {
+		line, run := t.typeKey(ev)
+		t.mu.Unlock()
+		if run {
+			t.exec(line)
+		}
+		return
+	}
+	defer t.mu.Unlock()
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC:
+		t.quit()
+	case tcell.KeyUp:
+		t.scrollBy(1)
+	case tcell.KeyDown:
+		t.scrollBy(-1)
+	case tcell.KeyPgUp:
+		t.scrollBy(max(t.page-1, 1))
+	case tcell.KeyPgDn:
+		t.scrollBy(-max(t.page-1, 1))
+	case tcell.KeyHome:
+		t.scrollBy(len(t.entries) * t.page)
+	case tcell.KeyEnd:
+		t.follow()
+	case tcell.KeyRune:
+		switch r := ev.Rune(); {
+		case r == 'q':
+			t.quit()
+		case r == 'k':
+			t.scrollBy(1)
+		case r == 'j':
+			t.scrollBy(-1)
+		case r == 'g':
+			t.scrollBy(len(t.entries) * t.page)
+		case r == 'G':
+			t.follow()
+		case r == ' ' && t.paused:
+			t.follow()
+		case r == ' ':
+			t.pause()
+		case r == '/' && t.opts.Exec != nil:
+			t.typing, t.command = true, nil
+		case r >= '1' && r <= '9':
+			t.toggle(int(r - '1'))
+		}
+	}
+}
+
+func (t *TUI) quit() {
+	if t.opts.Quit != nil {
+		go t.opts.Quit()
+	}
+}
+
+// typeKey edits the command line, returning it with run set when Enter
+// was pressed.
+func (t *TUI) typeKey(ev *tcell.EventKey) (line string, run bool) {
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		t.typing = false
+	case tcell.KeyEnter:
+		t.typing = false
+		return "/" + string(t.command), len(t.command) > 0
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(t.command) == 0 {
+			t.typing = false
+		} else {
+			t.command = t.command[:len(t.command)-1]
+		}
+	case tcell.KeyRune:
+		t.command = append(t.command, ev.Rune())
+	}
+	return "", false
+}
+
+// exec runs a typed command in the background, since some (such as
+// /clip) wait on the network, and logs it with its output.
+func (t *TUI) exec(line string) {
+	t.Log("> " + line)
+	go func() {
+		for out := range strings.SplitSeq(t.opts.Exec(line), "\n") {
+			t.Log(out)
+		}
+	}()
+}
+
+// scrollBy moves the view n rows back (or forward, when negative).
+// Scrolling back pauses the view, and scrolling forward to its newest row
+// follows the chat again.
+func (t *TUI) scrollBy(n int) {
+	if n > 0 && !t.paused {
+		t.pause()
+	}
+	t.scroll = max(t.scroll+n, 0)
+	if n < 0 && t.scroll == 0 {
+		t.follow()
+	}
+}
+
+func (t *TUI) pause() {
+	t.paused = true
+	t.anchor = t.first + len(t.entries) - 1
+}
+
+func (t *TUI) follow() {
+	t.paused = false
+	t.scroll = 0
+}
+
+// toggle mutes or unmutes the i'th platform.
+func (t *TUI) toggle(i int) {
+	platforms := message.Platforms()
+	if i >= len(platforms) {
+		return
+	}
+	target := display.Target{Platform: platforms[i]}
+	if t.opts.Filter.Muted(target) {
+		t.opts.Filter.Unmute(target)
+	} else {
+		t.opts.Filter.Mute(target)
+	}
+}
+
+// segment is text drawn in one style, and row one screen line of them.
+type (
+	segment struct {
+		text  string
+		style tcell.Style
+	}
+	row []segment
+)
+
+var (
+	plainStyle     = tcell.StyleDefault
+	dimStyle       = tcell.StyleDefault.Dim(true)
+	usernameStyle  = tcell.StyleDefault.Foreground(tcell.ColorTeal)
+	eventStyle     = tcell.StyleDefault.Foreground(tcell.ColorOlive).Bold(true)
+	amountStyle    = tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true)
+	emoteStyle     = tcell.StyleDefault.Foreground(tcell.ColorPurple)
+	highlightStyle = tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorOlive).Bold(true)
+	pausedStyle    = tcell.StyleDefault.Foreground(tcell.ColorOlive).Bold(true)
+	liveStyle      = tcell.StyleDefault.Foreground(tcell.ColorGreen).Bold(true)
+	mutedStyle     = tcell.StyleDefault.Dim(true).StrikeThrough(true)
+)
+
+// eventStyles sets each kind of event apart, as the printer's colors do.
+// Notices (display.IsNotice) are dimmed; other types use eventStyle.
+var eventStyles = map[message.Type]tcell.Style{
+	message.TypeSub:        tcell.StyleDefault.Foreground(tcell.ColorFuchsia).Bold(true),
+	message.TypeRaid:       tcell.StyleDefault.Foreground(tcell.ColorAqua).Bold(true),
+	message.TypeFollow:     tcell.StyleDefault.Foreground(tcell.ColorLime).Bold(true),
+	message.TypeRedemption: tcell.StyleDefault.Foreground(tcell.ColorBlue).Bold(true),
+	message.TypeHype:       tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true),
+	message.TypeDeletion:   tcell.StyleDefault.Foreground(tcell.ColorMaroon),
+}
+
+// colorHints maps platform color hints to the terminal's standard colors,
+// as the printer uses them.
+var colorHints = map[string]tcell.Color{
+	"black":   tcell.ColorBlack,
+	"red":     tcell.ColorMaroon,
+	"green":   tcell.ColorGreen,
+	"yellow":  tcell.ColorOlive,
+	"blue":    tcell.ColorNavy,
+	"magenta": tcell.ColorPurple,
+	"cyan":    tcell.ColorTeal,
+	"white":   tcell.ColorSilver,
+}
+
+// roleStyles styles the badges of known roles; others are dim.
+var roleStyles = map[string]tcell.Style{
+	"admin":     tcell.StyleDefault.Foreground(tcell.ColorMaroon).Bold(true),
+	"moderator": tcell.StyleDefault.Foreground(tcell.ColorGreen).Bold(true),
+	"operative": tcell.StyleDefault.Foreground(tcell.ColorNavy),
+}
+
+func platformStyle(p message.Platform) tcell.Style {
+	return tcell.StyleDefault.Foreground(colorHints[p.Color()]).Bold(true)
+}
+
+// draw renders the chat area, the status bar, and the key help or the
+// command being typed.
+func (t *TUI) draw(s tcell.Screen) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.Clear()
+	width, height := s.Size()
+	t.page = height - 2
+	if t.page < 1 || width < 1 {
+		s.Show()
+		return
+	}
+	if t.beep {
+		s.Beep()
+		t.beep = false
+	}
+	rows := t.rows(width, t.page)
+	for i, r := range rows {
+		drawRow(s, t.page-len(rows)+i, width, r)
+	}
+	drawRow(s, height-2, width, t.statusRow(width))
+	if t.typing {
+		line := "/" + string(t.command)
+		drawRow(s, height-1, width, row{{line, plainStyle}})
+		s.ShowCursor(min(runewidth.StringWidth(line), width-1), height-1)
+	} else {
+		drawRow(s, height-1, width, t.helpRow())
+		s.HideCursor()
+	}
+	s.Show()
+}
+
+// rows lays out the entries the view shows, at most height rows ending
+// scroll rows above its newest entry.
+func (t *TUI) rows(width, height int) []row {
+	newest := len(t.entries) - 1
+	if t.paused {
+		newest = min(t.anchor-t.first, newest)
+	}
+	var blocks [][]row
+	total := 0
+	now := t.clock.Now()
+	for i := newest; i >= 0 && total < height+t.scroll; i-- {
+		e := t.entries[i]
+		if e.log == "" && !t.opts.Filter.Allows(e.msg) {
+			continue
+		}
+		block := layout(e, width, t.stamp(e.msg, now), !t.opts.PlainEmotes)
+		blocks = append(blocks, block)
+		total += len(block)
+	}
+	// Stop at the oldest row
+	t.scroll = min(t.scroll, max(total-height, 0))
+	rows := make([]row, 0, total)
+	for _, block := range slices.Backward(blocks) {
+		rows = append(rows, block...)
+	}
+	end := len(rows) - t.scroll
+	return rows[max(end-height, 0):end]
+}
+
+// stamp renders when msg was sent as of now, per Options.Timestamps.
+func (t *TUI) stamp(msg message.Message, now time.Time) string {
+	if t.opts.Timestamps.Relative() {
+		return display.Ago(msg.Timestamp, now)
+	}
+	return t.opts.Timestamps.Format(msg.Timestamp)
+}
+
+// layout renders one entry as rows: "14:30:45 [TTV] viewer: hello",
+// with stamp as the time, wrapped with a hanging indent under the start
+// of the content. With emotes, emotes in chat are set apart in their own
+// color.
+func layout(e entry, width int, stamp string, emotes bool) []row {
+	if e.log != "" {
+		var rows []row
+		for _, line := range display.Wrap(e.log, width) {
+			rows = append(rows, row{{line, dimStyle}})
+		}
+		return rows
+	}
+
+	msg := e.msg
+	head := row{
+		{stamp + " ", dimStyle},
+		{"[" + msg.Platform.DisplayLabel() + "]", platformStyle(msg.Platform)},
+		{" ", plainStyle},
+	}
+	text, style := msg.Content, plainStyle
+	switch {
+	case msg.IsEvent():
+		text, style = eventMarker(msg.Type)+" "+msg.Content, eventStyle
+		if s, ok := eventStyles[msg.Type]; ok {
+			style = s
+		} else if display.IsNotice(msg.Type) {
+			style = dimStyle
+		}
+	default:
+		if role := strings.ToLower(msg.Role); role != "" {
+			badge, ok := roleStyles[role]
+			if !ok {
+				badge = dimStyle
+			}
+			head = append(head, segment{"[" + roleTag(role) + "] ", badge})
+		}
+		head = append(head, segment{msg.Username, usernameStyle})
+		if msg.Channel != "" {
+			head = append(head, segment{" #" + msg.Channel, dimStyle})
+		}
+		if !msg.Amount.IsZero() {
+			head = append(head, segment{" ◆ " + i18n.Amount(msg.Amount), amountStyle})
+			style = amountStyle
+		}
+		if e.highlighted {
+			style = highlightStyle
+			emotes = false
+		}
+		head = append(head, segment{": ", plainStyle})
+	}
+	if !emotes || msg.IsEvent() {
+		msg.Emotes = nil
+	}
+
+	// Content goes beside the header when there's room, and under it
+	// otherwise
+	indent := rowWidth(head)
+	var rows []row
+	if indent > width/2 {
+		indent = 4
+		rows = append(rows, head)
+		head = nil
+	}
+	pad := strings.Repeat(" ", indent)
+	for i, line := range display.Wrap(text, width-indent) {
+		r := row{{pad, plainStyle}}
+		if i == 0 && head != nil {
+			r = head
+		}
+		for _, span := range display.Spans(line, msg.Emotes) {
+			if span.Emote != nil {
+				r = append(r, segment{span.Text, emoteStyle})
+			} else {
+				r = append(r, segment{span.Text, style})
+			}
+		}
+		rows = append(rows, r)
+	}
+	for _, pv := range msg.Previews {
+		rows = append(rows, row{{pad + "↳ " + pv.Title, dimStyle}})
+	}
+	return rows
+}
+
+// roleTag is a role's badge text: ADM, MOD, OPR, or its first three
+// letters.
+func roleTag(role string) string {
+	switch role {
+	case "admin":
+		return "ADM"
+	case "moderator":
+		return "MOD"
+	case "operative":
+		return "OPR"
+	}
+	tag := []rune(strings.ToUpper(role))
+	return string(tag[:min(len(tag), 3)])
+}
+
+// eventMarker is the glyph before an event, as in the printer.
+func eventMarker(t message.Type) string {
+	switch t {
+	case message.TypeDeletion:
+		return "✖"
+	case message.TypeEdit:
+		return "✎"
+	case message.TypeSystem:
+		return "»"
+	case message.TypeHype:
+		return "▲"
+	}
+	return "★"
+}
+
+// statusRow shows each source's state and message count, then whether
+// the view follows the chat:
+//
+//	TTV ● 1234  YT_ ↻ 56 (2 reconnects)  HTV ○ 0       PAUSED +12
+func (t *TUI) statusRow(width int) row {
+	now := t.clock.Now()
+	var r row
+	for _, src := range t.sources {
+		reconnects := int64(0)
+		if src.reconnects != nil {
+			reconnects = src.reconnects()
+		}
+		if reconnects > src.seen {
+			src.seen, src.reconnected = reconnects, now
+		}
+		state, style := "●", liveStyle
+		switch {
+		case !src.reconnected.IsZero() && src.last.Before(src.reconnected) && now.Sub(src.reconnected) < reconnectShown:
+			state, style = "↻", pausedStyle
+		case src.messages == 0:
+			state, style = "○", dimStyle
+		}
+		r = append(r,
+			segment{src.platform.DisplayLabel(), platformStyle(src.platform)},
+			segment{" " + state, style},
+			segment{fmt.Sprintf(" %d", src.messages), plainStyle},
+		)
+		if reconnects > 0 {
+			r = append(r, segment{fmt.Sprintf(" (%d reconnects)", reconnects), dimStyle})
+		}
+		r = append(r, segment{"  ", plainStyle})
+	}
+
+	mode := segment{"LIVE", liveStyle}
+	if t.paused {
+		mode = segment{"PAUSED", pausedStyle}
+		if unseen := t.first + len(t.entries) - 1 - t.anchor; unseen > 0 {
+			mode.text += fmt.Sprintf(" +%d", unseen)
+		}
+	}
+	if pad := width - rowWidth(r) - runewidth.StringWidth(mode.text); pad > 0 {
+		r = append(r, segment{strings.Repeat(" ", pad), plainStyle})
+	}
+	return append(r, mode)
+}
+
+// helpRow shows the platform keys, with muted platforms struck through,
+// and the other keys.
+func (t *TUI) helpRow() row {
+	var r row
+	for i, p := range message.Platforms() {
+		if i == 9 {
+			break
+		}
+		style := platformStyle(p)
+		if t.opts.Filter.Muted(display.Target{Platform: p}) {
+			style = mutedStyle
+		}
+		r = append(r, segment{fmt.Sprintf("%d ", i+1), dimStyle}, segment{p.DisplayLabel(), style}, segment{"  ", plainStyle})
+	}
+	help := "↑↓ scroll · space pause · q quit"
+	if t.opts.Exec != nil {
+		help = "↑↓ scroll · space pause · / command · q quit"
+	}
+	return append(r, segment{help, dimStyle})
+}
+
+func rowWidth(r row) int {
+	n := 0
+	for _, seg := range r {
+		n += runewidth.StringWidth(seg.text)
+	}
+	return n
+}
+
+// drawRow draws r on line y, cut at width.
+func drawRow(s tcell.Screen, y, width int, r row) {
+	x := 0
+	for _, seg := range r {
+		for _, c := range seg.text {
+			w := runewidth.RuneWidth(c)
+			if w == 0 {
+				continue
+			}
+			if x+w > width {
+				return
+			}
+			s.SetContent(x, y, c, nil, seg.style)
+			x += w
+		}
+	}
+}
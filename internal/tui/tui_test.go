@@ -0,0 +1,303 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"relay/internal/clock"
+	"relay/internal/display"
+	"relay/internal/message"
+)
+
+// screen is a simulated terminal a TUI draws on.
+type screen struct {
+	tcell.SimulationScreen
+	tu *TUI
+}
+
+// start runs tu on a width×height simulated screen until the test ends.
+func start(t *testing.T, tu *TUI, width, height int) *screen {
+	t.Helper()
+	s := &screen{tcell.NewSimulationScreen("UTF-8"), tu}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSize(width, height)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tu.Run(ctx, s)
+	}()
+	t.Cleanup(func() { cancel(); <-done })
+	return s
+}
+
+// text returns the screen's lines, trailing spaces trimmed. The
+// simulation's cells are only safe to read between draws.
+func (s *screen) text() string {
+	s.tu.mu.Lock()
+	defer s.tu.mu.Unlock()
+	cells, width, _ := s.GetContents()
+	var b strings.Builder
+	for i, c := range cells {
+		if len(c.Runes) > 0 {
+			b.WriteRune(c.Runes[0])
+		}
+		if (i+1)%width == 0 {
+			b.WriteString("\n")
+		}
+	}
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// waitFor waits for the screen to satisfy ok.
+func waitFor(t *testing.T, s *screen, ok func(screen string) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		text := s.text()
+		if ok(text) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("screen never matched:\n%s", text)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// styleOf returns the style the screen draws the start of want in.
+func styleOf(t *testing.T, s *screen, want string) tcell.Style {
+	t.Helper()
+	text := s.text()
+	s.tu.mu.Lock()
+	defer s.tu.mu.Unlock()
+	for y, line := range strings.Split(text, "\n") {
+		if x := strings.Index(line, want); x >= 0 {
+			_, _, style, _ := s.GetContent(len([]rune(line[:x])), y)
+			return style
+		}
+	}
+	t.Fatalf("%q not on screen:\n%s", want, text)
+	return tcell.StyleDefault
+}
+
+func contains(want string) func(string) bool {
+	return func(screen string) bool { return strings.Contains(screen, want) }
+}
+
+// ts is built in local time, as chat is shown, so tests don't depend on
+// the machine's zone.
+var ts = time.Date(2025, 1, 15, 14, 30, 45, 0, time.Local)
+
+func chat(n int) message.Message {
+	return message.Message{Platform: message.Twitch, Username: "viewer", Content: fmt.Sprintf("message %d", n), Timestamp: ts}
+}
+
+func TestRendersChatAndStatus(t *testing.T) {
+	tu := New(Options{})
+	tu.Track(message.HackrTV, func() int64 { return 2 })
+	s := start(t, tu, 60, 8)
+
+	tu.Handle(message.Message{Platform: message.Twitch, Username: "viewer", Channel: "xqc", Content: "hello chat"})
+	tu.Handle(message.Message{Platform: message.YouTube, Type: message.TypeSub, Username: "fan", Content: "fan became a member"})
+	tu.Log("\x1b[32m[RLY]\x1b[0m ● Serving HTTP API on 127.0.0.1:8787")
+	waitFor(t, s, contains("[TTV] viewer #xqc: hello chat"))
+	waitFor(t, s, contains("[YT_] ★ fan became a member"))
+	waitFor(t, s, contains("[RLY] ● Serving HTTP API"))
+	waitFor(t, s, contains("TTV ● 1  YT_ ● 1  HTV ↻ 0 (2 reconnects)"))
+	waitFor(t, s, contains("LIVE"))
+}
+
+func TestWrapsUnderContent(t *testing.T) {
+	tu := New(Options{})
+	s := start(t, tu, 60, 8)
+	tu.Handle(message.Message{Platform: message.Twitch, Username: "viewer", Content: "this message is far too long for one line of the screen", Timestamp: ts})
+	// The content keeps to its column
+	waitFor(t, s, contains("14:30:45 [TTV] viewer: this message is far too long for one\n"+strings.Repeat(" ", 23)+"line of the screen"))
+
+	// A header wider than half the screen puts the content under it
+	s.SetSize(40, 8)
+	waitFor(t, s, contains("14:30:45 [TTV] viewer:\n    this message is far too long for one\n    line of the screen"))
+}
+
+func TestScrollingBackPauses(t *testing.T) {
+	tu := New(Options{})
+	for i := 1; i <= 20; i++ {
+		tu.Handle(chat(i))
+	}
+	s := start(t, tu, 60, 6)
+	waitFor(t, s, contains("message 20"))
+
+	s.InjectKey(tcell.KeyUp, 0, tcell.ModNone)
+	waitFor(t, s, func(screen string) bool {
+		return strings.Contains(screen, "message 19") && !strings.Contains(screen, "message 20") && strings.Contains(screen, "PAUSED")
+	})
+
+	// New chat waits below the paused view
+	tu.Handle(chat(21))
+	waitFor(t, s, contains("PAUSED +1"))
+	if strings.Contains(s.text(), "message 21") {
+		t.Error("new message shown while paused")
+	}
+
+	// Scrolling back down to the bottom follows the chat again
+	s.InjectKey(tcell.KeyDown, 0, tcell.ModNone)
+	waitFor(t, s, func(screen string) bool {
+		return strings.Contains(screen, "message 21") && strings.Contains(screen, "LIVE")
+	})
+
+	s.InjectKey(tcell.KeyHome, 0, tcell.ModNone)
+	waitFor(t, s, contains("message 1\n"))
+	s.InjectKey(tcell.KeyEnd, 0, tcell.ModNone)
+	waitFor(t, s, contains("message 21"))
+}
+
+func TestPlatformKeysToggleMutes(t *testing.T) {
+	filter := display.NewFilter()
+	tu := New(Options{Filter: filter})
+	tu.Handle(chat(1))
+	s := start(t, tu, 60, 6)
+	waitFor(t, s, contains("message 1"))
+
+	key := rune('1' + int(message.Twitch))
+	s.InjectKey(tcell.KeyRune, key, tcell.ModNone)
+	waitFor(t, s, func(screen string) bool { return !strings.Contains(screen, "message 1") })
+	if !filter.Muted(display.Target{Platform: message.Twitch}) {
+		t.Error("Twitch isn't muted in the shared filter")
+	}
+	s.InjectKey(tcell.KeyRune, key, tcell.ModNone)
+	waitFor(t, s, contains("message 1"))
+}
+
+func TestCommandLine(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	tu := New(Options{Exec: func(line string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, line)
+		return "[display] muted: TTV"
+	}})
+	s := start(t, tu, 80, 6)
+	waitFor(t, s, contains("/ command"))
+
+	s.InjectKey(tcell.KeyRune, '/', tcell.ModNone)
+	for _, r := range "mute ttv" {
+		s.InjectKey(tcell.KeyRune, r, tcell.ModNone)
+	}
+	waitFor(t, s, contains("/mute ttv"))
+	s.InjectKey(tcell.KeyEnter, 0, tcell.ModNone)
+	waitFor(t, s, contains("> /mute ttv\n[display] muted: TTV"))
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 1 || ran[0] != "/mute ttv" {
+		t.Errorf("Exec calls = %q, want [/mute ttv]", ran)
+	}
+}
+
+func TestQuitKey(t *testing.T) {
+	quit := make(chan struct{}, 1)
+	tu := New(Options{Quit: func() { quit <- struct{}{} }})
+	s := start(t, tu, 60, 6)
+	s.InjectKey(tcell.KeyRune, 'q', tcell.ModNone)
+	select {
+	case <-quit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("q didn't quit")
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tu := New(Options{History: 3})
+	for i := 1; i <= 5; i++ {
+		tu.Handle(chat(i))
+	}
+	if len(tu.entries) != 3 || tu.entries[0].msg.Content != "message 3" || tu.first != 2 {
+		t.Errorf("entries = %d from %d, want the last 3", len(tu.entries), tu.first)
+	}
+}
+
+func TestHighlightsMentions(t *testing.T) {
+	tu := New(Options{Highlights: display.NewHighlights([]string{"@mychannel"})})
+	s := start(t, tu, 60, 6)
+
+	tu.Handle(message.Message{Platform: message.Twitch, Username: "viewer", Content: "hi @mychannel", Timestamp: ts})
+	tu.Handle(chat(1))
+	waitFor(t, s, contains("message 1"))
+
+	if got := styleOf(t, s, "hi @mychannel"); got != highlightStyle {
+		t.Errorf("mention drawn in %v, want the highlight style", got)
+	}
+	if got := styleOf(t, s, "message 1"); got != plainStyle {
+		t.Errorf("other chat drawn in %v, want the plain style", got)
+	}
+}
+
+func TestEmotesStandOut(t *testing.T) {
+	for _, plain := range []bool{false, true} {
+		tu := New(Options{PlainEmotes: plain})
+		s := start(t, tu, 60, 6)
+		tu.Handle(message.Message{Platform: message.Twitch, Username: "viewer", Content: "gg Kappa", Timestamp: ts,
+			Emotes: []message.Emote{{Name: "Kappa", Start: 3, End: 8}}})
+		waitFor(t, s, contains("viewer: gg Kappa"))
+
+		// The emote ends the line it is on
+		lines := strings.Split(s.text(), "\n")
+		y := slices.IndexFunc(lines, func(l string) bool { return strings.HasSuffix(l, "Kappa") })
+		s.tu.mu.Lock()
+		_, _, style, _ := s.GetContent(len([]rune(lines[y]))-1, y)
+		s.tu.mu.Unlock()
+		want := emoteStyle
+		if plain {
+			want = plainStyle
+		}
+		if style != want {
+			t.Errorf("PlainEmotes %v: emote drawn in %v, want %v", plain, style, want)
+		}
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	msg := message.Message{Platform: message.Twitch, Username: "viewer", Content: "hello", Timestamp: time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)}
+
+	zoned := New(Options{Timestamps: display.Timestamps{Layout: "15:04", Location: time.FixedZone("CET", 3600)}})
+	zoned.Handle(msg)
+	waitFor(t, start(t, zoned, 60, 6), contains("15:30 [TTV] viewer: hello"))
+
+	// Relative times keep up with the clock
+	clk := clock.NewFake(msg.Timestamp.Add(90 * time.Second))
+	relative := New(Options{Timestamps: display.Timestamps{Layout: display.TimestampsRelative}, Clock: clk})
+	relative.Handle(msg)
+	s := start(t, relative, 60, 6)
+	waitFor(t, s, contains(" 1m ago [TTV] viewer: hello"))
+	clk.Advance(2 * time.Hour)
+	waitFor(t, s, contains(" 2h ago [TTV] viewer: hello"))
+}
+
+func TestEventStyles(t *testing.T) {
+	tu := New(Options{})
+	s := start(t, tu, 60, 6)
+	tu.Handle(message.Message{Platform: message.Twitch, Type: message.TypeRaid, Username: "raider", Content: "15 raiders", Timestamp: ts})
+	tu.Handle(message.Message{Platform: message.HackrTV, Type: message.TypeSystem, Username: "xeraen", Content: "xeraen connected", Timestamp: ts})
+	waitFor(t, s, contains("» xeraen connected"))
+
+	if got := styleOf(t, s, "★ 15 raiders"); got != eventStyles[message.TypeRaid] {
+		t.Errorf("raid drawn in %v, want the raid style", got)
+	}
+	if got := styleOf(t, s, "» xeraen connected"); got != dimStyle {
+		t.Errorf("notice drawn in %v, want it dimmed", got)
+	}
+}
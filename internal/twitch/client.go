@@ -2,54 +2,251 @@ package twitch
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"relay/internal/clock"
+	"relay/internal/i18n"
 	"relay/internal/message"
+	"relay/internal/netio"
 )
 
 const (
-	ircServer = "irc.chat.twitch.tv:6667"
+	ircServerTLS       = "irc.chat.twitch.tv:6697"
+	ircServerPlaintext = "irc.chat.twitch.tv:6667"
 )
 
+// DefaultCapabilities are requested when Options.Capabilities is nil.
+// Tags carry message IDs, bits and badges; commands enable USERNOTICE,
+// CLEARCHAT and CLEARMSG.
+var DefaultCapabilities = []string{"twitch.tv/tags", "twitch.tv/commands"}
+
+var (
+	// ErrReadOnly is returned by Send when the client is connected
+	// anonymously and cannot post messages.
+	ErrReadOnly = errors.New("twitch: anonymous connection is read-only")
+	// ErrNotConnected is returned by Send when there is no live connection.
+	ErrNotConnected = errors.New("twitch: not connected")
+	// ErrAuth is returned by Connect when Twitch refuses the nick and
+	// OAuth token.
+	ErrAuth = errors.New("twitch: authentication failed")
+)
+
+// maxSendLength is the longest chat message Twitch accepts, in
+// characters.
+const maxSendLength = 500
+
+// Options configures how the client connects to Twitch IRC.
+type Options struct {
+	// Server overrides the IRC address ("host:port"), e.g. for a local
+	// mock server or another IRC-compatible backend. Defaults to Twitch.
+	Server string
+	// Plaintext disables TLS and connects to the legacy port 6667.
+	Plaintext bool
+	// Nick and Token authenticate the connection so it can send
+	// messages. Token is an OAuth token, with or without the "oauth:"
+	// prefix. When either is empty the client connects anonymously.
+	Nick  string
+	Token string
+	// Capabilities lists the IRCv3 capabilities to request. Nil requests
+	// DefaultCapabilities; an empty, non-nil slice skips CAP REQ entirely
+	// for servers that do not support it.
+	Capabilities []string
+	// Clock stamps received messages. Defaults to the wall clock.
+	Clock clock.Clock
+	// WriteTimeout bounds each write to the server, so Send and
+	// keepalive replies give up on a connection that has stopped
+	// draining. Defaults to 10s.
+	WriteTimeout time.Duration
+	// KeepRaw sets each message's Raw to the IRC line it came from.
+	KeepRaw bool
+}
+
 type Client struct {
-	channel string
+	channels []string
+	opts     Options
+
+	// writeMu serialises writes to conn, which is set while Connect is running.
+	writeMu sync.Mutex
 	conn    net.Conn
+
+	// rooms maps joined channels to their Twitch user IDs, from ROOMSTATE.
+	roomsMu sync.Mutex
+	rooms   map[string]string
+}
+
+// NewClient creates a Twitch IRC client that joins every given channel
+// on a single connection. Channel names are lowercased.
+func NewClient(channels []string, opts Options) *Client {
+	opts.Clock = clock.Or(opts.Clock)
+	c := &Client{opts: opts, rooms: make(map[string]string)}
+	for _, ch := range channels {
+		c.channels = append(c.channels, strings.ToLower(strings.TrimPrefix(ch, "#")))
+	}
+	return c
+}
+
+// server returns the IRC address to dial.
+func (c *Client) server() string {
+	switch {
+	case c.opts.Server != "":
+		return c.opts.Server
+	case c.opts.Plaintext:
+		return ircServerPlaintext
+	default:
+		return ircServerTLS
+	}
+}
+
+// capabilities returns the IRCv3 capabilities to request.
+func (c *Client) capabilities() []string {
+	if c.opts.Capabilities == nil {
+		return DefaultCapabilities
+	}
+	return c.opts.Capabilities
+}
+
+// dial opens the IRC connection, over TLS unless Plaintext is set.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	if c.opts.Plaintext {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", c.server())
+	}
+	d := tls.Dialer{Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+	return d.DialContext(ctx, "tcp", c.server())
+}
+
+// authenticated reports whether the client has credentials to send messages.
+func (c *Client) authenticated() bool {
+	return c.opts.Nick != "" && c.opts.Token != ""
 }
 
-func NewClient(channel string) *Client {
-	return &Client{
-		channel: strings.ToLower(channel),
+// register writes the IRC registration and JOIN commands. Anonymous
+// clients use a random justinfan nick; authenticated ones send PASS first.
+// Capabilities are requested first so tags apply to the JOIN replies.
+func (c *Client) register(w io.Writer) {
+	if caps := c.capabilities(); len(caps) > 0 {
+		fmt.Fprintf(w, "CAP REQ :%s\r\n", strings.Join(caps, " "))
 	}
+	if c.authenticated() {
+		token := c.opts.Token
+		if !strings.HasPrefix(token, "oauth:") {
+			token = "oauth:" + token
+		}
+		fmt.Fprintf(w, "PASS %s\r\n", token)
+		fmt.Fprintf(w, "NICK %s\r\n", strings.ToLower(c.opts.Nick))
+	} else {
+		fmt.Fprintf(w, "NICK justinfan%d\r\n", rand.Intn(99999)+1)
+	}
+
+	joinChannels := make([]string, len(c.channels))
+	for i, ch := range c.channels {
+		joinChannels[i] = "#" + ch
+	}
+	fmt.Fprintf(w, "JOIN %s\r\n", strings.Join(joinChannels, ","))
+}
+
+// write sends IRC lines on conn within Options.WriteTimeout, giving up
+// when ctx is done. A failed write may leave a line half sent, so the
+// connection is closed and Connect returns for it to be redialed.
+func (c *Client) write(ctx context.Context, conn net.Conn, lines string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := netio.Write(ctx, conn, c.opts.WriteTimeout, func(time.Time) error {
+		_, err := io.WriteString(conn, lines)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+	}
+	return err
+}
+
+func (c *Client) setConn(conn net.Conn) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn = conn
+}
+
+// Send posts a PRIVMSG to the given channel. It requires an authenticated
+// connection and returns ErrReadOnly or ErrNotConnected otherwise. It
+// gives up when ctx is done or the write outlasts Options.WriteTimeout.
+func (c *Client) Send(ctx context.Context, channel, text string) error {
+	if !c.authenticated() {
+		return ErrReadOnly
+	}
+
+	// IRC lines cannot contain line breaks
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	if r := []rune(text); len(r) > maxSendLength {
+		text = string(r[:maxSendLength])
+	}
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	return c.write(ctx, c.conn, fmt.Sprintf("PRIVMSG #%s :%s\r\n", channel, text))
+}
+
+// RoomID returns the Twitch user ID of a joined channel, as Twitch
+// reported it on joining, or "" before then. Emote providers such as
+// BetterTTV key channel emotes by it.
+func (c *Client) RoomID(channel string) string {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	return c.rooms[strings.ToLower(strings.TrimPrefix(channel, "#"))]
+}
+
+// roomState records the channel ID a ROOMSTATE line carries.
+func (c *Client) roomState(line string) {
+	l, ok := parseLine(line)
+	if !ok || l.tags["room-id"] == "" {
+		return
+	}
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	c.rooms[l.channel()] = l.tags["room-id"]
 }
 
 func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) error {
-	var err error
-	c.conn, err = net.Dial("tcp", ircServer)
+	conn, err := c.dial(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to connect to Twitch IRC: %w", err)
 	}
-	defer c.conn.Close()
-
-	// Generate anonymous username
-	username := fmt.Sprintf("justinfan%d", rand.Intn(99999)+1)
+	defer conn.Close()
 
 	// Send IRC registration
-	fmt.Fprintf(c.conn, "NICK %s\r\n", username)
-	fmt.Fprintf(c.conn, "JOIN #%s\r\n", c.channel)
+	var registration strings.Builder
+	c.register(&registration)
+	if err := c.write(ctx, conn, registration.String()); err != nil {
+		return fmt.Errorf("failed to register with Twitch IRC: %w", err)
+	}
 
-	reader := bufio.NewReader(c.conn)
+	c.setConn(conn)
+	defer c.setConn(nil)
+
+	reader := bufio.NewReader(conn)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			c.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+			conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 			line, err := reader.ReadString('\n')
 			if err != nil {
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -62,59 +259,197 @@ func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) e
 
 			// Respond to PING to stay connected
 			if strings.HasPrefix(line, "PING") {
-				fmt.Fprintf(c.conn, "PONG%s\r\n", strings.TrimPrefix(line, "PING"))
+				c.writeMu.Lock()
+				c.write(ctx, conn, "PONG"+strings.TrimPrefix(line, "PING")+"\r\n")
+				c.writeMu.Unlock()
 				continue
 			}
 
-			// Parse PRIVMSG
-			msg, ok := parsePrivMsg(line)
-			if ok {
-				messages <- msg
+			// Twitch rejects bad credentials with a NOTICE before closing
+			if strings.Contains(line, "NOTICE * :Login authentication failed") ||
+				strings.Contains(line, "NOTICE * :Improperly formatted auth") {
+				return fmt.Errorf("%w for nick %q", ErrAuth, c.opts.Nick)
+			}
+
+			// Twitch sends a channel's ROOMSTATE, with its user ID, on join
+			if strings.Contains(line, " ROOMSTATE #") {
+				c.roomState(line)
+				continue
+			}
+
+			// Parse PRIVMSG, then USERNOTICE and moderation events
+			now := c.opts.Clock.Now()
+			msg, ok := parsePrivMsg(line, now)
+			if !ok {
+				msg, ok = parseUserNotice(line, now)
+			}
+			if !ok {
+				msg, ok = parseClear(line, now)
+			}
+			if !ok {
+				continue
+			}
+			if c.opts.KeepRaw {
+				msg.Raw = line
+			}
+			// A stalled reader mustn't keep Connect from returning
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 	}
 }
 
 // parsePrivMsg parses IRC PRIVMSG format:
-// :username!username@username.tmi.twitch.tv PRIVMSG #channel :message content
-func parsePrivMsg(line string) (message.Message, bool) {
-	if !strings.Contains(line, "PRIVMSG") {
+// [@tags] :username!username@username.tmi.twitch.tv PRIVMSG #channel :message content
+// A reply's reply-parent tags name the message it answers.
+func parsePrivMsg(line string, now time.Time) (message.Message, bool) {
+	l, ok := parseLine(line)
+	if !ok || l.command != "PRIVMSG" {
 		return message.Message{}, false
 	}
 
-	// Extract username from prefix
-	if !strings.HasPrefix(line, ":") {
+	username := l.nick()
+	if username == "" {
 		return message.Message{}, false
 	}
 
-	parts := strings.SplitN(line[1:], "!", 2)
-	if len(parts) < 2 {
-		return message.Message{}, false
+	return message.Message{
+		Platform:    message.Twitch,
+		ID:          cmp.Or(l.tags["id"], message.NewID()),
+		ReplyToID:   l.tags["reply-parent-msg-id"],
+		ReplyToUser: l.tags["reply-parent-user-login"],
+		Channel:     l.channel(),
+		Username:    username,
+		UserID:      l.tags["user-id"],
+		Timestamp:   now,
+		Content:     l.trailing,
+		Emotes:      l.emotes(l.trailing),
+		Amount:      parseBits(l.tags["bits"]),
+		Badges:      l.badges(),
+		Extra:       l.extra(),
+	}, true
+}
+
+// parseBits returns the bits cheered in a message, from its bits tag.
+// Cheermote-like words in the text are not counted: only Twitch knows
+// which cheermotes a channel has, and chat can type "Cheer100" freely.
+func parseBits(tag string) message.Amount {
+	bits, _ := strconv.Atoi(tag)
+	if bits <= 0 {
+		return message.Amount{}
 	}
-	username := parts[0]
 
-	// Find message content after " :"
-	msgIdx := strings.Index(line, " :")
-	if msgIdx == -1 {
+	unit := "bits"
+	if bits == 1 {
+		unit = "bit"
+	}
+	return message.Amount{
+		Value:    float64(bits),
+		Currency: "BITS",
+		Display:  fmt.Sprintf("%d %s", bits, unit),
+	}
+}
+
+// userNoticeTypes maps USERNOTICE msg-id tags to message types. Other
+// notices (announcements, bits badge tiers, ...) are ignored.
+var userNoticeTypes = map[string]message.Type{
+	"sub":              message.TypeSub,
+	"resub":            message.TypeSub,
+	"subgift":          message.TypeSub,
+	"submysterygift":   message.TypeSub,
+	"giftpaidupgrade":  message.TypeSub,
+	"primepaidupgrade": message.TypeSub,
+	"raid":             message.TypeRaid,
+}
+
+// parseUserNotice parses USERNOTICE lines (subs, resubs, gift subs, raids):
+// @msg-id=resub;login=bob;system-msg=... :tmi.twitch.tv USERNOTICE #channel :optional message
+// Content is Twitch's human-readable system-msg, followed by the user's
+// own message when they attached one.
+func parseUserNotice(line string, now time.Time) (message.Message, bool) {
+	l, ok := parseLine(line)
+	if !ok || l.command != "USERNOTICE" {
 		return message.Message{}, false
 	}
 
-	// Skip the PRIVMSG prefix part, find the actual message
-	afterPrivmsg := strings.SplitN(line, "PRIVMSG", 2)
-	if len(afterPrivmsg) < 2 {
+	msgType, ok := userNoticeTypes[l.tags["msg-id"]]
+	if !ok {
 		return message.Message{}, false
 	}
 
-	contentIdx := strings.Index(afterPrivmsg[1], ":")
-	if contentIdx == -1 {
+	username := l.tags["display-name"]
+	if username == "" {
+		username = l.tags["login"]
+	}
+
+	content := l.tags["system-msg"]
+	if l.trailing != "" {
+		if content != "" {
+			content += " — "
+		}
+		content += l.trailing
+	}
+	if content == "" {
 		return message.Message{}, false
 	}
-	content := afterPrivmsg[1][contentIdx+1:]
 
 	return message.Message{
 		Platform:  message.Twitch,
+		Type:      msgType,
+		ID:        cmp.Or(l.tags["id"], message.NewID()),
+		Channel:   l.channel(),
 		Username:  username,
-		Timestamp: time.Now(),
+		UserID:    l.tags["user-id"],
+		Timestamp: now,
 		Content:   content,
+		Badges:    l.badges(),
+		Extra:     l.extra(),
 	}, true
 }
+
+// parseClear parses moderation lines into deletion events:
+// @login=bob;target-msg-id=abc :tmi.twitch.tv CLEARMSG #channel :deleted text
+// @ban-duration=600 :tmi.twitch.tv CLEARCHAT #channel :bob   (timeout)
+// :tmi.twitch.tv CLEARCHAT #channel :bob                     (ban)
+// :tmi.twitch.tv CLEARCHAT #channel                          (chat cleared)
+func parseClear(line string, now time.Time) (message.Message, bool) {
+	l, ok := parseLine(line)
+	if !ok {
+		return message.Message{}, false
+	}
+
+	msg := message.Message{
+		Platform:  message.Twitch,
+		Type:      message.TypeDeletion,
+		ID:        message.NewID(),
+		Channel:   l.channel(),
+		Timestamp: now,
+	}
+
+	switch l.command {
+	case "CLEARMSG":
+		msg.Username = l.tags["login"]
+		msg.TargetID = l.tags["target-msg-id"]
+		if msg.TargetID == "" {
+			return message.Message{}, false
+		}
+		msg.Content = i18n.T(i18n.MessageDeleted, msg.Username)
+	case "CLEARCHAT":
+		msg.Username = l.trailing
+		switch {
+		case msg.Username == "":
+			msg.Content = i18n.T(i18n.ChatCleared)
+		case l.tags["ban-duration"] != "":
+			msg.Content = i18n.T(i18n.UserTimedOut, msg.Username, l.tags["ban-duration"])
+		default:
+			msg.Content = i18n.T(i18n.UserBanned, msg.Username)
+		}
+	default:
+		return message.Message{}, false
+	}
+
+	return msg, true
+}
@@ -1,8 +1,22 @@
 package twitch
 
 import (
-	"relay/internal/message"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/i18n"
+	"relay/internal/message"
+	"relay/internal/relaytest"
 )
 
 func TestParsePrivMsg(t *testing.T) {
@@ -12,6 +26,7 @@ func TestParsePrivMsg(t *testing.T) {
 		wantOk   bool
 		wantUser string
 		wantText string
+		wantChan string
 	}{
 		{
 			name:     "standard PRIVMSG",
@@ -19,6 +34,7 @@ func TestParsePrivMsg(t *testing.T) {
 			wantOk:   true,
 			wantUser: "cooluser",
 			wantText: "hello world",
+			wantChan: "channel",
 		},
 		{
 			name:     "message with colons in content",
@@ -26,6 +42,7 @@ func TestParsePrivMsg(t *testing.T) {
 			wantOk:   true,
 			wantUser: "user",
 			wantText: "time is 12:34:56",
+			wantChan: "ch",
 		},
 		{
 			name:   "PING message",
@@ -56,7 +73,7 @@ func TestParsePrivMsg(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msg, ok := parsePrivMsg(tt.line)
+			msg, ok := parsePrivMsg(tt.line, time.Now())
 			if ok != tt.wantOk {
 				t.Fatalf("parsePrivMsg() ok = %v, want %v", ok, tt.wantOk)
 			}
@@ -69,6 +86,9 @@ func TestParsePrivMsg(t *testing.T) {
 			if msg.Content != tt.wantText {
 				t.Errorf("Content = %q, want %q", msg.Content, tt.wantText)
 			}
+			if msg.Channel != tt.wantChan {
+				t.Errorf("Channel = %q, want %q", msg.Channel, tt.wantChan)
+			}
 			if msg.Platform != message.Twitch {
 				t.Errorf("Platform = %v, want Twitch", msg.Platform)
 			}
@@ -76,9 +96,693 @@ func TestParsePrivMsg(t *testing.T) {
 	}
 }
 
+func TestParsePrivMsgWithTags(t *testing.T) {
+	line := "@badge-info=;color=#FF0000;display-name=CoolUser;mod=0 :cooluser!cooluser@cooluser.tmi.twitch.tv PRIVMSG #chan :tagged hello"
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false for tagged line")
+	}
+	if msg.Username != "cooluser" {
+		t.Errorf("Username = %q, want %q", msg.Username, "cooluser")
+	}
+	if msg.Content != "tagged hello" {
+		t.Errorf("Content = %q, want %q", msg.Content, "tagged hello")
+	}
+	if msg.Type != message.TypeChat {
+		t.Errorf("Type = %v, want chat", msg.Type)
+	}
+}
+
+func TestParsePrivMsgBadges(t *testing.T) {
+	line := "@badges=subscriber/12,vip/1;display-name=Bob :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi"
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false")
+	}
+	if len(msg.Badges) != 2 || msg.Badges[0] != "subscriber" || msg.Badges[1] != "vip" {
+		t.Errorf("Badges = %q, want subscriber and vip", msg.Badges)
+	}
+}
+
+func TestParsePrivMsgExtra(t *testing.T) {
+	line := "@badges=moderator/1;color=#1E90FF;first-msg=1 :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi all"
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false")
+	}
+	if msg.Color() != "#1E90FF" || !msg.IsFirstMessage() || !msg.IsModerator() {
+		t.Errorf("Extra = %v with badges %q, want a first message from a moderator in #1E90FF", msg.Extra, msg.Badges)
+	}
+
+	msg, _ = parsePrivMsg("@color=;first-msg=0 :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi again", time.Now())
+	if msg.Extra != nil {
+		t.Errorf("Extra = %v, want none for empty tags", msg.Extra)
+	}
+}
+
+func TestParsePrivMsgReply(t *testing.T) {
+	line := `@id=def;reply-parent-display-name=Streamer;reply-parent-msg-body=what\sgame?;reply-parent-msg-id=abc-123;reply-parent-user-login=streamer :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :@Streamer doom`
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false")
+	}
+	if msg.ReplyToID != "abc-123" || msg.ReplyToUser != "streamer" {
+		t.Errorf("reply to %q from %q, want abc-123 from streamer", msg.ReplyToID, msg.ReplyToUser)
+	}
+	if msg.Content != "@Streamer doom" {
+		t.Errorf("Content = %q, want it as sent", msg.Content)
+	}
+}
+
+func TestParsePrivMsgEmotes(t *testing.T) {
+	const kappa = "https://static-cdn.jtvnw.net/emoticons/v2/25/default/dark/1.0"
+	tests := []struct {
+		content string
+		tag     string
+		want    []message.Emote
+	}{
+		{"Kappa hi Kappa PogChamp", "25:0-4,9-13/88:15-22", []message.Emote{
+			{Name: "Kappa", Start: 0, End: 5, Image: kappa},
+			{Name: "Kappa", Start: 9, End: 14, Image: kappa},
+			{Name: "PogChamp", Start: 15, End: 23, Image: "https://static-cdn.jtvnw.net/emoticons/v2/88/default/dark/1.0"},
+		}},
+		{"héllo 👋 Kappa", "25:8-12", []message.Emote{{Name: "Kappa", Start: 8, End: 13, Image: kappa}}},
+		{"\x01ACTION waves Kappa\x01", "25:6-10", []message.Emote{{Name: "Kappa", Start: 14, End: 19, Image: kappa}}},
+		{"short", "25:3-40", nil},
+		{"none", "", nil},
+	}
+	for _, tt := range tests {
+		line := "@emotes=" + tt.tag + " :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :" + tt.content
+		msg, ok := parsePrivMsg(line, time.Now())
+		if !ok {
+			t.Fatalf("parsePrivMsg(%q) ok = false", line)
+		}
+		if !slices.Equal(msg.Emotes, tt.want) {
+			t.Errorf("Emotes for %q = %+v, want %+v", tt.content, msg.Emotes, tt.want)
+		}
+	}
+}
+
+func TestParsePrivMsgID(t *testing.T) {
+	line := "@id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;display-name=Bob :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi"
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false")
+	}
+	if msg.ID != "b34ccfc7-4977-403a-8a94-33c6bac34fb8" {
+		t.Errorf("ID = %q", msg.ID)
+	}
+
+	// Without an id tag, the message gets one of its own
+	first, _ := parsePrivMsg(":bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi", time.Now())
+	second, _ := parsePrivMsg(":bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :hi", time.Now())
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("untagged IDs = %q and %q, want two different IDs", first.ID, second.ID)
+	}
+}
+
+func TestParseBits(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		wantValue   float64
+		wantDisplay string
+	}{
+		{"bits", "250", 250, "250 bits"},
+		{"single bit", "1", 1, "1 bit"},
+		{"no tag", "", 0, ""},
+		{"malformed tag", "lots", 0, ""},
+		{"negative tag", "-5", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseBits(tt.tag)
+			if got.Value != tt.wantValue || got.Display != tt.wantDisplay {
+				t.Errorf("parseBits(%q) = %+v, want %v %q", tt.tag, got, tt.wantValue, tt.wantDisplay)
+			}
+			if tt.wantValue > 0 && got.Currency != "BITS" {
+				t.Errorf("Currency = %q, want BITS", got.Currency)
+			}
+		})
+	}
+}
+
+func TestParsePrivMsgCheer(t *testing.T) {
+	line := "@bits=100;id=x :bob!bob@bob.tmi.twitch.tv PRIVMSG #chan :Cheer100 great stream"
+
+	msg, ok := parsePrivMsg(line, time.Now())
+	if !ok {
+		t.Fatal("parsePrivMsg() ok = false")
+	}
+	if msg.Amount.Value != 100 {
+		t.Errorf("Amount = %+v, want 100 bits", msg.Amount)
+	}
+	if msg.Type != message.TypeChat {
+		t.Errorf("Type = %v, cheers are still chat", msg.Type)
+	}
+}
+
+func TestParseClear(t *testing.T) {
+	tests := []struct {
+		name         string
+		line         string
+		wantOk       bool
+		wantUser     string
+		wantTargetID string
+		wantContent  string
+	}{
+		{
+			name:         "CLEARMSG single message",
+			line:         "@login=ronni;room-id=;target-msg-id=abc-123;tmi-sent-ts=1642720582342 :tmi.twitch.tv CLEARMSG #chan :HeyGuys",
+			wantOk:       true,
+			wantUser:     "ronni",
+			wantTargetID: "abc-123",
+			wantContent:  "message from ronni deleted",
+		},
+		{
+			name:        "CLEARCHAT timeout",
+			line:        "@ban-duration=350;room-id=1;target-user-id=2 :tmi.twitch.tv CLEARCHAT #chan :ronni",
+			wantOk:      true,
+			wantUser:    "ronni",
+			wantContent: "ronni timed out for 350s",
+		},
+		{
+			name:        "CLEARCHAT ban",
+			line:        "@room-id=1;target-user-id=2 :tmi.twitch.tv CLEARCHAT #chan :ronni",
+			wantOk:      true,
+			wantUser:    "ronni",
+			wantContent: "ronni banned",
+		},
+		{
+			name:        "CLEARCHAT whole chat",
+			line:        "@room-id=1 :tmi.twitch.tv CLEARCHAT #chan",
+			wantOk:      true,
+			wantContent: "chat cleared by a moderator",
+		},
+		{
+			name:   "CLEARMSG without target id",
+			line:   "@login=ronni :tmi.twitch.tv CLEARMSG #chan :HeyGuys",
+			wantOk: false,
+		},
+		{
+			name:   "PRIVMSG is not a clear",
+			line:   ":user!user@user.tmi.twitch.tv PRIVMSG #chan :hello",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := parseClear(tt.line, time.Now())
+			if ok != tt.wantOk {
+				t.Fatalf("parseClear() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if msg.Type != message.TypeDeletion {
+				t.Errorf("Type = %v, want deletion", msg.Type)
+			}
+			if msg.Username != tt.wantUser {
+				t.Errorf("Username = %q, want %q", msg.Username, tt.wantUser)
+			}
+			if msg.TargetID != tt.wantTargetID {
+				t.Errorf("TargetID = %q, want %q", msg.TargetID, tt.wantTargetID)
+			}
+			if msg.ID == "" || msg.ID == msg.TargetID {
+				t.Errorf("ID = %q, want an ID of its own", msg.ID)
+			}
+			if msg.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", msg.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestParseClearLocale(t *testing.T) {
+	if err := i18n.Set("de"); err != nil {
+		t.Fatal(err)
+	}
+	defer i18n.Set(i18n.DefaultTag)
+
+	for line, want := range map[string]string{
+		"@login=ronni;target-msg-id=abc-123 :tmi.twitch.tv CLEARMSG #chan :HeyGuys": "Nachricht von ronni gelöscht",
+		"@ban-duration=350 :tmi.twitch.tv CLEARCHAT #chan :ronni":                   "ronni für 350 s gesperrt",
+		":tmi.twitch.tv CLEARCHAT #chan :ronni":                                     "ronni gebannt",
+		":tmi.twitch.tv CLEARCHAT #chan":                                            "Chat von einem Moderator geleert",
+	} {
+		msg, _ := parseClear(line, time.Now())
+		if msg.Content != want {
+			t.Errorf("parseClear(%q) content = %q, want %q", line, msg.Content, want)
+		}
+	}
+}
+
+func TestParseUserNotice(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantOk      bool
+		wantType    message.Type
+		wantUser    string
+		wantContent string
+	}{
+		{
+			name:        "resub with message",
+			line:        `@display-name=Bob;login=bob;msg-id=resub;msg-param-cumulative-months=6;system-msg=Bob\ssubscribed\sat\sTier\s1.\sThey've\ssubscribed\sfor\s6\smonths! :tmi.twitch.tv USERNOTICE #chan :love the stream`,
+			wantOk:      true,
+			wantType:    message.TypeSub,
+			wantUser:    "Bob",
+			wantContent: "Bob subscribed at Tier 1. They've subscribed for 6 months! — love the stream",
+		},
+		{
+			name:        "gift sub without message",
+			line:        `@login=alice;msg-id=subgift;system-msg=alice\sgifted\sa\sTier\s1\ssub\sto\scarol! :tmi.twitch.tv USERNOTICE #chan`,
+			wantOk:      true,
+			wantType:    message.TypeSub,
+			wantUser:    "alice",
+			wantContent: "alice gifted a Tier 1 sub to carol!",
+		},
+		{
+			name:        "raid",
+			line:        `@display-name=Raider;login=raider;msg-id=raid;msg-param-viewerCount=15;system-msg=15\sraiders\sfrom\sRaider\shave\sjoined! :tmi.twitch.tv USERNOTICE #chan`,
+			wantOk:      true,
+			wantType:    message.TypeRaid,
+			wantUser:    "Raider",
+			wantContent: "15 raiders from Raider have joined!",
+		},
+		{
+			name:   "unsupported msg-id",
+			line:   `@login=x;msg-id=announcement;system-msg=hi :tmi.twitch.tv USERNOTICE #chan :hello`,
+			wantOk: false,
+		},
+		{
+			name:   "not a USERNOTICE",
+			line:   ":user!user@user.tmi.twitch.tv PRIVMSG #chan :hello",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := parseUserNotice(tt.line, time.Now())
+			if ok != tt.wantOk {
+				t.Fatalf("parseUserNotice() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if msg.Type != tt.wantType {
+				t.Errorf("Type = %v, want %v", msg.Type, tt.wantType)
+			}
+			if msg.Username != tt.wantUser {
+				t.Errorf("Username = %q, want %q", msg.Username, tt.wantUser)
+			}
+			if msg.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", msg.Content, tt.wantContent)
+			}
+			if msg.Channel != "chan" {
+				t.Errorf("Channel = %q, want %q", msg.Channel, "chan")
+			}
+		})
+	}
+}
+
 func TestNewClient(t *testing.T) {
-	c := NewClient("UPPERCASE")
-	if c.channel != "uppercase" {
-		t.Errorf("NewClient did not lowercase channel: got %q", c.channel)
+	c := NewClient([]string{"UPPERCASE"}, Options{})
+	if len(c.channels) != 1 || c.channels[0] != "uppercase" {
+		t.Errorf("NewClient did not lowercase channel: got %q", c.channels)
+	}
+}
+
+func TestNewClientMultipleChannels(t *testing.T) {
+	c := NewClient([]string{"xQc", "#Shroud"}, Options{})
+	want := []string{"xqc", "shroud"}
+	if len(c.channels) != len(want) {
+		t.Fatalf("channels = %q, want %q", c.channels, want)
+	}
+	for i := range want {
+		if c.channels[i] != want[i] {
+			t.Errorf("channels[%d] = %q, want %q", i, c.channels[i], want[i])
+		}
+	}
+}
+
+func TestRegisterAnonymous(t *testing.T) {
+	c := NewClient([]string{"xqc", "shroud"}, Options{})
+
+	var buf bytes.Buffer
+	c.register(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\r\n")
+
+	if len(lines) != 3 {
+		t.Fatalf("expected CAP + NICK + JOIN, got %q", lines)
+	}
+	if lines[0] != "CAP REQ :twitch.tv/tags twitch.tv/commands" {
+		t.Errorf("line 1 = %q, want CAP REQ", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "NICK justinfan") {
+		t.Errorf("line 2 = %q, want anonymous NICK", lines[1])
+	}
+	if lines[2] != "JOIN #xqc,#shroud" {
+		t.Errorf("line 3 = %q, want JOIN #xqc,#shroud", lines[2])
+	}
+}
+
+func TestRegisterAuthenticated(t *testing.T) {
+	c := NewClient([]string{"xqc"}, Options{Nick: "RelayBot", Token: "abc123"})
+
+	var buf bytes.Buffer
+	c.register(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\r\n")
+
+	want := []string{"CAP REQ :twitch.tv/tags twitch.tv/commands", "PASS oauth:abc123", "NICK relaybot", "JOIN #xqc"}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i+1, lines[i], want[i])
+		}
+	}
+}
+
+func TestRegisterCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []string
+		want string
+	}{
+		{"default", nil, "CAP REQ :twitch.tv/tags twitch.tv/commands"},
+		{"custom", []string{"twitch.tv/tags", "twitch.tv/membership"}, "CAP REQ :twitch.tv/tags twitch.tv/membership"},
+		{"none", []string{}, "PASS oauth:abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient([]string{"xqc"}, Options{Nick: "RelayBot", Token: "abc", Capabilities: tt.caps})
+
+			var buf bytes.Buffer
+			c.register(&buf)
+
+			lines := strings.Split(strings.TrimRight(buf.String(), "\r\n"), "\r\n")
+			if lines[0] != tt.want {
+				t.Errorf("line 1 = %q, want %q", lines[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestSendReadOnly(t *testing.T) {
+	c := NewClient([]string{"xqc"}, Options{})
+	if err := c.Send(context.Background(), "xqc", "hi"); err != ErrReadOnly {
+		t.Errorf("Send() error = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestSendNotConnected(t *testing.T) {
+	c := NewClient([]string{"xqc"}, Options{Nick: "bot", Token: "oauth:abc"})
+	if err := c.Send(context.Background(), "xqc", "hi"); err != ErrNotConnected {
+		t.Errorf("Send() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSendWritesPrivMsg(t *testing.T) {
+	c := NewClient([]string{"xqc"}, Options{Nick: "bot", Token: "oauth:abc"})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c.setConn(client)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Send(context.Background(), "#XQC", "hello\nchat")
+	}()
+
+	line, err := bufio.NewReader(server).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading sent line: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if line != "PRIVMSG #xqc :hello chat\r\n" {
+		t.Errorf("sent %q", line)
+	}
+
+	// Long messages are cut to Twitch's limit
+	go func() {
+		errCh <- c.Send(context.Background(), "xqc", strings.Repeat("é", maxSendLength+10))
+	}()
+	line, _ = bufio.NewReader(server).ReadString('\n')
+	<-errCh
+	if got := strings.TrimSuffix(strings.TrimPrefix(line, "PRIVMSG #xqc :"), "\r\n"); len([]rune(got)) != maxSendLength {
+		t.Errorf("sent %d characters, want %d", len([]rune(got)), maxSendLength)
+	}
+}
+
+func TestSendGivesUpOnStalledConnection(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	c := NewClient([]string{"xqc"}, Options{Nick: "bot", Token: "oauth:abc", WriteTimeout: 50 * time.Millisecond})
+
+	// The server never reads, so every write blocks
+	client, server := net.Pipe()
+	defer server.Close()
+	c.setConn(client)
+
+	start := time.Now()
+	if err := c.Send(context.Background(), "xqc", "hi"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Send() = %v, want a deadline error", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Send() took %s with a 50ms write timeout", took)
+	}
+	// A half-written line can't be finished, so the connection is dropped
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("connection after a failed write: read = %v, want it closed", err)
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	c := NewClient([]string{"xqc"}, Options{Nick: "bot", Token: "oauth:abc"})
+	client, server := net.Pipe()
+	defer server.Close()
+	c.setConn(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := c.Send(ctx, "xqc", "hi"); err != context.Canceled {
+		t.Errorf("Send() = %v, want context.Canceled", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Send() took %s to notice cancellation", took)
+	}
+}
+
+func TestConnectReturnsWhenReaderStalls(t *testing.T) {
+	relaytest.NoLeaks(t, 2*time.Second)
+	addr, _ := mockIRCServer(t,
+		":alice!alice@alice.tmi.twitch.tv PRIVMSG #xqc :one",
+		":alice!alice@alice.tmi.twitch.tv PRIVMSG #xqc :two",
+	)
+	c := NewClient([]string{"xqc"}, Options{Server: addr, Plaintext: true})
+
+	// Nothing reads messages past the first
+	messages := make(chan message.Message)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Connect(ctx, messages) }()
+	select {
+	case <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Connect() = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connect() still blocked on a stalled reader after cancel")
+	}
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "irc.chat.twitch.tv:6697"},
+		{Options{Plaintext: true}, "irc.chat.twitch.tv:6667"},
+		{Options{Server: "localhost:6667", Plaintext: true}, "localhost:6667"},
+	}
+
+	for _, tt := range tests {
+		c := NewClient([]string{"x"}, tt.opts)
+		if got := c.server(); got != tt.want {
+			t.Errorf("server() with %+v = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+// mockIRCServer accepts one connection, waits for JOIN, then writes lines.
+func mockIRCServer(t *testing.T, lines ...string) (addr string, received chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received = make(chan string, 20)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSpace(line)
+			if strings.HasPrefix(line, "JOIN") {
+				break
+			}
+		}
+		for _, l := range lines {
+			conn.Write([]byte(l + "\r\n"))
+		}
+		// Drain until the client disconnects
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSpace(line)
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
+
+func TestConnectMockServer(t *testing.T) {
+	addr, received := mockIRCServer(t,
+		":tmi.twitch.tv 001 justinfan1 :Welcome, GLHF!",
+		"PING :tmi.twitch.tv",
+		"@emote-only=0;followers-only=-1;r9k=0;room-id=71092938;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #xqc",
+		":alice!alice@alice.tmi.twitch.tv PRIVMSG #xqc :hello from mock",
+		`@msg-id=raid;login=raider;system-msg=5\sraiders\sfrom\sraider\shave\sjoined! :tmi.twitch.tv USERNOTICE #xqc`,
+	)
+
+	c := NewClient([]string{"xqc"}, Options{Server: addr, Plaintext: true})
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go c.Connect(ctx, messages)
+
+	var got []message.Message
+	for len(got) < 2 {
+		select {
+		case msg := <-messages:
+			got = append(got, msg)
+		case <-ctx.Done():
+			t.Fatalf("timed out, received %+v", got)
+		}
+	}
+
+	if got[0].Content != "hello from mock" || got[0].Channel != "xqc" {
+		t.Errorf("msg[0] = %+v", got[0])
+	}
+	if got[1].Type != message.TypeRaid {
+		t.Errorf("msg[1].Type = %v, want raid", got[1].Type)
+	}
+	if id := c.RoomID("#XQC"); id != "71092938" {
+		t.Errorf("RoomID() = %q, want the ROOMSTATE's room-id", id)
+	}
+
+	// The client must answer the server PING
+	for {
+		select {
+		case line := <-received:
+			if line == "PONG :tmi.twitch.tv" {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("no PONG received")
+		}
+	}
+}
+
+func TestConnectAuthFailed(t *testing.T) {
+	addr, _ := mockIRCServer(t, ":tmi.twitch.tv NOTICE * :Login authentication failed")
+	c := NewClient([]string{"xqc"}, Options{Server: addr, Plaintext: true, Nick: "relaybot", Token: "oauth:expired"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.Connect(ctx, make(chan message.Message, 1))
+	if !errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), `"relaybot"`) {
+		t.Errorf("Connect() = %v, want ErrAuth for the nick", err)
+	}
+}
+
+func TestConnectStampsWithClock(t *testing.T) {
+	addr, _ := mockIRCServer(t, ":alice!alice@alice.tmi.twitch.tv PRIVMSG #xqc :hello")
+	at := time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)
+	c := NewClient([]string{"xqc"}, Options{Server: addr, Plaintext: true, Clock: clock.NewFake(at)})
+
+	messages := make(chan message.Message, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go c.Connect(ctx, messages)
+
+	select {
+	case msg := <-messages:
+		if !msg.Timestamp.Equal(at) {
+			t.Errorf("Timestamp = %v, want the clock's %v", msg.Timestamp, at)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out")
+	}
+}
+
+func TestConnectKeepsRaw(t *testing.T) {
+	const line = "@color=#1E90FF;id=abc :alice!alice@alice.tmi.twitch.tv PRIVMSG #xqc :hello"
+	for _, keep := range []bool{false, true} {
+		addr, _ := mockIRCServer(t, line)
+		c := NewClient([]string{"xqc"}, Options{Server: addr, Plaintext: true, KeepRaw: keep})
+
+		messages := make(chan message.Message, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go c.Connect(ctx, messages)
+
+		want := ""
+		if keep {
+			want = line
+		}
+		select {
+		case msg := <-messages:
+			if msg.Raw != want {
+				t.Errorf("KeepRaw %v: Raw = %q, want %q", keep, msg.Raw, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out")
+		}
 	}
 }
@@ -0,0 +1,172 @@
+package twitch
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"relay/internal/message"
+)
+
+// actionPrefix starts a /me message's text; Twitch counts emote
+// positions from after it.
+const actionPrefix = "\x01ACTION "
+
+// ircLine is a parsed IRCv3 line:
+// [@tags] [:prefix] COMMAND [params...] [:trailing]
+type ircLine struct {
+	tags     map[string]string
+	prefix   string
+	command  string
+	params   []string
+	trailing string
+}
+
+// nick returns the nickname part of the prefix (before "!"), or "" when
+// the prefix is a bare server name.
+func (l ircLine) nick() string {
+	nick, _, ok := strings.Cut(l.prefix, "!")
+	if !ok {
+		return ""
+	}
+	return nick
+}
+
+// channel returns the first parameter without its "#", which for
+// PRIVMSG, USERNOTICE and friends is the target channel.
+func (l ircLine) channel() string {
+	if len(l.params) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(l.params[0], "#")
+}
+
+// badges returns the badge names from the badges tag, e.g.
+// "subscriber/12,vip/1" gives subscriber and vip.
+func (l ircLine) badges() []string {
+	var out []string
+	for _, badge := range strings.Split(l.tags["badges"], ",") {
+		if name, _, _ := strings.Cut(badge, "/"); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// extra returns the tags kept in a message's Extra: the sender's name
+// color and whether this is their first message in the channel.
+func (l ircLine) extra() map[string]string {
+	extra := make(map[string]string)
+	if c := l.tags["color"]; c != "" {
+		extra[message.ExtraColor] = c
+	}
+	if l.tags["first-msg"] == "1" {
+		extra[message.ExtraFirstMessage] = "1"
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+// emoteImage returns where Twitch serves an emote's picture.
+func emoteImage(id string) string {
+	return "https://static-cdn.jtvnw.net/emoticons/v2/" + id + "/default/dark/1.0"
+}
+
+// emotes locates the emotes tag's emotes in content, e.g.
+// "25:0-4,12-16/1902:6-10". Positions are in runes; ranges that fall
+// outside content are skipped.
+func (l ircLine) emotes(content string) []message.Emote {
+	runes := []rune(content)
+	offset := 0
+	if strings.HasPrefix(content, actionPrefix) {
+		offset = len([]rune(actionPrefix))
+	}
+	var out []message.Emote
+	for _, emote := range strings.Split(l.tags["emotes"], "/") {
+		id, ranges, ok := strings.Cut(emote, ":")
+		if !ok {
+			continue
+		}
+		for _, r := range strings.Split(ranges, ",") {
+			from, to, _ := strings.Cut(r, "-")
+			start, err1 := strconv.Atoi(from)
+			end, err2 := strconv.Atoi(to)
+			start, end = start+offset, end+offset+1
+			if err1 != nil || err2 != nil || start < 0 || start >= end || end > len(runes) {
+				continue
+			}
+			out = append(out, message.Emote{
+				Name:  string(runes[start:end]),
+				Start: start,
+				End:   end,
+				Image: emoteImage(id),
+			})
+		}
+	}
+	slices.SortFunc(out, func(a, b message.Emote) int { return a.Start - b.Start })
+	return out
+}
+
+// parseLine splits a raw IRC line into its parts. It returns false for
+// empty lines or lines without a command.
+func parseLine(line string) (ircLine, bool) {
+	var l ircLine
+
+	if strings.HasPrefix(line, "@") {
+		rawTags, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return l, false
+		}
+		l.tags = parseTags(rawTags)
+		line = rest
+	}
+
+	if strings.HasPrefix(line, ":") {
+		prefix, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return l, false
+		}
+		l.prefix = prefix
+		line = rest
+	}
+
+	if head, trailing, ok := strings.Cut(line, " :"); ok {
+		line = head
+		l.trailing = trailing
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return l, false
+	}
+	l.command = fields[0]
+	l.params = fields[1:]
+	return l, true
+}
+
+// parseTags decodes "key=value;key2=value2" IRCv3 message tags.
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		k, v, _ := strings.Cut(pair, "=")
+		if k != "" {
+			tags[k] = unescapeTag(v)
+		}
+	}
+	return tags
+}
+
+var tagUnescaper = strings.NewReplacer(
+	`\s`, " ",
+	`\:`, ";",
+	`\\`, `\`,
+	`\r`, "\r",
+	`\n`, "\n",
+)
+
+// unescapeTag reverses IRCv3 tag value escaping.
+func unescapeTag(v string) string {
+	return tagUnescaper.Replace(v)
+}
@@ -0,0 +1,104 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name         string
+		line         string
+		wantOk       bool
+		wantCommand  string
+		wantNick     string
+		wantChannel  string
+		wantTrailing string
+		wantTags     map[string]string
+	}{
+		{
+			name:         "untagged PRIVMSG",
+			line:         ":user!user@user.tmi.twitch.tv PRIVMSG #chan :hi there",
+			wantOk:       true,
+			wantCommand:  "PRIVMSG",
+			wantNick:     "user",
+			wantChannel:  "chan",
+			wantTrailing: "hi there",
+		},
+		{
+			name:         "tagged USERNOTICE",
+			line:         `@login=bob;msg-id=sub;system-msg=bob\ssubscribed\:\sTier\s1 :tmi.twitch.tv USERNOTICE #chan`,
+			wantOk:       true,
+			wantCommand:  "USERNOTICE",
+			wantChannel:  "chan",
+			wantTrailing: "",
+			wantTags: map[string]string{
+				"login":      "bob",
+				"msg-id":     "sub",
+				"system-msg": "bob subscribed; Tier 1",
+			},
+		},
+		{
+			name:         "PING without prefix",
+			line:         "PING :tmi.twitch.tv",
+			wantOk:       true,
+			wantCommand:  "PING",
+			wantTrailing: "tmi.twitch.tv",
+		},
+		{
+			name:   "empty line",
+			line:   "",
+			wantOk: false,
+		},
+		{
+			name:   "tags only",
+			line:   "@a=b",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, ok := parseLine(tt.line)
+			if ok != tt.wantOk {
+				t.Fatalf("parseLine() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if l.command != tt.wantCommand {
+				t.Errorf("command = %q, want %q", l.command, tt.wantCommand)
+			}
+			if l.nick() != tt.wantNick {
+				t.Errorf("nick() = %q, want %q", l.nick(), tt.wantNick)
+			}
+			if l.channel() != tt.wantChannel {
+				t.Errorf("channel() = %q, want %q", l.channel(), tt.wantChannel)
+			}
+			if l.trailing != tt.wantTrailing {
+				t.Errorf("trailing = %q, want %q", l.trailing, tt.wantTrailing)
+			}
+			for k, want := range tt.wantTags {
+				if got := l.tags[k]; got != want {
+					t.Errorf("tags[%q] = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+// benchLine is a typical tagged chat line: badges, emotes, and a reply.
+const benchLine = `@badge-info=subscriber/14;badges=subscriber/12,premium/1;color=#1E90FF;display-name=Viewer;emotes=25:0-4,12-16/1902:6-10;first-msg=0;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;room-id=71092938;subscriber=1;tmi-sent-ts=1736951445123;turbo=0;user-id=12345678;user-type= :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #xqc :Kappa Keepo Kappa what a play`
+
+func BenchmarkParseLine(b *testing.B) {
+	for b.Loop() {
+		parseLine(benchLine)
+	}
+}
+
+func BenchmarkParsePrivMsg(b *testing.B) {
+	now := time.Now()
+	for b.Loop() {
+		parsePrivMsg(benchLine, now)
+	}
+}
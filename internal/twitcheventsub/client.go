@@ -0,0 +1,462 @@
+package twitcheventsub
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"relay/internal/message"
+)
+
+const (
+	eventSubURL = "wss://eventsub.wss.twitch.tv/ws"
+	helixURL    = "https://api.twitch.tv/helix"
+)
+
+// Failed Helix requests and revoked subscriptions wrap one of these, so
+// callers can test them with errors.Is.
+var (
+	// ErrAuth is a 401: the access token is invalid or expired.
+	ErrAuth = errors.New("eventsub: access token refused")
+	// ErrRateLimit is a 429.
+	ErrRateLimit = errors.New("eventsub: rate limited")
+	// ErrSubscriptionRejected is a subscription Twitch refused, e.g. for
+	// a missing scope, or later revoked.
+	ErrSubscriptionRejected = errors.New("eventsub: subscription rejected")
+	// ErrNotLive is returned by CreateClip when the broadcaster is
+	// offline.
+	ErrNotLive = errors.New("eventsub: channel is not live")
+)
+
+// Client streams follow, raid, and channel point redemption events from
+// Twitch's EventSub WebSocket into the unified message stream.
+type Client struct {
+	clientID    string
+	token       string
+	broadcaster string
+	wsURL       string
+	helixURL    string
+	httpClient  *http.Client
+	// keepRaw keeps each event's JSON in its message's Raw.
+	keepRaw bool
+}
+
+// NewClient creates an EventSub client. clientID and token are the
+// application's Client ID and a user access token authorised for the
+// subscribed scopes (moderator:read:followers, channel:read:redemptions).
+// broadcaster is the login of the channel to watch.
+func NewClient(clientID, token, broadcaster string) *Client {
+	return &Client{
+		clientID:    clientID,
+		token:       strings.TrimPrefix(token, "oauth:"),
+		broadcaster: strings.ToLower(broadcaster),
+		wsURL:       eventSubURL,
+		helixURL:    helixURL,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// KeepRaw makes the client set each message's Raw to the JSON of the
+// event it came from. Call it before Connect.
+func (c *Client) KeepRaw() {
+	c.keepRaw = true
+}
+
+// wsMessage is an EventSub WebSocket frame.
+type wsMessage struct {
+	Metadata struct {
+		MessageID        string `json:"message_id"`
+		MessageType      string `json:"message_type"`
+		MessageTimestamp string `json:"message_timestamp"`
+		SubscriptionType string `json:"subscription_type"`
+	} `json:"metadata"`
+	Payload struct {
+		Session struct {
+			ID                      string `json:"id"`
+			KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+			ReconnectURL            string `json:"reconnect_url"`
+		} `json:"session"`
+		Subscription struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"subscription"`
+		Event json.RawMessage `json:"event"`
+	} `json:"payload"`
+}
+
+// Event payloads for the supported subscription types
+type followEvent struct {
+	UserName string `json:"user_name"`
+}
+
+type raidEvent struct {
+	FromBroadcasterUserName string `json:"from_broadcaster_user_name"`
+	Viewers                 int    `json:"viewers"`
+}
+
+type redemptionEvent struct {
+	UserName  string `json:"user_name"`
+	UserInput string `json:"user_input"`
+	Reward    struct {
+		Title string `json:"title"`
+		Cost  int    `json:"cost"`
+	} `json:"reward"`
+}
+
+// subscription describes one EventSub subscription request.
+type subscription struct {
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport struct {
+		Method    string `json:"method"`
+		SessionID string `json:"session_id"`
+	} `json:"transport"`
+}
+
+func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) error {
+	broadcasterID, err := c.userID(ctx, c.broadcaster)
+	if err != nil {
+		return fmt.Errorf("failed to resolve broadcaster %q: %w", c.broadcaster, err)
+	}
+	// Follow subscriptions need a moderator ID; use the token's own user
+	moderatorID, err := c.userID(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to resolve token user: %w", err)
+	}
+
+	conn, session, err := c.dial(ctx, c.wsURL)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+
+	subs := []subscription{
+		newSubscription("channel.follow", "2", map[string]string{
+			"broadcaster_user_id": broadcasterID,
+			"moderator_user_id":   moderatorID,
+		}),
+		newSubscription("channel.raid", "1", map[string]string{
+			"to_broadcaster_user_id": broadcasterID,
+		}),
+		newSubscription("channel.channel_points_custom_reward_redemption.add", "1", map[string]string{
+			"broadcaster_user_id": broadcasterID,
+		}),
+	}
+	for _, sub := range subs {
+		sub.Transport.SessionID = session.ID
+		if err := c.subscribe(ctx, sub); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", sub.Type, err)
+		}
+	}
+
+	keepalive := session.keepalive()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(keepalive))
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("read error: %w", err)
+		}
+
+		switch msg.Metadata.MessageType {
+		case "session_keepalive":
+			continue
+		case "session_reconnect":
+			// Subscriptions carry over to the new session; swap connections
+			// once the replacement has welcomed us.
+			newConn, newSession, err := c.dial(ctx, msg.Payload.Session.ReconnectURL)
+			if err != nil {
+				return fmt.Errorf("reconnect failed: %w", err)
+			}
+			conn.Close()
+			conn = newConn
+			keepalive = newSession.keepalive()
+			go func(conn *websocket.Conn) {
+				<-ctx.Done()
+				conn.Close()
+			}(conn)
+		case "revocation":
+			return fmt.Errorf("%w: %s revoked: %s", ErrSubscriptionRejected,
+				msg.Payload.Subscription.Type, msg.Payload.Subscription.Status)
+		case "notification":
+			if m, ok := c.notificationToMessage(msg); ok {
+				messages <- m
+			}
+		}
+	}
+}
+
+type session struct {
+	ID               string
+	keepaliveTimeout time.Duration
+}
+
+// keepalive is how long to wait for any frame before treating the
+// connection as dead: the advertised keepalive plus some slack.
+func (s session) keepalive() time.Duration {
+	return s.keepaliveTimeout + 5*time.Second
+}
+
+// dial connects to an EventSub WebSocket URL and waits for session_welcome.
+func (c *Client) dial(ctx context.Context, wsURL string) (*websocket.Conn, session, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return nil, session{}, fmt.Errorf("failed to connect to EventSub: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var welcome wsMessage
+	if err := conn.ReadJSON(&welcome); err != nil {
+		conn.Close()
+		return nil, session{}, fmt.Errorf("failed to read welcome: %w", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if welcome.Metadata.MessageType != "session_welcome" {
+		conn.Close()
+		return nil, session{}, fmt.Errorf("expected session_welcome, got %q", welcome.Metadata.MessageType)
+	}
+
+	keepalive := time.Duration(welcome.Payload.Session.KeepaliveTimeoutSeconds) * time.Second
+	if keepalive <= 0 {
+		keepalive = 10 * time.Second
+	}
+	return conn, session{ID: welcome.Payload.Session.ID, keepaliveTimeout: keepalive}, nil
+}
+
+func newSubscription(typ, version string, condition map[string]string) subscription {
+	sub := subscription{Type: typ, Version: version, Condition: condition}
+	sub.Transport.Method = "websocket"
+	return sub
+}
+
+func (c *Client) helixRequest(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.helixURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Client-Id", c.clientID)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.httpClient.Do(req)
+}
+
+// userID resolves a login to a Twitch user ID. An empty login resolves
+// the user that owns the access token.
+func (c *Client) userID(ctx context.Context, login string) (string, error) {
+	path := "/users"
+	if login != "" {
+		path += "?login=" + url.QueryEscape(login)
+	}
+
+	resp, err := c.helixRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", helixError(resp.StatusCode, nil)
+	}
+
+	var users struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return "", err
+	}
+	if len(users.Data) == 0 {
+		return "", fmt.Errorf("user not found")
+	}
+	return users.Data[0].ID, nil
+}
+
+func (c *Client) subscribe(ctx context.Context, sub subscription) error {
+	resp, err := c.helixRequest(ctx, http.MethodPost, "/eventsub/subscriptions", sub)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		// Any other refusal is of the subscription itself: a missing
+		// scope, or a condition Twitch won't accept
+		return helixError(resp.StatusCode, ErrSubscriptionRejected)
+	}
+	return nil
+}
+
+// helixError describes a Helix reply with an unexpected status, wrapping
+// ErrAuth or ErrRateLimit when the status says so, and otherwise refused
+// when set.
+func helixError(status int, refused error) error {
+	err := fmt.Errorf("Helix returned status %d", status)
+	switch {
+	case status == http.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", ErrAuth, err)
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
+	case refused != nil && status >= 400 && status < 500:
+		return fmt.Errorf("%w: %w", refused, err)
+	default:
+		return err
+	}
+}
+
+// CreateClip asks Twitch to clip the broadcaster's live stream and
+// returns the clip's edit URL. The token needs the clips:edit scope.
+func (c *Client) CreateClip(ctx context.Context) (string, error) {
+	broadcasterID, err := c.userID(ctx, c.broadcaster)
+	if err != nil {
+		return "", fmt.Errorf("resolving broadcaster %q: %w", c.broadcaster, err)
+	}
+
+	resp, err := c.helixRequest(ctx, http.MethodPost, "/clips?broadcaster_id="+url.QueryEscape(broadcasterID), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		// Twitch answers 404 for a channel that isn't live
+		if resp.StatusCode == http.StatusNotFound {
+			return "", helixError(resp.StatusCode, ErrNotLive)
+		}
+		return "", helixError(resp.StatusCode, nil)
+	}
+
+	var clips struct {
+		Data []struct {
+			ID      string `json:"id"`
+			EditURL string `json:"edit_url"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&clips); err != nil {
+		return "", err
+	}
+	if len(clips.Data) == 0 {
+		return "", fmt.Errorf("Helix returned no clip")
+	}
+	return clips.Data[0].EditURL, nil
+}
+
+// Profile looks up a Twitch account by user ID, or by login when id is
+// empty, for its creation date, avatar, and channel page.
+func (c *Client) Profile(ctx context.Context, id, login string) (message.Profile, error) {
+	path := "/users?login=" + url.QueryEscape(strings.ToLower(login))
+	if id != "" {
+		path = "/users?id=" + url.QueryEscape(id)
+	}
+	resp, err := c.helixRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return message.Profile{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return message.Profile{}, helixError(resp.StatusCode, nil)
+	}
+
+	var users struct {
+		Data []struct {
+			Login           string    `json:"login"`
+			CreatedAt       time.Time `json:"created_at"`
+			ProfileImageURL string    `json:"profile_image_url"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return message.Profile{}, err
+	}
+	if len(users.Data) == 0 {
+		return message.Profile{}, fmt.Errorf("user not found")
+	}
+	u := users.Data[0]
+	return message.Profile{
+		Created: u.CreatedAt,
+		Avatar:  u.ProfileImageURL,
+		URL:     "https://www.twitch.tv/" + u.Login,
+	}, nil
+}
+
+// notificationToMessage converts a notification frame into an event message.
+func (c *Client) notificationToMessage(msg wsMessage) (message.Message, bool) {
+	ts, err := time.Parse(time.RFC3339Nano, msg.Metadata.MessageTimestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	out := message.Message{
+		Platform:  message.Twitch,
+		ID:        cmp.Or(msg.Metadata.MessageID, message.NewID()),
+		Channel:   c.broadcaster,
+		Timestamp: ts,
+	}
+
+	switch msg.Metadata.SubscriptionType {
+	case "channel.follow":
+		var ev followEvent
+		if err := json.Unmarshal(msg.Payload.Event, &ev); err != nil {
+			return message.Message{}, false
+		}
+		out.Type = message.TypeFollow
+		out.Username = ev.UserName
+		out.Content = fmt.Sprintf("%s followed", ev.UserName)
+	case "channel.raid":
+		var ev raidEvent
+		if err := json.Unmarshal(msg.Payload.Event, &ev); err != nil {
+			return message.Message{}, false
+		}
+		out.Type = message.TypeRaid
+		out.Username = ev.FromBroadcasterUserName
+		out.Content = fmt.Sprintf("%s raided with %d viewers", ev.FromBroadcasterUserName, ev.Viewers)
+	case "channel.channel_points_custom_reward_redemption.add":
+		var ev redemptionEvent
+		if err := json.Unmarshal(msg.Payload.Event, &ev); err != nil {
+			return message.Message{}, false
+		}
+		out.Type = message.TypeRedemption
+		out.Username = ev.UserName
+		out.Content = fmt.Sprintf("%s redeemed %s (%d)", ev.UserName, ev.Reward.Title, ev.Reward.Cost)
+		if ev.UserInput != "" {
+			out.Content += ": " + ev.UserInput
+		}
+	default:
+		return message.Message{}, false
+	}
+
+	if c.keepRaw {
+		out.Raw = string(msg.Payload.Event)
+	}
+	return out, true
+}
@@ -0,0 +1,360 @@
+package twitcheventsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"relay/internal/message"
+)
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+func frame(msgType, subType, event string) map[string]any {
+	f := map[string]any{
+		"metadata": map[string]any{
+			"message_id":        "id-" + subType,
+			"message_type":      msgType,
+			"message_timestamp": "2025-06-15T10:30:00.123456789Z",
+			"subscription_type": subType,
+		},
+		"payload": map[string]any{},
+	}
+	if event != "" {
+		f["payload"] = map[string]any{"event": json.RawMessage(event)}
+	}
+	return f
+}
+
+func welcome(id string) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{"message_type": "session_welcome"},
+		"payload": map[string]any{
+			"session": map[string]any{"id": id, "keepalive_timeout_seconds": 10},
+		},
+	}
+}
+
+func TestConnectEmitsEvents(t *testing.T) {
+	var mu sync.Mutex
+	var subscribed []subscription
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/helix/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Client-Id") != "cid" || r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("missing Helix auth headers: %v", r.Header)
+		}
+		id := "999" // token owner
+		if r.URL.Query().Get("login") == "hackrtv" {
+			id = "123"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": id}}})
+	})
+	mux.HandleFunc("/helix/eventsub/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var sub subscription
+		json.NewDecoder(r.Body).Decode(&sub)
+		mu.Lock()
+		subscribed = append(subscribed, sub)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteJSON(welcome("session-1"))
+
+		// Give the client time to subscribe before sending notifications
+		time.Sleep(50 * time.Millisecond)
+
+		conn.WriteJSON(map[string]any{"metadata": map[string]any{"message_type": "session_keepalive"}})
+		conn.WriteJSON(frame("notification", "channel.follow", `{"user_name":"NewFan"}`))
+		conn.WriteJSON(frame("notification", "channel.raid", `{"from_broadcaster_user_name":"Raider","viewers":42}`))
+		conn.WriteJSON(frame("notification", "channel.channel_points_custom_reward_redemption.add",
+			`{"user_name":"Viewer","user_input":"play doom","reward":{"title":"Song request","cost":500}}`))
+		conn.WriteJSON(frame("notification", "channel.unknown", `{}`))
+
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient("cid", "oauth:tok", "hackrTV")
+	c.wsURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	c.helixURL = server.URL + "/helix"
+	c.httpClient = server.Client()
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.Connect(ctx, messages)
+	close(messages)
+
+	var received []message.Message
+	for msg := range messages {
+		received = append(received, msg)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("expected 3 events, got %d: %+v", len(received), received)
+	}
+
+	want := []struct {
+		typ     message.Type
+		user    string
+		content string
+	}{
+		{message.TypeFollow, "NewFan", "NewFan followed"},
+		{message.TypeRaid, "Raider", "Raider raided with 42 viewers"},
+		{message.TypeRedemption, "Viewer", "Viewer redeemed Song request (500): play doom"},
+	}
+	for i, w := range want {
+		got := received[i]
+		if got.Type != w.typ || got.Username != w.user || got.Content != w.content {
+			t.Errorf("event[%d] = %v %q %q, want %v %q %q", i, got.Type, got.Username, got.Content, w.typ, w.user, w.content)
+		}
+		if got.Platform != message.Twitch || got.Channel != "hackrtv" {
+			t.Errorf("event[%d] platform/channel = %v/%q", i, got.Platform, got.Channel)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(subscribed) != 3 {
+		t.Fatalf("expected 3 subscriptions, got %d", len(subscribed))
+	}
+	for _, sub := range subscribed {
+		if sub.Transport.Method != "websocket" || sub.Transport.SessionID != "session-1" {
+			t.Errorf("%s transport = %+v", sub.Type, sub.Transport)
+		}
+	}
+	if subscribed[0].Condition["broadcaster_user_id"] != "123" || subscribed[0].Condition["moderator_user_id"] != "999" {
+		t.Errorf("follow condition = %v", subscribed[0].Condition)
+	}
+}
+
+func TestKeepRaw(t *testing.T) {
+	const event = `{"user_name":"NewFan","followed_at":"2025-06-15T10:30:00Z"}`
+	data, _ := json.Marshal(frame("notification", "channel.follow", event))
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient("cid", "tok", "hackrtv")
+	if got, _ := c.notificationToMessage(msg); got.Raw != "" {
+		t.Errorf("Raw = %s before KeepRaw", got.Raw)
+	}
+	c.KeepRaw()
+	if got, _ := c.notificationToMessage(msg); got.Raw != event {
+		t.Errorf("Raw = %s, want the event's JSON %s", got.Raw, event)
+	}
+}
+
+func TestConnectReconnect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/helix/users", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "1"}}})
+	})
+	mux.HandleFunc("/helix/eventsub/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	var server *httptest.Server
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(welcome("old"))
+		time.Sleep(50 * time.Millisecond)
+
+		reconnectURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws2"
+		conn.WriteJSON(map[string]any{
+			"metadata": map[string]any{"message_type": "session_reconnect"},
+			"payload":  map[string]any{"session": map[string]any{"id": "old", "reconnect_url": reconnectURL}},
+		})
+		// Keep the old connection open until the client drops it
+		var discard any
+		conn.ReadJSON(&discard)
+	})
+	mux.HandleFunc("/ws2", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(welcome("new"))
+		conn.WriteJSON(frame("notification", "channel.follow", `{"user_name":"AfterReconnect"}`))
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient("cid", "tok", "chan")
+	c.wsURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	c.helixURL = server.URL + "/helix"
+	c.httpClient = server.Client()
+
+	messages := make(chan message.Message, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.Connect(ctx, messages)
+	close(messages)
+
+	var received []message.Message
+	for msg := range messages {
+		received = append(received, msg)
+	}
+	if len(received) != 1 || received[0].Username != "AfterReconnect" {
+		t.Errorf("expected event from reconnected session, got %+v", received)
+	}
+}
+
+func TestConnectSubscribeFailure(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/helix/users", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "1"}}})
+	})
+	mux.HandleFunc("/helix/eventsub/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(welcome("s"))
+		var discard any
+		conn.ReadJSON(&discard)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient("cid", "tok", "chan")
+	c.wsURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	c.helixURL = server.URL + "/helix"
+	c.httpClient = server.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Connect(ctx, make(chan message.Message, 1))
+	if !errors.Is(err, ErrSubscriptionRejected) || !strings.Contains(err.Error(), "channel.follow") {
+		t.Errorf("expected subscribe error naming channel.follow, got %v", err)
+	}
+}
+
+func TestConnectTokenRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := NewClient("cid", "expired", "chan")
+	c.helixURL = server.URL + "/helix"
+	c.httpClient = server.Client()
+
+	err := c.Connect(context.Background(), make(chan message.Message, 1))
+	if !errors.Is(err, ErrAuth) {
+		t.Errorf("Connect() = %v, want ErrAuth", err)
+	}
+}
+
+func TestCreateClip(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/helix/users", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "123"}}})
+	})
+	mux.HandleFunc("/helix/clips", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Query().Get("broadcaster_id") != "123" {
+			t.Errorf("unexpected clip request %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{
+			{"id": "Clip1", "edit_url": "https://clips.twitch.tv/Clip1/edit"},
+		}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient("cid", "tok", "hackrTV")
+	client.helixURL = server.URL + "/helix"
+
+	editURL, err := client.CreateClip(context.Background())
+	if err != nil {
+		t.Fatalf("CreateClip() error: %v", err)
+	}
+	if editURL != "https://clips.twitch.tv/Clip1/edit" {
+		t.Errorf("CreateClip() = %q", editURL)
+	}
+}
+
+func TestCreateClipOffline(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/helix/users", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": "123"}}})
+	})
+	mux.HandleFunc("/helix/clips", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient("cid", "tok", "hackrTV")
+	client.helixURL = server.URL + "/helix"
+
+	if _, err := client.CreateClip(context.Background()); !errors.Is(err, ErrNotLive) {
+		t.Errorf("CreateClip() = %v, want ErrNotLive", err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"data":[{"id":"12826","login":"twitch","created_at":"2007-05-22T10:39:54Z","profile_image_url":"https://static-cdn.jtvnw.net/twitch.png"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("cid", "tok", "hackrTV")
+	client.helixURL = server.URL
+
+	p, err := client.Profile(context.Background(), "12826", "Twitch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "id=12826" {
+		t.Errorf("query = %q, want a lookup by ID", query)
+	}
+	want := message.Profile{
+		Created: time.Date(2007, 5, 22, 10, 39, 54, 0, time.UTC),
+		Avatar:  "https://static-cdn.jtvnw.net/twitch.png",
+		URL:     "https://www.twitch.tv/twitch",
+	}
+	if !p.Created.Equal(want.Created) || p.Avatar != want.Avatar || p.URL != want.URL {
+		t.Errorf("Profile() = %+v, want %+v", p, want)
+	}
+
+	// Without an ID the login is looked up
+	client.Profile(context.Background(), "", "Twitch")
+	if query != "login=twitch" {
+		t.Errorf("query = %q, want a lookup by login", query)
+	}
+}
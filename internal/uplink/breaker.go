@@ -0,0 +1,146 @@
+package uplink
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultBreakerCooldown is how long an open breaker pauses sends unless
+// Options.BreakerCooldown says otherwise.
+const defaultBreakerCooldown = 30 * time.Second
+
+// defaultBreakerBuffer is the retry queue a breaker gets when
+// Options.RetryQueue doesn't give one, so messages held while it is open
+// aren't all lost.
+const defaultBreakerBuffer = 100
+
+// Circuit states reported in Stats.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// breaker is a circuit breaker for sends. After threshold failures in a
+// row it opens, and sends stop for cooldown. Then a single probe is let
+// through: success closes it, failure opens it for another cooldown.
+// Only opening and closing are logged, so an outage costs two lines of
+// stderr rather than one per message.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	// openUntil is when an open breaker lets a probe through; zero while
+	// closed.
+	openUntil time.Time
+	probing   bool
+	openedAt  time.Time
+	held      int
+}
+
+// newBreaker returns the breaker opts asks for, or nil.
+func newBreaker(opts Options) *breaker {
+	if opts.BreakerThreshold <= 0 {
+		return nil
+	}
+	cooldown := opts.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &breaker{threshold: opts.BreakerThreshold, cooldown: cooldown}
+}
+
+// allow reports whether a send may go out now. Once an open breaker's
+// cooldown has passed it allows one probe at a time. A nil breaker
+// allows everything.
+func (b *breaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return true
+	case b.probing || now.Before(b.openUntil):
+		return false
+	default:
+		b.probing = true
+		return true
+	}
+}
+
+// hold counts a message held back while the breaker is open.
+func (b *breaker) hold() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.held++
+}
+
+// until returns when an open breaker next allows a probe, or the zero
+// time when it is closed.
+func (b *breaker) until() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openUntil
+}
+
+// success records a send hackr.tv accepted, closing an open breaker.
+func (b *breaker) success(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if b.openUntil.IsZero() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Uplink circuit closed: hackr.tv is accepting messages again after %s; %d messages were held\n", now.Sub(b.openedAt).Round(time.Second), b.held)
+	b.openUntil, b.probing, b.held = time.Time{}, false, 0
+}
+
+// failure records a failed send. It reports whether the breaker is open
+// afterwards, so the caller knows not to log the failure itself.
+func (b *breaker) failure(now time.Time, err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	switch {
+	case b.probing:
+		b.probing = false
+		b.openUntil = now.Add(b.cooldown)
+		return true
+	case !b.openUntil.IsZero():
+		return true
+	case b.failures >= b.threshold:
+		b.openUntil, b.openedAt = now.Add(b.cooldown), now
+		fmt.Fprintf(os.Stderr, "Uplink circuit open after %d failed sends (%v); pausing sends, trying again every %s\n", b.failures, err, b.cooldown)
+		return true
+	}
+	return false
+}
+
+// state names the breaker's state for Stats.
+func (b *breaker) state(now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return circuitClosed
+	case b.probing || !now.Before(b.openUntil):
+		return circuitHalfOpen
+	default:
+		return circuitOpen
+	}
+}
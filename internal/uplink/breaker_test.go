@@ -0,0 +1,168 @@
+package uplink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+func TestBreakerStates(t *testing.T) {
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	b := newBreaker(Options{BreakerThreshold: 3})
+	errDown := errors.New("down")
+
+	b.failure(now, errDown)
+	b.failure(now, errDown)
+	if !b.allow(now) || b.state(now) != circuitClosed {
+		t.Fatal("breaker opened before the threshold")
+	}
+	if !b.failure(now, errDown) || b.allow(now) || b.state(now) != circuitOpen {
+		t.Fatal("breaker should open at the threshold")
+	}
+
+	// After the cooldown one probe goes through; a failed probe reopens
+	now = now.Add(defaultBreakerCooldown)
+	if !b.allow(now) {
+		t.Fatal("cooled-down breaker should allow a probe")
+	}
+	if b.allow(now) || b.state(now) != circuitHalfOpen {
+		t.Fatal("only one probe should be in flight")
+	}
+	b.failure(now, errDown)
+	if b.allow(now.Add(time.Second)) {
+		t.Fatal("failed probe should reopen the breaker")
+	}
+
+	now = now.Add(defaultBreakerCooldown)
+	if !b.allow(now) {
+		t.Fatal("cooled-down breaker should allow a probe")
+	}
+	b.success(now)
+	if !b.allow(now) || b.state(now) != circuitClosed {
+		t.Fatal("successful probe should close the breaker")
+	}
+	if b.failure(now, errDown) {
+		t.Fatal("closing should reset the failure count")
+	}
+}
+
+func TestBreakerHoldsMessages(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	opts := Options{Clock: fake, BreakerThreshold: 2, BreakerCooldown: 10 * time.Second}
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    opts,
+		retries: newRetries(opts),
+		breaker: newBreaker(opts),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := range 5 {
+		client.Handle(ctx, message.Message{Platform: message.Twitch, Username: "u", Content: "msg", ID: string(rune('a' + i))})
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("attempts = %d, want sends to stop once the breaker opened", n)
+	}
+	if s := client.Stats(); s.Circuit != circuitOpen || s.Retrying != 5 {
+		t.Errorf("Stats() = %+v, want an open circuit holding all 5 messages", s)
+	}
+
+	down.Store(false)
+	done := make(chan struct{})
+	go func() {
+		client.RunRetries(ctx)
+		close(done)
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(10 * time.Second)
+	for client.retries.len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := client.Stats(); s.Circuit != circuitClosed {
+		t.Errorf("Circuit = %q after the probe succeeded, want closed", s.Circuit)
+	}
+	if n := attempts.Load(); n != 7 {
+		t.Errorf("attempts = %d, want the 5 held messages sent once each", n)
+	}
+	cancel()
+	<-done
+}
+
+// downPerformer is a cable connection that fails while down is set.
+type downPerformer struct {
+	down     atomic.Bool
+	attempts atomic.Int32
+}
+
+func (p *downPerformer) Perform(ctx context.Context, action string, data map[string]any) error {
+	p.attempts.Add(1)
+	if p.down.Load() {
+		return errors.New("cable closed")
+	}
+	return nil
+}
+
+func TestBreakerHoldsMessagesUserMode(t *testing.T) {
+	cable := &downPerformer{}
+	cable.down.Store(true)
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	client := NewUserClient(cable, "live", Options{Clock: fake, BreakerThreshold: 2, BreakerCooldown: 10 * time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := range 4 {
+		client.Handle(ctx, message.Message{Platform: message.YouTube, Username: "u", Content: "msg", ID: string(rune('a' + i))})
+	}
+	if s := client.Stats(); s.Circuit != circuitOpen || s.Retrying != 4 {
+		t.Errorf("Stats() = %+v, want an open circuit holding all 4 messages", s)
+	}
+
+	// Once the cable is back, the held messages go out over it
+	cable.down.Store(false)
+	done := make(chan struct{})
+	go func() {
+		client.RunRetries(ctx)
+		close(done)
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(10 * time.Second)
+	for client.retries.len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := client.Stats(); s.Circuit != circuitClosed {
+		t.Errorf("Circuit = %q after the probe succeeded, want closed", s.Circuit)
+	}
+	if n := cable.attempts.Load(); n != 6 {
+		t.Errorf("attempts = %d, want the 4 held messages sent once each", n)
+	}
+	cancel()
+	<-done
+}
@@ -2,34 +2,214 @@ package uplink
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"relay/internal/clock"
+	"relay/internal/echo"
 	"relay/internal/message"
+	"relay/internal/retention"
 )
 
-// ErrRateLimit is returned when the Uplink API responds with 429.
-var ErrRateLimit = errors.New("uplink: rate limited")
+var (
+	// ErrRateLimit is returned when the Uplink API responds with 429.
+	ErrRateLimit = errors.New("uplink: rate limited")
+	// ErrAuth is returned when the Uplink API refuses the token with a
+	// 401 or 403.
+	ErrAuth = errors.New("uplink: token refused")
+	// ErrNoDrop is returned by Drop when hackr.tv has no way to remove
+	// packets through the Uplink API.
+	ErrNoDrop = errors.New("uplink: dropping packets not supported")
+)
+
+// suppressWindow is how long a moderator deletion keeps matching messages
+// that are still queued for the bridge, and how long a bridged message
+// can still be retracted by one.
+const suppressWindow = time.Minute
+
+// rateLimitBackoff is how long Run waits after a 429, and retryBackoff the
+// base delay between strict-mode retries of a failed send. They are
+// variables so tests can shorten them.
+var (
+	rateLimitBackoff = 2 * time.Second
+	retryBackoff     = time.Second
+)
+
+// dryRunOutput receives the messages a DryRun client would have sent,
+// or stderr as it is at the time when nil. It is a variable so tests can
+// capture them.
+var dryRunOutput io.Writer
+
+// DefaultMaxLength is the longest content sent to hackr.tv, in bytes,
+// unless Options.MaxLength says otherwise.
+const DefaultMaxLength = 512
+
+// DefaultSendTimeout bounds each send unless Options.SendTimeout says
+// otherwise.
+const DefaultSendTimeout = 10 * time.Second
+
+// ellipsis ends truncated content.
+const ellipsis = "…"
+
+// strictAttempts caps how often strict mode tries a message that fails
+// for reasons other than rate limiting before skipping it.
+const strictAttempts = 3
+
+// Options configures bridge delivery.
+type Options struct {
+	// StrictOrder guarantees messages reach hackr.tv in the order they
+	// were received: a message that is rate limited or fails is retried
+	// before anything after it is sent, and sends are never concurrent.
+	// This trades throughput for intact back-and-forth conversations.
+	// By default a rate-limited message is dropped and the bridge moves on.
+	StrictOrder bool
+	// Clock paces backoff and expires deletion suppressions. Defaults to
+	// the wall clock.
+	Clock clock.Clock
+	// SlowMode bridges at most one chat message per user per interval.
+	// Held messages are summarized as "+3 more from user" once the
+	// interval has passed. Events and paid messages are never held.
+	// Zero disables it.
+	SlowMode time.Duration
+	// Template formats bridged messages. Defaults to DefaultTemplate.
+	Template *Template
+	// MaxLength caps the content of each message, in bytes, cutting
+	// longer ones at a character boundary and ending them with "…".
+	// Defaults to DefaultMaxLength.
+	MaxLength int
+	// RetryQueue keeps up to this many messages whose send failed, or
+	// that were handed to Queue, and retries them with exponential
+	// backoff from RunRetries. In strict mode a message is queued once
+	// its attempts run out. Rate-limited messages are not queued. When
+	// the queue is full the oldest message is dropped. Zero disables it,
+	// and failed messages are lost.
+	RetryQueue int
+	// Workers is how many messages Run sends at once. Each sender's
+	// messages always go to the same worker, so they still arrive in the
+	// order they were said. StrictOrder needs a single worker. Defaults
+	// to 1.
+	Workers int
+	// Rate caps sends at this many messages per second with a token
+	// bucket, so the bridge stays under hackr.tv's rate limit instead of
+	// running into 429s. Messages over the rate wait their turn. Zero
+	// disables it.
+	Rate float64
+	// Burst is how many messages may go out at once after a quiet spell
+	// before Rate applies. Defaults to 1.
+	Burst int
+	// SpillFile, with RetryQueue, is a JSON-lines file that takes the
+	// messages that don't fit in the queue. Messages still queued at
+	// shutdown are saved to it, and it is drained on the next start.
+	SpillFile string
+	// BreakerThreshold opens a circuit breaker after this many sends in
+	// a row fail, other than for rate limiting: sends then pause for
+	// BreakerCooldown before a single probe is tried, and messages are
+	// held in the retry queue meanwhile, which gets room for 100 when
+	// RetryQueue is zero. Opening and closing are logged once each
+	// instead of every failure. Zero disables it.
+	BreakerThreshold int
+	// BreakerCooldown defaults to 30s.
+	BreakerCooldown time.Duration
+	// SpillRetention bounds the spill file by message age and file size,
+	// dropping the oldest messages. The zero value keeps everything.
+	SpillRetention retention.Policy
+	// Echoes, when set, records the ID of every packet the Uplink API
+	// creates, so the hackr.tv client can drop the bridge's own messages
+	// when they are broadcast back. Clients made with NewUserClient
+	// learn no IDs.
+	Echoes *echo.Set
+	// DryRun logs each message as it would be sent, to stderr, instead
+	// of sending it. Slow mode, rate limiting, the template, and the
+	// length limit all still apply, so the log shows what hackr.tv would.
+	DryRun bool
+	// SendTimeout bounds each send, over the Uplink API or the cable, so
+	// a request hackr.tv never answers fails and frees its worker.
+	// Defaults to DefaultSendTimeout.
+	SendTimeout time.Duration
+}
+
+// Performer invokes an ActionCable action on an authenticated hackr.tv
+// cable connection. It is satisfied by *hackrtv.Client.
+type Performer interface {
+	Perform(ctx context.Context, action string, data map[string]any) error
+}
 
-// Client sends chat messages to hackr.tv via the Admin Uplink API.
+// Client sends chat messages to hackr.tv, either via the Admin Uplink API
+// or, for non-admin hackrs, as a regular packet over the cable connection.
 type Client struct {
 	baseURL string
 	token   string
 	channel string
 	http    *http.Client
+	cable   Performer
+	opts    Options
+
+	// suppressed holds deleted message IDs ("id:...") and timed-out or
+	// banned users ("user:...", see userKey) with the time the
+	// suppression expires.
+	// mu guards it so several Handle calls may run at once.
+	mu         sync.Mutex
+	suppressed map[string]time.Time
+	// sent maps the IDs of messages bridged through the Uplink API in
+	// the last suppressWindow to their packets, so a deletion arriving
+	// after the send can drop them. mu guards it.
+	sent map[string]sentPacket
+	// noDrop is set once hackr.tv has answered that it can't drop
+	// packets, so later deletions don't ask again.
+	noDrop atomic.Bool
+	// slow tracks each user's last bridged message under SlowMode,
+	// keyed by platform and lowercased username. mu guards it.
+	slow map[string]*slowEntry
+	// retries is the retry queue, or nil without Options.RetryQueue.
+	retries *retryQueue
+	// limit paces sends, or is nil without Options.Rate.
+	limit *limiter
+	// breaker pauses sends while hackr.tv is down, or is nil without
+	// Options.BreakerThreshold.
+	breaker *breaker
+	// queued counts messages handed to Run's workers and not yet
+	// picked up.
+	queued atomic.Int64
+}
+
+// sentPacket is a bridged message's hackr.tv packet, with where the
+// message came from so a ban on one platform retracts only its own.
+type sentPacket struct {
+	packetID string
+	platform message.Platform
+	channel  string
+	username string
+	until    time.Time
+}
+
+// slowEntry is a user's slow-mode state: when their last message was
+// bridged, and how many have been held since.
+type slowEntry struct {
+	last time.Time
+	held int
+	// from is the user's last bridged message, which names the platform,
+	// channel, and user for the summary.
+	from message.Message
 }
 
 // NewClient creates an Uplink API client.
 // wsURL is the ActionCable WebSocket URL (e.g. wss://hackr.tv/cable).
 // token is the per-hackr API token, alias is the hackr alias.
 // channel is the chat channel slug.
-func NewClient(wsURL, token, alias, channel string) (*Client, error) {
+func NewClient(wsURL, token, alias, channel string, opts Options) (*Client, error) {
 	base, err := deriveBaseURL(wsURL)
 	if err != nil {
 		return nil, fmt.Errorf("uplink: %w", err)
@@ -39,10 +219,28 @@ func NewClient(wsURL, token, alias, channel string) (*Client, error) {
 		baseURL: base,
 		token:   alias + ":" + token,
 		channel: channel,
-		http:    &http.Client{Timeout: 10 * time.Second},
+		http:    &http.Client{},
+		opts:    opts,
+		retries: newRetries(opts),
+		limit:   newLimiter(opts),
+		breaker: newBreaker(opts),
 	}, nil
 }
 
+// NewUserClient creates a client that posts as a regular authenticated
+// hackr by performing the send_packet action over an existing cable
+// connection, for operators without an admin token.
+func NewUserClient(cable Performer, channel string, opts Options) *Client {
+	return &Client{
+		channel: channel,
+		cable:   cable,
+		opts:    opts,
+		retries: newRetries(opts),
+		limit:   newLimiter(opts),
+		breaker: newBreaker(opts),
+	}
+}
+
 // deriveBaseURL converts a WebSocket URL to an HTTP base URL.
 // ws://host:port/cable → http://host:port
 // wss://host:port/cable → https://host:port
@@ -67,61 +265,333 @@ func deriveBaseURL(wsURL string) (string, error) {
 	return u.String(), nil
 }
 
-// FormatContent formats a message for the Uplink API.
-// Format: "[TTV] nightbot: !commands" — truncated to 512 chars.
+// FormatContent formats a message for the Uplink API with
+// DefaultTemplate.
+// Format: "[TTV] nightbot: !commands" — truncated to 512 bytes.
+// Events already name the user in their content: "[TTV] ★ bob subscribed".
+// Monetised messages carry their amount: "[TTV] ◆ 100 bits bob: Cheer100".
 func FormatContent(msg message.Message) string {
-	s := fmt.Sprintf("[%s] %s: %s", msg.Platform, msg.Username, msg.Content)
-	if len(s) > 512 {
-		s = s[:512]
+	return Truncate(defaultTemplate.Format(msg), DefaultMaxLength)
+}
+
+// formatContent formats msg with the client's template and length limit.
+func (c *Client) formatContent(msg message.Message) string {
+	tmpl := c.opts.Template
+	if tmpl == nil {
+		tmpl = defaultTemplate
+	}
+	return Truncate(tmpl.Format(msg), c.maxLength())
+}
+
+// Truncate shortens s to at most max bytes, ending it with an ellipsis.
+// It cuts on a character boundary so the result stays valid UTF-8.
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	tail := ellipsis
+	if max < 2*len(ellipsis) {
+		tail = ""
+	}
+	cut := max - len(tail)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
 	}
-	return s
+	return s[:cut] + tail
+}
+
+// FormatOutbound formats hackr.tv chat for posting to Twitch or YouTube:
+// "[HTV] xeraen: hello". prefix replaces the "[HTV]" label when set.
+func FormatOutbound(msg message.Message, prefix string) string {
+	if prefix == "" {
+		prefix = "[" + msg.Platform.String() + "]"
+	}
+	return fmt.Sprintf("%s %s: %s", prefix, msg.Username, msg.Content)
 }
 
 type sendPayload struct {
-	ChannelSlug string `json:"channel_slug"`
-	Content     string `json:"content"`
-	Source      string `json:"source,omitempty"`
+	ChannelSlug   string `json:"channel_slug"`
+	Content       string `json:"content"`
+	Source        string `json:"source,omitempty"`
+	SourceChannel string `json:"source_channel,omitempty"`
 }
 
-// Send posts a single message to the Uplink API.
+// Send posts a single message to hackr.tv, over the cable connection for
+// clients made with NewUserClient and the Uplink API otherwise, giving
+// up after Options.SendTimeout. With Options.DryRun it only logs the
+// message.
 func (c *Client) Send(ctx context.Context, msg message.Message) error {
+	_, err := c.send(ctx, msg)
+	return err
+}
+
+// send is Send, also returning the ID of the packet created over the
+// Uplink API, or "" when there is none.
+func (c *Client) send(ctx context.Context, msg message.Message) (string, error) {
+	if c.opts.DryRun {
+		out := dryRunOutput
+		if out == nil {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, "Bridge dry run → hackr.tv #%s: %s\n", c.channel, c.formatContent(msg))
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(c.opts.SendTimeout, DefaultSendTimeout))
+	defer cancel()
+	if c.cable != nil {
+		data := map[string]any{
+			"content": c.formatContent(msg),
+			"source":  msg.Platform.String(),
+		}
+		if msg.Channel != "" {
+			data["source_channel"] = msg.Channel
+		}
+		return "", c.cable.Perform(ctx, "send_packet", data)
+	}
+	return c.post(ctx, msg)
+}
+
+// Post sends msg over the Uplink API like Send, but returns the ID of the
+// packet it created, or "" when hackr.tv doesn't report it, so a test
+// message can be dropped again. It ignores Options.DryRun and needs a
+// client made with NewClient.
+func (c *Client) Post(ctx context.Context, msg message.Message) (string, error) {
+	if c.cable != nil {
+		return "", errors.New("uplink: Post needs the Uplink API, not a user client")
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(c.opts.SendTimeout, DefaultSendTimeout))
+	defer cancel()
+	return c.post(ctx, msg)
+}
+
+// post sends msg through the Uplink API's send_packet endpoint.
+func (c *Client) post(ctx context.Context, msg message.Message) (string, error) {
 	body, err := json.Marshal(sendPayload{
-		ChannelSlug: c.channel,
-		Content:     FormatContent(msg),
-		Source:      msg.Platform.String(),
+		ChannelSlug:   c.channel,
+		Content:       c.formatContent(msg),
+		Source:        msg.Platform.String(),
+		SourceChannel: msg.Channel,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
 		c.baseURL+"/api/admin/uplink/send_packet", bytes.NewReader(body))
 	if err != nil {
-		return err
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
+	done := c.opts.Echoes.Begin()
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return err
+		done("", false)
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	switch {
 	case resp.StatusCode == http.StatusCreated:
-		return nil
+		id := packetID(resp.Body)
+		done(id, true)
+		return id, nil
 	case resp.StatusCode == http.StatusTooManyRequests:
-		return ErrRateLimit
+		done("", false)
+		return "", ErrRateLimit
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		done("", false)
+		return "", fmt.Errorf("%w (status %d)", ErrAuth, resp.StatusCode)
+	default:
+		done("", false)
+		return "", fmt.Errorf("uplink: unexpected status %d", resp.StatusCode)
+	}
+}
+
+// Drop removes a packet through the Uplink API's drop_packet endpoint,
+// as a moderator would, e.g. a test message made with Post. Servers
+// without the endpoint answer 404, returned as ErrNoDrop.
+func (c *Client) Drop(ctx context.Context, id string) error {
+	if c.cable != nil {
+		return errors.New("uplink: Drop needs the Uplink API, not a user client")
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(c.opts.SendTimeout, DefaultSendTimeout))
+	defer cancel()
+	body, err := json.Marshal(map[string]string{"channel_slug": c.channel, "packet_id": id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.baseURL+"/api/admin/uplink/drop_packet", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return ErrNoDrop
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w (status %d)", ErrAuth, resp.StatusCode)
 	default:
 		return fmt.Errorf("uplink: unexpected status %d", resp.StatusCode)
 	}
 }
 
-// Run reads messages from the channel and sends each to the Uplink API.
-// On rate limiting it backs off for 2 seconds. Stops when ctx is cancelled
-// or the channel is closed.
+// packetID reads the ID of the created packet from a send_packet
+// response, {"packet": {"id": 123, ...}} or {"id": 123, ...}. It returns
+// "" when the response doesn't carry one.
+func packetID(body io.Reader) string {
+	var resp struct {
+		ID     json.RawMessage `json:"id"`
+		Packet struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"packet"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 1<<16)).Decode(&resp); err != nil {
+		return ""
+	}
+	id := resp.Packet.ID
+	if len(id) == 0 {
+		id = resp.ID
+	}
+	if s := strings.Trim(string(id), `"`); s != "null" {
+		return s
+	}
+	return ""
+}
+
+// suppress records a moderator deletion so queued messages it covers are
+// never bridged. A deletion with a TargetID covers that message; one
+// without covers everything from the user.
+func (c *Client) suppress(del message.Message, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.suppressed == nil {
+		c.suppressed = make(map[string]time.Time)
+	}
+	for k, until := range c.suppressed {
+		if now.After(until) {
+			delete(c.suppressed, k)
+		}
+	}
+	switch {
+	case del.TargetID != "":
+		c.suppressed["id:"+del.TargetID] = now.Add(suppressWindow)
+	case del.Username != "":
+		c.suppressed[userKey(del)] = now.Add(suppressWindow)
+	}
+}
+
+// userKey is the suppression key for msg's sender. A ban or timeout only
+// covers the user on the platform and channel it came from, as the same
+// name elsewhere may be someone else.
+func userKey(msg message.Message) string {
+	return "user:" + msg.Platform.Key() + ":" + msg.Channel + ":" + strings.ToLower(msg.Username)
+}
+
+// remember records the packet a message was bridged as, for retract.
+func (c *Client) remember(msg message.Message, packetID string, now time.Time) {
+	if msg.ID == "" || packetID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sent == nil {
+		c.sent = make(map[string]sentPacket)
+	}
+	for k, p := range c.sent {
+		if now.After(p.until) {
+			delete(c.sent, k)
+		}
+	}
+	c.sent[msg.ID] = sentPacket{
+		packetID: packetID,
+		platform: msg.Platform,
+		channel:  msg.Channel,
+		username: msg.Username,
+		until:    now.Add(suppressWindow),
+	}
+}
+
+// retract drops the packets of messages a moderator deleted after they
+// were bridged: the deletion's target, or everything bridged from the
+// user on that platform and channel in the last suppressWindow for a ban
+// or timeout. Only clients made with NewClient learn packet IDs, so user
+// clients retract nothing.
+func (c *Client) retract(ctx context.Context, del message.Message, now time.Time) {
+	if c.noDrop.Load() {
+		return
+	}
+	var packets []string
+	c.mu.Lock()
+	for k, p := range c.sent {
+		if now.After(p.until) {
+			delete(c.sent, k)
+			continue
+		}
+		if p.platform != del.Platform {
+			continue
+		}
+		if k == del.TargetID || del.TargetID == "" && del.Username != "" && p.channel == del.Channel && strings.EqualFold(p.username, del.Username) {
+			packets = append(packets, p.packetID)
+			delete(c.sent, k)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, id := range packets {
+		err := c.Drop(ctx, id)
+		if errors.Is(err, ErrNoDrop) {
+			c.noDrop.Store(true)
+			fmt.Fprintln(os.Stderr, "Uplink: hackr.tv can't drop packets, so deleted messages already bridged stay up")
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Uplink drop error: %v\n", err)
+		}
+	}
+}
+
+// isSuppressed reports whether msg was deleted before it could be sent.
+func (c *Client) isSuppressed(msg message.Message, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := []string{userKey(msg)}
+	if msg.ID != "" {
+		keys = append(keys, "id:"+msg.ID)
+	}
+	for _, k := range keys {
+		if until, ok := c.suppressed[k]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run reads messages from the channel and sends each to the Uplink API,
+// no faster than Options.Rate allows. On rate limiting it backs off for
+// 2 seconds; see Options.StrictOrder for whether the limited message is
+// retried. Moderator deletions are not forwarded; instead they suppress
+// matching messages still in the queue and retract ones already sent.
+// With Options.Workers above 1 messages are sent in parallel, see
+// runPool. Stops when ctx is cancelled or the channel is closed, after
+// the workers have sent what they were handed.
 func (c *Client) Run(ctx context.Context, messages <-chan message.Message) {
+	if c.opts.Workers > 1 {
+		c.runPool(ctx, messages)
+		return
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -130,23 +600,163 @@ func (c *Client) Run(ctx context.Context, messages <-chan message.Message) {
 			if !ok {
 				return
 			}
-			err := c.Send(ctx, msg)
-			if err == nil {
-				continue
+			if !c.Handle(ctx, msg) {
+				return
 			}
-			if errors.Is(err, ErrRateLimit) {
-				fmt.Fprintln(os.Stderr, "Uplink rate limited, backing off 2s")
-				select {
-				case <-time.After(2 * time.Second):
-				case <-ctx.Done():
-					return
-				}
-				continue
+		}
+	}
+}
+
+// Handle bridges one message as Run would: deletions suppress matching
+// messages and retract those already bridged, suppressed messages are
+// skipped, slow mode holds chat from users bridged too recently, and
+// others are sent after any slow-mode summaries that have come due. It is
+// safe to call concurrently, though that gives up StrictOrder. It returns
+// false if ctx was cancelled.
+func (c *Client) Handle(ctx context.Context, msg message.Message) bool {
+	if msg.Type == message.TypeDeletion {
+		c.suppress(msg, c.clock().Now())
+		c.retract(ctx, msg, c.clock().Now())
+		return ctx.Err() == nil
+	}
+	now := c.clock().Now()
+	if c.isSuppressed(msg, now) {
+		return true
+	}
+	for _, summary := range c.dueSummaries(now) {
+		if !c.deliver(ctx, summary) {
+			return false
+		}
+	}
+	if !c.allow(msg, now) {
+		return true
+	}
+	return c.deliver(ctx, msg)
+}
+
+// allow applies slow mode, reporting false if msg should be held because
+// its sender was bridged less than SlowMode ago.
+func (c *Client) allow(msg message.Message, now time.Time) bool {
+	if c.opts.SlowMode <= 0 || msg.IsEvent() || !msg.Amount.IsZero() {
+		return true
+	}
+	key := msg.Platform.Key() + ":" + strings.ToLower(msg.Username)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.slow == nil {
+		c.slow = make(map[string]*slowEntry)
+	}
+	if e, ok := c.slow[key]; ok && now.Sub(e.last) < c.opts.SlowMode {
+		e.held++
+		return false
+	}
+	c.slow[key] = &slowEntry{last: now, from: msg}
+	return true
+}
+
+// dueSummaries returns a "+N more" message for each user whose slow-mode
+// interval has passed with messages held, oldest first, and forgets users
+// who have been quiet for a full interval. Summaries go out with the
+// next message bridged, so they wait while chat is idle.
+func (c *Client) dueSummaries(now time.Time) []message.Message {
+	if c.opts.SlowMode <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var due []*slowEntry
+	for key, e := range c.slow {
+		if now.Sub(e.last) < c.opts.SlowMode {
+			continue
+		}
+		if e.held > 0 {
+			due = append(due, e)
+		}
+		delete(c.slow, key)
+	}
+	slices.SortFunc(due, func(a, b *slowEntry) int { return a.last.Compare(b.last) })
+
+	summaries := make([]message.Message, 0, len(due))
+	for _, e := range due {
+		summaries = append(summaries, message.Message{
+			Platform:  e.from.Platform,
+			Type:      message.TypeSystem,
+			ID:        message.NewID(),
+			Channel:   e.from.Channel,
+			Username:  e.from.Username,
+			Timestamp: now,
+			Content:   fmt.Sprintf("+%d more from %s", e.held, e.from.Username),
+		})
+	}
+	return summaries
+}
+
+// maxLength returns the configured content limit, or the default.
+func (c *Client) maxLength() int {
+	if c.opts.MaxLength > 0 {
+		return c.opts.MaxLength
+	}
+	return DefaultMaxLength
+}
+
+// clock returns the configured clock, or the wall clock.
+func (c *Client) clock() clock.Clock {
+	return clock.Or(c.opts.Clock)
+}
+
+// deliver sends msg once the rate limiter allows, backing off if hackr.tv
+// rate limits it anyway. In strict mode it keeps retrying until the
+// message is sent or strictAttempts non-rate-limit failures occur, so
+// later messages cannot overtake it. A message that fails for good goes
+// to the retry queue, if any. It returns false if ctx was cancelled.
+func (c *Client) deliver(ctx context.Context, msg message.Message) bool {
+	failures := 0
+	for {
+		// While hackr.tv is down, hold messages without trying them
+		if !c.breaker.allow(c.clock().Now()) {
+			c.breaker.hold()
+			c.Queue(msg)
+			return true
+		}
+		if !c.limit.wait(ctx, c.clock()) {
+			return false
+		}
+		id, err := c.send(ctx, msg)
+		if err == nil {
+			c.breaker.success(c.clock().Now())
+			c.remember(msg, id, c.clock().Now())
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		wait := rateLimitBackoff
+		if errors.Is(err, ErrRateLimit) {
+			// A 429 means hackr.tv is up
+			c.breaker.success(c.clock().Now())
+			fmt.Fprintf(os.Stderr, "Uplink rate limited, backing off %s\n", wait)
+		} else {
+			open := c.breaker.failure(c.clock().Now(), err)
+			if !open {
+				fmt.Fprintf(os.Stderr, "Uplink send error: %v\n", err)
 			}
-			if ctx.Err() != nil {
-				return
+			failures++
+			if open || !c.opts.StrictOrder || failures >= strictAttempts {
+				c.Queue(msg)
+				return true
 			}
-			fmt.Fprintf(os.Stderr, "Uplink send error: %v\n", err)
+			wait = time.Duration(failures) * retryBackoff
+		}
+
+		select {
+		case <-c.clock().After(wait):
+		case <-ctx.Done():
+			return false
+		}
+		if !c.opts.StrictOrder {
+			return true
 		}
 	}
 }
@@ -3,15 +3,23 @@ package uplink
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"relay/internal/clock"
+	"relay/internal/echo"
 	"relay/internal/message"
+	"relay/internal/relaytest"
 )
 
 func TestDeriveBaseURL(t *testing.T) {
@@ -91,6 +99,36 @@ func TestFormatContent(t *testing.T) {
 			},
 			want: "[YT_] viewer: hello world",
 		},
+		{
+			name: "sub event",
+			msg: message.Message{
+				Platform: message.Twitch,
+				Type:     message.TypeSub,
+				Username: "bob",
+				Content:  "bob subscribed at Tier 1.",
+			},
+			want: "[TTV] ★ bob subscribed at Tier 1.",
+		},
+		{
+			name: "cheer",
+			msg: message.Message{
+				Platform: message.Twitch,
+				Username: "bob",
+				Content:  "Cheer100 gg",
+				Amount:   message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"},
+			},
+			want: "[TTV] ◆ 100 bits bob: Cheer100 gg",
+		},
+		{
+			name: "super sticker",
+			msg: message.Message{
+				Platform: message.YouTube,
+				Username: "Fan",
+				Content:  "[sticker] Dancing cat",
+				Amount:   message.Amount{Value: 1.99, Currency: "EUR", Display: "€1.99"},
+			},
+			want: "[YT_] ◆ €1.99 Fan: [sticker] Dancing cat",
+		},
 		{
 			name: "truncation at 512 chars",
 			msg: message.Message{
@@ -105,8 +143,8 @@ func TestFormatContent(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			got := FormatContent(tt.msg)
 			if tt.name == "truncation at 512 chars" {
-				if len(got) != 512 {
-					t.Errorf("len = %d, want 512", len(got))
+				if len(got) != 512 || !strings.HasSuffix(got, "…") {
+					t.Errorf("len = %d, want 512 ending in an ellipsis", len(got))
 				}
 				return
 			}
@@ -117,6 +155,49 @@ func TestFormatContent(t *testing.T) {
 	}
 }
 
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"fits", "héllo", 6, "héllo"},
+		{"ascii", "hello world", 8, "hello…"},
+		{"rune boundary", "ab€€€", 9, "ab€…"},
+		{"emoji", "😀😀😀", 10, "😀…"},
+		{"tiny limit", "€€€", 4, "€"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.s, tt.max)
+			if got != tt.want || !utf8.ValidString(got) || len(got) > tt.max {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendMaxLength(t *testing.T) {
+	cable := &fakePerformer{}
+	client := NewUserClient(cable, "live", Options{MaxLength: 20})
+	client.Send(context.Background(), message.Message{Platform: message.Twitch, Username: "u", Content: "ünïcödé everywhere"})
+	got, _ := cable.data["content"].(string)
+	if got != "[TTV] u: ünïcö…" {
+		t.Errorf("content = %q, want it cut to 20 bytes", got)
+	}
+}
+
+func TestFormatOutbound(t *testing.T) {
+	msg := message.Message{Platform: message.HackrTV, Username: "xeraen", Content: "welcome"}
+	if got := FormatOutbound(msg, ""); got != "[HTV] xeraen: welcome" {
+		t.Errorf("FormatOutbound() = %q", got)
+	}
+	if got := FormatOutbound(msg, "📡"); got != "📡 xeraen: welcome" {
+		t.Errorf("FormatOutbound() with prefix = %q", got)
+	}
+}
+
 func TestSendSuccess(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Verify method and path
@@ -150,6 +231,9 @@ func TestSendSuccess(t *testing.T) {
 		if !strings.Contains(payload.Content, "[TTV]") {
 			t.Errorf("content missing [TTV] prefix: %q", payload.Content)
 		}
+		if payload.SourceChannel != "xqc" {
+			t.Errorf("source_channel = %q, want %q", payload.SourceChannel, "xqc")
+		}
 
 		w.WriteHeader(http.StatusCreated)
 	}))
@@ -164,6 +248,7 @@ func TestSendSuccess(t *testing.T) {
 
 	msg := message.Message{
 		Platform:  message.Twitch,
+		Channel:   "xqc",
 		Username:  "nightbot",
 		Content:   "!commands",
 		Timestamp: time.Now(),
@@ -175,6 +260,147 @@ func TestSendSuccess(t *testing.T) {
 	}
 }
 
+// hangingServer accepts sends and never answers them.
+func hangingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request ends when the client hangs up, once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSendTimeout(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	server := hangingServer(t)
+	client := &Client{baseURL: server.URL, channel: "live", http: server.Client(), opts: Options{SendTimeout: 50 * time.Millisecond}}
+	t.Cleanup(server.Client().CloseIdleConnections)
+
+	start := time.Now()
+	if err := client.Send(context.Background(), message.Message{Platform: message.Twitch, Content: "hi"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() = %v, want context.DeadlineExceeded", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Send() took %s with a 50ms timeout", took)
+	}
+
+	// Over the cable too
+	cable := NewUserClient(stalledPerformer{}, "live", Options{SendTimeout: 50 * time.Millisecond})
+	if err := cable.Send(context.Background(), message.Message{Platform: message.Twitch, Content: "hi"}); err != context.DeadlineExceeded {
+		t.Errorf("cable Send() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// stalledPerformer never finishes a Perform before its context ends.
+type stalledPerformer struct{}
+
+func (stalledPerformer) Perform(ctx context.Context, action string, data map[string]any) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunStopsMidSend(t *testing.T) {
+	relaytest.NoLeaks(t, time.Second)
+	server := hangingServer(t)
+	client := &Client{baseURL: server.URL, channel: "live", http: server.Client(), opts: Options{SendTimeout: time.Minute}}
+	t.Cleanup(server.Client().CloseIdleConnections)
+
+	messages := make(chan message.Message, 1)
+	messages <- message.Message{Platform: message.Twitch, Content: "hi"}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Run(ctx, messages)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() still waiting on a send after cancel")
+	}
+}
+
+func TestSendRecordsPacketID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"packet":{"id":123,"content":"[TTV] viewer: hi"}}`)
+	}))
+	defer server.Close()
+
+	echoes := echo.New()
+	client := &Client{
+		baseURL: server.URL,
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{Echoes: echoes},
+	}
+	if err := client.Send(context.Background(), message.Message{Platform: message.Twitch, Username: "viewer", Content: "hi"}); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if !echoes.Echo("123", 0) || echoes.Unreported() {
+		t.Error("the created packet's ID was not recorded")
+	}
+}
+
+func TestPostAndDrop(t *testing.T) {
+	var dropped map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/admin/uplink/send_packet":
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"packet":{"id":77}}`)
+		case "/api/admin/uplink/drop_packet":
+			json.NewDecoder(r.Body).Decode(&dropped)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("ws"+strings.TrimPrefix(server.URL, "http")+"/cable", "token", "relay", "live", Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := client.Post(context.Background(), message.Message{Platform: message.Relay, Username: "relay", Content: "test"})
+	if err != nil || id != "77" {
+		t.Fatalf("Post() = %q, %v", id, err)
+	}
+	if err := client.Drop(context.Background(), id); err != nil {
+		t.Fatalf("Drop() = %v", err)
+	}
+	if dropped["packet_id"] != "77" || dropped["channel_slug"] != "live" {
+		t.Errorf("drop_packet got %v", dropped)
+	}
+
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	client, _ = NewClient("ws"+strings.TrimPrefix(old.URL, "http")+"/cable", "token", "relay", "live", Options{})
+	if err := client.Drop(context.Background(), "77"); !errors.Is(err, ErrNoDrop) {
+		t.Errorf("Drop() on a server without drop_packet = %v, want ErrNoDrop", err)
+	}
+}
+
+func TestPacketID(t *testing.T) {
+	tests := map[string]string{
+		`{"packet":{"id":123}}`:  "123",
+		`{"id":"abc"}`:           "abc",
+		`{"success":true}`:       "",
+		`{"packet":{"id":null}}`: "",
+		``:                       "",
+	}
+	for body, want := range tests {
+		if got := packetID(strings.NewReader(body)); got != want {
+			t.Errorf("packetID(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
+
 func TestSendRateLimit(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTooManyRequests)
@@ -198,6 +424,26 @@ func TestSendRateLimit(t *testing.T) {
 	}
 }
 
+func TestSendTokenRefused(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		client := &Client{
+			baseURL: server.URL,
+			token:   "a:b",
+			channel: "live",
+			http:    server.Client(),
+		}
+
+		err := client.Send(context.Background(), message.Message{Platform: message.Twitch, Username: "user", Content: "test"})
+		if !errors.Is(err, ErrAuth) {
+			t.Errorf("Send() with status %d = %v, want ErrAuth", status, err)
+		}
+		server.Close()
+	}
+}
+
 func TestSendValidation(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnprocessableEntity)
@@ -224,6 +470,77 @@ func TestSendValidation(t *testing.T) {
 	}
 }
 
+type fakePerformer struct {
+	action string
+	data   map[string]any
+}
+
+func (f *fakePerformer) Perform(ctx context.Context, action string, data map[string]any) error {
+	f.action = action
+	f.data = data
+	return nil
+}
+
+func TestSendUserMode(t *testing.T) {
+	cable := &fakePerformer{}
+	client := NewUserClient(cable, "live", Options{})
+
+	err := client.Send(context.Background(), message.Message{
+		Platform: message.YouTube,
+		Username: "viewer",
+		Content:  "hello",
+	})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	if cable.action != "send_packet" {
+		t.Errorf("action = %q, want send_packet", cable.action)
+	}
+	if cable.data["content"] != "[YT_] viewer: hello" {
+		t.Errorf("content = %v", cable.data["content"])
+	}
+	if cable.data["source"] != "YT_" {
+		t.Errorf("source = %v, want YT_", cable.data["source"])
+	}
+	if _, ok := cable.data["source_channel"]; ok {
+		t.Errorf("source_channel = %v, want omitted", cable.data["source_channel"])
+	}
+
+	client.Send(context.Background(), message.Message{
+		Platform: message.Twitch,
+		Channel:  "xqc",
+		Username: "viewer",
+		Content:  "hi",
+	})
+	if cable.data["source_channel"] != "xqc" {
+		t.Errorf("source_channel = %v, want xqc", cable.data["source_channel"])
+	}
+}
+
+func TestSendDryRun(t *testing.T) {
+	var out strings.Builder
+	dryRunOutput = &out
+	t.Cleanup(func() { dryRunOutput = nil })
+
+	cable := &fakePerformer{}
+	client := NewUserClient(cable, "live", Options{DryRun: true, MaxLength: 18})
+	err := client.Send(context.Background(), message.Message{
+		Platform: message.Twitch,
+		Username: "viewer",
+		Content:  "hello from the other side",
+	})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if cable.action != "" {
+		t.Errorf("dry run performed %q, want nothing sent", cable.action)
+	}
+	if want := "Bridge dry run → hackr.tv #live: [TTV] viewer: h…\n"; out.String() != want {
+		t.Errorf("logged %q, want %q", out.String(), want)
+	}
+}
+
 func TestRunSkipsHackrTV(t *testing.T) {
 	var hitCount atomic.Int32
 
@@ -267,3 +584,361 @@ func TestRunSkipsHackrTV(t *testing.T) {
 		t.Errorf("expected 2 requests (TTV + YT), got %d", got)
 	}
 }
+
+func TestRunSuppressesDeletedMessages(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload sendPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		sent = append(sent, payload.Content)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+	}
+
+	ch := make(chan message.Message, 10)
+	ch <- message.Message{Platform: message.Twitch, Username: "ok", ID: "1", Content: "first"}
+	ch <- message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "spammer", TargetID: "2"}
+	ch <- message.Message{Platform: message.Twitch, Username: "spammer", ID: "2", Content: "deleted msg"}
+	ch <- message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "Troll"}
+	ch <- message.Message{Platform: message.Twitch, Username: "troll", ID: "3", Content: "timed out msg"}
+	ch <- message.Message{Platform: message.Twitch, Username: "spammer", ID: "4", Content: "later msg"}
+	close(ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client.Run(ctx, ch)
+
+	want := []string{"[TTV] ok: first", "[TTV] spammer: later msg"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %q, want %q", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("sent[%d] = %q, want %q", i, sent[i], want[i])
+		}
+	}
+}
+
+func TestRunRetractsSentMessages(t *testing.T) {
+	var mu sync.Mutex
+	var sent int
+	var dropped []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/admin/uplink/send_packet":
+			sent++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"packet":{"id":%d}}`, 100+sent)
+		case "/api/admin/uplink/drop_packet":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			dropped = append(dropped, body["packet_id"])
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+	}
+
+	// Each deletion reaches the client after its target was sent, as
+	// the sink queue is first in, first out
+	ch := make(chan message.Message, 10)
+	ch <- message.Message{Platform: message.Twitch, Username: "ok", ID: "1", Content: "first"}
+	ch <- message.Message{Platform: message.Twitch, Username: "spammer", ID: "2", Content: "deleted msg"}
+	ch <- message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "spammer", TargetID: "2"}
+	ch <- message.Message{Platform: message.Twitch, Username: "troll", ID: "3", Content: "timed out msg"}
+	ch <- message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "Troll"}
+	close(ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.Run(ctx, ch)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"102", "103"}; !slices.Equal(dropped, want) {
+		t.Errorf("dropped packets %v, want %v", dropped, want)
+	}
+
+	// A server without drop_packet is asked once
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	client = &Client{baseURL: old.URL, http: old.Client()}
+	now := time.Now()
+	client.remember(message.Message{ID: "1", Username: "a"}, "201", now)
+	client.remember(message.Message{ID: "2", Username: "a"}, "202", now)
+	client.retract(ctx, message.Message{Type: message.TypeDeletion, Username: "a"}, now)
+	if !client.noDrop.Load() {
+		t.Error("ErrNoDrop was not remembered")
+	}
+}
+
+func TestSuppressExpires(t *testing.T) {
+	client := &Client{}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	client.suppress(message.Message{Type: message.TypeDeletion, Username: "troll"}, now)
+
+	msg := message.Message{Username: "troll"}
+	if !client.isSuppressed(msg, now.Add(30*time.Second)) {
+		t.Error("expected suppression within window")
+	}
+	if client.isSuppressed(msg, now.Add(2*suppressWindow)) {
+		t.Error("expected suppression to expire")
+	}
+}
+
+func TestSuppressIsPerPlatform(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	var dropped []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/admin/uplink/send_packet":
+			var payload sendPayload
+			json.NewDecoder(r.Body).Decode(&payload)
+			sent = append(sent, payload.Content)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"packet":{"id":%d}}`, 100+len(sent))
+		case "/api/admin/uplink/drop_packet":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			dropped = append(dropped, body["packet_id"])
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+	}
+
+	// A Twitch timeout for "alex" leaves YouTube's "alex" alone, both
+	// the packet already bridged and the messages after it
+	ch := make(chan message.Message, 10)
+	ch <- message.Message{Platform: message.YouTube, Channel: "vid", Username: "alex", ID: "yt-1", Content: "hi"}
+	ch <- message.Message{Platform: message.Twitch, Channel: "xqc", Username: "alex", ID: "tw-1", Content: "spam"}
+	ch <- message.Message{Platform: message.Twitch, Channel: "xqc", Type: message.TypeDeletion, Username: "Alex"}
+	ch <- message.Message{Platform: message.YouTube, Channel: "vid", Username: "alex", ID: "yt-2", Content: "still here"}
+	ch <- message.Message{Platform: message.Twitch, Channel: "xqc", Username: "alex", ID: "tw-2", Content: "more spam"}
+	close(ch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.Run(ctx, ch)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"[YT_] alex: hi", "[TTV] alex: spam", "[YT_] alex: still here"}; !slices.Equal(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if want := []string{"102"}; !slices.Equal(dropped, want) {
+		t.Errorf("dropped packets %v, want %v", dropped, want)
+	}
+}
+
+func TestRunOrdering(t *testing.T) {
+	defer func(d time.Duration) { rateLimitBackoff = d }(rateLimitBackoff)
+	rateLimitBackoff = time.Millisecond
+
+	tests := []struct {
+		name   string
+		strict bool
+		want   []string
+	}{
+		// The first attempt at "two" is rate limited.
+		{"best effort drops limited message", false, []string{"[TTV] a: one", "[TTV] a: three"}},
+		{"strict retries before moving on", true, []string{"[TTV] a: one", "[TTV] a: two", "[TTV] a: three"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			limited := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload sendPayload
+				json.NewDecoder(r.Body).Decode(&payload)
+				if strings.HasSuffix(payload.Content, "two") && !limited {
+					limited = true
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				sent = append(sent, payload.Content)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			client := &Client{
+				baseURL: server.URL,
+				token:   "a:b",
+				channel: "live",
+				http:    server.Client(),
+				opts:    Options{StrictOrder: tt.strict},
+			}
+
+			ch := make(chan message.Message, 3)
+			for _, content := range []string{"one", "two", "three"} {
+				ch <- message.Message{Platform: message.Twitch, Username: "a", Content: content}
+			}
+			close(ch)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			client.Run(ctx, ch)
+
+			if strings.Join(sent, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("sent %q, want %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStrictOrderGivesUp(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{StrictOrder: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !client.deliver(ctx, message.Message{Platform: message.Twitch, Username: "a", Content: "bad"}) {
+		t.Fatal("deliver() reported cancellation")
+	}
+	if got := hits.Load(); got != strictAttempts {
+		t.Errorf("attempts = %d, want %d", got, strictAttempts)
+	}
+}
+
+func TestStrictRetryWaitsOnClock(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{StrictOrder: true, Clock: fake},
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- client.deliver(context.Background(), message.Message{Platform: message.Twitch, Username: "a", Content: "hi"})
+	}()
+
+	// The retry waits for the fake clock, however long real time runs.
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(rateLimitBackoff - time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("retried after %d attempts before the backoff elapsed", got)
+	}
+	fake.Advance(time.Millisecond)
+	if !<-done {
+		t.Fatal("deliver() reported cancellation")
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestSlowMode(t *testing.T) {
+	var sent []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body sendPayload
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.Content)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{SlowMode: 10 * time.Second, Clock: fake},
+	}
+	chat := func(user, content string) message.Message {
+		return message.Message{Platform: message.Twitch, Username: user, Content: content}
+	}
+	ctx := context.Background()
+
+	client.Handle(ctx, chat("bob", "one"))
+	client.Handle(ctx, chat("bob", "two"))
+	client.Handle(ctx, chat("Bob", "three"))
+	// Other users, events, and cheers are not held
+	client.Handle(ctx, chat("amy", "hi"))
+	client.Handle(ctx, message.Message{Platform: message.Twitch, Type: message.TypeSub, Username: "bob", Content: "bob subscribed"})
+	client.Handle(ctx, message.Message{Platform: message.Twitch, Username: "bob", Content: "Cheer100", Amount: message.Amount{Value: 100, Currency: "BITS", Display: "100 bits"}})
+
+	// Once the interval passes, the summary goes out ahead of bob's next
+	// message
+	fake.Advance(10 * time.Second)
+	client.Handle(ctx, chat("bob", "four"))
+
+	want := []string{
+		"[TTV] bob: one",
+		"[TTV] amy: hi",
+		"[TTV] ★ bob subscribed",
+		"[TTV] ◆ 100 bits bob: Cheer100",
+		"[TTV] ★ +2 more from bob",
+		"[TTV] bob: four",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != len(want) {
+		t.Fatalf("sent %q, want %q", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("sent[%d] = %q, want %q", i, sent[i], want[i])
+		}
+	}
+}
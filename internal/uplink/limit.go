@@ -0,0 +1,64 @@
+package uplink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+)
+
+// limiter is a token bucket: it holds up to burst tokens, refills at
+// rate per second, and each send takes one. Senders that find it empty
+// reserve a token ahead and wait for it, so concurrent senders queue up
+// at the configured pace rather than all waking at once.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns the limiter opts asks for, or nil. It starts full.
+func newLimiter(opts Options) *limiter {
+	if opts.Rate <= 0 {
+		return nil
+	}
+	burst := float64(max(opts.Burst, 1))
+	return &limiter{rate: opts.Rate, burst: burst, tokens: burst}
+}
+
+// reserve takes a token, returning how long to wait before using it.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until a send is allowed. It returns false if ctx was
+// cancelled first.
+func (l *limiter) wait(ctx context.Context, clk clock.Clock) bool {
+	if l == nil {
+		return true
+	}
+	d := l.reserve(clk.Now())
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-clk.After(d):
+		return true
+	}
+}
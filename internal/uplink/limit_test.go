@@ -0,0 +1,67 @@
+package uplink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	start := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	l := newLimiter(Options{Rate: 2, Burst: 3})
+
+	// A full bucket lets the burst through, then paces at the rate
+	for i := range 3 {
+		if d := l.reserve(start); d != 0 {
+			t.Fatalf("send %d waited %s, want none within the burst", i, d)
+		}
+	}
+	if d := l.reserve(start); d != 500*time.Millisecond {
+		t.Errorf("first send over the burst waits %s, want 500ms", d)
+	}
+	if d := l.reserve(start); d != time.Second {
+		t.Errorf("second send over the burst waits %s, want 1s", d)
+	}
+	// Idle time refills, but never past the burst
+	if d := l.reserve(start.Add(time.Hour)); d != 0 {
+		t.Errorf("send after an idle hour waits %s", d)
+	}
+	if l.tokens != 2 {
+		t.Errorf("tokens = %v, want burst 3 less one", l.tokens)
+	}
+
+	if newLimiter(Options{}) != nil {
+		t.Error("newLimiter() without a rate should disable limiting")
+	}
+}
+
+func TestLimiterWaitsOnClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	l := newLimiter(Options{Rate: 1})
+	if !l.wait(context.Background(), fake) {
+		t.Fatal("wait() reported cancellation")
+	}
+
+	done := make(chan bool)
+	go func() { done <- l.wait(context.Background(), fake) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("second send went out before a token refilled")
+	case <-time.After(10 * time.Millisecond):
+	}
+	fake.Advance(time.Second)
+	if !<-done {
+		t.Error("wait() reported cancellation")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if l.wait(ctx, fake) {
+		t.Error("wait() on a cancelled context should report false")
+	}
+}
@@ -0,0 +1,99 @@
+package uplink
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"relay/internal/message"
+)
+
+// workerBuffer is how many messages each of Run's workers may have
+// waiting.
+const workerBuffer = 32
+
+// Stats is a snapshot of the bridge's backlog.
+type Stats struct {
+	// Workers is how many messages Run sends at once.
+	Workers int `json:"workers"`
+	// Queued is how many messages wait for a worker.
+	Queued int64 `json:"queued"`
+	// Retrying is how many failed messages wait in the retry queue's
+	// memory, not counting any spilled to disk.
+	Retrying int `json:"retrying"`
+	// Circuit is the breaker's state, "closed", "open", or "half-open",
+	// or empty without one.
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// Stats reports the client's current backlog.
+func (c *Client) Stats() Stats {
+	s := Stats{Workers: max(c.opts.Workers, 1), Queued: c.queued.Load()}
+	if c.retries != nil {
+		s.Retrying = c.retries.len()
+	}
+	if c.breaker != nil {
+		s.Circuit = c.breaker.state(c.clock().Now())
+	}
+	return s
+}
+
+// runPool is Run with several workers. Each message goes to the worker
+// picked by its sender, so one user's messages are sent one at a time
+// and in order while different users' go out in parallel. Deletions are
+// applied as they arrive rather than queued, so they catch matching
+// messages waiting at any worker and retract those already sent.
+func (c *Client) runPool(ctx context.Context, messages <-chan message.Message) {
+	queues := make([]chan message.Message, c.opts.Workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan message.Message, workerBuffer)
+		wg.Add(1)
+		go func(q <-chan message.Message) {
+			defer wg.Done()
+			for msg := range q {
+				c.queued.Add(-1)
+				if ctx.Err() == nil {
+					c.Handle(ctx, msg)
+				}
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if msg.Type == message.TypeDeletion {
+				c.suppress(msg, c.clock().Now())
+				c.retract(ctx, msg, c.clock().Now())
+				continue
+			}
+			c.queued.Add(1)
+			select {
+			case queues[worker(msg, len(queues))] <- msg:
+			case <-ctx.Done():
+				c.queued.Add(-1)
+				return
+			}
+		}
+	}
+}
+
+// worker picks the worker for msg's sender.
+func worker(msg message.Message, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(msg.Platform.Key() + ":" + strings.ToLower(msg.Username)))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,89 @@
+package uplink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"relay/internal/message"
+)
+
+func TestRunPoolOrdersPerUser(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p sendPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		if p.Content == "[TTV] slow: 1" {
+			<-release
+		}
+		mu.Lock()
+		got = append(got, strings.TrimPrefix(p.Content, "[TTV] "))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	const workers = 4
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{Workers: workers},
+	}
+	chat := func(user, content string) message.Message {
+		return message.Message{Platform: message.Twitch, Username: user, Content: content}
+	}
+	// A user on another worker than the slow one
+	other := "fast"
+	for i := 0; worker(chat(other, ""), workers) == worker(chat("slow", ""), workers); i++ {
+		other = "fast" + string(rune('a'+i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	messages := make(chan message.Message)
+	done := make(chan struct{})
+	go func() {
+		client.Run(ctx, messages)
+		close(done)
+	}()
+	messages <- chat("slow", "1")
+	messages <- chat("slow", "2")
+	messages <- chat("Slow", "3")
+	messages <- chat(other, "hi")
+
+	// The other user isn't held up behind the slow one
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("a different user's message waited for the slow one")
+		}
+	}
+	if s := client.Stats(); s.Queued != 2 || s.Workers != workers {
+		t.Errorf("Stats() = %+v, want 2 queued behind the slow send", s)
+	}
+	close(release)
+	close(messages)
+	<-done
+
+	want := []string{other + ": hi", "slow: 1", "slow: 2", "Slow: 3"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+	if s := client.Stats(); s.Queued != 0 {
+		t.Errorf("Queued = %d after Run returned", s.Queued)
+	}
+}
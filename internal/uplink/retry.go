@@ -0,0 +1,375 @@
+package uplink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"relay/internal/message"
+	"relay/internal/retention"
+)
+
+// minRetryBackoff and maxRetryBackoff bound the wait between attempts to
+// send the head of the retry queue. They are variables so tests can
+// shorten them.
+var (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+// retryQueue holds messages that could not be bridged, oldest first. Up
+// to limit are kept in memory; with a spill file the rest are appended
+// to it as JSON lines and read back as the queue drains, so order is
+// kept across both.
+type retryQueue struct {
+	limit int
+	spill string
+	// keep bounds the spill file.
+	keep retention.Policy
+
+	mu    sync.Mutex
+	items []message.Message
+	// spilled is set while the spill file may hold messages. New
+	// messages go to the file behind them rather than jumping ahead.
+	spilled bool
+	dropped int
+	wake    chan struct{}
+}
+
+// newRetries returns the retry queue opts asks for, or nil. A spill file
+// left by an earlier run is picked up.
+func newRetries(opts Options) *retryQueue {
+	limit := opts.RetryQueue
+	if limit <= 0 && opts.BreakerThreshold > 0 {
+		limit = defaultBreakerBuffer
+	}
+	if limit <= 0 {
+		return nil
+	}
+	q := &retryQueue{limit: limit, spill: opts.SpillFile, keep: opts.SpillRetention, wake: make(chan struct{}, 1)}
+	if q.spill != "" {
+		if err := q.prune(q.keep); err != nil {
+			fmt.Fprintf(os.Stderr, "Uplink spill error: %v\n", err)
+		}
+		if info, err := os.Stat(q.spill); err == nil && info.Size() > 0 {
+			q.spilled = true
+		}
+	}
+	return q
+}
+
+// prune applies p to the spill file. q.mu must be held, or q not yet
+// shared.
+func (q *retryQueue) prune(p retention.Policy) error {
+	if p.IsZero() {
+		return nil
+	}
+	n, err := PruneSpill(q.spill, p, time.Now())
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Uplink spill file pruned, %d messages dropped\n", n)
+	}
+	return err
+}
+
+// push queues msg. Without room in memory it is spilled to disk, or the
+// oldest queued message is dropped.
+func (q *retryQueue) push(msg message.Message) {
+	// Spilled messages are aged by their timestamp
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case !q.spilled && len(q.items) < q.limit:
+		q.items = append(q.items, msg)
+	case q.spill != "":
+		if err := appendLines(q.spill, []message.Message{msg}); err != nil {
+			fmt.Fprintf(os.Stderr, "Uplink spill error: %v\n", err)
+			q.dropped++
+			return
+		}
+		q.spilled = true
+		// Past its size limit the file is trimmed to three quarters of
+		// it, so it isn't rewritten for every message that follows
+		if info, err := os.Stat(q.spill); err == nil && q.keep.MaxSize > 0 && info.Size() > q.keep.MaxSize {
+			if err := q.prune(retention.Policy{MaxAge: q.keep.MaxAge, MaxSize: q.keep.MaxSize * 3 / 4}); err != nil {
+				fmt.Fprintf(os.Stderr, "Uplink spill error: %v\n", err)
+			}
+		}
+	default:
+		q.items = append(q.items[1:], msg)
+		q.dropped++
+		if q.dropped == 1 || q.dropped%100 == 0 {
+			fmt.Fprintf(os.Stderr, "Uplink retry queue full, %d messages dropped\n", q.dropped)
+		}
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// peek returns the oldest queued message, refilling memory from the
+// spill file when it has run dry.
+func (q *retryQueue) peek() (message.Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 && q.spilled {
+		if err := q.refill(); err != nil {
+			fmt.Fprintf(os.Stderr, "Uplink spill error: %v\n", err)
+			q.spilled = false
+		}
+	}
+	if len(q.items) == 0 {
+		return message.Message{}, false
+	}
+	return q.items[0], true
+}
+
+// pop removes the oldest queued message.
+func (q *retryQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) > 0 {
+		q.items = q.items[1:]
+	}
+}
+
+// len reports how many messages are queued in memory.
+func (q *retryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// refill moves up to limit messages from the spill file into memory and
+// rewrites the file with the rest. q.mu must be held.
+func (q *retryQueue) refill() error {
+	msgs, err := readLines(q.spill)
+	if err != nil {
+		return err
+	}
+	if dropped := len(msgs); !q.keep.IsZero() {
+		msgs = keepMessages(msgs, q.keep, time.Now())
+		if dropped -= len(msgs); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Uplink spill file pruned, %d messages dropped\n", dropped)
+		}
+	}
+	n := min(len(msgs), q.limit)
+	q.items = append(q.items, msgs[:n]...)
+	q.spilled = len(msgs) > n
+	return writeLines(q.spill, msgs[n:])
+}
+
+// save writes the messages still in memory to the front of the spill
+// file, so a restart picks up where this run stopped.
+func (q *retryQueue) save() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spill == "" || len(q.items) == 0 {
+		return nil
+	}
+	rest, err := readLines(q.spill)
+	if err != nil {
+		return err
+	}
+	if err := writeLines(q.spill, append(q.items, rest...)); err != nil {
+		return err
+	}
+	q.items, q.spilled = nil, true
+	return nil
+}
+
+// PruneSpill applies p to the spill file at path, dropping messages older
+// than MaxAge and then the oldest while the file is over MaxSize. It
+// reports how many were dropped. It must not be used on the file of a
+// running client; see Client.PruneRetries.
+func PruneSpill(path string, p retention.Policy, now time.Time) (int, error) {
+	msgs, err := readLines(path)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+	kept := keepMessages(msgs, p, now)
+	if len(kept) == len(msgs) {
+		return 0, nil
+	}
+	return len(msgs) - len(kept), writeLines(path, kept)
+}
+
+// keepMessages returns the messages p keeps, by timestamp and encoded
+// size.
+func keepMessages(msgs []message.Message, p retention.Policy, now time.Time) []message.Message {
+	records := make([]retention.Record, len(msgs))
+	for i, msg := range msgs {
+		data, _ := json.Marshal(msg)
+		records[i] = retention.Record{Time: msg.Timestamp, Size: len(data) + 1}
+	}
+	return msgs[p.Keep(records, now):]
+}
+
+// PruneRetries applies the client's SpillRetention to its spill file. The
+// relay calls it now and then so messages don't linger past their age
+// while hackr.tv stays down.
+func (c *Client) PruneRetries() error {
+	q := c.retries
+	if q == nil || q.spill == "" {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.prune(q.keep); err != nil {
+		return err
+	}
+	if info, err := os.Stat(q.spill); err != nil || info.Size() == 0 {
+		q.spilled = false
+	}
+	return nil
+}
+
+// readLines reads a spill file. A missing file is empty, and lines that
+// don't decode are skipped.
+func readLines(path string) ([]message.Message, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []message.Message
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var msg message.Message
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, scanner.Err()
+}
+
+// writeLines replaces a spill file's contents, removing it when empty.
+func writeLines(path string, msgs []message.Message) error {
+	if len(msgs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := appendLines(tmp, msgs); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// appendLines adds msgs to the end of a spill file, creating it readable
+// only by the owner since it holds chat.
+func appendLines(path string, msgs []message.Message) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Queue adds msg to the retry queue, e.g. one the dispatcher had no room
+// for. A deletion is applied as in Handle rather than queued. It reports
+// false when msg was dropped because the client has no retry queue.
+func (c *Client) Queue(msg message.Message) bool {
+	if msg.Type == message.TypeDeletion {
+		c.suppress(msg, c.clock().Now())
+		return true
+	}
+	if c.retries == nil {
+		return false
+	}
+	c.retries.push(msg)
+	return true
+}
+
+// RunRetries sends queued messages oldest first until ctx is cancelled,
+// backing off exponentially while hackr.tv keeps failing. Messages
+// deleted by a moderator in the meantime are skipped. On return the
+// messages still queued are saved to the spill file, if there is one.
+// It returns at once for clients without a retry queue.
+func (c *Client) RunRetries(ctx context.Context) {
+	q := c.retries
+	if q == nil {
+		return
+	}
+	defer func() {
+		if err := q.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Uplink spill error: %v\n", err)
+		}
+	}()
+
+	backoff := minRetryBackoff
+	for {
+		msg, ok := q.peek()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		if c.isSuppressed(msg, c.clock().Now()) {
+			q.pop()
+			continue
+		}
+
+		// An open breaker decides when hackr.tv is tried again
+		if now := c.clock().Now(); !c.breaker.allow(now) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.clock().After(max(c.breaker.until().Sub(now), minRetryBackoff)):
+			}
+			continue
+		}
+		if !c.limit.wait(ctx, c.clock()) {
+			return
+		}
+		id, err := c.send(ctx, msg)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil || errors.Is(err, ErrRateLimit) {
+			c.breaker.success(c.clock().Now())
+		}
+		if err == nil {
+			c.remember(msg, id, c.clock().Now())
+			q.pop()
+			backoff = minRetryBackoff
+			continue
+		}
+		if errors.Is(err, ErrRateLimit) || !c.breaker.failure(c.clock().Now(), err) {
+			fmt.Fprintf(os.Stderr, "Uplink retry failed: %v; %d queued, next attempt in %s\n", err, q.len(), backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock().After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
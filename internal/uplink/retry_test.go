@@ -0,0 +1,177 @@
+package uplink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+	"relay/internal/retention"
+)
+
+func TestRetryQueueRecovers(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var attempts atomic.Int32
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var p sendPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		got = append(got, p.Content)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	client := &Client{
+		baseURL: server.URL,
+		token:   "a:b",
+		channel: "live",
+		http:    server.Client(),
+		opts:    Options{Clock: fake},
+		retries: newRetries(Options{RetryQueue: 10}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.Handle(ctx, message.Message{Platform: message.Twitch, Username: "a", Content: "first", ID: "1"})
+	client.Handle(ctx, message.Message{Platform: message.Twitch, Username: "b", Content: "deleted", ID: "2"})
+	if n := client.retries.len(); n != 2 {
+		t.Fatalf("queued = %d, want the 2 failed messages", n)
+	}
+	client.Queue(message.Message{Platform: message.Twitch, Type: message.TypeDeletion, Username: "b", TargetID: "2"})
+
+	done := make(chan struct{})
+	go func() {
+		client.RunRetries(ctx)
+		close(done)
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(minRetryBackoff)
+	// The second failure doubles the wait
+	for attempts.Load() < 4 || fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	down.Store(false)
+	fake.Advance(minRetryBackoff)
+	time.Sleep(10 * time.Millisecond)
+	if n := attempts.Load(); n != 4 {
+		t.Fatalf("attempts before the doubled backoff = %d, want 4", n)
+	}
+	fake.Advance(minRetryBackoff)
+	for client.retries.len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != "[TTV] a: first" {
+		t.Errorf("delivered %q, want only the undeleted message", got)
+	}
+}
+
+func TestRetryQueueSpill(t *testing.T) {
+	spill := filepath.Join(t.TempDir(), "spill.jsonl")
+	q := newRetries(Options{RetryQueue: 1, SpillFile: spill})
+	for _, c := range []string{"a", "b", "c"} {
+		q.push(message.Message{Platform: message.Twitch, Content: c})
+	}
+	data, err := os.ReadFile(spill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("spilled %d messages, want 2", n)
+	}
+
+	// Take one, then shut down with the rest unsent
+	if msg, _ := q.peek(); msg.Content != "a" {
+		t.Fatalf("peek() = %q, want a", msg.Content)
+	}
+	q.pop()
+	if msg, _ := q.peek(); msg.Content != "b" {
+		t.Fatalf("peek() = %q, want b from the spill file", msg.Content)
+	}
+	if err := q.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart picks up where the last run stopped, in order
+	q = newRetries(Options{RetryQueue: 5, SpillFile: spill})
+	q.push(message.Message{Platform: message.Twitch, Content: "d"})
+	var order []string
+	for {
+		msg, ok := q.peek()
+		if !ok {
+			break
+		}
+		order = append(order, msg.Content)
+		q.pop()
+	}
+	if strings.Join(order, "") != "bcd" {
+		t.Errorf("order = %v, want b c d", order)
+	}
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("spill file left behind after draining: %v", err)
+	}
+}
+
+func TestRetryQueueDropsOldest(t *testing.T) {
+	q := newRetries(Options{RetryQueue: 2})
+	for _, c := range []string{"a", "b", "c"} {
+		q.push(message.Message{Content: c})
+	}
+	if msg, _ := q.peek(); msg.Content != "b" || q.len() != 2 {
+		t.Errorf("head = %q with %d queued, want b with 2", msg.Content, q.len())
+	}
+	if (&Client{}).Queue(message.Message{Content: "x"}) {
+		t.Error("Queue() without a retry queue should report the message dropped")
+	}
+}
+
+func TestPruneSpill(t *testing.T) {
+	spill := filepath.Join(t.TempDir(), "spill.jsonl")
+	now := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	var msgs []message.Message
+	for i, age := range []time.Duration{48 * time.Hour, time.Hour, time.Minute, 0} {
+		msgs = append(msgs, message.Message{Platform: message.Twitch, Content: string(rune('a' + i)), Timestamp: now.Add(-age)})
+	}
+	if err := writeLines(spill, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := PruneSpill(spill, retention.Policy{MaxAge: 24 * time.Hour}, now)
+	if err != nil || n != 1 {
+		t.Fatalf("PruneSpill() = %d, %v; want the day-old message dropped", n, err)
+	}
+	info, _ := os.Stat(spill)
+	n, err = PruneSpill(spill, retention.Policy{MaxSize: info.Size() - 1}, now)
+	if err != nil || n != 1 {
+		t.Fatalf("PruneSpill() = %d, %v; want the oldest dropped to fit", n, err)
+	}
+	kept, _ := readLines(spill)
+	if len(kept) != 2 || kept[0].Content != "c" {
+		t.Errorf("kept %+v, want c and d", kept)
+	}
+}
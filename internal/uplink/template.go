@@ -0,0 +1,162 @@
+package uplink
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"relay/internal/message"
+)
+
+// DefaultTemplate reproduces the standard bridge formats:
+// "[TTV] user: text", "[TTV] ★ event", and "[TTV] ◆ 100 bits user: text".
+const DefaultTemplate = `[{{.Platform}}] {{if .Event}}★ {{.Content}}{{else}}{{with .Amount}}◆ {{.}} {{end}}{{.Username}}: {{.Content}}{{end}}`
+
+// TemplateData is what a bridge template is executed with.
+type TemplateData struct {
+	// Platform is the source platform's label, e.g. "TTV".
+	Platform string
+	Username string
+	Content  string
+	// Channel is the source channel, e.g. the Twitch channel or YouTube
+	// video ID, when known.
+	Channel string
+	// Amount is a cheer or Super Chat's display amount, e.g. "$5.00", or
+	// empty.
+	Amount string
+	// Event is set for subs, raids, and other non-chat events, whose
+	// Content already names the user.
+	Event bool
+}
+
+// Template formats messages bridged to hackr.tv, and recognizes them when
+// hackr.tv echoes them back, so the two always agree.
+type Template struct {
+	t *template.Template
+}
+
+// ParseTemplate parses a text/template over TemplateData. An empty text
+// gives DefaultTemplate. The template must include {{.Platform}} ahead of
+// {{.Content}} so echoes of bridged chat can be told from other messages
+// by the relay's alias.
+func ParseTemplate(text string) (*Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	t, err := template.New("bridge").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("bridge template: %w", err)
+	}
+	tmpl := &Template{t: t}
+	for _, sample := range echoSamples(message.Twitch) {
+		s, err := tmpl.execute(sample)
+		if err != nil {
+			return nil, fmt.Errorf("bridge template: %w", err)
+		}
+		before, _, _ := strings.Cut(s, sample.Content)
+		if !strings.Contains(before, sample.Platform) {
+			return nil, fmt.Errorf("bridge template must include {{.Platform}} before {{.Content}}")
+		}
+	}
+	return tmpl, nil
+}
+
+// defaultTemplate formats for clients without a template.
+var defaultTemplate = func() *Template {
+	t, err := ParseTemplate("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}()
+
+func (t *Template) execute(data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := t.t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Format renders msg, falling back to DefaultTemplate if the template
+// fails on it.
+func (t *Template) Format(msg message.Message) string {
+	data := TemplateData{
+		Platform: msg.Platform.String(),
+		Username: msg.Username,
+		Content:  msg.Content,
+		Channel:  msg.Channel,
+		Amount:   msg.Amount.Display,
+		Event:    msg.IsEvent(),
+	}
+	if msg.Amount.IsZero() {
+		data.Amount = ""
+	}
+	s, err := t.execute(data)
+	if err != nil && t != defaultTemplate {
+		fmt.Fprintf(os.Stderr, "Bridge template error: %v\n", err)
+		return defaultTemplate.Format(msg)
+	}
+	return s
+}
+
+// Sentinels stand in for the fields that vary when the template is
+// rendered to derive echo patterns.
+const (
+	sentinelUser    = "\x00user\x00"
+	sentinelContent = "\x00content\x00"
+	sentinelChannel = "\x00channel\x00"
+	sentinelAmount  = "\x00amount\x00"
+)
+
+// sentinelPattern matches the sentinels other than the content's.
+var sentinelPattern = regexp.MustCompile("\x00(?:user|channel|amount)\x00")
+
+// echoSamples are a chat message, an event, and a paid message from p.
+func echoSamples(p message.Platform) []TemplateData {
+	chat := TemplateData{Platform: p.String(), Username: sentinelUser, Content: sentinelContent, Channel: sentinelChannel}
+	event, paid := chat, chat
+	event.Event = true
+	paid.Amount = sentinelAmount
+	return []TemplateData{chat, event, paid}
+}
+
+// IsBridged reports whether content, posted to hackr.tv by the relay's
+// alias, is a message the template bridged from another platform. Only
+// what comes before the content is compared, so truncated messages
+// still match.
+func (t *Template) IsBridged(content string) bool {
+	for _, p := range message.Platforms() {
+		if p == message.HackrTV {
+			continue
+		}
+		for _, sample := range echoSamples(p) {
+			s, err := t.execute(sample)
+			if err != nil {
+				continue
+			}
+			if echoPattern(s).MatchString(content) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// echoPattern turns a template rendered with sentinels into a pattern for
+// its output: literal text up to the content, with the sentinels
+// matching anything.
+func echoPattern(rendered string) *regexp.Regexp {
+	before, _, _ := strings.Cut(rendered, sentinelContent)
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range sentinelPattern.Split(before, -1) {
+		if i > 0 {
+			b.WriteString(".*?")
+		}
+		b.WriteString(regexp.QuoteMeta(part))
+	}
+	return regexp.MustCompile(b.String())
+}
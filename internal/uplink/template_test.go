@@ -0,0 +1,62 @@
+package uplink
+
+import (
+	"testing"
+
+	"relay/internal/message"
+)
+
+func TestTemplateFormat(t *testing.T) {
+	tmpl, err := ParseTemplate("{{.Platform}}/{{.Channel}} <{{.Username}}> {{.Content}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := message.Message{Platform: message.Twitch, Channel: "xqc", Username: "viewer", Content: "hello"}
+	if got := tmpl.Format(msg); got != "TTV/xqc <viewer> hello" {
+		t.Errorf("Format() = %q", got)
+	}
+
+	// A template that fails on a message falls back to the default
+	tmpl, err = ParseTemplate("[{{.Platform}}] {{slice .Username 0 5}}: {{.Content}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tmpl.Format(message.Message{Platform: message.Twitch, Username: "bo", Content: "hi"}); got != "[TTV] bo: hi" {
+		t.Errorf("Format() = %q, want the default format", got)
+	}
+}
+
+func TestParseTemplateValidates(t *testing.T) {
+	for _, text := range []string{
+		"{{.Platform",
+		"{{.Username}}: {{.Content}}",
+		"{{.Content}} via {{.Platform}}",
+		"{{.Nickname}}: {{.Content}}",
+	} {
+		if _, err := ParseTemplate(text); err == nil {
+			t.Errorf("ParseTemplate(%q) should fail", text)
+		}
+	}
+}
+
+func TestTemplateIsBridged(t *testing.T) {
+	tmpl := defaultTemplate
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"[TTV] user: hi", true},
+		{"[YT_] ◆ $5.00 fan: thanks", true},
+		{"[TTV] ★ bob subscribed", true},
+		{"[RLY] ★ Relay online: mirroring twitch.tv/xqc", true},
+		{Truncate("[TTV] user: "+string(make([]byte, 600)), 64), true},
+		{"[TTV]no space", false},
+		{"[HTV] user: hi", false},
+		{"hello grid", false},
+	}
+	for _, tt := range tests {
+		if got := tmpl.IsBridged(tt.content); got != tt.want {
+			t.Errorf("IsBridged(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
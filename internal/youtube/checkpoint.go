@@ -0,0 +1,95 @@
+package youtube
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// checkpointIDs is how many of the newest delivered message IDs a
+// checkpoint keeps, enough to cover the page a resumed token overlaps.
+const checkpointIDs = 200
+
+// maxCheckpointAge is how old a checkpoint may be and still be resumed.
+// Older page tokens are likely to have expired, and the chat they point
+// at is no longer served.
+const maxCheckpointAge = 30 * time.Minute
+
+// checkpoint records where a client left off in a live chat, so a relay
+// restarted mid-stream resumes there instead of replaying the chat's
+// recent messages or skipping what arrived while it was down.
+type checkpoint struct {
+	LiveChatID string    `json:"live_chat_id"`
+	PageToken  string    `json:"page_token"`
+	LastIDs    []string  `json:"last_ids"`
+	SavedAt    time.Time `json:"saved_at"`
+}
+
+// loadCheckpoint reads the checkpoint at path. A missing or unreadable
+// file has none.
+func loadCheckpoint(path string) (checkpoint, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "YouTube checkpoint error: %v\n", err)
+		}
+		return checkpoint{}, false
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		fmt.Fprintf(os.Stderr, "YouTube checkpoint error: %s: %v\n", path, err)
+		return checkpoint{}, false
+	}
+	return cp, true
+}
+
+// saveCheckpoint writes cp to path, replacing it atomically.
+func saveCheckpoint(path string, cp checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// resume picks up from the client's checkpoint if it is recent and for
+// chatID: the saved page token is polled next, and the saved message IDs
+// count as delivered. It reports whether it resumed.
+func (c *Client) resume(chatID string) bool {
+	c.pageToken = ""
+	if c.checkpoint == "" {
+		return false
+	}
+	cp, ok := loadCheckpoint(c.checkpoint)
+	if !ok || cp.LiveChatID != chatID || cp.PageToken == "" || c.clock.Now().Sub(cp.SavedAt) > maxCheckpointAge {
+		return false
+	}
+	c.pageToken = cp.PageToken
+	for _, id := range cp.LastIDs {
+		c.markSeen(chatID, id)
+	}
+	c.resumed = true
+	return true
+}
+
+// save writes the client's position in the current chat to its
+// checkpoint file, if it has one.
+func (c *Client) save() {
+	if c.checkpoint == "" || c.pageToken == "" {
+		return
+	}
+	c.mu.Lock()
+	cp := checkpoint{LiveChatID: c.liveChatID, PageToken: c.pageToken, SavedAt: c.clock.Now()}
+	if seen := c.seen[c.liveChatID]; seen != nil {
+		cp.LastIDs = append([]string(nil), seen.order[max(0, len(seen.order)-checkpointIDs):]...)
+	}
+	c.mu.Unlock()
+	if err := saveCheckpoint(c.checkpoint, cp); err != nil {
+		fmt.Fprintf(os.Stderr, "YouTube checkpoint error: %v\n", err)
+	}
+}
@@ -0,0 +1,114 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("pageToken") {
+		case "":
+			json.NewEncoder(w).Encode(liveChatResponse{NextPageToken: "t1", Items: []liveChatItem{
+				newItem("m1", "", "first", "alice"),
+				newItem("m2", "", "second", "bob"),
+			}})
+		case "t1":
+			// The resumed page overlaps what was already delivered
+			json.NewEncoder(w).Encode(liveChatResponse{NextPageToken: "t2", Items: []liveChatItem{
+				newItem("m2", "", "second", "bob"),
+				newItem("m3", "", "third", "carol"),
+			}})
+		default:
+			t.Errorf("unexpected pageToken %q", r.URL.Query().Get("pageToken"))
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "youtube.json")
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	newClient := func() *Client {
+		c := NewClient(NewKeyPool("key"), "video-123", Options{BaseURL: server.URL, Checkpoint: path, Clock: fake})
+		c.httpClient = server.Client()
+		return c
+	}
+
+	first := newClient()
+	first.setLiveChatID("chat-abc")
+	if first.resume("chat-abc") {
+		t.Fatal("resumed without a checkpoint")
+	}
+	msgs := make(chan message.Message, 10)
+	if err := first.fetchMessages(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("first run delivered %d messages, want 2", len(msgs))
+	}
+
+	// A restart on the same chat picks up at the saved token
+	second := newClient()
+	second.setLiveChatID("chat-abc")
+	if !second.resume("chat-abc") {
+		t.Fatal("resume() = false, want the saved checkpoint")
+	}
+	msgs = make(chan message.Message, 10)
+	if err := second.fetchMessages(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("resumed run delivered %d messages, want only the new one", len(msgs))
+	}
+	if msg := <-msgs; msg.Content != "third" {
+		t.Errorf("delivered %q, want third", msg.Content)
+	}
+	if cp, _ := loadCheckpoint(path); cp.PageToken != "t2" || len(cp.LastIDs) != 3 {
+		t.Errorf("checkpoint = %+v, want t2 with three IDs", cp)
+	}
+
+	// Another chat, or a stale checkpoint, starts over
+	if newClient().resume("chat-other") {
+		t.Error("resumed a checkpoint for a different chat")
+	}
+	fake.Advance(maxCheckpointAge + time.Minute)
+	if newClient().resume("chat-abc") {
+		t.Error("resumed a stale checkpoint")
+	}
+}
+
+func TestCheckpointRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "expired" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(liveChatResponse{NextPageToken: "fresh", Items: []liveChatItem{newItem("m1", "", "hi", "alice")}})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "youtube.json")
+	if err := saveCheckpoint(path, checkpoint{LiveChatID: "chat-abc", PageToken: "expired", SavedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(NewKeyPool("key"), "video-123", Options{BaseURL: server.URL, Checkpoint: path})
+	c.httpClient = server.Client()
+	c.setLiveChatID("chat-abc")
+	if !c.resume("chat-abc") {
+		t.Fatal("resume() = false")
+	}
+	msgs := make(chan message.Message, 10)
+	if err := c.fetchMessages(context.Background(), msgs); err != nil {
+		t.Fatalf("fetchMessages() error: %v, want a fresh start", err)
+	}
+	if len(msgs) != 1 || c.pageToken != "fresh" {
+		t.Errorf("delivered %d messages with token %q", len(msgs), c.pageToken)
+	}
+}
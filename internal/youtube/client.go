@@ -1,52 +1,383 @@
 package youtube
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"relay/internal/clock"
+	"relay/internal/i18n"
 	"relay/internal/message"
 )
 
 const (
-	liveChatMessagesURL = "https://www.googleapis.com/youtube/v3/liveChat/messages"
-	videosURL           = "https://www.googleapis.com/youtube/v3/videos"
+	defaultBaseURL = "https://www.googleapis.com/youtube/v3"
+
+	liveChatMessagesPath = "/liveChat/messages"
+	videosPath           = "/videos"
+	channelsPath         = "/channels"
+	playlistItemsPath    = "/playlistItems"
+
+	// defaultDiscoverInterval is how often a followed channel is checked
+	// for a new live stream.
+	defaultDiscoverInterval = time.Minute
+	// recentUploads is how many of a channel's newest uploads are checked
+	// for a live broadcast.
+	recentUploads = 5
+)
+
+// Options configures a YouTube client.
+type Options struct {
+	// BaseURL overrides the YouTube Data API base URL, for regional
+	// endpoints, egress proxies, API-compatible gateways, or mock servers.
+	// Defaults to https://www.googleapis.com/youtube/v3.
+	BaseURL string
+	// ChannelID or Handle (e.g. "@hackrtv") names a channel to follow
+	// when no video ID is given: its current live stream is found
+	// automatically, and a new one is picked up when it starts.
+	ChannelID string
+	Handle    string
+	// DiscoverInterval is how often a followed channel is checked for a
+	// new live stream. Defaults to 1m.
+	DiscoverInterval time.Duration
+	// Clock paces polling and discovery and stamps messages that lack a
+	// publish time. Defaults to the wall clock.
+	Clock clock.Clock
+	// OAuth authorizes Send to post to the live chat. Without it the
+	// client is read-only.
+	OAuth *OAuth
+	// MinPollInterval and MaxPollInterval bound the wait between chat
+	// polls, which otherwise follows the API's pollingIntervalMillis
+	// hint. A higher floor spends less quota at the cost of latency.
+	// Zero leaves that side unbounded.
+	MinPollInterval time.Duration
+	MaxPollInterval time.Duration
+	// Checkpoint, if set, is a file the client saves its place in the
+	// chat to after every poll, and resumes from when it starts again on
+	// the same chat within half an hour.
+	Checkpoint string
+	// SendTimeout bounds each Send, including refreshing the access
+	// token. Defaults to 10s.
+	SendTimeout time.Duration
+	// KeepRaw sets each message's Raw to the JSON of the chat item it
+	// came from.
+	KeepRaw bool
+}
+
+var (
+	// ErrReadOnly is returned by Send when the client has no OAuth
+	// credentials.
+	ErrReadOnly = errors.New("youtube: sending requires OAuth credentials")
+	// ErrNoLiveChat is returned by Send before a live chat has been found.
+	ErrNoLiveChat = errors.New("youtube: no live chat to post to")
+	// ErrChatEnded is returned when the live chat has closed because the
+	// broadcast ended or chat was disabled.
+	ErrChatEnded = errors.New("youtube: live chat ended")
+	// ErrStreamEnded is ErrChatEnded, by the name the other clients use
+	// for a stream that is over.
+	ErrStreamEnded = ErrChatEnded
+	// ErrNotLive is returned for a video with no live chat, such as an
+	// upcoming stream or an ordinary upload. Connect keeps retrying a
+	// video ID that isn't live yet.
+	ErrNotLive = errors.New("youtube: not live")
 )
 
+// maxSendLength is the longest live chat message YouTube accepts, in
+// characters.
+const maxSendLength = 200
+
+// defaultSendTimeout bounds Send unless Options.SendTimeout is set.
+const defaultSendTimeout = 10 * time.Second
+
+// seenLimit bounds how many delivered message IDs are remembered per chat.
+const seenLimit = 2000
+
 type Client struct {
-	apiKey      string
+	keys        *KeyPool
+	baseURL     string
 	videoID     string
 	liveChatID  string
 	httpClient  *http.Client
 	pageToken   string
 	pollingRate time.Duration
+	// minPoll and maxPoll bound pollingRate when nonzero.
+	minPoll time.Duration
+	maxPoll time.Duration
+
+	// channelID and handle identify a followed channel; uploadsID is its
+	// uploads playlist, resolved on first use.
+	channelID        string
+	handle           string
+	uploadsID        string
+	discoverInterval time.Duration
+	clock            clock.Clock
+	oauth            *OAuth
+	sendTimeout      time.Duration
+	// checkpoint is the file the client's place is saved to; resumed is
+	// set while the page token came from it and hasn't been accepted yet.
+	checkpoint string
+	resumed    bool
+	// keepRaw keeps each item's JSON in its message's Raw.
+	keepRaw bool
+
+	// seen tracks delivered message IDs per liveChatId so overlapping
+	// pages and reconnects don't print the same message twice, and so
+	// messages we sent are not read back. mu guards it and liveChatID,
+	// which Send reads from other goroutines.
+	mu   sync.Mutex
+	seen map[string]*idSet
+
+	// retries counts requests retried after a transient failure.
+	retries atomic.Int64
+}
+
+// Reconnects returns how many requests have been retried after a
+// transient failure.
+func (c *Client) Reconnects() int64 {
+	return c.retries.Load()
+}
+
+// idSet is a bounded FIFO set of message IDs, each with the name of its
+// author when known, so later deletions can say whose message went.
+type idSet struct {
+	ids   map[string]string
+	order []string
+	limit int
 }
 
-func NewClient(apiKey, videoID string) *Client {
-	return &Client{
-		apiKey:      apiKey,
-		videoID:     videoID,
-		httpClient:  &http.Client{Timeout: 10 * time.Second},
-		pollingRate: 3 * time.Second,
+func newIDSet(limit int) *idSet {
+	return &idSet{ids: make(map[string]string), limit: limit}
+}
+
+// add records id and reports whether it was new.
+func (s *idSet) add(id string) bool {
+	return s.addAuthor(id, "")
+}
+
+// addAuthor records id with its author and reports whether it was new.
+// The oldest IDs are evicted once the set reaches its limit.
+func (s *idSet) addAuthor(id, author string) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = author
+	s.order = append(s.order, id)
+	if len(s.order) > s.limit {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// NewClient creates a live chat poller for videoID that draws API keys
+// from keys. The pool may be shared with other clients. With an empty
+// videoID, the channel in opts is followed instead.
+func NewClient(keys *KeyPool, videoID string, opts Options) *Client {
+	baseURL := strings.TrimRight(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
 	}
+	discover := opts.DiscoverInterval
+	if discover <= 0 {
+		discover = defaultDiscoverInterval
+	}
+	send := opts.SendTimeout
+	if send <= 0 {
+		send = defaultSendTimeout
+	}
+	c := &Client{
+		keys:             keys,
+		baseURL:          baseURL,
+		videoID:          videoID,
+		httpClient:       &http.Client{Timeout: max(10*time.Second, send)},
+		minPoll:          opts.MinPollInterval,
+		maxPoll:          opts.MaxPollInterval,
+		channelID:        opts.ChannelID,
+		handle:           opts.Handle,
+		discoverInterval: discover,
+		clock:            clock.Or(opts.Clock),
+		oauth:            opts.OAuth,
+		sendTimeout:      send,
+		checkpoint:       opts.Checkpoint,
+		keepRaw:          opts.KeepRaw,
+		seen:             make(map[string]*idSet),
+	}
+	c.setPollingRate(3 * time.Second)
+	return c
+}
+
+// setPollingRate adopts d as the wait between polls, within the client's
+// bounds.
+func (c *Client) setPollingRate(d time.Duration) {
+	if c.minPoll > 0 {
+		d = max(d, c.minPoll)
+	}
+	if c.maxPoll > 0 {
+		d = min(d, c.maxPoll)
+	}
+	c.pollingRate = d
 }
 
 // liveChatResponse represents the YouTube Live Chat API response
 type liveChatResponse struct {
-	NextPageToken         string `json:"nextPageToken"`
-	PollingIntervalMillis int    `json:"pollingIntervalMillis"`
-	Items                 []struct {
+	NextPageToken         string         `json:"nextPageToken"`
+	PollingIntervalMillis int            `json:"pollingIntervalMillis"`
+	Items                 []liveChatItem `json:"items"`
+	// OfflineAt is set once the chat has gone offline.
+	OfflineAt string `json:"offlineAt"`
+}
+
+// liveChatItem is a single liveChatMessages resource
+type liveChatItem struct {
+	ID      string `json:"id"`
+	Snippet struct {
+		// Type is e.g. "textMessageEvent", "superChatEvent",
+		// "superStickerEvent", "newSponsorEvent",
+		// "memberMilestoneChatEvent", "membershipGiftingEvent",
+		// "giftMembershipReceivedEvent", "messageDeletedEvent", or
+		// "userBannedEvent".
+		Type                string               `json:"type"`
+		PublishedAt         string               `json:"publishedAt"`
+		DisplayMessage      string               `json:"displayMessage"`
+		AuthorChannelID     string               `json:"authorChannelId"`
+		SuperChatDetails    *superChatDetails    `json:"superChatDetails"`
+		SuperStickerDetails *superStickerDetails `json:"superStickerDetails"`
+		// MessageDeletedDetails and UserBannedDetails are set on
+		// messageDeletedEvent and userBannedEvent items.
+		MessageDeletedDetails *struct {
+			DeletedMessageID string `json:"deletedMessageId"`
+		} `json:"messageDeletedDetails"`
+		UserBannedDetails *userBannedDetails `json:"userBannedDetails"`
+		// The membership details are set on the membership item types.
+		NewSponsorDetails          *membershipDetails `json:"newSponsorDetails"`
+		MemberMilestoneChatDetails *membershipDetails `json:"memberMilestoneChatDetails"`
+		MembershipGiftingDetails   *struct {
+			GiftMembershipsCount int `json:"giftMembershipsCount"`
+		} `json:"membershipGiftingDetails"`
+		GiftMembershipReceivedDetails *membershipDetails `json:"giftMembershipReceivedDetails"`
+	} `json:"snippet"`
+	AuthorDetails struct {
+		DisplayName     string `json:"displayName"`
+		IsChatOwner     bool   `json:"isChatOwner"`
+		IsChatModerator bool   `json:"isChatModerator"`
+		IsChatSponsor   bool   `json:"isChatSponsor"`
+		IsVerified      bool   `json:"isVerified"`
+	} `json:"authorDetails"`
+
+	// raw is the item's JSON as the API sent it.
+	raw []byte
+}
+
+// UnmarshalJSON decodes an item, keeping its JSON for Options.KeepRaw.
+func (item *liveChatItem) UnmarshalJSON(data []byte) error {
+	type plain liveChatItem
+	if err := json.Unmarshal(data, (*plain)(item)); err != nil {
+		return err
+	}
+	item.raw = bytes.Clone(data)
+	return nil
+}
+
+// superChatDetails is the paid part of a superChatEvent item.
+type superChatDetails struct {
+	// AmountMicros is the amount in millionths of Currency, as a string.
+	AmountMicros        string `json:"amountMicros"`
+	Currency            string `json:"currency"`
+	AmountDisplayString string `json:"amountDisplayString"`
+	UserComment         string `json:"userComment"`
+}
+
+// superStickerDetails is the paid part of a superStickerEvent item.
+type superStickerDetails struct {
+	AmountMicros         string `json:"amountMicros"`
+	Currency             string `json:"currency"`
+	AmountDisplayString  string `json:"amountDisplayString"`
+	SuperStickerMetadata struct {
+		AltText string `json:"altText"`
+	} `json:"superStickerMetadata"`
+}
+
+// userBannedDetails describes a ban or timeout in a userBannedEvent item.
+type userBannedDetails struct {
+	BannedUserDetails struct {
+		ChannelID   string `json:"channelId"`
+		DisplayName string `json:"displayName"`
+	} `json:"bannedUserDetails"`
+	// BanType is "permanent" or "temporary".
+	BanType            string      `json:"banType"`
+	BanDurationSeconds json.Number `json:"banDurationSeconds"`
+}
+
+// membershipDetails describes a new, upgraded, gifted, or long-standing
+// channel membership.
+type membershipDetails struct {
+	MemberLevelName string `json:"memberLevelName"`
+	// MemberMonth and UserComment are set on milestones.
+	MemberMonth int    `json:"memberMonth"`
+	UserComment string `json:"userComment"`
+}
+
+// channelsResponse is a channels.list response with content details.
+type channelsResponse struct {
+	Items []struct {
+		ID             string `json:"id"`
+		ContentDetails struct {
+			RelatedPlaylists struct {
+				Uploads string `json:"uploads"`
+			} `json:"relatedPlaylists"`
+		} `json:"contentDetails"`
+	} `json:"items"`
+}
+
+// channelSnippetResponse is a channels.list response with snippets.
+type channelSnippetResponse struct {
+	Items []struct {
 		Snippet struct {
-			PublishedAt     string `json:"publishedAt"`
-			DisplayMessage  string `json:"displayMessage"`
-			AuthorChannelID string `json:"authorChannelId"`
+			// CustomURL is the channel's handle, e.g. "@hackrtv".
+			CustomURL   string `json:"customUrl"`
+			PublishedAt string `json:"publishedAt"`
+			Thumbnails  struct {
+				Default struct {
+					URL string `json:"url"`
+				} `json:"default"`
+			} `json:"thumbnails"`
 		} `json:"snippet"`
-		AuthorDetails struct {
-			DisplayName string `json:"displayName"`
-		} `json:"authorDetails"`
+	} `json:"items"`
+}
+
+// playlistItemsResponse lists the video IDs in a playlist.
+type playlistItemsResponse struct {
+	Items []struct {
+		ContentDetails struct {
+			VideoID string `json:"videoId"`
+		} `json:"contentDetails"`
+	} `json:"items"`
+}
+
+// liveVideoResponse is a videos.list response with broadcast state.
+type liveVideoResponse struct {
+	Items []struct {
+		ID      string `json:"id"`
+		Snippet struct {
+			// LiveBroadcastContent is "live", "upcoming", or "none".
+			LiveBroadcastContent string `json:"liveBroadcastContent"`
+		} `json:"snippet"`
+		LiveStreamingDetails struct {
+			ActiveLiveChatID string `json:"activeLiveChatId"`
+		} `json:"liveStreamingDetails"`
 	} `json:"items"`
 }
 
@@ -59,41 +390,284 @@ type videoResponse struct {
 	} `json:"items"`
 }
 
+// Connect polls the video's live chat, or follows a channel's live
+// streams when the client has no video ID, until ctx is cancelled.
 func (c *Client) Connect(ctx context.Context, messages chan<- message.Message) error {
+	if c.videoID == "" {
+		return c.follow(ctx, messages)
+	}
+
 	// First, get the live chat ID from the video
-	if err := c.fetchLiveChatID(ctx); err != nil {
+	err := c.retry(ctx, "lookup", func() error { return c.fetchLiveChatID(ctx) })
+	if err != nil {
 		return fmt.Errorf("failed to get live chat ID: %w", err)
 	}
+	if c.resume(c.liveChatID) {
+		fmt.Fprintf(os.Stderr, "YouTube: resuming %s from its checkpoint\n", c.videoID)
+	}
+	// A chat that ends is announced by poll and ends this leg cleanly
+	if err := c.poll(ctx, messages, nil); !errors.Is(err, ErrChatEnded) {
+		return err
+	}
+	return nil
+}
 
-	// Poll for messages
-	ticker := time.NewTicker(c.pollingRate)
-	defer ticker.Stop()
+// poll fetches chat messages at the API's suggested rate, within the
+// client's bounds, until ctx is cancelled, a request fails permanently
+// (the key pool runs dry, or the chat is forbidden or gone), or the chat
+// ends, which it announces with a system event before returning
+// ErrChatEnded. Transient failures are
+// retried with exponential backoff. If recheck is set it is called every
+// discoverInterval, and poll returns nil once it reports true.
+func (c *Client) poll(ctx context.Context, messages chan<- message.Message, recheck func() bool) error {
+	var recheckC <-chan time.Time
+	if recheck != nil {
+		recheckTicker := c.clock.NewTicker(c.discoverInterval)
+		defer recheckTicker.Stop()
+		recheckC = recheckTicker.C()
+	}
+
+	fetch := func() error {
+		err := c.retry(ctx, "fetch", func() error { return c.fetchMessages(ctx, messages) })
+		if errors.Is(err, ErrChatEnded) {
+			c.announceEnd(messages)
+		}
+		return err
+	}
 
 	// Initial fetch
-	if err := c.fetchMessages(ctx, messages); err != nil {
+	if err := fetch(); err != nil {
 		return err
 	}
 
+	// Each wait follows the latest polling hint
+	next := c.clock.After(c.pollingRate)
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
-			if err := c.fetchMessages(ctx, messages); err != nil {
-				// Log error but continue polling
-				fmt.Printf("YouTube fetch error: %v\n", err)
+		case <-recheckC:
+			if recheck() {
+				return nil
+			}
+		case <-next:
+			if err := fetch(); err != nil {
+				return err
 			}
+			next = c.clock.After(c.pollingRate)
 		}
 	}
 }
 
-func (c *Client) fetchLiveChatID(ctx context.Context) error {
+// follow finds the followed channel's live stream and polls its chat,
+// moving to a new stream when the channel's live broadcast changes and
+// waiting discoverInterval between checks while it is offline.
+func (c *Client) follow(ctx context.Context, messages chan<- message.Message) error {
+	waiting := false
+	for {
+		videoID, chatID, err := c.findLiveStream(ctx)
+		switch {
+		case errors.Is(err, ErrQuotaExhausted), errors.Is(err, ErrAuth), errors.Is(err, ErrForbidden), errors.Is(err, ErrNotFound):
+			return err
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "YouTube discovery error: %v\n", err)
+		case videoID == "":
+			if !waiting {
+				fmt.Fprintf(os.Stderr, "YouTube: %s is not live, checking every %s\n", c.channelName(), c.discoverInterval)
+			}
+			waiting = true
+		default:
+			waiting = false
+			fmt.Fprintf(os.Stderr, "YouTube: following live stream %s\n", videoID)
+			c.videoID = videoID
+			c.setLiveChatID(chatID)
+			if c.resume(chatID) {
+				fmt.Fprintf(os.Stderr, "YouTube: resuming %s from its checkpoint\n", videoID)
+			}
+			err := c.poll(ctx, messages, func() bool {
+				next, _, err := c.findLiveStream(ctx)
+				return err == nil && next != videoID
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil {
+				// The broadcast changed; look again right away.
+				continue
+			}
+			// A chat that ends, or one that is forbidden or gone, sends
+			// the channel back to waiting for its next stream
+			if errors.Is(err, ErrQuotaExhausted) {
+				return err
+			}
+			if !errors.Is(err, ErrChatEnded) {
+				fmt.Fprintf(os.Stderr, "YouTube fetch error: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(c.discoverInterval):
+		}
+	}
+}
+
+// announceEnd emits a system event saying the followed chat has ended.
+func (c *Client) announceEnd(messages chan<- message.Message) {
+	announceEnd(c.clock, c.videoID, messages)
+}
+
+// announceEnd emits a system event saying videoID's chat has ended.
+func announceEnd(clk clock.Clock, videoID string, messages chan<- message.Message) {
+	messages <- message.Message{
+		Platform:  message.YouTube,
+		Type:      message.TypeSystem,
+		ID:        message.NewID(),
+		Channel:   videoID,
+		Username:  "youtube",
+		Timestamp: clk.Now(),
+		Content:   i18n.T(i18n.StreamEnded, videoID),
+	}
+}
+
+// channelName describes the followed channel for log lines.
+func (c *Client) channelName() string {
+	return cmp.Or(c.handle, c.channelID)
+}
+
+// findLiveStream returns the video and live chat IDs of the followed
+// channel's current broadcast, or empty IDs when it is not live. It
+// checks the newest uploads, which costs a few quota units where a
+// search would cost a hundred.
+func (c *Client) findLiveStream(ctx context.Context) (videoID, chatID string, err error) {
+	if c.uploadsID == "" {
+		if err := c.resolveUploads(ctx); err != nil {
+			return "", "", err
+		}
+	}
+
 	params := url.Values{}
-	params.Set("part", "liveStreamingDetails")
-	params.Set("id", c.videoID)
-	params.Set("key", c.apiKey)
+	params.Set("part", "contentDetails")
+	params.Set("playlistId", c.uploadsID)
+	params.Set("maxResults", strconv.Itoa(recentUploads))
+	var uploads playlistItemsResponse
+	if err := c.get(ctx, c.baseURL+playlistItemsPath, params, &uploads); err != nil {
+		return "", "", err
+	}
+	var ids []string
+	for _, item := range uploads.Items {
+		ids = append(ids, item.ContentDetails.VideoID)
+	}
+	if len(ids) == 0 {
+		return "", "", nil
+	}
+
+	params = url.Values{}
+	params.Set("part", "snippet,liveStreamingDetails")
+	params.Set("id", strings.Join(ids, ","))
+	var videos liveVideoResponse
+	if err := c.get(ctx, c.baseURL+videosPath, params, &videos); err != nil {
+		return "", "", err
+	}
+	for _, v := range videos.Items {
+		if v.Snippet.LiveBroadcastContent == "live" && v.LiveStreamingDetails.ActiveLiveChatID != "" {
+			return v.ID, v.LiveStreamingDetails.ActiveLiveChatID, nil
+		}
+	}
+	return "", "", nil
+}
 
-	reqURL := fmt.Sprintf("%s?%s", videosURL, params.Encode())
+// resolveUploads looks up the followed channel's uploads playlist,
+// resolving a handle to its channel on the way.
+func (c *Client) resolveUploads(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("part", "contentDetails")
+	if c.channelID != "" {
+		params.Set("id", c.channelID)
+	} else {
+		params.Set("forHandle", c.handle)
+	}
+
+	var channels channelsResponse
+	if err := c.get(ctx, c.baseURL+channelsPath, params, &channels); err != nil {
+		return err
+	}
+	if len(channels.Items) == 0 {
+		return notFoundError{"channel", c.channelName()}
+	}
+	c.channelID = channels.Items[0].ID
+	c.uploadsID = channels.Items[0].ContentDetails.RelatedPlaylists.Uploads
+	if c.uploadsID == "" {
+		return fmt.Errorf("channel %s has no uploads playlist", c.channelName())
+	}
+	return nil
+}
+
+// Profile looks up a YouTube channel, such as a chat author's, for its
+// creation date, avatar, and page. It costs one unit of API quota.
+func (c *Client) Profile(ctx context.Context, channelID string) (message.Profile, error) {
+	params := url.Values{}
+	params.Set("part", "snippet")
+	params.Set("id", channelID)
+
+	var channels channelSnippetResponse
+	if err := c.get(ctx, c.baseURL+channelsPath, params, &channels); err != nil {
+		return message.Profile{}, err
+	}
+	if len(channels.Items) == 0 {
+		return message.Profile{}, notFoundError{"channel", channelID}
+	}
+	snippet := channels.Items[0].Snippet
+	p := message.Profile{
+		Avatar: snippet.Thumbnails.Default.URL,
+		URL:    "https://www.youtube.com/channel/" + channelID,
+	}
+	p.Created, _ = time.Parse(time.RFC3339, snippet.PublishedAt)
+	if snippet.CustomURL != "" {
+		p.URL = "https://www.youtube.com/" + snippet.CustomURL
+	}
+	return p, nil
+}
+
+// apiError is the error envelope returned by Google APIs.
+type apiError struct {
+	Error struct {
+		Errors []struct {
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+// get performs a GET against endpoint with params plus an API key from the
+// pool, decoding the JSON response into out. When a key reports
+// quotaExceeded it is taken out of rotation and the request is retried
+// with the next key until the pool is exhausted.
+func (c *Client) get(ctx context.Context, endpoint string, params url.Values, out any) error {
+	for {
+		key, err := c.keys.pick()
+		if err != nil {
+			return err
+		}
+
+		err = c.getWithKey(ctx, endpoint, params, key, out)
+		if !errors.Is(err, errQuotaExceeded) {
+			return err
+		}
+
+		usage := c.keys.exhaust(key)
+		fmt.Fprintf(os.Stderr, "YouTube API key %s quota exhausted after %d requests, rotating\n", usage.Key, usage.Requests)
+	}
+}
+
+func (c *Client) getWithKey(ctx context.Context, endpoint string, params url.Values, key string, out any) error {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("key", key)
+
+	reqURL := fmt.Sprintf("%s?%s", endpoint, q.Encode())
 	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return err
@@ -101,26 +675,50 @@ func (c *Client) fetchLiveChatID(ctx context.Context) error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &APIError{Kind: ErrTransient, Err: err}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API returned status %d", resp.StatusCode)
+		var apiErr apiError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		var reasons []string
+		for _, e := range apiErr.Error.Errors {
+			reasons = append(reasons, e.Reason)
+		}
+		e := &APIError{Status: resp.StatusCode, Kind: classify(resp.StatusCode, reasons)}
+		if len(reasons) > 0 {
+			e.Reason = reasons[0]
+		}
+		return e
 	}
 
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &APIError{Status: resp.StatusCode, Kind: ErrTransient, Err: err}
+	}
+	return nil
+}
+
+func (c *Client) fetchLiveChatID(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("part", "liveStreamingDetails")
+	params.Set("id", c.videoID)
+
 	var videoResp videoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&videoResp); err != nil {
+	if err := c.get(ctx, c.baseURL+videosPath, params, &videoResp); err != nil {
 		return err
 	}
 
 	if len(videoResp.Items) == 0 {
-		return fmt.Errorf("video not found: %s", c.videoID)
+		return notFoundError{"video", c.videoID}
 	}
 
-	c.liveChatID = videoResp.Items[0].LiveStreamingDetails.ActiveLiveChatID
+	c.setLiveChatID(videoResp.Items[0].LiveStreamingDetails.ActiveLiveChatID)
 	if c.liveChatID == "" {
-		return fmt.Errorf("video %s does not have an active live chat", c.videoID)
+		return fmt.Errorf("%w: video %s does not have an active live chat", ErrNotLive, c.videoID)
 	}
 
 	return nil
@@ -130,54 +728,344 @@ func (c *Client) fetchMessages(ctx context.Context, messages chan<- message.Mess
 	params := url.Values{}
 	params.Set("part", "snippet,authorDetails")
 	params.Set("liveChatId", c.liveChatID)
-	params.Set("key", c.apiKey)
 	if c.pageToken != "" {
 		params.Set("pageToken", c.pageToken)
 	}
 
-	reqURL := fmt.Sprintf("%s?%s", liveChatMessagesURL, params.Encode())
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
+	var chatResp liveChatResponse
+	if err := c.get(ctx, c.baseURL+liveChatMessagesPath, params, &chatResp); err != nil {
+		if c.resumed && errors.Is(err, ErrForbidden) {
+			// The saved page token was rejected; start from the chat's
+			// recent messages instead
+			fmt.Fprintf(os.Stderr, "YouTube: checkpoint rejected (%v), starting over\n", err)
+			c.pageToken, c.resumed = "", false
+			return c.fetchMessages(ctx, messages)
+		}
 		return err
 	}
+	c.resumed = false
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
-
-	var chatResp liveChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return err
+	c.handleResponse(chatResp, messages)
+	c.save()
+	if chatResp.OfflineAt != "" {
+		return ErrChatEnded
 	}
+	return nil
+}
 
+// handleResponse applies paging and polling hints from a response and
+// delivers its items, skipping any already delivered for this chat. Each
+// message is tagged with its video, so simulcasts can tell chats apart.
+func (c *Client) handleResponse(chatResp liveChatResponse, messages chan<- message.Message) {
 	// Update page token for next request
 	c.pageToken = chatResp.NextPageToken
 
 	// Update polling rate if provided
 	if chatResp.PollingIntervalMillis > 0 {
-		c.pollingRate = time.Duration(chatResp.PollingIntervalMillis) * time.Millisecond
+		c.setPollingRate(time.Duration(chatResp.PollingIntervalMillis) * time.Millisecond)
 	}
 
 	// Send messages
 	for _, item := range chatResp.Items {
-		timestamp, _ := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
-		if timestamp.IsZero() {
-			timestamp = time.Now()
+		msg := itemToMessage(item, c.clock.Now())
+		msg.Channel = c.videoID
+		if c.keepRaw {
+			msg.Raw = string(item.raw)
+		}
+		if item.ID != "" && !c.markDelivered(c.liveChatID, item.ID, msg.Username) {
+			continue
+		}
+		if msg.Type == message.TypeDeletion && msg.TargetID != "" {
+			attributeDeletion(&msg, c.author(c.liveChatID, msg.TargetID))
+		}
+		messages <- msg
+	}
+}
+
+// setLiveChatID switches the chat that is polled and posted to.
+func (c *Client) setLiveChatID(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveChatID = id
+}
+
+// markSeen records a message ID for a chat, reporting false if it was
+// already there.
+func (c *Client) markSeen(chatID, id string) bool {
+	return c.markDelivered(chatID, id, "")
+}
+
+// markDelivered is markSeen for a message from author.
+func (c *Client) markDelivered(chatID, id, author string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen, ok := c.seen[chatID]
+	if !ok {
+		seen = newIDSet(seenLimit)
+		c.seen[chatID] = seen
+	}
+	return seen.addAuthor(id, author)
+}
+
+// author returns who sent a delivered message, or "" if it is unknown.
+func (c *Client) author(chatID, id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seen, ok := c.seen[chatID]; ok {
+		return seen.ids[id]
+	}
+	return ""
+}
+
+// sendRequest is a liveChatMessages.insert body.
+type sendRequest struct {
+	Snippet struct {
+		LiveChatID         string `json:"liveChatId"`
+		Type               string `json:"type"`
+		TextMessageDetails struct {
+			MessageText string `json:"messageText"`
+		} `json:"textMessageDetails"`
+	} `json:"snippet"`
+}
+
+// Send posts text to the live chat currently being polled, truncated to
+// YouTube's 200-character limit. It returns ErrReadOnly without OAuth
+// credentials and ErrNoLiveChat before a chat has been found. The posted
+// message is marked as seen so it is not read back as new chat. It gives
+// up after Options.SendTimeout.
+func (c *Client) Send(ctx context.Context, text string) error {
+	if c.oauth == nil {
+		return ErrReadOnly
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.sendTimeout)
+	defer cancel()
+	c.mu.Lock()
+	chatID := c.liveChatID
+	c.mu.Unlock()
+	if chatID == "" {
+		return ErrNoLiveChat
+	}
+
+	if r := []rune(text); len(r) > maxSendLength {
+		text = string(r[:maxSendLength])
+	}
+	var body sendRequest
+	body.Snippet.LiveChatID = chatID
+	body.Snippet.Type = "textMessageEvent"
+	body.Snippet.TextMessageDetails.MessageText = text
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	// An access token rejected as expired is refreshed and retried once
+	for attempt := 0; ; attempt++ {
+		token, err := c.oauth.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+liveChatMessagesPath+"?part=snippet", bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		var sent struct {
+			ID string `json:"id"`
 		}
+		decodeErr := json.NewDecoder(resp.Body).Decode(&sent)
+		resp.Body.Close()
 
-		messages <- message.Message{
-			Platform:  message.YouTube,
-			Username:  item.AuthorDetails.DisplayName,
-			Timestamp: timestamp,
-			Content:   item.Snippet.DisplayMessage,
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			c.oauth.Invalidate()
+			continue
+		case resp.StatusCode == http.StatusUnauthorized:
+			return fmt.Errorf("%w: send returned status %d", ErrAuth, resp.StatusCode)
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("youtube: send returned status %d", resp.StatusCode)
+		case decodeErr != nil:
+			return decodeErr
 		}
+		if sent.ID != "" {
+			c.markSeen(chatID, sent.ID)
+		}
+		return nil
 	}
+}
 
-	return nil
+// itemToMessage converts a live chat item, stamping it with now when the
+// API gives no publish time.
+func itemToMessage(item liveChatItem, now time.Time) message.Message {
+	timestamp, _ := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+
+	msg := message.Message{
+		Platform:  message.YouTube,
+		ID:        cmp.Or(item.ID, message.NewID()),
+		Username:  item.AuthorDetails.DisplayName,
+		UserID:    item.Snippet.AuthorChannelID,
+		Timestamp: timestamp,
+		Content:   item.Snippet.DisplayMessage,
+		Badges:    authorBadges(item),
+	}
+
+	// Moderator deletions and bans become retraction events, as on
+	// Twitch. The deleted message's author is filled in by the caller.
+	switch d := item.Snippet; {
+	case d.Type == "messageDeletedEvent" && d.MessageDeletedDetails != nil:
+		msg.Type = message.TypeDeletion
+		msg.TargetID = d.MessageDeletedDetails.DeletedMessageID
+		msg.Username, msg.UserID = "", ""
+		msg.Content = i18n.T(i18n.MessageDeletedAnon)
+		return msg
+	case d.Type == "userBannedEvent" && d.UserBannedDetails != nil:
+		ban := d.UserBannedDetails
+		msg.Type = message.TypeDeletion
+		msg.Username = ban.BannedUserDetails.DisplayName
+		msg.UserID = ban.BannedUserDetails.ChannelID
+		msg.Content = i18n.T(i18n.UserBanned, msg.Username)
+		if ban.BanType == "temporary" && ban.BanDurationSeconds != "" {
+			msg.Content = i18n.T(i18n.UserTimedOut, msg.Username, ban.BanDurationSeconds)
+		}
+		return msg
+	}
+
+	// Memberships are YouTube's subscriptions, shown as sub events like
+	// Twitch's. The API leaves their display message empty or generic,
+	// so the content is written here.
+	if content, ok := membershipContent(item); ok {
+		msg.Type = message.TypeSub
+		msg.Content = emojiShortcodes(content)
+		msg.Emotes = customEmoji(msg.Content)
+		return msg
+	}
+
+	// Super Chats and Super Stickers are chat with an amount attached,
+	// like Twitch cheers. A Super Chat's text is its user comment; a
+	// sticker is shown by its alt text.
+	switch d := item.Snippet; {
+	case d.Type == "superChatEvent" && d.SuperChatDetails != nil:
+		msg.Amount = amount(d.SuperChatDetails.AmountMicros, d.SuperChatDetails.Currency, d.SuperChatDetails.AmountDisplayString)
+		msg.Content = cmp.Or(d.SuperChatDetails.UserComment, msg.Content)
+	case d.Type == "superStickerEvent" && d.SuperStickerDetails != nil:
+		msg.Amount = amount(d.SuperStickerDetails.AmountMicros, d.SuperStickerDetails.Currency, d.SuperStickerDetails.AmountDisplayString)
+		msg.Content = "[sticker] " + cmp.Or(d.SuperStickerDetails.SuperStickerMetadata.AltText, "Super Sticker")
+	}
+	msg.Content = emojiShortcodes(msg.Content)
+	msg.Emotes = customEmoji(msg.Content)
+	return msg
+}
+
+// membershipContent describes a membership item, reporting false for
+// other item types.
+func membershipContent(item liveChatItem) (string, bool) {
+	name := item.AuthorDetails.DisplayName
+	d := item.Snippet
+	switch {
+	case d.Type == "newSponsorEvent":
+		var level string
+		if d.NewSponsorDetails != nil {
+			level = d.NewSponsorDetails.MemberLevelName
+		}
+		return memberNew(name, level), true
+	case d.Type == "memberMilestoneChatEvent" && d.MemberMilestoneChatDetails != nil:
+		m := d.MemberMilestoneChatDetails
+		return memberMilestone(name, m.MemberMonth, m.UserComment), true
+	case d.Type == "membershipGiftingEvent" && d.MembershipGiftingDetails != nil:
+		return memberGift(name, d.MembershipGiftingDetails.GiftMembershipsCount), true
+	case d.Type == "giftMembershipReceivedEvent":
+		return i18n.T(i18n.MemberGiftReceived, name), true
+	}
+	return "", false
+}
+
+// memberNew describes a new or upgraded member, naming the level when
+// there is one.
+func memberNew(name, level string) string {
+	content := i18n.T(i18n.MemberNew, name)
+	if level != "" {
+		content += " (" + level + ")"
+	}
+	return content
+}
+
+// memberMilestone describes a membership milestone, followed by the
+// member's comment.
+func memberMilestone(name string, months int, comment string) string {
+	content := i18n.T(i18n.MemberMilestone, name, months)
+	if comment != "" {
+		content += " — " + comment
+	}
+	return content
+}
+
+// memberGift describes count memberships gifted by name.
+func memberGift(name string, count int) string {
+	if count == 1 {
+		return i18n.T(i18n.MemberGiftOne, name)
+	}
+	return i18n.T(i18n.MemberGiftOther, name, count)
+}
+
+// shortcutPattern matches custom emoji as YouTube writes them in text,
+// e.g. ":hand-pink-waving:" or ":_channelEmote:", but not "12:30:45".
+var shortcutPattern = regexp.MustCompile(`:[A-Za-z_][\w-]*:`)
+
+// customEmoji locates the custom emoji shortcuts in content.
+func customEmoji(content string) []message.Emote {
+	var out []message.Emote
+	for _, loc := range shortcutPattern.FindAllStringIndex(content, -1) {
+		start := utf8.RuneCountInString(content[:loc[0]])
+		name := content[loc[0]:loc[1]]
+		out = append(out, message.Emote{Name: name, Start: start, End: start + utf8.RuneCountInString(name)})
+	}
+	return out
+}
+
+// authorBadges lists the sender's badges; members are sponsors in the API.
+func authorBadges(item liveChatItem) []string {
+	var badges []string
+	for _, b := range []struct {
+		name string
+		has  bool
+	}{
+		{"owner", item.AuthorDetails.IsChatOwner},
+		{"moderator", item.AuthorDetails.IsChatModerator},
+		{"member", item.AuthorDetails.IsChatSponsor},
+		{"verified", item.AuthorDetails.IsVerified},
+	} {
+		if b.has {
+			badges = append(badges, b.name)
+		}
+	}
+	return badges
+}
+
+// attributeDeletion names the author of a deleted message when it was
+// delivered earlier.
+func attributeDeletion(msg *message.Message, author string) {
+	if author == "" {
+		return
+	}
+	msg.Username = author
+	msg.Content = i18n.T(i18n.MessageDeleted, author)
+}
+
+// amount converts a Super Chat or Super Sticker price. amountMicros is a
+// decimal string; an unparseable one leaves only the display string.
+func amount(micros, currency, display string) message.Amount {
+	n, _ := strconv.ParseInt(micros, 10, 64)
+	return message.Amount{
+		Value:    float64(n) / 1e6,
+		Currency: currency,
+		Display:  display,
+	}
 }
@@ -3,18 +3,23 @@ package youtube
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"relay/internal/clock"
 	"relay/internal/message"
 )
 
 func TestNewClient(t *testing.T) {
-	c := NewClient("api-key", "video-123")
-	if c.apiKey != "api-key" {
-		t.Errorf("apiKey = %q", c.apiKey)
+	c := NewClient(NewKeyPool("api-key"), "video-123", Options{})
+	if c.keys.Len() != 1 {
+		t.Errorf("keys.Len() = %d", c.keys.Len())
 	}
 	if c.videoID != "video-123" {
 		t.Errorf("videoID = %q", c.videoID)
@@ -22,10 +27,41 @@ func TestNewClient(t *testing.T) {
 	if c.pollingRate != 3*time.Second {
 		t.Errorf("pollingRate = %v", c.pollingRate)
 	}
+	if c.baseURL != "https://www.googleapis.com/youtube/v3" {
+		t.Errorf("baseURL = %q", c.baseURL)
+	}
+}
+
+func TestNewClientBaseURL(t *testing.T) {
+	c := NewClient(NewKeyPool("k"), "v", Options{BaseURL: "https://proxy.example.com/yt/v3/"})
+	if c.baseURL != "https://proxy.example.com/yt/v3" {
+		t.Errorf("baseURL = %q, want trailing slash trimmed", c.baseURL)
+	}
+}
+
+// newTestClient returns a client whose API calls go to server.
+func newTestClient(server *httptest.Server, keys ...string) *Client {
+	c := NewClient(NewKeyPool(keys...), "video-123", Options{BaseURL: server.URL})
+	c.httpClient = server.Client()
+	return c
+}
+
+func videoWithChat(chatID string) videoResponse {
+	var resp videoResponse
+	resp.Items = make([]struct {
+		LiveStreamingDetails struct {
+			ActiveLiveChatID string `json:"activeLiveChatId"`
+		} `json:"liveStreamingDetails"`
+	}, 1)
+	resp.Items[0].LiveStreamingDetails.ActiveLiveChatID = chatID
+	return resp
 }
 
 func TestFetchLiveChatID(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/videos" {
+			t.Errorf("path = %q, want /videos", r.URL.Path)
+		}
 		// Verify request params
 		if r.URL.Query().Get("id") != "video-123" {
 			t.Errorf("expected video id param, got %q", r.URL.Query().Get("id"))
@@ -34,44 +70,16 @@ func TestFetchLiveChatID(t *testing.T) {
 			t.Errorf("expected api key param, got %q", r.URL.Query().Get("key"))
 		}
 
-		json.NewEncoder(w).Encode(videoResponse{
-			Items: []struct {
-				LiveStreamingDetails struct {
-					ActiveLiveChatID string `json:"activeLiveChatId"`
-				} `json:"liveStreamingDetails"`
-			}{
-				{LiveStreamingDetails: struct {
-					ActiveLiveChatID string `json:"activeLiveChatId"`
-				}{ActiveLiveChatID: "chat-abc"}},
-			},
-		})
+		json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
 	}))
 	defer server.Close()
 
-	c := NewClient("api-key", "video-123")
-	c.httpClient = server.Client()
-
-	// Override the URL by temporarily replacing the const via the request
-	origURL := videosURL
-	defer func() { _ = origURL }()
-
-	// Use a custom fetchLiveChatID that hits our test server
-	ctx := context.Background()
-	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"?part=liveStreamingDetails&id=video-123&key=api-key", nil)
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		t.Fatalf("request failed: %v", err)
+	c := newTestClient(server, "api-key")
+	if err := c.fetchLiveChatID(context.Background()); err != nil {
+		t.Fatalf("fetchLiveChatID() error: %v", err)
 	}
-	defer resp.Body.Close()
-
-	var videoResp videoResponse
-	json.NewDecoder(resp.Body).Decode(&videoResp)
-
-	if len(videoResp.Items) == 0 {
-		t.Fatal("expected items in response")
-	}
-	if videoResp.Items[0].LiveStreamingDetails.ActiveLiveChatID != "chat-abc" {
-		t.Errorf("unexpected chat ID: %s", videoResp.Items[0].LiveStreamingDetails.ActiveLiveChatID)
+	if c.liveChatID != "chat-abc" {
+		t.Errorf("unexpected chat ID: %s", c.liveChatID)
 	}
 }
 
@@ -81,113 +89,83 @@ func TestFetchLiveChatIDVideoNotFound(t *testing.T) {
 	}))
 	defer server.Close()
 
-	c := &Client{
-		apiKey:     "key",
-		videoID:    "bad-id",
-		httpClient: server.Client(),
+	c := newTestClient(server, "key")
+	err := c.fetchLiveChatID(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "video not found") {
+		t.Errorf("expected video not found error, got %v", err)
 	}
+}
+
+func TestFetchLiveChatIDNoActiveChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(videoWithChat(""))
+	}))
+	defer server.Close()
 
-	// Manually test the parse logic
-	ctx := context.Background()
-	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
-	resp, _ := c.httpClient.Do(req)
-	defer resp.Body.Close()
+	c := newTestClient(server, "key")
+	err := c.fetchLiveChatID(context.Background())
+	if !errors.Is(err, ErrNotLive) || !strings.Contains(err.Error(), "does not have an active live chat") {
+		t.Errorf("expected no active chat error, got %v", err)
+	}
+}
 
-	var videoResp videoResponse
-	json.NewDecoder(resp.Body).Decode(&videoResp)
+func newItem(id, publishedAt, text, author string) liveChatItem {
+	var item liveChatItem
+	item.ID = id
+	item.Snippet.PublishedAt = publishedAt
+	item.Snippet.DisplayMessage = text
+	item.AuthorDetails.DisplayName = author
+	return item
+}
 
-	if len(videoResp.Items) != 0 {
-		t.Errorf("expected empty items, got %d", len(videoResp.Items))
+func TestItemToMessageMemberships(t *testing.T) {
+	tests := []struct {
+		item string
+		want string
+	}{
+		{`{"type":"newSponsorEvent","displayMessage":"","newSponsorDetails":{"memberLevelName":"Gold","isUpgrade":false}}`, "Fan became a member (Gold)"},
+		{`{"type":"memberMilestoneChatEvent","displayMessage":"six months!","memberMilestoneChatDetails":{"userComment":"six months!","memberMonth":6,"memberLevelName":"Gold"}}`, "Fan has been a member for 6 months — six months!"},
+		{`{"type":"membershipGiftingEvent","membershipGiftingDetails":{"giftMembershipsCount":5,"giftMembershipsLevelName":"Gold"}}`, "Fan gifted 5 memberships"},
+		{`{"type":"membershipGiftingEvent","membershipGiftingDetails":{"giftMembershipsCount":1}}`, "Fan gifted a membership"},
+		{`{"type":"giftMembershipReceivedEvent","giftMembershipReceivedDetails":{"memberLevelName":"Gold"}}`, "Fan received a gift membership"},
+	}
+	for _, tt := range tests {
+		var item liveChatItem
+		if err := json.Unmarshal([]byte(`{"id":"m-1","snippet":`+tt.item+`,"authorDetails":{"displayName":"Fan","isChatSponsor":true}}`), &item); err != nil {
+			t.Fatal(err)
+		}
+		msg := itemToMessage(item, time.Now())
+		if msg.Type != message.TypeSub || msg.Content != tt.want || msg.Username != "Fan" {
+			t.Errorf("%s: %v %q from %q, want a sub event %q", item.Snippet.Type, msg.Type, msg.Content, msg.Username, tt.want)
+		}
 	}
 }
 
 func TestFetchMessages(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/liveChat/messages" {
+			t.Errorf("path = %q, want /liveChat/messages", r.URL.Path)
+		}
+		if r.URL.Query().Get("liveChatId") != "chat-abc" {
+			t.Errorf("liveChatId = %q", r.URL.Query().Get("liveChatId"))
+		}
 		json.NewEncoder(w).Encode(liveChatResponse{
 			NextPageToken:         "next-token",
 			PollingIntervalMillis: 5000,
-			Items: []struct {
-				Snippet struct {
-					PublishedAt     string `json:"publishedAt"`
-					DisplayMessage  string `json:"displayMessage"`
-					AuthorChannelID string `json:"authorChannelId"`
-				} `json:"snippet"`
-				AuthorDetails struct {
-					DisplayName string `json:"displayName"`
-				} `json:"authorDetails"`
-			}{
-				{
-					Snippet: struct {
-						PublishedAt     string `json:"publishedAt"`
-						DisplayMessage  string `json:"displayMessage"`
-						AuthorChannelID string `json:"authorChannelId"`
-					}{
-						PublishedAt:    "2025-06-15T10:30:00Z",
-						DisplayMessage: "hello from youtube",
-					},
-					AuthorDetails: struct {
-						DisplayName string `json:"displayName"`
-					}{
-						DisplayName: "YTUser",
-					},
-				},
-				{
-					Snippet: struct {
-						PublishedAt     string `json:"publishedAt"`
-						DisplayMessage  string `json:"displayMessage"`
-						AuthorChannelID string `json:"authorChannelId"`
-					}{
-						PublishedAt:    "invalid-date",
-						DisplayMessage: "bad timestamp msg",
-					},
-					AuthorDetails: struct {
-						DisplayName string `json:"displayName"`
-					}{
-						DisplayName: "User2",
-					},
-				},
+			Items: []liveChatItem{
+				newItem("msg-1", "2025-06-15T10:30:00Z", "hello from youtube", "YTUser"),
+				newItem("msg-2", "invalid-date", "bad timestamp msg", "User2"),
 			},
 		})
 	}))
 	defer server.Close()
 
-	messages := make(chan message.Message, 10)
-	ctx := context.Background()
-
-	// Manually fetch to test parsing
-	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
-	client := server.Client()
-	resp, err := client.Do(req)
-	if err != nil {
-		t.Fatalf("request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var chatResp liveChatResponse
-	json.NewDecoder(resp.Body).Decode(&chatResp)
+	c := newTestClient(server, "key")
+	c.liveChatID = "chat-abc"
 
-	if chatResp.NextPageToken != "next-token" {
-		t.Errorf("NextPageToken = %q", chatResp.NextPageToken)
-	}
-	if chatResp.PollingIntervalMillis != 5000 {
-		t.Errorf("PollingIntervalMillis = %d", chatResp.PollingIntervalMillis)
-	}
-	if len(chatResp.Items) != 2 {
-		t.Fatalf("expected 2 items, got %d", len(chatResp.Items))
-	}
-
-	// Verify message conversion
-	for _, item := range chatResp.Items {
-		timestamp, _ := time.Parse(time.RFC3339, item.Snippet.PublishedAt)
-		if timestamp.IsZero() {
-			timestamp = time.Now()
-		}
-		messages <- message.Message{
-			Platform:  message.YouTube,
-			Username:  item.AuthorDetails.DisplayName,
-			Timestamp: timestamp,
-			Content:   item.Snippet.DisplayMessage,
-		}
+	messages := make(chan message.Message, 10)
+	if err := c.fetchMessages(context.Background(), messages); err != nil {
+		t.Fatalf("fetchMessages() error: %v", err)
 	}
 	close(messages)
 
@@ -196,6 +174,15 @@ func TestFetchMessages(t *testing.T) {
 		received = append(received, msg)
 	}
 
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+	if c.pageToken != "next-token" {
+		t.Errorf("pageToken = %q", c.pageToken)
+	}
+	if c.pollingRate != 5*time.Second {
+		t.Errorf("pollingRate = %v", c.pollingRate)
+	}
 	if received[0].Username != "YTUser" {
 		t.Errorf("msg[0].Username = %q", received[0].Username)
 	}
@@ -205,6 +192,12 @@ func TestFetchMessages(t *testing.T) {
 	if received[0].Platform != message.YouTube {
 		t.Errorf("msg[0].Platform = %v", received[0].Platform)
 	}
+	if received[0].ID != "msg-1" {
+		t.Errorf("msg[0].ID = %q", received[0].ID)
+	}
+	if received[0].Channel != "video-123" {
+		t.Errorf("msg[0].Channel = %q, want the video ID", received[0].Channel)
+	}
 	expectedTime := time.Date(2025, 6, 15, 10, 30, 0, 0, time.UTC)
 	if !received[0].Timestamp.Equal(expectedTime) {
 		t.Errorf("msg[0].Timestamp = %v, want %v", received[0].Timestamp, expectedTime)
@@ -214,6 +207,200 @@ func TestFetchMessages(t *testing.T) {
 	if received[1].Username != "User2" {
 		t.Errorf("msg[1].Username = %q", received[1].Username)
 	}
+	if received[1].Timestamp.IsZero() {
+		t.Error("msg[1].Timestamp should fall back to now")
+	}
+}
+
+func TestItemToMessagePaid(t *testing.T) {
+	var superChat liveChatItem
+	json.Unmarshal([]byte(`{"id":"sc-1","snippet":{"type":"superChatEvent","publishedAt":"2025-06-15T10:30:00Z",
+		"displayMessage":"love the stream","superChatDetails":{"amountMicros":"5000000","currency":"USD",
+		"amountDisplayString":"$5.00","userComment":"love the stream","tier":2}},
+		"authorDetails":{"displayName":"Fan","isChatSponsor":true}}`), &superChat)
+	var sticker liveChatItem
+	json.Unmarshal([]byte(`{"id":"ss-1","snippet":{"type":"superStickerEvent","publishedAt":"2025-06-15T10:31:00Z",
+		"displayMessage":"","superStickerDetails":{"amountMicros":"1990000","currency":"EUR",
+		"amountDisplayString":"€1.99","superStickerMetadata":{"stickerId":"x","altText":"Dancing cat"}}},
+		"authorDetails":{"displayName":"Fan2"}}`), &sticker)
+
+	tests := []struct {
+		item    liveChatItem
+		amount  message.Amount
+		content string
+	}{
+		{superChat, message.Amount{Value: 5, Currency: "USD", Display: "$5.00"}, "love the stream"},
+		{sticker, message.Amount{Value: 1.99, Currency: "EUR", Display: "€1.99"}, "[sticker] Dancing cat"},
+		{newItem("msg-1", "2025-06-15T10:30:00Z", "plain", "User"), message.Amount{}, "plain"},
+	}
+	for _, tt := range tests {
+		msg := itemToMessage(tt.item, time.Now())
+		if msg.Amount != tt.amount || msg.Content != tt.content || msg.IsEvent() {
+			t.Errorf("itemToMessage(%s) = %+v %q, want chat with %+v %q", tt.item.ID, msg.Amount, msg.Content, tt.amount, tt.content)
+		}
+	}
+	if msg := itemToMessage(superChat, time.Now()); !msg.HasBadge("member") {
+		t.Errorf("Badges = %q, want a member badge for a sponsor", msg.Badges)
+	}
+}
+
+func TestFetchMessagesPageToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") != "prev-token" {
+			t.Errorf("pageToken = %q, want prev-token", r.URL.Query().Get("pageToken"))
+		}
+		json.NewEncoder(w).Encode(liveChatResponse{})
+	}))
+	defer server.Close()
+
+	c := newTestClient(server, "key")
+	c.pageToken = "prev-token"
+	if err := c.fetchMessages(context.Background(), make(chan message.Message, 1)); err != nil {
+		t.Fatalf("fetchMessages() error: %v", err)
+	}
+}
+
+func TestHandleResponseDedup(t *testing.T) {
+	c := NewClient(NewKeyPool("key"), "video", Options{})
+	c.liveChatID = "chat-1"
+	messages := make(chan message.Message, 10)
+
+	c.handleResponse(liveChatResponse{Items: []liveChatItem{
+		newItem("a", "2025-06-15T10:30:00Z", "one", "u"),
+		newItem("b", "2025-06-15T10:30:01Z", "two", "u"),
+	}}, messages)
+
+	// Overlapping page repeats "b"
+	c.handleResponse(liveChatResponse{Items: []liveChatItem{
+		newItem("b", "2025-06-15T10:30:01Z", "two", "u"),
+		newItem("c", "2025-06-15T10:30:02Z", "three", "u"),
+	}}, messages)
+
+	// A different chat has its own history
+	c.liveChatID = "chat-2"
+	c.handleResponse(liveChatResponse{Items: []liveChatItem{
+		newItem("a", "2025-06-15T11:00:00Z", "other chat", "u"),
+	}}, messages)
+	close(messages)
+
+	var got []string
+	for msg := range messages {
+		got = append(got, msg.Content)
+	}
+
+	want := []string{"one", "two", "three", "other chat"}
+	if len(got) != len(want) {
+		t.Fatalf("delivered %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("delivered[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHandleResponseKeepsRaw(t *testing.T) {
+	// The item has a field the client doesn't parse
+	const item = `{"id":"a","snippet":{"type":"textMessageEvent","displayMessage":"hi","hasDisplayContent":true},"authorDetails":{"displayName":"u"}}`
+	var resp liveChatResponse
+	if err := json.Unmarshal([]byte(`{"items":[`+item+`]}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, keep := range []bool{false, true} {
+		c := NewClient(NewKeyPool("key"), "video", Options{KeepRaw: keep})
+		c.liveChatID = "chat-1"
+		messages := make(chan message.Message, 1)
+		c.handleResponse(resp, messages)
+
+		want := ""
+		if keep {
+			want = item
+		}
+		if msg := <-messages; msg.Raw != want {
+			t.Errorf("KeepRaw %v: Raw = %s, want %s", keep, msg.Raw, want)
+		}
+	}
+}
+
+func TestHandleResponseDeletions(t *testing.T) {
+	c := NewClient(NewKeyPool("key"), "video", Options{})
+	c.liveChatID = "chat-1"
+	messages := make(chan message.Message, 10)
+
+	var deleted, unknown, banned, timedOut liveChatItem
+	json.Unmarshal([]byte(`{"id":"d-1","snippet":{"type":"messageDeletedEvent","messageDeletedDetails":{"deletedMessageId":"a"}},
+		"authorDetails":{"displayName":"Mod"}}`), &deleted)
+	json.Unmarshal([]byte(`{"id":"d-2","snippet":{"type":"messageDeletedEvent","messageDeletedDetails":{"deletedMessageId":"old"}}}`), &unknown)
+	json.Unmarshal([]byte(`{"id":"b-1","snippet":{"type":"userBannedEvent","userBannedDetails":{
+		"bannedUserDetails":{"channelId":"UC1","displayName":"Spammer"},"banType":"permanent"}}}`), &banned)
+	json.Unmarshal([]byte(`{"id":"b-2","snippet":{"type":"userBannedEvent","userBannedDetails":{
+		"bannedUserDetails":{"channelId":"UC2","displayName":"Heckler"},"banType":"temporary","banDurationSeconds":"300"}}}`), &timedOut)
+
+	c.handleResponse(liveChatResponse{Items: []liveChatItem{
+		newItem("a", "2025-06-15T10:30:00Z", "buy followers", "Spammer"),
+		deleted, unknown, banned, timedOut,
+	}}, messages)
+	close(messages)
+
+	<-messages
+	tests := []struct {
+		target, username, content string
+	}{
+		{"a", "Spammer", "message from Spammer deleted"},
+		{"old", "", "message deleted"},
+		{"", "Spammer", "Spammer banned"},
+		{"", "Heckler", "Heckler timed out for 300s"},
+	}
+	for _, tt := range tests {
+		msg := <-messages
+		if msg.Type != message.TypeDeletion || msg.TargetID != tt.target || msg.Username != tt.username || msg.Content != tt.content {
+			t.Errorf("got %v %q %q %q, want deletion %q %q %q", msg.Type, msg.TargetID, msg.Username, msg.Content, tt.target, tt.username, tt.content)
+		}
+	}
+}
+
+func TestCustomEmoji(t *testing.T) {
+	got := customEmoji("hé :hand-pink-waving: at 12:30:45 :_chanEmote:")
+	want := []message.Emote{
+		{Name: ":hand-pink-waving:", Start: 3, End: 21},
+		{Name: ":_chanEmote:", Start: 34, End: 46},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("customEmoji() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("customEmoji()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEmojiShortcodes(t *testing.T) {
+	tests := map[string]string{
+		"gg :face-with-tears-of-joy::joy:":    "gg 😂😂",
+		"nice :thumbs-up: :hand-pink-waving:": "nice 👍 :hand-pink-waving:",
+		"at 12:30:45 :fire:":                  "at 12:30:45 🔥",
+		"no codes":                            "no codes",
+	}
+	for in, want := range tests {
+		if got := emojiShortcodes(in); got != want {
+			t.Errorf("emojiShortcodes(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIDSetEviction(t *testing.T) {
+	s := newIDSet(2)
+	s.add("a")
+	s.add("b")
+	s.add("c")
+
+	if !s.add("a") {
+		t.Error("oldest ID should have been evicted")
+	}
+	if s.add("c") {
+		t.Error("recent ID should still be remembered")
+	}
 }
 
 func TestFetchMessagesAPIError(t *testing.T) {
@@ -222,16 +409,319 @@ func TestFetchMessagesAPIError(t *testing.T) {
 	}))
 	defer server.Close()
 
-	ctx := context.Background()
-	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
-	client := server.Client()
-	resp, err := client.Do(req)
+	c := newTestClient(server, "key")
+	err := c.fetchMessages(context.Background(), make(chan message.Message, 1))
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("expected status 500 error, got %v", err)
+	}
+}
+
+func TestGetRotatesOnQuotaExceeded(t *testing.T) {
+	var keysUsed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		keysUsed = append(keysUsed, key)
+		if key == "spent-key" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"code":403,"errors":[{"reason":"quotaExceeded"}]}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(liveChatResponse{NextPageToken: "tok"})
+	}))
+	defer server.Close()
+
+	c := newTestClient(server, "spent-key", "fresh-key")
+
+	var resp liveChatResponse
+	if err := c.get(context.Background(), server.URL, nil, &resp); err != nil {
+		t.Fatalf("get() error: %v", err)
+	}
+	if resp.NextPageToken != "tok" {
+		t.Errorf("NextPageToken = %q", resp.NextPageToken)
+	}
+	if len(keysUsed) != 2 || keysUsed[0] != "spent-key" || keysUsed[1] != "fresh-key" {
+		t.Errorf("keys used = %q, want spent then fresh", keysUsed)
+	}
+
+	// The spent key stays out of rotation
+	keysUsed = nil
+	c.get(context.Background(), server.URL, nil, &resp)
+	c.get(context.Background(), server.URL, nil, &resp)
+	for _, k := range keysUsed {
+		if k == "spent-key" {
+			t.Errorf("exhausted key reused: %q", keysUsed)
+		}
+	}
+}
+
+func TestGetAllKeysExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":{"errors":[{"reason":"quotaExceeded"}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(server, "a", "b")
+
+	var resp liveChatResponse
+	err := c.get(context.Background(), server.URL, nil, &resp)
+	if err != ErrQuotaExhausted {
+		t.Errorf("get() error = %v, want ErrQuotaExhausted", err)
+	}
+}
+
+func TestGetForbiddenOtherReason(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":{"errors":[{"reason":"forbidden"}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(server, "a", "b")
+
+	var resp liveChatResponse
+	err := c.get(context.Background(), server.URL, nil, &resp)
+	if err == nil || err == ErrQuotaExhausted {
+		t.Errorf("get() error = %v, want plain 403 error", err)
+	}
+	if usage := c.keys.Usage(); usage[0].Exhausted || usage[1].Exhausted {
+		t.Errorf("non-quota 403 must not exhaust keys: %+v", usage)
+	}
+}
+
+func TestFindLiveStream(t *testing.T) {
+	var channelCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/channels":
+			channelCalls++
+			if q.Get("forHandle") != "@hackrtv" {
+				t.Errorf("forHandle = %q", q.Get("forHandle"))
+			}
+			w.Write([]byte(`{"items":[{"id":"UC123","contentDetails":{"relatedPlaylists":{"uploads":"UU123"}}}]}`))
+		case "/playlistItems":
+			if q.Get("playlistId") != "UU123" {
+				t.Errorf("playlistId = %q", q.Get("playlistId"))
+			}
+			w.Write([]byte(`{"items":[{"contentDetails":{"videoId":"old"}},{"contentDetails":{"videoId":"now"}}]}`))
+		case "/videos":
+			if q.Get("id") != "old,now" {
+				t.Errorf("id = %q", q.Get("id"))
+			}
+			w.Write([]byte(`{"items":[
+				{"id":"old","snippet":{"liveBroadcastContent":"none"}},
+				{"id":"now","snippet":{"liveBroadcastContent":"live"},"liveStreamingDetails":{"activeLiveChatId":"chat-now"}}
+			]}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(NewKeyPool("k"), "", Options{BaseURL: server.URL, Handle: "@hackrtv"})
+	c.httpClient = server.Client()
+	for range 2 {
+		videoID, chatID, err := c.findLiveStream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if videoID != "now" || chatID != "chat-now" {
+			t.Errorf("findLiveStream() = %q, %q; want now, chat-now", videoID, chatID)
+		}
+	}
+	if channelCalls != 1 {
+		t.Errorf("channels looked up %d times, want the uploads playlist cached", channelCalls)
+	}
+}
+
+func TestFindLiveStreamOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/channels":
+			w.Write([]byte(`{"items":[{"id":"UC123","contentDetails":{"relatedPlaylists":{"uploads":"UU123"}}}]}`))
+		case "/playlistItems":
+			w.Write([]byte(`{"items":[{"contentDetails":{"videoId":"vod"}}]}`))
+		case "/videos":
+			w.Write([]byte(`{"items":[{"id":"vod","snippet":{"liveBroadcastContent":"none"}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(NewKeyPool("k"), "", Options{BaseURL: server.URL, ChannelID: "UC123"})
+	c.httpClient = server.Client()
+	videoID, _, err := c.findLiveStream(context.Background())
+	if err != nil || videoID != "" {
+		t.Errorf("findLiveStream() = %q, %v; want no live stream", videoID, err)
+	}
+}
+
+func TestConnectPollsOnClock(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/videos":
+			json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
+		case "/liveChat/messages":
+			n := polls.Add(1)
+			// No publishedAt, so the message is stamped by the clock.
+			fmt.Fprintf(w, `{"items":[{"id":"m%d","snippet":{"type":"textMessageEvent","displayMessage":"hi"},"authorDetails":{"displayName":"a"}}]}`, n)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	c := NewClient(NewKeyPool("k"), "video-123", Options{BaseURL: server.URL, Clock: fake})
+	c.httpClient = server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := make(chan message.Message, 10)
+	go c.Connect(ctx, messages)
+
+	if msg := <-messages; !msg.Timestamp.Equal(start) {
+		t.Errorf("Timestamp = %v, want the clock's time %v", msg.Timestamp, start)
+	}
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := polls.Load(); got != 1 {
+		t.Fatalf("polled %d times before the clock moved, want 1", got)
+	}
+	fake.Advance(3 * time.Second)
+	if msg := <-messages; !msg.Timestamp.Equal(start.Add(3 * time.Second)) {
+		t.Errorf("Timestamp = %v, want %v", msg.Timestamp, start.Add(3*time.Second))
+	}
+}
+
+func TestConnectEndsWithChat(t *testing.T) {
+	tests := []struct {
+		name string
+		chat http.HandlerFunc
+	}{
+		{"offlineAt", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"items":[{"id":"last","snippet":{"displayMessage":"gg"},"authorDetails":{"displayName":"a"}}],"offlineAt":"2025-01-15T15:00:00Z"}`))
+		}},
+		{"liveChatEnded", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"code":403,"errors":[{"reason":"liveChatEnded"}]}}`))
+		}},
+		{"liveChatNotFound", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"errors":[{"reason":"liveChatNotFound"}]}}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/videos" {
+					json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
+					return
+				}
+				tt.chat(w, r)
+			}))
+			defer server.Close()
+
+			c := newTestClient(server, "k")
+			messages := make(chan message.Message, 10)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.Connect(ctx, messages); err != nil {
+				t.Fatalf("Connect() = %v, want a clean end", err)
+			}
+			close(messages)
+			var last message.Message
+			for msg := range messages {
+				last = msg
+			}
+			if last.Type != message.TypeSystem || !strings.Contains(last.Content, "stream ended") {
+				t.Errorf("last message = %+v, want a stream ended event", last)
+			}
+		})
+	}
+}
+
+func TestPollingBounds(t *testing.T) {
+	c := NewClient(NewKeyPool("k"), "v", Options{MinPollInterval: 10 * time.Second, MaxPollInterval: 20 * time.Second})
+	if c.pollingRate != 10*time.Second {
+		t.Errorf("initial pollingRate = %v, want the 10s floor", c.pollingRate)
+	}
+	for _, tt := range []struct {
+		millis int
+		want   time.Duration
+	}{{2000, 10 * time.Second}, {15000, 15 * time.Second}, {60000, 20 * time.Second}} {
+		c.handleResponse(liveChatResponse{PollingIntervalMillis: tt.millis}, make(chan message.Message))
+		if c.pollingRate != tt.want {
+			t.Errorf("pollingIntervalMillis %d: pollingRate = %v, want %v", tt.millis, c.pollingRate, tt.want)
+		}
+	}
+}
+
+func TestConnectFollowsPollingHint(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/videos":
+			json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
+		case "/liveChat/messages":
+			n := polls.Add(1)
+			fmt.Fprintf(w, `{"pollingIntervalMillis":2000,"items":[{"id":"m%d","snippet":{"displayMessage":"hi"},"authorDetails":{"displayName":"a"}}]}`, n)
+		}
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	c := NewClient(NewKeyPool("k"), "video-123", Options{BaseURL: server.URL, Clock: fake, MinPollInterval: 10 * time.Second})
+	c.httpClient = server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := make(chan message.Message, 10)
+	go c.Connect(ctx, messages)
+
+	<-messages
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(9 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if got := polls.Load(); got != 1 {
+		t.Fatalf("polled %d times before the 10s floor, want 1", got)
+	}
+	fake.Advance(time.Second)
+	<-messages
+	if got := polls.Load(); got != 2 {
+		t.Errorf("polled %d times at the floor, want 2", got)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != channelsPath || r.URL.Query().Get("id") != "UCfan" || r.URL.Query().Get("part") != "snippet" {
+			t.Errorf("request = %s", r.URL)
+		}
+		w.Write([]byte(`{"items":[{"snippet":{"customUrl":"@fan","publishedAt":"2019-03-01T12:00:00Z","thumbnails":{"default":{"url":"https://yt3.ggpht.com/fan.jpg"}}}}]}`))
+	}))
+	defer server.Close()
+
+	p, err := newTestClient(server, "key").Profile(context.Background(), "UCfan")
 	if err != nil {
-		t.Fatalf("request failed: %v", err)
+		t.Fatal(err)
 	}
-	defer resp.Body.Close()
+	if p.URL != "https://www.youtube.com/@fan" || p.Avatar != "https://yt3.ggpht.com/fan.jpg" ||
+		!p.Created.Equal(time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Profile() = %+v", p)
+	}
+}
+
+func TestProfileNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
 
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("expected 500, got %d", resp.StatusCode)
+	if _, err := newTestClient(server, "key").Profile(context.Background(), "UCgone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Profile() = %v, want ErrNotFound", err)
 	}
 }
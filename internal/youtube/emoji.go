@@ -0,0 +1,236 @@
+package youtube
+
+import "strings"
+
+// standardEmoji maps the shortcodes YouTube writes standard emoji as,
+// e.g. ":face-with-tears-of-joy:" or its short form ":joy:", to the
+// emoji. Codes not listed, such as YouTube's own ":hand-pink-waving:"
+// and channel emoji, have no Unicode form and are left as custom emoji.
+var standardEmoji = map[string]string{
+	// Faces
+	"grinning-face":                   "😀",
+	"grinning":                        "😀",
+	"grinning-face-with-big-eyes":     "😃",
+	"smiley":                          "😃",
+	"grinning-face-with-smiling-eyes": "😄",
+	"smile":                           "😄",
+	"beaming-face-with-smiling-eyes":  "😁",
+	"grin":                            "😁",
+	"grinning-squinting-face":         "😆",
+	"laughing":                        "😆",
+	"grinning-face-with-sweat":        "😅",
+	"sweat_smile":                     "😅",
+	"rolling-on-the-floor-laughing":   "🤣",
+	"rofl":                            "🤣",
+	"face-with-tears-of-joy":          "😂",
+	"joy":                             "😂",
+	"slightly-smiling-face":           "🙂",
+	"upside-down-face":                "🙃",
+	"winking-face":                    "😉",
+	"wink":                            "😉",
+	"smiling-face-with-smiling-eyes":  "😊",
+	"blush":                           "😊",
+	"smiling-face-with-halo":          "😇",
+	"innocent":                        "😇",
+	"smiling-face-with-hearts":        "🥰",
+	"smiling-face-with-heart-eyes":    "😍",
+	"heart_eyes":                      "😍",
+	"star-struck":                     "🤩",
+	"face-blowing-a-kiss":             "😘",
+	"kissing_heart":                   "😘",
+	"face-savoring-food":              "😋",
+	"yum":                             "😋",
+	"winking-face-with-tongue":        "😜",
+	"stuck_out_tongue_winking_eye":    "😜",
+	"money-mouth-face":                "🤑",
+	"hugging-face":                    "🤗",
+	"thinking-face":                   "🤔",
+	"thinking":                        "🤔",
+	"zipper-mouth-face":               "🤐",
+	"neutral-face":                    "😐",
+	"expressionless-face":             "😑",
+	"face-without-mouth":              "😶",
+	"smirking-face":                   "😏",
+	"smirk":                           "😏",
+	"unamused-face":                   "😒",
+	"unamused":                        "😒",
+	"face-with-rolling-eyes":          "🙄",
+	"roll_eyes":                       "🙄",
+	"grimacing-face":                  "😬",
+	"relieved-face":                   "😌",
+	"pensive-face":                    "😔",
+	"sleepy-face":                     "😪",
+	"sleeping-face":                   "😴",
+	"sleeping":                        "😴",
+	"face-with-medical-mask":          "😷",
+	"nauseated-face":                  "🤢",
+	"hot-face":                        "🥵",
+	"cold-face":                       "🥶",
+	"woozy-face":                      "🥴",
+	"exploding-head":                  "🤯",
+	"partying-face":                   "🥳",
+	"smiling-face-with-sunglasses":    "😎",
+	"sunglasses":                      "😎",
+	"nerd-face":                       "🤓",
+	"confused-face":                   "😕",
+	"confused":                        "😕",
+	"worried-face":                    "😟",
+	"frowning-face":                   "☹️",
+	"face-with-open-mouth":            "😮",
+	"open_mouth":                      "😮",
+	"astonished-face":                 "😲",
+	"astonished":                      "😲",
+	"flushed-face":                    "😳",
+	"flushed":                         "😳",
+	"pleading-face":                   "🥺",
+	"fearful-face":                    "😨",
+	"anxious-face-with-sweat":         "😰",
+	"crying-face":                     "😢",
+	"cry":                             "😢",
+	"loudly-crying-face":              "😭",
+	"sob":                             "😭",
+	"face-screaming-in-fear":          "😱",
+	"scream":                          "😱",
+	"downcast-face-with-sweat":        "😓",
+	"weary-face":                      "😩",
+	"tired-face":                      "😫",
+	"yawning-face":                    "🥱",
+	"face-with-steam-from-nose":       "😤",
+	"pouting-face":                    "😡",
+	"rage":                            "😡",
+	"angry-face":                      "😠",
+	"angry":                           "😠",
+	"face-with-symbols-on-mouth":      "🤬",
+	"skull":                           "💀",
+	"pile-of-poo":                     "💩",
+	"clown-face":                      "🤡",
+	"ghost":                           "👻",
+	"alien":                           "👽",
+	"robot":                           "🤖",
+	"see-no-evil-monkey":              "🙈",
+	"see_no_evil":                     "🙈",
+
+	// Hands and people
+	"waving-hand":        "👋",
+	"wave":               "👋",
+	"ok-hand":            "👌",
+	"ok_hand":            "👌",
+	"victory-hand":       "✌️",
+	"crossed-fingers":    "🤞",
+	"sign-of-the-horns":  "🤘",
+	"metal":              "🤘",
+	"thumbs-up":          "👍",
+	"thumbsup":           "👍",
+	"thumbs-down":        "👎",
+	"thumbsdown":         "👎",
+	"raised-fist":        "✊",
+	"oncoming-fist":      "👊",
+	"punch":              "👊",
+	"clapping-hands":     "👏",
+	"clap":               "👏",
+	"raising-hands":      "🙌",
+	"raised_hands":       "🙌",
+	"folded-hands":       "🙏",
+	"pray":               "🙏",
+	"flexed-biceps":      "💪",
+	"muscle":             "💪",
+	"eyes":               "👀",
+	"brain":              "🧠",
+	"person-facepalming": "🤦",
+	"facepalm":           "🤦",
+	"person-shrugging":   "🤷",
+	"shrug":              "🤷",
+
+	// Hearts and symbols
+	"red-heart":            "❤️",
+	"heart":                "❤️",
+	"orange-heart":         "🧡",
+	"yellow-heart":         "💛",
+	"green-heart":          "💚",
+	"blue-heart":           "💙",
+	"purple-heart":         "💜",
+	"black-heart":          "🖤",
+	"white-heart":          "🤍",
+	"broken-heart":         "💔",
+	"broken_heart":         "💔",
+	"sparkling-heart":      "💖",
+	"two-hearts":           "💕",
+	"hundred-points":       "💯",
+	"collision":            "💥",
+	"boom":                 "💥",
+	"sparkles":             "✨",
+	"high-voltage":         "⚡",
+	"zap":                  "⚡",
+	"fire":                 "🔥",
+	"star":                 "⭐",
+	"glowing-star":         "🌟",
+	"check-mark-button":    "✅",
+	"white_check_mark":     "✅",
+	"cross-mark":           "❌",
+	"x":                    "❌",
+	"warning":              "⚠️",
+	"red-question-mark":    "❓",
+	"question":             "❓",
+	"red-exclamation-mark": "❗",
+	"exclamation":          "❗",
+	"musical-note":         "🎵",
+	"musical_note":         "🎵",
+	"speech-balloon":       "💬",
+	"zzz":                  "💤",
+
+	// Objects and celebrations
+	"party-popper":           "🎉",
+	"tada":                   "🎉",
+	"confetti-ball":          "🎊",
+	"wrapped-gift":           "🎁",
+	"gift":                   "🎁",
+	"birthday-cake":          "🎂",
+	"birthday":               "🎂",
+	"balloon":                "🎈",
+	"trophy":                 "🏆",
+	"crown":                  "👑",
+	"gem-stone":              "💎",
+	"gem":                    "💎",
+	"money-bag":              "💰",
+	"moneybag":               "💰",
+	"money-with-wings":       "💸",
+	"rocket":                 "🚀",
+	"video-game":             "🎮",
+	"video_game":             "🎮",
+	"headphone":              "🎧",
+	"headphones":             "🎧",
+	"microphone":             "🎤",
+	"light-bulb":             "💡",
+	"bulb":                   "💡",
+	"bell":                   "🔔",
+	"hot-beverage":           "☕",
+	"coffee":                 "☕",
+	"pizza":                  "🍕",
+	"popcorn":                "🍿",
+	"beer-mug":               "🍺",
+	"beer":                   "🍺",
+	"globe-showing-americas": "🌎",
+	"sun":                    "☀️",
+	"rainbow":                "🌈",
+	"snowflake":              "❄️",
+	"goat":                   "🐐",
+	"cat-face":               "🐱",
+	"cat":                    "🐱",
+	"dog-face":               "🐶",
+	"dog":                    "🐶",
+	"snake":                  "🐍",
+}
+
+// emojiShortcodes replaces the standard emoji shortcodes in content with
+// the emoji, leaving custom emoji and other text between colons alone.
+func emojiShortcodes(content string) string {
+	if !strings.Contains(content, ":") {
+		return content
+	}
+	return shortcutPattern.ReplaceAllStringFunc(content, func(code string) string {
+		if emoji, ok := standardEmoji[strings.Trim(code, ":")]; ok {
+			return emoji
+		}
+		return code
+	})
+}
@@ -0,0 +1,142 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Failed Data API requests are classified by wrapping one of these, so
+// callers can test them with errors.Is. Quota exhaustion across the whole
+// key pool is ErrQuotaExhausted and an ended chat is ErrChatEnded.
+var (
+	// ErrAuth is a 401: the API refused the OAuth access token. Refused
+	// or revoked OAuth grants wrap it too.
+	ErrAuth = errors.New("youtube: unauthorized")
+	// ErrForbidden is a request the API rejected, e.g. for an invalid key
+	// or a private video: a 403 other than an exhausted quota or a closed
+	// chat, or another 4xx. Retrying won't help.
+	ErrForbidden = errors.New("youtube: request forbidden")
+	// ErrNotFound is a 404, or an empty lookup for a video or channel.
+	ErrNotFound = errors.New("youtube: not found")
+	// ErrTransient is a failure worth retrying: a network error, a 5xx,
+	// or a rate limit.
+	ErrTransient = errors.New("youtube: temporary failure")
+	// ErrRateLimit is a 429 or a rate limit reason. It is an
+	// ErrTransient, so it is retried.
+	ErrRateLimit = fmt.Errorf("%w: rate limited", ErrTransient)
+)
+
+// errQuotaExceeded marks a 403 quotaExceeded response for the key used.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// minRetryBackoff and maxRetryBackoff bound the wait between retries of
+// a transient failure.
+const (
+	minRetryBackoff = 2 * time.Second
+	maxRetryBackoff = 2 * time.Minute
+)
+
+// APIError is a failed Data API request.
+type APIError struct {
+	// Status is the HTTP status, or 0 when no response arrived.
+	Status int
+	// Reason is Google's error reason, e.g. "forbidden", when given.
+	Reason string
+	// Kind is the classification: ErrAuth, ErrForbidden, ErrNotFound,
+	// ErrTransient, ErrRateLimit, ErrChatEnded, or errQuotaExceeded.
+	Kind error
+	// Err is the underlying transport or decoding error, if any.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Status == 0:
+		return fmt.Sprintf("youtube: %v", e.Err)
+	case e.Reason != "":
+		return fmt.Sprintf("youtube: API returned status %d (%s)", e.Status, e.Reason)
+	default:
+		return fmt.Sprintf("youtube: API returned status %d", e.Status)
+	}
+}
+
+func (e *APIError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// notFoundError is an empty lookup for a video or channel.
+type notFoundError struct {
+	what, id string
+}
+
+func (e notFoundError) Error() string {
+	return e.what + " not found: " + e.id
+}
+
+func (e notFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// classify returns the kind of a failed response with the given status
+// and Google error reasons.
+func classify(status int, reasons []string) error {
+	for _, reason := range reasons {
+		switch reason {
+		case "quotaExceeded", "dailyLimitExceeded":
+			return errQuotaExceeded
+		case "liveChatEnded", "liveChatNotFound", "liveChatDisabled":
+			return ErrChatEnded
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			return ErrRateLimit
+		}
+	}
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrAuth
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimit
+	case status >= 500:
+		return ErrTransient
+	case status >= 400:
+		return ErrForbidden
+	default:
+		return ErrTransient
+	}
+}
+
+// retryable reports whether err may clear up on its own. Errors that are
+// not classified, such as a truncated response, count as retryable.
+func retryable(err error) bool {
+	for _, permanent := range []error{ErrQuotaExhausted, ErrAuth, ErrForbidden, ErrNotFound, ErrChatEnded, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// retry calls fn until it succeeds, fails permanently, or ctx is
+// cancelled, backing off exponentially after transient failures.
+func (c *Client) retry(ctx context.Context, what string, fn func() error) error {
+	backoff := minRetryBackoff
+	for {
+		err := fn()
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "YouTube %s error: %v; retrying in %s\n", what, err, backoff)
+		c.retries.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,129 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+func TestGetClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"forbidden", http.StatusForbidden, `{"error":{"errors":[{"reason":"forbidden"}]}}`, ErrForbidden},
+		{"bad key", http.StatusBadRequest, `{"error":{"errors":[{"reason":"keyInvalid"}]}}`, ErrForbidden},
+		{"not found", http.StatusNotFound, `{"error":{"errors":[{"reason":"videoNotFound"}]}}`, ErrNotFound},
+		{"chat ended", http.StatusForbidden, `{"error":{"errors":[{"reason":"liveChatEnded"}]}}`, ErrChatEnded},
+		{"rate limited", http.StatusForbidden, `{"error":{"errors":[{"reason":"rateLimitExceeded"}]}}`, ErrTransient},
+		{"rate limit reason", http.StatusForbidden, `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`, ErrRateLimit},
+		{"too many requests", http.StatusTooManyRequests, ``, ErrRateLimit},
+		{"unauthorized", http.StatusUnauthorized, `{"error":{"errors":[{"reason":"authError"}]}}`, ErrAuth},
+		{"server error", http.StatusInternalServerError, ``, ErrTransient},
+		{"unavailable", http.StatusServiceUnavailable, `<html>busy</html>`, ErrTransient},
+		{"quota", http.StatusForbidden, `{"error":{"errors":[{"reason":"quotaExceeded"}]}}`, ErrQuotaExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := newTestClient(server, "key")
+			var resp liveChatResponse
+			err := c.get(context.Background(), server.URL, nil, &resp)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("get() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectBacksOffOnTransientErrors(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/videos":
+			json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
+		case "/liveChat/messages":
+			if polls.Add(1) <= 2 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{"items":[{"id":"m1","snippet":{"displayMessage":"back"},"authorDetails":{"displayName":"a"}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	c := NewClient(NewKeyPool("k"), "video-123", Options{BaseURL: server.URL, Clock: fake})
+	c.httpClient = server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := make(chan message.Message, 10)
+	go c.Connect(ctx, messages)
+
+	// The first retry's backoff; the next poll isn't scheduled until
+	// the first succeeds
+	for fake.Waiters() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(minRetryBackoff)
+	for polls.Load() < 2 || fake.Waiters() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// The second retry waits twice as long
+	fake.Advance(minRetryBackoff)
+	time.Sleep(10 * time.Millisecond)
+	if n := polls.Load(); n != 2 {
+		t.Fatalf("polls before the doubled backoff = %d, want 2", n)
+	}
+	fake.Advance(minRetryBackoff)
+	if msg := <-messages; msg.Content != "back" {
+		t.Errorf("message = %+v, want the one after recovery", msg)
+	}
+}
+
+func TestConnectStopsOnPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"forbidden", `{"error":{"errors":[{"reason":"forbidden"}]}}`, ErrForbidden},
+		{"quota", `{"error":{"errors":[{"reason":"quotaExceeded"}]}}`, ErrQuotaExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/videos" {
+					json.NewEncoder(w).Encode(videoWithChat("chat-abc"))
+					return
+				}
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := newTestClient(server, "k")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.Connect(ctx, make(chan message.Message, 10)); !errors.Is(err, tt.want) {
+				t.Errorf("Connect() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package youtube
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/i18n"
+	"relay/internal/message"
+)
+
+const (
+	defaultInnerTubeURL = "https://www.youtube.com"
+
+	liveChatPagePath = "/live_chat"
+	getLiveChatPath  = "/youtubei/v1/live_chat/get_live_chat"
+
+	// defaultClientVersion is sent when the chat page does not name one.
+	defaultClientVersion = "2.20250101.00.00"
+	// maxPage is how much of the chat page is read looking for its data.
+	maxPage = 4 << 20
+
+	// minInnerTubePoll and maxInnerTubePoll bound the wait the endpoint
+	// asks for between polls.
+	minInnerTubePoll = time.Second
+	maxInnerTubePoll = 5 * time.Second
+)
+
+// InnerTubeOptions configures a key-less InnerTube client.
+type InnerTubeOptions struct {
+	// BaseURL overrides https://www.youtube.com, for proxies or mock
+	// servers.
+	BaseURL string
+	// Clock paces polling. Defaults to the wall clock.
+	Clock clock.Clock
+	// KeepRaw sets each chat message's Raw to the JSON of the item it
+	// came from.
+	KeepRaw bool
+}
+
+// InnerTubeClient reads a live chat through the web player's public
+// InnerTube endpoint, the way yt-dlp does, so no API key or Google Cloud
+// project is needed. It is read-only and follows a single video.
+type InnerTubeClient struct {
+	baseURL    string
+	videoID    string
+	httpClient *http.Client
+	clock      clock.Clock
+	keepRaw    bool
+
+	apiKey        string
+	clientVersion string
+	continuation  string
+	pollingRate   time.Duration
+	seen          *idSet
+
+	// retries counts polls retried after a failed fetch.
+	retries atomic.Int64
+}
+
+// Reconnects returns how many polls have been retried after a failed
+// fetch.
+func (c *InnerTubeClient) Reconnects() int64 {
+	return c.retries.Load()
+}
+
+// NewInnerTubeClient creates a key-less live chat reader for videoID.
+func NewInnerTubeClient(videoID string, opts InnerTubeOptions) *InnerTubeClient {
+	baseURL := strings.TrimRight(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultInnerTubeURL
+	}
+	return &InnerTubeClient{
+		baseURL:     baseURL,
+		videoID:     videoID,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		clock:       clock.Or(opts.Clock),
+		keepRaw:     opts.KeepRaw,
+		pollingRate: 3 * time.Second,
+		seen:        newIDSet(seenLimit),
+	}
+}
+
+// innerTubeChat is the shape shared by the chat page's liveChatRenderer
+// and get_live_chat's liveChatContinuation.
+type innerTubeChat struct {
+	Continuations []struct {
+		Invalidation *innerTubeContinuation `json:"invalidationContinuationData"`
+		Timed        *innerTubeContinuation `json:"timedContinuationData"`
+		Reload       *innerTubeContinuation `json:"reloadContinuationData"`
+	} `json:"continuations"`
+	Actions []struct {
+		AddChatItemAction *struct {
+			Item innerTubeItem `json:"item"`
+		} `json:"addChatItemAction"`
+		MarkChatItemAsDeletedAction *struct {
+			TargetItemID string `json:"targetItemId"`
+		} `json:"markChatItemAsDeletedAction"`
+	} `json:"actions"`
+}
+
+type innerTubeContinuation struct {
+	Continuation string `json:"continuation"`
+	TimeoutMs    int    `json:"timeoutMs"`
+}
+
+// next returns the continuation to poll with and how long to wait first.
+func (c innerTubeChat) next() (innerTubeContinuation, bool) {
+	for _, cont := range c.Continuations {
+		for _, data := range []*innerTubeContinuation{cont.Invalidation, cont.Timed, cont.Reload} {
+			if data != nil && data.Continuation != "" {
+				return *data, true
+			}
+		}
+	}
+	return innerTubeContinuation{}, false
+}
+
+// innerTubeItem holds the renderers relayed as chat and membership
+// events. Other items are ignored.
+type innerTubeItem struct {
+	Text    *innerTubeRenderer `json:"liveChatTextMessageRenderer"`
+	Paid    *innerTubeRenderer `json:"liveChatPaidMessageRenderer"`
+	Sticker *innerTubeRenderer `json:"liveChatPaidStickerRenderer"`
+	// Membership is a new or upgraded member, or a milestone when it
+	// has a HeaderPrimaryText.
+	Membership     *innerTubeRenderer     `json:"liveChatMembershipItemRenderer"`
+	GiftPurchase   *innerTubeGiftPurchase `json:"liveChatSponsorshipsGiftPurchaseAnnouncementRenderer"`
+	GiftRedemption *innerTubeRenderer     `json:"liveChatSponsorshipsGiftRedemptionAnnouncementRenderer"`
+
+	// raw is the item's JSON as the page sent it.
+	raw []byte
+}
+
+// UnmarshalJSON decodes an item, keeping its JSON for
+// InnerTubeOptions.KeepRaw.
+func (item *innerTubeItem) UnmarshalJSON(data []byte) error {
+	type plain innerTubeItem
+	if err := json.Unmarshal(data, (*plain)(item)); err != nil {
+		return err
+	}
+	item.raw = bytes.Clone(data)
+	return nil
+}
+
+type innerTubeRenderer struct {
+	ID                 string        `json:"id"`
+	TimestampUsec      string        `json:"timestampUsec"`
+	AuthorName         innerTubeText `json:"authorName"`
+	AuthorChannelID    string        `json:"authorExternalChannelId"`
+	Message            innerTubeText `json:"message"`
+	PurchaseAmountText innerTubeText `json:"purchaseAmountText"`
+	AuthorBadges       []struct {
+		Renderer struct {
+			Icon *struct {
+				IconType string `json:"iconType"`
+			} `json:"icon"`
+			// CustomThumbnail is the channel's membership badge image.
+			CustomThumbnail *json.RawMessage `json:"customThumbnail"`
+		} `json:"liveChatAuthorBadgeRenderer"`
+	} `json:"authorBadges"`
+	// HeaderPrimaryText is a milestone's "Member for 6 months", and
+	// HeaderSubtext a new member's "Welcome to Gold!" or a milestone's
+	// level.
+	HeaderPrimaryText innerTubeText `json:"headerPrimaryText"`
+	HeaderSubtext     innerTubeText `json:"headerSubtext"`
+	// PrimaryText is a gift purchase's "Gifted 5 memberships".
+	PrimaryText innerTubeText `json:"primaryText"`
+	Sticker     struct {
+		Accessibility struct {
+			AccessibilityData struct {
+				Label string `json:"label"`
+			} `json:"accessibilityData"`
+		} `json:"accessibility"`
+	} `json:"sticker"`
+}
+
+// innerTubeGiftPurchase announces gifted memberships. The gifter is
+// named in its header.
+type innerTubeGiftPurchase struct {
+	ID              string `json:"id"`
+	TimestampUsec   string `json:"timestampUsec"`
+	AuthorChannelID string `json:"authorExternalChannelId"`
+	Header          struct {
+		Renderer innerTubeRenderer `json:"liveChatSponsorshipsHeaderRenderer"`
+	} `json:"header"`
+}
+
+// innerTubeText is either a simple string or a list of text and emoji
+// runs.
+type innerTubeText struct {
+	SimpleText string `json:"simpleText"`
+	Runs       []struct {
+		Text  string `json:"text"`
+		Emoji *struct {
+			EmojiID       string   `json:"emojiId"`
+			Shortcuts     []string `json:"shortcuts"`
+			IsCustomEmoji bool     `json:"isCustomEmoji"`
+			Image         struct {
+				Thumbnails []struct {
+					URL string `json:"url"`
+				} `json:"thumbnails"`
+			} `json:"image"`
+		} `json:"emoji"`
+	} `json:"runs"`
+}
+
+// String flattens the text. Custom channel emoji are written as their
+// shortcut, e.g. ":hand-pink-waving:".
+func (t innerTubeText) String() string {
+	if t.SimpleText != "" {
+		return t.SimpleText
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		switch {
+		case run.Emoji == nil:
+			b.WriteString(run.Text)
+		case run.Emoji.IsCustomEmoji && len(run.Emoji.Shortcuts) > 0:
+			b.WriteString(run.Emoji.Shortcuts[0])
+		default:
+			b.WriteString(run.Emoji.EmojiID)
+		}
+	}
+	return b.String()
+}
+
+// emojiImages maps the text's custom emoji shortcuts to their smallest
+// picture.
+func (t innerTubeText) emojiImages() map[string]string {
+	var out map[string]string
+	for _, run := range t.Runs {
+		if e := run.Emoji; e != nil && e.IsCustomEmoji && len(e.Shortcuts) > 0 && len(e.Image.Thumbnails) > 0 {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[e.Shortcuts[0]] = e.Image.Thumbnails[0].URL
+		}
+	}
+	return out
+}
+
+// Connect loads the video's chat page and polls for new messages until
+// ctx is cancelled or the chat ends, which is announced with a system
+// event and returns nil.
+func (c *InnerTubeClient) Connect(ctx context.Context, messages chan<- message.Message) error {
+	chat, err := c.loadPage(ctx)
+	if err != nil {
+		return err
+	}
+	if !c.advance(chat) {
+		return fmt.Errorf("%w: no live chat for video %s", ErrNotLive, c.videoID)
+	}
+	c.deliver(chat, messages)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(c.pollingRate):
+		}
+		chat, err := c.fetch(ctx)
+		if errors.Is(err, ErrChatEnded) {
+			announceEnd(c.clock, c.videoID, messages)
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "YouTube fetch error: %v\n", err)
+			c.retries.Add(1)
+			continue
+		}
+		c.advance(chat)
+		c.deliver(chat, messages)
+	}
+}
+
+var (
+	initialDataPattern   = regexp.MustCompile(`ytInitialData"?\]?\s*=\s*`)
+	apiKeyPattern        = regexp.MustCompile(`"INNERTUBE_API_KEY"\s*:\s*"([^"]+)"`)
+	clientVersionPattern = regexp.MustCompile(`"INNERTUBE_CONTEXT_CLIENT_VERSION"\s*:\s*"([^"]+)"`)
+)
+
+// loadPage fetches the popout chat page and reads the API key, client
+// version, first continuation, and recent messages embedded in it.
+func (c *InnerTubeClient) loadPage(ctx context.Context) (innerTubeChat, error) {
+	params := url.Values{"v": {c.videoID}, "is_popout": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+liveChatPagePath+"?"+params.Encode(), nil)
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+	// The page only embeds chat data for browser-like clients
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return innerTubeChat{}, fmt.Errorf("chat page returned status %d", resp.StatusCode)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPage))
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+
+	if m := apiKeyPattern.FindSubmatch(page); m != nil {
+		c.apiKey = string(m[1])
+	}
+	c.clientVersion = defaultClientVersion
+	if m := clientVersionPattern.FindSubmatch(page); m != nil {
+		c.clientVersion = string(m[1])
+	}
+
+	loc := initialDataPattern.FindIndex(page)
+	if loc == nil {
+		return innerTubeChat{}, fmt.Errorf("%w: no live chat for video %s", ErrNotLive, c.videoID)
+	}
+	// The decoder stops at the end of the object, before the script's ";"
+	var data struct {
+		Contents struct {
+			LiveChatRenderer innerTubeChat `json:"liveChatRenderer"`
+		} `json:"contents"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(page[loc[1]:])).Decode(&data); err != nil {
+		return innerTubeChat{}, fmt.Errorf("decoding chat page: %w", err)
+	}
+	return data.Contents.LiveChatRenderer, nil
+}
+
+// innerTubeRequest is the get_live_chat request body.
+type innerTubeRequest struct {
+	Context struct {
+		Client struct {
+			ClientName    string `json:"clientName"`
+			ClientVersion string `json:"clientVersion"`
+		} `json:"client"`
+	} `json:"context"`
+	Continuation string `json:"continuation"`
+}
+
+// fetch polls get_live_chat with the current continuation. A response
+// without a continuation means the chat has ended.
+func (c *InnerTubeClient) fetch(ctx context.Context) (innerTubeChat, error) {
+	var body innerTubeRequest
+	body.Context.Client.ClientName = "WEB"
+	body.Context.Client.ClientVersion = c.clientVersion
+	body.Continuation = c.continuation
+	data, err := json.Marshal(body)
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+
+	params := url.Values{"prettyPrint": {"false"}}
+	if c.apiKey != "" {
+		params.Set("key", c.apiKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+getLiveChatPath+"?"+params.Encode(), bytes.NewReader(data))
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return innerTubeChat{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return innerTubeChat{}, fmt.Errorf("get_live_chat returned status %d", resp.StatusCode)
+	}
+
+	var chatResp struct {
+		ContinuationContents *struct {
+			LiveChatContinuation innerTubeChat `json:"liveChatContinuation"`
+		} `json:"continuationContents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return innerTubeChat{}, fmt.Errorf("decoding get_live_chat: %w", err)
+	}
+	if chatResp.ContinuationContents == nil {
+		return innerTubeChat{}, ErrChatEnded
+	}
+	chat := chatResp.ContinuationContents.LiveChatContinuation
+	if _, ok := chat.next(); !ok {
+		return innerTubeChat{}, ErrChatEnded
+	}
+	return chat, nil
+}
+
+// advance moves to chat's continuation and adopts its polling hint,
+// reporting false if it has none.
+func (c *InnerTubeClient) advance(chat innerTubeChat) bool {
+	next, ok := chat.next()
+	if !ok {
+		return false
+	}
+	c.continuation = next.Continuation
+	if next.TimeoutMs > 0 {
+		wait := time.Duration(next.TimeoutMs) * time.Millisecond
+		c.pollingRate = min(max(wait, minInnerTubePoll), maxInnerTubePoll)
+	}
+	return true
+}
+
+// deliver sends chat's new messages, skipping any already delivered,
+// and retractions for messages a moderator deleted.
+func (c *InnerTubeClient) deliver(chat innerTubeChat, messages chan<- message.Message) {
+	for _, action := range chat.Actions {
+		if del := action.MarkChatItemAsDeletedAction; del != nil && del.TargetItemID != "" {
+			msg := message.Message{
+				Platform:  message.YouTube,
+				Type:      message.TypeDeletion,
+				ID:        message.NewID(),
+				TargetID:  del.TargetItemID,
+				Channel:   c.videoID,
+				Timestamp: c.clock.Now(),
+				Content:   i18n.T(i18n.MessageDeletedAnon),
+			}
+			attributeDeletion(&msg, c.seen.ids[del.TargetItemID])
+			messages <- msg
+			continue
+		}
+		if action.AddChatItemAction == nil {
+			continue
+		}
+		msg, ok := innerTubeToMessage(action.AddChatItemAction.Item, c.clock.Now())
+		if !ok || (msg.ID != "" && !c.seen.addAuthor(msg.ID, msg.Username)) {
+			continue
+		}
+		msg.Channel = c.videoID
+		if c.keepRaw {
+			msg.Raw = string(action.AddChatItemAction.Item.raw)
+		}
+		messages <- msg
+	}
+}
+
+// innerTubeToMessage converts a chat item, stamping it with now when it
+// has no timestamp. Paid messages and stickers carry their amount like
+// the Data API's Super Chats, and memberships are sub events like its
+// membership items.
+func innerTubeToMessage(item innerTubeItem, now time.Time) (message.Message, bool) {
+	var r *innerTubeRenderer
+	switch {
+	case item.Text != nil:
+		r = item.Text
+	case item.Paid != nil:
+		r = item.Paid
+	case item.Sticker != nil:
+		r = item.Sticker
+	case item.Membership != nil:
+		r = item.Membership
+	case item.GiftPurchase != nil:
+		g := item.GiftPurchase
+		r = &g.Header.Renderer
+		r.ID, r.TimestampUsec, r.AuthorChannelID = g.ID, g.TimestampUsec, g.AuthorChannelID
+	case item.GiftRedemption != nil:
+		r = item.GiftRedemption
+	default:
+		return message.Message{}, false
+	}
+
+	timestamp := now
+	if usec, err := strconv.ParseInt(r.TimestampUsec, 10, 64); err == nil {
+		timestamp = time.UnixMicro(usec)
+	}
+	msg := message.Message{
+		Platform:  message.YouTube,
+		ID:        cmp.Or(r.ID, message.NewID()),
+		Username:  r.AuthorName.String(),
+		UserID:    r.AuthorChannelID,
+		Timestamp: timestamp,
+		Content:   r.Message.String(),
+	}
+	// Icon badges are OWNER, MODERATOR, and VERIFIED; membership badges
+	// are the channel's own images instead
+	for _, b := range r.AuthorBadges {
+		switch {
+		case b.Renderer.Icon != nil:
+			msg.Badges = append(msg.Badges, strings.ToLower(b.Renderer.Icon.IconType))
+		case b.Renderer.CustomThumbnail != nil:
+			msg.Badges = append(msg.Badges, "member")
+		}
+	}
+	if item.Paid != nil || item.Sticker != nil {
+		msg.Amount = parsePurchase(r.PurchaseAmountText.String())
+	}
+	if item.Sticker != nil {
+		label := r.Sticker.Accessibility.AccessibilityData.Label
+		if label == "" {
+			label = "Super Sticker"
+		}
+		msg.Content = "[sticker] " + label
+	}
+	if content, ok := item.membershipContent(msg.Username); ok {
+		msg.Type = message.TypeSub
+		msg.Content = content
+	}
+	msg.Content = emojiShortcodes(msg.Content)
+	msg.Emotes = customEmoji(msg.Content)
+	images := r.Message.emojiImages()
+	for i, e := range msg.Emotes {
+		msg.Emotes[i].Image = images[e.Name]
+	}
+	return msg, true
+}
+
+// countPattern finds the count in membership text such as "Member for
+// 6 months" or "Gifted 5 memberships".
+var countPattern = regexp.MustCompile(`\d+`)
+
+// membershipContent describes a membership item as the Data API client
+// does, reporting false for chat. The page is requested in English, so
+// counts and levels are read from YouTube's English text: the level is
+// the highlighted run of a new member's "Welcome to Gold!".
+func (item innerTubeItem) membershipContent(name string) (string, bool) {
+	switch {
+	case item.Membership != nil && item.Membership.HeaderPrimaryText.String() != "":
+		m := item.Membership
+		months, _ := strconv.Atoi(countPattern.FindString(m.HeaderPrimaryText.String()))
+		return memberMilestone(name, months, m.Message.String()), true
+	case item.Membership != nil:
+		var level string
+		if runs := item.Membership.HeaderSubtext.Runs; len(runs) > 1 {
+			level = runs[1].Text
+		}
+		return memberNew(name, level), true
+	case item.GiftPurchase != nil:
+		count, err := strconv.Atoi(countPattern.FindString(item.GiftPurchase.Header.Renderer.PrimaryText.String()))
+		if err != nil {
+			count = 1
+		}
+		return memberGift(name, count), true
+	case item.GiftRedemption != nil:
+		return i18n.T(i18n.MemberGiftReceived, name), true
+	}
+	return "", false
+}
+
+// purchaseSymbols maps the prefixes YouTube shows on Super Chat amounts
+// to ISO 4217 codes.
+var purchaseSymbols = map[string]string{
+	"$": "USD", "US$": "USD", "CA$": "CAD", "A$": "AUD", "NZ$": "NZD",
+	"MX$": "MXN", "HK$": "HKD", "NT$": "TWD", "R$": "BRL", "€": "EUR",
+	"£": "GBP", "¥": "JPY", "₹": "INR", "₩": "KRW", "₱": "PHP", "₪": "ILS",
+}
+
+// parsePurchase reads an amount such as "$5.00", "€1.234,50", or
+// "CHF 10.00". An amount it cannot read keeps only its display string.
+func parsePurchase(display string) message.Amount {
+	a := message.Amount{Display: display}
+	start := strings.IndexAny(display, "0123456789")
+	if start < 0 {
+		return a
+	}
+	end := strings.LastIndexAny(display, "0123456789") + 1
+	symbol := strings.TrimSpace(display[:start] + display[end:])
+	a.Currency = purchaseSymbols[symbol]
+	if a.Currency == "" && len(symbol) == 3 && strings.ToUpper(symbol) == symbol {
+		a.Currency = symbol
+	}
+
+	// The last separator is the decimal point when it has at most two
+	// digits after it; every other separator groups thousands
+	number := display[start:end]
+	if i := strings.LastIndexAny(number, ".,"); i >= 0 && len(number)-i-1 <= 2 {
+		number = strings.NewReplacer(".", "", ",", "", " ", "", " ", "").Replace(number[:i]) + "." + number[i+1:]
+	} else {
+		number = strings.NewReplacer(".", "", ",", "", " ", "", " ", "").Replace(number)
+	}
+	a.Value, _ = strconv.ParseFloat(number, 64)
+	return a
+}
@@ -0,0 +1,186 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+	"relay/internal/message"
+)
+
+const chatPage = `<html><script>window["ytInitialData"] = {"contents":{"liveChatRenderer":{
+"continuations":[{"invalidationContinuationData":{"continuation":"cont-1","timeoutMs":10000}}],
+"actions":[{"addChatItemAction":{"item":{"liveChatTextMessageRenderer":{
+  "id":"msg-1","timestampUsec":"1736951445000000","authorName":{"simpleText":"ytfan"},
+  "authorBadges":[{"liveChatAuthorBadgeRenderer":{"customThumbnail":{"thumbnails":[]},"tooltip":"Member (1 year)"}},{"liveChatAuthorBadgeRenderer":{"icon":{"iconType":"MODERATOR"}}}],
+  "message":{"runs":[{"text":"hello "},{"emoji":{"emojiId":"👋"}},{"text":" "},{"emoji":{"emojiId":"UC/x","shortcuts":[":hand-pink-waving:"],"isCustomEmoji":true,"image":{"thumbnails":[{"url":"https://yt3.ggpht.com/wave=w24-h24"},{"url":"https://yt3.ggpht.com/wave=w48-h48"}]}}}]}}}}}]
+}}};</script><script>ytcfg.set({"INNERTUBE_API_KEY":"public-key","INNERTUBE_CONTEXT_CLIENT_VERSION":"2.20250115.01.00"});</script></html>`
+
+func TestInnerTubeConnect(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case liveChatPagePath:
+			if r.URL.Query().Get("v") != "video-123" {
+				t.Errorf("v = %q", r.URL.Query().Get("v"))
+			}
+			w.Write([]byte(chatPage))
+		case getLiveChatPath:
+			if r.URL.Query().Get("key") != "public-key" {
+				t.Errorf("key = %q, want the page's key", r.URL.Query().Get("key"))
+			}
+			var body innerTubeRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Context.Client.ClientVersion != "2.20250115.01.00" {
+				t.Errorf("clientVersion = %q", body.Context.Client.ClientVersion)
+			}
+			switch polls.Add(1) {
+			case 1:
+				if body.Continuation != "cont-1" {
+					t.Errorf("continuation = %q, want cont-1", body.Continuation)
+				}
+				// A repeat of msg-1, a Super Chat, and msg-1 deleted
+				w.Write([]byte(`{"continuationContents":{"liveChatContinuation":{
+				"continuations":[{"timedContinuationData":{"continuation":"cont-2","timeoutMs":2000}}],
+				"actions":[
+				  {"addChatItemAction":{"item":{"liveChatTextMessageRenderer":{"id":"msg-1","authorName":{"simpleText":"ytfan"},"message":{"simpleText":"hello"}}}}},
+				  {"addChatItemAction":{"item":{"liveChatPaidMessageRenderer":{"id":"msg-2","authorName":{"simpleText":"donor"},"purchaseAmountText":{"simpleText":"€1.234,50"},"message":{"simpleText":"gg"}}}}},
+				  {"markChatItemAsDeletedAction":{"deletedStateMessage":{"simpleText":"[message retracted]"},"targetItemId":"msg-1"}}
+				]}}}`))
+			default:
+				if body.Continuation != "cont-2" {
+					t.Errorf("continuation = %q, want cont-2", body.Continuation)
+				}
+				// The stream has ended
+				w.Write([]byte(`{"responseContext":{}}`))
+			}
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	c := NewInnerTubeClient("video-123", InnerTubeOptions{BaseURL: server.URL, Clock: fake})
+	messages := make(chan message.Message, 10)
+	done := make(chan error)
+	go func() { done <- c.Connect(context.Background(), messages) }()
+
+	first := <-messages
+	if first.ID != "msg-1" || first.Content != "hello 👋 :hand-pink-waving:" || first.Username != "ytfan" || first.Channel != "video-123" {
+		t.Errorf("first = %+v", first)
+	}
+	if len(first.Emotes) != 1 || first.Emotes[0].Name != ":hand-pink-waving:" || first.Emotes[0].Image != "https://yt3.ggpht.com/wave=w24-h24" {
+		t.Errorf("Emotes = %+v, want the custom emoji and its picture", first.Emotes)
+	}
+	if !first.HasBadge("member") || !first.HasBadge("moderator") {
+		t.Errorf("Badges = %q, want member and moderator", first.Badges)
+	}
+	if !first.Timestamp.Equal(time.Date(2025, 1, 15, 14, 30, 45, 0, time.UTC)) {
+		t.Errorf("timestamp = %v", first.Timestamp)
+	}
+
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The page asked for 10s, which is capped
+	fake.Advance(maxInnerTubePoll)
+	paid := <-messages
+	want := message.Amount{Value: 1234.5, Currency: "EUR", Display: "€1.234,50"}
+	if paid.ID != "msg-2" || paid.Amount != want || paid.Content != "gg" {
+		t.Errorf("paid = %+v", paid)
+	}
+	del := <-messages
+	if del.Type != message.TypeDeletion || del.TargetID != "msg-1" || del.Content != "message from ytfan deleted" {
+		t.Errorf("deletion = %+v", del)
+	}
+
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(2 * time.Second)
+	if end := <-messages; end.Type != message.TypeSystem {
+		t.Errorf("end = %+v, want a system event", end)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Connect() = %v, want nil after the chat ends", err)
+	}
+}
+
+func TestInnerTubeKeepsRaw(t *testing.T) {
+	const item = `{"liveChatTextMessageRenderer":{"id":"msg-1","authorName":{"simpleText":"ytfan"},"message":{"simpleText":"hello"},"contextMenuEndpoint":{}}}`
+	var chat innerTubeChat
+	if err := json.Unmarshal([]byte(`{"actions":[{"addChatItemAction":{"item":`+item+`}}]}`), &chat); err != nil {
+		t.Fatal(err)
+	}
+	c := NewInnerTubeClient("video-123", InnerTubeOptions{KeepRaw: true})
+	messages := make(chan message.Message, 1)
+	c.deliver(chat, messages)
+	if msg := <-messages; msg.Raw != item {
+		t.Errorf("Raw = %s, want the item's JSON %s", msg.Raw, item)
+	}
+}
+
+func TestInnerTubeMemberships(t *testing.T) {
+	tests := []struct {
+		item string
+		want string
+	}{
+		{`{"liveChatMembershipItemRenderer":{"id":"m-1","authorName":{"simpleText":"Fan"},"headerSubtext":{"runs":[{"text":"Welcome to "},{"text":"Gold"},{"text":"!"}]}}}`, "Fan became a member (Gold)"},
+		{`{"liveChatMembershipItemRenderer":{"id":"m-2","authorName":{"simpleText":"Fan"},"headerSubtext":{"simpleText":"New member"}}}`, "Fan became a member"},
+		{`{"liveChatMembershipItemRenderer":{"id":"m-3","authorName":{"simpleText":"Fan"},"headerPrimaryText":{"runs":[{"text":"Member for "},{"text":"6"},{"text":" months"}]},"headerSubtext":{"simpleText":"Gold"},"message":{"runs":[{"text":"six months!"}]}}}`, "Fan has been a member for 6 months — six months!"},
+		{`{"liveChatSponsorshipsGiftPurchaseAnnouncementRenderer":{"id":"m-4","timestampUsec":"1736951445000000","header":{"liveChatSponsorshipsHeaderRenderer":{"authorName":{"simpleText":"Fan"},"primaryText":{"runs":[{"text":"Gifted "},{"text":"5"},{"text":" "},{"text":"Channel"},{"text":" memberships"}]}}}}}`, "Fan gifted 5 memberships"},
+		{`{"liveChatSponsorshipsGiftPurchaseAnnouncementRenderer":{"id":"m-5","header":{"liveChatSponsorshipsHeaderRenderer":{"authorName":{"simpleText":"Fan"},"primaryText":{"runs":[{"text":"Gifted "},{"text":"1"},{"text":" "},{"text":"Channel"},{"text":" membership"}]}}}}}`, "Fan gifted a membership"},
+		{`{"liveChatSponsorshipsGiftRedemptionAnnouncementRenderer":{"id":"m-6","authorName":{"simpleText":"Fan"},"message":{"runs":[{"text":"received a gift membership by "},{"text":"Gifter"}]}}}`, "Fan received a gift membership"},
+	}
+	for _, tt := range tests {
+		var item innerTubeItem
+		if err := json.Unmarshal([]byte(tt.item), &item); err != nil {
+			t.Fatal(err)
+		}
+		msg, ok := innerTubeToMessage(item, time.Now())
+		if !ok || msg.Type != message.TypeSub || msg.Content != tt.want || msg.Username != "Fan" || msg.ID == "" {
+			t.Errorf("%s: %v %q from %q, want a sub event %q", tt.item, msg.Type, msg.Content, msg.Username, tt.want)
+		}
+	}
+}
+
+func TestInnerTubeNoChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>Chat is disabled for this live stream.</html>`))
+	}))
+	defer server.Close()
+
+	c := NewInnerTubeClient("video-123", InnerTubeOptions{BaseURL: server.URL})
+	if err := c.Connect(context.Background(), make(chan message.Message, 1)); err == nil {
+		t.Error("Connect() should fail without a live chat")
+	}
+}
+
+func TestParsePurchase(t *testing.T) {
+	tests := []struct {
+		display  string
+		value    float64
+		currency string
+	}{
+		{"$5.00", 5, "USD"},
+		{"CA$10.00", 10, "CAD"},
+		{"€1.234,50", 1234.5, "EUR"},
+		{"¥1,000", 1000, "JPY"},
+		{"CHF 20.00", 20, "CHF"},
+		{"R$ 25,00", 25, "BRL"},
+		{"₩10,000", 10000, "KRW"},
+		{"free", 0, ""},
+	}
+	for _, tt := range tests {
+		a := parsePurchase(tt.display)
+		if a.Value != tt.value || a.Currency != tt.currency || a.Display != tt.display {
+			t.Errorf("parsePurchase(%q) = %+v, want %v %s", tt.display, a, tt.value, tt.currency)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package youtube
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExhausted is returned when every key in the pool has hit its
+// daily quota.
+var ErrQuotaExhausted = errors.New("youtube: all API keys have exhausted their quota")
+
+// KeyPool rotates requests across one or more API keys and takes keys
+// out of rotation until the daily quota reset once they report
+// quotaExceeded. A pool may be shared by several clients.
+type KeyPool struct {
+	mu   sync.Mutex
+	keys []*apiKey
+	next int
+	now  func() time.Time
+}
+
+type apiKey struct {
+	key       string
+	requests  int
+	exhausted time.Time // zero, or when the key's quota resets
+}
+
+// KeyUsage is a per-key accounting snapshot.
+type KeyUsage struct {
+	// Key is the masked API key, e.g. "…f00d".
+	Key       string
+	Requests  int
+	Exhausted bool
+}
+
+// NewKeyPool creates a pool from the given keys, skipping empty and
+// duplicate entries.
+func NewKeyPool(keys ...string) *KeyPool {
+	p := &KeyPool{now: time.Now}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		p.keys = append(p.keys, &apiKey{key: k})
+	}
+	return p
+}
+
+// Len returns the number of keys in the pool.
+func (p *KeyPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+// pick returns the next usable key in round-robin order and counts the
+// request against it.
+func (p *KeyPool) pick() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for i := 0; i < len(p.keys); i++ {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if !k.exhausted.IsZero() && now.Before(k.exhausted) {
+			continue
+		}
+		k.exhausted = time.Time{}
+		k.requests++
+		p.next = (p.next + i + 1) % len(p.keys)
+		return k.key, nil
+	}
+	return "", ErrQuotaExhausted
+}
+
+// exhaust takes key out of rotation until the next quota reset and
+// returns its usage so far.
+func (p *KeyPool) exhaust(key string) KeyUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k.key == key {
+			k.exhausted = nextQuotaReset(p.now())
+			return KeyUsage{Key: maskKey(k.key), Requests: k.requests, Exhausted: true}
+		}
+	}
+	return KeyUsage{Key: maskKey(key)}
+}
+
+// Usage returns per-key request counts and exhaustion state.
+func (p *KeyPool) Usage() []KeyUsage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	out := make([]KeyUsage, len(p.keys))
+	for i, k := range p.keys {
+		out[i] = KeyUsage{
+			Key:       maskKey(k.key),
+			Requests:  k.requests,
+			Exhausted: !k.exhausted.IsZero() && now.Before(k.exhausted),
+		}
+	}
+	return out
+}
+
+// nextQuotaReset returns the next midnight Pacific time, when YouTube
+// Data API quotas reset. Falls back to 24h if tzdata is unavailable.
+func nextQuotaReset(now time.Time) time.Time {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return now.Add(24 * time.Hour)
+	}
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// maskKey hides all but the last four characters of a key for logging.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "…"
+	}
+	return "…" + key[len(key)-4:]
+}
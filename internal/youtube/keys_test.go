@@ -0,0 +1,71 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	p := NewKeyPool("key-a", "key-b", "", "key-a")
+	if p.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2 (empty and duplicate skipped)", p.Len())
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		k, err := p.pick()
+		if err != nil {
+			t.Fatalf("pick() error: %v", err)
+		}
+		got = append(got, k)
+	}
+
+	want := []string{"key-a", "key-b", "key-a", "key-b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pick %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	usage := p.Usage()
+	if usage[0].Requests != 2 || usage[1].Requests != 2 {
+		t.Errorf("usage = %+v, want 2 requests each", usage)
+	}
+	if usage[0].Key != "…ey-a" {
+		t.Errorf("masked key = %q", usage[0].Key)
+	}
+}
+
+func TestKeyPoolExhaustion(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	p := NewKeyPool("key-a", "key-b")
+	p.now = func() time.Time { return now }
+
+	p.exhaust("key-a")
+	for i := 0; i < 3; i++ {
+		k, err := p.pick()
+		if err != nil || k != "key-b" {
+			t.Fatalf("pick() = %q, %v; want key-b", k, err)
+		}
+	}
+
+	p.exhaust("key-b")
+	if _, err := p.pick(); err != ErrQuotaExhausted {
+		t.Errorf("pick() error = %v, want ErrQuotaExhausted", err)
+	}
+
+	// After the daily reset keys come back
+	now = now.Add(25 * time.Hour)
+	if _, err := p.pick(); err != nil {
+		t.Errorf("pick() after reset error: %v", err)
+	}
+}
+
+func TestNextQuotaReset(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	reset := nextQuotaReset(now)
+
+	if !reset.After(now) || reset.Sub(now) > 24*time.Hour {
+		t.Errorf("nextQuotaReset(%v) = %v, want within the next 24h", now, reset)
+	}
+}
@@ -0,0 +1,266 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"relay/internal/clock"
+)
+
+const (
+	defaultDeviceCodeURL = "https://oauth2.googleapis.com/device/code"
+	defaultTokenURL      = "https://oauth2.googleapis.com/token"
+
+	// sendScope allows inserting live chat messages.
+	sendScope = "https://www.googleapis.com/auth/youtube.force-ssl"
+
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// tokenSlack renews an access token this long before it expires.
+	tokenSlack = time.Minute
+)
+
+// ErrNotAuthorized is returned when the user denies the device
+// authorization or lets its code expire.
+var ErrNotAuthorized = fmt.Errorf("%w: OAuth authorization was not granted", ErrAuth)
+
+// OAuthOptions configures the OAuth 2.0 device flow used to post chat.
+type OAuthOptions struct {
+	// ClientID and ClientSecret identify a Google OAuth client of type
+	// "TVs and Limited Input devices".
+	ClientID     string
+	ClientSecret string
+	// TokenFile stores the refresh token so authorization happens once.
+	// Empty keeps it in memory only.
+	TokenFile string
+	// Prompt receives the instructions for approving the device.
+	// Defaults to stderr.
+	Prompt io.Writer
+	// DeviceCodeURL and TokenURL override Google's endpoints, e.g. for a
+	// mock server.
+	DeviceCodeURL string
+	TokenURL      string
+	// Clock paces device-flow polling and token expiry. Defaults to the
+	// wall clock.
+	Clock clock.Clock
+}
+
+// OAuth issues access tokens for posting to live chat. The first
+// Authorize runs the device flow unless a refresh token was saved; later
+// tokens are refreshed as they expire. It is safe for concurrent use.
+type OAuth struct {
+	opts       OAuthOptions
+	httpClient *http.Client
+	clock      clock.Clock
+
+	mu           sync.Mutex
+	accessToken  string
+	expires      time.Time
+	refreshToken string
+}
+
+// NewOAuth creates a token source, loading a saved refresh token from
+// opts.TokenFile when there is one.
+func NewOAuth(opts OAuthOptions) *OAuth {
+	if opts.Prompt == nil {
+		opts.Prompt = os.Stderr
+	}
+	if opts.DeviceCodeURL == "" {
+		opts.DeviceCodeURL = defaultDeviceCodeURL
+	}
+	if opts.TokenURL == "" {
+		opts.TokenURL = defaultTokenURL
+	}
+	o := &OAuth{
+		opts:       opts,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		clock:      clock.Or(opts.Clock),
+	}
+	if opts.TokenFile != "" {
+		var saved struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if data, err := os.ReadFile(opts.TokenFile); err == nil && json.Unmarshal(data, &saved) == nil {
+			o.refreshToken = saved.RefreshToken
+		}
+	}
+	return o
+}
+
+// tokenResponse is the token endpoint's reply, or its error.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// Authorize makes sure a refresh token is available, running the device
+// flow if needed: it prints a code for the user to enter at Google's
+// device page and waits until they approve it.
+func (o *OAuth) Authorize(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.refreshToken != "" {
+		return nil
+	}
+	return o.deviceFlow(ctx)
+}
+
+// Token returns a valid access token, refreshing it when it is about to
+// expire. Authorize must have succeeded first.
+func (o *OAuth) Token(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.accessToken != "" && o.clock.Now().Before(o.expires.Add(-tokenSlack)) {
+		return o.accessToken, nil
+	}
+	if o.refreshToken == "" {
+		return "", ErrNotAuthorized
+	}
+	tok, err := o.post(ctx, o.opts.TokenURL, url.Values{
+		"client_id":     {o.opts.ClientID},
+		"client_secret": {o.opts.ClientSecret},
+		"refresh_token": {o.refreshToken},
+		"grant_type":    {"refresh_token"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("refresh token: %w", err)
+	}
+	if tok.Error != "" {
+		// Google refuses a revoked or expired grant as invalid_grant
+		return "", fmt.Errorf("%w: refresh token: %s", ErrAuth, tok.Error)
+	}
+	o.store(tok)
+	return o.accessToken, nil
+}
+
+// Invalidate drops the cached access token, e.g. after a 401, so the next
+// Token call refreshes it.
+func (o *OAuth) Invalidate() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.accessToken = ""
+}
+
+// deviceFlow runs the OAuth 2.0 device authorization grant. o.mu must be
+// held.
+func (o *OAuth) deviceFlow(ctx context.Context) error {
+	var code struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if err := o.postJSON(ctx, o.opts.DeviceCodeURL, url.Values{
+		"client_id": {o.opts.ClientID},
+		"scope":     {sendScope},
+	}, &code); err != nil {
+		return fmt.Errorf("device code: %w", err)
+	}
+	fmt.Fprintf(o.opts.Prompt, "YouTube: to let the relay post to live chat, visit %s and enter code %s\n", code.VerificationURL, code.UserCode)
+
+	interval := time.Duration(max(code.Interval, 1)) * time.Second
+	deadline := o.clock.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.clock.After(interval):
+		}
+		if code.ExpiresIn > 0 && o.clock.Now().After(deadline) {
+			return ErrNotAuthorized
+		}
+
+		tok, err := o.post(ctx, o.opts.TokenURL, url.Values{
+			"client_id":     {o.opts.ClientID},
+			"client_secret": {o.opts.ClientSecret},
+			"device_code":   {code.DeviceCode},
+			"grant_type":    {deviceGrantType},
+		})
+		if err != nil {
+			return fmt.Errorf("device token: %w", err)
+		}
+		switch tok.Error {
+		case "":
+			o.store(tok)
+			fmt.Fprintln(o.opts.Prompt, "YouTube: authorized to post to live chat")
+			return nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied", "expired_token":
+			return ErrNotAuthorized
+		default:
+			return fmt.Errorf("device token: %s", tok.Error)
+		}
+	}
+}
+
+// store keeps a token response, saving a new refresh token to the token
+// file. o.mu must be held.
+func (o *OAuth) store(tok tokenResponse) {
+	o.accessToken = tok.AccessToken
+	o.expires = o.clock.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	if tok.RefreshToken == "" || tok.RefreshToken == o.refreshToken {
+		return
+	}
+	o.refreshToken = tok.RefreshToken
+	if o.opts.TokenFile == "" {
+		return
+	}
+	data, _ := json.Marshal(map[string]string{"refresh_token": tok.RefreshToken})
+	if err := os.WriteFile(o.opts.TokenFile, data, 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "YouTube: could not save OAuth token: %v\n", err)
+	}
+}
+
+// post sends a form to the token endpoint. OAuth errors such as
+// authorization_pending come back with a 4xx status and are returned in
+// the response rather than as an error.
+func (o *OAuth) post(ctx context.Context, endpoint string, form url.Values) (tokenResponse, error) {
+	var tok tokenResponse
+	err := o.postJSON(ctx, endpoint, form, &tok)
+	var status statusError
+	if errors.As(err, &status) && status.code >= 400 && status.code < 500 && tok.Error != "" {
+		err = nil
+	}
+	return tok, err
+}
+
+// statusError is a non-2xx reply from an OAuth endpoint.
+type statusError struct{ code int }
+
+func (e statusError) Error() string { return fmt.Sprintf("status %d", e.code) }
+
+// postJSON posts form to endpoint and decodes the JSON reply into out,
+// even when the status is an error.
+func (o *OAuth) postJSON(ctx context.Context, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decodeErr := json.NewDecoder(resp.Body).Decode(out)
+	if resp.StatusCode/100 != 2 {
+		return statusError{resp.StatusCode}
+	}
+	return decodeErr
+}
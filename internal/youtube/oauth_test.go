@@ -0,0 +1,223 @@
+package youtube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relay/internal/clock"
+)
+
+// oauthServer mocks Google's device and token endpoints. The device code
+// is approved after pending polls.
+func oauthServer(t *testing.T, pending int) *httptest.Server {
+	t.Helper()
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/device/code":
+			if r.Form.Get("scope") != sendScope {
+				t.Errorf("scope = %q", r.Form.Get("scope"))
+			}
+			w.Write([]byte(`{"device_code":"dev","user_code":"ABCD-EFGH","verification_url":"https://www.google.com/device","expires_in":1800,"interval":5}`))
+		case "/token":
+			switch r.Form.Get("grant_type") {
+			case deviceGrantType:
+				if int(polls.Add(1)) <= pending {
+					w.WriteHeader(http.StatusPreconditionRequired)
+					w.Write([]byte(`{"error":"authorization_pending"}`))
+					return
+				}
+				w.Write([]byte(`{"access_token":"access-1","refresh_token":"refresh","expires_in":3600}`))
+			case "refresh_token":
+				if r.Form.Get("refresh_token") != "refresh" {
+					t.Errorf("refresh_token = %q", r.Form.Get("refresh_token"))
+				}
+				w.Write([]byte(`{"access_token":"access-2","expires_in":3600}`))
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOAuthDeviceFlow(t *testing.T) {
+	server := oauthServer(t, 2)
+	fake := clock.NewFake(time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC))
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	var prompt bytes.Buffer
+	o := NewOAuth(OAuthOptions{
+		ClientID:      "client",
+		TokenFile:     tokenFile,
+		Prompt:        &prompt,
+		DeviceCodeURL: server.URL + "/device/code",
+		TokenURL:      server.URL + "/token",
+		Clock:         fake,
+	})
+
+	done := make(chan error)
+	go func() { done <- o.Authorize(context.Background()) }()
+	// Each poll waits out the interval on the fake clock
+	for i := 0; i < 3; i++ {
+		for fake.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		fake.Advance(5 * time.Second)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	if !strings.Contains(prompt.String(), "ABCD-EFGH") {
+		t.Errorf("prompt = %q, want the user code", prompt.String())
+	}
+
+	tok, err := o.Token(context.Background())
+	if err != nil || tok != "access-1" {
+		t.Errorf("Token() = %q, %v; want access-1", tok, err)
+	}
+
+	// The refresh token is saved, so a new client skips the device flow
+	// and refreshes instead
+	data, err := os.ReadFile(tokenFile)
+	if err != nil || !strings.Contains(string(data), `"refresh"`) {
+		t.Fatalf("token file = %q, %v", data, err)
+	}
+	o = NewOAuth(OAuthOptions{ClientID: "client", TokenFile: tokenFile, TokenURL: server.URL + "/token", DeviceCodeURL: "http://unused.invalid"})
+	if err := o.Authorize(context.Background()); err != nil {
+		t.Fatalf("Authorize() with saved token: %v", err)
+	}
+	if tok, err := o.Token(context.Background()); err != nil || tok != "access-2" {
+		t.Errorf("Token() = %q, %v; want refreshed access-2", tok, err)
+	}
+}
+
+func TestOAuthDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/device/code" {
+			w.Write([]byte(`{"device_code":"dev","user_code":"X","verification_url":"u","interval":1}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"access_denied"}`))
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	o := NewOAuth(OAuthOptions{Prompt: &bytes.Buffer{}, DeviceCodeURL: server.URL + "/device/code", TokenURL: server.URL + "/token", Clock: fake})
+	done := make(chan error)
+	go func() { done <- o.Authorize(context.Background()) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(time.Second)
+	if err := <-done; !errors.Is(err, ErrNotAuthorized) || !errors.Is(err, ErrAuth) {
+		t.Errorf("Authorize() = %v, want ErrNotAuthorized", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	oauth := oauthServer(t, 0)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/liveChat/messages" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		// The first token is rejected, as if it had been revoked
+		if attempts.Add(1) == 1 {
+			if r.Header.Get("Authorization") != "Bearer access-1" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access-2" {
+			t.Errorf("Authorization = %q, want refreshed token", r.Header.Get("Authorization"))
+		}
+		var body sendRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Snippet.LiveChatID != "chat-abc" || len([]rune(body.Snippet.TextMessageDetails.MessageText)) != maxSendLength {
+			t.Errorf("body = %+v", body.Snippet)
+		}
+		w.Write([]byte(`{"id":"sent-1"}`))
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	o := NewOAuth(OAuthOptions{Prompt: &bytes.Buffer{}, DeviceCodeURL: oauth.URL + "/device/code", TokenURL: oauth.URL + "/token", Clock: fake})
+	c := NewClient(NewKeyPool("k"), "video-123", Options{BaseURL: server.URL, OAuth: o})
+	c.httpClient = server.Client()
+
+	if err := c.Send(context.Background(), "hi"); !errors.Is(err, ErrNoLiveChat) {
+		t.Errorf("Send() before a chat is found = %v, want ErrNoLiveChat", err)
+	}
+	c.setLiveChatID("chat-abc")
+
+	// Authorize once; the device code is approved on the first poll
+	done := make(chan error)
+	go func() { done <- o.Authorize(context.Background()) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(5 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Send(context.Background(), strings.Repeat("é", 250)); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if c.markSeen("chat-abc", "sent-1") {
+		t.Error("sent message should be marked seen so it is not read back")
+	}
+}
+
+func TestSendUnauthorized(t *testing.T) {
+	oauth := oauthServer(t, 0)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Now())
+	o := NewOAuth(OAuthOptions{Prompt: &bytes.Buffer{}, DeviceCodeURL: oauth.URL + "/device/code", TokenURL: oauth.URL + "/token", Clock: fake})
+	c := NewClient(NewKeyPool("k"), "video-123", Options{BaseURL: server.URL, OAuth: o})
+	c.httpClient = server.Client()
+	c.setLiveChatID("chat-abc")
+
+	done := make(chan error)
+	go func() { done <- o.Authorize(context.Background()) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(5 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// A refreshed token that is refused too isn't tried again
+	if err := c.Send(context.Background(), "hi"); !errors.Is(err, ErrAuth) {
+		t.Errorf("Send() = %v, want ErrAuth", err)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("attempts = %d, want 2", n)
+	}
+}
+
+func TestSendReadOnly(t *testing.T) {
+	c := NewClient(NewKeyPool("k"), "video-123", Options{})
+	if err := c.Send(context.Background(), "hi"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Send() = %v, want ErrReadOnly", err)
+	}
+}
@@ -1,42 +1,87 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
-	"syscall"
+	"time"
 
+	"relay/internal/chatlog"
 	"relay/internal/config"
+	"relay/internal/demo"
+	"relay/internal/dispatch"
 	"relay/internal/display"
+	"relay/internal/echo"
 	"relay/internal/hackrtv"
+	"relay/internal/highlight"
+	"relay/internal/i18n"
+	"relay/internal/latency"
+	"relay/internal/markup"
 	"relay/internal/message"
-	"relay/internal/twitch"
+	"relay/internal/retention"
+	"relay/internal/safemode"
+	"relay/internal/setup"
 	"relay/internal/uplink"
-	"relay/internal/youtube"
 )
 
 func main() {
-	// CLI flags
-	configPath := flag.String("config", "", "Path to TOML config file")
-	twitchChannel := flag.String("twitch-channel", "", "Twitch channel name to watch")
-	youtubeVideoID := flag.String("youtube-video-id", "", "YouTube video ID for live stream")
-	youtubeAPIKey := flag.String("youtube-api-key", "", "YouTube Data API key (or set YOUTUBE_API_KEY env)")
-	hackrtvURL := flag.String("hackrtv-url", "", "hackr.tv ActionCable WebSocket URL (e.g. wss://hackr.tv/cable)")
-	hackrtvChannel := flag.String("hackrtv-channel", "", "hackr.tv chat channel slug")
-	hackrtvToken := flag.String("hackrtv-token", "", "hackr.tv admin API token (or set HACKRTV_API_TOKEN env)")
-	hackrtvAlias := flag.String("hackrtv-alias", "", "hackr.tv hackr alias for auth")
-	bridge := flag.Bool("bridge", false, "Bridge Twitch/YouTube chat to hackr.tv via Uplink API")
-	flag.Parse()
+	// "relay setup hackrtv" checks hackr.tv settings against the live
+	// server, saves them to the config file, and exits
+	if len(os.Args) > 1 && os.Args[1] == "setup" {
+		if err := runSetup(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "relay prune" applies [retention] to the files on disk and exits
+	pruneMode := len(os.Args) > 1 && os.Args[1] == "prune"
+	if pruneMode {
+		os.Args = slices.Delete(os.Args, 1, 2)
+	}
+
+	// "relay latency" compares platforms' stream delays in recorded chat
+	// and exits
+	latencyMode := len(os.Args) > 1 && os.Args[1] == "latency"
+	var latencyOpts latency.Options
+	if latencyMode {
+		os.Args = slices.Delete(os.Args, 1, 2)
+		flag.DurationVar(&latencyOpts.Bucket, "bucket", 0, "Latency: resolution chat rates are compared at (default 1s)")
+		flag.DurationVar(&latencyOpts.MaxLag, "max-lag", 0, "Latency: largest delay looked for between platforms (default 30s)")
+		flag.StringVar(&latencyOpts.Reference, "reference", "", "Latency: platform the others are compared against (default the busiest)")
+	}
+
+	// "relay demo" shows generated chat in place of the platform sources
+	demoMode := len(os.Args) > 1 && os.Args[1] == "demo"
+	if demoMode {
+		os.Args = slices.Delete(os.Args, 1, 2)
+	}
+
+	flags := registerFlags(demoMode)
+	flags.parse()
+
+	if latencyMode {
+		if err := reportLatency(flag.Args(), latencyOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Load config file if specified
 	var cfg config.Config
-	if *configPath != "" {
+	if *flags.configPath != "" {
 		var err error
-		cfg, err = config.Load(*configPath)
+		cfg, err = config.Load(*flags.configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
@@ -46,173 +91,427 @@ func main() {
 	// Apply defaults for fields that have them
 	cfg.ApplyDefaults()
 
+	// Platform labels are shared by the display, bridge, and echo detection
+	if err := applyLabels(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The locale formats system events, timestamps, and amounts
+	if err := i18n.Set(cfg.Display.Locale); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: display.locale: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Override config with explicitly-set CLI flags
-	flagsSet := make(map[string]bool)
-	flag.Visit(func(f *flag.Flag) {
-		flagsSet[f.Name] = true
-	})
+	flags.apply(&cfg)
 
-	if flagsSet["twitch-channel"] {
-		cfg.Twitch.Channel = *twitchChannel
+	highlightsKeep, err := retentionPolicy(cfg.Retention.Highlights)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [retention.highlights] %v\n", err)
+		os.Exit(1)
 	}
-	if flagsSet["youtube-video-id"] {
-		cfg.YouTube.VideoID = *youtubeVideoID
+	spillKeep, err := retentionPolicy(cfg.Retention.Spill)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [retention.spill] %v\n", err)
+		os.Exit(1)
 	}
-	if flagsSet["youtube-api-key"] {
-		cfg.YouTube.APIKey = *youtubeAPIKey
+	if pruneMode {
+		if err := prune(cfg, highlightsKeep, spillKeep); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
-	if flagsSet["hackrtv-url"] {
-		cfg.HackrTV.URL = *hackrtvURL
+	if cfg.StateDir != "" {
+		if err := os.MkdirAll(cfg.StateDir, 0o700); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: state_dir: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	if flagsSet["hackrtv-channel"] {
-		cfg.HackrTV.Channel = *hackrtvChannel
+	// A relay that keeps crashing starts with only the chat display, so a
+	// bad setting or corrupt file can't keep taking the bridge down. Every
+	// exit from here on that doesn't reach the end of main is a crash.
+	crashGuard, err := safemode.Start(safemode.Options{
+		Dir:     cfg.StateDir,
+		Crashes: cfg.SafeMode.Crashes,
+		Window:  cfg.SafeMode.Window,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [safe_mode] %v\n", err)
+		os.Exit(1)
 	}
-	if flagsSet["hackrtv-token"] {
-		cfg.HackrTV.Token = *hackrtvToken
+	safeMode := crashGuard.Safe()
+	if flags.set["safe-mode"] {
+		safeMode = *flags.safeMode
 	}
-	if flagsSet["hackrtv-alias"] {
-		cfg.HackrTV.Alias = *hackrtvAlias
+	var safeModeWarning []string
+	if safeMode {
+		safeModeWarning = safeModeLines(crashGuard.Crashes(), enterSafeMode(&cfg))
 	}
-	if flagsSet["bridge"] {
-		cfg.Bridge = *bridge
+
+	// The demo replaces every platform source, so none are connected
+	var demoPersonas []demo.Persona
+	if demoMode {
+		if cfg.Bridge {
+			fmt.Fprintln(os.Stderr, "Error: relay demo cannot be combined with --bridge")
+			os.Exit(1)
+		}
+		if demoPersonas, err = personas(cfg.Demo.Personas); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Twitch = config.TwitchConfig{}
+		cfg.YouTube = config.YouTubeConfig{}
+		cfg.HackrTV.URL = ""
 	}
 
-	// Env var fallbacks for fields still empty
-	if cfg.YouTube.APIKey == "" {
-		cfg.YouTube.APIKey = os.Getenv("YOUTUBE_API_KEY")
+	applyEnv(&cfg)
+	if err := validate(cfg, demoMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, errNoPlatform) {
+			flag.Usage()
+		}
+		os.Exit(1)
 	}
-	if cfg.HackrTV.Token == "" {
-		cfg.HackrTV.Token = os.Getenv("HACKRTV_API_TOKEN")
+	timestamps, err := display.ParseTimestamps(cfg.Display.TimestampFormat, cfg.Display.Timezone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [display] %v\n", err)
+		os.Exit(1)
 	}
-
-	// Validate inputs
-	if cfg.Twitch.Channel == "" && cfg.YouTube.VideoID == "" && cfg.HackrTV.URL == "" {
-		fmt.Fprintln(os.Stderr, "Error: At least one platform is required (--twitch-channel, --youtube-video-id, or --hackrtv-url)")
-		flag.Usage()
+	bridgeTmpl, err := uplink.ParseTemplate(cfg.BridgeTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	htvChannels := cfg.HackrTV.AllChannels()
+	var routes []bridgeRoute
+	if cfg.Bridge {
+		if routes, err = bridgeRoutes(cfg.BridgeRoutes, htvChannels[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: [[bridge_routes]] %v\n", err)
+			os.Exit(1)
+		}
+		// Regular hackrs post over the cable, which only reaches the
+		// first channel
+		if cfg.HackrTV.AuthMode == "user" && slices.ContainsFunc(routes, func(r bridgeRoute) bool { return r.target != htvChannels[0] }) {
+			fmt.Fprintf(os.Stderr, "Error: [[bridge_routes]] to channels other than %s require auth_mode = \"admin\"\n", htvChannels[0])
+			os.Exit(1)
+		}
+	}
 
-	if cfg.YouTube.VideoID != "" && cfg.YouTube.APIKey == "" {
-		fmt.Fprintln(os.Stderr, "Error: --youtube-api-key (or YOUTUBE_API_KEY env) is required for YouTube")
-		os.Exit(1)
+	// The Uplink API answers each send with the packet's ID, so the
+	// hackr.tv client can drop the bridge's own messages when they come
+	// back. Regular hackrs posting over the cable learn no IDs; their
+	// echoes, like those from earlier runs, are recognised by the bridge
+	// template.
+	var echoes *echo.Set
+	if cfg.Bridge && !cfg.BridgeDryRun && cfg.HackrTV.AuthMode == "admin" {
+		echoes = echo.New()
 	}
 
-	if cfg.Bridge && (cfg.HackrTV.URL == "" || cfg.HackrTV.Token == "") {
-		fmt.Fprintln(os.Stderr, "Error: --bridge requires --hackrtv-url and --hackrtv-token")
-		os.Exit(1)
+	r := &relay{
+		cfg:             cfg,
+		demoMode:        demoMode,
+		personas:        demoPersonas,
+		busConsume:      cfg.Bus.Role == "consume",
+		twitchChannels:  cfg.Twitch.AllChannels(),
+		htvChannels:     htvChannels,
+		timestamps:      timestamps,
+		bridgeTmpl:      bridgeTmpl,
+		routes:          routes,
+		echoes:          echoes,
+		highlightsKeep:  highlightsKeep,
+		spillKeep:       spillKeep,
+		safeModeWarning: safeModeWarning,
+	}
+	code := r.run()
+	// Reaching here is a clean exit, even with a failed source, so the
+	// next run starts normally
+	if err := crashGuard.Stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "Crash record error: %v\n", err)
+	}
+	if code != 0 {
+		os.Exit(code)
 	}
+}
 
-	// Setup context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// enterSafeMode turns off everything but reading chat and the printer:
+// the bridge and every sink that posts or writes chat elsewhere, the
+// HTTP API, output templates, Twitch clips, and the state the relay
+// resumes from. It returns the names of what was on, for the warning.
+func enterSafeMode(cfg *config.Config) []string {
+	var off []string
+	turnOff := func(on bool, name string) {
+		if on {
+			off = append(off, name)
+		}
+	}
+	turnOff(cfg.Bridge || cfg.BridgeDryRun, "bridge")
+	cfg.Bridge, cfg.BridgeDryRun, cfg.BridgeReplies = false, false, false
+	cfg.Supporters.Channel = ""
+	turnOff(cfg.Bus.Role == "publish", "bus")
+	if cfg.Bus.Role == "publish" {
+		cfg.Bus = config.BusConfig{}
+	}
+	turnOff(cfg.ChatLog.Dir != "", "chat log")
+	cfg.ChatLog.Dir = ""
+	turnOff(cfg.Notifications.Enabled, "notifications")
+	cfg.Notifications.Enabled = false
+	turnOff(cfg.API.Listen != "", "HTTP API")
+	cfg.API.Listen, cfg.API.Dashboard, cfg.API.DashboardControls = "", false, false
+	turnOff(cfg.Display.Template != "", "output template")
+	cfg.Display.Template = ""
+	turnOff(cfg.Highlights.TwitchClip, "Twitch clips")
+	cfg.Highlights.TwitchClip = false
+	turnOff(cfg.StateDir != "", "saved state")
+	cfg.StateDir = ""
+	return off
+}
 
-	// Handle interrupt signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		fmt.Fprintln(os.Stderr, "\nShutting down...")
-		cancel()
-	}()
+// safeModeLines explains safe mode for the warning: why the relay is in
+// it, what it turned off, and how to leave it.
+func safeModeLines(crashes []time.Time, off []string) []string {
+	why := "Started with --safe-mode."
+	if len(crashes) > 0 {
+		why = fmt.Sprintf("The relay crashed %d times since %s.", len(crashes), crashes[0].Local().Format("15:04:05"))
+		if len(crashes) == 1 {
+			why = "The relay crashed at " + crashes[0].Local().Format("15:04:05") + "."
+		}
+	}
+	lines := []string{why, "Only chat display is running."}
+	if len(off) > 0 {
+		lines = append(lines, "Turned off: "+strings.Join(off, ", ")+".")
+	}
+	return append(lines, "Fix the cause and restart; a clean exit leaves safe mode, and --safe-mode=false skips it.")
+}
 
-	// Create unified message channel
-	messages := make(chan message.Message, 100)
+// isReplay reports whether msg was sent before cutoff, making it history
+// a source replayed rather than live chat. Messages without a timestamp
+// are never replays.
+func isReplay(msg message.Message, cutoff time.Time) bool {
+	return !msg.Timestamp.IsZero() && msg.Timestamp.Before(cutoff)
+}
 
-	// Fan-out: printer always receives; uplink receives non-HTV when bridging
-	printerCh := make(chan message.Message, 100)
-	var uplinkCh chan message.Message
+// applyLabels installs configured platform labels in the message package.
+func applyLabels(cfg config.Config) error {
+	for key, label := range cfg.Labels {
+		p, ok := message.ParsePlatform(key)
+		if !ok {
+			return fmt.Errorf("unknown platform %q in [labels]", key)
+		}
+		message.SetLabel(p, label)
+	}
+	for key, label := range cfg.Display.Labels {
+		p, ok := message.ParsePlatform(key)
+		if !ok {
+			return fmt.Errorf("unknown platform %q in [display.labels]", key)
+		}
+		message.SetDisplayLabel(p, label)
+	}
+	return nil
+}
 
-	if cfg.Bridge {
-		uplinkCh = make(chan message.Message, 100)
+// sinkOptions converts a sink's config, using overflow when it sets none.
+func sinkOptions(sc config.SinkConfig, overflow string) dispatch.Options {
+	return dispatch.Options{
+		Buffer:      sc.Buffer,
+		Concurrency: sc.Concurrency,
+		Unordered:   sc.Ordered != nil && !*sc.Ordered,
+		Overflow:    cmp.Or(sc.Overflow, overflow),
 	}
+}
 
-	go func() {
-		for msg := range messages {
-			// In bridge mode, suppress HTV echoes of our own bridged messages
-			if uplinkCh != nil && isBridgeEcho(msg, cfg.HackrTV.Alias) {
-				continue
-			}
-			printerCh <- msg
-			if uplinkCh != nil && msg.Platform != message.HackrTV {
-				select {
-				case uplinkCh <- msg:
-				default:
-					// drop if uplink can't keep up — don't block printer
-				}
-			}
+// markupOptions converts a sink's markup config.
+func markupOptions(sc config.SinkConfig) markup.Options {
+	return markup.Options{
+		Emotes: sc.Markup.Emotes,
+		Emoji:  sc.Markup.Emoji,
+		Plain:  sc.Markup.Plain,
+	}
+}
+
+// addSink registers a sink, exiting on invalid [sinks] settings.
+func addSink(d *dispatch.Dispatcher, s dispatch.Sink) {
+	if err := d.Add(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [sinks] %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// historyOptions reads [hackrtv] history: "all", "none", or "last_N".
+func historyOptions(hc config.HackrTVConfig) (skip bool, last int, err error) {
+	history := strings.ToLower(strings.TrimSpace(hc.History))
+	if hc.SkipHistory {
+		if history != "" && history != "none" {
+			return false, 0, fmt.Errorf("skip_history = true conflicts with history = %q", hc.History)
 		}
-		close(printerCh)
-		if uplinkCh != nil {
-			close(uplinkCh)
+		return true, 0, nil
+	}
+	switch history {
+	case "", "all":
+		return false, 0, nil
+	case "none":
+		return true, 0, nil
+	}
+	if n, ok := strings.CutPrefix(history, "last_"); ok {
+		if last, err := strconv.Atoi(n); err == nil && last > 0 {
+			return false, last, nil
 		}
-	}()
+	}
+	return false, 0, fmt.Errorf("history must be \"all\", \"none\", or \"last_N\" (e.g. \"last_20\"), got %q", hc.History)
+}
 
-	// Start printer goroutine
-	printer := display.NewPrinter()
-	go printer.Run(printerCh)
+// htvSubscriptions converts configured extra hackr.tv channels for the client.
+func htvSubscriptions(subs []config.SubscriptionConfig) []hackrtv.Subscription {
+	var out []hackrtv.Subscription
+	for _, s := range subs {
+		out = append(out, hackrtv.Subscription{Channel: s.Channel, Params: s.Params})
+	}
+	return out
+}
 
-	// Start uplink bridge if enabled
-	if cfg.Bridge {
-		uplinkClient, err := uplink.NewClient(cfg.HackrTV.URL, cfg.HackrTV.Token, cfg.HackrTV.Alias, cfg.HackrTV.Channel)
+// personas converts [[demo.personas]] entries, resolving platform keys
+// and labels. No entries keeps the built-in cast.
+func personas(entries []config.DemoPersonaConfig) ([]demo.Persona, error) {
+	var out []demo.Persona
+	for _, e := range entries {
+		if e.Name == "" {
+			return nil, fmt.Errorf("every [[demo.personas]] entry needs a name")
+		}
+		p, ok := message.ParsePlatform(e.Platform)
+		if !ok {
+			return nil, fmt.Errorf("[[demo.personas]] %q: unknown platform %q", e.Name, e.Platform)
+		}
+		out = append(out, demo.Persona{Name: e.Name, Platform: p, Role: e.Role, Lines: e.Lines})
+	}
+	return out, nil
+}
+
+// stateName makes name safe to use in a state file's name.
+func stateName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '@' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// retentionPolicy converts a [retention] policy from the config.
+func retentionPolicy(rc config.RetentionPolicy) (retention.Policy, error) {
+	if rc.MaxAge < 0 {
+		return retention.Policy{}, fmt.Errorf("max_age must not be negative")
+	}
+	p := retention.Policy{MaxAge: rc.MaxAge}
+	if rc.MaxSize != "" {
+		size, err := retention.ParseSize(rc.MaxSize)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Uplink client error: %v\n", err)
-			os.Exit(1)
+			return retention.Policy{}, fmt.Errorf("max_size: %w", err)
+		}
+		p.MaxSize = size
+	}
+	return p, nil
+}
+
+// prune applies the retention policies once, for "relay prune".
+func prune(cfg config.Config, highlightsKeep, spillKeep retention.Policy) error {
+	if highlightsKeep.IsZero() && spillKeep.IsZero() {
+		fmt.Println("Nothing to prune: [retention] sets no max_age or max_size")
+		return nil
+	}
+	now := time.Now()
+	if !highlightsKeep.IsZero() {
+		n, err := highlight.Prune(cfg.Highlights.File, highlightsKeep, now)
+		if err != nil {
+			return err
 		}
-		fmt.Fprintln(os.Stderr, "Bridge mode enabled — forwarding Twitch/YouTube chat to hackr.tv")
-		go uplinkClient.Run(ctx, uplinkCh)
+		fmt.Printf("%s: dropped %d clips\n", cfg.Highlights.File, n)
 	}
+	if !spillKeep.IsZero() && cfg.BridgeSpillFile != "" {
+		n, err := uplink.PruneSpill(cfg.BridgeSpillFile, spillKeep, now)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: dropped %d messages\n", cfg.BridgeSpillFile, n)
+	}
+	return nil
+}
 
-	// Track active connections
-	var wg sync.WaitGroup
+// runSetup runs the "relay setup" wizard named by the first argument,
+// e.g. "relay setup hackrtv --config=relay.toml".
+func runSetup(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New(`name what to set up, e.g. "relay setup hackrtv"`)
+	}
+	flags := flag.NewFlagSet("relay setup "+args[0], flag.ExitOnError)
+	configPath := flags.String("config", "relay.toml", "TOML config file the checked settings are saved to")
+	flags.Parse(args[1:])
+	switch args[0] {
+	case "hackrtv":
+		return setup.HackrTV(context.Background(), setup.Options{Config: *configPath})
+	default:
+		return fmt.Errorf("unknown setup %q; only hackrtv can be set up", args[0])
+	}
+}
 
-	// Start Twitch client if configured
-	if cfg.Twitch.Channel != "" {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			client := twitch.NewClient(cfg.Twitch.Channel)
-			fmt.Fprintf(os.Stderr, "Connecting to Twitch channel: %s\n", cfg.Twitch.Channel)
-			if err := client.Connect(ctx, messages); err != nil && ctx.Err() == nil {
-				fmt.Fprintf(os.Stderr, "Twitch error: %v\n", err)
-			}
-		}()
-	}
-
-	// Start YouTube client if configured
-	if cfg.YouTube.VideoID != "" {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			client := youtube.NewClient(cfg.YouTube.APIKey, cfg.YouTube.VideoID)
-			fmt.Fprintf(os.Stderr, "Connecting to YouTube video: %s\n", cfg.YouTube.VideoID)
-			if err := client.Connect(ctx, messages); err != nil && ctx.Err() == nil {
-				fmt.Fprintf(os.Stderr, "YouTube error: %v\n", err)
+// reportLatency reads chat recorded in chat log files, in either format,
+// or --output=json captures (stdin when no paths are given), and prints
+// how far each platform's chat trails the fastest.
+func reportLatency(paths []string, opts latency.Options) error {
+	analyzer := latency.New(opts)
+	read := func(name string, r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		skipped := 0
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
 			}
-		}()
-	}
-
-	// Start hackr.tv client if configured
-	if cfg.HackrTV.URL != "" {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			client := hackrtv.NewClient(cfg.HackrTV.URL, cfg.HackrTV.Token, cfg.HackrTV.Alias, cfg.HackrTV.Channel)
-			fmt.Fprintf(os.Stderr, "Connecting to hackr.tv channel: %s\n", cfg.HackrTV.Channel)
-			if err := client.Connect(ctx, messages); err != nil && ctx.Err() == nil {
-				fmt.Fprintf(os.Stderr, "hackr.tv error: %v\n", err)
+			msg, err := chatlog.ParseLine(scanner.Text())
+			if err != nil {
+				skipped++
+				continue
 			}
-		}()
+			analyzer.Add(msg)
+		}
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "%s: skipped %d unreadable lines\n", name, skipped)
+		}
+		return scanner.Err()
 	}
-
-	// Wait for all clients to finish
-	wg.Wait()
-	close(messages)
+	if len(paths) == 0 {
+		if err := read("stdin", os.Stdin); err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = read(path, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	report, err := analyzer.Report()
+	if err != nil {
+		return err
+	}
+	return report.Write(os.Stdout)
 }
 
-// isBridgeEcho returns true if an HTV message is an echo of a bridged
-// Twitch/YouTube message sent by our own relay alias.
-func isBridgeEcho(msg message.Message, relayAlias string) bool {
-	return msg.Platform == message.HackrTV &&
-		strings.EqualFold(msg.Username, relayAlias) &&
-		(strings.HasPrefix(msg.Content, "[TTV] ") || strings.HasPrefix(msg.Content, "[YT_] "))
+// runRetention calls prune now and every interval until ctx is done.
+func runRetention(ctx context.Context, interval time.Duration, prune func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		prune()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -1,9 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"relay/internal/config"
+	"relay/internal/console"
+	"relay/internal/dispatch"
+	"relay/internal/display"
+	"relay/internal/hackrtv"
+	"relay/internal/highlight"
 	"relay/internal/message"
+	"relay/internal/twitch"
+	"relay/internal/twitcheventsub"
+	"relay/internal/uplink"
+	"relay/internal/youtube"
 )
 
 func TestIsBridgeEcho(t *testing.T) {
@@ -65,10 +86,605 @@ func TestIsBridgeEcho(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isBridgeEcho(tt.msg, tt.relayAlias)
+			got := isBridgeEcho(tt.msg, tt.relayAlias, defaultTemplate(t))
 			if got != tt.want {
 				t.Errorf("isBridgeEcho() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestIsBridgeEchoCustomTemplate(t *testing.T) {
+	tmpl, err := uplink.ParseTemplate("{{.Username}} on {{.Platform}}{{with .Channel}}/{{.}}{{end}} » {{.Content}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := message.Message{Platform: message.Twitch, Channel: "xqc", Username: "viewer", Content: "hi"}
+	echo := message.Message{Platform: message.HackrTV, Username: "relay", Content: tmpl.Format(msg)}
+	if echo.Content != "viewer on TTV/xqc » hi" {
+		t.Fatalf("Format() = %q", echo.Content)
+	}
+	if !isBridgeEcho(echo, "relay", tmpl) {
+		t.Error("message in the custom format should be detected as echo")
+	}
+	old := message.Message{Platform: message.HackrTV, Username: "relay", Content: "[TTV] viewer: hi"}
+	if isBridgeEcho(old, "relay", tmpl) {
+		t.Error("the default format should no longer be treated as echo")
+	}
+}
+
+// defaultTemplate parses the default bridge template.
+func defaultTemplate(t *testing.T) *uplink.Template {
+	tmpl, err := uplink.ParseTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestIsBridgeEchoCustomLabel(t *testing.T) {
+	t.Cleanup(func() { message.SetLabel(message.Twitch, "TTV") })
+
+	cfg := config.Config{Labels: map[string]string{"twitch": "TWITCH"}}
+	if err := applyLabels(cfg); err != nil {
+		t.Fatalf("applyLabels() error: %v", err)
+	}
+
+	echo := message.Message{Platform: message.HackrTV, Username: "relay", Content: "[TWITCH] user: hi"}
+	if !isBridgeEcho(echo, "relay", defaultTemplate(t)) {
+		t.Error("expected custom-labelled bridge message to be detected as echo")
+	}
+
+	stale := message.Message{Platform: message.HackrTV, Username: "relay", Content: "[TTV] user: hi"}
+	if isBridgeEcho(stale, "relay", defaultTemplate(t)) {
+		t.Error("old label should no longer be treated as echo")
+	}
+}
+
+func TestApplyLabelsUnknownPlatform(t *testing.T) {
+	cfg := config.Config{Labels: map[string]string{"discord": "DSC"}}
+	if err := applyLabels(cfg); err == nil {
+		t.Error("expected error for unknown platform key")
+	}
+}
+
+func TestDisplayCommands(t *testing.T) {
+	con := console.New(io.Discard)
+	filter := display.NewFilter()
+	registerDisplayCommands(con, filter)
+
+	ttv := message.Message{Platform: message.Twitch}
+	htv := message.Message{Platform: message.HackrTV}
+
+	if got := con.Exec("/solo htv"); got != "[display] solo: HTV" {
+		t.Errorf("/solo htv = %q", got)
+	}
+	if filter.Allows(ttv) || !filter.Allows(htv) {
+		t.Error("solo htv should show only hackr.tv")
+	}
+
+	con.Exec("/unsolo")
+	if got := con.Exec("/mute ttv"); got != "[display] muted: TTV" {
+		t.Errorf("/mute ttv = %q", got)
+	}
+	if filter.Allows(ttv) {
+		t.Error("muted Twitch should be hidden")
+	}
+
+	if got := con.Exec("/mute"); got == "" || got == "[display] muted: TTV" {
+		t.Errorf("/mute without args should error, got %q", got)
+	}
+}
+
+func TestClipCommand(t *testing.T) {
+	con := console.New(io.Discard)
+	rec := highlight.NewRecorder(5 * time.Minute)
+	rec.Add(message.Message{Platform: message.Twitch, Username: "old", Content: "earlier", Timestamp: time.Now().Add(-2 * time.Minute)})
+	rec.Add(message.Message{Platform: message.Twitch, Username: "bob", Content: "what a shot"})
+
+	path := filepath.Join(t.TempDir(), "highlights.txt")
+	createClip := func(ctx context.Context) (string, error) {
+		return "https://clips.twitch.tv/Clip1/edit", nil
+	}
+	registerClipCommand(con, rec, path, createClip)
+
+	got := con.Exec("/clip 30 great play")
+	if !strings.HasPrefix(got, "[clip] saved 1 messages from the last 30s") || !strings.Contains(got, "Clip1/edit") {
+		t.Errorf("/clip = %q", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "(last 30s) great play ===") || !strings.Contains(string(data), "[TTV] bob: what a shot") {
+		t.Errorf("highlights file = %q", data)
+	}
+	if strings.Contains(string(data), "earlier") {
+		t.Error("clip should not include chat older than the requested window")
+	}
+
+	if got := con.Exec("/clip 0"); !strings.Contains(got, "seconds must be positive") {
+		t.Errorf("/clip 0 = %q", got)
+	}
+}
+
+func TestPersonas(t *testing.T) {
+	got, err := personas([]config.DemoPersonaConfig{{Name: "xeraen", Platform: "HTV", Role: "admin"}})
+	if err != nil || len(got) != 1 || got[0].Platform != message.HackrTV {
+		t.Errorf("personas() = %+v, %v", got, err)
+	}
+	if _, err := personas([]config.DemoPersonaConfig{{Name: "x", Platform: "myspace"}}); err == nil {
+		t.Error("expected an error for an unknown platform")
+	}
+	if _, err := personas([]config.DemoPersonaConfig{{Platform: "twitch"}}); err == nil {
+		t.Error("expected an error for a persona without a name")
+	}
+}
+
+func TestWithRoute(t *testing.T) {
+	var got []message.Message
+	handle := withRoute(config.SinkConfig{
+		Footer: " ↪ via relay",
+		Markup: config.MarkupConfig{Emotes: "strip"},
+	}, func(msg message.Message) { got = append(got, msg) })
+
+	kappa := []message.Emote{{Name: "Kappa", Start: 0, End: 5}}
+	handle(message.Message{Content: "Kappa hi", Emotes: kappa})
+	handle(message.Message{Content: "Kappa", Emotes: kappa})
+	handle(message.Message{Type: message.TypeDeletion, Content: "message deleted"})
+
+	if len(got) != 2 {
+		t.Fatalf("handled %d messages, want 2 (the emote-only one is skipped)", len(got))
+	}
+	if got[0].Content != "hi ↪ via relay" {
+		t.Errorf("Content = %q, want the footer after the stripped text", got[0].Content)
+	}
+	if got[1].Content != "message deleted" {
+		t.Errorf("deletion Content = %q, want it untouched", got[1].Content)
+	}
+}
+
+func TestMirroredChats(t *testing.T) {
+	var cfg config.Config
+	cfg.YouTube.VideoIDs = []string{"vid-a"}
+	cfg.YouTube.Handle = "@ignored"
+	got := strings.Join(mirroredChats(cfg, []string{"xqc"}, nil), ", ")
+	if got != "twitch.tv/xqc, youtu.be/vid-a" {
+		t.Errorf("mirroredChats() = %q", got)
+	}
+
+	cfg = config.Config{}
+	cfg.YouTube.Handle = "@hackrtv"
+	if got := mirroredChats(cfg, nil, nil); len(got) != 1 || got[0] != "youtube.com/@hackrtv" {
+		t.Errorf("mirroredChats() = %q, want the followed handle", got)
+	}
+}
+
+func TestMirrorName(t *testing.T) {
+	var cfg config.Config
+	cfg.HackrTV.URL = "ws://localhost:3000/cable"
+	if got := mirrorName(cfg, []string{"live", "dev"}); got != "localhost #live" {
+		t.Errorf("mirrorName() = %q, want localhost #live", got)
+	}
+	if got := mirrorName(config.Config{}, nil); got != "hackr.tv" {
+		t.Errorf("mirrorName() = %q, want hackr.tv", got)
+	}
+}
+
+func TestBridgeStatsHandler(t *testing.T) {
+	clients := map[string]*uplink.Client{"uplink": uplink.NewUserClient(nil, "live", uplink.Options{Workers: 3, RetryQueue: 10})}
+	rec := httptest.NewRecorder()
+	bridgeStatsHandler(dispatch.New(), clients).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bridge", nil))
+	want := `{"uplink":{"workers":3,"queued":0,"retrying":0,"dropped":0}}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("%w for nick %q", twitch.ErrAuth, "bot"), "auth"},
+		{fmt.Errorf("failed to connect to hackr.tv: %w (status 401)", hackrtv.ErrAuth), "auth"},
+		{youtube.ErrNotAuthorized, "auth"},
+		{fmt.Errorf("%w: video x does not have an active live chat", youtube.ErrNotLive), "not_live"},
+		{youtube.ErrQuotaExhausted, "rate_limit"},
+		{fmt.Errorf("failed to resolve token user: %w", twitcheventsub.ErrRateLimit), "rate_limit"},
+		{fmt.Errorf("%w for channel %q", hackrtv.ErrSubscriptionRejected, "live"), "subscription_rejected"},
+		{youtube.ErrChatEnded, "stream_ended"},
+		{errors.New("read error: EOF"), "error"},
+	}
+	for _, tt := range tests {
+		if got := failureReason(tt.err); got != tt.want {
+			t.Errorf("failureReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSourceHealth(t *testing.T) {
+	h := newSourceHealth()
+	serve := func() (int, string) {
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connected := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- h.run(ctx, "twitch", func() error {
+			close(connected)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-connected
+	if code, body := serve(); code != http.StatusOK || body != `{"status":"ok","sources":{"twitch":{"state":"running"}}}` {
+		t.Errorf("running: %d %s", code, body)
+	}
+
+	// An ended stream isn't a failure
+	if err := h.run(ctx, "youtube:abc", func() error { return youtube.ErrChatEnded }); err != nil {
+		t.Errorf("run() of an ended stream = %v", err)
+	}
+	if h.exitCode() != 0 {
+		t.Errorf("exitCode() = %d after a stream ended, want 0", h.exitCode())
+	}
+
+	refused := fmt.Errorf("server disconnected: %w", hackrtv.ErrAuth)
+	if err := h.run(ctx, "hackrtv", func() error { return refused }); err != refused {
+		t.Errorf("run() = %v, want the source's error", err)
+	}
+	h.run(ctx, "eventsub", func() error { return errors.New("read error: EOF") })
+	code, body := serve()
+	want := `{"status":"failing","sources":{"eventsub":{"state":"failed","reason":"error","error":"read error: EOF"},` +
+		`"hackrtv":{"state":"failed","reason":"auth","error":"server disconnected: hackrtv: unauthorized"},` +
+		`"twitch":{"state":"running"},"youtube:abc":{"state":"stopped"}}}`
+	if code != http.StatusServiceUnavailable || body != want {
+		t.Errorf("failing: %d %s\nwant %s", code, body, want)
+	}
+	// The first failure decides the exit status
+	if got := h.exitCode(); got != 3 {
+		t.Errorf("exitCode() = %d, want 3 for a refused token", got)
+	}
+
+	// Shutting down stops a source without failing it
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run() after cancel = %v, want nil", err)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	p, err := retentionPolicy(config.RetentionPolicy{MaxAge: time.Hour, MaxSize: "2KB"})
+	if err != nil || p.MaxAge != time.Hour || p.MaxSize != 2048 {
+		t.Errorf("retentionPolicy() = %+v, %v", p, err)
+	}
+	if p, err := retentionPolicy(config.RetentionPolicy{}); err != nil || !p.IsZero() {
+		t.Errorf("empty policy = %+v, %v, want zero", p, err)
+	}
+	if _, err := retentionPolicy(config.RetentionPolicy{MaxSize: "lots"}); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestStateName(t *testing.T) {
+	if got := stateName("@hackr.tv/live"); got != "@hackr_tv_live" {
+		t.Errorf("stateName() = %q", got)
+	}
+}
+
+func TestIsReplay(t *testing.T) {
+	cutoff := time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		ts   time.Time
+		want bool
+	}{
+		{cutoff.Add(-time.Second), true},
+		{cutoff, false},
+		{cutoff.Add(time.Minute), false},
+		{time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := isReplay(message.Message{Timestamp: tt.ts}, cutoff); got != tt.want {
+			t.Errorf("isReplay(%v) = %v, want %v", tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestBridgeRoutes(t *testing.T) {
+	routes, err := bridgeRoutes([]config.BridgeRouteConfig{
+		{From: "twitch#xqc", To: "xqc-room"},
+		{From: "TTV"},
+	}, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		msg    message.Message
+		target string
+		ok     bool
+	}{
+		{message.Message{Platform: message.Twitch, Channel: "XQC"}, "xqc-room", true},
+		{message.Message{Platform: message.Twitch, Channel: "other"}, "live", true},
+		{message.Message{Platform: message.YouTube, Channel: "vid"}, "", false},
+		{message.Message{Platform: message.HackrTV}, "", false},
+	}
+	for _, tt := range tests {
+		if target, ok := routeTarget(routes, tt.msg); target != tt.target || ok != tt.ok {
+			t.Errorf("routeTarget(%s #%s) = %q, %v, want %q, %v", tt.msg.Platform, tt.msg.Channel, target, ok, tt.target, tt.ok)
+		}
+	}
+	if got := routeTargets(routes); !slices.Equal(got, []string{"xqc-room", "live"}) {
+		t.Errorf("routeTargets() = %q", got)
+	}
+
+	all, err := bridgeRoutes(nil, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []message.Platform{message.Twitch, message.YouTube} {
+		if target, ok := routeTarget(all, message.Message{Platform: p}); !ok || target != "live" {
+			t.Errorf("without routes, %s goes to %q, %v, want live", p, target, ok)
+		}
+	}
+	if _, ok := routeTarget(all, message.Message{Platform: message.HackrTV}); ok {
+		t.Error("hackr.tv chat should never be routed")
+	}
+
+	if _, err := bridgeRoutes([]config.BridgeRouteConfig{{From: "myspace"}}, "live"); err == nil {
+		t.Error("expected an error for an unknown platform")
+	}
+	if _, err := bridgeRoutes([]config.BridgeRouteConfig{{From: "hackrtv"}}, "live"); err == nil {
+		t.Error("expected an error for a route from hackr.tv")
+	}
+}
+
+func TestMirroredChatsRouted(t *testing.T) {
+	var cfg config.Config
+	cfg.YouTube.VideoIDs = []string{"vid-a"}
+	onlyTwitch := func(p message.Platform, channel string) bool { return p == message.Twitch }
+	if got := strings.Join(mirroredChats(cfg, []string{"xqc"}, onlyTwitch), ", "); got != "twitch.tv/xqc" {
+		t.Errorf("mirroredChats() = %q, want only the routed chat", got)
+	}
+}
+
+func TestHistoryOptions(t *testing.T) {
+	tests := []struct {
+		hc   config.HackrTVConfig
+		skip bool
+		last int
+		err  bool
+	}{
+		{config.HackrTVConfig{}, false, 0, false},
+		{config.HackrTVConfig{History: "all"}, false, 0, false},
+		{config.HackrTVConfig{History: "none"}, true, 0, false},
+		{config.HackrTVConfig{SkipHistory: true}, true, 0, false},
+		{config.HackrTVConfig{History: "last_20"}, false, 20, false},
+		{config.HackrTVConfig{History: "last_0"}, false, 0, true},
+		{config.HackrTVConfig{History: "some"}, false, 0, true},
+		{config.HackrTVConfig{History: "all", SkipHistory: true}, false, 0, true},
+	}
+	for _, tt := range tests {
+		skip, last, err := historyOptions(tt.hc)
+		if skip != tt.skip || last != tt.last || (err != nil) != tt.err {
+			t.Errorf("historyOptions(%+v) = %v, %d, %v", tt.hc, skip, last, err)
+		}
+	}
+}
+
+func TestSessionSummary(t *testing.T) {
+	d := dispatch.New()
+	for _, name := range []string{"printer", "uplink"} {
+		if err := d.Add(dispatch.Sink{Name: name, Handle: func(message.Message) {}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := map[message.Platform]int64{message.HackrTV: 3, message.Twitch: 5}
+	reconnects := []func() (message.Platform, int64){
+		func() (message.Platform, int64) { return message.HackrTV, 1 },
+		// A source that reconnected but relayed nothing is still listed
+		func() (message.Platform, int64) { return message.YouTube, 2 },
+		func() (message.Platform, int64) { return message.YouTube, 1 },
+	}
+	sum := sessionSummary(time.Minute, counts, reconnects, d)
+	want := []display.SourceSummary{
+		{Platform: message.Twitch, Messages: 5},
+		{Platform: message.YouTube, Reconnects: 3},
+		{Platform: message.HackrTV, Messages: 3, Reconnects: 1},
+	}
+	if !slices.Equal(sum.Sources, want) {
+		t.Errorf("Sources = %+v, want %+v", sum.Sources, want)
+	}
+	if len(sum.Dropped) != 2 || sum.Uptime != time.Minute {
+		t.Errorf("Dropped = %v, want both sinks", sum.Dropped)
+	}
+}
+
+func TestServerGuard(t *testing.T) {
+	if _, err := serverGuard(config.ServerConfig{Tokens: []config.ServerTokenConfig{{Token: "t", Scope: "admin"}}}); err == nil {
+		t.Error("an unknown scope should be rejected")
+	}
+	if _, err := serverGuard(config.ServerConfig{Tokens: []config.ServerTokenConfig{{Scope: "read"}}}); err == nil {
+		t.Error("a token entry without a token should be rejected")
+	}
+	g, err := serverGuard(config.ServerConfig{AllowRemote: true, Tokens: []config.ServerTokenConfig{{Token: "t"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckListen("0.0.0.0:8787"); err != nil {
+		t.Errorf("CheckListen() = %v, want remote allowed with a token", err)
+	}
+}
+
+func TestDisplayHandler(t *testing.T) {
+	g, err := serverGuard(config.ServerConfig{Tokens: []config.ServerTokenConfig{{Token: "reader"}, {Token: "mod", Scope: "control"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := display.NewFilter()
+	h := displayHandler(g, filter, "127.0.0.1:8787")
+	send := func(method, token, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://127.0.0.1:8787/api/display", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		return send(method, token, body, nil)
+	}
+
+	if w := do(http.MethodPost, "reader", `{"action":"mute","target":"ttv"}`); w.Code != http.StatusForbidden {
+		t.Errorf("mute with a read token: status %d, want 403", w.Code)
+	}
+	if w := do(http.MethodPost, "mod", `{"action":"mute","target":"ttv#xqc"}`); w.Code != http.StatusOK {
+		t.Errorf("mute: status %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "mod", `{"action":"shout","target":"ttv"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown action: status %d, want 400", w.Code)
+	}
+	// Another site's page can't change the display, by a form post or
+	// by a name rebound to loopback
+	if w := send(http.MethodPost, "mod", `{"action":"solo","target":"yt"}`, http.Header{"Content-Type": {"text/plain"}}); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain body: status %d, want 415", w.Code)
+	}
+	if w := send(http.MethodPost, "mod", `{"action":"solo","target":"yt"}`, http.Header{"Origin": {"https://evil.example"}}); w.Code != http.StatusForbidden {
+		t.Errorf("cross-origin POST: status %d, want 403", w.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "http://evil.example:8787/api/display", strings.NewReader(`{"action":"solo","target":"yt"}`))
+	r.Header.Set("Authorization", "Bearer mod")
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST to a rebound Host: status %d, want 403", rec.Code)
+	}
+	if w := send(http.MethodPost, "mod", `{"action":"unsolo"}`, http.Header{"Origin": {"http://127.0.0.1:8787"}, "Content-Type": {"application/json; charset=utf-8"}}); w.Code != http.StatusOK {
+		t.Errorf("same-origin POST: status %d: %s", w.Code, w.Body)
+	}
+
+	w := do(http.MethodGet, "reader", "")
+	if got := strings.TrimSpace(w.Body.String()); got != `{"muted":["TTV#xqc"],"solo":[]}` {
+		t.Errorf("GET = %s", got)
+	}
+}
+
+func TestEnterSafeMode(t *testing.T) {
+	cfg := config.Config{
+		Bridge:     true,
+		StateDir:   "state",
+		Bus:        config.BusConfig{URL: "nats://bus:4222", Role: "publish"},
+		ChatLog:    config.ChatLogConfig{Dir: "logs"},
+		API:        config.APIConfig{Listen: "127.0.0.1:8787", Dashboard: true},
+		Supporters: config.SupportersConfig{Channel: "subs"},
+		Display:    config.DisplayConfig{Template: "{{.Content}}"},
+	}
+	off := enterSafeMode(&cfg)
+	want := []string{"bridge", "bus", "chat log", "HTTP API", "output template", "saved state"}
+	if !slices.Equal(off, want) {
+		t.Errorf("enterSafeMode() = %q, want %q", off, want)
+	}
+	if cfg.Bridge || cfg.Bus.URL != "" || cfg.ChatLog.Dir != "" || cfg.API.Listen != "" || cfg.API.Dashboard ||
+		cfg.Supporters.Channel != "" || cfg.Display.Template != "" || cfg.StateDir != "" {
+		t.Errorf("safe config still has something on: %+v", cfg)
+	}
+
+	// A consuming relay keeps the bus, its only source of chat
+	cfg = config.Config{Bus: config.BusConfig{URL: "nats://bus:4222", Role: "consume"}}
+	if off := enterSafeMode(&cfg); len(off) != 0 || cfg.Bus.URL == "" {
+		t.Errorf("consume: turned off %q, bus %+v", off, cfg.Bus)
+	}
+}
+
+func TestSafeModeLines(t *testing.T) {
+	crashed := time.Date(2025, 1, 15, 14, 30, 0, 0, time.Local)
+	lines := safeModeLines([]time.Time{crashed, crashed.Add(time.Minute), crashed.Add(2 * time.Minute)}, []string{"bridge", "chat log"})
+	if lines[0] != "The relay crashed 3 times since 14:30:00." || lines[2] != "Turned off: bridge, chat log." {
+		t.Errorf("safeModeLines() = %q", lines)
+	}
+	if lines := safeModeLines(nil, nil); lines[0] != "Started with --safe-mode." || len(lines) != 3 {
+		t.Errorf("safeModeLines() when forced = %q", lines)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() config.Config {
+		var cfg config.Config
+		cfg.ApplyDefaults()
+		cfg.Twitch.Channels = []string{"xqc"}
+		applyEnv(&cfg)
+		return cfg
+	}
+	if err := validate(valid(), false); err != nil {
+		t.Fatalf("validate() = %v, want nil", err)
+	}
+	if err := validate(config.Config{}, false); !errors.Is(err, errNoPlatform) {
+		t.Errorf("validate() with no platform = %v, want errNoPlatform", err)
+	}
+	if err := validate(config.Config{}, true); errors.Is(err, errNoPlatform) {
+		t.Errorf("validate() for the demo = %v, want no platform needed", err)
+	}
+
+	for name, change := range map[string]func(*config.Config){
+		"bus url without role": func(cfg *config.Config) { cfg.Bus.URL = "nats://bus:4222" },
+		"bridge without token": func(cfg *config.Config) { cfg.Bridge, cfg.HackrTV.URL = true, "wss://hackr.tv/cable" },
+		"strict with workers":  func(cfg *config.Config) { cfg.BridgeOrder, cfg.BridgeWorkers = "strict", 4 },
+		"unknown sink":         func(cfg *config.Config) { cfg.Sinks = map[string]config.SinkConfig{"irc": {}} },
+		"tui with json":        func(cfg *config.Config) { cfg.Display.TUI, cfg.Display.Output = true, "json" },
+	} {
+		cfg := valid()
+		change(&cfg)
+		if err := validate(cfg, false); err == nil {
+			t.Errorf("%s: validate() = nil, want an error", name)
+		}
+	}
+}
+
+func TestApplyNoHistoryFlag(t *testing.T) {
+	for _, tt := range []struct {
+		value       bool
+		wantSkip    bool
+		wantHistory string
+	}{
+		{true, true, ""},
+		{false, false, "last_20"},
+	} {
+		f := &cliFlags{hackrtvNoHistory: &tt.value, set: map[string]bool{"hackrtv-no-history": true}}
+		var cfg config.Config
+		cfg.HackrTV.History = "last_20"
+		f.apply(&cfg)
+		if cfg.HackrTV.SkipHistory != tt.wantSkip || cfg.HackrTV.History != tt.wantHistory {
+			t.Errorf("--hackrtv-no-history=%t: skip_history = %t, history = %q; want %t, %q", tt.value, cfg.HackrTV.SkipHistory, cfg.HackrTV.History, tt.wantSkip, tt.wantHistory)
+		}
+	}
+}
+
+func TestValidateSinkSections(t *testing.T) {
+	for _, sink := range []string{"chat_log", "notifications"} {
+		path := filepath.Join(t.TempDir(), "relay.toml")
+		data := "[twitch]\nchannels = [\"xqc\"]\n\n[sinks." + sink + "]\nbuffer = 500\noverflow = \"drop\"\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := config.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.ApplyDefaults()
+		applyEnv(&cfg)
+		if err := validate(cfg, false); err != nil {
+			t.Errorf("[sinks.%s]: validate() = %v, want nil", sink, err)
+		}
+	}
+}
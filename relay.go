@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"relay/internal/chatlog"
+	"relay/internal/config"
+	"relay/internal/console"
+	"relay/internal/currency"
+	"relay/internal/demo"
+	"relay/internal/dispatch"
+	"relay/internal/display"
+	"relay/internal/echo"
+	"relay/internal/emote"
+	"relay/internal/enrich"
+	"relay/internal/filter"
+	"relay/internal/highlight"
+	"relay/internal/hype"
+	"relay/internal/message"
+	"relay/internal/notify"
+	"relay/internal/optout"
+	"relay/internal/preview"
+	"relay/internal/retention"
+	"relay/internal/signing"
+	"relay/internal/tui"
+	"relay/internal/uplink"
+	"relay/internal/youtube"
+)
+
+// relay is one run: the checked config and what main parsed from it,
+// and the pipeline run builds from them, which the setup steps in this
+// package add their sources and sinks to.
+type relay struct {
+	cfg      config.Config
+	demoMode bool
+	personas []demo.Persona
+	// busConsume takes chat from the bus instead of the platforms
+	busConsume     bool
+	twitchChannels []string
+	htvChannels    []string
+	timestamps     display.Timestamps
+	bridgeTmpl     *uplink.Template
+	routes         []bridgeRoute
+	// echoes holds the IDs of packets the Uplink API created, so the
+	// bridge's own messages are dropped when hackr.tv sends them back
+	echoes                    *echo.Set
+	highlightsKeep, spillKeep retention.Policy
+	// safeModeWarning explains safe mode, when the relay is in it
+	safeModeWarning []string
+
+	ctx        context.Context
+	status     *display.Status
+	merger     *dispatch.Merger
+	dispatcher *dispatch.Dispatcher
+	health     *sourceHealth
+	con        *console.Console
+	// view is the TUI and api the HTTP API, each nil when not enabled
+	view *tui.TUI
+	api  *api
+	// optOut and bridgeFilter keep chat off hackr.tv; both are nil
+	// without a bridge
+	optOut       *optout.List
+	bridgeFilter *filter.Filter
+	// reconnects reports each source's reconnects, for the summary
+	reconnects []func() (message.Platform, int64)
+	// sources are connected once every sink is in place
+	sources []source
+
+	hooksMu sync.Mutex
+	// shutdownHooks run on an interrupt, while the sources are still
+	// connected
+	shutdownHooks []func()
+}
+
+// run builds the pipeline, runs it until every source has ended or the
+// relay is interrupted, and returns the exit status.
+func (r *relay) run() int {
+	cfg := r.cfg
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.ctx = ctx
+
+	// Connection banners and the shutdown summary go to stderr, tagged
+	// like chat
+	r.status = display.NewStatus()
+	started := time.Now()
+	interrupt := r.handleSignals(cancel)
+
+	// Each source sends on its own channel, merged into one stream. Source
+	// channels are never closed, so no source goroutine can panic on send.
+	r.merger = dispatch.NewMerger(100)
+	// Fan-out: the dispatcher gives each sink its own queue, so a slow
+	// bridge never holds up the printer. Sinks are added below.
+	r.dispatcher = dispatch.New()
+	// How each chat source is doing, for /api/health and the exit status
+	r.health = newSourceHealth()
+
+	// Recent chat is kept for /clip
+	highlights := highlight.NewRecorder(cfg.Highlights.Window)
+	signer := r.newSigner()
+	display.SetSigner(signer)
+	// The printer is made early so the dashboard and the TUI can share
+	// its mutes
+	printer, keywords := r.newPrinter()
+
+	// Console commands (/mute, /solo, /help, ...), typed on stdin or on
+	// the TUI's command line
+	r.con = console.New(os.Stderr)
+	registerDisplayCommands(r.con, printer.Filter())
+	// Quitting the TUI shuts down as Ctrl+C does outside it
+	r.view = newView(cfg, printer.Filter(), keywords, r.timestamps, r.con.Exec, func() {
+		select {
+		case interrupt <- os.Interrupt:
+		default:
+		}
+	})
+	r.api = startAPI(ctx, cfg, r.status, printer.Filter(), r.health, signer)
+
+	if r.demoMode {
+		r.sources = append(r.sources, source{
+			platform: message.Relay,
+			banner:   fmt.Sprintf("Generating demo chat (seed %d)", cfg.Demo.Seed),
+			connect:  demo.New(demo.Options{Seed: cfg.Demo.Seed, Rate: cfg.Demo.Rate, Personas: r.personas}).Connect,
+		})
+	}
+	p := r.newPlatforms()
+	if r.view == nil {
+		go r.con.Run(os.Stdin)
+	}
+	var createClip func(context.Context) (string, error)
+	if cfg.Highlights.TwitchClip && p.eventSub != nil {
+		createClip = p.eventSub.CreateClip
+	}
+	registerClipCommand(r.con, highlights, cfg.Highlights.File, createClip)
+
+	if cfg.Bridge {
+		r.newBridgeFilters()
+	}
+	dispatched, sourceCounts := r.fanIn(r.preprocess(r.merger.Output(), p), highlights, started)
+
+	// The printer always receives, as text or as JSON lines for tools,
+	// or in the TUI
+	show := printer.Handle
+	if r.view != nil {
+		show = r.view.Handle
+	}
+	addSink(r.dispatcher, dispatch.Sink{
+		Name:    "printer",
+		Handle:  withRoute(cfg.Sinks["printer"], show),
+		Options: sinkOptions(cfg.Sinks["printer"], dispatch.OverflowBlock),
+	})
+	r.bridgeToYouTube(p)
+	ul := r.startUplinks(p.hackrTV)
+	r.bridgeToTwitch(p)
+	r.addReplies(p)
+	r.startRetention(ul.spill)
+	busClient := r.startBus()
+	chatLog := r.addChatLog()
+	r.addNotifications(keywords)
+
+	// The TUI takes over the terminal from here. What the relay writes
+	// to stderr is shown in it until it closes, after the sinks finish.
+	stopTUI := func() {}
+	if r.view != nil {
+		var err error
+		if stopTUI, err = startTUI(r.view); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --tui: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(r.safeModeWarning) > 0 {
+		r.status.Warning(message.Relay, "SAFE MODE", r.safeModeWarning...)
+	}
+
+	dispatchDone := make(chan struct{})
+	go func() {
+		r.dispatcher.Run(ctx, dispatched)
+		close(dispatchDone)
+	}()
+
+	var sources sync.WaitGroup
+	r.startSources(&sources)
+
+	// Wait for all sources to finish, then end the merged stream and let
+	// the sinks finish what is queued, e.g. a "stream ended" event
+	sources.Wait()
+	r.merger.Close()
+	<-dispatchDone
+	stopTUI()
+	ul.drain()
+	cancel()
+	ul.retries.Wait()
+	// Closed here rather than deferred, since a failed source exits
+	// with its own status
+	if busClient != nil {
+		busClient.Close()
+	}
+	if chatLog != nil {
+		chatLog.Close()
+	}
+
+	r.status.Summary(sessionSummary(time.Since(started), sourceCounts, r.reconnects, r.dispatcher))
+	return r.health.exitCode()
+}
+
+// handleSignals cancels the run on SIGINT or SIGTERM, after the shutdown
+// hooks. It returns the channel the signals arrive on, so the TUI can
+// quit the same way.
+func (r *relay) handleSignals(cancel context.CancelFunc) chan<- os.Signal {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Fprintln(os.Stderr, "\nShutting down...")
+		r.hooksMu.Lock()
+		for _, hook := range r.shutdownHooks {
+			hook()
+		}
+		r.hooksMu.Unlock()
+		cancel()
+	}()
+	return sigChan
+}
+
+// onShutdown adds a hook run on an interrupt, before the sources
+// disconnect.
+func (r *relay) onShutdown(hook func()) {
+	r.hooksMu.Lock()
+	r.shutdownHooks = append(r.shutdownHooks, hook)
+	r.hooksMu.Unlock()
+}
+
+// track reports a source's reconnects in the summary, on the dashboard,
+// and in the TUI's status bar. A nil count only lists the source on the
+// dashboard and in the TUI.
+func (r *relay) track(p message.Platform, count func() int64) {
+	if count != nil {
+		r.reconnects = append(r.reconnects, func() (message.Platform, int64) { return p, count() })
+	}
+	r.api.track(p, count)
+	if r.view != nil {
+		r.view.Track(p, count)
+	}
+}
+
+// newSigner loads the key that signs the relay's JSON, so consumers can
+// check it came from this instance, or returns nil without [signing].
+func (r *relay) newSigner() *signing.Signer {
+	if !r.cfg.Signing.Enabled {
+		return nil
+	}
+	keyFile := r.cfg.Signing.KeyFile
+	if keyFile == "" && r.cfg.StateDir != "" {
+		keyFile = filepath.Join(r.cfg.StateDir, "signing.key")
+	}
+	if keyFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: [signing] requires key_file or --state-dir")
+		os.Exit(1)
+	}
+	signer, err := signing.LoadOrCreate(keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [signing] %v\n", err)
+		os.Exit(1)
+	}
+	r.status.Banner(message.Relay, "Signing JSON with Ed25519 public key %s", signer.PublicKey())
+	return signer
+}
+
+// newPrinter makes the printer for [display], with --show's platforms
+// alone unmuted, and the highlight words it picks out.
+func (r *relay) newPrinter() (*display.Printer, *display.Highlights) {
+	cfg := r.cfg
+	printer := display.NewPrinter()
+	switch {
+	case cfg.Display.Output == "json":
+		printer = display.NewJSONPrinter()
+	case cfg.Display.Template != "":
+		var err error
+		if printer, err = display.NewTemplatePrinter(cfg.Display.Template); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	printer.SetWidth(cfg.Display.Width)
+	printer.SetEmotes(cfg.Display.Emotes)
+	printer.SetTimestamps(r.timestamps)
+	keywords := display.NewHighlights(cfg.Display.Highlights)
+	printer.SetHighlights(keywords, cfg.Display.Bell)
+
+	// --show mutes the platforms left out, which /unmute shows again
+	if len(cfg.Display.Platforms) > 0 {
+		var shown []message.Platform
+		for _, name := range cfg.Display.Platforms {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			p, ok := message.ParsePlatform(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Error: [display] platforms: unknown platform %q\n", name)
+				os.Exit(1)
+			}
+			shown = append(shown, p)
+		}
+		printer.Filter().ShowOnly(shown...)
+	}
+	return printer, keywords
+}
+
+// newBridgeFilters loads what keeps chat off hackr.tv: viewers who opted
+// out with !nobridge, and bot spam, commands, and unwanted words.
+func (r *relay) newBridgeFilters() {
+	var err error
+	if r.optOut, err = optout.New(r.cfg.BridgeOptOut, r.cfg.BridgeOptOutFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: bridge_opt_out: %v\n", err)
+		os.Exit(1)
+	}
+	bf := r.cfg.BridgeFilters
+	r.bridgeFilter, err = filter.New(filter.Options{
+		DenyUsers:     bf.DenyUsers,
+		AllowUsers:    bf.AllowUsers,
+		DenyWords:     bf.DenyWords,
+		DenyPatterns:  bf.DenyPatterns,
+		MinLength:     bf.MinLength,
+		SkipCommands:  bf.SkipCommands,
+		MinAccountAge: bf.MinAccountAge,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [bridge_filters] %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// preprocess starts the optional stages the merged stream passes
+// through before fan-out: link previews, BetterTTV and 7TV emotes, and
+// sender lookups. It returns the stream out of the last.
+func (r *relay) preprocess(stream <-chan message.Message, p *platforms) <-chan message.Message {
+	cfg, ctx := r.cfg, r.ctx
+	if cfg.Previews.Enabled {
+		enriched := make(chan message.Message, 100)
+		fetcher := preview.NewFetcher(preview.Options{
+			Deny:          cfg.Previews.Deny,
+			MaxConcurrent: cfg.Previews.MaxConcurrent,
+			Timeout:       cfg.Previews.Timeout,
+		})
+		go fetcher.Run(ctx, stream, enriched)
+		stream = enriched
+	}
+
+	// The emote lookups find channel IDs through the Twitch client
+	if len(cfg.Emotes.Providers) > 0 {
+		finder, err := emote.New(emote.Options{
+			Providers: cfg.Emotes.Providers,
+			Refresh:   cfg.Emotes.Refresh,
+			ChannelID: func(channel string) string {
+				if p.twitch == nil {
+					return ""
+				}
+				return p.twitch.RoomID(channel)
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: [emotes] %v\n", err)
+			os.Exit(1)
+		}
+		found := make(chan message.Message, 100)
+		go finder.Run(ctx, stream, found)
+		stream = found
+	}
+
+	if cfg.Enrich.Enabled {
+		resolvers := make(map[message.Platform]enrich.Resolver)
+		if p.eventSub != nil {
+			resolvers[message.Twitch] = func(ctx context.Context, msg message.Message) (message.Profile, error) {
+				return p.eventSub.Profile(ctx, msg.UserID, msg.Username)
+			}
+		}
+		if p.ytPool != nil {
+			lookups := youtube.NewClient(p.ytPool, "", youtube.Options{BaseURL: cfg.YouTube.BaseURL})
+			resolvers[message.YouTube] = func(ctx context.Context, msg message.Message) (message.Profile, error) {
+				if msg.UserID == "" {
+					return message.Profile{}, errors.New("no channel ID")
+				}
+				return lookups.Profile(ctx, msg.UserID)
+			}
+		}
+		enriched := make(chan message.Message, 100)
+		enricher := enrich.New(enrich.Options{
+			Resolvers: resolvers,
+			CacheSize: cfg.Enrich.CacheSize,
+			TTL:       cfg.Enrich.TTL,
+			Rate:      cfg.Enrich.Rate,
+			Timeout:   cfg.Enrich.Timeout,
+		})
+		go enricher.Run(ctx, stream, enriched)
+		stream = enriched
+	}
+	return stream
+}
+
+// fanIn passes stream on to the dispatcher, dropping history older than
+// the replay window and the bridge's own echoes, valuing amounts in the
+// base currency, noting opt-out commands, and adding hype events. Every
+// message is also recorded for /clip and the HTTP API. The returned
+// channel is closed at the end of stream, and the counts of messages
+// per platform are final once it is.
+func (r *relay) fanIn(stream <-chan message.Message, highlights *highlight.Recorder, started time.Time) (<-chan message.Message, map[message.Platform]int64) {
+	cfg := r.cfg
+	var hypeDetector *hype.Detector
+	if cfg.Hype.Enabled {
+		hypeDetector = hype.NewDetector(hype.Options{
+			Window:      cfg.Hype.Window,
+			Baseline:    cfg.Hype.Baseline,
+			Factor:      cfg.Hype.Factor,
+			MinMessages: cfg.Hype.MinMessages,
+			Cooldown:    cfg.Hype.Cooldown,
+		})
+	}
+	var converter *currency.Converter
+	if cfg.Currency.Enabled {
+		converter = currency.New(currency.Options{
+			Base:     cfg.Currency.Base,
+			RatesURL: cfg.Currency.RatesURL,
+		})
+		go converter.Run(r.ctx)
+	}
+
+	// History replayed on connect is older than the replay window
+	replayCutoff := started.Add(-cfg.ReplayWindow)
+	replaySkipped := make(map[message.Platform]bool)
+	counts := make(map[message.Platform]int64)
+	dispatched := make(chan message.Message, 100)
+	go func() {
+		deliver := func(msg message.Message) {
+			highlights.Add(msg)
+			r.api.add(msg)
+			dispatched <- msg
+		}
+		for msg := range stream {
+			if cfg.ReplayWindow > 0 && isReplay(msg, replayCutoff) {
+				if !replaySkipped[msg.Platform] {
+					replaySkipped[msg.Platform] = true
+					fmt.Fprintf(os.Stderr, "Skipping %s messages from before %s (replay window)\n", msg.Platform, replayCutoff.Format(time.TimeOnly))
+				}
+				continue
+			}
+			// In bridge mode, suppress HTV echoes of our own bridged
+			// messages. Echoes known by ID never get here, but packets
+			// from an earlier run, replayed as history, are only known by
+			// the template
+			if cfg.Bridge && isBridgeEcho(msg, cfg.HackrTV.Alias, r.bridgeTmpl) {
+				continue
+			}
+			counts[msg.Platform]++
+			if converter != nil {
+				msg = converter.Normalize(msg)
+			}
+			if r.optOut != nil && msg.Platform != message.HackrTV {
+				if ok, err := r.optOut.Observe(msg); err != nil {
+					fmt.Fprintf(os.Stderr, "Bridge opt-out error: %v\n", err)
+				} else if ok {
+					fmt.Fprintf(os.Stderr, "%s (%s) sent %s\n", msg.Username, msg.Platform, strings.Fields(msg.Content)[0])
+				}
+			}
+			deliver(msg)
+			if hypeDetector != nil {
+				if ev, ok := hypeDetector.Observe(msg); ok {
+					deliver(ev)
+				}
+			}
+		}
+		close(dispatched)
+	}()
+	return dispatched, counts
+}
+
+// startRetention keeps the files the relay appends to within
+// [retention]: the highlights file, and spill's spill file.
+func (r *relay) startRetention(spill *uplink.Client) {
+	if r.highlightsKeep.IsZero() && (spill == nil || r.spillKeep.IsZero()) {
+		return
+	}
+	go runRetention(r.ctx, r.cfg.Retention.Interval, func() {
+		if _, err := highlight.Prune(r.cfg.Highlights.File, r.highlightsKeep, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Retention error: %v\n", err)
+		}
+		if spill != nil {
+			if err := spill.PruneRetries(); err != nil {
+				fmt.Fprintf(os.Stderr, "Retention error: %v\n", err)
+			}
+		}
+	})
+}
+
+// addChatLog adds the chat_log sink, which archives every message
+// whatever the display mutes, or returns nil without --chat-log.
+func (r *relay) addChatLog() *chatlog.Log {
+	cfg := r.cfg
+	if cfg.ChatLog.Dir == "" {
+		return nil
+	}
+	chatLog, err := chatlog.New(chatlog.Options{Dir: cfg.ChatLog.Dir, Format: cfg.ChatLog.Format})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [chat_log] %v\n", err)
+		os.Exit(1)
+	}
+	r.status.Banner(message.Relay, "Logging chat to %s", chatLog.Path(time.Now()))
+	// Only the first failure and the recovery are logged
+	var failing atomic.Bool
+	addSink(r.dispatcher, dispatch.Sink{
+		Name: "chat_log",
+		Handle: withRoute(cfg.Sinks["chat_log"], func(msg message.Message) {
+			if err := chatLog.Write(msg); err != nil {
+				if !failing.Swap(true) {
+					fmt.Fprintf(os.Stderr, "Chat log error: %v\n", err)
+				}
+			} else if failing.Swap(false) {
+				fmt.Fprintln(os.Stderr, "Chat log writing again")
+			}
+		}),
+		Options: sinkOptions(cfg.Sinks["chat_log"], dispatch.OverflowBlock),
+	})
+	return chatLog
+}
+
+// addNotifications adds the notifications sink, which pops up chat that
+// shouldn't be missed while the terminal is hidden, such as chat with
+// one of keywords.
+func (r *relay) addNotifications(keywords *display.Highlights) {
+	cfg, ctx := r.cfg, r.ctx
+	if !cfg.Notifications.Enabled {
+		return
+	}
+	opts := notify.Options{
+		Events:     cfg.Notifications.Events,
+		Highlights: keywords,
+		Users:      cfg.Notifications.Users,
+		Cooldown:   cfg.Notifications.Cooldown,
+	}
+	if len(cfg.Notifications.Command) > 0 {
+		opts.Backend = notify.Command(cfg.Notifications.Command)
+	}
+	notifier, err := notify.New(opts)
+	if errors.Is(err, notify.ErrUnsupported) {
+		err = fmt.Errorf("%w; install notify-send or terminal-notifier, or set command", err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: [notifications] %v\n", err)
+		os.Exit(1)
+	}
+	// Only the first failure and the recovery are logged
+	var failing atomic.Bool
+	addSink(r.dispatcher, dispatch.Sink{
+		Name:   "notifications",
+		Accept: notifier.Match,
+		Handle: withRoute(cfg.Sinks["notifications"], func(msg message.Message) {
+			if err := notifier.Handle(ctx, msg); err != nil {
+				if !failing.Swap(true) && ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "Notification error: %v\n", err)
+				}
+			} else if failing.Swap(false) {
+				fmt.Fprintln(os.Stderr, "Notifications working again")
+			}
+		}),
+		Options: sinkOptions(cfg.Sinks["notifications"], dispatch.OverflowDrop),
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"relay/internal/config"
+	"relay/internal/markup"
+	"relay/internal/message"
+)
+
+// bridgeRoute sends chat from one platform, or one of its channels, to a
+// hackr.tv channel.
+type bridgeRoute struct {
+	platform message.Platform
+	// channel limits the route to one Twitch channel or YouTube video;
+	// empty matches them all.
+	channel string
+	target  string
+}
+
+func (r bridgeRoute) String() string {
+	if r.channel == "" {
+		return r.platform.Key()
+	}
+	return r.platform.Key() + "#" + r.channel
+}
+
+// bridgeRoutes parses [[bridge_routes]], sending entries without a
+// target to defaultTarget. With no entries, every platform outside
+// hackr.tv goes to defaultTarget.
+func bridgeRoutes(entries []config.BridgeRouteConfig, defaultTarget string) ([]bridgeRoute, error) {
+	if len(entries) == 0 {
+		var routes []bridgeRoute
+		for _, p := range message.Platforms() {
+			if p != message.HackrTV && p != message.Relay {
+				routes = append(routes, bridgeRoute{platform: p, target: defaultTarget})
+			}
+		}
+		return routes, nil
+	}
+	routes := make([]bridgeRoute, 0, len(entries))
+	for _, e := range entries {
+		name, channel, _ := strings.Cut(e.From, "#")
+		p, ok := message.ParsePlatform(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown platform in from = %q", e.From)
+		}
+		if p == message.HackrTV || p == message.Relay {
+			return nil, fmt.Errorf("from = %q: only chat from outside hackr.tv is bridged", e.From)
+		}
+		routes = append(routes, bridgeRoute{platform: p, channel: strings.TrimSpace(channel), target: cmp.Or(e.To, defaultTarget)})
+	}
+	return routes, nil
+}
+
+// routeTarget returns the hackr.tv channel msg is bridged to, from the
+// first route that matches it, or false when none does.
+func routeTarget(routes []bridgeRoute, msg message.Message) (string, bool) {
+	for _, r := range routes {
+		if r.platform == msg.Platform && (r.channel == "" || strings.EqualFold(r.channel, strings.TrimPrefix(msg.Channel, "#"))) {
+			return r.target, true
+		}
+	}
+	return "", false
+}
+
+// routeTargets lists the hackr.tv channels routes post to, in order.
+func routeTargets(routes []bridgeRoute) []string {
+	var targets []string
+	for _, r := range routes {
+		if !slices.Contains(targets, r.target) {
+			targets = append(targets, r.target)
+		}
+	}
+	return targets
+}
+
+// withRoute rewrites each message for a sink's route before handle,
+// skipping chat that nothing is left of, and appends the route's footer.
+// Deletions are passed on untouched.
+func withRoute(sc config.SinkConfig, handle func(message.Message)) func(message.Message) {
+	opts := markupOptions(sc)
+	if opts.IsZero() && sc.Footer == "" {
+		return handle
+	}
+	return func(msg message.Message) {
+		if msg.Type == message.TypeDeletion {
+			handle(msg)
+			return
+		}
+		msg, ok := markup.Translate(msg, opts)
+		if !ok {
+			return
+		}
+		msg.Content += sc.Footer
+		handle(msg)
+	}
+}
+
+// mirroredChats names the chats the bridge mirrors, e.g.
+// "twitch.tv/xqc" or "youtu.be/VIDEO_ID".
+func mirroredChats(cfg config.Config, twitchChannels []string, keep func(p message.Platform, channel string) bool) []string {
+	if keep == nil {
+		keep = func(message.Platform, string) bool { return true }
+	}
+	var chats []string
+	for _, ch := range twitchChannels {
+		if keep(message.Twitch, ch) {
+			chats = append(chats, "twitch.tv/"+ch)
+		}
+	}
+	for _, id := range cfg.YouTube.AllVideoIDs() {
+		if keep(message.YouTube, id) {
+			chats = append(chats, "youtu.be/"+id)
+		}
+	}
+	switch {
+	case len(cfg.YouTube.AllVideoIDs()) > 0 || !keep(message.YouTube, ""):
+	case cfg.YouTube.Handle != "":
+		chats = append(chats, "youtube.com/"+cfg.YouTube.Handle)
+	case cfg.YouTube.ChannelID != "":
+		chats = append(chats, "youtube.com/channel/"+cfg.YouTube.ChannelID)
+	}
+	return chats
+}
+
+// mirrorName names the hackr.tv chat the bridge posts to, e.g.
+// "hackr.tv #live".
+func mirrorName(cfg config.Config, htvChannels []string) string {
+	host := "hackr.tv"
+	if u, err := url.Parse(cfg.HackrTV.URL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	if len(htvChannels) == 0 {
+		return host
+	}
+	return host + " #" + htvChannels[0]
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"relay/internal/hackrtv"
+	"relay/internal/message"
+	"relay/internal/twitch"
+	"relay/internal/twitcheventsub"
+	"relay/internal/youtube"
+)
+
+// source is a chat source the relay reads until it ends or the relay
+// stops.
+type source struct {
+	// name is the source in /api/health, e.g. "youtube:VIDEO_ID"; the
+	// demo has none
+	name     string
+	platform message.Platform
+	// banner is printed as it connects
+	banner  string
+	connect func(context.Context, chan<- message.Message) error
+	// failed reports the error the source stopped with
+	failed func(error)
+}
+
+// platforms are the chat platforms' clients, built before the sinks that
+// post back through them. Each is nil when its platform isn't read.
+type platforms struct {
+	twitch   *twitch.Client
+	eventSub *twitcheventsub.Client
+	hackrTV  *hackrtv.Client
+	// ytPool is the key pool the YouTube pollers and sender lookups
+	// share, and so its quota budget
+	ytPool *youtube.KeyPool
+	// ytPoster is the first YouTube chat's client when it can post, with
+	// OAuth
+	ytPoster *youtube.Client
+}
+
+// newPlatforms builds a client for each platform configured, adding each
+// to the relay's sources. A relay consuming from the bus reads none.
+func (r *relay) newPlatforms() *platforms {
+	p := &platforms{}
+	if r.busConsume {
+		return p
+	}
+	cfg := r.cfg
+
+	if es := cfg.Twitch.EventSub; es.ClientID != "" {
+		p.eventSub = twitcheventsub.NewClient(es.ClientID, es.Token, es.Broadcaster)
+		if cfg.KeepRaw {
+			p.eventSub.KeepRaw()
+		}
+	}
+	if cfg.YouTube.Enabled() && cfg.YouTube.Transport == "api" {
+		p.ytPool = youtube.NewKeyPool(cfg.YouTube.AllAPIKeys()...)
+	}
+
+	if cfg.HackrTV.URL != "" {
+		skipHistory, historyLast, err := historyOptions(cfg.HackrTV)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: [hackrtv] %v\n", err)
+			os.Exit(1)
+		}
+		p.hackrTV = hackrtv.NewClient(cfg.HackrTV.URL, cfg.HackrTV.Token, cfg.HackrTV.Alias, r.htvChannels, hackrtv.Options{
+			StaleThreshold: cfg.HackrTV.StaleTimeout,
+			ConfirmTimeout: cfg.HackrTV.ConfirmTimeout,
+			SkipHistory:    skipHistory,
+			HistoryLast:    historyLast,
+			HeaderAuth:     cfg.HackrTV.HeaderAuth,
+			ChannelClass:   cfg.HackrTV.ChannelClass,
+			Subscriptions:  htvSubscriptions(cfg.HackrTV.Subscriptions),
+			Echoes:         r.echoes,
+			WriteTimeout:   cfg.SendTimeout,
+			KeepRaw:        cfg.KeepRaw,
+		})
+		registerWhoCommand(r.con, p.hackrTV, r.htvChannels)
+		r.track(message.HackrTV, p.hackrTV.Reconnects)
+	}
+
+	ytSources := r.newYouTube(p)
+
+	if len(r.twitchChannels) > 0 {
+		p.twitch = twitch.NewClient(r.twitchChannels, twitch.Options{
+			Server:       cfg.Twitch.Server,
+			Plaintext:    cfg.Twitch.Plaintext,
+			Nick:         cfg.Twitch.Nick,
+			Token:        cfg.Twitch.Token,
+			Capabilities: cfg.Twitch.Capabilities,
+			WriteTimeout: cfg.SendTimeout,
+			KeepRaw:      cfg.KeepRaw,
+		})
+		r.track(message.Twitch, nil)
+		r.sources = append(r.sources, source{
+			name:     "twitch",
+			platform: message.Twitch,
+			banner:   "Connecting to channels: " + strings.Join(r.twitchChannels, ", "),
+			connect:  p.twitch.Connect,
+			failed:   func(err error) { fmt.Fprintf(os.Stderr, "Twitch error: %v\n", err) },
+		})
+	}
+	if p.eventSub != nil {
+		r.sources = append(r.sources, source{
+			name:     "eventsub",
+			platform: message.Twitch,
+			banner:   "Connecting to EventSub for: " + cfg.Twitch.EventSub.Broadcaster,
+			connect:  p.eventSub.Connect,
+			failed:   func(err error) { fmt.Fprintf(os.Stderr, "Twitch EventSub error: %v\n", err) },
+		})
+	}
+	r.sources = append(r.sources, ytSources...)
+	if p.hackrTV != nil {
+		r.sources = append(r.sources, source{
+			name:     "hackrtv",
+			platform: message.HackrTV,
+			banner:   "Connecting to channels: " + strings.Join(r.htvChannels, ", "),
+			connect:  p.hackrTV.Connect,
+			failed:   func(err error) { fmt.Fprintf(os.Stderr, "hackr.tv error: %v\n", err) },
+		})
+	}
+	return p
+}
+
+// newYouTube builds one YouTube reader per video, or one following the
+// channel, with whichever transport is configured. With [youtube.oauth]
+// and a bridge to hackr.tv, the first authorizes to post, running the
+// device flow on first use.
+func (r *relay) newYouTube(p *platforms) []source {
+	cfg := r.cfg
+	if !cfg.YouTube.Enabled() {
+		return nil
+	}
+	var sources []source
+	add := func(name, banner string, connect func(context.Context, chan<- message.Message) error) {
+		sources = append(sources, source{
+			name:     "youtube:" + name,
+			platform: message.YouTube,
+			banner:   banner,
+			connect:  connect,
+			failed: func(err error) {
+				if errors.Is(err, youtube.ErrQuotaExhausted) {
+					fmt.Fprintln(os.Stderr, "YouTube stopped: every API key is out of quota until the daily reset at midnight Pacific. Add keys with --youtube-api-key=KEY1,KEY2 or read chat key-less with --youtube-transport=innertube.")
+					return
+				}
+				fmt.Fprintf(os.Stderr, "YouTube error: %v\n", err)
+			},
+		})
+	}
+	videoIDs := cfg.YouTube.AllVideoIDs()
+	if cfg.YouTube.Transport == "innertube" {
+		for _, id := range videoIDs {
+			client := youtube.NewInnerTubeClient(id, youtube.InnerTubeOptions{KeepRaw: cfg.KeepRaw})
+			add(id, "Connecting to video: "+id+" (key-less innertube)", client.Connect)
+			r.track(message.YouTube, client.Reconnects)
+		}
+		return sources
+	}
+
+	var oauth *youtube.OAuth
+	if cfg.Bridge && cfg.YouTube.OAuth.ClientID != "" && p.hackrTV != nil {
+		oauth = youtube.NewOAuth(youtube.OAuthOptions{
+			ClientID:     cfg.YouTube.OAuth.ClientID,
+			ClientSecret: cfg.YouTube.OAuth.ClientSecret,
+			TokenFile:    cfg.YouTube.OAuth.TokenFile,
+		})
+		// Runs the device flow on first use; the refresh token is
+		// saved so later runs start straight away
+		if err := oauth.Authorize(r.ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "YouTube OAuth error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Without video IDs a single client follows the channel
+	targets := videoIDs
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	var first *youtube.Client
+	for _, id := range targets {
+		opts := youtube.Options{
+			BaseURL:          cfg.YouTube.BaseURL,
+			ChannelID:        cfg.YouTube.ChannelID,
+			Handle:           cfg.YouTube.Handle,
+			DiscoverInterval: cfg.YouTube.DiscoverInterval,
+			MinPollInterval:  cfg.YouTube.MinPollInterval,
+			MaxPollInterval:  cfg.YouTube.MaxPollInterval,
+			SendTimeout:      cfg.SendTimeout,
+			KeepRaw:          cfg.KeepRaw,
+		}
+		name := cmp.Or(id, cfg.YouTube.Handle, cfg.YouTube.ChannelID)
+		// A restart mid-stream resumes each chat where it left off
+		if cfg.StateDir != "" {
+			opts.Checkpoint = filepath.Join(cfg.StateDir, "youtube-"+stateName(name)+".json")
+		}
+		banner := "Following channel: " + cmp.Or(cfg.YouTube.Handle, cfg.YouTube.ChannelID)
+		if id != "" {
+			banner = "Connecting to video: " + id
+		}
+		// hackr.tv chat is posted to the first video's chat
+		if first == nil {
+			opts.OAuth = oauth
+		}
+		client := youtube.NewClient(p.ytPool, id, opts)
+		if first == nil {
+			first = client
+		}
+		add(name, banner, client.Connect)
+		r.track(message.YouTube, client.Reconnects)
+	}
+	if oauth != nil {
+		p.ytPoster = first
+	}
+	return sources
+}
+
+// startSources connects every source, each on its own channel into the
+// merger, recording in the source health how each one ends. wg is done
+// once they all have.
+func (r *relay) startSources(wg *sync.WaitGroup) {
+	for _, src := range r.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.status.Banner(src.platform, "%s", src.banner)
+			connect := func() error { return src.connect(r.ctx, r.merger.Source()) }
+			if src.name == "" {
+				connect()
+				return
+			}
+			if err := r.health.run(r.ctx, src.name, connect); err != nil {
+				src.failed(err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+
+	"github.com/gdamore/tcell/v2"
+
+	"relay/internal/config"
+	"relay/internal/display"
+	"relay/internal/tui"
+)
+
+// newView makes the TUI, which shows chat in place of the printer and
+// shares its mutes, or returns nil without --tui. Typed commands go to
+// exec, and quitting calls quit.
+func newView(cfg config.Config, filter *display.Filter, keywords *display.Highlights, timestamps display.Timestamps, exec func(string) string, quit func()) *tui.TUI {
+	if !cfg.Display.TUI {
+		return nil
+	}
+	return tui.New(tui.Options{
+		Filter:      filter,
+		Exec:        exec,
+		Highlights:  keywords,
+		Bell:        cfg.Display.Bell,
+		PlainEmotes: cfg.Display.Emotes == display.EmotesPlain,
+		Timestamps:  timestamps,
+		Quit:        quit,
+	})
+}
+
+// startTUI draws view on the terminal and sends stderr's lines to it.
+// stop closes the TUI and gives stderr back to the terminal.
+func startTUI(view *tui.TUI) (stop func(), err error) {
+	screen, err := tcell.NewScreen()
+	if err == nil {
+		err = screen.Init()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		screen.Fini()
+		return nil, err
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	go func() {
+		lines := bufio.NewScanner(r)
+		for lines.Scan() {
+			view.Log(lines.Text())
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		view.Run(ctx, screen)
+	}()
+	return func() {
+		cancel()
+		<-done
+		os.Stderr = stderr
+		w.Close()
+	}, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"relay/internal/config"
+	"relay/internal/display"
+)
+
+// errNoPlatform is validate's error for a relay with nothing to read.
+var errNoPlatform = errors.New("At least one platform is required (--twitch-channel, --youtube-video-id, --youtube-channel, or --hackrtv-url)")
+
+// applyEnv fills credentials still empty from the environment, and the
+// settings that default to others: the YouTube transport, from whether
+// there is an API key, and EventSub's token and broadcaster, from the IRC
+// login and the first Twitch channel.
+func applyEnv(cfg *config.Config) {
+	if cfg.Twitch.Token == "" {
+		cfg.Twitch.Token = os.Getenv("TWITCH_OAUTH_TOKEN")
+	}
+	if len(cfg.YouTube.AllAPIKeys()) == 0 {
+		cfg.YouTube.APIKey = os.Getenv("YOUTUBE_API_KEY")
+	}
+	if cfg.YouTube.OAuth.ClientSecret == "" {
+		cfg.YouTube.OAuth.ClientSecret = os.Getenv("YOUTUBE_OAUTH_CLIENT_SECRET")
+	}
+	if cfg.HackrTV.Token == "" {
+		cfg.HackrTV.Token = os.Getenv("HACKRTV_API_TOKEN")
+	}
+
+	// Without an API key, YouTube chat is read key-less over InnerTube
+	if cfg.YouTube.Transport == "" {
+		cfg.YouTube.Transport = "api"
+		if len(cfg.YouTube.AllAPIKeys()) == 0 {
+			cfg.YouTube.Transport = "innertube"
+		}
+	}
+
+	if cfg.Twitch.EventSub.Token == "" {
+		cfg.Twitch.EventSub.Token = cfg.Twitch.Token
+	}
+	if twitchChannels := cfg.Twitch.AllChannels(); cfg.Twitch.EventSub.Broadcaster == "" && len(twitchChannels) > 0 {
+		cfg.Twitch.EventSub.Broadcaster = twitchChannels[0]
+	}
+}
+
+// validate checks settings that conflict or are out of range, after
+// applyEnv. demoMode is set for "relay demo", whose generated chat
+// replaces the platforms.
+func validate(cfg config.Config, demoMode bool) error {
+	// A consuming relay takes chat from the bus instead of reading the
+	// platforms. Their settings still name the chats the bridge mirrors,
+	// and [hackrtv] is still where it bridges to.
+	busConsume := cfg.Bus.Role == "consume"
+	switch {
+	case cfg.Bus.Role != "" && cfg.Bus.Role != "publish" && !busConsume:
+		return fmt.Errorf("--bus-role must be \"publish\" or \"consume\", got %q", cfg.Bus.Role)
+	case (cfg.Bus.Role == "") != (cfg.Bus.URL == ""):
+		return errors.New("--bus-url and --bus-role must be set together")
+	case busConsume && demoMode:
+		return errors.New("relay demo cannot consume from the bus")
+	}
+
+	if !demoMode && !busConsume && len(cfg.Twitch.AllChannels()) == 0 && !cfg.YouTube.Enabled() && cfg.HackrTV.URL == "" {
+		return errNoPlatform
+	}
+
+	if (cfg.Twitch.Nick == "") != (cfg.Twitch.Token == "") {
+		return errors.New("--twitch-nick and --twitch-token (or TWITCH_OAUTH_TOKEN env) must be set together")
+	}
+
+	if cfg.Twitch.EventSub.ClientID != "" && (cfg.Twitch.EventSub.Token == "" || cfg.Twitch.EventSub.Broadcaster == "") {
+		return errors.New("[twitch.eventsub] requires a token and a broadcaster (or a Twitch channel)")
+	}
+
+	switch {
+	case cfg.YouTube.Transport != "api" && cfg.YouTube.Transport != "innertube":
+		return fmt.Errorf("--youtube-transport must be \"api\" or \"innertube\", got %q", cfg.YouTube.Transport)
+	case !cfg.YouTube.Enabled():
+	case cfg.YouTube.Transport == "api" && len(cfg.YouTube.AllAPIKeys()) == 0:
+		return errors.New("--youtube-api-key (or YOUTUBE_API_KEY env) is required for the YouTube api transport")
+	case cfg.YouTube.Transport == "innertube" && len(cfg.YouTube.AllVideoIDs()) == 0:
+		return errors.New("following a YouTube channel requires an API key; the key-less innertube transport needs --youtube-video-id")
+	case cfg.YouTube.Transport == "innertube" && cfg.Bridge && cfg.YouTube.OAuth.ClientID != "":
+		return errors.New("posting to YouTube chat ([youtube.oauth]) requires the api transport")
+	}
+
+	if yt := cfg.YouTube; yt.MinPollInterval < 0 || yt.MaxPollInterval < 0 || yt.MaxPollInterval > 0 && yt.MinPollInterval > yt.MaxPollInterval {
+		return errors.New("[youtube] min_poll_interval must not exceed max_poll_interval")
+	}
+
+	if o := cfg.Display.Output; o != "" && o != "text" && o != "json" {
+		return fmt.Errorf("--output must be \"text\" or \"json\", got %q", o)
+	}
+	if e := cfg.Display.Emotes; e != "" && e != display.EmotesText && e != display.EmotesImages && e != display.EmotesPlain {
+		return fmt.Errorf("--emotes must be %q, %q, or %q, got %q", display.EmotesText, display.EmotesImages, display.EmotesPlain, e)
+	}
+	if cfg.Display.Width < -1 {
+		return fmt.Errorf("[display] width must be a column count, or -1 to never wrap, got %d", cfg.Display.Width)
+	}
+	if cfg.Display.Output == "json" && cfg.Display.Template != "" {
+		return errors.New("--output-template applies to text output, not --output=json")
+	}
+	if cfg.Display.TUI && (cfg.Display.Output == "json" || cfg.Display.Template != "") {
+		return errors.New("--tui replaces the text output, so it can't be combined with --output=json or --output-template")
+	}
+
+	if (cfg.API.Dashboard || cfg.API.DashboardControls) && cfg.API.Listen == "" {
+		return errors.New("--dashboard requires --api-listen")
+	}
+
+	if cfg.ReplayWindow < 0 {
+		return errors.New("--replay-window must not be negative")
+	}
+
+	if cfg.SendTimeout < 0 {
+		return errors.New("--send-timeout must not be negative")
+	}
+
+	if cfg.HackrTV.URL != "" && len(cfg.HackrTV.AllChannels()) == 0 {
+		return errors.New("--hackrtv-channel must name at least one channel")
+	}
+
+	for _, s := range cfg.HackrTV.Subscriptions {
+		if s.Channel == "" {
+			return errors.New("every [[hackrtv.subscriptions]] entry needs a channel class")
+		}
+	}
+
+	if cfg.Bridge && !cfg.BridgeDryRun && (cfg.HackrTV.URL == "" || cfg.HackrTV.Token == "") {
+		return errors.New("--bridge requires --hackrtv-url and --hackrtv-token")
+	}
+
+	if cfg.HackrTV.AuthMode != "admin" && cfg.HackrTV.AuthMode != "user" {
+		return fmt.Errorf("--hackrtv-auth-mode must be \"admin\" or \"user\", got %q", cfg.HackrTV.AuthMode)
+	}
+
+	if busConsume && cfg.Bridge && cfg.HackrTV.AuthMode == "user" {
+		return errors.New("a relay consuming from the bus bridges with auth_mode = \"admin\" only, as it doesn't connect to hackr.tv")
+	}
+
+	if cfg.BridgeOrder != "best_effort" && cfg.BridgeOrder != "strict" {
+		return fmt.Errorf("--bridge-order must be \"best_effort\" or \"strict\", got %q", cfg.BridgeOrder)
+	}
+	if cfg.BridgeRate < 0 || cfg.BridgeBurst < 0 || cfg.BridgeMaxLength < 0 || cfg.BridgeWorkers < 0 || cfg.BridgeBreaker < 0 || cfg.BridgeBreakerCooldown < 0 {
+		return errors.New("--bridge-rate, --bridge-burst, --bridge-max-length, --bridge-workers, --bridge-breaker, and --bridge-breaker-cooldown must not be negative")
+	}
+	if cfg.BridgeOrder == "strict" && cfg.BridgeWorkers > 1 {
+		return fmt.Errorf("--bridge-workers %d requires --bridge-order=best_effort", cfg.BridgeWorkers)
+	}
+
+	for name, sc := range cfg.Sinks {
+		if !slices.Contains([]string{"printer", "uplink", "supporters", "twitch", "youtube", "replies", "bus", "chat_log", "notifications"}, name) {
+			return fmt.Errorf("unknown sink %q in [sinks] (expected printer, uplink, supporters, twitch, youtube, replies, bus, chat_log, or notifications)", name)
+		}
+		if err := markupOptions(sc).Validate(); err != nil {
+			return fmt.Errorf("[sinks.%s.markup] %w", name, err)
+		}
+	}
+
+	for _, name := range []string{"uplink", "supporters"} {
+		if cfg.BridgeOrder == "strict" && cfg.Sinks[name].Concurrency > 1 {
+			return fmt.Errorf("bridge_order = \"strict\" requires [sinks.%s] concurrency = 1", name)
+		}
+	}
+
+	if cfg.Supporters.Channel != "" && !cfg.Bridge {
+		return errors.New("[supporters] channel requires --bridge")
+	}
+	// Regular hackrs post over the cable, which only reaches the first
+	// channel
+	if cfg.Supporters.Channel != "" && cfg.HackrTV.AuthMode == "user" {
+		return errors.New("[supporters] channel requires auth_mode = \"admin\"")
+	}
+	return nil
+}